@@ -0,0 +1,72 @@
+package toxiproxy
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// parseClientRange parses an entry of the allow or deny list of a proxy: a
+// CIDR, e.g. 10.0.0.0/8, or a single IP.
+func parseClientRange(entry string) (netip.Prefix, error) {
+	if !strings.Contains(entry, "/") {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+func validateClientAccess(allow, deny []string) error {
+	for _, entries := range [][]string{allow, deny} {
+		for _, entry := range entries {
+			_, err := parseClientRange(entry)
+			if err != nil {
+				return joinError(
+					fmt.Errorf("%q is not a CIDR or an IP: %w", entry, err),
+					ErrInvalidClientAccess,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// clientAllowed reports whether a client can connect to the proxy: its IP is
+// in none of the ranges of Deny and, when Allow is set, in one of them. The
+// clients of unix sockets have no IP and are always allowed.
+func (proxy *Proxy) clientAllowed(client net.Addr) bool {
+	proxy.Toxics.Lock()
+	allow, deny := proxy.Allow, proxy.Deny
+	proxy.Toxics.Unlock()
+
+	if len(allow) == 0 && len(deny) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(client.String())
+	if err != nil {
+		return true
+	}
+	addr := addrPort.Addr().Unmap().WithZone("")
+	if matchesClientRange(deny, addr) {
+		return false
+	}
+	return len(allow) == 0 || matchesClientRange(allow, addr)
+}
+
+func matchesClientRange(entries []string, addr netip.Addr) bool {
+	for _, entry := range entries {
+		prefix, err := parseClientRange(entry)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package toxiproxy_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+func TestProxyAllowsAndDeniesClients(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test_access", upstream.Addr().String())
+	proxy.Listen = "127.0.0.1:0"
+	err = proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	cases := []struct {
+		allow, deny []string
+		allowed     bool
+	}{
+		{nil, nil, true},
+		{[]string{"127.0.0.0/8"}, nil, true},
+		{[]string{"10.0.0.0/8", "127.0.0.1"}, nil, true},
+		{[]string{"10.0.0.0/8"}, nil, false},
+		{nil, []string{"127.0.0.1/32"}, false},
+		{[]string{"127.0.0.0/8"}, []string{"127.0.0.1"}, false},
+		{nil, []string{"::1", "10.0.0.0/8"}, true},
+	}
+	for _, c := range cases {
+		err = proxy.SetOptions(&toxiproxy.Proxy{Allow: c.allow, Deny: c.deny})
+		if err != nil {
+			t.Fatal("Failed to set the access lists:", err)
+		}
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		if c.allowed {
+			assertEcho(t, conn)
+		} else {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = conn.Read(make([]byte, 1))
+			if err != io.EOF {
+				t.Errorf("Expected the client to be rejected with allow %v and deny %v, got %v",
+					c.allow, c.deny, err)
+			}
+		}
+		conn.Close()
+	}
+
+	if rejected := proxy.Stats.Counters().RejectedConnections; rejected != 3 {
+		t.Errorf("Expected 3 rejected connections, got %d", rejected)
+	}
+}
@@ -1,18 +1,24 @@
 package toxiproxy
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 
+	"github.com/Shopify/toxiproxy/v2/stream"
 	"github.com/Shopify/toxiproxy/v2/toxics"
 )
 
@@ -27,14 +33,57 @@ func stopBrowsersMiddleware(next http.Handler) http.Handler {
 }
 
 func timeoutMiddleware(next http.Handler) http.Handler {
-	return http.TimeoutHandler(next, 25*time.Second, "")
+	timeout := http.TimeoutHandler(next, 25*time.Second, "")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if waitRoute(r) {
+			next.ServeHTTP(w, r)
+		} else {
+			timeout.ServeHTTP(w, r)
+		}
+	})
 }
 
 type ApiServer struct {
 	Collection *ProxyCollection
 	Metrics    *metricsContainer
 	Logger     *zerolog.Logger
-	http       *http.Server
+	Events     *EventBuffer
+	// Toxics holds the toxic types the proxies of the server can use.
+	Toxics *toxics.Registry
+	// ListenFunc and DialFunc are the default transports of the proxies of
+	// the server, TCP if not set.
+	ListenFunc ListenFunc
+	DialFunc   DialFunc
+	// MaxConnections is the largest number of clients connected to all the
+	// proxies of the server at once, no limit if not set.
+	MaxConnections int
+	// RateLimit is the number of API requests per second of each client,
+	// with bursts of RateBurst requests, and MaxBodySize the largest body of
+	// a request in bytes, no limit if not set. They are read by Routes.
+	RateLimit   float64
+	RateBurst   int
+	MaxBodySize int64
+	// CORSOrigins are the origins whose browsers can use the API, e.g.
+	// "http://localhost:3000" for a dashboard, or "*" for all of them.
+	CORSOrigins []string
+	// UI serves a web UI of the proxies, their toxics and the events under /ui.
+	UI bool
+	// Strict rejects the fields of the API requests and of the config file
+	// that are unknown, e.g. a "latancy" typo, instead of ignoring them.
+	// Requests can ask to be strict or not with a X-Toxiproxy-Strict header.
+	Strict bool
+	// Debug exposes pprof and the internal state of the server under /debug.
+	Debug       bool
+	connections *connectionLimit
+	seeds       *seedSource
+	ports       *portPool
+	namespaces  *namespaces
+	chaos       *chaosController
+	bound       *boundAddresses
+	readiness   *readiness
+	http        *http.Server
+	listener    net.Listener
+	logging     *logControl
 }
 
 const (
@@ -42,29 +91,186 @@ const (
 	read_timeout = 15 * time.Second
 )
 
-func NewServer(m *metricsContainer, logger zerolog.Logger) *ApiServer {
+type serverOptions struct {
+	logger   zerolog.Logger
+	metrics  *metricsContainer
+	listener net.Listener
+	toxics   *toxics.Registry
+	listen   ListenFunc
+	dial     DialFunc
+	maxConns int
+	seed     int64
+	rate     float64
+	burst    int
+	maxBody  int64
+	origins  []string
+}
+
+// ServerOption configures a server created with New.
+type ServerOption func(*serverOptions)
+
+// WithLogger logs with the given logger, instead of discarding the logs.
+func WithLogger(logger zerolog.Logger) ServerOption {
+	return func(options *serverOptions) {
+		options.logger = logger
+	}
+}
+
+// WithMetricsRegistry registers the metrics of the server in the given
+// registry, instead of a new one.
+func WithMetricsRegistry(registry *prometheus.Registry) ServerOption {
+	return func(options *serverOptions) {
+		options.metrics = NewMetricsContainer(registry)
+	}
+}
+
+// WithListener serves the API on the given listener, instead of listening on
+// the address given to Listen.
+func WithListener(listener net.Listener) ServerOption {
+	return func(options *serverOptions) {
+		options.listener = listener
+	}
+}
+
+// WithToxicRegistry restricts the toxics of the server to the ones of the
+// given registry, instead of the default registry.
+func WithToxicRegistry(registry *toxics.Registry) ServerOption {
+	return func(options *serverOptions) {
+		options.toxics = registry
+	}
+}
+
+// WithProxyListener makes proxies accept their clients from the listeners
+// returned by listen, instead of TCP listeners.
+func WithProxyListener(listen ListenFunc) ServerOption {
+	return func(options *serverOptions) {
+		options.listen = listen
+	}
+}
+
+// WithDialer makes proxies connect to their upstream with dial, instead of
+// over TCP.
+func WithDialer(dial DialFunc) ServerOption {
+	return func(options *serverOptions) {
+		options.dial = dial
+	}
+}
+
+// WithMaxConnections limits the number of clients connected to all the
+// proxies of the server at once.
+func WithMaxConnections(max int) ServerOption {
+	return func(options *serverOptions) {
+		options.maxConns = max
+	}
+}
+
+// WithRateLimit limits the API requests of each client to rate per second,
+// with bursts of burst requests, or of a second of requests if burst is 0.
+func WithRateLimit(rate float64, burst int) ServerOption {
+	return func(options *serverOptions) {
+		options.rate = rate
+		options.burst = burst
+	}
+}
+
+// WithMaxBodySize rejects the API requests with a body larger than size bytes.
+func WithMaxBodySize(size int64) ServerOption {
+	return func(options *serverOptions) {
+		options.maxBody = size
+	}
+}
+
+// WithCORSOrigins lets the browsers of the origins use the API, or of all the
+// origins with "*", instead of rejecting the requests of browsers.
+func WithCORSOrigins(origins ...string) ServerOption {
+	return func(options *serverOptions) {
+		options.origins = origins
+	}
+}
+
+// WithSeed seeds the toxics added without a seed, so that their random
+// values are the same each time the server runs. The seed is random if not
+// set.
+func WithSeed(seed int64) ServerOption {
+	return func(options *serverOptions) {
+		options.seed = seed
+	}
+}
+
+// New creates a server to embed Toxiproxy in a Go program. The API is served
+// once Listen is called.
+func New(opts ...ServerOption) *ApiServer {
+	options := serverOptions{
+		logger: zerolog.Nop(),
+		toxics: toxics.DefaultRegistry,
+		seed:   time.Now().UnixNano(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.metrics == nil {
+		options.metrics = NewMetricsContainer(prometheus.NewRegistry())
+	}
+
+	logging, logger := newServerLogControl(options.logger)
 	return &ApiServer{
-		Collection: NewProxyCollection(),
-		Metrics:    m,
-		Logger:     &logger,
+		Collection:     NewProxyCollection(),
+		Metrics:        options.metrics,
+		Logger:         &logger,
+		Events:         NewEventBuffer(DefaultEventBufferSize),
+		Toxics:         options.toxics,
+		ListenFunc:     options.listen,
+		DialFunc:       options.dial,
+		MaxConnections: options.maxConns,
+		RateLimit:      options.rate,
+		RateBurst:      options.burst,
+		MaxBodySize:    options.maxBody,
+		CORSOrigins:    options.origins,
+		connections:    newConnectionLimit(),
+		seeds:          newSeedSource(options.seed),
+		namespaces:     newNamespaces(),
+		bound:          newBoundAddresses(),
+		readiness:      newReadiness(),
+		chaos:          new(chaosController),
+		listener:       options.listener,
+		logging:        logging,
 	}
 }
 
+func NewServer(m *metricsContainer, logger zerolog.Logger) *ApiServer {
+	return New(WithLogger(logger), func(options *serverOptions) {
+		options.metrics = m
+	})
+}
+
+// Listen serves the API on addr, or on the listener given with WithListener
+// in which case addr is ignored. It blocks until the server is shut down. The
+// address is a TCP address, or a unix socket written unix:/path, or
+// unix:@name for an abstract socket on Linux.
 func (server *ApiServer) Listen(addr string) error {
+	listener := server.listener
+	if listener == nil {
+		var err error
+		listener, err = listenAPI(addr)
+		if err != nil {
+			return err
+		}
+	}
+
 	server.Logger.
 		Info().
-		Str("address", addr).
+		Str("address", listener.Addr().String()).
 		Msg("Starting Toxiproxy HTTP server")
 
 	server.http = &http.Server{
-		Addr:         addr,
 		Handler:      server.Routes(),
 		WriteTimeout: wait_timeout,
 		ReadTimeout:  read_timeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	err := server.http.ListenAndServe()
+	server.readiness.listen()
+	err := server.http.Serve(listener)
 	if err == http.ErrServerClosed {
 		err = nil
 	}
@@ -72,7 +278,47 @@ func (server *ApiServer) Listen(addr string) error {
 	return err
 }
 
+// listenAPI listens on the address of the API, with the socket file of a unix
+// socket only accessible to the user of the server.
+func listenAPI(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	abstract := strings.HasPrefix(path, "@")
+	if !abstract {
+		removeStaleSocket(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil || abstract {
+		return listener, err
+	}
+	// Only the user of the server can use the API.
+	err = os.Chmod(path, 0o600)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the unix socket of a server that exited without
+// removing it, which nothing accepts connections on.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != os.ModeSocket {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
 func (server *ApiServer) Shutdown() error {
+	server.StopChaos()
 	if server.http == nil {
 		return nil
 	}
@@ -106,9 +352,61 @@ func (server *ApiServer) Routes() *mux.Router {
 			Str("handler", handler).
 			Msg("")
 	}))
-	r.Use(stopBrowsersMiddleware)
+	r.Use(tracingMiddleware)
+	r.Use(server.corsMiddleware)
+	r.Use(server.limitsMiddleware())
 	r.Use(timeoutMiddleware)
 
+	if len(server.CORSOrigins) > 0 {
+		r.Methods("OPTIONS").HandlerFunc(server.Preflight).Name("Preflight")
+	}
+	server.proxyRoutes(r)
+	namespace := r.PathPrefix("/namespaces/{namespace:" + namespacePattern + "}").Subrouter()
+	namespace.HandleFunc("", server.NamespaceDelete).Methods("DELETE").
+		Name("NamespaceDelete")
+	server.proxyRoutes(namespace)
+
+	r.HandleFunc("/presets", server.PresetIndex).Methods("GET").
+		Name("PresetIndex")
+
+	r.HandleFunc("/chaos", server.ChaosShow).Methods("GET").
+		Name("ChaosShow")
+	r.HandleFunc("/chaos", server.ChaosStart).Methods("PUT").
+		Name("ChaosStart")
+	r.HandleFunc("/chaos", server.ChaosStop).Methods("DELETE").
+		Name("ChaosStop")
+
+	r.HandleFunc("/events/recent", server.EventsRecent).Methods("GET").
+		Name("EventsRecent")
+
+	r.HandleFunc("/settings/logging", server.LogSettingsShow).Methods("GET").
+		Name("LogSettingsShow")
+	r.HandleFunc("/settings/logging", server.LogSettingsUpdate).Methods("PUT").
+		Name("LogSettingsUpdate")
+
+	r.HandleFunc("/toxics", server.ToxicTypeIndex).Methods("GET").Name("ToxicTypeIndex")
+	r.HandleFunc("/version", server.Version).Methods("GET").Name("Version")
+	r.HandleFunc("/ready", server.Ready).Methods("GET").Name("Ready")
+	r.HandleFunc("/live", server.Live).Methods("GET").Name("Live")
+
+	if server.Metrics.anyMetricsEnabled() {
+		r.Handle("/metrics", server.Metrics.handler()).Name("Metrics")
+	}
+
+	if server.Debug {
+		server.debugRoutes(r)
+	}
+
+	if server.UI {
+		server.uiRoutes(r)
+	}
+
+	return r
+}
+
+// proxyRoutes adds the routes of the proxies of a namespace, or of the
+// proxies outside of namespaces.
+func (server *ApiServer) proxyRoutes(r *mux.Router) {
 	r.HandleFunc("/reset", server.ResetState).Methods("POST").
 		Name("ResetState")
 	r.HandleFunc("/proxies", server.ProxyIndex).Methods("GET").
@@ -117,50 +415,88 @@ func (server *ApiServer) Routes() *mux.Router {
 		Name("ProxyCreate")
 	r.HandleFunc("/populate", server.Populate).Methods("POST").
 		Name("Populate")
+	server.snapshotRoutes(r)
+	r.HandleFunc("/listen", server.ListenCheck).Methods("GET").
+		Name("ListenCheck")
 	r.HandleFunc("/proxies/{proxy}", server.ProxyShow).Methods("GET").
 		Name("ProxyShow")
 	r.HandleFunc("/proxies/{proxy}", server.ProxyUpdate).Methods("POST", "PATCH").
 		Name("ProxyUpdate")
 	r.HandleFunc("/proxies/{proxy}", server.ProxyDelete).Methods("DELETE").
 		Name("ProxyDelete")
+	r.HandleFunc("/proxies/{proxy}/rename", server.ProxyRename).Methods("POST").
+		Name("ProxyRename")
+	r.HandleFunc("/proxies/{proxy}/move", server.ProxyMove).Methods("POST").
+		Name("ProxyMove")
+	r.HandleFunc("/proxies/{proxy}/listen", server.ProxyListen).Methods("GET").
+		Name("ProxyListen")
+	r.HandleFunc("/proxies/{proxy}/wait", server.ProxyWait).Methods("GET").
+		Name("ProxyWait")
+	r.HandleFunc("/proxies/{proxy}/directions/{direction}", server.DirectionUpdate).
+		Methods("PUT").
+		Name("DirectionUpdate")
 	r.HandleFunc("/proxies/{proxy}/toxics", server.ToxicIndex).Methods("GET").
 		Name("ToxicIndex")
 	r.HandleFunc("/proxies/{proxy}/toxics", server.ToxicCreate).Methods("POST").
 		Name("ToxicCreate")
+	r.HandleFunc("/proxies/{proxy}/toxics/order", server.ToxicReorder).Methods("PUT").
+		Name("ToxicReorder")
 	r.HandleFunc("/proxies/{proxy}/toxics/{toxic}", server.ToxicShow).Methods("GET").
 		Name("ToxicShow")
 	r.HandleFunc("/proxies/{proxy}/toxics/{toxic}", server.ToxicUpdate).Methods("POST", "PATCH").
 		Name("ToxicUpdate")
 	r.HandleFunc("/proxies/{proxy}/toxics/{toxic}", server.ToxicDelete).Methods("DELETE").
 		Name("ToxicDelete")
-
-	r.HandleFunc("/version", server.Version).Methods("GET").Name("Version")
-
-	if server.Metrics.anyMetricsEnabled() {
-		r.Handle("/metrics", server.Metrics.handler()).Name("Metrics")
-	}
-
-	return r
+	r.HandleFunc("/proxies/{proxy}/toxics/{toxic}/resume", server.ToxicResume).Methods("POST").
+		Name("ToxicResume")
+
+	r.HandleFunc("/proxies/{proxy}/connections", server.ConnectionIndex).Methods("GET").
+		Name("ConnectionIndex")
+	r.HandleFunc("/proxies/{proxy}/connections/{connection}", server.ConnectionDelete).
+		Methods("DELETE").
+		Name("ConnectionDelete")
+
+	r.HandleFunc("/proxies/{proxy}/presets/{preset}", server.PresetApply).Methods("POST").
+		Name("PresetApply")
+	r.HandleFunc("/proxies/{proxy}/presets/{preset}", server.PresetRemove).Methods("DELETE").
+		Name("PresetRemove")
 }
 
 func (server *ApiServer) PopulateConfig(filename string) {
-	file, err := os.Open(filename)
+	server.readiness.populate()
+	server.readiness.populated(server.populateConfig(filename))
+}
+
+func (server *ApiServer) populateConfig(filename string) error {
+	data, err := os.ReadFile(filename)
 	logger := server.Logger
 	if err != nil {
 		logger.Err(err).Str("config", filename).Msg("Error reading config file")
-		return
+		return err
 	}
 
-	proxies, err := server.Collection.PopulateJson(server, file)
+	if server.Strict {
+		err = checkFields(data, &[]proxyFields{})
+		if err != nil {
+			logger.Err(err).Str("config", filename).Msg("Failed to populate proxies from file")
+			return err
+		}
+	}
+	proxies, err := server.Collection.PopulateJson(server, bytes.NewReader(data))
 	if err != nil {
 		logger.Err(err).Msg("Failed to populate proxies from file")
 	} else {
 		logger.Info().Int("proxies", len(proxies)).Msg("Populated proxies from file")
 	}
+	return err
 }
 
 func (server *ApiServer) ProxyIndex(response http.ResponseWriter, request *http.Request) {
-	proxies := server.Collection.Proxies()
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	proxies := collection.Proxies()
 	marshalData := make(map[string]interface{}, len(proxies))
 
 	for name, proxy := range proxies {
@@ -182,7 +518,11 @@ func (server *ApiServer) ProxyIndex(response http.ResponseWriter, request *http.
 
 func (server *ApiServer) ResetState(response http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
-	proxies := server.Collection.Proxies()
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	proxies := collection.Proxies()
 
 	for _, proxy := range proxies {
 		err := proxy.Start()
@@ -191,10 +531,13 @@ func (server *ApiServer) ResetState(response http.ResponseWriter, request *http.
 		}
 
 		proxy.Toxics.ResetToxics(ctx)
+		for direction := range stream.NumDirections {
+			proxy.SetDirectionEnabled(direction, true)
+		}
 	}
 
 	response.WriteHeader(http.StatusNoContent)
-	_, err := response.Write(nil)
+	_, err = response.Write(nil)
 	if err != nil {
 		log := zerolog.Ctx(ctx)
 		log.Warn().Err(err).Msg("ResetState: Failed to write headers to client")
@@ -204,7 +547,11 @@ func (server *ApiServer) ResetState(response http.ResponseWriter, request *http.
 func (server *ApiServer) ProxyCreate(response http.ResponseWriter, request *http.Request) {
 	// Default fields to enable the proxy right away
 	input := Proxy{Enabled: true}
-	err := json.NewDecoder(request.Body).Decode(&input)
+	err := server.checkBody(request, &proxyFields{})
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&input)
 	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
 		return
 	}
@@ -213,14 +560,24 @@ func (server *ApiServer) ProxyCreate(response http.ResponseWriter, request *http
 		server.apiError(response, joinError(fmt.Errorf("name"), ErrMissingField))
 		return
 	}
-	if len(input.Upstream) < 1 {
+	if len(input.Upstream) < 1 && needsUpstream(input.Protocol) {
 		server.apiError(response, joinError(fmt.Errorf("upstream"), ErrMissingField))
 		return
 	}
 
+	err = validateOptions(&input)
+	if server.apiError(response, err) {
+		return
+	}
+
 	proxy := NewProxy(server, input.Name, input.Listen, input.Upstream)
+	proxy.copyOptions(&input)
 
-	err = server.Collection.Add(proxy, input.Enabled)
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = collection.Add(proxy, input.Enabled)
 	if server.apiError(response, err) {
 		return
 	}
@@ -240,7 +597,19 @@ func (server *ApiServer) ProxyCreate(response http.ResponseWriter, request *http
 }
 
 func (server *ApiServer) Populate(response http.ResponseWriter, request *http.Request) {
-	proxies, err := server.Collection.PopulateJson(server, request.Body)
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	options, err := populateOptions(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = server.checkBody(request, &[]proxyFields{})
+	if server.apiError(response, err) {
+		return
+	}
+	proxies, plan, err := collection.ReconcileJson(server, request.Body, options)
 	log := zerolog.Ctx(request.Context())
 	if err != nil {
 		log.Warn().Err(err).Msg("Populate errors")
@@ -249,18 +618,22 @@ func (server *ApiServer) Populate(response http.ResponseWriter, request *http.Re
 	apiErr, ok := err.(*ApiError)
 	if !ok && err != nil {
 		log.Warn().Err(err).Msg("Error did not include status code")
-		apiErr = &ApiError{err.Error(), http.StatusInternalServerError}
+		apiErr = internalError(err)
 	}
 
 	data, err := json.Marshal(struct {
 		*ApiError `json:",omitempty"`
 		Proxies   []proxyToxics `json:"proxies"`
-	}{apiErr, proxiesWithToxics(proxies)})
+		Plan      *PopulatePlan `json:"plan,omitempty"`
+	}{apiErr, proxiesWithToxics(proxies), plan})
 	if server.apiError(response, err) {
 		return
 	}
 
 	responseCode := http.StatusCreated
+	if options.DryRun {
+		responseCode = http.StatusOK
+	}
 	if apiErr != nil {
 		responseCode = apiErr.StatusCode
 	}
@@ -273,10 +646,26 @@ func (server *ApiServer) Populate(response http.ResponseWriter, request *http.Re
 	}
 }
 
-func (server *ApiServer) ProxyShow(response http.ResponseWriter, request *http.Request) {
-	vars := mux.Vars(request)
+// populateOptions parses the prune and dry_run parameters of a populate.
+func populateOptions(request *http.Request) (PopulateOptions, error) {
+	var options PopulateOptions
+	query := request.URL.Query()
+	for name, option := range map[string]*bool{"prune": &options.Prune, "dry_run": &options.DryRun} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		var err error
+		*option, err = strconv.ParseBool(value)
+		if err != nil {
+			return options, joinError(fmt.Errorf("%s=%q", name, value), ErrInvalidPopulateOption)
+		}
+	}
+	return options, nil
+}
 
-	proxy, err := server.Collection.Get(vars["proxy"])
+func (server *ApiServer) ProxyShow(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
@@ -293,21 +682,77 @@ func (server *ApiServer) ProxyShow(response http.ResponseWriter, request *http.R
 	}
 }
 
+// ProxyListen returns the address a proxy listens on, e.g. the port of the
+// pool it was given, without its toxics and stats.
+func (server *ApiServer) ProxyListen(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	proxy.Lock()
+	listen := struct {
+		Name    string `json:"name"`
+		Listen  string `json:"listen"`
+		Enabled bool   `json:"enabled"`
+	}{proxy.Name, proxy.Listen, proxy.Enabled}
+	proxy.Unlock()
+	data, err := json.Marshal(listen)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		server.Logger.Warn().Err(err).Msg("ProxyListen: Failed to write response to client")
+	}
+}
+
 func (server *ApiServer) ProxyUpdate(response http.ResponseWriter, request *http.Request) {
 	log := zerolog.Ctx(request.Context())
 	if request.Method == "POST" {
 		log.Warn().Msg("ProxyUpdate: HTTP method POST is depercated. Use HTTP PATCH instead.")
 	}
 
-	vars := mux.Vars(request)
-
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
 
 	// Default fields are the same as existing proxy
-	input := Proxy{Listen: proxy.Listen, Upstream: proxy.Upstream, Enabled: proxy.Enabled}
+	input := Proxy{
+		Listen:            proxy.Listen,
+		Upstream:          proxy.Upstream,
+		Enabled:           proxy.Enabled,
+		Protocol:          proxy.Protocol,
+		ReadBufferSize:    proxy.ReadBufferSize,
+		ChannelDepth:      proxy.ChannelDepth,
+		Backpressure:      proxy.Backpressure,
+		BackpressureBytes: proxy.BackpressureBytes,
+		MaxConnections:    proxy.MaxConnections,
+		OnLimit:           proxy.OnLimit,
+		LimitTimeout:      proxy.LimitTimeout,
+		HangProbability:   proxy.HangProbability,
+		HangTimeout:       proxy.HangTimeout,
+		DialTimeout:       proxy.DialTimeout,
+		DialRetries:       proxy.DialRetries,
+		DialBackoff:       proxy.DialBackoff,
+		UpstreamProxy:     proxy.UpstreamProxy,
+		UpstreamBind:      proxy.UpstreamBind,
+		DualStack:         proxy.DualStack,
+		Allow:             proxy.Allow,
+		Deny:              proxy.Deny,
+		IdleTimeout:       proxy.IdleTimeout,
+		MaxConnectionAge:  proxy.MaxConnectionAge,
+		OnStop:            proxy.OnStop,
+		Socket:            proxy.Socket,
+		HealthCheck:       proxy.HealthCheck,
+	}
+	err = server.checkBody(request, &proxyFields{})
+	if server.apiError(response, err) {
+		return
+	}
 	err = json.NewDecoder(request.Body).Decode(&input)
 	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
 		return
@@ -330,10 +775,95 @@ func (server *ApiServer) ProxyUpdate(response http.ResponseWriter, request *http
 	}
 }
 
+// ProxyRename renames a proxy, keeping its listener, its toxics, its stats and
+// its connections.
+func (server *ApiServer) ProxyRename(response http.ResponseWriter, request *http.Request) {
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	input := struct {
+		Name string `json:"name"`
+	}{}
+	err = server.checkBody(request, &input)
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&input)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+	if input.Name == "" {
+		server.apiError(response, joinError(fmt.Errorf("name"), ErrMissingField))
+		return
+	}
+
+	proxy, err := collection.Rename(mux.Vars(request)["proxy"], input.Name)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(proxyWithToxics(proxy))
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ProxyRename: Failed to write response to client")
+	}
+}
+
+// ProxyMove points a proxy to another upstream for its next clients, keeping,
+// draining or resetting the connections of the others.
+func (server *ApiServer) ProxyMove(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	input := struct {
+		Upstream string `json:"upstream"`
+		Switchover
+	}{}
+	err = server.checkBody(request, &input)
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&input)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+
+	err = proxy.Switch(input.Upstream, input.Switchover)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(proxyWithToxics(proxy))
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ProxyMove: Failed to write response to client")
+	}
+}
+
 func (server *ApiServer) ProxyDelete(response http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
 
-	err := server.Collection.Remove(vars["proxy"])
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = collection.Remove(vars["proxy"])
 	if server.apiError(response, err) {
 		return
 	}
@@ -347,9 +877,7 @@ func (server *ApiServer) ProxyDelete(response http.ResponseWriter, request *http
 }
 
 func (server *ApiServer) ToxicIndex(response http.ResponseWriter, request *http.Request) {
-	vars := mux.Vars(request)
-
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
@@ -369,13 +897,15 @@ func (server *ApiServer) ToxicIndex(response http.ResponseWriter, request *http.
 }
 
 func (server *ApiServer) ToxicCreate(response http.ResponseWriter, request *http.Request) {
-	vars := mux.Vars(request)
-
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
 
+	err = server.checkBody(request, &toxicFields{})
+	if server.apiError(response, err) {
+		return
+	}
 	toxic, err := proxy.Toxics.AddToxicJson(request.Body)
 	if server.apiError(response, err) {
 		return
@@ -397,7 +927,7 @@ func (server *ApiServer) ToxicCreate(response http.ResponseWriter, request *http
 func (server *ApiServer) ToxicShow(response http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
 
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
@@ -429,11 +959,15 @@ func (server *ApiServer) ToxicUpdate(response http.ResponseWriter, request *http
 
 	vars := mux.Vars(request)
 
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
 
+	err = server.checkBody(request, &toxicFields{})
+	if server.apiError(response, err) {
+		return
+	}
 	toxic, err := proxy.Toxics.UpdateToxicJson(vars["toxic"], request.Body)
 	if server.apiError(response, err) {
 		return
@@ -451,12 +985,66 @@ func (server *ApiServer) ToxicUpdate(response http.ResponseWriter, request *http
 	}
 }
 
+func (server *ApiServer) ToxicResume(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	toxic, err := proxy.Toxics.ResumeToxic(mux.Vars(request)["toxic"])
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(toxic)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ToxicResume: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) ToxicReorder(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	var names []string
+	err = json.NewDecoder(request.Body).Decode(&names)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+
+	err = proxy.Toxics.ReorderToxics(request.Context(), names)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(proxy.Toxics.GetToxicArray())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ToxicReorder: Failed to write response to client")
+	}
+}
+
 func (server *ApiServer) ToxicDelete(response http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
 	ctx := request.Context()
 	log := zerolog.Ctx(ctx)
 
-	proxy, err := server.Collection.Get(vars["proxy"])
+	proxy, err := server.proxy(request)
 	if server.apiError(response, err) {
 		return
 	}
@@ -473,6 +1061,68 @@ func (server *ApiServer) ToxicDelete(response http.ResponseWriter, request *http
 	}
 }
 
+func (server *ApiServer) LogSettingsShow(response http.ResponseWriter, request *http.Request) {
+	settings, err := server.LogSettings(request.URL.Query().Get("proxy"))
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(settings)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("LogSettingsShow: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) LogSettingsUpdate(response http.ResponseWriter, request *http.Request) {
+	input := LogSettings{}
+	err := server.checkBody(request, &LogSettings{})
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&input)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+
+	settings, err := server.UpdateLogSettings(input)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(settings)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("LogSettingsUpdate: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) ToxicTypeIndex(response http.ResponseWriter, request *http.Request) {
+	data, err := json.Marshal(server.Toxics.Types())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ToxicTypeIndex: Failed to write response to client")
+	}
+}
+
 func (server *ApiServer) Version(response http.ResponseWriter, request *http.Request) {
 	log := zerolog.Ctx(request.Context())
 
@@ -487,42 +1137,254 @@ func (server *ApiServer) Version(response http.ResponseWriter, request *http.Req
 type ApiError struct {
 	Message    string `json:"error"`
 	StatusCode int    `json:"status"`
+	// Code identifies the cause of the error for programs, e.g. proxy_not_found.
+	Code string `json:"code"`
 }
 
 func (e *ApiError) Error() string {
 	return e.Message
 }
 
-func newError(msg string, status int) *ApiError {
-	return &ApiError{msg, status}
+func newError(code, msg string, status int) *ApiError {
+	return &ApiError{Message: msg, StatusCode: status, Code: code}
 }
 
 func joinError(err error, wrapper *ApiError) *ApiError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		wrapper = ErrRequestTooLarge
+	}
 	if err != nil {
-		return &ApiError{wrapper.Message + ": " + err.Error(), wrapper.StatusCode}
+		return &ApiError{
+			Message:    wrapper.Message + ": " + err.Error(),
+			StatusCode: wrapper.StatusCode,
+			Code:       wrapper.Code,
+		}
 	}
 	return nil
 }
 
+// internalError wraps an error without a status code.
+func internalError(err error) *ApiError {
+	return newError("internal_error", err.Error(), http.StatusInternalServerError)
+}
+
+// attributesError tells which attribute of a toxic could not be decoded in
+// its code, e.g. invalid_attribute:latency.
+func attributesError(err error) *ApiError {
+	apiErr := joinError(err, ErrBadRequestBody)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && strings.HasPrefix(typeErr.Field, "attributes.") {
+		apiErr.Code = "invalid_attribute:" + strings.TrimPrefix(typeErr.Field, "attributes.")
+	}
+	return apiErr
+}
+
 var (
-	ErrBadRequestBody     = newError("bad request body", http.StatusBadRequest)
-	ErrMissingField       = newError("missing required field", http.StatusBadRequest)
-	ErrProxyNotFound      = newError("proxy not found", http.StatusNotFound)
-	ErrProxyAlreadyExists = newError("proxy already exists", http.StatusConflict)
+	ErrBadRequestBody = newError("bad_request_body", "bad request body", http.StatusBadRequest)
+	ErrMissingField   = newError(
+		"missing_field",
+		"missing required field",
+		http.StatusBadRequest,
+	)
+	ErrProxyNotFound      = newError("proxy_not_found", "proxy not found", http.StatusNotFound)
+	ErrProxyAlreadyExists = newError("proxy_exists", "proxy already exists", http.StatusConflict)
 	ErrInvalidStream      = newError(
+		"invalid_stream",
 		"stream was invalid, can be either upstream or downstream",
 		http.StatusBadRequest,
 	)
-	ErrInvalidToxicType   = newError("invalid toxic type", http.StatusBadRequest)
-	ErrToxicAlreadyExists = newError("toxic already exists", http.StatusConflict)
-	ErrToxicNotFound      = newError("toxic not found", http.StatusNotFound)
+	ErrInvalidToxicType = newError(
+		"invalid_toxic_type",
+		"invalid toxic type",
+		http.StatusBadRequest,
+	)
+	ErrToxicAlreadyExists = newError("toxic_exists", "toxic already exists", http.StatusConflict)
+	ErrToxicNotFound      = newError("toxic_not_found", "toxic not found", http.StatusNotFound)
+	ErrInvalidLogLevel    = newError(
+		"invalid_log_level",
+		"invalid log level, can be trace, debug, info, warn, error, fatal, panic or disabled",
+		http.StatusBadRequest,
+	)
+	ErrInvalidLogFormat = newError(
+		"invalid_log_format",
+		"invalid log format, can be either json or console",
+		http.StatusBadRequest,
+	)
+	ErrLogFormatFixed = newError(
+		"log_format_fixed",
+		"log format can not be changed for this server",
+		http.StatusBadRequest,
+	)
+	ErrInvalidLimit = newError(
+		"invalid_limit",
+		"limit must be a positive integer",
+		http.StatusBadRequest,
+	)
+	ErrInvalidSince = newError(
+		"invalid_since",
+		"since must be an event id",
+		http.StatusBadRequest,
+	)
+	ErrPresetNotFound     = newError("preset_not_found", "preset not found", http.StatusNotFound)
+	ErrConnectionNotFound = newError(
+		"connection_not_found",
+		"connection not found",
+		http.StatusNotFound,
+	)
+	ErrInvalidBufferSize = newError(
+		"invalid_buffer_size",
+		"invalid buffer size",
+		http.StatusBadRequest,
+	)
+	ErrInvalidConnectionLimit = newError(
+		"invalid_connection_limit",
+		"invalid connection limit",
+		http.StatusBadRequest,
+	)
+	ErrInvalidSocketOptions = newError(
+		"invalid_socket_options",
+		"invalid socket options",
+		http.StatusBadRequest,
+	)
+	ErrInvalidDialOptions = newError(
+		"invalid_dial_options",
+		"invalid dial options",
+		http.StatusBadRequest,
+	)
+	ErrInvalidConnectionTimeout = newError(
+		"invalid_connection_timeout",
+		"invalid connection timeout",
+		http.StatusBadRequest,
+	)
+	ErrInvalidProtocol = newError(
+		"invalid_protocol",
+		"invalid protocol",
+		http.StatusBadRequest,
+	)
+	ErrInvalidListen = newError(
+		"invalid_listen",
+		"invalid listen addresses",
+		http.StatusBadRequest,
+	)
+	ErrInvalidSwitchover = newError(
+		"invalid_switchover",
+		"invalid switchover",
+		http.StatusBadRequest,
+	)
+	ErrInvalidHealthCheck = newError(
+		"invalid_health_check",
+		"invalid health check",
+		http.StatusBadRequest,
+	)
+	ErrNotReady = newError(
+		"not_ready",
+		"not ready",
+		http.StatusServiceUnavailable,
+	)
+	ErrListenConflict = newError(
+		"listen_conflict",
+		"listen address in use",
+		http.StatusConflict,
+	)
+	ErrInvalidClientAccess = newError(
+		"invalid_client_access",
+		"invalid client allow or deny list",
+		http.StatusBadRequest,
+	)
+	ErrNamespaceForbidden = newError(
+		"namespace_forbidden",
+		"namespace not allowed without its token",
+		http.StatusForbidden,
+	)
+	ErrInvalidChaos = newError(
+		"invalid_chaos",
+		"invalid chaos config",
+		http.StatusBadRequest,
+	)
+	ErrInvalidModulation = newError(
+		"invalid_modulation",
+		"invalid modulation",
+		http.StatusBadRequest,
+	)
+	ErrInvalidBackpressure = newError(
+		"invalid_backpressure",
+		"invalid backpressure",
+		http.StatusBadRequest,
+	)
+	ErrInvalidWait = newError(
+		"invalid_wait",
+		"invalid wait",
+		http.StatusBadRequest,
+	)
+	ErrWaitTimeout = newError(
+		"wait_timeout",
+		"conditions not met before the timeout",
+		http.StatusRequestTimeout,
+	)
+	ErrToxicNotResumable = newError(
+		"toxic_not_resumable",
+		"toxic can not be resumed, only a limit_data toxic with pause can",
+		http.StatusBadRequest,
+	)
+	ErrInvalidHang = newError(
+		"invalid_hang",
+		"invalid hang probability or timeout",
+		http.StatusBadRequest,
+	)
+	ErrInvalidMatch = newError(
+		"invalid_match",
+		"invalid toxic match",
+		http.StatusBadRequest,
+	)
+	ErrInvalidAttribute = newError(
+		"invalid_attribute",
+		"invalid attribute",
+		http.StatusBadRequest,
+	)
+	ErrUnknownField = newError(
+		"unknown_field",
+		"unknown field",
+		http.StatusBadRequest,
+	)
+	ErrRateLimited = newError(
+		"rate_limited",
+		"too many requests",
+		http.StatusTooManyRequests,
+	)
+	ErrRequestTooLarge = newError(
+		"request_too_large",
+		"request body too large",
+		http.StatusRequestEntityTooLarge,
+	)
+	ErrInvalidPopulateOption = newError(
+		"invalid_populate_option",
+		"prune and dry_run should be true or false",
+		http.StatusBadRequest,
+	)
+	ErrSnapshotNotFound = newError(
+		"snapshot_not_found",
+		"snapshot not found",
+		http.StatusNotFound,
+	)
+	ErrInvalidPortRange = newError(
+		"invalid_port_range",
+		"invalid port range",
+		http.StatusBadRequest,
+	)
+	ErrInvalidToxicOrder = newError(
+		"invalid_toxic_order",
+		"toxic order should list each toxic of the proxy once",
+		http.StatusBadRequest,
+	)
 )
 
 func (server *ApiServer) apiError(resp http.ResponseWriter, err error) bool {
 	obj, ok := err.(*ApiError)
 	if !ok && err != nil {
 		server.Logger.Warn().Err(err).Msg("Error did not include status code")
-		obj = &ApiError{err.Error(), http.StatusInternalServerError}
+		obj = internalError(err)
 	}
 
 	if obj == nil {
@@ -544,6 +1406,16 @@ type proxyToxics struct {
 	Toxics []toxics.Toxic `json:"toxics"`
 }
 
+// MarshalJSON marshals the proxy with its lock taken, as its health check
+// can disable or move it meanwhile.
+func (p proxyToxics) MarshalJSON() ([]byte, error) {
+	p.Proxy.Lock()
+	defer p.Proxy.Unlock()
+
+	type plain proxyToxics
+	return json.Marshal(plain(p))
+}
+
 func proxyWithToxics(proxy *Proxy) (result proxyToxics) {
 	result.Proxy = proxy
 	result.Toxics = proxy.Toxics.GetToxicArray()
@@ -0,0 +1,123 @@
+package toxiproxy
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Clients of the API a rate limiter keeps the bucket of before forgetting the
+// ones whose bucket is full.
+const maxRateBuckets = 1024
+
+// limitsMiddleware rejects the requests of a client over the rate limit of the
+// API, and the bodies larger than the limit of the server, so that a test
+// harness hammering the API can't starve the proxies or exhaust the memory of
+// the server. The clients share the rate limiter of the returned middleware.
+func (server *ApiServer) limitsMiddleware() mux.MiddlewareFunc {
+	limiter := newRateLimiter(server.RateLimit, server.RateBurst)
+	maxBody := server.MaxBodySize
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter != nil && !probePaths[r.URL.Path] {
+				wait, ok := limiter.allow(clientHost(r.RemoteAddr), time.Now())
+				if !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					server.apiError(w, ErrRateLimited)
+					return
+				}
+			}
+			if maxBody > 0 {
+				if r.ContentLength > maxBody {
+					server.apiError(w, ErrRequestTooLarge)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientHost returns the host of the address of a client, the clients of a
+// unix socket sharing their address.
+func clientHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// rateLimiter is a token bucket for each client of the API, refilled at the
+// rate of requests per second up to the burst.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter returns a rate limiter, or nil without a rate. The burst is
+// the requests of a second if not set.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = max(int(math.Ceil(rate)), 1)
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token of the bucket of a client, or returns how long until
+// the client has one if the bucket is empty.
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.purge(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = l.refilled(bucket, now)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// refilled returns the tokens of a bucket at a time.
+func (l *rateLimiter) refilled(bucket *tokenBucket, now time.Time) float64 {
+	return min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+}
+
+// purge forgets the clients whose bucket is full, as they would get a new one.
+func (l *rateLimiter) purge(now time.Time) {
+	for client, bucket := range l.buckets {
+		if l.refilled(bucket, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
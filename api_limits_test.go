@@ -0,0 +1,100 @@
+package toxiproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestApiRateLimitsEachClient(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()), WithRateLimit(1, 2))
+	routes := srv.Routes()
+
+	request := func(client string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/version", nil)
+		req.RemoteAddr = client
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := request("10.0.0.1:1000"); resp.Code != http.StatusOK {
+			t.Fatalf("Expected request %d of the burst to succeed, got %d", i, resp.Code)
+		}
+	}
+	resp := request("10.0.0.1:1001")
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 over the rate limit, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), `"code":"rate_limited"`) {
+		t.Errorf("Expected the rate_limited code, got %s", resp.Body.String())
+	}
+	if resp.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected to retry after 1 second, got %q", resp.Header().Get("Retry-After"))
+	}
+
+	if resp := request("10.0.0.2:1000"); resp.Code != http.StatusOK {
+		t.Errorf("Expected another client not to be limited, got %d", resp.Code)
+	}
+}
+
+func TestRateLimiterRefillsAtTheRate(t *testing.T) {
+	limiter := newRateLimiter(10, 0)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		if _, ok := limiter.allow("client", now); !ok {
+			t.Fatalf("Expected a burst of a second of requests, limited at %d", i)
+		}
+	}
+	wait, ok := limiter.allow("client", now)
+	if ok || wait != 100*time.Millisecond {
+		t.Fatalf("Expected to wait 100ms for a token, got %v %v", wait, ok)
+	}
+	if _, ok := limiter.allow("client", now.Add(100*time.Millisecond)); !ok {
+		t.Fatal("Expected a token after 100ms")
+	}
+
+	for i := 0; i < maxRateBuckets; i++ {
+		limiter.allow(time.Duration(i).String(), now)
+	}
+	limiter.allow("new", now.Add(2*time.Second))
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected the full buckets to be purged, got %d", len(limiter.buckets))
+	}
+}
+
+func TestApiRejectsTheBodiesOverTheMaxBodySize(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()), WithMaxBodySize(64))
+	defer srv.Collection.Clear()
+	routes := srv.Routes()
+
+	body := `[{"name": "big", "listen": "localhost:0", "upstream": "localhost:1", ` +
+		`"enabled": false, "padding": "` + strings.Repeat("x", 64) + `"}]`
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest("POST", "/populate", strings.NewReader(body))
+		if chunked {
+			// Without a length, the body is cut while it's read.
+			req.ContentLength = -1
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		if resp.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413 with chunked %v, got %d: %s", chunked, resp.Code, resp.Body)
+		}
+		if !strings.Contains(resp.Body.String(), `"code":"request_too_large"`) {
+			t.Errorf("Expected the request_too_large code, got %s", resp.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/populate", strings.NewReader(`[]`))
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Errorf("Expected a small body to be accepted, got %d: %s", resp.Code, resp.Body)
+	}
+}
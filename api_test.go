@@ -2,10 +2,17 @@ package toxiproxy_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +21,8 @@ import (
 
 	"github.com/Shopify/toxiproxy/v2"
 	tclient "github.com/Shopify/toxiproxy/v2/client"
+	"github.com/Shopify/toxiproxy/v2/testhelper"
+	"github.com/Shopify/toxiproxy/v2/toxics"
 )
 
 var testServer *toxiproxy.ApiServer
@@ -316,6 +325,74 @@ func TestPopulateExistingProxy(t *testing.T) {
 	})
 }
 
+func TestPopulateWithPruneAndDryRun(t *testing.T) {
+	WithServer(t, func(addr string) {
+		_, err := client.CreateProxy("one", "localhost:7070", "localhost:7171")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = client.CreateProxy("two", "localhost:7373", "localhost:7474")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		config := []tclient.Proxy{
+			{Name: "one", Listen: "localhost:7070", Upstream: "localhost:7272", Enabled: true},
+			{Name: "three", Listen: "localhost:7575", Upstream: "localhost:7676", Enabled: true},
+		}
+		proxies, plan, err := client.Reconcile(config, tclient.PopulateOptions{
+			Prune:  true,
+			DryRun: true,
+		})
+		if err != nil {
+			t.Fatal("Unable to plan the populate:", err)
+		}
+		expected := &tclient.PopulatePlan{
+			Created:  []string{"three"},
+			Replaced: []string{"one"},
+			Kept:     []string{},
+			Removed:  []string{"two"},
+		}
+		if len(proxies) != 0 || !reflect.DeepEqual(plan, expected) {
+			t.Fatalf("Expected the plan %+v without proxies, got %+v and %d proxies",
+				expected, plan, len(proxies))
+		}
+		all, err := client.Proxies()
+		if err != nil {
+			t.Fatal("Unable to list the proxies:", err)
+		}
+		if len(all) != 2 || all["two"] == nil || all["one"].Upstream != "localhost:7171" {
+			t.Fatalf("Expected the dry run not to change the proxies, got %+v", all)
+		}
+
+		proxies, plan, err = client.Reconcile(config, tclient.PopulateOptions{Prune: true})
+		if err != nil {
+			t.Fatal("Unable to populate:", err)
+		}
+		if len(proxies) != 2 || !reflect.DeepEqual(plan, expected) {
+			t.Fatalf("Expected the plan %+v with 2 proxies, got %+v and %d proxies",
+				expected, plan, len(proxies))
+		}
+		all, err = client.Proxies()
+		if err != nil {
+			t.Fatal("Unable to list the proxies:", err)
+		}
+		if len(all) != 2 || all["two"] != nil || all["three"] == nil {
+			t.Fatalf("Expected the proxies not in the config to be pruned, got %+v", all)
+		}
+
+		resp, err := http.Post(addr+"/populate?prune=yes", "application/json",
+			bytes.NewReader([]byte("[]")))
+		if err != nil {
+			t.Fatal("Failed to populate:", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for an invalid prune, got %d", resp.StatusCode)
+		}
+	})
+}
+
 func TestPopulateWithBadName(t *testing.T) {
 	WithServer(t, func(addr string) {
 		testProxies, err := client.Populate([]tclient.Proxy{
@@ -667,7 +744,8 @@ func TestCreateProxyPortConflict(t *testing.T) {
 			t.Fatal("Unable to create proxy:", err)
 		}
 
-		expected := "create: HTTP 500: listen tcp 127.0.0.1:3310: bind: address already in use"
+		expected := "create: HTTP 409: listen address in use: " +
+			"listen tcp 127.0.0.1:3310: bind: address already in use, by proxy mysql_master"
 		_, err = client.CreateProxy("test", "localhost:3310", "localhost:20001")
 		if err == nil {
 			t.Error("Proxy did not result in conflict.")
@@ -1091,6 +1169,215 @@ func TestRemoveToxic(t *testing.T) {
 	})
 }
 
+func TestResumeToxic(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("hello world"))
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", upstream.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = proxy.AddToxic("", "limit_data", "downstream", 1, tclient.Attributes{
+			"bytes": 5,
+			"pause": true,
+		})
+		if err != nil {
+			t.Fatal("Error setting toxic:", err)
+		}
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 5)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("Expected hello before the limit, got %q: %v", buf, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if n, err := conn.Read(buf); err == nil {
+			t.Fatalf("Expected the connection to be paused, got %q", buf[:n])
+		}
+
+		_, err = proxy.ResumeToxic("limit_data_downstream")
+		if err != nil {
+			t.Fatal("Error resuming toxic:", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != " worl" {
+			t.Fatalf("Expected the next 5 bytes once resumed, got %q: %v", buf, err)
+		}
+
+		_, err = proxy.AddToxic("", "latency", "downstream", 1, nil)
+		if err != nil {
+			t.Fatal("Error setting toxic:", err)
+		}
+		_, err = proxy.ResumeToxic("latency_downstream")
+		if !errors.Is(err, tclient.ErrToxicNotResumable) {
+			t.Fatalf("Expected a toxic_not_resumable error, got %#v", err)
+		}
+		_, err = proxy.ResumeToxic("missing")
+		if !errors.Is(err, tclient.ErrToxicNotFound) {
+			t.Fatalf("Expected a toxic_not_found error, got %#v", err)
+		}
+	})
+}
+
+// greeter listens for connections it greets with hello, until the test ends.
+func greeter(t *testing.T) net.Listener {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	t.Cleanup(func() { upstream.Close() })
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello"))
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return upstream
+}
+
+// dialGreeted dials a proxy of a greeter, and tells whether it was greeted.
+func dialGreeted(t *testing.T, proxy *tclient.Proxy) (net.Conn, bool) {
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, greeted(conn)
+}
+
+func greeted(conn net.Conn) bool {
+	buf := make([]byte, 5)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err := io.ReadFull(conn, buf)
+	return err == nil
+}
+
+func TestAddToxicScopedToTheFirstConnection(t *testing.T) {
+	upstream := greeter(t)
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", upstream.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		before, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer before.Close()
+		toxic, err := client.AddToxic(&tclient.ToxicOptions{
+			ProxyName:        "mysql_master",
+			ToxicType:        "timeout",
+			Toxicity:         1,
+			FirstConnections: 1,
+		})
+		if err != nil {
+			t.Fatal("Error setting toxic:", err)
+		}
+		if toxic.FirstConnections != 1 {
+			t.Fatalf("Expected first_connections of 1, got %d", toxic.FirstConnections)
+		}
+
+		if !greeted(before) {
+			t.Error("Expected the connection opened before the toxic not to be affected")
+		}
+		if _, ok := dialGreeted(t, proxy); ok {
+			t.Error("Expected the first connection after the toxic to be affected")
+		}
+		if _, ok := dialGreeted(t, proxy); !ok {
+			t.Error("Expected the second connection after the toxic not to be affected")
+		}
+
+		toxics, err := proxy.Toxics()
+		if err != nil {
+			t.Fatal("Error returning toxics:", err)
+		}
+		if activations := toxics[0].Stats.Activations; activations != 1 {
+			t.Errorf("Expected 1 activation of the scoped toxic, got %d", activations)
+		}
+	})
+}
+
+func TestAddToxicWithMatch(t *testing.T) {
+	upstream := greeter(t)
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", upstream.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		toxic, err := client.AddToxic(&tclient.ToxicOptions{
+			ProxyName: "mysql_master",
+			ToxicType: "timeout",
+			Toxicity:  1,
+			Match:     &tclient.Match{ClientCIDR: "127.0.0.0/8", Upstream: "example.com"},
+		})
+		if err != nil {
+			t.Fatal("Error setting toxic:", err)
+		}
+		if toxic.Match == nil || toxic.Match.Upstream != "example.com" {
+			t.Fatalf("Expected the match to be read back, got %+v", toxic.Match)
+		}
+		if _, ok := dialGreeted(t, proxy); !ok {
+			t.Error("Expected the connections to another upstream not to be affected")
+		}
+
+		body := `{"match": {"upstream": "` + upstream.Addr().String() + `"}}`
+		request, _ := http.NewRequest(
+			"PATCH", addr+"/proxies/mysql_master/toxics/timeout_downstream",
+			bytes.NewReader([]byte(body)),
+		)
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal("Failed to update the toxic:", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected the toxic to be updated, got %d", resp.StatusCode)
+		}
+		if _, ok := dialGreeted(t, proxy); ok {
+			t.Error("Expected the connections to the upstream to be affected")
+		}
+
+		_, err = client.AddToxic(&tclient.ToxicOptions{
+			ProxyName: "mysql_master",
+			ToxicName: "invalid",
+			ToxicType: "latency",
+			Match:     &tclient.Match{ClientPorts: "http"},
+		})
+		if !errors.Is(err, tclient.ErrInvalidMatch) {
+			t.Fatalf("Expected an invalid_match error, got %#v", err)
+		}
+	})
+}
+
 func TestVersionEndpointReturnsVersion(t *testing.T) {
 	WithServer(t, func(addr string) {
 		resp, err := http.Get(addr + "/version")
@@ -1110,6 +1397,566 @@ func TestVersionEndpointReturnsVersion(t *testing.T) {
 	})
 }
 
+func TestListToxicTypes(t *testing.T) {
+	WithServer(t, func(addr string) {
+		types, err := client.ToxicTypes()
+		if err != nil {
+			t.Fatal("Unable to list toxic types:", err)
+		}
+
+		found := false
+		for i, typeName := range types {
+			if i > 0 && types[i-1] >= typeName {
+				t.Errorf("Toxic types are not sorted: %v", types)
+			}
+			found = found || typeName == "latency"
+		}
+		if !found {
+			t.Fatalf("Expected latency in toxic types, got %v", types)
+		}
+	})
+}
+
+func TestNewServerWithOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := toxics.NewRegistry()
+	registry.Register("latency", new(toxics.LatencyToxic))
+	server := toxiproxy.New(
+		toxiproxy.WithListener(listener),
+		toxiproxy.WithToxicRegistry(registry),
+		toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+	go server.Listen("")
+	defer server.Shutdown()
+	defer server.Collection.Clear()
+
+	client := tclient.NewClient(listener.Addr().String())
+	err = client.WaitForReady(context.Background())
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+
+	types, err := client.ToxicTypes()
+	if err != nil {
+		t.Fatal("Unable to list toxic types:", err)
+	}
+	if len(types) != 1 || types[0] != "latency" {
+		t.Fatalf("Expected only the latency toxic type, got %v", types)
+	}
+
+	proxy, err := client.CreateProxy("embedded", "localhost:0", "localhost:20001")
+	if err != nil {
+		t.Fatal("Unable to create proxy:", err)
+	}
+	_, err = proxy.AddToxic("", "latency", "", 1, nil)
+	if err != nil {
+		t.Fatal("Unable to add a registered toxic:", err)
+	}
+	_, err = proxy.AddToxic("", "bandwidth", "", 1, nil)
+	if err == nil {
+		t.Fatal("Expected an error adding a toxic missing from the registry")
+	}
+}
+
+func TestNewServerWithTransportOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := testhelper.NewPipeListener()
+	upstream := testhelper.NewPipeListener()
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	var listened []string
+	server := toxiproxy.New(
+		toxiproxy.WithListener(listener),
+		toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()),
+		toxiproxy.WithProxyListener(func(address string) (net.Listener, error) {
+			listened = append(listened, address)
+			return clients, nil
+		}),
+		toxiproxy.WithDialer(upstream.Dial),
+	)
+	go server.Listen("")
+	defer server.Shutdown()
+	defer server.Collection.Clear()
+
+	client := tclient.NewClient(listener.Addr().String())
+	err = client.WaitForReady(context.Background())
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+
+	_, err = client.CreateProxy("in_memory", "memory", "upstream")
+	if err != nil {
+		t.Fatal("Unable to create proxy:", err)
+	}
+	if len(listened) != 1 || listened[0] != "memory" {
+		t.Fatalf("Expected the proxy to listen with the server listener, got %v", listened)
+	}
+
+	conn, err := clients.Dial(context.Background(), "memory")
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello world")
+	go conn.Write(msg)
+	resp := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		t.Fatal("Failed to read from proxy:", err)
+	}
+	if !bytes.Equal(resp, msg) {
+		t.Errorf("Expected %q back, got %q", msg, resp)
+	}
+}
+
+func TestToxicAttributesAreValidated(t *testing.T) {
+	WithServer(t, func(addr string) {
+		testProxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		for _, test := range []struct {
+			toxicType  string
+			attributes tclient.Attributes
+			code       string
+			message    string
+		}{
+			{"latency", tclient.Attributes{"latncy": 100}, "invalid_attribute:latncy",
+				"latncy is not an attribute of the toxic"},
+			{"latency", tclient.Attributes{"latency": -100}, "invalid_attribute:latency",
+				"latency must not be negative"},
+			{"random_reset", tclient.Attributes{"min_time": 200, "max_time": 100},
+				"invalid_attribute:min_time", "min_time must not be greater than max_time"},
+			{"trigger", tclient.Attributes{"action": "reset"}, "invalid_attribute:pattern",
+				"pattern is required"},
+		} {
+			_, err = testProxy.AddToxic("", test.toxicType, "", 1, test.attributes)
+			var apiErr *tclient.ApiError
+			if !errors.As(err, &apiErr) || apiErr.Code != test.code ||
+				!strings.HasSuffix(apiErr.Message, test.message) {
+				t.Errorf("Expected %s for %v, got %#v", test.code, test.attributes, err)
+			}
+		}
+
+		_, err = testProxy.AddToxic("slow", "latency", "", 1, tclient.Attributes{"latency": 100})
+		if err != nil {
+			t.Fatal("Unable to create toxic:", err)
+		}
+		_, err = testProxy.UpdateToxic("slow", 1, tclient.Attributes{"latency": 200, "jitter": -1})
+		if !errors.Is(err, tclient.ErrInvalidAttribute) {
+			t.Fatalf("Expected the update to be rejected, got %#v", err)
+		}
+		toxics, err := testProxy.Toxics()
+		if err != nil {
+			t.Fatal("Unable to get toxics:", err)
+		}
+		if toxics[0].Attributes["latency"] != 100.0 {
+			t.Fatalf("Expected the rejected update not to change the toxic, got %v",
+				toxics[0].Attributes)
+		}
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	WithServer(t, func(addr string) {
+		_, err := client.Proxy("missing")
+		if !errors.Is(err, tclient.ErrProxyNotFound) {
+			t.Fatalf("Expected a proxy_not_found error, got %#v", err)
+		}
+
+		testProxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		_, err = testProxy.AddToxic("", "latency", "", 1, tclient.Attributes{"latency": "slow"})
+		var apiErr *tclient.ApiError
+		if !errors.As(err, &apiErr) || !errors.Is(err, tclient.ErrInvalidAttribute) {
+			t.Fatalf("Expected an invalid_attribute error, got %#v", err)
+		}
+		if apiErr.Code != "invalid_attribute:latency" || apiErr.Attribute() != "latency" {
+			t.Fatalf("Expected the latency attribute to be invalid, got %s", apiErr.Code)
+		}
+
+		_, err = testProxy.AddToxic("", "timeout", "", 1, tclient.Attributes{"close": "slam"})
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+			t.Fatalf("Expected the close attribute to be rejected, got %#v", err)
+		}
+
+		_, err = client.AddToxic(&tclient.ToxicOptions{
+			ProxyName: "mysql_master",
+			ToxicType: "walrus",
+		})
+		if !errors.Is(err, tclient.ErrInvalidToxicType) {
+			t.Fatalf("Expected an invalid_toxic_type error, got %#v", err)
+		}
+	})
+}
+
+func TestProxyBufferSettings(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.ReadBufferSize = 1024
+		proxy.ChannelDepth = 8
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if proxy.ReadBufferSize != 1024 || proxy.ChannelDepth != 8 {
+			t.Fatalf("Expected buffers of 1024 bytes and 8 chunks, got %d and %d",
+				proxy.ReadBufferSize, proxy.ChannelDepth)
+		}
+
+		proxy.ReadBufferSize = 0
+		err = proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to update proxy:", err)
+		}
+		if proxy.ReadBufferSize != 0 || proxy.ChannelDepth != 8 || !proxy.Enabled {
+			t.Fatalf("Expected the default read buffer size on the enabled proxy, got %+v", proxy)
+		}
+
+		proxy.ChannelDepth = -1
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidBufferSize) {
+			t.Fatalf("Expected an invalid_buffer_size error, got %#v", err)
+		}
+	})
+}
+
+func TestProxyConnectionLimitSettings(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.MaxConnections = 10
+		proxy.OnLimit = "wait"
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if proxy.MaxConnections != 10 || proxy.OnLimit != "wait" {
+			t.Fatalf("Expected a limit of 10 connections waiting over it, got %d and %q",
+				proxy.MaxConnections, proxy.OnLimit)
+		}
+
+		proxy.OnLimit = "drop"
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidConnectionLimit) {
+			t.Fatalf("Expected an invalid_connection_limit error, got %#v", err)
+		}
+	})
+}
+
+func TestProxyDialSettings(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.DialTimeout = 500
+		proxy.DialRetries = 3
+		proxy.DialBackoff = 100
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if proxy.DialTimeout != 500 || proxy.DialRetries != 3 || proxy.DialBackoff != 100 {
+			t.Fatalf("Expected 3 retries after 500ms with a backoff of 100ms, got %d, %d and %d",
+				proxy.DialRetries, proxy.DialTimeout, proxy.DialBackoff)
+		}
+
+		proxy.DialRetries = -1
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidDialOptions) {
+			t.Fatalf("Expected an invalid_dial_options error, got %#v", err)
+		}
+
+		proxy.DialRetries = 0
+		for _, upstreamProxy := range []string{"ftp://localhost:21", "socks5://localhost"} {
+			proxy.UpstreamProxy = upstreamProxy
+			err = proxy.Save()
+			if !errors.Is(err, tclient.ErrInvalidDialOptions) {
+				t.Fatalf("Expected %q to be invalid, got %#v", upstreamProxy, err)
+			}
+		}
+
+		proxy.UpstreamProxy = ""
+		for _, bind := range []tclient.UpstreamBind{{Address: "localhost"}, {Mark: -1}} {
+			proxy.UpstreamBind = bind
+			err = proxy.Save()
+			if !errors.Is(err, tclient.ErrInvalidDialOptions) {
+				t.Fatalf("Expected %+v to be invalid, got %#v", bind, err)
+			}
+		}
+	})
+}
+
+func TestProxyClientAccessSettings(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.Allow = []string{"10.0.0.0/8", "127.0.0.1"}
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		// The access lists are kept by updates that don't set them.
+		request, _ := http.NewRequest(
+			"PATCH", addr+"/proxies/mysql_master", bytes.NewReader([]byte(`{"deny": ["10.0.0.1"]}`)),
+		)
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal("Failed to update proxy:", err)
+		}
+		resp.Body.Close()
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if len(proxy.Allow) != 2 || len(proxy.Deny) != 1 || proxy.Deny[0] != "10.0.0.1" {
+			t.Fatalf("Expected the allow and deny lists, got %v and %v", proxy.Allow, proxy.Deny)
+		}
+
+		for _, entry := range []string{"10.0.0.0/33", "localhost", ""} {
+			proxy.Deny = []string{entry}
+			err = proxy.Save()
+			if !errors.Is(err, tclient.ErrInvalidClientAccess) {
+				t.Fatalf("Expected %q to be invalid, got %#v", entry, err)
+			}
+		}
+	})
+}
+
+func TestProxyConnectionTimeoutSettings(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.IdleTimeout = 1000
+		proxy.MaxConnectionAge = 60000
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if proxy.IdleTimeout != 1000 || proxy.MaxConnectionAge != 60000 {
+			t.Fatalf("Expected an idle timeout of 1s and a max age of 1m, got %d and %d",
+				proxy.IdleTimeout, proxy.MaxConnectionAge)
+		}
+
+		proxy.IdleTimeout = -1
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidConnectionTimeout) {
+			t.Fatalf("Expected an invalid_connection_timeout error, got %#v", err)
+		}
+	})
+}
+
+func TestProxyProtocol(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "dns"
+		proxy.Listen = "localhost:0"
+		proxy.Upstream = "localhost:20053"
+		proxy.Enabled = true
+		proxy.Protocol = "udp"
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		if proxy.Protocol != "udp" {
+			t.Fatalf("Expected a UDP proxy, got %q", proxy.Protocol)
+		}
+
+		// The protocol is kept by the updates that don't set it.
+		request, _ := http.NewRequest(
+			"PATCH", addr+"/proxies/dns", bytes.NewReader([]byte(`{"enabled": false}`)),
+		)
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal("Failed to update proxy:", err)
+		}
+		resp.Body.Close()
+		proxy, err = client.Proxy("dns")
+		if err != nil {
+			t.Fatal("Unable to get proxy:", err)
+		}
+		if proxy.Protocol != "udp" {
+			t.Fatalf("Expected the proxy to stay a UDP proxy, got %q", proxy.Protocol)
+		}
+
+		proxy.Protocol = "sctp"
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidProtocol) {
+			t.Fatalf("Expected an invalid_protocol error, got %#v", err)
+		}
+	})
+}
+
+func TestProxyListenValidation(t *testing.T) {
+	WithServer(t, func(addr string) {
+		for _, addresses := range [][2]string{
+			{"localhost:7000-7002", "localhost:9000"},
+			{"localhost:7000-7002", "localhost:9000-9001"},
+			{"localhost:7000", "localhost:9000-9002"},
+			{"localhost:7002-7000", "localhost:9002-9000"},
+		} {
+			_, err := client.CreateProxy("range", addresses[0], addresses[1])
+			if !errors.Is(err, tclient.ErrInvalidPortRange) {
+				t.Errorf("Expected %v to be invalid, got %#v", addresses, err)
+			}
+		}
+
+		for _, listen := range []string{"localhost:7000,", "localhost:7000,localhost:7001-7002"} {
+			_, err := client.CreateProxy("list", listen, "localhost:9000")
+			if !errors.Is(err, tclient.ErrInvalidListen) {
+				t.Errorf("Expected %q to be invalid, got %#v", listen, err)
+			}
+		}
+	})
+}
+
+func TestProxyListenLookup(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("pool", toxiproxy.PoolListen, "localhost:20000")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		listen, err := client.ProxyListen("pool")
+		if err != nil {
+			t.Fatal("Unable to look up the listen address:", err)
+		}
+		if listen != proxy.Listen || listen == toxiproxy.PoolListen {
+			t.Errorf("Expected the proxy to listen on %s, got %s", proxy.Listen, listen)
+		}
+
+		_, err = client.ProxyListen("missing")
+		if !errors.Is(err, tclient.ErrProxyNotFound) {
+			t.Errorf("Expected a proxy_not_found error, got %#v", err)
+		}
+	})
+}
+
+func TestReorderToxics(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		for _, typeName := range []string{"latency", "bandwidth"} {
+			_, err = proxy.AddToxic("", typeName, "downstream", 1, nil)
+			if err != nil {
+				t.Fatal("Unable to add toxic:", err)
+			}
+		}
+
+		toxics, err := proxy.ReorderToxics("bandwidth_downstream", "latency_downstream")
+		if err != nil {
+			t.Fatal("Unable to reorder toxics:", err)
+		}
+		if len(toxics) != 2 || toxics[0].Name != "bandwidth_downstream" || toxics[0].Index != 1 ||
+			toxics[1].Name != "latency_downstream" || toxics[1].Index != 2 {
+			t.Fatalf("Expected bandwidth before latency, got %+v", toxics)
+		}
+
+		toxics, err = proxy.Toxics()
+		if err != nil {
+			t.Fatal("Unable to list toxics:", err)
+		}
+		if toxics[0].Name != "bandwidth_downstream" {
+			t.Fatalf("Expected the new order to be kept, got %+v", toxics)
+		}
+
+		_, err = proxy.ReorderToxics("latency_downstream")
+		if !errors.Is(err, tclient.ErrInvalidToxicOrder) {
+			t.Fatalf("Expected an invalid_toxic_order error, got %#v", err)
+		}
+	})
+}
+
+func TestProxySocketOptions(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "mysql_master"
+		proxy.Listen = "localhost:3310"
+		proxy.Upstream = "localhost:20001"
+		proxy.Enabled = true
+		proxy.Socket.Nagle = true
+		proxy.Socket.KeepAlive = 1000
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if !proxy.Socket.Nagle || proxy.Socket.KeepAlive != 1000 {
+			t.Fatalf("Expected Nagle's algorithm and keepalives every second, got %+v", proxy.Socket)
+		}
+
+		proxy.Socket.Backlog = -1
+		err = proxy.Save()
+		if !errors.Is(err, tclient.ErrInvalidSocketOptions) {
+			t.Fatalf("Expected an invalid_socket_options error, got %#v", err)
+		}
+	})
+}
+
 func TestInvalidStream(t *testing.T) {
 	WithServer(t, func(addr string) {
 		testProxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
@@ -1157,3 +2004,46 @@ func AssertToxicExists(
 	}
 	return toxic
 }
+
+func TestServerListensOnUnixSocket(t *testing.T) {
+	// The paths of unix sockets are short, which the test directories may not be.
+	dir, err := os.MkdirTemp("", "toxiproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+
+	// The socket of a server which exited without removing it.
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	server := toxiproxy.New(toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()))
+	go server.Listen("unix:" + socket)
+	defer server.Shutdown()
+
+	client := tclient.NewClient("unix:" + socket)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.WaitForReady(ctx)
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+
+	_, err = client.Version()
+	if err != nil {
+		t.Fatal("Unable to get the version through the socket:", err)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Windows only keeps the read-only attribute of the permissions.
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the socket to only be accessible to its user, got %s", info.Mode())
+	}
+}
@@ -0,0 +1,122 @@
+package toxiproxy
+
+import (
+	"fmt"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// What happens to the data read from a connection while its toxics are
+// slower than the reads, e.g. a bandwidth toxic shaping a fast sender.
+const (
+	BackpressureBlock  = "block"  // Stop reading, so that TCP slows the sender down, the default
+	BackpressureBuffer = "buffer" // Hold the data in memory, then stop reading
+	BackpressureDrop   = "drop"   // Hold the data in memory, then drop what is read
+)
+
+// Bytes held for the toxics of each direction of a connection with the buffer
+// and drop backpressures.
+const (
+	defaultBackpressureBytes = 1 << 20
+	maxBackpressureBytes     = 256 << 20
+)
+
+func validateBackpressure(backpressure string, bytes int) error {
+	switch backpressure {
+	case "", BackpressureBlock, BackpressureBuffer, BackpressureDrop:
+	default:
+		return joinError(
+			fmt.Errorf(
+				"backpressure must be %s, %s or %s",
+				BackpressureBlock, BackpressureBuffer, BackpressureDrop,
+			),
+			ErrInvalidBackpressure,
+		)
+	}
+	if bytes < 0 || bytes > maxBackpressureBytes {
+		return joinError(
+			fmt.Errorf("backpressure_bytes must be at most %d", maxBackpressureBytes),
+			ErrInvalidBackpressure,
+		)
+	}
+	return nil
+}
+
+// backpressure and backpressureBytes are called with the lock of the toxics
+// taken, like channelDepth.
+func (proxy *Proxy) backpressure() string {
+	if proxy == nil || proxy.Backpressure == "" {
+		return BackpressureBlock
+	}
+	return proxy.Backpressure
+}
+
+func (proxy *Proxy) backpressureBytes() int {
+	if proxy.BackpressureBytes == 0 {
+		return defaultBackpressureBytes
+	}
+	return proxy.BackpressureBytes
+}
+
+// hold passes the chunks read from a connection to its toxics, holding up to
+// limit bytes while the toxics do not take them. Once they hold limit bytes,
+// the reads wait with the buffer backpressure, and the chunks read are
+// dropped with the drop one. The output is closed once the input is, and the
+// chunks held sent, or discarded once the link stopped writing.
+func (link *ToxicLink) hold(
+	input <-chan *stream.StreamChunk,
+	output chan<- *stream.StreamChunk,
+	backpressure string,
+	limit int,
+) {
+	stats := link.proxy.Stats
+	var queue []*stream.StreamChunk
+	held := 0
+	done := link.done
+	for input != nil || len(queue) > 0 {
+		var in <-chan *stream.StreamChunk
+		if input != nil && (backpressure == BackpressureDrop || held < limit || done == nil) {
+			in = input
+		}
+		var out chan<- *stream.StreamChunk
+		var next *stream.StreamChunk
+		size := 0
+		if len(queue) > 0 {
+			out = output
+			next = queue[0]
+			// The toxics own the chunk once it is sent.
+			size = len(next.Data)
+		}
+
+		select {
+		case chunk, ok := <-in:
+			if !ok {
+				input = nil
+				continue
+			}
+			if done == nil {
+				continue
+			}
+			if backpressure == BackpressureDrop && held+len(chunk.Data) > limit {
+				stats.addDropped(len(chunk.Data))
+				continue
+			}
+			queue = append(queue, chunk)
+			held += len(chunk.Data)
+			stats.addBuffered(int64(len(chunk.Data)))
+		case out <- next:
+			queue[0] = nil
+			queue = queue[1:]
+			held -= size
+			stats.addBuffered(-int64(size))
+		case <-done:
+			// Nothing reads the toxics anymore, the reads are unblocked
+			// until the source is closed.
+			stats.addBuffered(-int64(held))
+			queue = nil
+			held = 0
+			done = nil
+		}
+	}
+	close(output)
+}
@@ -0,0 +1,127 @@
+package toxiproxy_test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+// withSlowProxy runs f with a proxy whose bandwidth toxic is slower than a
+// client sending as fast as it can.
+func withSlowProxy(
+	t *testing.T,
+	backpressure string,
+	f func(proxy *toxiproxy.Proxy),
+) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.Backpressure = backpressure
+	proxy.BackpressureBytes = 64 << 10
+	proxy.ChannelDepth = 1
+	proxy.Start()
+	defer proxy.Stop()
+	_, err = proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "bandwidth", "stream": "upstream", "attributes": {"rate": 1}}`,
+	))
+	if err != nil {
+		t.Fatal("Failed to add toxic:", err)
+	}
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	go func() {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		conn.Write(make([]byte, 16<<20))
+	}()
+
+	f(proxy)
+}
+
+func waitForBackpressure(
+	t *testing.T,
+	proxy *toxiproxy.Proxy,
+	check func(toxiproxy.ProxyCounters) bool,
+) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !check(proxy.Stats.Counters()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected proxy stats: %+v", proxy.Stats.Counters())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackpressureBlocksTheReads(t *testing.T) {
+	withSlowProxy(t, "", func(proxy *toxiproxy.Proxy) {
+		waitForBackpressure(t, proxy, func(c toxiproxy.ProxyCounters) bool {
+			return c.BlockedReads > 0
+		})
+		if counters := proxy.Stats.Counters(); counters.BufferedBytes != 0 ||
+			counters.DroppedBytes != 0 {
+			t.Errorf("Expected the reads to only block, got %+v", counters)
+		}
+	})
+}
+
+func TestBackpressureBuffersBeforeBlocking(t *testing.T) {
+	var slow *toxiproxy.Proxy
+	withSlowProxy(t, toxiproxy.BackpressureBuffer, func(proxy *toxiproxy.Proxy) {
+		slow = proxy
+		waitForBackpressure(t, proxy, func(c toxiproxy.ProxyCounters) bool {
+			return c.BufferedBytes >= 64<<10 && c.BlockedReads > 0
+		})
+		if counters := proxy.Stats.Counters(); counters.DroppedBytes != 0 {
+			t.Errorf("Expected no data to be dropped, got %+v", counters)
+		}
+	})
+
+	// The data held is discarded once the connection is closed.
+	waitForBackpressure(t, slow, func(c toxiproxy.ProxyCounters) bool {
+		return c.BufferedBytes == 0
+	})
+}
+
+func TestBackpressureDropsOverItsBuffer(t *testing.T) {
+	withSlowProxy(t, toxiproxy.BackpressureDrop, func(proxy *toxiproxy.Proxy) {
+		waitForBackpressure(t, proxy, func(c toxiproxy.ProxyCounters) bool {
+			return c.DroppedBytes > 1<<20
+		})
+		if counters := proxy.Stats.Counters(); counters.BufferedBytes > 64<<10 {
+			t.Errorf("Expected at most 64KB to be held, got %+v", counters)
+		}
+	})
+}
+
+func TestBackpressureValidation(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	for _, input := range []*toxiproxy.Proxy{
+		{Listen: "localhost:0", Upstream: "localhost:20000", Backpressure: "queue"},
+		{Listen: "localhost:0", Upstream: "localhost:20000", BackpressureBytes: -1},
+		{Listen: "localhost:0", Upstream: "localhost:20000", BackpressureBytes: 1 << 30},
+	} {
+		err := proxy.SetOptions(input)
+		if err == nil || err.(*toxiproxy.ApiError).Code != toxiproxy.ErrInvalidBackpressure.Code {
+			t.Errorf("Expected %q with %d bytes to be invalid, got %v",
+				input.Backpressure, input.BackpressureBytes, err)
+		}
+	}
+}
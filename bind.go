@@ -0,0 +1,106 @@
+package toxiproxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// UpstreamBind is where the connections of a proxy to its upstream are made
+// from, so that they take a network path of a host with several of them, or
+// are matched by its firewall rules. It does not apply to a DialFunc.
+type UpstreamBind struct {
+	// Address is the local IP, or IP and port, the connections are made from.
+	Address string `json:"address,omitempty"`
+	// Interface is the network interface the connections go through, with
+	// SO_BINDTODEVICE, and Mark the SO_MARK of their sockets. Both are only
+	// supported on Linux.
+	Interface string `json:"interface,omitempty"`
+	Mark      int    `json:"mark,omitempty"`
+}
+
+var errBindUnsupported = errors.New(
+	"the interface and the mark of upstream_bind are only supported on Linux",
+)
+
+func validateUpstreamBind(bind UpstreamBind) error {
+	_, _, err := bind.localAddress()
+	if err == nil && len(bind.Interface) > 15 {
+		err = fmt.Errorf("interface %q is too long", bind.Interface)
+	}
+	if err == nil && (bind.Mark < 0 || uint64(bind.Mark) > math.MaxUint32) {
+		err = errors.New("mark must be a 32 bits unsigned integer")
+	}
+	if err == nil && !bindSupported && (bind.Interface != "" || bind.Mark != 0) {
+		err = errBindUnsupported
+	}
+	if err != nil {
+		return joinError(fmt.Errorf("upstream_bind: %w", err), ErrInvalidDialOptions)
+	}
+	return nil
+}
+
+// localAddress returns the IP and the port of the address, nil if not set.
+func (bind UpstreamBind) localAddress() (net.IP, int, error) {
+	if bind.Address == "" {
+		return nil, 0, nil
+	}
+	if ip := net.ParseIP(bind.Address); ip != nil {
+		return ip, 0, nil
+	}
+	host, port, err := net.SplitHostPort(bind.Address)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := net.ParseIP(host)
+	number, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, 0, fmt.Errorf("address %q is not an IP or an IP and a port", bind.Address)
+	}
+	return ip, int(number), nil
+}
+
+func (proxy *Proxy) upstreamBind() UpstreamBind {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	return proxy.UpstreamBind
+}
+
+// dialer returns a dialer of a network, "tcp" or "udp", connecting from the
+// bind.
+func (bind UpstreamBind) dialer(network string) net.Dialer {
+	var dialer net.Dialer
+	// It was validated when set.
+	if ip, port, _ := bind.localAddress(); ip != nil && network == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{IP: ip, Port: port}
+	} else if ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip, Port: port}
+	}
+	if bind.Interface != "" || bind.Mark != 0 {
+		dialer.Control = func(_, _ string, conn syscall.RawConn) error {
+			return control(conn, bind.set)
+		}
+	}
+	return dialer
+}
+
+// set sets the interface and the mark of a socket.
+func (bind UpstreamBind) set(fd uintptr) error {
+	if bind.Interface != "" {
+		err := setBindToDevice(fd, bind.Interface)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", bind.Interface, err)
+		}
+	}
+	if bind.Mark != 0 {
+		err := setMark(fd, bind.Mark)
+		if err != nil {
+			return fmt.Errorf("mark: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package toxiproxy
+
+import "golang.org/x/sys/unix"
+
+const bindSupported = true
+
+func setBindToDevice(fd uintptr, name string) error {
+	return unix.BindToDevice(int(fd), name)
+}
+
+func setMark(fd uintptr, mark int) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, mark)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package toxiproxy
+
+const bindSupported = false
+
+func setBindToDevice(uintptr, string) error {
+	return errBindUnsupported
+}
+
+func setMark(uintptr, int) error {
+	return errBindUnsupported
+}
@@ -0,0 +1,46 @@
+package toxiproxy_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+func TestProxyBindsUpstreamConnections(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+
+	// A port nothing listens on to connect from.
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	free.Close()
+
+	proxy := NewTestProxy("test_bind", upstream.Addr().String())
+	proxy.UpstreamBind = toxiproxy.UpstreamBind{Address: free.Addr().String()}
+	err = proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer conn.Close()
+	accepted, err := upstream.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accepted.Close()
+	if accepted.RemoteAddr().String() != free.Addr().String() {
+		t.Errorf("Expected the upstream to be connected from %s, got %s",
+			free.Addr(), accepted.RemoteAddr())
+	}
+}
@@ -0,0 +1,348 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ChaosConfig configures the chaos controller of a server, which adds random
+// toxics to random proxies and removes them over time, a lightweight chaos
+// monkey for staging environments.
+type ChaosConfig struct {
+	// Proxies are the names of the proxies faults are added to, all the
+	// proxies outside of namespaces if not set.
+	Proxies []string `json:"proxies,omitempty"`
+	// Toxics is the palette of the faults, one of which is picked at random
+	// for each fault. Their stream is downstream and their toxicity 1 if not
+	// set.
+	Toxics []PresetToxic `json:"toxics"`
+	// Intensity is the chance between 0 and 1 that each proxy gets a fault
+	// at each interval.
+	Intensity float64 `json:"intensity"`
+	// Interval is the number of milliseconds between two rounds, the faults
+	// of a round being removed at the next one.
+	Interval int `json:"interval"`
+	// Seed makes the faults the same each time chaos starts with it, random
+	// if not set.
+	Seed int64 `json:"seed,omitempty"`
+	// Probes check the steady state of the system during the experiment,
+	// which is aborted once one of them fails too many times.
+	Probes []ChaosProbe `json:"probes,omitempty"`
+}
+
+// ChaosFault is a toxic added by the chaos controller.
+type ChaosFault struct {
+	Proxy string `json:"proxy"`
+	Toxic string `json:"toxic"`
+	Type  string `json:"type"`
+
+	proxy *Proxy
+}
+
+// ChaosStatus is the state of the chaos controller, with the config it was
+// started with, the seed filled in, and the faults of its last round. Aborted
+// is the reason a probe stopped the controller.
+type ChaosStatus struct {
+	Running bool         `json:"running"`
+	Config  *ChaosConfig `json:"config"`
+	Rounds  int          `json:"rounds"`
+	Faults  []ChaosFault `json:"faults"`
+	Aborted string       `json:"aborted,omitempty"`
+}
+
+type chaosController struct {
+	control sync.Mutex // Held while starting or stopping
+	mutex   sync.Mutex
+	config  *ChaosConfig
+	rand    *rand.Rand
+	rounds  int
+	faults  []ChaosFault
+	aborted string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// validateChaosConfig checks a config, adding its toxics to a collection of
+// its own so that their types and attributes are checked like any toxic.
+func (server *ApiServer) validateChaosConfig(config *ChaosConfig) error {
+	var err error
+	switch {
+	case len(config.Toxics) == 0:
+		err = fmt.Errorf("toxics must not be empty")
+	case config.Intensity <= 0 || config.Intensity > 1:
+		err = fmt.Errorf("intensity must be more than 0 and at most 1")
+	case config.Interval <= 0:
+		err = fmt.Errorf("interval must be positive")
+	}
+	if err != nil {
+		return joinError(err, ErrInvalidChaos)
+	}
+	for _, probe := range config.Probes {
+		err = validateChaosProbe(probe)
+		if err != nil {
+			return err
+		}
+	}
+
+	collection := NewToxicCollection(&Proxy{apiServer: server})
+	for i, toxic := range config.Toxics {
+		_, err = collection.AddToxicJson(chaosToxicJSON(toxic, fmt.Sprint("check", i), 1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func chaosToxicJSON(toxic PresetToxic, name string, seed int64) *bytes.Reader {
+	data, _ := json.Marshal(map[string]interface{}{
+		"name":       name,
+		"type":       toxic.Type,
+		"stream":     toxic.Stream,
+		"toxicity":   toxic.Toxicity,
+		"attributes": toxic.Attributes,
+		"seed":       seed,
+	})
+	return bytes.NewReader(data)
+}
+
+// StartChaos starts adding faults to the proxies as configured, replacing the
+// faults of the controller if it was already running.
+func (server *ApiServer) StartChaos(config ChaosConfig) error {
+	config.Toxics = append([]PresetToxic{}, config.Toxics...)
+	for i := range config.Toxics {
+		if config.Toxics[i].Stream == "" {
+			config.Toxics[i].Stream = "downstream"
+		}
+		if config.Toxics[i].Toxicity == 0 {
+			config.Toxics[i].Toxicity = 1
+		}
+	}
+	config.Probes = append([]ChaosProbe{}, config.Probes...)
+	for i := range config.Probes {
+		config.Probes[i].setDefaults()
+	}
+	err := server.validateChaosConfig(&config)
+	if err != nil {
+		return err
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	c := server.chaos
+	c.control.Lock()
+	defer c.control.Unlock()
+	server.stopChaos()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.config = &config
+	c.rand = rand.New(rand.NewSource(config.Seed)) // #nosec G404 -- replayable on purpose
+	c.rounds = 0
+	c.aborted = ""
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go server.runChaos(&config, c.stop, c.done)
+	return nil
+}
+
+// StopChaos stops the chaos controller, and removes the faults it added.
+func (server *ApiServer) StopChaos() {
+	server.chaos.control.Lock()
+	defer server.chaos.control.Unlock()
+	server.stopChaos()
+}
+
+func (server *ApiServer) stopChaos() {
+	c := server.chaos
+	c.mutex.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeFaults()
+}
+
+// ChaosStatus returns the state of the chaos controller.
+func (server *ApiServer) ChaosStatus() ChaosStatus {
+	c := server.chaos
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return ChaosStatus{
+		Running: c.stop != nil && c.aborted == "",
+		Config:  c.config,
+		Rounds:  c.rounds,
+		Faults:  append([]ChaosFault{}, c.faults...),
+		Aborted: c.aborted,
+	}
+}
+
+func (server *ApiServer) runChaos(config *ChaosConfig, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(time.Duration(config.Interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	aborted := make(chan string, 1)
+	probesStop := make(chan struct{})
+	var probes sync.WaitGroup
+	for _, probe := range config.Probes {
+		probes.Add(1)
+		go func() {
+			defer probes.Done()
+			server.runChaosProbe(probe, aborted, probesStop)
+		}()
+	}
+	defer probes.Wait()
+	defer close(probesStop)
+
+	for {
+		server.chaosRound()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case reason := <-aborted:
+			server.abortChaos(reason)
+			return
+		}
+	}
+}
+
+// abortChaos removes the faults of the controller once the steady state is
+// lost, and keeps the reason in its status until it is started again.
+func (server *ApiServer) abortChaos(reason string) {
+	c := server.chaos
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeFaults()
+	c.aborted = reason
+	server.Logger.Warn().Str("reason", reason).Msg("Aborted chaos")
+}
+
+// chaosRound removes the faults of the previous round, and adds a fault to
+// each target proxy with a chance of the intensity.
+func (server *ApiServer) chaosRound() {
+	c := server.chaos
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeFaults()
+	c.rounds++
+
+	names := c.config.Proxies
+	if len(names) == 0 {
+		for name := range server.Collection.Proxies() {
+			names = append(names, name)
+		}
+		// Map order is random, the faults are the same for a seed.
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		// The random values are drawn for missing proxies too, so that a
+		// proxy deleted doesn't change the faults of the others.
+		roll, pick, seed := c.rand.Float64(), c.rand.Intn(len(c.config.Toxics)), c.rand.Int63()|1
+		if roll >= c.config.Intensity {
+			continue
+		}
+		proxy, err := server.Collection.Get(name)
+		if err != nil {
+			continue
+		}
+
+		toxic := c.config.Toxics[pick]
+		added, err := proxy.Toxics.AddToxicJson(
+			chaosToxicJSON(toxic, "chaos_"+toxic.Type+"_"+toxic.Stream, seed),
+		)
+		if err != nil {
+			proxy.Logger.Warn().Err(err).Str("toxic", toxic.Type).Msg("Unable to add chaos toxic")
+			continue
+		}
+		proxy.Logger.Info().Str("toxic", added.Name).Msg("Added chaos toxic")
+		c.faults = append(c.faults, ChaosFault{
+			Proxy: name,
+			Toxic: added.Name,
+			Type:  added.Type,
+			proxy: proxy,
+		})
+	}
+}
+
+// removeFaults removes the toxics of the last round, unless they were already
+// removed, e.g. by a reset. It is called with the lock taken.
+func (c *chaosController) removeFaults() {
+	for _, fault := range c.faults {
+		err := fault.proxy.Toxics.RemoveToxic(context.Background(), fault.Toxic)
+		if err == nil {
+			fault.proxy.Logger.Info().Str("toxic", fault.Toxic).Msg("Removed chaos toxic")
+		}
+	}
+	c.faults = nil
+}
+
+func (server *ApiServer) ChaosShow(response http.ResponseWriter, request *http.Request) {
+	server.writeChaosStatus(response, request)
+}
+
+func (server *ApiServer) ChaosStart(response http.ResponseWriter, request *http.Request) {
+	var config ChaosConfig
+	err := server.checkBody(request, &ChaosConfig{})
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&config)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+
+	err = server.StartChaos(config)
+	if server.apiError(response, err) {
+		return
+	}
+	server.writeChaosStatus(response, request)
+}
+
+func (server *ApiServer) ChaosStop(response http.ResponseWriter, request *http.Request) {
+	server.StopChaos()
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err := response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ChaosStop: Failed to write headers to client")
+	}
+}
+
+func (server *ApiServer) writeChaosStatus(response http.ResponseWriter, request *http.Request) {
+	data, err := json.Marshal(server.ChaosStatus())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("Chaos: Failed to write response to client")
+	}
+}
@@ -0,0 +1,187 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Defaults of the probes of the chaos controller.
+const (
+	defaultProbeInterval  = 1000
+	defaultProbeTimeout   = 1000
+	defaultProbeThreshold = 3
+)
+
+// ChaosProbe checks the steady state of the system while the chaos controller
+// runs: once it failed Threshold times in a row, the toxics of the controller
+// are removed and the experiment is aborted. A probe has one of HTTP, TCP or
+// Webhook.
+type ChaosProbe struct {
+	// HTTP is a URL answering GET requests with a 2xx status.
+	HTTP string `json:"http,omitempty"`
+	// TCP is an address accepting connections.
+	TCP string `json:"tcp,omitempty"`
+	// Webhook is a URL POSTed the ChaosStatus, answering with a verdict of
+	// {"healthy": bool, "reason": string}.
+	Webhook string `json:"webhook,omitempty"`
+
+	// Interval is the number of milliseconds between two checks, and
+	// Timeout the longest a check takes, 1000 if not set. Threshold is the
+	// number of failed checks in a row that abort the experiment, 3 if not
+	// set.
+	Interval  int `json:"interval,omitempty"`
+	Timeout   int `json:"timeout,omitempty"`
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// ChaosVerdict is the answer of the webhook of a probe.
+type ChaosVerdict struct {
+	Healthy bool   `json:"healthy"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (probe *ChaosProbe) setDefaults() {
+	if probe.Interval == 0 {
+		probe.Interval = defaultProbeInterval
+	}
+	if probe.Timeout == 0 {
+		probe.Timeout = defaultProbeTimeout
+	}
+	if probe.Threshold == 0 {
+		probe.Threshold = defaultProbeThreshold
+	}
+}
+
+func validateChaosProbe(probe ChaosProbe) error {
+	set := 0
+	for _, target := range []string{probe.HTTP, probe.TCP, probe.Webhook} {
+		if target != "" {
+			set++
+		}
+	}
+	var err error
+	switch {
+	case set != 1:
+		err = errors.New("a probe must have one of http, tcp or webhook")
+	case probe.Interval < 0 || probe.Timeout < 0 || probe.Threshold < 0:
+		err = errors.New("the interval, timeout and threshold of a probe must not be negative")
+	case probe.TCP != "":
+		_, _, err = net.SplitHostPort(probe.TCP)
+	default:
+		var u *url.URL
+		u, err = url.Parse(probe.HTTP + probe.Webhook)
+		if err == nil && u.Scheme != "http" && u.Scheme != "https" {
+			err = fmt.Errorf("%s is not an http or https URL", u)
+		}
+	}
+	if err != nil {
+		return joinError(err, ErrInvalidChaos)
+	}
+	return nil
+}
+
+// target returns what the probe checks.
+func (probe ChaosProbe) target() string {
+	return probe.HTTP + probe.TCP + probe.Webhook
+}
+
+// check checks the steady state once, giving status to the webhook.
+func (probe ChaosProbe) check(ctx context.Context, status ChaosStatus) error {
+	if probe.TCP != "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	method, body := "GET", []byte(nil)
+	if probe.Webhook != "" {
+		method = "POST"
+		body, _ = json.Marshal(status)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, probe.target(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	if probe.Webhook == "" {
+		_, err = io.Copy(io.Discard, response.Body)
+		return err
+	}
+
+	var verdict ChaosVerdict
+	err = json.NewDecoder(response.Body).Decode(&verdict)
+	if err != nil {
+		return fmt.Errorf("invalid verdict: %w", err)
+	}
+	if !verdict.Healthy {
+		return fmt.Errorf("unhealthy: %s", verdict.Reason)
+	}
+	return nil
+}
+
+// runChaosProbe checks the steady state until stop is closed, and sends the
+// reason to abort the experiment once the probe failed too many times.
+func (server *ApiServer) runChaosProbe(
+	probe ChaosProbe,
+	aborted chan<- string,
+	stop <-chan struct{},
+) {
+	ticker := time.NewTicker(time.Duration(probe.Interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			time.Duration(probe.Timeout)*time.Millisecond,
+		)
+		err := probe.check(ctx, server.ChaosStatus())
+		cancel()
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		server.Logger.
+			Warn().
+			Err(err).
+			Str("probe", probe.target()).
+			Int("failures", failures).
+			Msg("Chaos probe failed")
+		if failures >= probe.Threshold {
+			select {
+			case aborted <- fmt.Sprintf("probe %s failed %d times: %s", probe.target(), failures, err):
+			default:
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package toxiproxy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Shopify/toxiproxy/v2"
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func withChaosServer(t *testing.T, proxies int, f func(*toxiproxy.ApiServer, *tclient.Client)) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := toxiproxy.New(
+		toxiproxy.WithListener(listener),
+		toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+	go server.Listen("")
+	defer server.Shutdown()
+
+	client := tclient.NewClient(listener.Addr().String())
+	err = client.WaitForReady(context.Background())
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+	for i := range proxies {
+		proxy, err := client.CreateProxy(fmt.Sprint("proxy", i), "localhost:0", "localhost:20000")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		defer proxy.Delete()
+	}
+	f(server, client)
+}
+
+// waitForChaosRound waits for the first round of the chaos controller.
+func waitForChaosRound(t *testing.T, server *toxiproxy.ApiServer) toxiproxy.ChaosStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status := server.ChaosStatus(); status.Rounds > 0 {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Chaos did not run")
+	return toxiproxy.ChaosStatus{}
+}
+
+func TestChaosAddsAndRemovesToxics(t *testing.T) {
+	withChaosServer(t, 2, func(server *toxiproxy.ApiServer, client *tclient.Client) {
+		status, err := client.StartChaos(tclient.ChaosConfig{
+			Proxies: []string{"proxy0", "proxy1", "missing"},
+			Toxics: []tclient.Toxic{
+				{Type: "latency", Attributes: tclient.Attributes{"latency": 100}},
+			},
+			Intensity: 1,
+			Interval:  int(time.Hour / time.Millisecond),
+		})
+		if err != nil {
+			t.Fatal("Unable to start chaos:", err)
+		}
+		if !status.Running || status.Config.Seed == 0 {
+			t.Fatalf("Expected chaos to run with a seed, got %+v", status)
+		}
+
+		waitForChaosRound(t, server)
+		for _, name := range []string{"proxy0", "proxy1"} {
+			toxics, err := client.Proxy(name)
+			if err != nil {
+				t.Fatal("Unable to retrieve proxy:", err)
+			}
+			if len(toxics.ActiveToxics) != 1 ||
+				toxics.ActiveToxics[0].Name != "chaos_latency_downstream" {
+				t.Errorf("Expected a chaos toxic on %s, got %+v", name, toxics.ActiveToxics)
+			}
+		}
+
+		err = client.StopChaos()
+		if err != nil {
+			t.Fatal("Unable to stop chaos:", err)
+		}
+		for _, name := range []string{"proxy0", "proxy1"} {
+			toxics, err := client.Proxy(name)
+			if err != nil {
+				t.Fatal("Unable to retrieve proxy:", err)
+			}
+			if len(toxics.ActiveToxics) != 0 {
+				t.Errorf("Expected the chaos toxic of %s to be removed, got %+v",
+					name, toxics.ActiveToxics)
+			}
+		}
+		status, err = client.Chaos()
+		if err != nil || status.Running {
+			t.Fatalf("Expected chaos to be stopped, got %+v and %v", status, err)
+		}
+	})
+}
+
+func TestChaosIsReplayedWithItsSeed(t *testing.T) {
+	config := toxiproxy.ChaosConfig{
+		Toxics: []toxiproxy.PresetToxic{
+			{Type: "latency", Attributes: map[string]interface{}{"latency": 100}},
+			{Type: "timeout", Stream: "upstream"},
+		},
+		Intensity: 0.5,
+		Interval:  int(time.Hour / time.Millisecond),
+		Seed:      42,
+	}
+
+	var faults [2][]toxiproxy.ChaosFault
+	for i := range faults {
+		withChaosServer(t, 8, func(server *toxiproxy.ApiServer, client *tclient.Client) {
+			err := server.StartChaos(config)
+			if err != nil {
+				t.Fatal("Unable to start chaos:", err)
+			}
+			for _, fault := range waitForChaosRound(t, server).Faults {
+				faults[i] = append(faults[i], toxiproxy.ChaosFault{
+					Proxy: fault.Proxy, Toxic: fault.Toxic, Type: fault.Type,
+				})
+			}
+		})
+	}
+
+	if len(faults[0]) == 0 || len(faults[0]) == 8 {
+		t.Errorf("Expected some of the proxies to get a fault, got %v", faults[0])
+	}
+	if !reflect.DeepEqual(faults[0], faults[1]) {
+		t.Errorf("Expected the same faults with the same seed, got %v and %v", faults[0], faults[1])
+	}
+}
+
+func TestChaosConfigValidation(t *testing.T) {
+	withChaosServer(t, 0, func(server *toxiproxy.ApiServer, client *tclient.Client) {
+		latency := []tclient.Toxic{{Type: "latency"}}
+		for _, config := range []tclient.ChaosConfig{
+			{Intensity: 1, Interval: 100},
+			{Toxics: latency, Intensity: 0, Interval: 100},
+			{Toxics: latency, Intensity: 1.5, Interval: 100},
+			{Toxics: latency, Intensity: 1, Interval: 0},
+			{Toxics: latency, Intensity: 1, Interval: 100, Probes: []tclient.ChaosProbe{{}}},
+			{Toxics: latency, Intensity: 1, Interval: 100, Probes: []tclient.ChaosProbe{
+				{HTTP: "http://localhost", TCP: "localhost:80"},
+			}},
+			{Toxics: latency, Intensity: 1, Interval: 100, Probes: []tclient.ChaosProbe{
+				{Webhook: "ftp://localhost"},
+			}},
+			{Toxics: latency, Intensity: 1, Interval: 100, Probes: []tclient.ChaosProbe{
+				{TCP: "localhost"},
+			}},
+		} {
+			_, err := client.StartChaos(config)
+			if !errors.Is(err, tclient.ErrInvalidChaos) {
+				t.Errorf("Expected %+v to be invalid, got %v", config, err)
+			}
+		}
+
+		_, err := client.StartChaos(tclient.ChaosConfig{
+			Toxics:    []tclient.Toxic{{Type: "unknown"}},
+			Intensity: 1,
+			Interval:  100,
+		})
+		if !errors.Is(err, tclient.ErrInvalidToxicType) {
+			t.Errorf("Expected the toxics to be checked, got %v", err)
+		}
+	})
+}
+
+// waitForChaosAbort waits for a probe to abort the chaos controller.
+func waitForChaosAbort(t *testing.T, server *toxiproxy.ApiServer) toxiproxy.ChaosStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status := server.ChaosStatus(); status.Aborted != "" {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Chaos was not aborted")
+	return toxiproxy.ChaosStatus{}
+}
+
+func TestChaosIsAbortedByProbes(t *testing.T) {
+	closed, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status toxiproxy.ChaosStatus
+		err := json.NewDecoder(r.Body).Decode(&status)
+		healthy := err == nil && len(status.Faults) == 0
+		json.NewEncoder(w).Encode(toxiproxy.ChaosVerdict{Healthy: healthy, Reason: "faults"})
+	}))
+	defer webhook.Close()
+
+	for name, probe := range map[string]toxiproxy.ChaosProbe{
+		"http":    {HTTP: health.URL},
+		"tcp":     {TCP: closed.Addr().String()},
+		"webhook": {Webhook: webhook.URL},
+	} {
+		t.Run(name, func(t *testing.T) {
+			withChaosServer(t, 1, func(server *toxiproxy.ApiServer, client *tclient.Client) {
+				healthy.Store(true)
+				probe.Interval = 10
+				err := server.StartChaos(toxiproxy.ChaosConfig{
+					Toxics:    []toxiproxy.PresetToxic{{Type: "timeout"}},
+					Intensity: 1,
+					Interval:  int(time.Hour / time.Millisecond),
+					Probes:    []toxiproxy.ChaosProbe{probe},
+				})
+				if err != nil {
+					t.Fatal("Unable to start chaos:", err)
+				}
+				waitForChaosRound(t, server)
+				healthy.Store(false)
+
+				status := waitForChaosAbort(t, server)
+				if status.Running || len(status.Faults) != 0 {
+					t.Errorf("Expected chaos to be stopped without faults, got %+v", status)
+				}
+				proxy, err := client.Proxy("proxy0")
+				if err != nil {
+					t.Fatal("Unable to retrieve proxy:", err)
+				}
+				if len(proxy.ActiveToxics) != 0 {
+					t.Errorf("Expected the chaos toxic to be removed, got %+v", proxy.ActiveToxics)
+				}
+			})
+		})
+	}
+}
+
+func TestChaosProbesTolerateFailuresBelowTheirThreshold(t *testing.T) {
+	var checks atomic.Int32
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every other check fails, never twice in a row.
+		if checks.Add(1)%2 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer health.Close()
+
+	withChaosServer(t, 1, func(server *toxiproxy.ApiServer, client *tclient.Client) {
+		err := server.StartChaos(toxiproxy.ChaosConfig{
+			Toxics:    []toxiproxy.PresetToxic{{Type: "timeout"}},
+			Intensity: 1,
+			Interval:  int(time.Hour / time.Millisecond),
+			Probes:    []toxiproxy.ChaosProbe{{HTTP: health.URL, Interval: 10, Threshold: 2}},
+		})
+		if err != nil {
+			t.Fatal("Unable to start chaos:", err)
+		}
+		for checks.Load() < 10 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		status := server.ChaosStatus()
+		if !status.Running || status.Aborted != "" {
+			t.Errorf("Expected chaos to keep running, got %+v", status)
+		}
+	})
+}
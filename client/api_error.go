@@ -7,13 +7,77 @@ package toxiproxy
 
 import (
 	"fmt"
+	"strings"
 )
 
 type ApiError struct {
 	Message string `json:"error"`
 	Status  int    `json:"status"`
+	// Code identifies the cause of the error, e.g. proxy_not_found or
+	// invalid_attribute:latency. Empty with older servers.
+	Code string `json:"code"`
 }
 
 func (err *ApiError) Error() string {
 	return fmt.Sprintf("HTTP %d: %s", err.Status, err.Message)
 }
+
+// Is makes errors.Is match an error with the code of one of the Err values,
+// e.g. errors.Is(err, toxiproxy.ErrProxyNotFound). The attribute of an
+// invalid_attribute code is ignored.
+func (err *ApiError) Is(target error) bool {
+	other, ok := target.(*ApiError)
+	if !ok || other.Code == "" {
+		return false
+	}
+	code, _, _ := strings.Cut(err.Code, ":")
+	return code == other.Code
+}
+
+// Attribute returns the attribute of an invalid_attribute error.
+func (err *ApiError) Attribute() string {
+	_, attribute, _ := strings.Cut(err.Code, ":")
+	return attribute
+}
+
+var (
+	ErrBadRequestBody           = &ApiError{Code: "bad_request_body"}
+	ErrMissingField             = &ApiError{Code: "missing_field"}
+	ErrProxyNotFound            = &ApiError{Code: "proxy_not_found"}
+	ErrProxyAlreadyExists       = &ApiError{Code: "proxy_exists"}
+	ErrInvalidStream            = &ApiError{Code: "invalid_stream"}
+	ErrInvalidToxicType         = &ApiError{Code: "invalid_toxic_type"}
+	ErrInvalidAttribute         = &ApiError{Code: "invalid_attribute"}
+	ErrToxicAlreadyExists       = &ApiError{Code: "toxic_exists"}
+	ErrToxicNotFound            = &ApiError{Code: "toxic_not_found"}
+	ErrToxicNotResumable        = &ApiError{Code: "toxic_not_resumable"}
+	ErrPresetNotFound           = &ApiError{Code: "preset_not_found"}
+	ErrConnectionNotFound       = &ApiError{Code: "connection_not_found"}
+	ErrInvalidBufferSize        = &ApiError{Code: "invalid_buffer_size"}
+	ErrInvalidConnectionLimit   = &ApiError{Code: "invalid_connection_limit"}
+	ErrInvalidSocketOptions     = &ApiError{Code: "invalid_socket_options"}
+	ErrInvalidDialOptions       = &ApiError{Code: "invalid_dial_options"}
+	ErrInvalidConnectionTimeout = &ApiError{Code: "invalid_connection_timeout"}
+	ErrInvalidToxicOrder        = &ApiError{Code: "invalid_toxic_order"}
+	ErrInvalidProtocol          = &ApiError{Code: "invalid_protocol"}
+	ErrInvalidPortRange         = &ApiError{Code: "invalid_port_range"}
+	ErrInvalidListen            = &ApiError{Code: "invalid_listen"}
+	ErrInvalidClientAccess      = &ApiError{Code: "invalid_client_access"}
+	ErrNamespaceForbidden       = &ApiError{Code: "namespace_forbidden"}
+	ErrInvalidChaos             = &ApiError{Code: "invalid_chaos"}
+	ErrInvalidModulation        = &ApiError{Code: "invalid_modulation"}
+	ErrInvalidBackpressure      = &ApiError{Code: "invalid_backpressure"}
+	ErrInvalidHang              = &ApiError{Code: "invalid_hang"}
+	ErrInvalidMatch             = &ApiError{Code: "invalid_match"}
+	ErrRateLimited              = &ApiError{Code: "rate_limited"}
+	ErrRequestTooLarge          = &ApiError{Code: "request_too_large"}
+	ErrInvalidPopulateOption    = &ApiError{Code: "invalid_populate_option"}
+	ErrSnapshotNotFound         = &ApiError{Code: "snapshot_not_found"}
+	ErrUnknownField             = &ApiError{Code: "unknown_field"}
+	ErrListenConflict           = &ApiError{Code: "listen_conflict"}
+	ErrInvalidSwitchover        = &ApiError{Code: "invalid_switchover"}
+	ErrInvalidHealthCheck       = &ApiError{Code: "invalid_health_check"}
+	ErrNotReady                 = &ApiError{Code: "not_ready"}
+	ErrInvalidWait              = &ApiError{Code: "invalid_wait"}
+	ErrWaitTimeout              = &ApiError{Code: "wait_timeout"}
+)
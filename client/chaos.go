@@ -0,0 +1,117 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// ChaosConfig configures the chaos controller of the server, which adds
+// random toxics to random proxies and removes them over time.
+type ChaosConfig struct {
+	// Names of the proxies faults are added to, all the proxies outside of
+	// namespaces if empty.
+	Proxies []string `json:"proxies,omitempty"`
+	// Palette of the faults, one of which is picked at random for each fault.
+	// Their names are ignored, their stream is downstream if empty and their
+	// toxicity 1 if 0.
+	Toxics []Toxic `json:"toxics"`
+	// Chance between 0 and 1 that each proxy gets a fault at each interval.
+	Intensity float64 `json:"intensity"`
+	// Milliseconds between two rounds, the faults of a round being removed at
+	// the next one.
+	Interval int `json:"interval"`
+	// Seed of the faults, to replay them, random if 0.
+	Seed int64 `json:"seed,omitempty"`
+	// Probes checking the steady state of the system, the experiment being
+	// aborted and its faults removed once one of them fails too many times.
+	Probes []ChaosProbe `json:"probes,omitempty"`
+}
+
+// ChaosProbe checks the steady state of the system during chaos, with one of
+// an HTTP URL answering with a 2xx status, a TCP address accepting
+// connections, or a webhook URL POSTed the ChaosStatus and answering with
+// {"healthy": bool, "reason": string}.
+type ChaosProbe struct {
+	HTTP    string `json:"http,omitempty"`
+	TCP     string `json:"tcp,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+	// Milliseconds between two checks and the longest a check takes, 1000
+	// if 0.
+	Interval int `json:"interval,omitempty"`
+	Timeout  int `json:"timeout,omitempty"`
+	// Failed checks in a row aborting the experiment, 3 if 0.
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// ChaosFault is a toxic added to a proxy by the chaos controller.
+type ChaosFault struct {
+	Proxy string `json:"proxy"`
+	Toxic string `json:"toxic"`
+	Type  string `json:"type"`
+}
+
+// ChaosStatus is the state of the chaos controller, with the faults of its
+// last round, and the reason a probe aborted it if one did.
+type ChaosStatus struct {
+	Running bool         `json:"running"`
+	Config  *ChaosConfig `json:"config"`
+	Rounds  int          `json:"rounds"`
+	Faults  []ChaosFault `json:"faults"`
+	Aborted string       `json:"aborted,omitempty"`
+}
+
+// Chaos returns the state of the chaos controller of the server.
+func (client *Client) Chaos() (*ChaosStatus, error) {
+	return client.ChaosContext(context.Background())
+}
+
+// ChaosContext is like Chaos but takes a context.
+func (client *Client) ChaosContext(ctx context.Context) (*ChaosStatus, error) {
+	resp, err := client.get(ctx, "/chaos")
+	if err != nil {
+		return nil, err
+	}
+	return decodeChaosStatus(resp)
+}
+
+// StartChaos starts the chaos controller of the server, replacing the faults
+// of the previous config if it was running.
+func (client *Client) StartChaos(config ChaosConfig) (*ChaosStatus, error) {
+	return client.StartChaosContext(context.Background(), config)
+}
+
+// StartChaosContext is like StartChaos but takes a context.
+func (client *Client) StartChaosContext(
+	ctx context.Context,
+	config ChaosConfig,
+) (*ChaosStatus, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.put(ctx, "/chaos", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return decodeChaosStatus(resp)
+}
+
+// StopChaos stops the chaos controller of the server, removing its faults.
+func (client *Client) StopChaos() error {
+	return client.StopChaosContext(context.Background())
+}
+
+// StopChaosContext is like StopChaos but takes a context.
+func (client *Client) StopChaosContext(ctx context.Context) error {
+	return client.delete(ctx, "/chaos")
+}
+
+func decodeChaosStatus(data []byte) (*ChaosStatus, error) {
+	status := new(ChaosStatus)
+	err := json.Unmarshal(data, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
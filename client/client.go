@@ -6,10 +6,13 @@ package toxiproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -17,38 +20,131 @@ import (
 // Client holds information about where to connect to Toxiproxy.
 type Client struct {
 	UserAgent string
+	// Header is sent with every request, e.g. for the Authorization of a
+	// Toxiproxy server behind an authenticating proxy.
+	Header http.Header
+	// Retry, when set, retries requests that fail to reach the server.
+	Retry     *RetryPolicy
 	endpoint  string
+	socket    string
+	namespace string
 	http      *http.Client
 }
 
 // NewClient creates a new client which provides the base of all communication
 // with Toxiproxy. Endpoint is the address to the proxy (e.g. localhost:8474 if
-// not overridden).
+// not overridden), or the unix socket of the API written unix:/path.
 func NewClient(endpoint string) *Client {
+	http := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	var socket string
+	if path, ok := strings.CutPrefix(endpoint, "unix:"); ok {
+		socket = path
+		http.Transport = unixTransport(socket)
+		endpoint = "unix"
+	}
 	if !strings.HasPrefix(endpoint, "https://") &&
 		!strings.HasPrefix(endpoint, "http://") {
 		endpoint = "http://" + endpoint
 	}
 
-	http := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	return &Client{
 		UserAgent: "toxiproxy-cli",
 		endpoint:  endpoint,
+		socket:    socket,
 		http:      http,
 	}
 }
 
+// unixTransport sends the requests of a client to a unix socket, or to an
+// abstract socket on Linux when path starts with @.
+func unixTransport(path string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// SetHTTPClient replaces the HTTP client used to send requests, to configure
+// TLS or a different timeout. The requests of a client of a unix socket are
+// still sent to the socket, unless httpClient has a Transport.
+func (client *Client) SetHTTPClient(httpClient *http.Client) {
+	if client.socket != "" && httpClient.Transport == nil {
+		withSocket := *httpClient
+		withSocket.Transport = unixTransport(client.socket)
+		httpClient = &withSocket
+	}
+	client.http = httpClient
+}
+
+// waiting returns the client with an HTTP timeout longer than a request
+// waiting on the server for up to timeout.
+func (client *Client) waiting(timeout time.Duration) *Client {
+	if client.http.Timeout == 0 || client.http.Timeout > timeout+10*time.Second {
+		return client
+	}
+	http := *client.http
+	http.Timeout = timeout + 10*time.Second
+	waiting := *client
+	waiting.http = &http
+	return &waiting
+}
+
 // Version returns a Toxiproxy running version.
 func (client *Client) Version() ([]byte, error) {
-	return client.get("/version")
+	return client.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but takes a context.
+func (client *Client) VersionContext(ctx context.Context) ([]byte, error) {
+	return client.get(ctx, "/version")
+}
+
+// Ready returns nil once the server is usable, the proxies of its config file
+// being populated, and an error matching ErrNotReady with the reason if not.
+func (client *Client) Ready() error {
+	return client.ReadyContext(context.Background())
+}
+
+// ReadyContext is like Ready but takes a context.
+func (client *Client) ReadyContext(ctx context.Context) error {
+	_, err := client.get(ctx, "/ready")
+	return err
+}
+
+// ToxicTypes returns the sorted names of the toxic types known by the server,
+// including custom toxics compiled into it.
+func (client *Client) ToxicTypes() ([]string, error) {
+	return client.ToxicTypesContext(context.Background())
+}
+
+// ToxicTypesContext is like ToxicTypes but takes a context.
+func (client *Client) ToxicTypesContext(ctx context.Context) ([]string, error) {
+	resp, err := client.get(ctx, "/toxics")
+	if err != nil {
+		return nil, err
+	}
+
+	var types []string
+	err = json.Unmarshal(resp, &types)
+	if err != nil {
+		return nil, err
+	}
+
+	return types, nil
 }
 
 // Proxies returns a map with all the proxies and their toxics.
 func (client *Client) Proxies() (map[string]*Proxy, error) {
-	resp, err := client.get("/proxies")
+	return client.ProxiesContext(context.Background())
+}
+
+// ProxiesContext is like Proxies but takes a context.
+func (client *Client) ProxiesContext(ctx context.Context) (map[string]*Proxy, error) {
+	resp, err := client.get(ctx, "/proxies")
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +174,14 @@ func (client *Client) NewProxy() *Proxy {
 // CreateProxy instantiates a new proxy and starts listening on the specified address.
 // This is an alias for `NewProxy()` + `proxy.Save()`.
 func (client *Client) CreateProxy(name, listen, upstream string) (*Proxy, error) {
+	return client.CreateProxyContext(context.Background(), name, listen, upstream)
+}
+
+// CreateProxyContext is like CreateProxy but takes a context.
+func (client *Client) CreateProxyContext(
+	ctx context.Context,
+	name, listen, upstream string,
+) (*Proxy, error) {
 	proxy := &Proxy{
 		Name:     name,
 		Listen:   listen,
@@ -86,7 +190,7 @@ func (client *Client) CreateProxy(name, listen, upstream string) (*Proxy, error)
 		client:   client,
 	}
 
-	err := proxy.Save()
+	err := proxy.SaveContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("create: %w", err)
 	}
@@ -96,7 +200,12 @@ func (client *Client) CreateProxy(name, listen, upstream string) (*Proxy, error)
 
 // Proxy returns a proxy by name.
 func (client *Client) Proxy(name string) (*Proxy, error) {
-	resp, err := client.get("/proxies/" + name)
+	return client.ProxyContext(context.Background(), name)
+}
+
+// ProxyContext is like Proxy but takes a context.
+func (client *Client) ProxyContext(ctx context.Context, name string) (*Proxy, error) {
+	resp, err := client.get(ctx, "/proxies/"+name)
 	if err != nil {
 		return nil, err
 	}
@@ -112,11 +221,39 @@ func (client *Client) Proxy(name string) (*Proxy, error) {
 	return proxy, nil
 }
 
+// ProxyListen returns the address a proxy listens on, e.g. the port of the
+// pool of the server it was given when created with a listen address of "0".
+func (client *Client) ProxyListen(name string) (string, error) {
+	return client.ProxyListenContext(context.Background(), name)
+}
+
+// ProxyListenContext is like ProxyListen but takes a context.
+func (client *Client) ProxyListenContext(ctx context.Context, name string) (string, error) {
+	resp, err := client.get(ctx, "/proxies/"+name+"/listen")
+	if err != nil {
+		return "", err
+	}
+
+	var listen struct {
+		Listen string `json:"listen"`
+	}
+	err = json.Unmarshal(resp, &listen)
+	if err != nil {
+		return "", err
+	}
+	return listen.Listen, nil
+}
+
 // Create a list of proxies using a configuration list. If a proxy already exists,
 // it will be replaced with the specified configuration.
 // For large amounts of proxies, `config` can be loaded from a file.
 // Returns a list of the successfully created proxies.
 func (client *Client) Populate(config []Proxy) ([]*Proxy, error) {
+	return client.PopulateContext(context.Background(), config)
+}
+
+// PopulateContext is like Populate but takes a context.
+func (client *Client) PopulateContext(ctx context.Context, config []Proxy) ([]*Proxy, error) {
 	proxies := struct {
 		Proxies []*Proxy `json:"proxies"`
 	}{}
@@ -125,7 +262,7 @@ func (client *Client) Populate(config []Proxy) ([]*Proxy, error) {
 		return nil, err
 	}
 
-	resp, err := client.post("/populate", bytes.NewReader(request))
+	resp, err := client.post(ctx, "/populate", bytes.NewReader(request))
 	if err != nil {
 		return nil, fmt.Errorf("Populate: %w", err)
 	}
@@ -142,23 +279,107 @@ func (client *Client) Populate(config []Proxy) ([]*Proxy, error) {
 	return proxies.Proxies, err
 }
 
+// PopulateOptions prunes the proxies not in the config of Reconcile, or only
+// plans the changes.
+type PopulateOptions struct {
+	// Prune removes the proxies of the server not in the config.
+	Prune bool
+	// DryRun returns the plan without changing the proxies.
+	DryRun bool
+}
+
+// PopulatePlan lists the names of the proxies a populate creates, replaces
+// because their listen or upstream address changed, keeps with their new
+// options, and removes when pruning.
+type PopulatePlan struct {
+	Created  []string `json:"created"`
+	Replaced []string `json:"replaced"`
+	Kept     []string `json:"kept"`
+	Removed  []string `json:"removed"`
+}
+
+// Reconcile is like Populate, with options to remove the proxies not in the
+// config or only plan the changes. It returns the proxies populated, none in
+// a dry run, and the plan of the changes.
+func (client *Client) Reconcile(
+	config []Proxy,
+	options PopulateOptions,
+) ([]*Proxy, *PopulatePlan, error) {
+	return client.ReconcileContext(context.Background(), config, options)
+}
+
+// ReconcileContext is like Reconcile but takes a context.
+func (client *Client) ReconcileContext(
+	ctx context.Context,
+	config []Proxy,
+	options PopulateOptions,
+) ([]*Proxy, *PopulatePlan, error) {
+	result := struct {
+		Proxies []*Proxy      `json:"proxies"`
+		Plan    *PopulatePlan `json:"plan"`
+	}{}
+	request, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := url.Values{}
+	if options.Prune {
+		query.Set("prune", "true")
+	}
+	if options.DryRun {
+		query.Set("dry_run", "true")
+	}
+	path := "/populate"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := client.post(ctx, path, bytes.NewReader(request))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Reconcile: %w", err)
+	}
+
+	err = json.Unmarshal(resp, &result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, proxy := range result.Proxies {
+		proxy.client = client
+	}
+
+	return result.Proxies, result.Plan, nil
+}
+
 // AddToxic creates a toxic to proxy.
 func (client *Client) AddToxic(options *ToxicOptions) (*Toxic, error) {
-	proxy, err := client.Proxy(options.ProxyName)
+	return client.AddToxicContext(context.Background(), options)
+}
+
+// AddToxicContext is like AddToxic but takes a context.
+func (client *Client) AddToxicContext(ctx context.Context, options *ToxicOptions) (*Toxic, error) {
+	proxy, err := client.ProxyContext(ctx, options.ProxyName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve proxy with name `%s`: %v", options.ProxyName, err)
+		return nil, fmt.Errorf("failed to retrieve proxy with name `%s`: %w", options.ProxyName, err)
 	}
 
-	toxic, err := proxy.AddToxic(
-		options.ToxicName,
-		options.ToxicType,
-		options.Stream,
-		options.Toxicity,
-		options.Attributes,
-	)
+	toxic, err := proxy.addToxic(ctx, Toxic{
+		Name:       options.ToxicName,
+		Type:       options.ToxicType,
+		Stream:     options.Stream,
+		Toxicity:   options.Toxicity,
+		Seed:       options.Seed,
+		Sticky:     options.Sticky,
+		Attributes: options.Attributes,
+		Modulation: options.Modulation,
+
+		FirstConnections: options.FirstConnections,
+		EveryConnection:  options.EveryConnection,
+		Match:            options.Match,
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to add toxic to proxy %s: %v", options.ProxyName, err)
+		return nil, fmt.Errorf("failed to add toxic to proxy %s: %w", options.ProxyName, err)
 	}
 
 	return toxic, nil
@@ -166,12 +387,21 @@ func (client *Client) AddToxic(options *ToxicOptions) (*Toxic, error) {
 
 // UpdateToxic update a toxic in proxy.
 func (client *Client) UpdateToxic(options *ToxicOptions) (*Toxic, error) {
-	proxy, err := client.Proxy(options.ProxyName)
+	return client.UpdateToxicContext(context.Background(), options)
+}
+
+// UpdateToxicContext is like UpdateToxic but takes a context.
+func (client *Client) UpdateToxicContext(
+	ctx context.Context,
+	options *ToxicOptions,
+) (*Toxic, error) {
+	proxy, err := client.ProxyContext(ctx, options.ProxyName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve proxy with name `%s`: %v", options.ProxyName, err)
+		return nil, fmt.Errorf("failed to retrieve proxy with name `%s`: %w", options.ProxyName, err)
 	}
 
-	toxic, err := proxy.UpdateToxic(
+	toxic, err := proxy.UpdateToxicContext(
+		ctx,
 		options.ToxicName,
 		options.Toxicity,
 		options.Attributes,
@@ -180,7 +410,7 @@ func (client *Client) UpdateToxic(options *ToxicOptions) (*Toxic, error) {
 	if err != nil {
 		return nil,
 			fmt.Errorf(
-				"failed to update toxic '%s' of proxy '%s': %v",
+				"failed to update toxic '%s' of proxy '%s': %w",
 				options.ToxicName, options.ProxyName, err,
 			)
 	}
@@ -190,15 +420,20 @@ func (client *Client) UpdateToxic(options *ToxicOptions) (*Toxic, error) {
 
 // RemoveToxic removes toxic from proxy.
 func (client *Client) RemoveToxic(options *ToxicOptions) error {
-	proxy, err := client.Proxy(options.ProxyName)
+	return client.RemoveToxicContext(context.Background(), options)
+}
+
+// RemoveToxicContext is like RemoveToxic but takes a context.
+func (client *Client) RemoveToxicContext(ctx context.Context, options *ToxicOptions) error {
+	proxy, err := client.ProxyContext(ctx, options.ProxyName)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve proxy with name `%s`: %v", options.ProxyName, err)
+		return fmt.Errorf("failed to retrieve proxy with name `%s`: %w", options.ProxyName, err)
 	}
 
-	err = proxy.RemoveToxic(options.ToxicName)
+	err = proxy.RemoveToxicContext(ctx, options.ToxicName)
 	if err != nil {
 		return fmt.Errorf(
-			"failed to remove toxic '%s' from proxy '%s': %v",
+			"failed to remove toxic '%s' from proxy '%s': %w",
 			options.ToxicName, options.ProxyName, err,
 		)
 	}
@@ -208,33 +443,79 @@ func (client *Client) RemoveToxic(options *ToxicOptions) error {
 
 // ResetState resets the state of all proxies and toxics in Toxiproxy.
 func (client *Client) ResetState() error {
-	_, err := client.post("/reset", bytes.NewReader([]byte{}))
+	return client.ResetStateContext(context.Background())
+}
+
+// ResetStateContext is like ResetState but takes a context.
+func (client *Client) ResetStateContext(ctx context.Context) error {
+	_, err := client.post(ctx, "/reset", bytes.NewReader([]byte{}))
 	return err
 }
 
-func (c *Client) get(path string) ([]byte, error) {
-	return c.send("GET", path, nil)
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	return c.send(ctx, "GET", path, nil)
 }
 
-func (c *Client) post(path string, body io.Reader) ([]byte, error) {
-	return c.send("POST", path, body)
+func (c *Client) post(ctx context.Context, path string, body io.Reader) ([]byte, error) {
+	return c.send(ctx, "POST", path, body)
 }
 
-func (c *Client) patch(path string, body io.Reader) ([]byte, error) {
-	return c.send("PATCH", path, body)
+func (c *Client) put(ctx context.Context, path string, body io.Reader) ([]byte, error) {
+	return c.send(ctx, "PUT", path, body)
 }
 
-func (c *Client) delete(path string) error {
-	_, err := c.send("DELETE", path, nil)
+func (c *Client) patch(ctx context.Context, path string, body io.Reader) ([]byte, error) {
+	return c.send(ctx, "PATCH", path, body)
+}
+
+func (c *Client) delete(ctx context.Context, path string) error {
+	_, err := c.send(ctx, "DELETE", path, nil)
 	return err
 }
 
-func (c *Client) send(verb, path string, body io.Reader) ([]byte, error) {
-	req, err := http.NewRequest(verb, c.endpoint+path, body)
+func (c *Client) send(ctx context.Context, verb, path string, body io.Reader) ([]byte, error) {
+	// The body is read once, to be sent again by retries.
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := c.sendOnce(ctx, verb, path, payload)
+		if c.Retry == nil || attempt >= c.Retry.MaxAttempts ||
+			!retryable(verb, err) || ctx.Err() != nil {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(c.Retry.backoff(attempt)):
+		}
+	}
+}
+
+func (c *Client) sendOnce(
+	ctx context.Context,
+	verb, path string,
+	payload []byte,
+) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, verb, c.endpoint+c.scopedPath(path), body)
 	if err != nil {
 		return nil, err
 	}
 
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
 	req.Header.Set("User-Agent", c.UserAgent)
 	req.Header.Set("Content-Type", "application/json")
 
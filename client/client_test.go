@@ -1,9 +1,18 @@
 package toxiproxy_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
 )
@@ -72,3 +81,187 @@ func TestClient_Headers(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_CustomHeader(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer secret" {
+			t.Errorf("Authorization for %s %s is expected `Bearer secret', got: `%s'",
+				r.Method,
+				r.URL,
+				auth)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := toxiproxy.NewClient(server.URL)
+	client.Header = http.Header{}
+	client.Header.Set("Authorization", "Bearer secret")
+	client.SetHTTPClient(server.Client())
+
+	_, err := client.Proxies()
+	if err != nil {
+		t.Fatal("Failed to retrieve proxies:", err)
+	}
+}
+
+func TestClient_ContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	client := toxiproxy.NewClient(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.ProxiesContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the request to stop at the deadline, took %s", elapsed)
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	t.Parallel()
+
+	// The paths of unix sockets are short, which the test directories may not be.
+	dir, err := os.MkdirTemp("", "toxiproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client := toxiproxy.NewClient("unix:" + socket)
+	// The requests are still sent to the socket with a client without a transport.
+	client.SetHTTPClient(&http.Client{Timeout: time.Second})
+
+	_, err = client.Proxies()
+	if err != nil {
+		t.Fatal("Failed to retrieve proxies through the socket:", err)
+	}
+}
+
+func TestClient_SetHTTPClientOverTCP(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := toxiproxy.NewClient(server.URL)
+	client.SetHTTPClient(&http.Client{Timeout: time.Second})
+
+	_, err := client.Proxies()
+	if err != nil {
+		t.Fatal("Failed to retrieve proxies over TCP:", err)
+	}
+}
+
+func TestProxy_AddTypedToxic(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"name": "mysql"}`))
+			return
+		}
+
+		toxic := map[string]interface{}{}
+		body, _ := io.ReadAll(r.Body)
+		err := json.Unmarshal(body, &toxic)
+		if err != nil {
+			t.Errorf("Failed to decode toxic %s: %v", body, err)
+		}
+		if toxic["type"] != "latency" {
+			t.Errorf("Expected a latency toxic, got: %s", body)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	proxy, err := toxiproxy.NewClient(server.URL).Proxy("mysql")
+	if err != nil {
+		t.Fatal("Failed to retrieve proxy:", err)
+	}
+
+	toxic, err := proxy.AddTypedToxic("", "", 1, toxiproxy.LatencyToxic{Latency: 100, Jitter: 10})
+	if err != nil {
+		t.Fatal("Failed to add toxic:", err)
+	}
+
+	latency, err := toxiproxy.AttributesAs[toxiproxy.LatencyToxic](toxic)
+	if err != nil {
+		t.Fatal("Failed to read attributes:", err)
+	}
+	if latency.Latency != 100 || latency.Jitter != 10 {
+		t.Fatalf("Expected latency 100 and jitter 10, got: %+v", latency)
+	}
+
+	_, err = toxiproxy.AttributesAs[toxiproxy.BandwidthToxic](toxic)
+	if err == nil {
+		t.Fatal("Expected an error reading a latency toxic as bandwidth")
+	}
+}
+
+func TestDelayBucket_UnmarshalOverflow(t *testing.T) {
+	t.Parallel()
+
+	var histogram toxiproxy.DelayHistogram
+	err := json.Unmarshal([]byte(`{"count": 2, "buckets": [
+		{"le_ms": 1, "count": 1},
+		{"le_ms": "+Inf", "count": 2}
+	]}`), &histogram)
+	if err != nil {
+		t.Fatal("Failed to unmarshal histogram:", err)
+	}
+
+	if histogram.Buckets[0].LeMs != 1 || !math.IsInf(histogram.Buckets[1].LeMs, 1) {
+		t.Fatalf("Unexpected bucket bounds: %+v", histogram.Buckets)
+	}
+	if histogram.Buckets[1].Count != 2 {
+		t.Fatalf("Expected 2 delays in the overflow bucket, got %d", histogram.Buckets[1].Count)
+	}
+}
+
+func TestDelayBucket_MarshalOverflow(t *testing.T) {
+	t.Parallel()
+
+	data, err := json.Marshal([]toxiproxy.DelayBucket{
+		{LeMs: 1, Count: 1},
+		{LeMs: math.Inf(1), Count: 2},
+	})
+	if err != nil {
+		t.Fatal("Failed to marshal buckets:", err)
+	}
+
+	expected := `[{"le_ms":1,"count":1},{"le_ms":"+Inf","count":2}]`
+	if string(data) != expected {
+		t.Fatalf("Expected %s, got %s", expected, data)
+	}
+}
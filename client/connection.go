@@ -0,0 +1,52 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Connection is an open client connection of a proxy.
+type Connection struct {
+	ID              uint64    `json:"id"`
+	Client          string    `json:"client"`   // The address of the client
+	Upstream        string    `json:"upstream"` // The local address of the upstream connection
+	OpenedAt        time.Time `json:"opened_at"`
+	UpstreamBytes   int64     `json:"upstream_bytes"`   // Bytes sent to the upstream
+	DownstreamBytes int64     `json:"downstream_bytes"` // Bytes sent to the client
+}
+
+// Connections returns the open connections of the proxy, oldest first.
+func (proxy *Proxy) Connections() ([]Connection, error) {
+	return proxy.ConnectionsContext(context.Background())
+}
+
+// ConnectionsContext is like Connections but takes a context.
+func (proxy *Proxy) ConnectionsContext(ctx context.Context) ([]Connection, error) {
+	resp, err := proxy.client.get(ctx, "/proxies/"+proxy.Name+"/connections")
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []Connection
+	err = json.Unmarshal(resp, &connections)
+	if err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+// KillConnection closes the connection with the given ID, on both the client
+// and the upstream side.
+func (proxy *Proxy) KillConnection(id uint64) error {
+	return proxy.KillConnectionContext(context.Background(), id)
+}
+
+// KillConnectionContext is like KillConnection but takes a context.
+func (proxy *Proxy) KillConnectionContext(ctx context.Context, id uint64) error {
+	return proxy.client.delete(
+		ctx,
+		"/proxies/"+proxy.Name+"/connections/"+strconv.FormatUint(id, 10))
+}
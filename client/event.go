@@ -0,0 +1,73 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Event is a lifecycle event of a proxy or one of its connections, such as an
+// accepted client, a failure to dial the upstream or a closed link.
+type Event struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Proxy     string    `json:"proxy"`
+	Client    string    `json:"client,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"`
+	Direction string    `json:"direction,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// RecentEvents returns the last events kept by the server, from the oldest to
+// the newest. An empty proxy name returns the events of all proxies.
+func (client *Client) RecentEvents(proxy string) ([]Event, error) {
+	return client.RecentEventsContext(context.Background(), proxy)
+}
+
+// RecentEventsContext is like RecentEvents but takes a context.
+func (client *Client) RecentEventsContext(ctx context.Context, proxy string) ([]Event, error) {
+	return client.EventsSinceContext(ctx, proxy, 0)
+}
+
+// EventsSince returns the events kept by the server that happened after the
+// event with the given ID, to poll the server for new events.
+func (client *Client) EventsSince(proxy string, since uint64) ([]Event, error) {
+	return client.EventsSinceContext(context.Background(), proxy, since)
+}
+
+// EventsSinceContext is like EventsSince but takes a context.
+func (client *Client) EventsSinceContext(
+	ctx context.Context,
+	proxy string,
+	since uint64,
+) ([]Event, error) {
+	query := url.Values{}
+	if proxy != "" {
+		query.Set("proxy", proxy)
+	}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+
+	path := "/events/recent"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := client.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	err = json.Unmarshal(resp, &events)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,48 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// ListenStatus tells whether the proxies of the server can listen on an
+// address, and what holds it if they can't.
+type ListenStatus struct {
+	Address   string `json:"address"`
+	Protocol  string `json:"protocol"`
+	Available bool   `json:"available"`
+	// The proxy or the process listening on the address, if known, e.g.
+	// "proxy redis" or "process nginx (pid 412)".
+	Holder string `json:"holder,omitempty"`
+	// Why the address can't be listened on, e.g. "bind: permission denied".
+	Reason string `json:"reason,omitempty"`
+}
+
+// CheckListen tells whether a proxy could listen on an address, e.g.
+// "localhost:3306", with the protocol "tcp" or "udp", TCP if empty.
+func (client *Client) CheckListen(address, protocol string) (*ListenStatus, error) {
+	return client.CheckListenContext(context.Background(), address, protocol)
+}
+
+// CheckListenContext is like CheckListen but takes a context.
+func (client *Client) CheckListenContext(
+	ctx context.Context,
+	address, protocol string,
+) (*ListenStatus, error) {
+	query := url.Values{"address": {address}}
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	resp, err := client.get(ctx, "/listen?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	status := new(ListenStatus)
+	err = json.Unmarshal(resp, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -0,0 +1,42 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Namespace returns a client of the proxies of a namespace of the server, so
+// that independent teams or parallel CI pipelines can use the same proxy
+// names. It shares the settings of client.
+func (client *Client) Namespace(name string) *Client {
+	namespaced := *client
+	namespaced.namespace = name
+	return &namespaced
+}
+
+// DeleteNamespace deletes the proxies of the namespace of the client.
+func (client *Client) DeleteNamespace() error {
+	return client.DeleteNamespaceContext(context.Background())
+}
+
+// DeleteNamespaceContext is like DeleteNamespace but takes a context.
+func (client *Client) DeleteNamespaceContext(ctx context.Context) error {
+	if client.namespace == "" {
+		return errors.New("the client is not the one of a namespace")
+	}
+	return client.delete(ctx, "")
+}
+
+// scopedPath returns the path of a request in the namespace of the client, for
+// the requests about its proxies.
+func (client *Client) scopedPath(path string) string {
+	scoped := path == "" || strings.HasPrefix(path, "/proxies") ||
+		strings.HasPrefix(path, "/reset") || strings.HasPrefix(path, "/populate") ||
+		strings.HasPrefix(path, "/listen")
+	if client.namespace == "" || !scoped {
+		return path
+	}
+	return "/namespaces/" + url.PathEscape(client.namespace) + path
+}
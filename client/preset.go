@@ -0,0 +1,68 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Preset is a named chain of toxics simulating a common network, such as 3g
+// or satellite.
+type Preset struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Toxics      []Toxic `json:"toxics"`
+}
+
+// Presets returns the presets known by the server, sorted by name.
+func (client *Client) Presets() ([]Preset, error) {
+	return client.PresetsContext(context.Background())
+}
+
+// PresetsContext is like Presets but takes a context.
+func (client *Client) PresetsContext(ctx context.Context) ([]Preset, error) {
+	resp, err := client.get(ctx, "/presets")
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []Preset
+	err = json.Unmarshal(resp, &presets)
+	if err != nil {
+		return nil, err
+	}
+
+	return presets, nil
+}
+
+// ApplyPreset adds the toxics of the preset with the given name to the proxy,
+// and returns them. No toxic is added if one of them fails.
+func (proxy *Proxy) ApplyPreset(name string) (Toxics, error) {
+	return proxy.ApplyPresetContext(context.Background(), name)
+}
+
+// ApplyPresetContext is like ApplyPreset but takes a context.
+func (proxy *Proxy) ApplyPresetContext(ctx context.Context, name string) (Toxics, error) {
+	resp, err := proxy.client.post(ctx, "/proxies/"+proxy.Name+"/presets/"+name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ApplyPreset: %w", err)
+	}
+
+	toxics := make(Toxics, 0)
+	err = json.Unmarshal(resp, &toxics)
+	if err != nil {
+		return nil, err
+	}
+
+	return toxics, nil
+}
+
+// RemovePreset removes the toxics added by the preset with the given name.
+func (proxy *Proxy) RemovePreset(name string) error {
+	return proxy.RemovePresetContext(context.Background(), name)
+}
+
+// RemovePresetContext is like RemovePreset but takes a context.
+func (proxy *Proxy) RemovePresetContext(ctx context.Context, name string) error {
+	return proxy.client.delete(ctx, "/proxies/"+proxy.Name+"/presets/"+name)
+}
@@ -0,0 +1,88 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy retries the requests of a client that fail to reach the server,
+// e.g. while its container is starting. Requests answered with an error by the
+// server are not retried, nor are requests that change the state of the server
+// once sent, as the server may have applied them before the connection failed.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts of a request, including the first one
+	MinBackoff  time.Duration // Delay before the first retry, 100ms if not set
+	MaxBackoff  time.Duration // Limit of the delay doubled after each retry, 2s if not set
+}
+
+// backoff returns the delay after the given attempt.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.MinBackoff
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	limit := policy.MaxBackoff
+	if limit <= 0 {
+		limit = 2 * time.Second
+	}
+
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		return limit
+	}
+	return delay
+}
+
+// IsConnectionError reports whether a request failed to reach the server or
+// to get its response, rather than being answered with an error.
+func IsConnectionError(err error) bool {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// isDialError reports whether a request failed to connect to the server, so
+// that it was not sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryable reports whether a request can be sent again after err. Requests
+// other than GET are only sent again if they did not reach the server.
+func retryable(verb string, err error) bool {
+	if !IsConnectionError(err) {
+		return false
+	}
+	return verb == "GET" || isDialError(err)
+}
+
+// WaitForReady blocks until the server responds, or until the context is
+// done. It polls with the backoff of the retry policy of the client.
+func (client *Client) WaitForReady(ctx context.Context) error {
+	policy := client.Retry
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err := client.sendOnce(ctx, "GET", "/version", nil)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("WaitForReady: %w: %w", ctx.Err(), err)
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
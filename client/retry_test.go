@@ -0,0 +1,175 @@
+package toxiproxy_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestClient_RetriesConnectionErrors(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error("Failed to hijack connection:", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := toxiproxy.NewClient(server.URL)
+	_, err := client.Proxies()
+	if !toxiproxy.IsConnectionError(err) {
+		t.Fatalf("Expected a connection error without retries, got: %v", err)
+	}
+
+	attempts.Store(0)
+	client.Retry = &toxiproxy.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+	_, err = client.Proxies()
+	if err != nil {
+		t.Fatal("Failed to retrieve proxies with retries:", err)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestClient_DoesNotRetrySentChanges(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		io.ReadAll(r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error("Failed to hijack connection:", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client := toxiproxy.NewClient(server.URL)
+	client.Retry = &toxiproxy.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+	_, err := client.CreateProxy("mysql", "localhost:3310", "localhost:3306")
+	if !toxiproxy.IsConnectionError(err) {
+		t.Fatalf("Expected a connection error, got: %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("Expected the POST to be sent once, got %d attempts", attempts.Load())
+	}
+}
+
+func TestClient_RetriesUnsentChanges(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := toxiproxy.NewClient(addr)
+	client.Retry = &toxiproxy.RetryPolicy{MaxAttempts: 20, MinBackoff: 10 * time.Millisecond}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name": "mysql", "enabled": true}`))
+	})}
+	defer server.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server.Serve(listener)
+	}()
+
+	_, err = client.CreateProxy("mysql", "localhost:3310", "localhost:3306")
+	if err != nil {
+		t.Fatal("Failed to create proxy once the server started:", err)
+	}
+}
+
+func TestClient_DoesNotRetryApiErrors(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "proxy not found", "status": 404}`))
+	}))
+	defer server.Close()
+
+	client := toxiproxy.NewClient(server.URL)
+	client.Retry = &toxiproxy.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+	_, err := client.Proxy("mysql")
+	if err == nil || toxiproxy.IsConnectionError(err) {
+		t.Fatalf("Expected an API error, got: %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("Expected 1 attempt, got %d", attempts.Load())
+	}
+}
+
+func TestClient_WaitForReady(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := toxiproxy.NewClient(addr)
+	client.Retry = &toxiproxy.RetryPolicy{MinBackoff: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.WaitForReady(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got: %v", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`git-ref`))
+	})}
+	defer server.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server.Serve(listener)
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.WaitForReady(ctx)
+	if err != nil {
+		t.Fatal("Failed to wait for the server:", err)
+	}
+}
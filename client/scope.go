@@ -0,0 +1,68 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+)
+
+// WithToxic adds a toxic to a proxy, calls fn and removes the toxic once fn
+// returns or panics, so that tests don't leak faults between cases. The toxic
+// is removed even if ctx is done by then.
+func (client *Client) WithToxic(
+	ctx context.Context,
+	options *ToxicOptions,
+	fn func() error,
+) (err error) {
+	toxic, err := client.AddToxicContext(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, client.RemoveToxicContext(context.WithoutCancel(ctx), &ToxicOptions{
+			ProxyName: options.ProxyName,
+			ToxicName: toxic.Name,
+		}))
+	}()
+
+	return fn()
+}
+
+// WithToxic is like Client.WithToxic for a toxic of this proxy.
+func (proxy *Proxy) WithToxic(ctx context.Context, toxic Toxic, fn func() error) (err error) {
+	added, err := proxy.AddToxicContext(
+		ctx,
+		toxic.Name,
+		toxic.Type,
+		toxic.Stream,
+		toxic.Toxicity,
+		toxic.Attributes,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, proxy.RemoveToxicContext(context.WithoutCancel(ctx), added.Name))
+	}()
+
+	return fn()
+}
+
+// WithDown disables the proxy, calls fn and enables the proxy again once fn
+// returns or panics.
+func (proxy *Proxy) WithDown(fn func()) error {
+	return proxy.WithDownContext(context.Background(), fn)
+}
+
+// WithDownContext is like WithDown but takes a context.
+func (proxy *Proxy) WithDownContext(ctx context.Context, fn func()) (err error) {
+	err = proxy.DisableContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, proxy.EnableContext(context.WithoutCancel(ctx)))
+	}()
+
+	fn()
+	return nil
+}
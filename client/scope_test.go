@@ -0,0 +1,140 @@
+package toxiproxy_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// recordingServer answers like Toxiproxy for the proxy mysql, and records the
+// requests changing it.
+func recordingServer(t *testing.T) (*toxiproxy.Client, func() []string) {
+	var mutex sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"name": "mysql", "enabled": true}`))
+			return
+		}
+
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mutex.Unlock()
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return toxiproxy.NewClient(server.URL), func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+func assertRequests(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected requests %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Expected requests %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestClient_WithToxicRemovesToxicOnError(t *testing.T) {
+	t.Parallel()
+
+	client, requests := recordingServer(t)
+	failure := errors.New("failure")
+
+	err := client.WithToxic(context.Background(), &toxiproxy.ToxicOptions{
+		ProxyName: "mysql",
+		ToxicName: "latency",
+		ToxicType: "latency",
+		Toxicity:  1,
+	}, func() error {
+		assertRequests(t, requests(), "POST /proxies/mysql/toxics")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the function, got: %v", err)
+	}
+
+	assertRequests(t, requests(),
+		"POST /proxies/mysql/toxics",
+		"DELETE /proxies/mysql/toxics/latency",
+	)
+}
+
+func TestProxy_WithToxicRemovesToxicOnPanic(t *testing.T) {
+	t.Parallel()
+
+	client, requests := recordingServer(t)
+	proxy, err := client.Proxy("mysql")
+	if err != nil {
+		t.Fatal("Failed to retrieve proxy:", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to be propagated")
+			}
+		}()
+		proxy.WithToxic(context.Background(), toxiproxy.Toxic{
+			Name: "timeout",
+			Type: "timeout",
+		}, func() error {
+			panic("failure")
+		})
+	}()
+
+	assertRequests(t, requests(),
+		"POST /proxies/mysql/toxics",
+		"DELETE /proxies/mysql/toxics/timeout",
+	)
+}
+
+func TestProxy_WithDownEnablesProxyOnPanic(t *testing.T) {
+	t.Parallel()
+
+	client, requests := recordingServer(t)
+	proxy, err := client.Proxy("mysql")
+	if err != nil {
+		t.Fatal("Failed to retrieve proxy:", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to be propagated")
+			}
+		}()
+		proxy.WithDown(func() {
+			if proxy.Enabled {
+				t.Error("Expected the proxy to be disabled")
+			}
+			panic("failure")
+		})
+	}()
+
+	if !proxy.Enabled {
+		t.Error("Expected the proxy to be enabled again")
+	}
+	assertRequests(t, requests(), "POST /proxies/mysql", "POST /proxies/mysql")
+}
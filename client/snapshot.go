@@ -0,0 +1,117 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Snapshot is the state of the proxies of the server and of their toxics at a
+// time, which can be restored to roll back the changes made since.
+type Snapshot struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// The proxies with their toxics, as they were when the snapshot was taken.
+	Proxies []Proxy `json:"proxies"`
+
+	client *Client
+}
+
+// CreateSnapshot snapshots the proxies of the server and their toxics.
+func (client *Client) CreateSnapshot() (*Snapshot, error) {
+	return client.CreateSnapshotContext(context.Background())
+}
+
+// CreateSnapshotContext is like CreateSnapshot but takes a context.
+func (client *Client) CreateSnapshotContext(ctx context.Context) (*Snapshot, error) {
+	resp, err := client.post(ctx, "/snapshots", nil)
+	if err != nil {
+		return nil, fmt.Errorf("CreateSnapshot: %w", err)
+	}
+
+	snapshot := &Snapshot{client: client}
+	err = json.Unmarshal(resp, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Snapshots returns the snapshots taken, from the oldest to the newest.
+func (client *Client) Snapshots() ([]*Snapshot, error) {
+	return client.SnapshotsContext(context.Background())
+}
+
+// SnapshotsContext is like Snapshots but takes a context.
+func (client *Client) SnapshotsContext(ctx context.Context) ([]*Snapshot, error) {
+	resp, err := client.get(ctx, "/snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	err = json.Unmarshal(resp, &snapshots)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		snapshot.client = client
+	}
+	return snapshots, nil
+}
+
+// Snapshot returns the snapshot with the given ID.
+func (client *Client) Snapshot(id uint64) (*Snapshot, error) {
+	return client.SnapshotContext(context.Background(), id)
+}
+
+// SnapshotContext is like Snapshot but takes a context.
+func (client *Client) SnapshotContext(ctx context.Context, id uint64) (*Snapshot, error) {
+	resp, err := client.get(ctx, snapshotPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{client: client}
+	err = json.Unmarshal(resp, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Restore rolls the proxies of the server back to the snapshot, removing the
+// proxies created since and creating again the ones removed, with their
+// toxics. The snapshot can be restored again.
+func (snapshot *Snapshot) Restore() error {
+	return snapshot.RestoreContext(context.Background())
+}
+
+// RestoreContext is like Restore but takes a context.
+func (snapshot *Snapshot) RestoreContext(ctx context.Context) error {
+	_, err := snapshot.client.post(ctx, snapshotPath(snapshot.ID)+"/restore", nil)
+	if err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes the snapshot from the server.
+func (snapshot *Snapshot) Delete() error {
+	return snapshot.DeleteContext(context.Background())
+}
+
+// DeleteContext is like Delete but takes a context.
+func (snapshot *Snapshot) DeleteContext(ctx context.Context) error {
+	err := snapshot.client.delete(ctx, snapshotPath(snapshot.ID))
+	if err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	return nil
+}
+
+func snapshotPath(id uint64) string {
+	return "/snapshots/" + strconv.FormatUint(id, 10)
+}
@@ -4,14 +4,118 @@
 // For use with Toxiproxy 2.x
 package toxiproxy
 
+import (
+	"encoding/json"
+	"math"
+)
+
 type Attributes map[string]interface{}
 
+// ToxicStats holds the counters reported by the server for a toxic.
+type ToxicStats struct {
+	Activations int64 `json:"activations"` // Times the toxic was applied to a link
+	Chunks      int64 `json:"chunks"`      // Chunks affected by the toxic
+	Bytes       int64 `json:"bytes"`       // Bytes in the affected chunks
+	Closes      int64 `json:"closes"`      // Links closed or reset by the toxic
+
+	// Distribution of the delays added by the toxic, nil if it did not delay data
+	Delay *DelayHistogram `json:"delay,omitempty"`
+}
+
+// DelayHistogram is a cumulative histogram of the delays added by a toxic.
+type DelayHistogram struct {
+	Count   int64         `json:"count"`
+	SumMs   float64       `json:"sum_ms"`
+	Buckets []DelayBucket `json:"buckets"`
+}
+
+type DelayBucket struct {
+	LeMs  float64 `json:"le_ms"` // Upper bound in milliseconds, +Inf for the overflow bucket
+	Count int64   `json:"count"` // Delays less than or equal to the upper bound
+}
+
+// MarshalJSON writes the bound of the overflow bucket as "+Inf", like the
+// server, so that proxies with their toxics can be saved.
+func (b DelayBucket) MarshalJSON() ([]byte, error) {
+	var le interface{} = b.LeMs
+	if math.IsInf(b.LeMs, 1) {
+		le = "+Inf"
+	}
+	return json.Marshal(struct {
+		LeMs  interface{} `json:"le_ms"`
+		Count int64       `json:"count"`
+	}{le, b.Count})
+}
+
+// UnmarshalJSON reads the "+Inf" bound of the overflow bucket.
+func (b *DelayBucket) UnmarshalJSON(data []byte) error {
+	var bucket struct {
+		LeMs  json.RawMessage `json:"le_ms"`
+		Count int64           `json:"count"`
+	}
+	err := json.Unmarshal(data, &bucket)
+	if err != nil {
+		return err
+	}
+
+	b.Count = bucket.Count
+	if len(bucket.LeMs) == 0 {
+		return nil
+	}
+	if string(bucket.LeMs) == `"+Inf"` {
+		b.LeMs = math.Inf(1)
+		return nil
+	}
+	return json.Unmarshal(bucket.LeMs, &b.LeMs)
+}
+
 type Toxic struct {
-	Name       string     `json:"name"`
-	Type       string     `json:"type"`
-	Stream     string     `json:"stream,omitempty"`
-	Toxicity   float32    `json:"toxicity"`
-	Attributes Attributes `json:"attributes"`
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Stream     string      `json:"stream,omitempty"`
+	Toxicity   float32     `json:"toxicity"`
+	Seed       int64       `json:"seed,omitempty"`   // Of the random values, picked by the server if 0
+	Sticky     bool        `json:"sticky,omitempty"` // Roll the toxicity from the client IP
+	Attributes Attributes  `json:"attributes"`
+	Modulation Modulation  `json:"modulation,omitempty"`
+	Index      int         `json:"index,omitempty"` // Position in the chain of its stream, from 1
+	Stats      *ToxicStats `json:"stats,omitempty"`
+	// Only the first FirstConnections connections opened after the toxic was
+	// added, or every EveryConnection-th of them, are affected, if set.
+	FirstConnections int `json:"first_connections,omitempty"`
+	EveryConnection  int `json:"every_connection,omitempty"`
+	// Restricts the toxic to the connections of some clients or upstreams.
+	Match *Match `json:"match,omitempty"`
+}
+
+// Match restricts a toxic to the connections matching all the fields set: the
+// IP of the client in a CIDR, its port in a range, e.g. "40000-49999", and the
+// address dialed for it, as "host:port" or only a host.
+type Match struct {
+	ClientCIDR  string `json:"client_cidr,omitempty"`
+	ClientPorts string `json:"client_ports,omitempty"`
+	Upstream    string `json:"upstream,omitempty"`
+}
+
+// Modulation is the waveforms that numeric attributes of a toxic follow over
+// time, by attribute name, e.g. a bandwidth rate degrading during simulated
+// peak hours.
+type Modulation map[string]Waveform
+
+// Waveform is a repeating waveform between Min and Max: "sine", at Min at the
+// start of the Period and at Max at its middle, "square", at Max for the Duty
+// fraction of the period (0.5 if 0) and at Min after, or "custom", the Values
+// spread over the period. The periods start at the Unix epoch plus Phase, and
+// the attribute is updated every Interval (1000 if 0), in milliseconds.
+type Waveform struct {
+	Shape    string    `json:"shape"`
+	Min      float64   `json:"min"`
+	Max      float64   `json:"max"`
+	Period   int64     `json:"period"`
+	Phase    int64     `json:"phase,omitempty"`
+	Interval int64     `json:"interval,omitempty"`
+	Duty     float64   `json:"duty,omitempty"`
+	Values   []float64 `json:"values,omitempty"`
 }
 
 type Toxics []Toxic
@@ -23,4 +127,20 @@ type ToxicOptions struct {
 	Stream string
 	Toxicity   float32
 	Attributes Attributes
+	// Seed of the random values of the toxic, so that a run can be replayed.
+	// The server picks one if 0.
+	Seed int64
+	// Sticky rolls the toxicity from the IP of the client, so that a client
+	// gets the same path each time it reconnects.
+	Sticky bool
+	// Modulation makes attributes follow waveforms, when adding a toxic.
+	Modulation Modulation
+	// FirstConnections and EveryConnection scope the toxic to the first N or
+	// every Kth connection opened after it was added, e.g. to degrade one
+	// connection of a pool. Both apply if both are set.
+	FirstConnections int
+	EveryConnection  int
+	// Match restricts the toxic to the connections of some clients or
+	// upstreams, e.g. the ones of the system under test on a shared proxy.
+	Match *Match
 }
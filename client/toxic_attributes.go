@@ -0,0 +1,420 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TypedAttributes are the attributes of one of the toxic types built into
+// Toxiproxy. Custom toxics keep using the Attributes map.
+type TypedAttributes interface {
+	ToxicType() string
+}
+
+// LatencyToxic adds a delay, in milliseconds, to all data going through the
+// proxy, plus or minus a random jitter.
+type LatencyToxic struct {
+	Latency int64 `json:"latency"`
+	Jitter  int64 `json:"jitter"`
+}
+
+func (LatencyToxic) ToxicType() string { return "latency" }
+
+// BandwidthToxic limits a connection to a rate in KB/s, or all the connections
+// of the proxy together if shared. Burst KB pass at once after the connection
+// was idle, and up to Queue KB wait to be sent, or are dropped if Drop is set.
+type BandwidthToxic struct {
+	Rate   int64 `json:"rate"`
+	Shared bool  `json:"shared"`
+	Burst  int64 `json:"burst"`
+	Queue  int64 `json:"queue"`
+	Drop   bool  `json:"drop"`
+}
+
+func (BandwidthToxic) ToxicType() string { return "bandwidth" }
+
+// AsymmetricToxic shapes each direction like a consumer link, limited to a
+// rate in KB/s and delayed by a latency in milliseconds once sent at the rate,
+// with a jitter. Added to the stream "both", it shapes both directions.
+type AsymmetricToxic struct {
+	DownRate    int64 `json:"down_rate"`
+	UpRate      int64 `json:"up_rate"`
+	DownLatency int64 `json:"down_latency"`
+	UpLatency   int64 `json:"up_latency"`
+	Jitter      int64 `json:"jitter"`
+}
+
+func (AsymmetricToxic) ToxicType() string { return "asymmetric" }
+
+// SlowCloseToxic delays the TCP socket from closing until delay milliseconds
+// have elapsed.
+type SlowCloseToxic struct {
+	Delay int64 `json:"delay"`
+}
+
+func (SlowCloseToxic) ToxicType() string { return "slow_close" }
+
+// TimeoutToxic stops all data from getting through, and closes the connection
+// after timeout milliseconds. A timeout of 0 keeps the connection open. Close
+// is "fin" if empty, or "rst" to reset the connection.
+type TimeoutToxic struct {
+	Timeout int64  `json:"timeout"`
+	Close   string `json:"close"`
+}
+
+func (TimeoutToxic) ToxicType() string { return "timeout" }
+
+// ResetPeerToxic resets the connection after timeout milliseconds. Close is
+// "rst" if empty, or "fin" to close it gracefully instead.
+type ResetPeerToxic struct {
+	Timeout int64  `json:"timeout"`
+	Close   string `json:"close"`
+}
+
+func (ResetPeerToxic) ToxicType() string { return "reset_peer" }
+
+// RandomResetToxic resets the connection after a number of bytes drawn from
+// MinBytes to MaxBytes, or a time in milliseconds drawn from MinTime to
+// MaxTime, whichever comes first. The ranges with a max of 0 are not drawn.
+// Close is "rst" if empty, or "fin" to close it gracefully instead.
+type RandomResetToxic struct {
+	MinBytes int64  `json:"min_bytes"`
+	MaxBytes int64  `json:"max_bytes"`
+	MinTime  int64  `json:"min_time"`
+	MaxTime  int64  `json:"max_time"`
+	Close    string `json:"close"`
+}
+
+func (RandomResetToxic) ToxicType() string { return "random_reset" }
+
+// ChurnToxic closes each connection after a lifetime in milliseconds drawn
+// from MinLifetime to MaxLifetime, and resets the connections opened for
+// Holdoff milliseconds after each close. Close is "fin" if empty, or "rst".
+type ChurnToxic struct {
+	MinLifetime int64  `json:"min_lifetime"`
+	MaxLifetime int64  `json:"max_lifetime"`
+	Holdoff     int64  `json:"holdoff"`
+	Close       string `json:"close"`
+}
+
+func (ChurnToxic) ToxicType() string { return "churn" }
+
+// SlicerToxic slices data into packets of an average size in bytes, varying
+// in size by up to size variation, with a delay in microseconds between them.
+// With a framing of "delimiter" (a newline if empty) or "length" (a big-endian
+// prefix of length size bytes, 4 if 0), each message is sliced separately.
+type SlicerToxic struct {
+	AverageSize   int    `json:"average_size"`
+	SizeVariation int    `json:"size_variation"`
+	Delay         int    `json:"delay"`
+	Framing       string `json:"framing,omitempty"`
+	Delimiter     string `json:"delimiter,omitempty"`
+	LengthSize    int    `json:"length_size,omitempty"`
+}
+
+func (SlicerToxic) ToxicType() string { return "slicer" }
+
+// SlowOpenToxic delays the first chunk of data of each connection, in the
+// stream of the toxic, by delay milliseconds.
+type SlowOpenToxic struct {
+	Delay int64 `json:"delay"`
+}
+
+func (SlowOpenToxic) ToxicType() string { return "slow_open" }
+
+// LimitDataToxic closes the connection once bytes have been transmitted. Close
+// is "fin" if empty, or "rst" to reset the connection. With Pause, the
+// connection is held open at the limit until ResumeToxic lets another bytes
+// through.
+type LimitDataToxic struct {
+	Bytes int64  `json:"bytes"`
+	Close string `json:"close"`
+	Pause bool   `json:"pause"`
+}
+
+func (LimitDataToxic) ToxicType() string { return "limit_data" }
+
+// StallToxic freezes the connection for duration milliseconds every interval
+// milliseconds, without closing it. The data waits for the end of the stall.
+type StallToxic struct {
+	Duration int64 `json:"duration"`
+	Interval int64 `json:"interval"`
+}
+
+func (StallToxic) ToxicType() string { return "stall" }
+
+// TarpitToxic trickles the data through, bytes (1 if 0) every interval
+// milliseconds, after the first grace bytes of the connection.
+type TarpitToxic struct {
+	Bytes    int64 `json:"bytes"`
+	Interval int64 `json:"interval"`
+	Grace    int64 `json:"grace"`
+}
+
+func (TarpitToxic) ToxicType() string { return "tarpit" }
+
+// BlackholeToxic drops all data without closing the connection during random
+// windows of around duration milliseconds, starting around every interval
+// milliseconds.
+type BlackholeToxic struct {
+	Duration int64 `json:"duration"`
+	Interval int64 `json:"interval"`
+}
+
+func (BlackholeToxic) ToxicType() string { return "blackhole" }
+
+// TriggerToxic watches the data for the regular expression of its pattern, and
+// applies its action once it matches: "reset" (if empty) or "close" the
+// connection, "delay" the chunk matching by delay milliseconds, "drop" the data
+// from the match on, or "inject" data after the match.
+type TriggerToxic struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+	Delay   int64  `json:"delay"`
+	Data    string `json:"data"`
+}
+
+func (TriggerToxic) ToxicType() string { return "trigger" }
+
+// PostgresToxic follows the messages of a PostgreSQL server, downstream, to
+// delay each query response by delay milliseconds, replace it with an error of
+// the SQLSTATE code (XX000 if empty), or kill the connection between queries.
+type PostgresToxic struct {
+	Delay    int64  `json:"delay"`
+	Error    string `json:"error"`
+	SQLState string `json:"sqlstate"`
+	Kill     bool   `json:"kill"`
+	Close    string `json:"close"`
+}
+
+func (PostgresToxic) ToxicType() string { return "postgres" }
+
+// MySQLToxic follows the packets of a MySQL server, downstream, to delay each
+// query response by delay milliseconds, replace it with an error of the error
+// code (1105 if 0), or kill the connection between queries.
+type MySQLToxic struct {
+	Delay     int64  `json:"delay"`
+	Error     string `json:"error"`
+	ErrorCode int    `json:"error_code"`
+	Kill      bool   `json:"kill"`
+	Close     string `json:"close"`
+}
+
+func (MySQLToxic) ToxicType() string { return "mysql" }
+
+// KafkaToxic follows the requests of Kafka clients to delay by delay
+// milliseconds, drop, or kill the connection on the ones of the API keys (all
+// if empty), e.g. 0 for Produce. Added to both streams, it rewrites the
+// addresses of the brokers in Metadata responses to the one of brokers by
+// their host:port, or else to advertise.
+type KafkaToxic struct {
+	APIKeys   []int16           `json:"api_keys,omitempty"`
+	Delay     int64             `json:"delay"`
+	Drop      bool              `json:"drop"`
+	Kill      bool              `json:"kill"`
+	Close     string            `json:"close"`
+	Advertise string            `json:"advertise"`
+	Brokers   map[string]string `json:"brokers,omitempty"`
+}
+
+func (KafkaToxic) ToxicType() string { return "kafka" }
+
+// AMQPToxic drops, or delays by delay milliseconds, the frames of AMQP 0-9-1:
+// "heartbeat", or the methods by name, e.g. "basic.deliver", or by ids, e.g.
+// "60.80". The content of a method dropped is dropped with it.
+type AMQPToxic struct {
+	Frames []string `json:"frames,omitempty"`
+	Drop   bool     `json:"drop"`
+	Delay  int64    `json:"delay"`
+}
+
+func (AMQPToxic) ToxicType() string { return "amqp" }
+
+// MQTTToxic drops, delays by delay milliseconds, or replaces with a DISCONNECT
+// closing the connection, the MQTT control packets of the types named, e.g.
+// "puback" (all if empty).
+type MQTTToxic struct {
+	Packets    []string `json:"packets,omitempty"`
+	Drop       bool     `json:"drop"`
+	Delay      int64    `json:"delay"`
+	Disconnect bool     `json:"disconnect"`
+}
+
+func (MQTTToxic) ToxicType() string { return "mqtt" }
+
+// ReplyToxic delays by delay milliseconds, or replaces with replace (expanded
+// with $1 for the first group), the replies of a line protocol such as SMTP or
+// IMAP matching the regular expression of its pattern. Only a fraction of them
+// are affected with a probability, all of them if 0.
+type ReplyToxic struct {
+	Pattern     string  `json:"pattern"`
+	Replace     string  `json:"replace"`
+	Delay       int64   `json:"delay"`
+	Probability float32 `json:"probability"`
+}
+
+func (ReplyToxic) ToxicType() string { return "reply" }
+
+// DNSToxic delays by delay milliseconds the DNS responses, or answers with an
+// rcode ("servfail", "nxdomain" or "refused"), truncates them, serves the
+// first answer to each question if stale, or replaces the addresses of their
+// A or AAAA records with address. Only a fraction of them are affected with a
+// probability, all of them if 0.
+type DNSToxic struct {
+	Delay       int64   `json:"delay"`
+	Rcode       string  `json:"rcode"`
+	Truncate    bool    `json:"truncate"`
+	Stale       bool    `json:"stale"`
+	Address     string  `json:"address"`
+	Probability float32 `json:"probability"`
+}
+
+func (DNSToxic) ToxicType() string { return "dns" }
+
+// TLSToxic delays by delay milliseconds each handshake record of a TLS server,
+// or aborts the handshake with a fatal alert, e.g. "certificate_expired", sent
+// after a number of handshake records.
+type TLSToxic struct {
+	Delay int64  `json:"delay"`
+	Alert string `json:"alert"`
+	After int    `json:"after"`
+}
+
+func (TLSToxic) ToxicType() string { return "tls" }
+
+// HTTP2Toxic acts on the frames of cleartext HTTP/2: after a number of new
+// streams left alone, it sends a GOAWAY before the next one, or resets a
+// fraction of them with a probability (all of them if 0) once their headers
+// are sent, with error_code. It also drops the WINDOW_UPDATE frames with
+// starve, or delays the SETTINGS acknowledgements by settings_ack_delay
+// milliseconds.
+type HTTP2Toxic struct {
+	After            int     `json:"after"`
+	Goaway           bool    `json:"goaway"`
+	Reset            bool    `json:"reset"`
+	Probability      float32 `json:"probability"`
+	ErrorCode        string  `json:"error_code"`
+	Starve           bool    `json:"starve"`
+	SettingsAckDelay int64   `json:"settings_ack_delay"`
+}
+
+func (HTTP2Toxic) ToxicType() string { return "http2" }
+
+// WebSocketToxic drops the WebSocket frames of the types in drop, e.g. "ping"
+// and "pong", and delays by delay milliseconds, corrupts, or replaces with a
+// close frame of close_code and close_reason, the messages. Only a fraction of
+// the messages are affected with a probability, all of them if 0.
+type WebSocketToxic struct {
+	Drop        []string `json:"drop"`
+	Delay       int64    `json:"delay"`
+	Corrupt     bool     `json:"corrupt"`
+	CloseCode   int      `json:"close_code"`
+	CloseReason string   `json:"close_reason"`
+	Probability float32  `json:"probability"`
+}
+
+func (WebSocketToxic) ToxicType() string { return "websocket" }
+
+// ProfileToxic delays the data like real measurements: by a latency drawn
+// for each chunk from a cumulative histogram, e.g. the delays of the stats of
+// another toxic, or following a series of latencies in milliseconds that
+// loops with step milliseconds between two values (1000 if 0).
+type ProfileToxic struct {
+	Histogram []DelayBucket `json:"histogram,omitempty"`
+	Series    []float64     `json:"series,omitempty"`
+	Step      int64         `json:"step,omitempty"`
+}
+
+func (ProfileToxic) ToxicType() string { return "profile" }
+
+// GzipToxic compresses the stream with gzip with a mode of "compress" (the
+// default), or decompresses a gzip stream ("decompress") or compresses it
+// again at level ("recompress"), from 1 to 9 (the default level of gzip if 0
+// when compressing, and 1 when recompressing).
+type GzipToxic struct {
+	Mode  string `json:"mode,omitempty"`
+	Level int    `json:"level,omitempty"`
+}
+
+func (GzipToxic) ToxicType() string { return "gzip" }
+
+// ToAttributes converts typed attributes to the map sent to the server.
+func ToAttributes(attrs TypedAttributes) (Attributes, error) {
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Attributes{}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AttributesAs returns the attributes of a toxic as typed attributes, e.g.
+// AttributesAs[LatencyToxic](toxic). It fails if the toxic is of another type.
+func AttributesAs[T TypedAttributes](toxic *Toxic) (T, error) {
+	var attrs T
+	if toxic.Type != attrs.ToxicType() {
+		return attrs, fmt.Errorf("toxic %s is of type %s, not %s",
+			toxic.Name, toxic.Type, attrs.ToxicType())
+	}
+
+	data, err := json.Marshal(toxic.Attributes)
+	if err != nil {
+		return attrs, err
+	}
+	err = json.Unmarshal(data, &attrs)
+	return attrs, err
+}
+
+// AddTypedToxic is like AddToxic, with the type of the toxic given by its
+// attributes.
+func (proxy *Proxy) AddTypedToxic(
+	name, stream string,
+	toxicity float32,
+	attrs TypedAttributes,
+) (*Toxic, error) {
+	return proxy.AddTypedToxicContext(context.Background(), name, stream, toxicity, attrs)
+}
+
+// AddTypedToxicContext is like AddTypedToxic but takes a context.
+func (proxy *Proxy) AddTypedToxicContext(
+	ctx context.Context,
+	name, stream string,
+	toxicity float32,
+	attrs TypedAttributes,
+) (*Toxic, error) {
+	attributes, err := ToAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.AddToxicContext(ctx, name, attrs.ToxicType(), stream, toxicity, attributes)
+}
+
+// UpdateTypedToxic is like UpdateToxic, but sets all the attributes of the
+// toxic, including the ones left to their zero value.
+func (proxy *Proxy) UpdateTypedToxic(
+	name string,
+	toxicity float32,
+	attrs TypedAttributes,
+) (*Toxic, error) {
+	return proxy.UpdateTypedToxicContext(context.Background(), name, toxicity, attrs)
+}
+
+// UpdateTypedToxicContext is like UpdateTypedToxic but takes a context.
+func (proxy *Proxy) UpdateTypedToxicContext(
+	ctx context.Context,
+	name string,
+	toxicity float32,
+	attrs TypedAttributes,
+) (*Toxic, error) {
+	attributes, err := ToAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.UpdateToxicContext(ctx, name, toxicity, attributes)
+}
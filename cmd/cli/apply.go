@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// stateProxy is a proxy in a state file. The format is the one of the JSON
+// config of the server, with the toxics of each proxy, and can be YAML.
+type stateProxy struct {
+	Name     string       `json:"name" yaml:"name"`
+	Listen   string       `json:"listen" yaml:"listen"`
+	Upstream string       `json:"upstream" yaml:"upstream"`
+	Enabled  *bool        `json:"enabled" yaml:"enabled"`
+	Toxics   []stateToxic `json:"toxics,omitempty" yaml:"toxics,omitempty"`
+}
+
+type stateToxic struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Type       string                 `json:"type" yaml:"type"`
+	Stream     string                 `json:"stream" yaml:"stream"`
+	Toxicity   *float32               `json:"toxicity" yaml:"toxicity"`
+	Attributes map[string]interface{} `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// stateChange is a difference between the server and the state file, with
+// the request that resolves it.
+type stateChange struct {
+	symbol      string
+	description string
+	apply       func(proxies map[string]*toxiproxy.Proxy) error
+}
+
+func cliApplyCommand() *cli.Command {
+	return &cli.Command{
+		Name: "apply",
+		Usage: "\tmake the proxies and toxics match a state file\n" +
+			"\t\tusage: 'toxiproxy-cli apply -f state.yaml'\n",
+		Flags:  []cli.Flag{stateFileFlag()},
+		Action: withToxi(applyState),
+	}
+}
+
+func cliDiffCommand() *cli.Command {
+	return &cli.Command{
+		Name: "diff",
+		Usage: "\tshow what apply would change, exits with 1 if anything\n" +
+			"\t\tusage: 'toxiproxy-cli diff -f state.yaml'\n",
+		Flags:  []cli.Flag{stateFileFlag()},
+		Action: withToxi(diffState),
+	}
+}
+
+func stateFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "filename",
+		Aliases: []string{"f"},
+		Usage:   "YAML or JSON file with the list of proxies and their toxics",
+	}
+}
+
+func diffState(c *cli.Context, t *toxiproxy.Client) error {
+	changes, _, err := planState(c, t)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, change := range changes {
+		printChange(change)
+	}
+	return cli.Exit("", 1)
+}
+
+func applyState(c *cli.Context, t *toxiproxy.Client) error {
+	changes, proxies, err := planState(c, t)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, change := range changes {
+		err := change.apply(proxies)
+		if err != nil {
+			return errorf("Failed to apply %s: %s\n", change.description, err)
+		}
+		printChange(change)
+	}
+	return nil
+}
+
+func printChange(change stateChange) {
+	col := map[string]string{"+": GREEN, "~": YELLOW, "-": RED}[change.symbol]
+	fmt.Printf("%s%s %s%s\n", color(col), change.symbol, change.description, color(NONE))
+}
+
+func planState(
+	c *cli.Context,
+	t *toxiproxy.Client,
+) ([]stateChange, map[string]*toxiproxy.Proxy, error) {
+	filename, err := getArgOrFail(c, "filename")
+	if err != nil {
+		return nil, nil, err
+	}
+	desired, err := readState(filename)
+	if err != nil {
+		return nil, nil, errorf("Failed to read %s: %s\n", filename, err)
+	}
+
+	proxies, err := t.Proxies()
+	if err != nil {
+		return nil, nil, errorf("Failed to retrieve proxies: %s\n", err)
+	}
+
+	return diffProxies(t, desired, proxies), proxies, nil
+}
+
+func readState(filename string) ([]stateProxy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxies []stateProxy
+	err = yaml.Unmarshal(data, &proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range proxies {
+		proxy := &proxies[i]
+		if proxy.Name == "" || proxy.Upstream == "" {
+			return nil, fmt.Errorf("proxy %d must have a name and an upstream", i+1)
+		}
+		if names[proxy.Name] {
+			return nil, fmt.Errorf("proxy %s is defined twice", proxy.Name)
+		}
+		names[proxy.Name] = true
+		if proxy.Enabled == nil {
+			enabled := true
+			proxy.Enabled = &enabled
+		}
+
+		for j := range proxy.Toxics {
+			toxic := &proxy.Toxics[j]
+			if toxic.Type == "" {
+				return nil, fmt.Errorf("toxic %d of proxy %s must have a type", j+1, proxy.Name)
+			}
+			if toxic.Stream == "" {
+				toxic.Stream = "downstream"
+			}
+			if toxic.Name == "" {
+				toxic.Name = toxic.Type + "_" + toxic.Stream
+			}
+			if toxic.Toxicity == nil {
+				toxicity := float32(1)
+				toxic.Toxicity = &toxicity
+			}
+		}
+	}
+	return proxies, nil
+}
+
+// diffProxies lists the changes that make the server match the desired
+// proxies: deleting the ones that are not in the file first, then creating
+// or updating the others and their toxics.
+func diffProxies(
+	t *toxiproxy.Client,
+	desired []stateProxy,
+	current map[string]*toxiproxy.Proxy,
+) []stateChange {
+	var changes []stateChange
+
+	wanted := map[string]bool{}
+	for _, proxy := range desired {
+		wanted[proxy.Name] = true
+	}
+	for _, name := range sortedProxyNames(current) {
+		if wanted[name] {
+			continue
+		}
+		name := name
+		changes = append(changes, stateChange{"-", "proxy " + name,
+			func(proxies map[string]*toxiproxy.Proxy) error {
+				return proxies[name].Delete()
+			},
+		})
+	}
+
+	for _, proxy := range desired {
+		changes = append(changes, diffProxy(t, proxy, current[proxy.Name])...)
+	}
+	return changes
+}
+
+func diffProxy(t *toxiproxy.Client, desired stateProxy, current *toxiproxy.Proxy) []stateChange {
+	name := desired.Name
+	save := func(proxies map[string]*toxiproxy.Proxy) error {
+		proxy, ok := proxies[name]
+		if !ok {
+			proxy = t.NewProxy()
+			proxy.Name = name
+			proxies[name] = proxy
+		}
+		proxy.Listen = desired.Listen
+		proxy.Upstream = desired.Upstream
+		proxy.Enabled = *desired.Enabled
+		return proxy.Save()
+	}
+
+	if current == nil {
+		changes := []stateChange{{"+", fmt.Sprintf("proxy %s (listen %s, upstream %s, %s)",
+			name, desired.Listen, desired.Upstream, enabledText(*desired.Enabled)), save}}
+		return append(changes, diffToxics(name, desired.Toxics, nil)...)
+	}
+
+	var details []string
+	if desired.Listen != "" && !sameAddress(desired.Listen, current.Listen) {
+		details = append(details, fmt.Sprintf("listen %s -> %s", current.Listen, desired.Listen))
+	}
+	if desired.Upstream != current.Upstream {
+		details = append(details,
+			fmt.Sprintf("upstream %s -> %s", current.Upstream, desired.Upstream))
+	}
+	if *desired.Enabled != current.Enabled {
+		details = append(details, enabledText(*desired.Enabled))
+	}
+
+	var changes []stateChange
+	if len(details) > 0 {
+		if desired.Listen == "" {
+			desired.Listen = current.Listen
+		}
+		changes = append(changes, stateChange{"~",
+			fmt.Sprintf("proxy %s: %s", name, strings.Join(details, ", ")), save})
+	}
+	return append(changes, diffToxics(name, desired.Toxics, current.ActiveToxics)...)
+}
+
+func diffToxics(proxyName string, desired []stateToxic, current toxiproxy.Toxics) []stateChange {
+	var changes []stateChange
+
+	existing := map[string]toxiproxy.Toxic{}
+	for _, toxic := range current {
+		existing[toxic.Name] = toxic
+	}
+	wanted := map[string]bool{}
+	for _, toxic := range desired {
+		wanted[toxic.Name] = true
+	}
+
+	remove := func(name string) stateChange {
+		return stateChange{"-", fmt.Sprintf("toxic %s on %s", name, proxyName),
+			func(proxies map[string]*toxiproxy.Proxy) error {
+				return proxies[proxyName].RemoveToxic(name)
+			},
+		}
+	}
+	add := func(toxic stateToxic) stateChange {
+		return stateChange{"+", fmt.Sprintf("toxic %s on %s (%s)",
+			toxic.Name, proxyName, describeStateToxic(toxic)),
+			func(proxies map[string]*toxiproxy.Proxy) error {
+				_, err := proxies[proxyName].AddToxic(toxic.Name, toxic.Type, toxic.Stream,
+					*toxic.Toxicity, toxic.Attributes)
+				return err
+			},
+		}
+	}
+
+	for _, toxic := range current {
+		if !wanted[toxic.Name] {
+			changes = append(changes, remove(toxic.Name))
+		}
+	}
+
+	for _, toxic := range desired {
+		old, ok := existing[toxic.Name]
+		switch {
+		case !ok:
+			changes = append(changes, add(toxic))
+		case old.Type != toxic.Type || old.Stream != toxic.Stream:
+			// Neither can be updated, the toxic has to be added again.
+			changes = append(changes, remove(toxic.Name), add(toxic))
+		default:
+			if change, ok := diffToxic(proxyName, toxic, old); ok {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// diffToxic compares the toxicity and the attributes set in the file, the
+// attributes left out keep their current value.
+func diffToxic(proxyName string, desired stateToxic, current toxiproxy.Toxic) (stateChange, bool) {
+	var details []string
+	if *desired.Toxicity != current.Toxicity {
+		details = append(details,
+			fmt.Sprintf("toxicity %.2f -> %.2f", current.Toxicity, *desired.Toxicity))
+	}
+	for _, a := range sortedAttributes(desired.Attributes) {
+		if fmt.Sprint(toFloat(a.value)) != fmt.Sprint(toFloat(current.Attributes[a.key])) {
+			details = append(details,
+				fmt.Sprintf("%s %v -> %v", a.key, current.Attributes[a.key], a.value))
+		}
+	}
+	if len(details) == 0 {
+		return stateChange{}, false
+	}
+
+	return stateChange{"~",
+		fmt.Sprintf("toxic %s on %s: %s", desired.Name, proxyName, strings.Join(details, ", ")),
+		func(proxies map[string]*toxiproxy.Proxy) error {
+			_, err := proxies[proxyName].UpdateToxic(
+				desired.Name, *desired.Toxicity, desired.Attributes)
+			return err
+		},
+	}, true
+}
+
+func describeStateToxic(toxic stateToxic) string {
+	return describeToxic(toxiproxy.Toxic{
+		Name:       toxic.Name,
+		Type:       toxic.Type,
+		Stream:     toxic.Stream,
+		Toxicity:   *toxic.Toxicity,
+		Attributes: toxic.Attributes,
+	})
+}
+
+// toFloat converts the integers decoded from YAML to the floats decoded from
+// the JSON of the API, so that the same value compares equal.
+func toFloat(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value
+}
+
+// sameAddress compares a listen address from the file with the one of the
+// server, which is resolved.
+func sameAddress(desired, current string) bool {
+	resolved, err := net.ResolveTCPAddr("tcp", desired)
+	if err != nil {
+		return desired == current
+	}
+	return resolved.String() == current || desired == current
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliChaosCommand() *cli.Command {
+	return &cli.Command{
+		Name: "chaos",
+		Usage: "\tstart, stop or show random faults added to the proxies\n" +
+			"\t\tusage: 'toxiproxy-cli chaos start <configFile>'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "start",
+				Usage:     "start adding random toxics of a YAML or JSON config",
+				ArgsUsage: "<configFile>",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "seed",
+						Usage: "seed of the faults, to replay them (default the one of the config)",
+					},
+				},
+				Action: withToxi(startChaos),
+			},
+			{
+				Name:   "stop",
+				Usage:  "stop adding faults, and remove the last ones",
+				Action: withToxi(stopChaos),
+			},
+			{
+				Name:    "status",
+				Aliases: []string{"s"},
+				Usage:   "show the config and the current faults",
+				Flags:   []cli.Flag{outputFlag()},
+				Action:  withToxi(showChaos),
+			},
+		},
+	}
+}
+
+func startChaos(c *cli.Context, t *toxiproxy.Client) error {
+	filename := c.Args().First()
+	if filename == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("A config file is required.\n")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", filename, err)
+	}
+	var config toxiproxy.ChaosConfig
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", filename, err)
+	}
+	if c.IsSet("seed") {
+		config.Seed = c.Int64("seed")
+	}
+
+	status, err := t.StartChaos(config)
+	if err != nil {
+		return errorf("Failed to start chaos: %s\n", err)
+	}
+	fmt.Printf("Started chaos with seed %d\n", status.Config.Seed)
+	return nil
+}
+
+func stopChaos(c *cli.Context, t *toxiproxy.Client) error {
+	err := t.StopChaos()
+	if err != nil {
+		return errorf("Failed to stop chaos: %s\n", err)
+	}
+	fmt.Println("Stopped chaos")
+	return nil
+}
+
+func showChaos(c *cli.Context, t *toxiproxy.Client) error {
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
+	status, err := t.Chaos()
+	if err != nil {
+		return errorf("Failed to retrieve chaos: %s\n", err)
+	}
+
+	if ok, err := printStructured(output, status); ok {
+		return err
+	}
+
+	if status.Aborted != "" {
+		fmt.Printf("Chaos was aborted after round %d, %s\n", status.Rounds, status.Aborted)
+		return nil
+	}
+	if !status.Running {
+		fmt.Println("Chaos is stopped")
+		return nil
+	}
+	fmt.Printf("Chaos is running with seed %d, round %d, intensity %.2f every %dms\n",
+		status.Config.Seed, status.Rounds, status.Config.Intensity, status.Config.Interval)
+	for _, fault := range status.Faults {
+		fmt.Printf("\t%s%s%s\t%s\n", color(BLUE), fault.Proxy, color(NONE), fault.Toxic)
+	}
+	return nil
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	terminal "golang.org/x/term"
@@ -40,9 +42,15 @@ var toxicDescription = `
   bandwidth:  limit to max kb/s
               rate=<KB/s>
 
+  asymmetric: shape both directions like a consumer link, with --upstream --downstream
+              down_rate=<KB/s>,up_rate=<KB/s>,down_latency=<ms>,up_latency=<ms>,jitter=<ms>
+
   slow_close: delay from closing
               delay=<ms>
 
+  slow_open:  delay the first chunk of data only
+              delay=<ms>
+
   timeout:    stop all data and close after timeout
               timeout=<ms>
 
@@ -50,27 +58,103 @@ var toxicDescription = `
               the stub Input immediately or after a timeout
               timeout=<ms>
 
+  random_reset: reset the connection after a number of bytes or a time drawn in ranges
+              min_bytes=<bytes>,max_bytes=<bytes>,min_time=<ms>,max_time=<ms>
+
+  churn:      close the connections after a random lifetime, reject reconnects for a holdoff
+              min_lifetime=<ms>,max_lifetime=<ms>,holdoff=<ms>
+
   slicer:     slice data into bits with optional delay
               average_size=<bytes>,size_variation=<bytes>,delay=<microseconds>
 
+  stall:      freeze the connection for a duration every interval
+              duration=<ms>,interval=<ms>
+
+  tarpit:     trickle the data a few bytes per interval after a grace volume
+              bytes=<bytes>,interval=<ms>,grace=<bytes>
+
+  blackhole:  drop all data during random windows, without closing
+              duration=<ms>,interval=<ms>
+
+  trigger:    reset, close, delay, drop or inject data once the data matches a pattern
+              pattern=<regexp>,action=<action>,delay=<ms>,data=<string>
+
+  postgres:   delay or fail the query responses of a PostgreSQL server, or kill between queries
+              delay=<ms>,error=<message>,sqlstate=<code>,kill=<bool>,close=<fin|rst>
+
+  mysql:      delay or fail the query responses of a MySQL server, or kill between queries
+              delay=<ms>,error=<message>,error_code=<code>,kill=<bool>,close=<fin|rst>
+
+  kafka:      delay, drop or kill on the requests of an API key, rewrite broker addresses
+              api_keys=<key>,delay=<ms>,drop=<bool>,kill=<bool>,advertise=<host:port>
+
+  amqp:       drop or delay the heartbeats or the methods of AMQP 0-9-1 named
+              frames=<frame>,drop=<bool>,delay=<ms>
+
+  mqtt:       drop, delay or disconnect on the MQTT packets of a type
+              packets=<type>,drop=<bool>,delay=<ms>,disconnect=<bool>
+
+  reply:      delay or replace the replies of a line protocol (SMTP, IMAP) matching a pattern
+              pattern=<regexp>,replace=<reply>,delay=<ms>,probability=<0-1>
+
+  dns:        delay, fail, truncate, serve stale or rewrite the responses of a DNS server
+              delay=<ms>,rcode=<servfail|nxdomain|refused>,truncate=<bool>,stale=<bool>,
+              address=<ip>,probability=<0-1>
+
+  tls:        slow down the handshake of a TLS server, or abort it with a fatal alert
+              delay=<ms>,alert=<name>,after=<records>
+
+  http2:      send a GOAWAY, reset streams, starve windows or delay SETTINGS acks of h2c
+              after=<streams>,goaway=<bool>,reset=<bool>,probability=<0-1>,
+              error_code=<name>,starve=<bool>,settings_ack_delay=<ms>
+
+  websocket:  drop the frames of a type, delay, corrupt or close on the WebSocket messages
+              drop=<ping|pong|text|binary|close>,delay=<ms>,corrupt=<bool>,
+              close_code=<code>,close_reason=<reason>,probability=<0-1>
+
+  profile:    replay the latencies of a histogram or a time series of real measurements
+              --profile <file.csv|file.json>, step=<ms>
+
+  gzip:       compress the stream, or decompress or recompress a gzip stream
+              mode=<compress|decompress|recompress>,level=<1-9>
+
+  Any numeric attribute follows sine, square or custom CSV waveforms with --modulation <file>.
+
+  toxic list:
+    usage: toxiproxy-cli toxic list [--output json|yaml|wide] <proxyName>
+
+    example: toxiproxy-cli toxic list -o json myProxy
+
   toxic add:
     usage: toxiproxy-cli toxic add --type <toxicType> [--downstream|--upstream] \
-            --toxicName <toxicName> [--toxicity <float>] \
-            --attribute <key=value> [--attribute <key2=value2>] <proxyName>
+            --toxicName <toxicName> [--toxicity <float>] [--seed <int>] [--sticky] \
+            [--first-connections <int>] [--every-connection <int>] \
+            [--match-client-cidr <cidr>] [--match-client-ports <ports>] \
+            [--match-upstream <address>] \
+            --attribute <key=value> [--attribute <key2=value2>] [--profile <file>] \
+            [--modulation <file>] <proxyName>
 
 
     example: toxiproxy-cli toxic add -t latency -n myToxic -a latency=100 -a jitter=50 myProxy
+    example: toxiproxy-cli toxic add -t profile --profile latencies.csv myProxy
 
   toxic update:
     usage: toxiproxy-cli toxic update --toxicName <toxicName> [--toxicity <float>] \
-            --attribute <key1=value1> [--attribute <key2=value2>] <proxyName>
+            --attribute <key1=value1> [--attribute <key2=value2>] [--profile <file>] \
+            [--modulation <file|none>] <proxyName>
 
     example: toxiproxy-cli toxic update -n myToxic -a jitter=25 myProxy
+    example: toxiproxy-cli toxic update -n myToxic --modulation peak-hours.yaml myProxy
 
   toxic delete:
     usage: toxiproxy-cli toxic delete --toxicName <toxicName> <proxyName>
 
     example: toxiproxy-cli toxic delete -n myToxic myProxy
+
+  toxic order:
+    usage: toxiproxy-cli toxic order <proxyName> <toxicName> [<toxicName>...]
+
+    example: toxiproxy-cli toxic order myProxy bandwidth_downstream latency_downstream
 `
 
 var (
@@ -93,11 +177,29 @@ func main() {
 			Name:        "host",
 			Aliases:     []string{"h"},
 			Value:       "http://localhost:8474",
-			Usage:       "toxiproxy host to connect to",
+			Usage:       "toxiproxy host to connect to, or unix:/path of its socket",
 			Destination: &hostname,
 			EnvVars:     []string{"TOXIPROXY_URL"},
 		},
+		&cli.StringFlag{
+			Name:    "namespace",
+			Usage:   "namespace of the proxies, instead of the proxies outside of namespaces",
+			EnvVars: []string{"TOXIPROXY_NAMESPACE"},
+		},
+		&cli.StringFlag{
+			Name:    "context",
+			Usage:   "server of the config file to connect to, instead of its current-context",
+			EnvVars: []string{"TOXIPROXY_CONTEXT"},
+		},
+		&cli.StringFlag{
+			Name:    "config",
+			Value:   defaultConfigPath(),
+			Usage:   "config file with the contexts",
+			EnvVars: []string{"TOXIPROXY_CONFIG"},
+		},
 	}
+	app.Before = selectContext
+	app.EnableBashCompletion = true
 
 	isTTY = terminal.IsTerminal(int(os.Stdout.Fd()))
 
@@ -110,13 +212,16 @@ func cliCommands() []*cli.Command {
 			Name:    "list",
 			Usage:   "list all proxies\n\tusage: 'toxiproxy-cli list'\n",
 			Aliases: []string{"l", "li", "ls"},
+			Flags:   []cli.Flag{outputFlag()},
 			Action:  withToxi(list),
 		},
 		{
-			Name:    "inspect",
-			Aliases: []string{"i", "ins"},
-			Usage:   "inspect a single proxy\n\tusage: 'toxiproxy-cli inspect <proxyName>'\n",
-			Action:  withToxi(inspectProxy),
+			Name:         "inspect",
+			Aliases:      []string{"i", "ins"},
+			Usage:        "inspect a single proxy\n\tusage: 'toxiproxy-cli inspect <proxyName>'\n",
+			Flags:        []cli.Flag{outputFlag()},
+			Action:       withToxi(inspectProxy),
+			BashComplete: completeWith(nil, completeProxies),
 		},
 		{
 			Name: "create",
@@ -134,6 +239,131 @@ func cliCommands() []*cli.Command {
 					Aliases: []string{"u"},
 					Usage:   "proxy will forward to this address",
 				},
+				&cli.StringFlag{
+					Name:  "protocol",
+					Usage: "tcp, udp, forward (SOCKS5 and HTTP CONNECT) or transparent: protocol of the proxy",
+				},
+				&cli.IntFlag{
+					Name:  "read-buffer-size",
+					Usage: "largest number of bytes read from a connection at once (default 32KB)",
+				},
+				&cli.IntFlag{
+					Name:  "channel-depth",
+					Usage: "number of chunks buffered before each toxic (default of the toxic)",
+				},
+				&cli.StringFlag{
+					Name: "backpressure",
+					Usage: "block, buffer or drop: what happens to the data read while the toxics " +
+						"are slower (default block)",
+				},
+				&cli.IntFlag{
+					Name:  "backpressure-bytes",
+					Usage: "bytes of each direction held by the buffer and drop backpressures (default 1MB)",
+				},
+				&cli.IntFlag{
+					Name:  "max-connections",
+					Usage: "largest number of clients connected at once (default no limit)",
+				},
+				&cli.StringFlag{
+					Name:  "on-limit",
+					Usage: "close, reset or wait: what happens to clients over the limit",
+				},
+				&cli.IntFlag{
+					Name:  "limit-timeout",
+					Usage: "milliseconds after which the clients waiting over the limit are closed",
+				},
+				&cli.Float64Flag{
+					Name:  "hang-probability",
+					Usage: "fraction of the clients held without an upstream, from 0 to 1",
+				},
+				&cli.IntFlag{
+					Name:  "hang-timeout",
+					Usage: "milliseconds after which hung clients are closed (default never)",
+				},
+				&cli.IntFlag{
+					Name:  "dial-timeout",
+					Usage: "longest time in milliseconds to connect to the upstream (default the system's)",
+				},
+				&cli.IntFlag{
+					Name:  "dial-retries",
+					Usage: "number of times a connection to the upstream is retried",
+				},
+				&cli.IntFlag{
+					Name:  "dial-backoff",
+					Usage: "milliseconds to wait before the first retry, doubled before each next",
+				},
+				&cli.StringFlag{
+					Name:  "upstream-proxy",
+					Usage: "socks5:// or http:// URL of a proxy the upstream is connected through",
+				},
+				&cli.StringFlag{
+					Name:  "upstream-bind",
+					Usage: "local IP, or IP and port, the upstream is connected from",
+				},
+				&cli.StringFlag{
+					Name:  "upstream-interface",
+					Usage: "network interface the upstream is connected through (Linux only)",
+				},
+				&cli.IntFlag{
+					Name:  "upstream-mark",
+					Usage: "SO_MARK of the sockets connected to the upstream (Linux only)",
+				},
+				&cli.StringFlag{
+					Name:  "prefer-family",
+					Usage: "ipv4 or ipv6: family of a dual-stack upstream dialed first",
+				},
+				&cli.BoolFlag{
+					Name:  "race-families",
+					Usage: "race the families of a dual-stack upstream, as Happy Eyeballs",
+				},
+				&cli.IntFlag{
+					Name:  "attempt-delay",
+					Usage: "milliseconds between the raced attempts, 250 if not set",
+				},
+				&cli.StringFlag{
+					Name:  "fail-family",
+					Usage: "ipv4 or ipv6: family whose connections are refused",
+				},
+				&cli.BoolFlag{
+					Name:  "blackhole",
+					Usage: "time out the connections of the failed family instead of refusing them",
+				},
+				&cli.StringSliceFlag{
+					Name:  "allow",
+					Usage: "CIDR or IP of the only clients accepted, may be repeated",
+				},
+				&cli.StringSliceFlag{
+					Name:  "deny",
+					Usage: "CIDR or IP of the clients rejected, may be repeated",
+				},
+				&cli.IntFlag{
+					Name:  "idle-timeout",
+					Usage: "milliseconds after which connections sending nothing are closed",
+				},
+				&cli.IntFlag{
+					Name:  "max-connection-age",
+					Usage: "milliseconds after which connections are closed",
+				},
+				&cli.StringFlag{
+					Name:  "health-check",
+					Usage: "tcp or http: check the upstream periodically",
+				},
+				&cli.StringFlag{
+					Name:  "health-path",
+					Usage: "path of the http health checks, / if not set",
+				},
+				&cli.StringFlag{
+					Name:  "on-down",
+					Usage: "disable or failover: what to do while the upstream is down",
+				},
+				&cli.StringFlag{
+					Name:  "failover",
+					Usage: "upstream the proxy fails over to while its upstream is down",
+				},
+				&cli.StringFlag{
+					Name:  "on-stop",
+					Usage: "fin or rst: how connections are closed when the proxy stops",
+				},
 			},
 			Action: withToxi(createProxy),
 		},
@@ -141,14 +371,40 @@ func cliCommands() []*cli.Command {
 			Name: "toggle",
 			Usage: "\ttoggle enabled status on a proxy\n" +
 				"\t\tusage: 'toxiproxy-cli toggle <proxyName>'\n",
-			Aliases: []string{"tog"},
-			Action:  withToxi(toggleProxy),
+			Aliases:      []string{"tog"},
+			Action:       withToxi(toggleProxy),
+			BashComplete: completeWith(nil, completeProxies),
+		},
+		{
+			Name: "rename",
+			Usage: "\trename a proxy, keeping its toxics and connections\n" +
+				"\t\tusage: 'toxiproxy-cli rename <proxyName> <newName>'\n",
+			Action:       withToxi(renameProxy),
+			BashComplete: completeWith(nil, completeProxies),
 		},
 		{
-			Name:    "delete",
-			Usage:   "\tdelete a proxy\n\t\tusage: 'toxiproxy-cli delete <proxyName>'\n",
-			Aliases: []string{"d"},
-			Action:  withToxi(deleteProxy),
+			Name: "move",
+			Usage: "\tpoint a proxy to another upstream, keeping its connections\n" +
+				"\t\tusage: 'toxiproxy-cli move <proxyName> <upstream>'\n",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "connections",
+					Usage: "keep, drain or reset: what becomes of the connections to the previous upstream",
+				},
+				&cli.IntFlag{
+					Name:  "drain-timeout",
+					Usage: "milliseconds the drained connections have to close before they are closed",
+				},
+			},
+			Action:       withToxi(moveProxy),
+			BashComplete: completeWith(nil, completeProxies),
+		},
+		{
+			Name:         "delete",
+			Usage:        "\tdelete a proxy\n\t\tusage: 'toxiproxy-cli delete <proxyName>'\n",
+			Aliases:      []string{"d"},
+			Action:       withToxi(deleteProxy),
+			BashComplete: completeWith(nil, completeProxies),
 		},
 		{
 			Name:        "toxic",
@@ -157,14 +413,43 @@ func cliCommands() []*cli.Command {
 			Description: toxicDescription,
 			Subcommands: cliToxiSubCommands(),
 		},
+		cliWatchCommand(),
+		cliWaitCommand(),
+		cliTopCommand(),
+		cliApplyCommand(),
+		cliDiffCommand(),
+		cliExportCommand(),
+		cliPresetCommand(),
+		cliChaosCommand(),
+		cliConnectionsCommand(),
+		cliDirectionCommand(),
+		cliScenarioCommand(),
+		cliLoadgenCommand(),
+		cliContextCommand(),
+		cliCompletionCommand(),
 	}
 }
 
 func cliToxiSubCommands() []*cli.Command {
 	return []*cli.Command{
+		cliToxiListSubCommand(),
 		cliToxiAddSubCommand(),
 		cliToxiUpdateSubCommand(),
 		cliToxiRemoveSubCommand(),
+		cliToxiResumeSubCommand(),
+		cliToxiOrderSubCommand(),
+	}
+}
+
+func cliToxiListSubCommand() *cli.Command {
+	return &cli.Command{
+		Name:         "list",
+		Aliases:      []string{"l", "ls"},
+		Usage:        "list the toxics of a proxy",
+		ArgsUsage:    "<proxyName>",
+		Flags:        []cli.Flag{outputFlag()},
+		Action:       withToxi(listToxicsOfProxy),
+		BashComplete: completeWith(nil, completeProxies),
 	}
 }
 
@@ -196,10 +481,46 @@ func cliToxiAddSubCommand() *cli.Command {
 				Aliases: []string{"a"},
 				Usage:   "toxic attribute in key=value format",
 			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "CSV or JSON file of the latencies of a profile toxic",
+			},
+			&cli.StringFlag{
+				Name:  "modulation",
+				Usage: "YAML or JSON file of the waveforms the attributes follow, none to stop them",
+			},
+			&cli.Int64Flag{
+				Name:  "seed",
+				Usage: "seed of the random values of the toxic, to replay them (default random)",
+			},
+			&cli.BoolFlag{
+				Name:  "sticky",
+				Usage: "roll the toxicity from the client IP, the same for each reconnect",
+			},
+			&cli.IntFlag{
+				Name:  "first-connections",
+				Usage: "only affect the first N connections opened after the toxic is added",
+			},
+			&cli.IntFlag{
+				Name:  "every-connection",
+				Usage: "only affect every Kth connection opened after the toxic is added",
+			},
+			&cli.StringFlag{
+				Name:  "match-client-cidr",
+				Usage: "only affect the clients in a CIDR, e.g. 10.1.0.0/16",
+			},
+			&cli.StringFlag{
+				Name:  "match-client-ports",
+				Usage: "only affect the clients of a port or range of ports, e.g. 40000-49999",
+			},
+			&cli.StringFlag{
+				Name:  "match-upstream",
+				Usage: "only affect the connections dialed to an upstream, as host:port or host",
+			},
 			&cli.BoolFlag{
 				Name:        "upstream",
 				Aliases:     []string{"u"},
-				Usage:       "add toxic to upstream",
+				Usage:       "add toxic to upstream, to both streams with --downstream",
 				DefaultText: "false",
 			},
 			&cli.BoolFlag{
@@ -210,6 +531,10 @@ func cliToxiAddSubCommand() *cli.Command {
 			},
 		},
 		Action: withToxi(addToxic),
+		BashComplete: completeWith(map[string]completer{
+			"type": completeToxicTypes,
+			"t":    completeToxicTypes,
+		}, completeProxies),
 	}
 }
 
@@ -236,8 +561,17 @@ func cliToxiUpdateSubCommand() *cli.Command {
 				Aliases: []string{"a"},
 				Usage:   "toxic attribute in key=value format",
 			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "CSV or JSON file of the latencies of a profile toxic",
+			},
+			&cli.StringFlag{
+				Name:  "modulation",
+				Usage: "YAML or JSON file of the waveforms the attributes follow, none to stop them",
+			},
 		},
-		Action: withToxi(updateToxic),
+		Action:       withToxi(updateToxic),
+		BashComplete: completeWith(toxicNameFlags, completeProxies),
 	}
 }
 
@@ -254,26 +588,91 @@ func cliToxiRemoveSubCommand() *cli.Command {
 				Usage:   "name of the toxic",
 			},
 		},
-		Action: withToxi(removeToxic),
+		Action:       withToxi(removeToxic),
+		BashComplete: completeWith(toxicNameFlags, completeProxies),
 	}
 }
 
+func cliToxiResumeSubCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "resume",
+		Usage:     "let the connections paused by a limit_data toxic through another limit",
+		ArgsUsage: "<proxyName>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "toxicName",
+				Aliases: []string{"n"},
+				Usage:   "name of the toxic",
+			},
+		},
+		Action:       withToxi(resumeToxic),
+		BashComplete: completeWith(toxicNameFlags, completeProxies),
+	}
+}
+
+func cliToxiOrderSubCommand() *cli.Command {
+	return &cli.Command{
+		Name:         "order",
+		Aliases:      []string{"o"},
+		Usage:        "change the order in which the toxics of each stream are applied",
+		ArgsUsage:    "<proxyName> <toxicName>...",
+		Action:       withToxi(orderToxics),
+		BashComplete: completeWith(nil, completeProxies),
+	}
+}
+
+// toxicNameFlags completes the name of a toxic given with --toxicName.
+var toxicNameFlags = map[string]completer{
+	"toxicName": completeToxics,
+	"n":         completeToxics,
+}
+
 type toxiAction func(*cli.Context, *toxiproxy.Client) error
 
 func withToxi(f toxiAction) func(*cli.Context) error {
 	return func(c *cli.Context) error {
-		toxiproxyClient := toxiproxy.NewClient(hostname)
-		toxiproxyClient.UserAgent = fmt.Sprintf(
-			"toxiproxy-cli/%s (%s/%s)",
-			c.App.Version,
-			runtime.GOOS,
-			runtime.GOARCH,
-		)
+		toxiproxyClient, err := newClient(c, 30*time.Second)
+		if err != nil {
+			return err
+		}
 		return f(c, toxiproxyClient)
 	}
 }
 
+func newClient(c *cli.Context, timeout time.Duration) (*toxiproxy.Client, error) {
+	toxiproxyClient := toxiproxy.NewClient(hostname)
+	toxiproxyClient.UserAgent = fmt.Sprintf(
+		"toxiproxy-cli/%s (%s/%s)",
+		c.App.Version,
+		runtime.GOOS,
+		runtime.GOARCH,
+	)
+
+	httpClient := &http.Client{Timeout: timeout}
+	if currentContext != nil {
+		err := currentContext.configure(toxiproxyClient, httpClient)
+		if err != nil {
+			return nil, errorf("Failed to configure context: %s\n", err)
+		}
+	}
+	toxiproxyClient.SetHTTPClient(httpClient)
+
+	namespace := c.String("namespace")
+	if namespace == "" && currentContext != nil {
+		namespace = currentContext.Namespace
+	}
+	if namespace != "" {
+		toxiproxyClient = toxiproxyClient.Namespace(namespace)
+	}
+	return toxiproxyClient, nil
+}
+
 func list(c *cli.Context, t *toxiproxy.Client) error {
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
 	proxies, err := t.Proxies()
 	if err != nil {
 		return errorf("Failed to retrieve proxies: %s", err)
@@ -285,6 +684,18 @@ func list(c *cli.Context, t *toxiproxy.Client) error {
 	}
 	sort.Strings(proxyNames)
 
+	sorted := make([]*toxiproxy.Proxy, 0, len(proxyNames))
+	for _, proxyName := range proxyNames {
+		sorted = append(sorted, proxies[proxyName])
+	}
+	if ok, err := printStructured(output, sorted); ok {
+		return err
+	}
+	if output == outputWide {
+		listProxiesWide(sorted)
+		return nil
+	}
+
 	if isTTY {
 		fmt.Printf(
 			"%sName\t\t\t%sListen\t\t%sUpstream\t\t%sEnabled\t\t%sToxics\n%s",
@@ -330,11 +741,26 @@ func inspectProxy(c *cli.Context, t *toxiproxy.Client) error {
 		return errorf("Proxy name is required as the first argument.\n")
 	}
 
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
 	proxy, err := t.Proxy(proxyName)
 	if err != nil {
 		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err.Error())
 	}
 
+	if ok, err := printStructured(output, proxy); ok {
+		return err
+	}
+	if output == outputWide {
+		listProxiesWide([]*toxiproxy.Proxy{proxy})
+		fmt.Println()
+		listToxicsWide(proxy.ActiveToxics)
+		return nil
+	}
+
 	if isTTY {
 		fmt.Printf("%sName: %s%s\t", color(PURPLE), color(NONE), proxy.Name)
 		fmt.Printf("%sListen: %s%s\t", color(BLUE), color(NONE), proxy.Listen)
@@ -348,9 +774,10 @@ func inspectProxy(c *cli.Context, t *toxiproxy.Client) error {
 			upstream := make(toxiproxy.Toxics, 0)
 			downstream := make(toxiproxy.Toxics, 0)
 			for _, toxic := range toxics {
-				if toxic.Stream == "upstream" {
+				if toxic.Stream == "upstream" || toxic.Stream == "both" {
 					upstream = append(upstream, toxic)
-				} else {
+				}
+				if toxic.Stream != "upstream" {
 					downstream = append(downstream, toxic)
 				}
 			}
@@ -373,6 +800,35 @@ func inspectProxy(c *cli.Context, t *toxiproxy.Client) error {
 	return nil
 }
 
+func listToxicsOfProxy(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().First()
+	if proxyName == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name is required as the first argument.\n")
+	}
+
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err.Error())
+	}
+
+	if ok, err := printStructured(output, proxy.ActiveToxics); ok {
+		return err
+	}
+	if output == outputWide {
+		listToxicsWide(proxy.ActiveToxics)
+		return nil
+	}
+
+	listToxics(proxy.ActiveToxics, "")
+	return nil
+}
+
 func toggleProxy(c *cli.Context, t *toxiproxy.Client) error {
 	proxyName := c.Args().First()
 	if proxyName == "" {
@@ -414,11 +870,58 @@ func createProxy(c *cli.Context, t *toxiproxy.Client) error {
 	if err != nil {
 		return err
 	}
-	upstream, err := getArgOrFail(c, "upstream")
-	if err != nil {
-		return err
+	// Forward and transparent proxies connect their clients to their own
+	// destinations.
+	upstream := c.String("upstream")
+	if protocol := c.String("protocol"); protocol != "forward" && protocol != "transparent" {
+		upstream, err = getArgOrFail(c, "upstream")
+		if err != nil {
+			return err
+		}
+	}
+	proxy := t.NewProxy()
+	proxy.Name = proxyName
+	proxy.Listen = listen
+	proxy.Upstream = upstream
+	proxy.Enabled = true
+	proxy.Protocol = c.String("protocol")
+	proxy.ReadBufferSize = c.Int("read-buffer-size")
+	proxy.ChannelDepth = c.Int("channel-depth")
+	proxy.Backpressure = c.String("backpressure")
+	proxy.BackpressureBytes = c.Int("backpressure-bytes")
+	proxy.MaxConnections = c.Int("max-connections")
+	proxy.OnLimit = c.String("on-limit")
+	proxy.LimitTimeout = c.Int("limit-timeout")
+	proxy.HangProbability = c.Float64("hang-probability")
+	proxy.HangTimeout = c.Int("hang-timeout")
+	proxy.DialTimeout = c.Int("dial-timeout")
+	proxy.DialRetries = c.Int("dial-retries")
+	proxy.DialBackoff = c.Int("dial-backoff")
+	proxy.UpstreamProxy = c.String("upstream-proxy")
+	proxy.UpstreamBind = toxiproxy.UpstreamBind{
+		Address:   c.String("upstream-bind"),
+		Interface: c.String("upstream-interface"),
+		Mark:      c.Int("upstream-mark"),
 	}
-	_, err = t.CreateProxy(proxyName, listen, upstream)
+	proxy.DualStack = toxiproxy.DualStack{
+		Prefer:       c.String("prefer-family"),
+		Race:         c.Bool("race-families"),
+		AttemptDelay: c.Int("attempt-delay"),
+		Fail:         c.String("fail-family"),
+		Blackhole:    c.Bool("blackhole"),
+	}
+	proxy.Allow = c.StringSlice("allow")
+	proxy.Deny = c.StringSlice("deny")
+	proxy.IdleTimeout = c.Int("idle-timeout")
+	proxy.MaxConnectionAge = c.Int("max-connection-age")
+	proxy.OnStop = c.String("on-stop")
+	proxy.HealthCheck = toxiproxy.HealthCheck{
+		Type:     c.String("health-check"),
+		Path:     c.String("health-path"),
+		OnDown:   c.String("on-down"),
+		Failover: c.String("failover"),
+	}
+	err = proxy.Save()
 	if err != nil {
 		return errorf("Failed to create proxy: %s\n", err.Error())
 	}
@@ -426,6 +929,47 @@ func createProxy(c *cli.Context, t *toxiproxy.Client) error {
 	return nil
 }
 
+func renameProxy(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName, newName := c.Args().Get(0), c.Args().Get(1)
+	if proxyName == "" || newName == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name and new name are required as the arguments.\n")
+	}
+	p, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err.Error())
+	}
+
+	err = p.Rename(newName)
+	if err != nil {
+		return errorf("Failed to rename proxy: %s\n", err.Error())
+	}
+	fmt.Printf("Renamed proxy %s to %s\n", proxyName, newName)
+	return nil
+}
+
+func moveProxy(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName, upstream := c.Args().Get(0), c.Args().Get(1)
+	if proxyName == "" || upstream == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name and upstream are required as the arguments.\n")
+	}
+	p, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err.Error())
+	}
+
+	err = p.Switch(upstream, toxiproxy.Switchover{
+		Connections:  c.String("connections"),
+		DrainTimeout: c.Int("drain-timeout"),
+	})
+	if err != nil {
+		return errorf("Failed to move proxy: %s\n", err.Error())
+	}
+	fmt.Printf("Moved proxy %s to upstream %s\n", proxyName, upstream)
+	return nil
+}
+
 func deleteProxy(c *cli.Context, t *toxiproxy.Client) error {
 	proxyName := c.Args().First()
 	if proxyName == "" {
@@ -490,6 +1034,16 @@ func updateToxic(c *cli.Context, t *toxiproxy.Client) error {
 	if err != nil {
 		return errorf("Failed to update toxic: %v\n", err)
 	}
+	if c.IsSet("modulation") {
+		proxy, err := t.Proxy(toxicParams.ProxyName)
+		if err != nil {
+			return errorf("Failed to retrieve proxy %s: %s\n", toxicParams.ProxyName, err)
+		}
+		_, err = proxy.ModulateToxic(toxic.Name, toxicParams.Modulation)
+		if err != nil {
+			return errorf("Failed to modulate toxic: %v\n", err)
+		}
+	}
 
 	fmt.Printf(
 		"Updated toxic '%s' on proxy '%s'\n",
@@ -514,6 +1068,47 @@ func removeToxic(c *cli.Context, t *toxiproxy.Client) error {
 	return nil
 }
 
+func resumeToxic(c *cli.Context, t *toxiproxy.Client) error {
+	toxicParams, err := parseToxicCommonParams(c)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := t.Proxy(toxicParams.ProxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", toxicParams.ProxyName, err.Error())
+	}
+	_, err = proxy.ResumeToxic(toxicParams.ToxicName)
+	if err != nil {
+		return errorf("Failed to resume toxic: %v\n", err)
+	}
+
+	fmt.Printf("Resumed toxic '%s' on proxy '%s'\n", toxicParams.ToxicName, toxicParams.ProxyName)
+	return nil
+}
+
+func orderToxics(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().First()
+	if proxyName == "" || c.NArg() < 2 {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name and the toxic names in order are required.\n")
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err.Error())
+	}
+
+	toxics, err := proxy.ReorderToxics(c.Args().Tail()...)
+	if err != nil {
+		return errorf("Failed to reorder toxics: %v\n", err)
+	}
+
+	fmt.Printf("Reordered the toxics of proxy '%s'\n", proxyName)
+	listToxics(toxics, "")
+	return nil
+}
+
 func parseToxicCommonParams(context *cli.Context) (*toxiproxy.ToxicOptions, error) {
 	proxyName := context.Args().First()
 	if proxyName == "" {
@@ -540,7 +1135,14 @@ func parseUpdateToxicParams(c *cli.Context) (*toxiproxy.ToxicOptions, error) {
 		return nil, err
 	}
 
-	result.Attributes = parseAttributes(c, "attribute")
+	result.Attributes, err = parseProfileAttributes(c)
+	if err != nil {
+		return nil, err
+	}
+	result.Modulation, err = parseModulation(c)
+	if err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -556,14 +1158,11 @@ func parseAddToxicParams(c *cli.Context) (*toxiproxy.ToxicOptions, error) {
 		return nil, err
 	}
 
-	upstream := c.Bool("upstream")
-	downstream := c.Bool("downstream")
-	if upstream && downstream {
-		return nil, errorf("Only one should be specified: upstream or downstream.\n")
-	}
-
 	stream := "downstream"
-	if upstream {
+	switch upstream, downstream := c.Bool("upstream"), c.Bool("downstream"); {
+	case upstream && downstream:
+		stream = "both"
+	case upstream:
 		stream = "upstream"
 	}
 	result.Stream = stream
@@ -573,7 +1172,26 @@ func parseAddToxicParams(c *cli.Context) (*toxiproxy.ToxicOptions, error) {
 		return nil, err
 	}
 
-	result.Attributes = parseAttributes(c, "attribute")
+	result.Seed = c.Int64("seed")
+	result.Sticky = c.Bool("sticky")
+	result.FirstConnections = c.Int("first-connections")
+	result.EveryConnection = c.Int("every-connection")
+	match := toxiproxy.Match{
+		ClientCIDR:  c.String("match-client-cidr"),
+		ClientPorts: c.String("match-client-ports"),
+		Upstream:    c.String("match-upstream"),
+	}
+	if match != (toxiproxy.Match{}) {
+		result.Match = &match
+	}
+	result.Attributes, err = parseProfileAttributes(c)
+	if err != nil {
+		return nil, err
+	}
+	result.Modulation, err = parseModulation(c)
+	if err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -589,6 +1207,8 @@ func parseAttributes(c *cli.Context, name string) toxiproxy.Attributes {
 		}
 		if float, err := strconv.ParseFloat(kv[1], 64); err == nil {
 			parsed[kv[0]] = float
+		} else if kv[1] == "true" || kv[1] == "false" {
+			parsed[kv[0]] = kv[1] == "true"
 		} else {
 			parsed[kv[0]] = kv[1]
 		}
@@ -648,6 +1268,29 @@ func listToxics(toxics toxiproxy.Toxics, stream string) {
 		fmt.Printf("type=%s\t", t.Type)
 		fmt.Printf("stream=%s\t", t.Stream)
 		fmt.Printf("toxicity=%.2f\t", t.Toxicity)
+		fmt.Printf("seed=%d\t", t.Seed)
+		if t.Sticky {
+			fmt.Printf("sticky=true\t")
+		}
+		if t.FirstConnections > 0 {
+			fmt.Printf("first_connections=%d\t", t.FirstConnections)
+		}
+		if t.EveryConnection > 0 {
+			fmt.Printf("every_connection=%d\t", t.EveryConnection)
+		}
+		if t.Match != nil {
+			fmt.Printf("match=[")
+			for _, field := range []struct{ key, value string }{
+				{"client_cidr", t.Match.ClientCIDR},
+				{"client_ports", t.Match.ClientPorts},
+				{"upstream", t.Match.Upstream},
+			} {
+				if field.value != "" {
+					fmt.Printf("\t%s=%s", field.key, field.value)
+				}
+			}
+			fmt.Printf("\t]\t")
+		}
 		fmt.Printf("attributes=[")
 		sorted := sortedAttributes(t.Attributes)
 		for _, a := range sorted {
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// Completions query the server, but must not hang the shell when it is down.
+const completionTimeout = 2 * time.Second
+
+var bashCompletion = `_toxiproxy_cli_complete() {
+  local cur words
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  words=("${COMP_WORDS[@]:0:$COMP_CWORD}")
+  if [[ "$cur" == "-"* ]]; then
+    words+=("$cur")
+  fi
+  local opts=$("${words[@]}" --generate-bash-completion 2>/dev/null)
+  COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+}
+
+complete -o bashdefault -o default -F _toxiproxy_cli_complete toxiproxy-cli
+`
+
+var zshCompletion = `#compdef toxiproxy-cli
+
+_toxiproxy_cli() {
+  local -a opts
+  local cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    compadd -a opts
+  else
+    _files
+  fi
+}
+
+compdef _toxiproxy_cli toxiproxy-cli
+`
+
+func cliCompletionCommand() *cli.Command {
+	return &cli.Command{
+		Name: "completion",
+		Usage: "\tprint the shell completion script for bash or zsh\n" +
+			"\t\tusage: 'source <(toxiproxy-cli completion bash)'\n",
+		ArgsUsage: "bash|zsh",
+		BashComplete: func(c *cli.Context) {
+			printCompletions(c, []string{"bash", "zsh"})
+		},
+		Action: func(c *cli.Context) error {
+			switch c.Args().First() {
+			case "bash":
+				fmt.Print(bashCompletion)
+			case "zsh":
+				fmt.Print(zshCompletion)
+			default:
+				cli.ShowSubcommandHelp(c)
+				return errorf("Shell should be either bash or zsh.\n")
+			}
+			return nil
+		},
+	}
+}
+
+// completer lists the values an argument or a flag can take, as known by the
+// server the CLI talks to.
+type completer func(c *cli.Context, t *toxiproxy.Client) []string
+
+// completeWith completes the flags with a completer of their own, and the
+// positional arguments of a command in order.
+func completeWith(flags map[string]completer, args ...completer) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		var previous string
+		if len(os.Args) > 2 {
+			previous = os.Args[len(os.Args)-2]
+		}
+
+		var complete completer
+		if flag, ok := flags[strings.TrimLeft(previous, "-")]; ok && previous != "" {
+			complete = flag
+		} else if strings.HasPrefix(previous, "-") {
+			cli.DefaultCompleteWithFlags(c.Command)(c)
+			return
+		} else if c.NArg() < len(args) {
+			complete = args[c.NArg()]
+		}
+		if complete == nil {
+			return
+		}
+
+		// Before actions don't run when completing.
+		if selectContext(c) != nil {
+			return
+		}
+		t, err := newClient(c, completionTimeout)
+		if err != nil {
+			return
+		}
+		printCompletions(c, complete(c, t))
+	}
+}
+
+func printCompletions(c *cli.Context, values []string) {
+	for _, value := range values {
+		fmt.Fprintln(c.App.Writer, value)
+	}
+}
+
+func completeProxies(c *cli.Context, t *toxiproxy.Client) []string {
+	proxies, err := t.Proxies()
+	if err != nil {
+		return nil
+	}
+	return sortedProxyNames(proxies)
+}
+
+// completeToxics lists the toxics of the proxy given as first argument, or of
+// all proxies when the flag comes before it.
+func completeToxics(c *cli.Context, t *toxiproxy.Client) []string {
+	proxies, err := t.Proxies()
+	if err != nil {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for name, proxy := range proxies {
+		if c.NArg() > 0 && name != c.Args().First() {
+			continue
+		}
+		for _, toxic := range proxy.ActiveToxics {
+			names[toxic.Name] = true
+		}
+	}
+
+	toxics := make([]string, 0, len(names))
+	for name := range names {
+		toxics = append(toxics, name)
+	}
+	sort.Strings(toxics)
+	return toxics
+}
+
+func completeToxicTypes(c *cli.Context, t *toxiproxy.Client) []string {
+	types, err := t.ToxicTypes()
+	if err != nil {
+		return nil
+	}
+	return types
+}
+
+func completePresets(c *cli.Context, t *toxiproxy.Client) []string {
+	presets, err := t.Presets()
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(presets))
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	return names
+}
+
+// completeConnections lists the connections of the proxy given as first
+// argument.
+func completeConnections(c *cli.Context, t *toxiproxy.Client) []string {
+	proxy, err := t.Proxy(c.Args().First())
+	if err != nil {
+		return nil
+	}
+	connections, err := proxy.Connections()
+	if err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(connections))
+	for _, conn := range connections {
+		ids = append(ids, strconv.FormatUint(conn.ID, 10))
+	}
+	return ids
+}
+
+func completeDirections(*cli.Context, *toxiproxy.Client) []string {
+	return []string{"upstream", "downstream"}
+}
+
+func completeContexts(c *cli.Context, _ *toxiproxy.Client) []string {
+	config, err := readContextsConfig(c.String("config"))
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
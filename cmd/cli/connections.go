@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliConnectionsCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "connections",
+		Aliases: []string{"conns"},
+		Usage: "\tlist or kill the open connections of a proxy\n" +
+			"\t\tusage: 'toxiproxy-cli connections kill <proxyName> <connectionId>'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:         "list",
+				Aliases:      []string{"l", "ls"},
+				Usage:        "list the open connections of a proxy",
+				ArgsUsage:    "<proxyName>",
+				Flags:        []cli.Flag{outputFlag()},
+				Action:       withToxi(listConnections),
+				BashComplete: completeWith(nil, completeProxies),
+			},
+			{
+				Name:         "kill",
+				Aliases:      []string{"k"},
+				Usage:        "close a connection on both the client and the upstream side",
+				ArgsUsage:    "<proxyName> <connectionId>",
+				Action:       withToxi(killConnection),
+				BashComplete: completeWith(nil, completeProxies, completeConnections),
+			},
+		},
+	}
+}
+
+func listConnections(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().First()
+	if proxyName == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name is required as the first argument.\n")
+	}
+
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+	}
+	connections, err := proxy.Connections()
+	if err != nil {
+		return errorf("Failed to retrieve connections of %s: %s\n", proxyName, err)
+	}
+
+	if ok, err := printStructured(output, connections); ok {
+		return err
+	}
+
+	if len(connections) == 0 {
+		fmt.Printf("%sProxy %s has no open connections.%s\n", color(RED), proxyName, color(NONE))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tUPSTREAM\tAGE\tUPSTREAM BYTES\tDOWNSTREAM BYTES")
+	for _, conn := range connections {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\n",
+			conn.ID,
+			conn.Client,
+			conn.Upstream,
+			time.Since(conn.OpenedAt).Round(time.Second),
+			conn.UpstreamBytes,
+			conn.DownstreamBytes,
+		)
+	}
+	w.Flush()
+	return nil
+}
+
+func killConnection(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().Get(0)
+	idArg := c.Args().Get(1)
+	if proxyName == "" || idArg == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name and connection id are required.\n")
+	}
+
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil {
+		return errorf("Connection id should be a number, got %s.\n", idArg)
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+	}
+	err = proxy.KillConnection(id)
+	if err != nil {
+		return errorf("Failed to kill connection %d: %s\n", id, err)
+	}
+
+	fmt.Printf("Killed connection %d on proxy '%s'\n", id, proxyName)
+	return nil
+}
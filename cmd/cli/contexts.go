@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// contextsConfig is the config file of the CLI, with the servers it can talk
+// to. Paths in a context are relative to the directory of the file.
+type contextsConfig struct {
+	CurrentContext string                    `yaml:"current-context,omitempty"`
+	Contexts       map[string]*serverContext `yaml:"contexts"`
+}
+
+type serverContext struct {
+	Host               string `yaml:"host"`
+	CACert             string `yaml:"ca-cert,omitempty"`
+	ClientCert         string `yaml:"client-cert,omitempty"`
+	ClientKey          string `yaml:"client-key,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify,omitempty"`
+	Token              string `yaml:"token,omitempty"`
+	Username           string `yaml:"username,omitempty"`
+	Password           string `yaml:"password,omitempty"`
+	Namespace          string `yaml:"namespace,omitempty"`
+}
+
+// currentContext is the context selected by --context or the config file,
+// nil when the CLI talks to --host without any settings.
+var currentContext *serverContext
+
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".toxiproxy", "config")
+}
+
+func readContextsConfig(path string) (*contextsConfig, error) {
+	config := &contextsConfig{Contexts: map[string]*serverContext{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]*serverContext{}
+	}
+
+	dir := filepath.Dir(path)
+	for name, context := range config.Contexts {
+		if context == nil || context.Host == "" {
+			return nil, fmt.Errorf("context %s must have a host", name)
+		}
+		for _, file := range []*string{&context.CACert, &context.ClientCert, &context.ClientKey} {
+			*file = resolvePath(dir, *file)
+		}
+	}
+	return config, nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" {
+		return ""
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// selectContext picks the context of --context, or the current one of the
+// config file, unless --host is given explicitly.
+func selectContext(c *cli.Context) error {
+	name := c.String("context")
+	if c.IsSet("host") && name == "" {
+		return nil
+	}
+
+	config, err := readContextsConfig(c.String("config"))
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", c.String("config"), err)
+	}
+
+	if name == "" {
+		name = config.CurrentContext
+		if name == "" {
+			return nil
+		}
+	}
+	context, ok := config.Contexts[name]
+	if !ok {
+		return errorf("Context %s is not defined in %s\n", name, c.String("config"))
+	}
+
+	currentContext = context
+	if !c.IsSet("host") {
+		hostname = context.Host
+	}
+	return nil
+}
+
+// configure applies the TLS and authentication settings of the context.
+func (context *serverContext) configure(client *toxiproxy.Client, httpClient *http.Client) error {
+	client.Header = http.Header{}
+	switch {
+	case context.Token != "":
+		client.Header.Set("Authorization", "Bearer "+context.Token)
+	case context.Username != "":
+		credentials := base64.StdEncoding.EncodeToString(
+			[]byte(context.Username + ":" + context.Password))
+		client.Header.Set("Authorization", "Basic "+credentials)
+	}
+
+	if context.CACert == "" && context.ClientCert == "" && !context.InsecureSkipVerify {
+		return nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: context.InsecureSkipVerify} // #nosec G402
+	if context.CACert != "" {
+		pem, err := os.ReadFile(context.CACert)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", context.CACert)
+		}
+	}
+	if context.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(context.ClientCert, context.ClientKey)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	httpClient.Transport = transport
+	return nil
+}
+
+func cliContextCommand() *cli.Command {
+	return &cli.Command{
+		Name: "context",
+		Usage: "\tlist or switch the servers of the config file\n" +
+			"\t\tusage: 'toxiproxy-cli context use <contextName>'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"l", "ls"},
+				Usage:   "list the contexts, with the current one marked with *",
+				Action:  listContexts,
+			},
+			{
+				Name:         "use",
+				Usage:        "make a context the current one",
+				ArgsUsage:    "<contextName>",
+				Action:       useContext,
+				BashComplete: completeWith(nil, completeContexts),
+			},
+		},
+	}
+}
+
+func listContexts(c *cli.Context) error {
+	path := c.String("config")
+	config, err := readContextsConfig(path)
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", path, err)
+	}
+
+	current := c.String("context")
+	if current == "" {
+		current = config.CurrentContext
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		fmt.Printf("%sno contexts defined in %s%s\n", color(RED), path, color(NONE))
+		return nil
+	}
+	for _, name := range names {
+		marker := " "
+		col := NONE
+		if name == current {
+			marker, col = "*", GREEN
+		}
+		fmt.Printf("%s %s%s%s\t%s\n", marker, color(col), name, color(NONE),
+			config.Contexts[name].Host)
+	}
+	return nil
+}
+
+// useContext sets the current context of the config file.
+func useContext(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Context name is required as the first argument.\n")
+	}
+
+	path := c.String("config")
+	config, err := readContextsConfig(path)
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", path, err)
+	}
+	if _, ok := config.Contexts[name]; !ok {
+		return errorf("Context %s is not defined in %s\n", name, path)
+	}
+
+	var document yaml.Node
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = yaml.Unmarshal(data, &document)
+	}
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", path, err)
+	}
+	setCurrentContext(&document, name)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&document)
+	if err == nil {
+		err = os.WriteFile(path, buf.Bytes(), 0o600)
+	}
+	if err != nil {
+		return errorf("Failed to write %s: %s\n", path, err)
+	}
+
+	fmt.Printf("Switched to context %s (%s)\n", name, config.Contexts[name].Host)
+	return nil
+}
+
+// setCurrentContext updates the current-context of a parsed config file in
+// place, so that the rest of the file and its comments are written back.
+func setCurrentContext(document *yaml.Node, name string) {
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "current-context" {
+			root.Content[i+1].SetString(name)
+			return
+		}
+	}
+	key := &yaml.Node{}
+	key.SetString("current-context")
+	value := &yaml.Node{}
+	value.SetString(name)
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliDirectionCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "direction",
+		Aliases: []string{"dir"},
+		Usage: "\tenable or disable one direction of the connections of a proxy\n" +
+			"\t\tusage: 'toxiproxy-cli direction disable <proxyName> <upstream|downstream>'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:         "enable",
+				Aliases:      []string{"e"},
+				Usage:        "relay the data of a direction again",
+				ArgsUsage:    "<proxyName> <upstream|downstream>",
+				Action:       withToxi(setDirection(true)),
+				BashComplete: completeWith(nil, completeProxies, completeDirections),
+			},
+			{
+				Name:         "disable",
+				Aliases:      []string{"d"},
+				Usage:        "discard the data of a direction, keeping the connections open",
+				ArgsUsage:    "<proxyName> <upstream|downstream>",
+				Action:       withToxi(setDirection(false)),
+				BashComplete: completeWith(nil, completeProxies, completeDirections),
+			},
+		},
+	}
+}
+
+func setDirection(enabled bool) toxiAction {
+	return func(c *cli.Context, t *toxiproxy.Client) error {
+		proxyName := c.Args().Get(0)
+		direction := c.Args().Get(1)
+		if proxyName == "" || direction == "" {
+			cli.ShowSubcommandHelp(c)
+			return errorf("Proxy name and direction are required.\n")
+		}
+
+		proxy, err := t.Proxy(proxyName)
+		if err != nil {
+			return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+		}
+		err = proxy.SetDirection(direction, enabled)
+		if err != nil {
+			return errorf("Failed to set the %s direction of %s: %s\n", direction, proxyName, err)
+		}
+
+		fmt.Printf(
+			"The %s direction of proxy %s%s%s is now %s%s%s\n",
+			direction,
+			colorEnabled(proxy.Enabled),
+			proxyName,
+			color(NONE),
+			colorEnabled(enabled),
+			enabledText(enabled),
+			color(NONE),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliExportCommand() *cli.Command {
+	return &cli.Command{
+		Name: "export",
+		Usage: "\tprint the proxies and their toxics in the format of apply\n" +
+			"\t\tusage: 'toxiproxy-cli export [--output yaml|json] [proxyName...]'\n",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   "yaml",
+				Usage:   "format of the state, yaml or json",
+			},
+		},
+		Action:       withToxi(exportState),
+		BashComplete: completeWith(nil, completeProxies),
+	}
+}
+
+func exportState(c *cli.Context, t *toxiproxy.Client) error {
+	output := c.String("output")
+	if output != "yaml" && output != "json" {
+		return errorf("output should be either yaml or json.\n")
+	}
+
+	proxies, err := t.Proxies()
+	if err != nil {
+		return errorf("Failed to retrieve proxies: %s\n", err)
+	}
+
+	names := c.Args().Slice()
+	if len(names) == 0 {
+		names = sortedProxyNames(proxies)
+	}
+
+	state := make([]stateProxy, 0, len(names))
+	for _, name := range names {
+		proxy, ok := proxies[name]
+		if !ok {
+			return errorf("Failed to retrieve proxy %s: proxy not found\n", name)
+		}
+		state = append(state, exportProxy(proxy))
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(state)
+	} else {
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		err = encoder.Encode(state)
+		if err == nil {
+			err = encoder.Close()
+		}
+	}
+	if err != nil {
+		return errorf("Failed to export proxies: %s\n", err)
+	}
+	return nil
+}
+
+// exportProxy converts a proxy to its state, with every attribute of the
+// toxics in the order they are applied.
+func exportProxy(proxy *toxiproxy.Proxy) stateProxy {
+	enabled := proxy.Enabled
+	state := stateProxy{
+		Name:     proxy.Name,
+		Listen:   proxy.Listen,
+		Upstream: proxy.Upstream,
+		Enabled:  &enabled,
+	}
+	for _, toxic := range proxy.ActiveToxics {
+		toxicity := toxic.Toxicity
+		state.Toxics = append(state.Toxics, stateToxic{
+			Name:       toxic.Name,
+			Type:       toxic.Type,
+			Stream:     toxic.Stream,
+			Toxicity:   &toxicity,
+			Attributes: toxic.Attributes,
+		})
+	}
+	return state
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliLoadgenCommand() *cli.Command {
+	return &cli.Command{
+		Name: "loadgen",
+		Usage: "\tpush TCP traffic through a proxy and report throughput and latency\n" +
+			"\t\tusage: 'toxiproxy-cli loadgen [--connections 10] [--echo-upstream] <proxyName>'\n",
+		ArgsUsage: "<proxyName>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "connections",
+				Aliases: []string{"c"},
+				Value:   1,
+				Usage:   "number of concurrent connections",
+			},
+			&cli.DurationFlag{
+				Name:    "duration",
+				Aliases: []string{"d"},
+				Value:   10 * time.Second,
+				Usage:   "how long to send traffic for",
+			},
+			&cli.IntFlag{
+				Name:    "size",
+				Aliases: []string{"s"},
+				Value:   1024,
+				Usage:   "size of each message in bytes",
+			},
+			&cli.Float64Flag{
+				Name:    "rate",
+				Aliases: []string{"r"},
+				Usage:   "messages per second of each connection (default as fast as possible)",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Value: "echo",
+				Usage: "echo: wait for each message to come back and measure its latency, " +
+					"stream: only send, for throughput",
+			},
+			&cli.StringFlag{
+				Name:  "address",
+				Usage: "address to connect to (default the listen address of the proxy)",
+			},
+			&cli.BoolFlag{
+				Name: "echo-upstream",
+				Usage: "serve an echo upstream and point the proxy at it during the run, " +
+					"the proxy must run on this host",
+			},
+			outputFlag(),
+		},
+		Action:       withToxi(loadgen),
+		BashComplete: completeWith(nil, completeProxies),
+	}
+}
+
+// loadgenConfig is a traffic pattern sent through a proxy by each connection.
+type loadgenConfig struct {
+	address     string
+	connections int
+	duration    time.Duration
+	size        int
+	rate        float64
+	echo        bool // Read each message back before sending the next one
+}
+
+// loadgenReport is the traffic achieved through a proxy.
+type loadgenReport struct {
+	Connections int     `json:"connections"`
+	Seconds     float64 `json:"seconds"`
+	Messages    int64   `json:"messages"`
+	Bytes       int64   `json:"bytes"`
+	Errors      int64   `json:"errors"`
+	// Bytes sent per second by all connections.
+	Throughput float64 `json:"throughput"`
+	// Round trips of the messages in echo mode.
+	Latency *latencyReport `json:"latency_ms,omitempty"`
+}
+
+// latencyReport summarizes the round trips of the messages in milliseconds.
+type latencyReport struct {
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func loadgen(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().First()
+	if proxyName == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name is required as the first argument.\n")
+	}
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
+	config := loadgenConfig{
+		address:     c.String("address"),
+		connections: c.Int("connections"),
+		duration:    c.Duration("duration"),
+		size:        c.Int("size"),
+		rate:        c.Float64("rate"),
+	}
+	switch c.String("mode") {
+	case "echo":
+		config.echo = true
+	case "stream":
+	default:
+		return errorf("mode should be echo or stream.\n")
+	}
+	if config.connections <= 0 || config.duration <= 0 || config.size <= 0 || config.rate < 0 {
+		return errorf("connections, duration and size should be positive, " +
+			"and rate not negative.\n")
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+	}
+	if config.address == "" {
+		config.address = proxy.Listen
+	}
+
+	if c.Bool("echo-upstream") {
+		restore, err := pointAtEchoUpstream(proxy)
+		if err != nil {
+			return errorf("Failed to serve an echo upstream: %s\n", err)
+		}
+		defer func() {
+			err := restore()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to restore the upstream of %s: %s\n", proxyName, err)
+			}
+		}()
+	} else if config.echo {
+		fmt.Fprintf(os.Stderr, "The upstream of %s must echo the messages in echo mode.\n", proxyName)
+	}
+
+	report := runLoadgen(config)
+	ok, err := printStructured(output, report)
+	if ok || err != nil {
+		return err
+	}
+	printLoadgenReport(proxyName, report)
+	return nil
+}
+
+// pointAtEchoUpstream serves an upstream that echoes what it receives, and
+// points the proxy at it until the returned function restores its upstream.
+func pointAtEchoUpstream(proxy *toxiproxy.Proxy) (func() error, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	upstream := proxy.Upstream
+	proxy.Upstream = listener.Addr().String()
+	err = proxy.Save()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return func() error {
+		defer listener.Close()
+		proxy.Upstream = upstream
+		return proxy.Save()
+	}, nil
+}
+
+// runLoadgen sends the traffic of the config through the address until its
+// duration elapsed.
+func runLoadgen(config loadgenConfig) loadgenReport {
+	var (
+		messages, bytes, errs atomic.Int64
+		mutex                 sync.Mutex
+		latencies             []time.Duration
+		wg                    sync.WaitGroup
+	)
+	start := time.Now()
+	deadline := start.Add(config.duration)
+	for i := 0; i < config.connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := loadgenWorker{config: config, messages: &messages, bytes: &bytes}
+			err := w.run(deadline)
+			if err != nil {
+				errs.Add(1)
+			}
+			mutex.Lock()
+			latencies = append(latencies, w.latencies...)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	report := loadgenReport{
+		Connections: config.connections,
+		Seconds:     elapsed.Seconds(),
+		Messages:    messages.Load(),
+		Bytes:       bytes.Load(),
+		Errors:      errs.Load(),
+		Throughput:  float64(bytes.Load()) / elapsed.Seconds(),
+	}
+	if config.echo && len(latencies) > 0 {
+		report.Latency = summarizeLatencies(latencies)
+	}
+	return report
+}
+
+// loadgenWorker sends the messages of a single connection.
+type loadgenWorker struct {
+	config    loadgenConfig
+	messages  *atomic.Int64
+	bytes     *atomic.Int64
+	latencies []time.Duration
+}
+
+// run sends messages until the deadline, and returns the error that stopped it
+// before then, if any.
+func (w *loadgenWorker) run(deadline time.Time) error {
+	conn, err := net.DialTimeout("tcp", w.config.address, time.Until(deadline))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	if !w.config.echo {
+		// Whatever comes back is discarded, so that an echo upstream doesn't
+		// block the connection.
+		go io.Copy(io.Discard, conn)
+	}
+
+	message := make([]byte, w.config.size)
+	reply := make([]byte, w.config.size)
+	var interval time.Duration
+	if w.config.rate > 0 {
+		interval = time.Duration(float64(time.Second) / w.config.rate)
+	}
+	next := time.Now()
+	for {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+			next = next.Add(interval)
+		}
+		sent := time.Now()
+		if !sent.Before(deadline) {
+			return nil
+		}
+
+		_, err = conn.Write(message)
+		if err == nil && w.config.echo {
+			_, err = io.ReadFull(conn, reply)
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		w.messages.Add(1)
+		w.bytes.Add(int64(len(message)))
+		if w.config.echo {
+			w.latencies = append(w.latencies, time.Since(sent))
+		}
+	}
+}
+
+func summarizeLatencies(latencies []time.Duration) *latencyReport {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		i := int(p * float64(len(latencies)-1))
+		return float64(latencies[i]) / float64(time.Millisecond)
+	}
+	return &latencyReport{
+		Min: percentile(0),
+		P50: percentile(0.5),
+		P90: percentile(0.9),
+		P99: percentile(0.99),
+		Max: percentile(1),
+	}
+}
+
+func printLoadgenReport(proxyName string, report loadgenReport) {
+	fmt.Printf("%sProxy %s%s: %d connections for %.1fs\n",
+		color(GREEN), proxyName, color(NONE), report.Connections, report.Seconds)
+	fmt.Printf("  messages:   %d (%d bytes)\n", report.Messages, report.Bytes)
+	fmt.Printf("  throughput: %.2f KB/s\n", report.Throughput/1000)
+	if report.Latency != nil {
+		fmt.Printf("  latency:    min %.2fms, p50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms\n",
+			report.Latency.Min,
+			report.Latency.P50,
+			report.Latency.P90,
+			report.Latency.P99,
+			report.Latency.Max,
+		)
+	}
+	if report.Errors > 0 {
+		fmt.Printf("  %serrors:     %d connections failed%s\n", color(RED), report.Errors, color(NONE))
+	}
+}
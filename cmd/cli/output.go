@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// Output formats of the commands that show proxies and toxics. The default
+// is the human readable format of each command.
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputWide = "wide"
+)
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "output format: json, yaml or wide",
+	}
+}
+
+func parseOutput(c *cli.Context) (string, error) {
+	output := c.String("output")
+	switch output {
+	case "", outputJSON, outputYAML, outputWide:
+		return output, nil
+	}
+	return "", errorf("output should be one of json, yaml or wide.\n")
+}
+
+// printStructured prints v as JSON or YAML, with the field names of the API.
+// It returns false for the other formats, which each command prints itself.
+func printStructured(output string, v interface{}) (bool, error) {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return true, encoder.Encode(v)
+	case outputYAML:
+		// Going through JSON keeps the names of the json tags as keys.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return true, err
+		}
+		var generic interface{}
+		err = json.Unmarshal(data, &generic)
+		if err != nil {
+			return true, err
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		err = encoder.Encode(generic)
+		if err != nil {
+			return true, err
+		}
+		return true, encoder.Close()
+	}
+	return false, nil
+}
+
+func listProxiesWide(proxies []*toxiproxy.Proxy) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tLISTEN\tUPSTREAM\tENABLED\tCONNECTIONS\tUPSTREAM BYTES\t"+
+		"DOWNSTREAM BYTES\tTOXICS")
+	for _, proxy := range proxies {
+		stats := proxy.Stats
+		if stats == nil {
+			stats = &toxiproxy.ProxyStats{}
+		}
+		names := make([]string, 0, len(proxy.ActiveToxics))
+		for _, toxic := range proxy.ActiveToxics {
+			names = append(names, toxic.Name)
+		}
+		toxics := strings.Join(names, ",")
+		if toxics == "" {
+			toxics = "None"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			proxy.Name,
+			proxy.Listen,
+			proxy.Upstream,
+			enabledText(proxy.Enabled),
+			stats.Connections,
+			stats.UpstreamBytes,
+			stats.DownstreamBytes,
+			toxics,
+		)
+	}
+	w.Flush()
+}
+
+func listToxicsWide(toxics toxiproxy.Toxics) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSTREAM\tTOXICITY\tACTIVATIONS\tCHUNKS\tBYTES\tCLOSES\tATTRIBUTES")
+	for _, toxic := range toxics {
+		stats := toxic.Stats
+		if stats == nil {
+			stats = &toxiproxy.ToxicStats{}
+		}
+		attributes := make([]string, 0, len(toxic.Attributes))
+		for _, a := range sortedAttributes(toxic.Attributes) {
+			attributes = append(attributes, fmt.Sprintf("%s=%v", a.key, a.value))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%d\t%d\t%d\t%d\t%s\n",
+			toxic.Name,
+			toxic.Type,
+			toxic.Stream,
+			toxic.Toxicity,
+			stats.Activations,
+			stats.Chunks,
+			stats.Bytes,
+			stats.Closes,
+			strings.Join(attributes, ","),
+		)
+	}
+	w.Flush()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliPresetCommand() *cli.Command {
+	return &cli.Command{
+		Name: "preset",
+		Usage: "\tlist, apply or remove presets of toxics\n" +
+			"\t\tusage: 'toxiproxy-cli preset apply <presetName> <proxyName>'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"l", "ls"},
+				Usage:   "list the presets and their toxics",
+				Flags:   []cli.Flag{outputFlag()},
+				Action:  withToxi(listPresets),
+			},
+			{
+				Name:         "apply",
+				Aliases:      []string{"a"},
+				Usage:        "add the toxics of a preset to a proxy",
+				ArgsUsage:    "<presetName> <proxyName>",
+				Action:       withToxi(applyPreset),
+				BashComplete: completeWith(nil, completePresets, completeProxies),
+			},
+			{
+				Name:         "remove",
+				Aliases:      []string{"r", "delete", "d"},
+				Usage:        "remove the toxics of a preset from a proxy",
+				ArgsUsage:    "<presetName> <proxyName>",
+				Action:       withToxi(removePreset),
+				BashComplete: completeWith(nil, completePresets, completeProxies),
+			},
+		},
+	}
+}
+
+func listPresets(c *cli.Context, t *toxiproxy.Client) error {
+	output, err := parseOutput(c)
+	if err != nil {
+		return err
+	}
+
+	presets, err := t.Presets()
+	if err != nil {
+		return errorf("Failed to retrieve presets: %s\n", err)
+	}
+
+	if ok, err := printStructured(output, presets); ok {
+		return err
+	}
+
+	for _, preset := range presets {
+		fmt.Printf("%s%s%s\t%s\n", color(BLUE), preset.Name, color(NONE), preset.Description)
+		for _, toxic := range preset.Toxics {
+			fmt.Printf("\t%s\n", describeToxic(toxic))
+		}
+	}
+	return nil
+}
+
+func applyPreset(c *cli.Context, t *toxiproxy.Client) error {
+	proxy, presetName, err := presetArgs(c, t)
+	if err != nil {
+		return err
+	}
+
+	toxics, err := proxy.ApplyPreset(presetName)
+	if err != nil {
+		return errorf("Failed to apply preset %s: %s\n", presetName, err)
+	}
+
+	fmt.Printf("Applied preset '%s' on proxy '%s'\n", presetName, proxy.Name)
+	listToxics(toxics, "")
+	return nil
+}
+
+func removePreset(c *cli.Context, t *toxiproxy.Client) error {
+	proxy, presetName, err := presetArgs(c, t)
+	if err != nil {
+		return err
+	}
+
+	err = proxy.RemovePreset(presetName)
+	if err != nil {
+		return errorf("Failed to remove preset %s: %s\n", presetName, err)
+	}
+
+	fmt.Printf("Removed preset '%s' from proxy '%s'\n", presetName, proxy.Name)
+	return nil
+}
+
+func presetArgs(c *cli.Context, t *toxiproxy.Client) (*toxiproxy.Proxy, string, error) {
+	presetName := c.Args().Get(0)
+	proxyName := c.Args().Get(1)
+	if presetName == "" || proxyName == "" {
+		cli.ShowSubcommandHelp(c)
+		return nil, "", errorf("Preset and proxy names are required.\n")
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return nil, "", errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+	}
+	return proxy, presetName, nil
+}
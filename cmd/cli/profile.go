@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// parseProfileAttributes returns the attributes of the toxic flags, with the
+// latencies of the --profile file if set, the --attribute flags overriding
+// them, e.g. its step.
+func parseProfileAttributes(c *cli.Context) (toxiproxy.Attributes, error) {
+	attrs := toxiproxy.Attributes{}
+	if filename := c.String("profile"); filename != "" {
+		var err error
+		attrs, err = readProfile(filename)
+		if err != nil {
+			return nil, errorf("Failed to read %s: %s\n", filename, err)
+		}
+	}
+	for key, value := range parseAttributes(c, "attribute") {
+		attrs[key] = value
+	}
+	return attrs, nil
+}
+
+// parseModulation returns the waveforms of the --modulation file, if set.
+func parseModulation(c *cli.Context) (toxiproxy.Modulation, error) {
+	filename := c.String("modulation")
+	if filename == "" {
+		return nil, nil
+	}
+	modulation, err := readModulation(filename)
+	if err != nil {
+		return nil, errorf("Failed to read %s: %s\n", filename, err)
+	}
+	return modulation, nil
+}
+
+// readProfile reads the latencies of a profile toxic: a YAML or JSON file of
+// its attributes, or a CSV file with a header of
+//   - le_ms,count for the cumulative buckets of a histogram,
+//   - latency_ms for a series, its step given with --attribute,
+//   - time,latency_ms for a series, its step the one of the times in seconds.
+func readProfile(filename string) (toxiproxy.Attributes, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		attrs := toxiproxy.Attributes{}
+		err = yaml.Unmarshal(data, &attrs)
+		return attrs, err
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no measurements")
+	}
+	rows := make([][]float64, len(records)-1)
+	for i, record := range records[1:] {
+		for _, field := range record {
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+2, err)
+			}
+			rows[i] = append(rows[i], value)
+		}
+	}
+
+	profile := new(toxiproxy.ProfileToxic)
+	header := strings.ToLower(strings.ReplaceAll(strings.Join(records[0], ","), " ", ""))
+	switch header {
+	case "le_ms,count":
+		for _, row := range rows {
+			profile.Histogram = append(profile.Histogram, toxiproxy.DelayBucket{
+				LeMs:  row[0],
+				Count: int64(row[1]),
+			})
+		}
+	case "latency_ms":
+		for _, row := range rows {
+			profile.Series = append(profile.Series, row[0])
+		}
+	case "time,latency_ms":
+		for _, row := range rows {
+			profile.Series = append(profile.Series, row[1])
+		}
+		if len(rows) > 1 {
+			profile.Step = int64(math.Round((rows[1][0] - rows[0][0]) * 1000))
+		}
+	default:
+		return nil, fmt.Errorf(
+			"the header %q is not one of le_ms,count, latency_ms or time,latency_ms",
+			strings.Join(records[0], ","),
+		)
+	}
+	return toxiproxy.ToAttributes(profile)
+}
+
+// modulationFile is a YAML or JSON file of the waveforms of the attributes of
+// a toxic, the values of a custom wave read from a CSV file if set.
+type modulationFile map[string]struct {
+	toxiproxy.Waveform `yaml:",inline"`
+	CSV                string `yaml:"csv"`
+}
+
+// readModulation reads the waveforms of a toxic, none to stop them.
+func readModulation(filename string) (toxiproxy.Modulation, error) {
+	if filename == "none" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file modulationFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	modulation := toxiproxy.Modulation{}
+	for name, wave := range file {
+		if wave.CSV != "" {
+			path := wave.CSV
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			wave.Values, err = readWaveValues(path)
+			if err != nil {
+				return nil, err
+			}
+			if wave.Shape == "" {
+				wave.Shape = "custom"
+			}
+		}
+		modulation[name] = wave.Waveform
+	}
+	return modulation, nil
+}
+
+// readWaveValues reads the values of a custom wave, the last column of a CSV
+// file, skipping its header.
+func readWaveValues(filename string) ([]float64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var values []float64
+	for i, record := range records {
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-1]), 64)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d: %w", filename, i+1, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// scenarioReport is the result of a run of a scenario written by --report,
+// for a CI pipeline to keep or gate on.
+type scenarioReport struct {
+	File     string       `json:"file"`
+	Seed     int64        `json:"seed"`
+	Started  time.Time    `json:"started"`
+	Duration float64      `json:"duration"` // Seconds
+	Passed   bool         `json:"passed"`
+	Failed   int          `json:"failed"`
+	Steps    []reportStep `json:"steps"`
+	proxies  []string
+	start    time.Time
+}
+
+// reportStep is a step as it ran, and the counters observed on the proxies of
+// the scenario until the next step.
+type reportStep struct {
+	// Seconds since the start of the scenario
+	Planned     float64                `json:"planned"`
+	At          float64                `json:"at"`
+	Action      string                 `json:"action"`
+	Proxy       string                 `json:"proxy,omitempty"`
+	Toxic       string                 `json:"toxic,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Stream      string                 `json:"stream,omitempty"`
+	Toxicity    *float32               `json:"toxicity,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	Description string                 `json:"description"`
+	Error       string                 `json:"error,omitempty"`
+	Phase       reportPhase            `json:"phase"`
+	ran         time.Time
+}
+
+// reportPhase is the counters of the proxies at the end of the phase of a
+// step, once the next step is due or the scenario is over.
+type reportPhase struct {
+	Duration float64       `json:"duration"` // Seconds
+	Proxies  []reportProxy `json:"proxies"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type reportProxy struct {
+	Name    string               `json:"name"`
+	Enabled bool                 `json:"enabled"`
+	Stats   toxiproxy.ProxyStats `json:"stats"`
+	Toxics  []reportToxic        `json:"toxics"`
+}
+
+type reportToxic struct {
+	Name   string               `json:"name"`
+	Type   string               `json:"type"`
+	Stream string               `json:"stream"`
+	Stats  toxiproxy.ToxicStats `json:"stats"`
+}
+
+func newScenarioReport(filename string, seed int64, steps []scenarioStep) *scenarioReport {
+	r := &scenarioReport{File: filename, Seed: seed, Steps: []reportStep{}}
+	seen := map[string]bool{}
+	for _, step := range steps {
+		if step.Proxy != "" && !seen[step.Proxy] {
+			seen[step.Proxy] = true
+			r.proxies = append(r.proxies, step.Proxy)
+		}
+	}
+	sort.Strings(r.proxies)
+	return r
+}
+
+// begin marks the start of the scenario.
+func (r *scenarioReport) begin() {
+	r.start = time.Now()
+	r.Started = r.start.UTC()
+}
+
+// record adds a step once it ran, starting its phase.
+func (r *scenarioReport) record(step scenarioStep, ran time.Time, err error) {
+	s := reportStep{
+		Planned:     seconds(step.At),
+		At:          seconds(ran.Sub(r.start)),
+		Action:      step.Action,
+		Proxy:       step.Proxy,
+		Toxic:       step.Toxic,
+		Type:        step.Type,
+		Stream:      step.Stream,
+		Toxicity:    step.Toxicity,
+		Attributes:  step.Attributes,
+		Description: describeStep(step),
+		ran:         ran,
+	}
+	if err != nil {
+		s.Error = err.Error()
+		r.Failed++
+	}
+	r.Steps = append(r.Steps, s)
+}
+
+// observe ends the phase of the last step with the counters of the proxies of
+// the scenario.
+func (r *scenarioReport) observe(t *toxiproxy.Client) {
+	if len(r.Steps) == 0 {
+		return
+	}
+	step := &r.Steps[len(r.Steps)-1]
+	phase := &step.Phase
+	phase.Duration = seconds(time.Since(step.ran))
+	phase.Proxies = []reportProxy{}
+
+	proxies, err := t.Proxies()
+	if err != nil {
+		phase.Error = err.Error()
+		return
+	}
+	for _, name := range r.proxies {
+		proxy, ok := proxies[name]
+		if !ok {
+			continue
+		}
+		p := reportProxy{Name: name, Enabled: proxy.Enabled, Toxics: []reportToxic{}}
+		if proxy.Stats != nil {
+			p.Stats = *proxy.Stats
+		}
+		for _, toxic := range proxy.ActiveToxics {
+			x := reportToxic{Name: toxic.Name, Type: toxic.Type, Stream: toxic.Stream}
+			if toxic.Stats != nil {
+				x.Stats = *toxic.Stats
+			}
+			p.Toxics = append(p.Toxics, x)
+		}
+		phase.Proxies = append(phase.Proxies, p)
+	}
+}
+
+// finish sets the result of the scenario.
+func (r *scenarioReport) finish() {
+	r.Duration = seconds(time.Since(r.start))
+	r.Passed = r.Failed == 0
+}
+
+// reportFormat returns the format of a report, junit when it is not set and
+// the file ends in .xml, json otherwise.
+func reportFormat(filename, format string) (string, error) {
+	switch format {
+	case "json", "junit":
+		return format, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(filename), ".xml") {
+			return "junit", nil
+		}
+		return "json", nil
+	}
+	return "", fmt.Errorf("unknown report format %q, should be json or junit", format)
+}
+
+// write writes the report as JSON, or as JUnit XML for the junit format.
+func (r *scenarioReport) write(filename, format string) error {
+	var data []byte
+	var err error
+	if format == "junit" {
+		data, err = xml.MarshalIndent(r.junit(), "", "  ")
+		data = append([]byte(xml.Header), data...)
+	} else {
+		data, err = json.MarshalIndent(r, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644) // #nosec G306 -- read by CI jobs
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// junit returns the report as a test suite, a test case for each step with
+// the counters of its phase as its output.
+func (r *scenarioReport) junit() junitSuites {
+	suite := junitSuite{
+		Name:      r.File,
+		Tests:     len(r.Steps),
+		Failures:  r.Failed,
+		Time:      fmt.Sprintf("%.3f", r.Duration),
+		Timestamp: r.Started.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "seed", Value: fmt.Sprint(r.Seed)},
+		},
+	}
+	for _, step := range r.Steps {
+		c := junitCase{
+			Name:      fmt.Sprintf("+%.3fs %s", step.At, step.Description),
+			ClassName: r.File,
+			Time:      fmt.Sprintf("%.3f", step.Phase.Duration),
+			SystemOut: describePhase(step.Phase),
+		}
+		if step.Error != "" {
+			c.Failure = &junitFailure{Message: step.Error}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	return junitSuites{Suites: []junitSuite{suite}}
+}
+
+func describePhase(phase reportPhase) string {
+	if phase.Error != "" {
+		return "Failed to retrieve proxies: " + phase.Error
+	}
+	var lines []string
+	for _, proxy := range phase.Proxies {
+		lines = append(lines, fmt.Sprintf(
+			"%s enabled=%t connections=%d rejected_connections=%d "+
+				"upstream_bytes=%d downstream_bytes=%d",
+			proxy.Name, proxy.Enabled, proxy.Stats.Connections,
+			proxy.Stats.RejectedConnections, proxy.Stats.UpstreamBytes,
+			proxy.Stats.DownstreamBytes,
+		))
+		for _, toxic := range proxy.Toxics {
+			lines = append(lines, fmt.Sprintf(
+				"  %s activations=%d chunks=%d bytes=%d closes=%d",
+				toxic.Name, toxic.Stats.Activations, toxic.Stats.Chunks,
+				toxic.Stats.Bytes, toxic.Stats.Closes,
+			))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// seconds returns a duration in seconds, to the millisecond.
+func seconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// scenario is a timeline of changes to proxies and toxics, run by
+// `toxiproxy-cli scenario run`.
+type scenario struct {
+	Seed  *int64         `yaml:"seed"`
+	Steps []scenarioStep `yaml:"steps"`
+}
+
+// scenarioStep is a change made at a time since the start of the scenario,
+// delayed by a random duration up to jitter. An attribute given as a list of a
+// minimum and a maximum gets a random value in between.
+type scenarioStep struct {
+	At         time.Duration          `yaml:"at"`
+	Jitter     time.Duration          `yaml:"jitter"`
+	Action     string                 `yaml:"action"`
+	Proxy      string                 `yaml:"proxy"`
+	Toxic      string                 `yaml:"toxic"`
+	Type       string                 `yaml:"type"`
+	Stream     string                 `yaml:"stream"`
+	Toxicity   *float32               `yaml:"toxicity"`
+	Attributes map[string]interface{} `yaml:"attributes"`
+}
+
+var scenarioActions = map[string]func(*toxiproxy.Client, scenarioStep) error{
+	"add": func(t *toxiproxy.Client, step scenarioStep) error {
+		_, err := t.AddToxic(&toxiproxy.ToxicOptions{
+			ProxyName:  step.Proxy,
+			ToxicName:  step.Toxic,
+			ToxicType:  step.Type,
+			Stream:     step.Stream,
+			Toxicity:   *step.Toxicity,
+			Attributes: step.Attributes,
+		})
+		return err
+	},
+	"update": func(t *toxiproxy.Client, step scenarioStep) error {
+		toxicity := float32(-1)
+		if step.Toxicity != nil {
+			toxicity = *step.Toxicity
+		}
+		_, err := t.UpdateToxic(&toxiproxy.ToxicOptions{
+			ProxyName:  step.Proxy,
+			ToxicName:  step.Toxic,
+			Toxicity:   toxicity,
+			Attributes: step.Attributes,
+		})
+		return err
+	},
+	"remove": func(t *toxiproxy.Client, step scenarioStep) error {
+		return t.RemoveToxic(&toxiproxy.ToxicOptions{
+			ProxyName: step.Proxy,
+			ToxicName: step.Toxic,
+		})
+	},
+	"enable": func(t *toxiproxy.Client, step scenarioStep) error {
+		proxy, err := t.Proxy(step.Proxy)
+		if err != nil {
+			return err
+		}
+		return proxy.Enable()
+	},
+	"disable": func(t *toxiproxy.Client, step scenarioStep) error {
+		proxy, err := t.Proxy(step.Proxy)
+		if err != nil {
+			return err
+		}
+		return proxy.Disable()
+	},
+	"reset": func(t *toxiproxy.Client, step scenarioStep) error {
+		return t.ResetState()
+	},
+}
+
+func cliScenarioCommand() *cli.Command {
+	return &cli.Command{
+		Name: "scenario",
+		Usage: "\trun a timeline of changes to proxies and toxics\n" +
+			"\t\tusage: 'toxiproxy-cli scenario run [--seed <int>] [--report <file>] timeline.yaml'\n",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "run",
+				Usage:     "run the steps of a timeline file, exits with 1 if any step fails",
+				ArgsUsage: "<timeline.yaml>",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "seed",
+						Usage: "seed of the random jitter and attributes, instead of the one of the file",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Usage: "file to write a report of the steps and the counters observed after each",
+					},
+					&cli.StringFlag{
+						Name:  "report-format",
+						Usage: "json or junit, junit if not set and the report file ends in .xml",
+					},
+				},
+				Action: withToxi(runScenario),
+			},
+		},
+	}
+}
+
+func runScenario(c *cli.Context, t *toxiproxy.Client) error {
+	filename := c.Args().First()
+	if filename == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Timeline file is required as the first argument.\n")
+	}
+
+	s, err := readScenario(filename)
+	if err != nil {
+		return errorf("Failed to read %s: %s\n", filename, err)
+	}
+
+	format, err := reportFormat(c.String("report"), c.String("report-format"))
+	if err != nil {
+		return errorf("%s\n", err)
+	}
+
+	seed := time.Now().UnixNano()
+	if s.Seed != nil {
+		seed = *s.Seed
+	}
+	if c.IsSet("seed") {
+		seed = c.Int64("seed")
+	}
+	steps := s.plan(rand.New(rand.NewSource(seed))) // #nosec G404
+
+	fmt.Printf("Running %d steps of %s with seed %d\n", len(steps), filename, seed)
+	report := newScenarioReport(filename, seed, steps)
+	report.begin()
+	for _, step := range steps {
+		time.Sleep(time.Until(report.start.Add(step.At)))
+		report.observe(t)
+
+		ran := time.Now()
+		err := scenarioActions[step.Action](t, step)
+		report.record(step, ran, err)
+		elapsed := ran.Sub(report.start).Seconds()
+		if err != nil {
+			fmt.Printf("%s+%.3fs %s: %s%s\n",
+				color(RED), elapsed, describeStep(step), err, color(NONE))
+			continue
+		}
+		fmt.Printf("%s+%.3fs%s %s\n", color(GREEN), elapsed, color(NONE), describeStep(step))
+	}
+
+	report.observe(t)
+	report.finish()
+
+	if filename := c.String("report"); filename != "" {
+		err := report.write(filename, format)
+		if err != nil {
+			return errorf("Failed to write report %s: %s\n", filename, err)
+		}
+	}
+
+	if report.Failed > 0 {
+		return errorf("%d of %d steps failed\n", report.Failed, len(steps))
+	}
+	return nil
+}
+
+func readScenario(filename string) (*scenario, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scenario{}
+	err = yaml.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if _, ok := scenarioActions[step.Action]; !ok {
+			return nil, fmt.Errorf("step %d has an unknown action %q, "+
+				"should be add, update, remove, enable, disable or reset", i+1, step.Action)
+		}
+		if step.Proxy == "" && step.Action != "reset" {
+			return nil, fmt.Errorf("step %d must have a proxy", i+1)
+		}
+		if step.Toxic == "" && (step.Action == "update" || step.Action == "remove") {
+			return nil, fmt.Errorf("step %d must have a toxic", i+1)
+		}
+		if step.Type == "" && step.Action == "add" {
+			return nil, fmt.Errorf("step %d must have a type", i+1)
+		}
+		if step.At < 0 || step.Jitter < 0 {
+			return nil, fmt.Errorf("step %d can not have a negative time", i+1)
+		}
+
+		if step.Action == "add" {
+			if step.Stream == "" {
+				step.Stream = "downstream"
+			}
+			if step.Toxic == "" {
+				step.Toxic = step.Type + "_" + step.Stream
+			}
+			if step.Toxicity == nil {
+				toxicity := float32(1)
+				step.Toxicity = &toxicity
+			}
+		}
+	}
+	return s, nil
+}
+
+// plan picks the random times and attributes of the steps, and returns them
+// in the order they run.
+func (s *scenario) plan(r *rand.Rand) []scenarioStep {
+	steps := make([]scenarioStep, len(s.Steps))
+	for i, step := range s.Steps {
+		if step.Jitter > 0 {
+			step.At += time.Duration(r.Int63n(int64(step.Jitter)))
+		}
+		if step.Attributes != nil {
+			attributes := make(map[string]interface{}, len(step.Attributes))
+			for _, a := range sortedAttributes(step.Attributes) {
+				attributes[a.key] = randomAttribute(r, a.value)
+			}
+			step.Attributes = attributes
+		}
+		steps[i] = step
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].At < steps[j].At
+	})
+	return steps
+}
+
+// randomAttribute picks an integer within [min, max] for an attribute given
+// as a range, or a float when either bound is one.
+func randomAttribute(r *rand.Rand, value interface{}) interface{} {
+	bounds, ok := value.([]interface{})
+	if !ok || len(bounds) != 2 {
+		return value
+	}
+	low, lowInt := bounds[0].(int)
+	high, highInt := bounds[1].(int)
+	if lowInt && highInt && low <= high {
+		return low + r.Intn(high-low+1)
+	}
+
+	lowFloat, ok1 := toFloat(bounds[0]).(float64)
+	highFloat, ok2 := toFloat(bounds[1]).(float64)
+	if !ok1 || !ok2 {
+		return value
+	}
+	return lowFloat + r.Float64()*(highFloat-lowFloat)
+}
+
+func describeStep(step scenarioStep) string {
+	switch step.Action {
+	case "add":
+		return fmt.Sprintf("add toxic %s on %s (%s)", step.Toxic, step.Proxy,
+			describeStateToxic(stateToxic{
+				Type:       step.Type,
+				Stream:     step.Stream,
+				Toxicity:   step.Toxicity,
+				Attributes: step.Attributes,
+			}))
+	case "update":
+		description := fmt.Sprintf("update toxic %s on %s", step.Toxic, step.Proxy)
+		if step.Toxicity != nil {
+			description += fmt.Sprintf(" toxicity=%.2f", *step.Toxicity)
+		}
+		for _, a := range sortedAttributes(step.Attributes) {
+			description += fmt.Sprintf(" %s=%v", a.key, a.value)
+		}
+		return description
+	case "remove":
+		return fmt.Sprintf("remove toxic %s on %s", step.Toxic, step.Proxy)
+	case "reset":
+		return "reset all proxies"
+	}
+	return step.Action + " proxy " + step.Proxy
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	terminal "golang.org/x/term"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+const (
+	REVERSE     = "\x1b[7m"
+	clearScreen = "\x1b[H\x1b[2J"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+)
+
+var topHelp = "↑/↓ select proxy  space toggle proxy  tab select toxic  " +
+	"←/→ select field  +/- change field  q quit"
+
+func cliTopCommand() *cli.Command {
+	return &cli.Command{
+		Name: "top",
+		Usage: "\tinteractive dashboard of proxies, connections and toxics\n" +
+			"\t\tusage: 'toxiproxy-cli top'\n",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:    "interval",
+				Aliases: []string{"n"},
+				Value:   time.Second,
+				Usage:   "time between two refreshes",
+			},
+		},
+		Action: withToxi(top),
+	}
+}
+
+// topState is the dashboard shown by `toxiproxy-cli top`. The selected field
+// of a toxic is its toxicity (0) or one of its sorted attributes (1 and up).
+type topState struct {
+	client   *toxiproxy.Client
+	proxies  []*toxiproxy.Proxy
+	previous map[string]toxiproxy.ProxyStats
+	rates    map[string][2]float64 // Upstream and downstream bytes per second.
+	polled   time.Time
+	proxy    int
+	toxic    int
+	field    int
+	message  string
+}
+
+func top(c *cli.Context, t *toxiproxy.Client) error {
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return errorf("interval should be positive.\n")
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !isTTY || !terminal.IsTerminal(stdin) {
+		return errorf("top requires an interactive terminal.\n")
+	}
+
+	previous, err := terminal.MakeRaw(stdin)
+	if err != nil {
+		return errorf("Failed to set up the terminal: %s\n", err)
+	}
+	defer terminal.Restore(stdin, previous)
+	fmt.Print(hideCursor)
+	defer fmt.Print(clearScreen + showCursor)
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	s := &topState{
+		client:   t,
+		previous: map[string]toxiproxy.ProxyStats{},
+		rates:    map[string][2]float64{},
+	}
+	s.poll()
+	s.render()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.poll()
+		case key, ok := <-keys:
+			if !ok || key == "q" || key == "\x03" {
+				return nil
+			}
+			if s.handle(key) {
+				s.poll()
+			}
+		}
+		s.render()
+	}
+}
+
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- string(buf[:n])
+	}
+}
+
+func (s *topState) poll() {
+	proxies, err := s.client.Proxies()
+	if err != nil {
+		s.message = fmt.Sprintf("Failed to retrieve proxies: %s", err)
+		return
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(s.polled).Seconds()
+	s.proxies = s.proxies[:0]
+	for _, proxy := range proxies {
+		s.proxies = append(s.proxies, proxy)
+		if proxy.Stats == nil {
+			continue
+		}
+		if previous, ok := s.previous[proxy.Name]; ok && elapsed > 0 {
+			s.rates[proxy.Name] = [2]float64{
+				float64(proxy.Stats.UpstreamBytes-previous.UpstreamBytes) / elapsed,
+				float64(proxy.Stats.DownstreamBytes-previous.DownstreamBytes) / elapsed,
+			}
+		}
+		s.previous[proxy.Name] = *proxy.Stats
+	}
+	sort.Slice(s.proxies, func(i, j int) bool {
+		return s.proxies[i].Name < s.proxies[j].Name
+	})
+	s.polled = now
+
+	s.proxy = clamp(s.proxy, len(s.proxies))
+	if proxy := s.selectedProxy(); proxy != nil {
+		s.toxic = clamp(s.toxic, len(proxy.ActiveToxics))
+	}
+	if toxic := s.selectedToxic(); toxic != nil {
+		s.field = clamp(s.field, len(toxic.Attributes)+1)
+	}
+}
+
+// handle applies a key press, and returns whether the server was changed.
+func (s *topState) handle(key string) bool {
+	switch key {
+	case "\x1b[A", "k":
+		s.proxy = clamp(s.proxy-1, len(s.proxies))
+		s.toxic, s.field = 0, 0
+	case "\x1b[B", "j":
+		s.proxy = clamp(s.proxy+1, len(s.proxies))
+		s.toxic, s.field = 0, 0
+	case "\t":
+		if proxy := s.selectedProxy(); proxy != nil && len(proxy.ActiveToxics) > 0 {
+			s.toxic = (s.toxic + 1) % len(proxy.ActiveToxics)
+			s.field = 0
+		}
+	case "\x1b[D", "h":
+		if toxic := s.selectedToxic(); toxic != nil {
+			s.field = clamp(s.field-1, len(toxic.Attributes)+1)
+		}
+	case "\x1b[C", "l":
+		if toxic := s.selectedToxic(); toxic != nil {
+			s.field = clamp(s.field+1, len(toxic.Attributes)+1)
+		}
+	case " ", "e":
+		return s.toggleProxy()
+	case "+", "=":
+		return s.changeField(1)
+	case "-", "_":
+		return s.changeField(-1)
+	}
+	return false
+}
+
+func (s *topState) toggleProxy() bool {
+	proxy := s.selectedProxy()
+	if proxy == nil {
+		return false
+	}
+
+	proxy.Enabled = !proxy.Enabled
+	err := proxy.Save()
+	if err != nil {
+		s.message = fmt.Sprintf("Failed to toggle proxy %s: %s", proxy.Name, err)
+		return false
+	}
+	s.message = fmt.Sprintf("Proxy %s is now %s", proxy.Name, enabledText(proxy.Enabled))
+	return true
+}
+
+// changeField steps the toxicity by 0.1, or a numeric attribute by 10% of its
+// value (at least 1), in the given direction.
+func (s *topState) changeField(direction float64) bool {
+	proxy := s.selectedProxy()
+	toxic := s.selectedToxic()
+	if toxic == nil {
+		return false
+	}
+
+	toxicity := float32(-1)
+	attributes := toxiproxy.Attributes{}
+	if s.field == 0 {
+		toxicity = float32(math.Max(0, math.Min(1, float64(toxic.Toxicity)+direction*0.1)))
+	} else {
+		attr := sortedAttributes(toxic.Attributes)[s.field-1]
+		value, ok := attr.value.(float64)
+		if !ok {
+			s.message = fmt.Sprintf("Attribute %s is not a number", attr.key)
+			return false
+		}
+		step := math.Max(1, math.Round(math.Abs(value)*0.1))
+		attributes[attr.key] = math.Max(0, value+direction*step)
+	}
+
+	_, err := proxy.UpdateToxic(toxic.Name, toxicity, attributes)
+	if err != nil {
+		s.message = fmt.Sprintf("Failed to update toxic %s: %s", toxic.Name, err)
+		return false
+	}
+	s.message = fmt.Sprintf("Updated toxic %s on proxy %s", toxic.Name, proxy.Name)
+	return true
+}
+
+func (s *topState) selectedProxy() *toxiproxy.Proxy {
+	if s.proxy >= len(s.proxies) {
+		return nil
+	}
+	return s.proxies[s.proxy]
+}
+
+func (s *topState) selectedToxic() *toxiproxy.Toxic {
+	proxy := s.selectedProxy()
+	if proxy == nil || s.toxic >= len(proxy.ActiveToxics) {
+		return nil
+	}
+	return &proxy.ActiveToxics[s.toxic]
+}
+
+func (s *topState) render() {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString(color(NONE) + "\r\n")
+	}
+
+	b.WriteString(clearScreen)
+	line("toxiproxy-cli top - %s - %s", hostname, s.polled.Format("15:04:05"))
+	line("")
+	line("%s  %-20s %-8s %-21s %-21s %6s %10s %10s %6s", color(GREEN),
+		"Name", "Enabled", "Listen", "Upstream", "Conns", "Up/s", "Down/s", "Toxics")
+	if len(s.proxies) == 0 {
+		line("%s  no proxies", color(RED))
+	}
+	for i, proxy := range s.proxies {
+		cursor := " "
+		if i == s.proxy {
+			cursor = ">"
+		}
+		var connections int64
+		if proxy.Stats != nil {
+			connections = proxy.Stats.Connections
+		}
+		rates := s.rates[proxy.Name]
+		line("%s %s%-20s %-8s%s %-21s %-21s %6d %10s %10s %6d",
+			cursor,
+			colorEnabled(proxy.Enabled), proxy.Name, enabledText(proxy.Enabled), color(NONE),
+			proxy.Listen, proxy.Upstream, connections,
+			formatRate(rates[0]), formatRate(rates[1]), len(proxy.ActiveToxics))
+	}
+
+	if proxy := s.selectedProxy(); proxy != nil {
+		line("")
+		line("%sToxics of %s:", color(GREEN), proxy.Name)
+		if len(proxy.ActiveToxics) == 0 {
+			line("%s  no toxics", color(RED))
+		}
+		for i, toxic := range proxy.ActiveToxics {
+			line("%s", s.renderToxic(toxic, i == s.toxic))
+		}
+	}
+
+	line("")
+	line("%s", s.message)
+	line("%s", topHelp)
+	fmt.Print(b.String())
+}
+
+func (s *topState) renderToxic(toxic toxiproxy.Toxic, selected bool) string {
+	field := func(i int, text string) string {
+		if selected && i == s.field {
+			return color(REVERSE) + text + color(NONE)
+		}
+		return text
+	}
+
+	cursor := " "
+	if selected {
+		cursor = ">"
+	}
+	text := fmt.Sprintf("%s %s%s%s  %s %s  ",
+		cursor, color(BLUE), toxic.Name, color(NONE), toxic.Type, toxic.Stream)
+	text += field(0, fmt.Sprintf("toxicity=%.2f", toxic.Toxicity))
+	for i, a := range sortedAttributes(toxic.Attributes) {
+		text += "  " + field(i+1, fmt.Sprintf("%s=%v", a.key, a.value))
+	}
+	return text
+}
+
+func formatRate(bytesPerSecond float64) string {
+	switch {
+	case bytesPerSecond >= 1<<20:
+		return fmt.Sprintf("%.1fMB", bytesPerSecond/(1<<20))
+	case bytesPerSecond >= 1<<10:
+		return fmt.Sprintf("%.1fKB", bytesPerSecond/(1<<10))
+	default:
+		return fmt.Sprintf("%.0fB", bytesPerSecond)
+	}
+}
+
+// clamp keeps an index within [0, length).
+func clamp(index, length int) int {
+	if index >= length {
+		index = length - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	return index
+}
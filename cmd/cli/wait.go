@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliWaitCommand() *cli.Command {
+	return &cli.Command{
+		Name: "wait",
+		Usage: "\twait until the counters of a proxy meet conditions\n" +
+			"\t\tusage: 'toxiproxy-cli wait --condition connections==0 <proxyName>'\n",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "condition",
+				Aliases: []string{"c"},
+				Usage: "comparison of a counter of the proxy, e.g. connections==0 or " +
+					"downstream_bytes>=1024, all of them met",
+			},
+			&cli.DurationFlag{
+				Name:    "timeout",
+				Aliases: []string{"t"},
+				Value:   30 * time.Second,
+				Usage:   "time to wait before failing, up to 5m",
+			},
+		},
+		Action:       withToxi(waitProxy),
+		BashComplete: completeWith(nil, completeProxies),
+	}
+}
+
+func waitProxy(c *cli.Context, t *toxiproxy.Client) error {
+	proxyName := c.Args().First()
+	if proxyName == "" {
+		cli.ShowSubcommandHelp(c)
+		return errorf("Proxy name is required as the first argument.\n")
+	}
+	conditions := c.StringSlice("condition")
+	if len(conditions) == 0 {
+		return errorf("At least one --condition is required.\n")
+	}
+
+	proxy, err := t.Proxy(proxyName)
+	if err != nil {
+		return errorf("Failed to retrieve proxy %s: %s\n", proxyName, err)
+	}
+	start := time.Now()
+	stats, err := proxy.Wait(c.Duration("timeout"), conditions...)
+	if err != nil {
+		return errorf("Failed to wait for proxy %s: %s\n", proxyName, err)
+	}
+
+	fmt.Printf("Proxy '%s' met the conditions after %.3fs with %d connections\n",
+		proxyName, time.Since(start).Seconds(), stats.Connections)
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	toxiproxyServer "github.com/Shopify/toxiproxy/v2"
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func cliWatchCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "watch",
+		Aliases: []string{"w"},
+		Usage: "\twatch changes to proxies, toxics and connections\n" +
+			"\t\tusage: 'toxiproxy-cli watch [proxyName]'\n",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:    "interval",
+				Aliases: []string{"n"},
+				Value:   time.Second,
+				Usage:   "time between two polls of the server",
+			},
+		},
+		Action:       withToxi(watch),
+		BashComplete: completeWith(nil, completeProxies),
+	}
+}
+
+// watcher polls the server and prints what changed since the previous poll.
+// Connections are counted from the events kept by the server, so connections
+// opened before its oldest event are not counted.
+type watcher struct {
+	proxyName   string
+	proxies     map[string]*toxiproxy.Proxy
+	lastEvent   uint64
+	connections map[string]map[string]int // Open links by client, by proxy.
+}
+
+func watch(c *cli.Context, t *toxiproxy.Client) error {
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return errorf("interval should be positive.\n")
+	}
+
+	w := &watcher{
+		proxyName:   c.Args().First(),
+		proxies:     map[string]*toxiproxy.Proxy{},
+		connections: map[string]map[string]int{},
+	}
+
+	err := w.poll(t, true)
+	if err != nil {
+		return errorf("Failed to watch proxies: %s\n", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := w.poll(t, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sFailed to poll toxiproxy: %s%s\n",
+				color(RED), err, color(NONE))
+		}
+	}
+	return nil
+}
+
+// poll fetches the proxies and new events. The first poll prints the current
+// state instead of changes.
+func (w *watcher) poll(t *toxiproxy.Client, initial bool) error {
+	proxies, err := t.Proxies()
+	if err != nil {
+		return err
+	}
+	if w.proxyName != "" {
+		filtered := map[string]*toxiproxy.Proxy{}
+		if proxy, ok := proxies[w.proxyName]; ok {
+			filtered[w.proxyName] = proxy
+		}
+		proxies = filtered
+	}
+
+	events, err := t.EventsSince(w.proxyName, w.lastEvent)
+	if err != nil {
+		return err
+	}
+
+	if initial {
+		for _, event := range events {
+			w.countConnections(event)
+		}
+		w.printState(proxies)
+	} else {
+		w.printProxyChanges(proxies)
+		for _, event := range events {
+			w.countConnections(event)
+			w.printEvent(event)
+		}
+	}
+
+	if len(events) > 0 {
+		w.lastEvent = events[len(events)-1].ID
+	}
+	w.proxies = proxies
+	return nil
+}
+
+// countConnections follows the open connections of each proxy. A connection
+// is accepted with its two links, and is closed once both links are.
+func (w *watcher) countConnections(event toxiproxy.Event) {
+	switch event.Type {
+	case toxiproxyServer.EventAccepted:
+		if w.connections[event.Proxy] == nil {
+			w.connections[event.Proxy] = map[string]int{}
+		}
+		w.connections[event.Proxy][event.Client] = 2
+	case toxiproxyServer.EventLinkClosed:
+		clients := w.connections[event.Proxy]
+		if _, ok := clients[event.Client]; !ok {
+			return
+		}
+		clients[event.Client]--
+		if clients[event.Client] <= 0 {
+			delete(clients, event.Client)
+		}
+	case toxiproxyServer.EventDialFailed:
+		delete(w.connections[event.Proxy], event.Client)
+	}
+}
+
+func (w *watcher) printState(proxies map[string]*toxiproxy.Proxy) {
+	for _, name := range sortedProxyNames(proxies) {
+		proxy := proxies[name]
+		watchLine(time.Now(), colorEnabled(proxy.Enabled), name,
+			"%s, listen %s, upstream %s, %d toxics, %d connections",
+			enabledText(proxy.Enabled),
+			proxy.Listen,
+			proxy.Upstream,
+			len(proxy.ActiveToxics),
+			len(w.connections[name]),
+		)
+	}
+	if len(proxies) == 0 {
+		watchLine(time.Now(), RED, "", "no proxies")
+	}
+}
+
+func (w *watcher) printProxyChanges(proxies map[string]*toxiproxy.Proxy) {
+	now := time.Now()
+
+	for _, name := range sortedProxyNames(w.proxies) {
+		if _, ok := proxies[name]; !ok {
+			watchLine(now, RED, name, "deleted")
+			delete(w.connections, name)
+		}
+	}
+
+	for _, name := range sortedProxyNames(proxies) {
+		proxy := proxies[name]
+		previous, ok := w.proxies[name]
+		if !ok {
+			watchLine(now, GREEN, name, "created, listen %s, upstream %s, %s",
+				proxy.Listen, proxy.Upstream, enabledText(proxy.Enabled))
+			previous = &toxiproxy.Proxy{Enabled: proxy.Enabled}
+		} else {
+			if previous.Listen != proxy.Listen {
+				watchLine(now, YELLOW, name, "listen %s -> %s", previous.Listen, proxy.Listen)
+			}
+			if previous.Upstream != proxy.Upstream {
+				watchLine(now, YELLOW, name, "upstream %s -> %s", previous.Upstream, proxy.Upstream)
+			}
+			if previous.Enabled != proxy.Enabled {
+				watchLine(now, colorEnabled(proxy.Enabled), name, "%s", enabledText(proxy.Enabled))
+			}
+		}
+		printToxicChanges(now, name, previous.ActiveToxics, proxy.ActiveToxics)
+	}
+}
+
+func printToxicChanges(now time.Time, proxyName string, previous, current toxiproxy.Toxics) {
+	byName := func(toxics toxiproxy.Toxics) map[string]toxiproxy.Toxic {
+		result := make(map[string]toxiproxy.Toxic, len(toxics))
+		for _, toxic := range toxics {
+			result[toxic.Name] = toxic
+		}
+		return result
+	}
+	before := byName(previous)
+	after := byName(current)
+
+	for _, toxic := range previous {
+		if _, ok := after[toxic.Name]; !ok {
+			watchLine(now, RED, proxyName, "toxic %s removed", toxic.Name)
+		}
+	}
+	for _, toxic := range current {
+		old, ok := before[toxic.Name]
+		switch {
+		case !ok:
+			watchLine(now, GREEN, proxyName, "toxic %s added, %s", toxic.Name, describeToxic(toxic))
+		case old.Type != toxic.Type || old.Stream != toxic.Stream ||
+			old.Toxicity != toxic.Toxicity || !reflect.DeepEqual(old.Attributes, toxic.Attributes):
+			watchLine(now, YELLOW, proxyName, "toxic %s updated, %s", toxic.Name, describeToxic(toxic))
+		}
+	}
+}
+
+func (w *watcher) printEvent(event toxiproxy.Event) {
+	connections := len(w.connections[event.Proxy])
+	switch event.Type {
+	case toxiproxyServer.EventAccepted:
+		watchLine(event.Time, BLUE, event.Proxy, "accepted %s, %d connections",
+			event.Client, connections)
+	case toxiproxyServer.EventLinkClosed:
+		watchLine(event.Time, BLUE, event.Proxy,
+			"closed %s %s after %d bytes (%s), %d connections",
+			event.Direction, event.Client, event.Bytes, event.Reason, connections)
+	case toxiproxyServer.EventDialFailed:
+		watchLine(event.Time, RED, event.Proxy, "failed to dial %s for %s: %s",
+			event.Upstream, event.Client, event.Reason)
+	case toxiproxyServer.EventAcceptFailed, toxiproxyServer.EventListenFailed:
+		watchLine(event.Time, RED, event.Proxy, "%s: %s", event.Type, event.Reason)
+	}
+}
+
+func describeToxic(toxic toxiproxy.Toxic) string {
+	description := fmt.Sprintf(
+		"type=%s stream=%s toxicity=%.2f",
+		toxic.Type,
+		toxic.Stream,
+		toxic.Toxicity,
+	)
+	for _, a := range sortedAttributes(toxic.Attributes) {
+		description += fmt.Sprintf(" %s=%v", a.key, a.value)
+	}
+	return description
+}
+
+func watchLine(at time.Time, col, proxyName, format string, args ...interface{}) {
+	fmt.Printf("%s%s  ", color(NONE), at.Local().Format("15:04:05"))
+	if proxyName != "" {
+		fmt.Printf("%s%s%s  ", color(PURPLE), proxyName, color(NONE))
+	}
+	fmt.Printf("%s%s%s\n", color(col), fmt.Sprintf(format, args...), color(NONE))
+}
+
+func sortedProxyNames(proxies map[string]*toxiproxy.Proxy) []string {
+	names := make([]string, 0, len(proxies))
+	for name := range proxies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+// notifier tells the supervisor of the server when it is ready: started by
+// systemd with Type=notify, or by a wrapper waiting for a line on a file
+// descriptor or for a file to exist.
+type notifier struct {
+	fd        int    // Written a READY=1 line once ready, if not 0
+	readyFile string // Created with the pid once ready, if set
+	socket    string // The sd_notify socket of systemd, if set
+}
+
+// newNotifier notifies the file descriptor and the ready file of the
+// arguments, and the socket systemd gives in NOTIFY_SOCKET.
+func newNotifier(cli cliArguments) notifier {
+	return notifier{
+		fd:        cli.notifyFd,
+		readyFile: cli.readyFile,
+		socket:    os.Getenv("NOTIFY_SOCKET"),
+	}
+}
+
+// notifyWhenReady notifies the supervisor once the server is ready, or tells
+// systemd why it is not.
+func (n notifier) notifyWhenReady(ctx context.Context, server *toxiproxy.ApiServer) {
+	logger := server.Logger
+	err := server.WaitReady(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Err(err).Msg("Server not ready, not notifying")
+		n.sdNotify(logger, "STATUS=Not ready: "+err.Error())
+		return
+	}
+
+	n.sdNotify(logger, "READY=1")
+	if n.fd != 0 {
+		file := os.NewFile(uintptr(n.fd), "notify-fd")
+		_, err := file.WriteString("READY=1\n")
+		if err != nil {
+			logger.Err(err).Int("fd", n.fd).Msg("Failed to notify readiness")
+		}
+		// The supervisor sees the end of the file, unless it is the output.
+		if n.fd > 2 {
+			file.Close()
+		}
+	}
+	if n.readyFile != "" {
+		err := writeReadyFile(n.readyFile)
+		if err != nil {
+			logger.Err(err).Str("ready_file", n.readyFile).Msg("Failed to write the ready file")
+		}
+	}
+	logger.Info().Msg("Server ready")
+}
+
+// stopping tells systemd the server is stopping, and removes the ready file.
+func (n notifier) stopping(logger *zerolog.Logger) {
+	n.sdNotify(logger, "STOPPING=1")
+	if n.readyFile != "" {
+		err := os.Remove(n.readyFile)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Err(err).Str("ready_file", n.readyFile).Msg("Failed to remove the ready file")
+		}
+	}
+}
+
+// sdNotify sends a state to systemd, as sd_notify(3) does.
+func (n notifier) sdNotify(logger *zerolog.Logger, state string) {
+	if n.socket == "" {
+		return
+	}
+	addr := &net.UnixAddr{Name: n.socket, Net: "unixgram"}
+	if strings.HasPrefix(n.socket, "@") {
+		addr.Name = "\x00" + n.socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		conn.Close()
+	}
+	if err != nil {
+		logger.Err(err).Str("state", state).Msg("Failed to notify systemd")
+	}
+}
+
+// writeReadyFile writes the pid of the server to a file, renaming it in place
+// so that a wrapper never reads it partially written.
+func writeReadyFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".toxiproxy-ready-*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(file, strconv.Itoa(os.Getpid()))
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
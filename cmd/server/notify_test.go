@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+// listenNotify listens for the states sent to a sd_notify socket.
+func listenNotify(t *testing.T, name string) *net.UnixConn {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatal("Failed to listen for notifications:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readState(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal("Failed to read the notified state:", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifyWhenReady(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "notify")
+	conn := listenNotify(t, socket)
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := toxiproxy.New(toxiproxy.WithLogger(zerolog.Nop()), toxiproxy.WithListener(listener))
+	defer server.Shutdown()
+	go server.Listen("")
+
+	readyFile := filepath.Join(dir, "ready")
+	notifier := newNotifier(cliArguments{readyFile: readyFile})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notifier.notifyWhenReady(ctx, server)
+
+	if state := readState(t, conn); state != "READY=1" {
+		t.Errorf("Expected READY=1 to be notified, got %q", state)
+	}
+	pid, err := os.ReadFile(readyFile)
+	if err != nil || strings.TrimSpace(string(pid)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("Expected the ready file to hold the pid, got %q %v", pid, err)
+	}
+
+	notifier.stopping(server.Logger)
+	if state := readState(t, conn); state != "STOPPING=1" {
+		t.Errorf("Expected STOPPING=1 to be notified, got %q", state)
+	}
+	if _, err := os.Stat(readyFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the ready file to be removed, got %v", err)
+	}
+}
+
+func TestSdNotifyAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are only supported on Linux")
+	}
+	name := fmt.Sprintf("@toxiproxy-notify-%d-%d", os.Getpid(), time.Now().UnixNano())
+	conn := listenNotify(t, "\x00"+name[1:])
+
+	var output bytes.Buffer
+	logger := zerolog.New(&output)
+	notifier{socket: name}.sdNotify(&logger, "READY=1")
+
+	if state := readState(t, conn); state != "READY=1" {
+		t.Errorf("Expected READY=1 to be notified, got %q", state)
+	}
+	if output.Len() != 0 {
+		t.Errorf("Expected no error to be logged, got %s", output.String())
+	}
+}
+
+func TestSdNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	var output bytes.Buffer
+	logger := zerolog.New(&output)
+	newNotifier(cliArguments{}).sdNotify(&logger, "READY=1")
+	if output.Len() != 0 {
+		t.Errorf("Expected nothing to be notified without a socket, got %s", output.String())
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	notifier{socket: missing}.sdNotify(&logger, "READY=1")
+	if !strings.Contains(output.String(), "Failed to notify systemd") {
+		t.Errorf("Expected the missing socket to be logged, got %s", output.String())
+	}
+}
@@ -1,19 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"math/rand"
 	"net"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"github.com/Shopify/toxiproxy/v2"
 	"github.com/Shopify/toxiproxy/v2/collectors"
@@ -22,11 +31,29 @@ import (
 type cliArguments struct {
 	host           string
 	port           string
+	socket         string
 	config         string
 	seed           int64
 	printVersion   bool
 	proxyMetrics   bool
 	runtimeMetrics bool
+	tracing        bool
+	debug          bool
+	ui             bool
+	strict         bool
+	events         int
+	maxConnections int
+	apiRateLimit   float64
+	apiRateBurst   int
+	apiMaxBody     int64
+	corsOrigins    string
+	portPool       string
+	tokens         string
+	chaos          string
+	statsd         toxiproxy.StatsdConfig
+	statsdTags     string
+	notifyFd       int
+	readyFile      string
 }
 
 func parseArguments() cliArguments {
@@ -35,18 +62,70 @@ func parseArguments() cliArguments {
 		"Host for toxiproxy's API to listen on")
 	flag.StringVar(&result.port, "port", "8474",
 		"Port for toxiproxy's API to listen on")
+	flag.StringVar(&result.socket, "socket", "",
+		"unix socket for toxiproxy's API to listen on instead of -host and -port, "+
+			"or @name for an abstract socket on Linux")
 	flag.StringVar(&result.config, "config", "",
 		"JSON file containing proxies to create on startup")
 	flag.Int64Var(&result.seed, "seed", time.Now().UTC().UnixNano(),
-		"Seed for randomizing toxics with")
+		"Seed of the toxics added without one, to replay their random values")
 	flag.BoolVar(&result.runtimeMetrics, "runtime-metrics", false,
 		`enable runtime-related prometheus metrics (default "false")`)
 	flag.BoolVar(&result.proxyMetrics, "proxy-metrics", false,
 		`enable toxiproxy-specific prometheus metrics (default "false")`)
+	flag.BoolVar(&result.tracing, "tracing", false,
+		`export OpenTelemetry traces via OTLP, configured with OTEL_EXPORTER_OTLP_* `+
+			`environment variables (default "false")`)
+	flag.BoolVar(&result.debug, "debug", false,
+		`expose pprof and the server's internal state under /debug (default "false")`)
+	flag.BoolVar(&result.ui, "ui", false,
+		`serve a web UI of the proxies, their toxics and the events under /ui (default "false")`)
+	flag.BoolVar(&result.strict, "strict", false,
+		`reject the unknown fields of the API requests and the config files (default "false")`)
+	flag.IntVar(&result.maxConnections, "max-connections", 0,
+		"largest number of clients connected to all the proxies at once (default no limit)")
+	flag.Float64Var(&result.apiRateLimit, "api-rate-limit", 0,
+		"API requests per second of each client (default no limit)")
+	flag.IntVar(&result.apiRateBurst, "api-rate-burst", 0,
+		"API requests of a client in a burst over the rate limit (default a second of requests)")
+	flag.Int64Var(&result.apiMaxBody, "api-max-body-size", 0,
+		"largest body of an API request in bytes (default no limit)")
+	flag.StringVar(&result.corsOrigins, "cors-origins", "",
+		`origins separated by commas whose browsers can use the API, e.g. `+
+			`http://localhost:3000, or "*" for all of them (default no browser)`)
+	flag.StringVar(&result.portPool, "port-pool", "",
+		`range of ports the proxies listening on "0" are given a free port of, `+
+			`e.g. localhost:20000-20099 (default an ephemeral port of localhost)`)
+	flag.StringVar(&result.tokens, "namespace-tokens", "",
+		`JSON file of the bearer token of each namespace, e.g. {"team-a": "secret"}, `+
+			"restricting the namespaces to the requests with their token")
+	flag.StringVar(&result.chaos, "chaos", "",
+		"JSON file of a chaos config, adding random toxics to the proxies from startup")
+	flag.IntVar(&result.events, "events", toxiproxy.DefaultEventBufferSize,
+		"number of connection events kept in memory for /events/recent")
+	flag.StringVar(&result.statsd.Addr, "statsd-addr", "",
+		"push metrics to the statsd server at this address, e.g. localhost:8125, "+
+			"enables -proxy-metrics unless -runtime-metrics is set")
+	flag.StringVar(&result.statsd.Prefix, "statsd-prefix", "",
+		"prefix for the metric names pushed to statsd")
+	flag.DurationVar(&result.statsd.Interval, "statsd-interval", 10*time.Second,
+		"interval between two pushes of metrics to statsd")
+	flag.BoolVar(&result.statsd.DogStatsD, "dogstatsd", false,
+		`send metric labels as DogStatsD tags (default "false")`)
+	flag.StringVar(&result.statsdTags, "statsd-tags", "",
+		"comma separated key:value DogStatsD tags to add to every metric")
+	flag.IntVar(&result.notifyFd, "notify-fd", 0,
+		"file descriptor written a READY=1 line once the server is ready, e.g. 3")
+	flag.StringVar(&result.readyFile, "ready-file", "",
+		"file written with the pid of the server once it is ready, removed at shutdown")
 	flag.BoolVar(&result.printVersion, "version", false,
 		`print the version (default "false")`)
 	flag.Parse()
 
+	if result.statsdTags != "" {
+		result.statsd.Tags = strings.Split(result.statsdTags, ",")
+	}
+
 	return result
 }
 
@@ -67,19 +146,60 @@ func run() error {
 		return nil
 	}
 
-	rand.New(rand.NewSource(cli.seed)) // #nosec G404 -- ignoring this rule
-
 	logger := setupLogger()
 	log.Logger = logger
 
 	logger.
 		Info().
 		Str("version", toxiproxy.Version).
+		Int64("seed", cli.seed).
 		Msg("Starting Toxiproxy")
 
+	if cli.tracing {
+		shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			return fmt.Errorf("tracing: %w", err)
+		}
+		defer func() {
+			err := shutdown(context.Background())
+			if err != nil {
+				logger.Err(err).Msg("Failed to flush traces")
+			}
+		}()
+	}
+
 	metrics := toxiproxy.NewMetricsContainer(prometheus.NewRegistry())
 	server := toxiproxy.NewServer(metrics, logger)
-	if cli.proxyMetrics {
+	server.SetLogOutput(os.Stdout)
+	logger = *server.Logger
+	log.Logger = logger
+	server.Debug = cli.debug
+	server.UI = cli.ui
+	server.Strict = cli.strict
+	server.MaxConnections = cli.maxConnections
+	server.RateLimit = cli.apiRateLimit
+	server.RateBurst = cli.apiRateBurst
+	server.MaxBodySize = cli.apiMaxBody
+	if cli.corsOrigins != "" {
+		server.CORSOrigins = strings.Split(cli.corsOrigins, ",")
+	}
+	server.SetSeed(cli.seed)
+	if cli.tokens != "" {
+		err := setNamespaceTokens(server, cli.tokens)
+		if err != nil {
+			return fmt.Errorf("namespace tokens: %w", err)
+		}
+	}
+	if cli.portPool != "" {
+		err := server.SetPortPool(cli.portPool)
+		if err != nil {
+			return fmt.Errorf("port pool: %w", err)
+		}
+	}
+	server.Events = toxiproxy.NewEventBuffer(cli.events)
+	// Pushing to statsd needs metrics to push, proxy metrics are enabled if no
+	// metrics were.
+	if cli.proxyMetrics || (cli.statsd.Addr != "" && !cli.runtimeMetrics) {
 		server.Metrics.ProxyMetrics = collectors.NewProxyMetricCollectors()
 	}
 	if cli.runtimeMetrics {
@@ -89,8 +209,26 @@ func run() error {
 	if len(cli.config) > 0 {
 		server.PopulateConfig(cli.config)
 	}
+	if cli.chaos != "" {
+		err := startChaos(server, cli.chaos)
+		if err != nil {
+			return fmt.Errorf("chaos: %w", err)
+		}
+	}
+
+	if cli.statsd.Addr != "" {
+		exporter, err := toxiproxy.NewStatsdExporter(server.Metrics, cli.statsd, logger)
+		if err != nil {
+			return fmt.Errorf("statsd: %w", err)
+		}
+		go exporter.Run()
+		defer exporter.Stop()
+	}
 
 	addr := net.JoinHostPort(cli.host, cli.port)
+	if cli.socket != "" {
+		addr = "unix:" + cli.socket
+	}
 	go func(server *toxiproxy.ApiServer, addr string) {
 		err := server.Listen(addr)
 		if err != nil {
@@ -98,10 +236,16 @@ func run() error {
 		}
 	}(server, addr)
 
+	notifier := newNotifier(cli)
+	ctx, cancel := context.WithCancel(context.Background())
+	go notifier.notifyWhenReady(ctx, server)
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	<-signals
+	cancel()
 	server.Logger.Info().Msg("Shutdown started")
+	notifier.stopping(server.Logger)
 	err := server.Shutdown()
 	if err != nil {
 		logger.Err(err).Msg("Shutdown finished with error")
@@ -109,6 +253,65 @@ func run() error {
 	return nil
 }
 
+func setNamespaceTokens(server *toxiproxy.ApiServer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tokens map[string]string
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return err
+	}
+	return server.SetNamespaceTokens(tokens)
+}
+
+func startChaos(server *toxiproxy.ApiServer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config toxiproxy.ChaosConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if server.Strict {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(&config)
+	if err != nil {
+		return err
+	}
+	return server.StartChaos(config)
+}
+
+// setupTracing registers a global tracer provider that exports spans over
+// OTLP/HTTP, and returns a function to flush and stop it.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("toxiproxy"),
+		semconv.ServiceVersion(toxiproxy.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
 func setupLogger() zerolog.Logger {
 	zerolog.TimestampFunc = func() time.Time {
 		return time.Now().UTC()
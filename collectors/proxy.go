@@ -2,14 +2,22 @@ package collectors
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type ProxyMetricCollectors struct {
-	collectors  []prometheus.Collector
-	proxyLabels []string
+	collectors       []prometheus.Collector
+	proxyLabels      []string
+	connectionLabels []string
+	toxicLabels      []string
 
-	ReceivedBytesTotal *prometheus.CounterVec
-	SentBytesTotal     *prometheus.CounterVec
+	ReceivedBytesTotal       *prometheus.CounterVec
+	SentBytesTotal           *prometheus.CounterVec
+	Connections              *prometheus.GaugeVec
+	RejectedConnectionsTotal *prometheus.CounterVec
+	UpstreamUp               *prometheus.GaugeVec
+	HealthCheckFailuresTotal *prometheus.CounterVec
+	ToxicLatencyAdded        *prometheus.HistogramVec
 }
 
 func (c *ProxyMetricCollectors) Collectors() []prometheus.Collector {
@@ -42,5 +50,122 @@ func NewProxyMetricCollectors() *ProxyMetricCollectors {
 		m.proxyLabels)
 	m.collectors = append(m.collectors, m.SentBytesTotal)
 
+	m.connectionLabels = []string{
+		"proxy",
+	}
+	m.Connections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "connections",
+		},
+		m.connectionLabels)
+	m.collectors = append(m.collectors, m.Connections)
+
+	m.RejectedConnectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "rejected_connections_total",
+		},
+		m.connectionLabels)
+	m.collectors = append(m.collectors, m.RejectedConnectionsTotal)
+
+	m.UpstreamUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "upstream_up",
+		},
+		m.connectionLabels)
+	m.collectors = append(m.collectors, m.UpstreamUp)
+
+	m.HealthCheckFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "health_check_failures_total",
+		},
+		m.connectionLabels)
+	m.collectors = append(m.collectors, m.HealthCheckFailuresTotal)
+
+	m.toxicLabels = []string{
+		"direction",
+		"proxy",
+		"toxic",
+		"type",
+	}
+	m.ToxicLatencyAdded = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "toxic",
+			Name:      "latency_added_seconds",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		},
+		m.toxicLabels)
+	m.collectors = append(m.collectors, m.ToxicLatencyAdded)
+
 	return &m
 }
+
+// RenameProxy moves the series of a proxy to its new name. The counters and
+// gauges keep their values, the latency histograms of its toxics are only
+// removed, as observations can't be moved.
+func (c *ProxyMetricCollectors) RenameProxy(previous, name string) {
+	for _, vec := range []*prometheus.CounterVec{
+		c.ReceivedBytesTotal,
+		c.SentBytesTotal,
+		c.RejectedConnectionsTotal,
+		c.HealthCheckFailuresTotal,
+	} {
+		for _, s := range proxySeries(vec, previous) {
+			vec.Delete(s.labels)
+			s.labels["proxy"] = name
+			vec.With(s.labels).Add(s.value)
+		}
+	}
+	for _, vec := range []*prometheus.GaugeVec{c.Connections, c.UpstreamUp} {
+		for _, s := range proxySeries(vec, previous) {
+			vec.Delete(s.labels)
+			s.labels["proxy"] = name
+			vec.With(s.labels).Add(s.value)
+		}
+	}
+	c.ToxicLatencyAdded.DeletePartialMatch(prometheus.Labels{"proxy": previous})
+}
+
+type series struct {
+	labels prometheus.Labels
+	value  float64
+}
+
+// proxySeries returns the counters or gauges of a collector labelled with the
+// name of a proxy.
+func proxySeries(collector prometheus.Collector, proxy string) []series {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	var found []series
+	for metric := range metrics {
+		var m dto.Metric
+		if metric.Write(&m) != nil {
+			continue
+		}
+		labels := make(prometheus.Labels, len(m.Label))
+		for _, label := range m.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["proxy"] != proxy {
+			continue
+		}
+		if m.Counter != nil {
+			found = append(found, series{labels, m.Counter.GetValue()})
+		} else if m.Gauge != nil {
+			found = append(found, series{labels, m.Gauge.GetValue()})
+		}
+	}
+	return found
+}
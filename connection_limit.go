@@ -0,0 +1,148 @@
+package toxiproxy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// What happens to the clients accepted over a connection limit.
+const (
+	OnLimitClose = "close" // Close the connection, the default
+	OnLimitReset = "reset" // Reset the connection, without a graceful close
+	OnLimitWait  = "wait"  // Wait for another connection to close
+)
+
+// connectionLimit counts the open connections of a proxy or of a server.
+//
+// All methods are safe to call on a nil *connectionLimit, which has no limit.
+type connectionLimit struct {
+	mutex sync.Mutex
+	open  int
+	freed chan struct{} // Closed when a connection closes
+}
+
+func newConnectionLimit() *connectionLimit {
+	return &connectionLimit{freed: make(chan struct{})}
+}
+
+// acquire counts a new connection, unless max connections are already open.
+// A max of 0 is no limit.
+func (l *connectionLimit) acquire(max int) bool {
+	if l == nil {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if max > 0 && l.open >= max {
+		return false
+	}
+	l.open++
+	return true
+}
+
+func (l *connectionLimit) release() {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.open--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// released returns a channel closed once a connection closes.
+func (l *connectionLimit) released() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.freed
+}
+
+// acquireConnection counts a new client against the connection limits of the
+// proxy and of the server. It reports whether the client can connect, or
+// rejects it as configured by OnLimit, or once it waited for LimitTimeout.
+func (proxy *Proxy) acquireConnection(client net.Conn, dying <-chan struct{}) bool {
+	var timeout <-chan time.Time
+	for {
+		proxy.Toxics.Lock()
+		max, onLimit, limitTimeout := proxy.MaxConnections, proxy.OnLimit, proxy.LimitTimeout
+		proxy.Toxics.Unlock()
+
+		// Wait on the limit that was reached, the taken count of the proxy is
+		// released if the server is full.
+		freed := proxy.openConnections.released()
+		if proxy.openConnections.acquire(max) {
+			freed = proxy.apiServer.connections.released()
+			if proxy.apiServer.connections.acquire(proxy.apiServer.MaxConnections) {
+				proxy.apiServer.connectionMetrics(proxy, 1)
+				return true
+			}
+			proxy.openConnections.release()
+		}
+
+		if onLimit != OnLimitWait {
+			proxy.reject(client, "connection limit reached", onLimit)
+			return false
+		}
+		if timeout == nil && limitTimeout > 0 {
+			timer := time.NewTimer(time.Duration(limitTimeout) * time.Millisecond)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-freed:
+		case <-timeout:
+			proxy.reject(client, "connection limit wait timed out", OnLimitClose)
+			return false
+		case <-dying:
+			client.Close()
+			return false
+		}
+	}
+}
+
+// releaseConnection frees the place of a closed client in the limits.
+func (proxy *Proxy) releaseConnection() {
+	proxy.apiServer.connectionMetrics(proxy, -1)
+	proxy.apiServer.connections.release()
+	proxy.openConnections.release()
+}
+
+// reject closes a client over a connection limit or not allowed by the access
+// lists of the proxy, resetting it with OnLimitReset.
+func (proxy *Proxy) reject(client net.Conn, reason, onLimit string) {
+	proxy.Logger.
+		Warn().
+		Str("client", client.RemoteAddr().String()).
+		Str("reason", reason).
+		Msg("Rejected client")
+	proxy.event(Event{
+		Type:   EventRejected,
+		Client: client.RemoteAddr().String(),
+		Reason: reason,
+	})
+	proxy.Stats.addRejected()
+	if proxy.apiServer.Metrics.proxyMetricsEnabled() {
+		proxy.apiServer.Metrics.ProxyMetrics.RejectedConnectionsTotal.
+			WithLabelValues(proxy.name()).Inc()
+	}
+
+	if tcp, ok := client.(*net.TCPConn); ok && onLimit == OnLimitReset {
+		// Without lingering, closing sends a RST instead of a FIN.
+		_ = tcp.SetLinger(0)
+	}
+	client.Close()
+}
+
+func (server *ApiServer) connectionMetrics(proxy *Proxy, delta float64) {
+	if server.Metrics.proxyMetricsEnabled() {
+		server.Metrics.ProxyMetrics.Connections.WithLabelValues(proxy.name()).Add(delta)
+	}
+}
@@ -0,0 +1,76 @@
+package toxiproxy
+
+import (
+	"time"
+)
+
+// Reasons of the links closed by the timeouts of their connection.
+const (
+	closeReasonIdle = "idle_timeout"
+	closeReasonAge  = "max_connection_age"
+)
+
+// connectionTimeouts returns the idle timeout and the max age of the
+// connections accepted by the proxy, 0 if they have none. The clients of a UDP
+// proxy time out when idle by default, as they never close their connection.
+func (proxy *Proxy) connectionTimeouts() (idle, age time.Duration) {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	idle = time.Duration(proxy.IdleTimeout) * time.Millisecond
+	age = time.Duration(proxy.MaxConnectionAge) * time.Millisecond
+	if idle == 0 && proxy.Protocol == ProtocolUDP {
+		idle = udpIdleTimeout
+	}
+	return idle, age
+}
+
+// watchConnection closes the connection once nothing was sent through it for
+// the idle timeout, or once it is older than the max age. A timeout of 0 is
+// never reached. It returns once the connection is removed.
+func (proxy *Proxy) watchConnection(conn *clientConnection, idle, age time.Duration) {
+	var ageTimeout, idleTimeout <-chan time.Time
+	if age > 0 {
+		timer := time.NewTimer(age)
+		defer timer.Stop()
+		ageTimeout = timer.C
+	}
+	var idleTimer *time.Timer
+	if idle > 0 {
+		idleTimer = time.NewTimer(idle)
+		defer idleTimer.Stop()
+		idleTimeout = idleTimer.C
+	}
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-ageTimeout:
+			proxy.timeOut(conn, closeReasonAge)
+			return
+		case <-idleTimeout:
+			if inactive := time.Since(conn.lastActive()); inactive < idle {
+				idleTimer.Reset(idle - inactive)
+				continue
+			}
+			proxy.timeOut(conn, closeReasonIdle)
+			return
+		}
+	}
+}
+
+// timeOut closes a connection that reached a timeout, its links are closed
+// with the reason once they notice.
+func (proxy *Proxy) timeOut(conn *clientConnection, reason string) {
+	if !conn.timeout.CompareAndSwap(nil, &reason) {
+		return
+	}
+	proxy.Logger.
+		Info().
+		Str("client", conn.client.RemoteAddr().String()).
+		Str("reason", reason).
+		Msg("Closing connection that timed out")
+	proxy.Stats.addTimeout(reason)
+	conn.close()
+}
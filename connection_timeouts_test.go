@@ -0,0 +1,117 @@
+package toxiproxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// startTimeoutProxy starts a proxy with the given timeouts in front of an
+// upstream echoing what it receives.
+func startTimeoutProxy(t *testing.T, idle, age int) (*ApiServer, *Proxy) {
+	t.Helper()
+
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { upstream.Close() })
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	proxy := NewProxy(srv, "test_timeouts", "localhost:0", upstream.Addr().String())
+	proxy.IdleTimeout = idle
+	proxy.MaxConnectionAge = age
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	t.Cleanup(proxy.Stop)
+	return srv, proxy
+}
+
+// echo sends a message through the connection and reads it back.
+func echo(conn net.Conn) error {
+	_, err := conn.Write([]byte("ping"))
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(conn, make([]byte, 4))
+	return err
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	srv, proxy := startTimeoutProxy(t, 100, 0)
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// Traffic keeps the connection open past the idle timeout.
+	for i := 0; i < 5; i++ {
+		err = echo(conn)
+		if err != nil {
+			t.Fatalf("Expected the active connection to stay open, got %v", err)
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	idleSince := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("Expected the idle connection to be closed, got %v", err)
+	}
+	if idle := time.Since(idleSince); idle < 50*time.Millisecond {
+		t.Errorf("Expected the connection to be closed after 100ms idle, closed after %s", idle)
+	}
+
+	closed := waitForEvent(t, srv.Events, proxy.Name, EventLinkClosed)
+	if closed.Reason != closeReasonIdle {
+		t.Errorf("Expected the link to close with the idle_timeout reason, got %+v", closed)
+	}
+	if counters := proxy.Stats.Counters(); counters.IdleTimeouts != 1 || counters.AgeTimeouts != 0 {
+		t.Errorf("Expected 1 idle timeout in the stats, got %+v", counters)
+	}
+}
+
+func TestProxyMaxConnectionAge(t *testing.T) {
+	srv, proxy := startTimeoutProxy(t, 0, 150)
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	opened := time.Now()
+	for echo(conn) == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if age := time.Since(opened); age < 100*time.Millisecond {
+		t.Errorf("Expected the connection to be closed after 150ms, closed after %s", age)
+	}
+
+	closed := waitForEvent(t, srv.Events, proxy.Name, EventLinkClosed)
+	if closed.Reason != closeReasonAge {
+		t.Errorf("Expected the link to close with the max_connection_age reason, got %+v", closed)
+	}
+	if counters := proxy.Stats.Counters(); counters.AgeTimeouts != 1 {
+		t.Errorf("Expected 1 age timeout in the stats, got %+v", counters)
+	}
+}
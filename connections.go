@@ -0,0 +1,360 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"hash/maphash"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// Connection is an open client connection of a proxy, as listed by the API.
+type Connection struct {
+	ID     uint64 `json:"id"`
+	Client string `json:"client"`
+	// Local address of the connection to the upstream.
+	Upstream        string    `json:"upstream"`
+	OpenedAt        time.Time `json:"opened_at"`
+	UpstreamBytes   int64     `json:"upstream_bytes"`
+	DownstreamBytes int64     `json:"downstream_bytes"`
+}
+
+// Number of shards of a connection list, so that the accepts and closes of a
+// busy proxy don't contend on a single lock.
+const connectionShards = 32
+
+// ConnectionList tracks the open connections of a proxy, sharded by the name
+// of their client.
+type ConnectionList struct {
+	seed   maphash.Seed
+	nextID atomic.Uint64
+	shards [connectionShards]connectionShard
+}
+
+type connectionShard struct {
+	lock    sync.Mutex
+	clients map[string]*clientConnection
+}
+
+func newConnectionList() *ConnectionList {
+	list := &ConnectionList{seed: maphash.MakeSeed()}
+	for i := range list.shards {
+		list.shards[i].clients = make(map[string]*clientConnection)
+	}
+	return list
+}
+
+// clientConnection tracks both links of a client, so that the connection can
+// be listed and closed through the API.
+type clientConnection struct {
+	id       uint64
+	client   net.Conn
+	upstream net.Conn
+	address  string // Dialed for the upstream
+	opened   time.Time
+	bytes    [stream.NumDirections]atomic.Int64
+	// Links of the connection that are still open, guarded by the lock of
+	// the shard.
+	links [stream.NumDirections]bool
+	// active is when the connection last sent bytes, in Unix nanoseconds.
+	active atomic.Int64
+	// timeout is the reason of the timeout that closed the connection, if any.
+	timeout atomic.Pointer[string]
+	done    chan struct{} // Closed once the connection is removed
+
+	// States shared by the stubs of both links of the paired toxics, by the
+	// downstream half of the toxic.
+	sharedLock sync.Mutex
+	shared     map[*toxics.ToxicWrapper]interface{}
+}
+
+// sharedState returns the state of the paired toxic shared by both links of
+// the connection, created by the first link asking for it.
+func (conn *clientConnection) sharedState(
+	toxic *toxics.ToxicWrapper,
+	paired toxics.PairedToxic,
+) interface{} {
+	if toxic.Direction == stream.Upstream {
+		toxic = toxic.Pair
+	}
+
+	conn.sharedLock.Lock()
+	defer conn.sharedLock.Unlock()
+
+	state, ok := conn.shared[toxic]
+	if !ok {
+		if conn.shared == nil {
+			conn.shared = make(map[*toxics.ToxicWrapper]interface{})
+		}
+		state = paired.NewSharedState()
+		conn.shared[toxic] = state
+	}
+	return state
+}
+
+func (conn *clientConnection) info() Connection {
+	return Connection{
+		ID:              conn.id,
+		Client:          conn.client.RemoteAddr().String(),
+		Upstream:        conn.upstream.LocalAddr().String(),
+		OpenedAt:        conn.opened,
+		UpstreamBytes:   conn.bytes[stream.Upstream].Load(),
+		DownstreamBytes: conn.bytes[stream.Downstream].Load(),
+	}
+}
+
+// addressHost returns the host of an address, or the whole address if it has
+// no port as with in-memory transports.
+func addressHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// addressPort returns the port of an address, 0 if it has none.
+func addressPort(addr net.Addr) int {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func (conn *clientConnection) lastActive() time.Time {
+	return time.Unix(0, conn.active.Load())
+}
+
+// reset discards the unsent data of both sides, so that they are sent a RST
+// once closed.
+func (conn *clientConnection) reset() {
+	for _, side := range []net.Conn{conn.client, conn.upstream} {
+		if side, ok := side.(lingerer); ok {
+			side.SetLinger(0)
+		}
+	}
+}
+
+func (conn *clientConnection) close() {
+	conn.client.Close()
+	conn.upstream.Close()
+}
+
+func (c *ConnectionList) shard(name string) *connectionShard {
+	return &c.shards[maphash.String(c.seed, name)%connectionShards]
+}
+
+// add registers the links of a new client, and returns its name: the address
+// of the client, suffixed with the id of its connection if another client has
+// the same address, as with in-memory transports.
+func (c *ConnectionList) add(client, upstream net.Conn, address string) string {
+	conn := &clientConnection{
+		id:       c.nextID.Add(1),
+		client:   client,
+		upstream: upstream,
+		address:  address,
+		opened:   time.Now(),
+		links:    [stream.NumDirections]bool{true, true},
+		done:     make(chan struct{}),
+	}
+	conn.active.Store(conn.opened.UnixNano())
+	name := client.RemoteAddr().String()
+	if !c.shard(name).add(name, conn) {
+		name += "#" + strconv.FormatUint(conn.id, 10)
+		c.shard(name).add(name, conn)
+	}
+	return name
+}
+
+// add registers a connection, unless its name is already taken.
+func (s *connectionShard) add(name string, conn *clientConnection) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.clients[name]; ok {
+		return false
+	}
+	s.clients[name] = conn
+	return true
+}
+
+func (c *ConnectionList) get(name string) (*clientConnection, bool) {
+	shard := c.shard(name)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	conn, ok := shard.clients[name]
+	return conn, ok
+}
+
+// removeLink removes a link of a client, and returns its connection if it was
+// the last open link of the connection.
+func (c *ConnectionList) removeLink(link string) *clientConnection {
+	name := strings.TrimSuffix(strings.TrimSuffix(link, "upstream"), "downstream")
+	direction := stream.Downstream
+	if strings.HasSuffix(link, "upstream") {
+		direction = stream.Upstream
+	}
+
+	shard := c.shard(name)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	conn, ok := shard.clients[name]
+	if !ok || !conn.links[direction] {
+		return nil
+	}
+	conn.links[direction] = false
+	if conn.links[stream.Upstream] || conn.links[stream.Downstream] {
+		return nil
+	}
+	delete(shard.clients, name)
+	return conn
+}
+
+// each calls f with the open connections, with the lock of their shard taken.
+func (c *ConnectionList) each(f func(*clientConnection)) {
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.lock.Lock()
+		for _, conn := range shard.clients {
+			f(conn)
+		}
+		shard.lock.Unlock()
+	}
+}
+
+// links returns the number of open links of the connections.
+func (c *ConnectionList) links() int {
+	links := 0
+	c.each(func(conn *clientConnection) {
+		for _, open := range conn.links {
+			if open {
+				links++
+			}
+		}
+	})
+	return links
+}
+
+// writer counts the bytes written to w by a link of the client in the proxy
+// stats and in the ones of its connection.
+func (proxy *Proxy) writer(client string, w io.Writer, direction stream.Direction) io.Writer {
+	w = proxy.Stats.writer(w, direction)
+
+	conn, ok := proxy.connections.get(client)
+	if !ok {
+		return w
+	}
+	return &connectionWriter{countingWriter{w, &conn.bytes[direction]}, conn}
+}
+
+// connectionWriter counts the bytes written by a link of a connection, and
+// records when it last wrote for the idle timeout.
+type connectionWriter struct {
+	countingWriter
+	conn *clientConnection
+}
+
+func (w *connectionWriter) Write(p []byte) (int, error) {
+	w.conn.active.Store(time.Now().UnixNano())
+	return w.countingWriter.Write(p)
+}
+
+// timeoutReason returns the reason of the timeout that closed the connection
+// of the client, if any.
+func (proxy *Proxy) timeoutReason(client string) string {
+	conn, ok := proxy.connections.get(client)
+	if !ok {
+		return ""
+	}
+	if reason := conn.timeout.Load(); reason != nil {
+		return *reason
+	}
+	return ""
+}
+
+// Connections returns the open connections of the proxy, oldest first.
+func (proxy *Proxy) Connections() []Connection {
+	connections := []Connection{}
+	proxy.connections.each(func(conn *clientConnection) {
+		connections = append(connections, conn.info())
+	})
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ID < connections[j].ID
+	})
+	return connections
+}
+
+// CloseConnection closes both sides of the connection with the given id. Its
+// links are removed once they notice.
+func (proxy *Proxy) CloseConnection(id uint64) error {
+	err := ErrConnectionNotFound
+	proxy.connections.each(func(conn *clientConnection) {
+		if conn.id == id {
+			conn.close()
+			err = nil
+		}
+	})
+	return err
+}
+
+func (server *ApiServer) ConnectionIndex(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(proxy.Connections())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ConnectionIndex: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) ConnectionDelete(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	id, err := strconv.ParseUint(vars["connection"], 10, 64)
+	if err != nil {
+		server.apiError(response, ErrConnectionNotFound)
+		return
+	}
+
+	err = proxy.CloseConnection(id)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err = response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ConnectionDelete: Failed to write headers to client")
+	}
+}
@@ -0,0 +1,192 @@
+package toxiproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+func waitForConnections(t *testing.T, proxy *Proxy, count int) []Connection {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if connections := proxy.Connections(); len(connections) == count {
+			return connections
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d connections, got %+v", count, proxy.Connections())
+	return nil
+}
+
+func TestProxyListsAndClosesConnections(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewProxy(srv, "test_connections", "localhost:0", upstream.Addr().String())
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(conn, make([]byte, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connections := waitForConnections(t, proxy, 1)
+	if connections[0].Client != conn.LocalAddr().String() {
+		t.Errorf("Expected client %s, got %s", conn.LocalAddr(), connections[0].Client)
+	}
+	// Links without toxics count their bytes while their direct copy runs.
+	if connections[0].UpstreamBytes != 5 || connections[0].DownstreamBytes != 5 {
+		t.Errorf("Expected 5 bytes in each direction, got %+v", connections[0])
+	}
+	counters := proxy.Stats.Counters()
+	if counters.UpstreamBytes != 5 || counters.DownstreamBytes != 5 {
+		t.Errorf("Expected 5 bytes in each direction of the proxy, got %+v", counters)
+	}
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, httptest.NewRequest("DELETE",
+		"/proxies/test_connections/connections/"+strconv.FormatUint(connections[0].ID, 10), nil))
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	waitForConnections(t, proxy, 0)
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("Expected the client to be disconnected, got %v", err)
+	}
+
+	err = proxy.CloseConnection(connections[0].ID)
+	if err != ErrConnectionNotFound {
+		t.Errorf("Expected ErrConnectionNotFound, got %v", err)
+	}
+}
+
+// readerFromRecorder stands for a TCP connection, whose ReadFrom copies until
+// the source is closed.
+type readerFromRecorder struct {
+	io.Writer
+	readFrom bool
+	copied   func() // Called once copied, before ReadFrom returns
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	n, err := io.Copy(r.Writer, src)
+	r.copied()
+	return n, err
+}
+
+func TestWriterReachesReaderFrom(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	proxy := NewProxy(srv, "test_reader_from", "localhost:0", "localhost:20001")
+
+	client, upstream := net.Pipe()
+	defer client.Close()
+	defer upstream.Close()
+	name := proxy.connections.add(client, upstream, proxy.Upstream)
+
+	// TCP connections hide their WriteTo when copying to another connection.
+	source := struct{ io.Reader }{strings.NewReader("hello")}
+	var live int64
+	dest := &readerFromRecorder{Writer: io.Discard, copied: func() {
+		live = proxy.Connections()[0].DownstreamBytes
+	}}
+	_, err := io.Copy(proxy.writer(name, dest, stream.Downstream), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dest.readFrom {
+		t.Fatal("Expected the copy to use the ReadFrom of the destination")
+	}
+	if live != 5 {
+		t.Fatalf("Expected the bytes to be counted during the copy, got %d", live)
+	}
+	if bytes := proxy.Stats.Counters().DownstreamBytes; bytes != 5 {
+		t.Fatalf("Expected 5 bytes in the proxy stats, got %d", bytes)
+	}
+	if bytes := proxy.Connections()[0].DownstreamBytes; bytes != 5 {
+		t.Fatalf("Expected 5 bytes in the connection stats, got %d", bytes)
+	}
+}
+
+func TestConnectionListConcurrentClients(t *testing.T) {
+	list := newConnectionList()
+
+	// In-memory connections all have the same address.
+	var wg sync.WaitGroup
+	names := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, upstream := net.Pipe()
+			names <- list.add(client, upstream, "")
+		}()
+	}
+	wg.Wait()
+	close(names)
+
+	unique := make(map[string]bool)
+	for name := range names {
+		unique[name] = true
+	}
+	if len(unique) != 100 || list.links() != 200 {
+		t.Fatalf("Expected 100 unique names and 200 links, got %d and %d",
+			len(unique), list.links())
+	}
+
+	for name := range unique {
+		if list.removeLink(name+"upstream") != nil {
+			t.Fatalf("Expected %s to stay open with its downstream link", name)
+		}
+		if list.removeLink(name+"downstream") == nil {
+			t.Fatalf("Expected %s to close with its last link", name)
+		}
+	}
+	if links := list.links(); links != 0 {
+		t.Fatalf("Expected no links left, got %d", links)
+	}
+}
@@ -0,0 +1,68 @@
+package toxiproxy
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Headers of the responses of the API the scripts of an allowed origin can read.
+const corsExposedHeaders = "X-Toxiproxy-Request-Id, Retry-After"
+
+// Methods of the API, allowed from the origins allowed by the server.
+const corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE"
+
+// allowedOrigin reports whether browsers of an origin can use the API, from
+// the origins set on the server, or all of them with "*".
+func (server *ApiServer) allowedOrigin(origin string) bool {
+	return origin != "" &&
+		(slices.Contains(server.CORSOrigins, "*") || slices.Contains(server.CORSOrigins, origin))
+}
+
+// corsMiddleware lets the dashboards and test runners of the origins allowed
+// by the server use the API from a browser, answering their preflight
+// requests and letting their requests past stopBrowsersMiddleware, as are the
+// requests of the web UI. The requests of the other browsers are still
+// rejected, so that other pages can't use the API.
+func (server *ApiServer) corsMiddleware(next http.Handler) http.Handler {
+	stopBrowsers := stopBrowsersMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !server.allowedOrigin(origin) {
+			if server.uiRequest(r) {
+				next.ServeHTTP(w, r)
+			} else {
+				stopBrowsers.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		if slices.Contains(server.CORSOrigins, "*") {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		header.Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Preflight answers the OPTIONS requests not from an allowed origin, with the
+// methods of the API but without allowing their origin.
+func (server *ApiServer) Preflight(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Allow", "OPTIONS, "+corsAllowedMethods)
+	response.WriteHeader(http.StatusNoContent)
+}
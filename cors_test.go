@@ -0,0 +1,87 @@
+package toxiproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const browserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+
+func browserRequest(method, path, origin string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("User-Agent", browserAgent)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	return req
+}
+
+func TestCORSAllowsTheBrowsersOfTheOrigins(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()), WithCORSOrigins("http://localhost:3000"))
+	routes := srv.Routes()
+
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, browserRequest("GET", "/proxies", "http://localhost:3000"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected the allowed origin to get the proxies, got %d", resp.Code)
+	}
+	if origin := resp.Header().Get("Access-Control-Allow-Origin"); origin != "http://localhost:3000" {
+		t.Errorf("Expected the origin to be allowed, got %q", origin)
+	}
+	if exposed := resp.Header().Get("Access-Control-Expose-Headers"); exposed != corsExposedHeaders {
+		t.Errorf("Expected the headers of the API to be exposed, got %q", exposed)
+	}
+
+	req := browserRequest("OPTIONS", "/proxies/redis/toxics", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for the preflight, got %d", resp.Code)
+	}
+	if methods := resp.Header().Get("Access-Control-Allow-Methods"); methods != corsAllowedMethods {
+		t.Errorf("Expected the methods of the API to be allowed, got %q", methods)
+	}
+	headers := resp.Header().Get("Access-Control-Allow-Headers")
+	if headers != "authorization, content-type" {
+		t.Errorf("Expected the requested headers to be allowed, got %q", headers)
+	}
+
+	for _, origin := range []string{"http://evil.example", ""} {
+		resp = httptest.NewRecorder()
+		routes.ServeHTTP(resp, browserRequest("GET", "/proxies", origin))
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("Expected the browser of origin %q to be rejected, got %d", origin, resp.Code)
+		}
+		if resp.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected origin %q not to be allowed", origin)
+		}
+	}
+}
+
+func TestCORSAllowsAllTheOrigins(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()), WithCORSOrigins("*"))
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, browserRequest("GET", "/version", "https://dashboard.example"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected any origin to get the version, got %d", resp.Code)
+	}
+	if origin := resp.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("Expected all the origins to be allowed, got %q", origin)
+	}
+}
+
+func TestOptionsWithoutCORSOrigins(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()))
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, httptest.NewRequest("OPTIONS", "/proxies", nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected OPTIONS not to be allowed without origins, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof" // #nosec G108 -- only routed when the server runs with -debug
+	"runtime"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// DebugState is a snapshot of the internals of a running server, to help
+// diagnosing leaks or stuck proxies in long-running deployments.
+type DebugState struct {
+	Goroutines int          `json:"goroutines"`
+	Memory     DebugMemory  `json:"memory"`
+	Proxies    []DebugProxy `json:"proxies"`
+}
+
+type DebugMemory struct {
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	HeapObjs   uint64 `json:"heap_objects"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"num_gc"`
+	PauseTotal uint64 `json:"pause_total_ns"`
+}
+
+type DebugProxy struct {
+	Name        string      `json:"name"`
+	Enabled     bool        `json:"enabled"`
+	Tomb        string      `json:"tomb"`
+	Connections int         `json:"connections"`
+	Links       []DebugLink `json:"links"`
+}
+
+// DebugLink shows how full the buffers between the toxics of a link are. A
+// link whose buffers stay full has an output that doesn't keep up.
+type DebugLink struct {
+	Name      string        `json:"name"`
+	Direction string        `json:"direction"`
+	Buffers   []DebugBuffer `json:"buffers"`
+}
+
+// DebugBuffer is the input buffer of a toxic in a link, in stream chunks.
+type DebugBuffer struct {
+	Toxic    string `json:"toxic"`
+	Type     string `json:"type"`
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+}
+
+// debugRoutes adds the pprof handlers and the debug state endpoint to r.
+func (server *ApiServer) debugRoutes(r *mux.Router) {
+	r.HandleFunc("/debug/state", server.DebugStateShow).Methods("GET").
+		Name("DebugStateShow")
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline).Name("DebugPprof")
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile).Name("DebugPprof")
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Name("DebugPprof")
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace).Name("DebugPprof")
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index).Name("DebugPprof")
+}
+
+func (server *ApiServer) DebugStateShow(response http.ResponseWriter, request *http.Request) {
+	data, err := json.Marshal(server.DebugState())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("DebugStateShow: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) DebugState() DebugState {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	state := DebugState{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: DebugMemory{
+			HeapAlloc:  mem.HeapAlloc,
+			HeapInuse:  mem.HeapInuse,
+			HeapObjs:   mem.HeapObjects,
+			Sys:        mem.Sys,
+			NumGC:      mem.NumGC,
+			PauseTotal: mem.PauseTotalNs,
+		},
+		Proxies: []DebugProxy{},
+	}
+
+	for _, proxy := range server.Collection.Proxies() {
+		state.Proxies = append(state.Proxies, proxy.debugState())
+	}
+	sort.Slice(state.Proxies, func(i, j int) bool {
+		return state.Proxies[i].Name < state.Proxies[j].Name
+	})
+
+	return state
+}
+
+func (proxy *Proxy) debugState() DebugProxy {
+	state := DebugProxy{Name: proxy.Name, Links: []DebugLink{}}
+
+	// Starting and stopping hold the lock, a proxy stuck in either shows up as
+	// changing instead of blocking the endpoint.
+	if proxy.TryLock() {
+		state.Enabled = proxy.Enabled
+		state.Tomb = proxy.tombState()
+		proxy.Unlock()
+	} else {
+		state.Tomb = "changing"
+	}
+
+	state.Connections = proxy.connections.links()
+
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+	for name, link := range proxy.Toxics.links {
+		state.Links = append(state.Links, link.debugState(name))
+	}
+	sort.Slice(state.Links, func(i, j int) bool {
+		return state.Links[i].Name < state.Links[j].Name
+	})
+
+	return state
+}
+
+// tombState describes the tomb of the accept loop. The proxy lock must be held.
+func (proxy *Proxy) tombState() string {
+	select {
+	case <-proxy.tomb.Dead():
+		return "dead"
+	case <-proxy.tomb.Dying():
+		return "dying"
+	default:
+	}
+	if !proxy.Enabled {
+		return "unused"
+	}
+	return "alive"
+}
+
+// debugState reports the buffers of the link. The collection lock must be held.
+func (link *ToxicLink) debugState(name string) DebugLink {
+	state := DebugLink{
+		Name:      name,
+		Direction: link.direction.String(),
+		Buffers:   []DebugBuffer{},
+	}
+	chain := link.toxics.chain[link.direction]
+	for i, stub := range link.stubs {
+		if i >= len(chain) {
+			break
+		}
+		state.Buffers = append(state.Buffers, DebugBuffer{
+			Toxic:    chain[i].Name,
+			Type:     chain[i].Type,
+			Length:   len(stub.Input),
+			Capacity: cap(stub.Input),
+		})
+	}
+	return state
+}
@@ -0,0 +1,63 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestDebugRoutesRequireDebug(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	for _, path := range []string{"/debug/state", "/debug/pprof/"} {
+		resp := httptest.NewRecorder()
+		srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 without debug, got %d", path, resp.Code)
+		}
+	}
+
+	srv.Debug = true
+	for _, path := range []string{"/debug/state", "/debug/pprof/", "/debug/pprof/goroutine"} {
+		resp := httptest.NewRecorder()
+		srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		if resp.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 with debug, got %d", path, resp.Code)
+		}
+	}
+}
+
+func TestDebugState(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	srv.Debug = true
+
+	proxy := NewProxy(srv, "test_debug_state", "localhost:0", "localhost:1")
+	err := srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", "/debug/state", nil))
+
+	var state DebugState
+	err = json.Unmarshal(resp.Body.Bytes(), &state)
+	if err != nil {
+		t.Fatal("Failed to decode debug state:", err)
+	}
+	if state.Goroutines == 0 {
+		t.Error("Expected goroutines to be counted")
+	}
+	if len(state.Proxies) != 1 {
+		t.Fatalf("Expected 1 proxy, got %+v", state.Proxies)
+	}
+	actual := state.Proxies[0]
+	if actual.Name != proxy.Name || !actual.Enabled || actual.Tomb != "alive" {
+		t.Fatalf("Unexpected proxy state: %+v", actual)
+	}
+}
@@ -0,0 +1,123 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// DirectionStates tells which directions of the connections of a proxy relay
+// their data, to simulate asymmetric failures, e.g. requests reaching the
+// upstream while its responses are lost. The data read in a disabled
+// direction is discarded, like with a timeout toxic, and the connections stay
+// open.
+//
+// All methods are safe to call on a nil *DirectionStates, with both
+// directions enabled.
+type DirectionStates struct {
+	disabled [stream.NumDirections]atomic.Bool
+}
+
+func NewDirectionStates() *DirectionStates {
+	return new(DirectionStates)
+}
+
+func (d *DirectionStates) Enabled(direction stream.Direction) bool {
+	return d == nil || !d.disabled[direction].Load()
+}
+
+func (d *DirectionStates) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]bool{
+		stream.Upstream.String():   d.Enabled(stream.Upstream),
+		stream.Downstream.String(): d.Enabled(stream.Downstream),
+	})
+}
+
+// UnmarshalJSON ignores directions sent back by clients updating a proxy,
+// which are changed with SetDirectionEnabled.
+func (d *DirectionStates) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+// SetDirectionEnabled enables or disables a direction of the connections of
+// the proxy, the open ones included. The connections of a disabled direction
+// are not copied directly, so that their data can be discarded.
+func (proxy *Proxy) SetDirectionEnabled(direction stream.Direction, enabled bool) {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	if proxy.Directions == nil {
+		proxy.Directions = NewDirectionStates()
+	}
+	proxy.Directions.disabled[direction].Store(!enabled)
+	if enabled {
+		return
+	}
+	for _, link := range proxy.Toxics.links {
+		if link.direction == direction {
+			link.stopDirect()
+		}
+	}
+}
+
+// directionWriter discards the data written while its direction is disabled.
+type directionWriter struct {
+	io.Writer
+	directions *DirectionStates
+	direction  stream.Direction
+}
+
+func (w *directionWriter) Write(p []byte) (int, error) {
+	if !w.directions.Enabled(w.direction) {
+		return len(p), nil
+	}
+	return w.Writer.Write(p)
+}
+
+// DirectionUpdate enables or disables a direction of a proxy, with a body of
+// {"enabled": false}, and returns the proxy.
+func (server *ApiServer) DirectionUpdate(response http.ResponseWriter, request *http.Request) {
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+	direction, err := stream.ParseDirection(mux.Vars(request)["direction"])
+	if err != nil {
+		server.apiError(response, ErrInvalidStream)
+		return
+	}
+
+	input := struct {
+		Enabled *bool `json:"enabled"`
+	}{}
+	err = server.checkBody(request, &input)
+	if server.apiError(response, err) {
+		return
+	}
+	err = json.NewDecoder(request.Body).Decode(&input)
+	if server.apiError(response, joinError(err, ErrBadRequestBody)) {
+		return
+	}
+	if input.Enabled == nil {
+		server.apiError(response, joinError(fmt.Errorf("enabled"), ErrMissingField))
+		return
+	}
+	proxy.SetDirectionEnabled(direction, *input.Enabled)
+
+	data, err := json.Marshal(proxyWithToxics(proxy))
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		server.Logger.Warn().Err(err).Msg("DirectionUpdate: Failed to write response to client")
+	}
+}
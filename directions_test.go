@@ -0,0 +1,116 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestDisabledDownstreamDiscardsResponses(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	received := make(chan []byte, 10)
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			received <- append([]byte{}, buf[:n]...)
+			conn.Write(buf[:n])
+		}
+	}()
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", upstream.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+
+		// The open connection is copied directly until the direction is
+		// disabled.
+		err = proxy.SetDirection("downstream", false)
+		if err != nil {
+			t.Fatal("Unable to disable the downstream direction:", err)
+		}
+		if proxy.Directions["downstream"] || !proxy.Directions["upstream"] {
+			t.Fatalf("Expected only the downstream direction to be disabled, got %v", proxy.Directions)
+		}
+
+		conn.Write([]byte("hello"))
+		select {
+		case data := <-received:
+			if string(data) != "hello" {
+				t.Fatalf("Expected the upstream to receive hello, got %q", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the upstream to receive the request")
+		}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		buf := make([]byte, 5)
+		if n, err := conn.Read(buf); err == nil {
+			t.Fatalf("Expected the response to be discarded, got %q", buf[:n])
+		}
+
+		err = proxy.SetDirection("downstream", true)
+		if err != nil {
+			t.Fatal("Unable to enable the downstream direction:", err)
+		}
+		conn.Write([]byte("world"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal("Expected the response once the direction is enabled, got", err)
+		}
+		if string(buf) != "world" {
+			t.Fatalf("Expected world, got %q", buf)
+		}
+	})
+}
+
+func TestSetDirectionValidation(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", "localhost:3306")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		err = proxy.SetDirection("sideways", false)
+		if !errors.Is(err, tclient.ErrInvalidStream) {
+			t.Fatal("Expected an invalid direction to be rejected, got", err)
+		}
+
+		err = proxy.SetDirection("upstream", false)
+		if err != nil {
+			t.Fatal("Unable to disable the upstream direction:", err)
+		}
+		err = client.ResetState()
+		if err != nil {
+			t.Fatal("Unable to reset the state:", err)
+		}
+		proxy, err = client.Proxy("mysql_master")
+		if err != nil {
+			t.Fatal("Unable to retrieve the proxy:", err)
+		}
+		if !proxy.Directions["upstream"] {
+			t.Error("Expected the reset to enable the upstream direction again")
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package toxiproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Families of the addresses of a dual-stack upstream.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// defaultAttemptDelay is the Connection Attempt Delay recommended by RFC 8305.
+const defaultAttemptDelay = 250 * time.Millisecond
+
+// lookupIPAddr resolves the names of the upstreams, replaced by the tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// DualStack controls how a proxy connects to an upstream whose name resolves
+// to both IPv4 and IPv6 addresses, to reproduce the behaviors of dual-stack
+// clients, or of upstreams broken on one family. If not set, the proxy dials
+// as Go does. It does not apply to a DialFunc nor to UDP proxies.
+type DualStack struct {
+	// Prefer is the family dialed first, FamilyIPv4 or FamilyIPv6, the family
+	// of the first address resolved if not set.
+	Prefer string `json:"prefer,omitempty"`
+	// Race dials the addresses as Happy Eyeballs (RFC 8305) does: alternating
+	// the families, each address being dialed once the previous one failed or
+	// AttemptDelay milliseconds after it, 250 if not set, and the first to
+	// connect winning. Otherwise the addresses of the preferred family are
+	// dialed one after the other, then the ones of the other family.
+	Race         bool `json:"race,omitempty"`
+	AttemptDelay int  `json:"attempt_delay,omitempty"`
+	// Fail is a family whose connections fail, like the broken IPv6 route of
+	// a host: they are refused, or with Blackhole they hang until the dial
+	// times out.
+	Fail      string `json:"fail,omitempty"`
+	Blackhole bool   `json:"blackhole,omitempty"`
+}
+
+func validateDualStack(dualStack DualStack) error {
+	for _, family := range []string{dualStack.Prefer, dualStack.Fail} {
+		switch family {
+		case "", FamilyIPv4, FamilyIPv6:
+		default:
+			return joinError(
+				fmt.Errorf("dual_stack: %q is not %s or %s", family, FamilyIPv4, FamilyIPv6),
+				ErrInvalidDialOptions,
+			)
+		}
+	}
+	if dualStack.AttemptDelay < 0 {
+		return joinError(
+			fmt.Errorf("dual_stack: attempt_delay must not be negative"),
+			ErrInvalidDialOptions,
+		)
+	}
+	return nil
+}
+
+func (proxy *Proxy) dualStack() DualStack {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	return proxy.DualStack
+}
+
+// netDialFunc connects to an address of a network, "tcp4" or "tcp6".
+type netDialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// dialWith returns a DialFunc connecting to the addresses of the host of an
+// address as the options tell, each of them with dial.
+func (dualStack DualStack) dialWith(dial netDialFunc) DialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else {
+			addrs, err := lookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+			}
+			for _, addr := range addrs {
+				ips = append(ips, addr.IP)
+			}
+		}
+
+		addresses := dualStack.order(ips)
+		if len(addresses) == 0 {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("no address for %s", host)}
+		}
+		if dualStack.Race {
+			return dualStack.race(ctx, dial, addresses, port)
+		}
+		return dualStack.sequence(ctx, dial, addresses, port)
+	}
+}
+
+func familyOf(ip net.IP) string {
+	if ip.To4() != nil {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// order returns the addresses in the order they are dialed: the preferred
+// family first, or alternating the families when racing them.
+func (dualStack DualStack) order(ips []net.IP) []net.IP {
+	if len(ips) == 0 {
+		return nil
+	}
+	preferred := dualStack.Prefer
+	if preferred == "" {
+		preferred = familyOf(ips[0])
+	}
+	var primaries, secondaries []net.IP
+	for _, ip := range ips {
+		if familyOf(ip) == preferred {
+			primaries = append(primaries, ip)
+		} else {
+			secondaries = append(secondaries, ip)
+		}
+	}
+	if !dualStack.Race {
+		return append(primaries, secondaries...)
+	}
+
+	ordered := make([]net.IP, 0, len(ips))
+	for len(primaries) > 0 || len(secondaries) > 0 {
+		if len(primaries) > 0 {
+			ordered = append(ordered, primaries[0])
+			primaries = primaries[1:]
+		}
+		if len(secondaries) > 0 {
+			ordered = append(ordered, secondaries[0])
+			secondaries = secondaries[1:]
+		}
+	}
+	return ordered
+}
+
+// attempt connects to an address, unless its family fails.
+func (dualStack DualStack) attempt(
+	ctx context.Context,
+	dial netDialFunc,
+	ip net.IP,
+	port string,
+) (net.Conn, error) {
+	network := "tcp4"
+	if familyOf(ip) == FamilyIPv6 {
+		network = "tcp6"
+	}
+	address := net.JoinHostPort(ip.String(), port)
+	if familyOf(ip) != dualStack.Fail {
+		return dial(ctx, network, address)
+	}
+
+	// It resolves, as the address is an IP.
+	addr, _ := net.ResolveTCPAddr(network, address)
+	err := error(syscall.ECONNREFUSED)
+	if dualStack.Blackhole {
+		<-ctx.Done()
+		err = ctx.Err()
+	}
+	return nil, &net.OpError{Op: "dial", Net: network, Addr: addr, Err: err}
+}
+
+// sequence dials the addresses one after the other, each being given its
+// share of the time left, as the dialer of Go does.
+func (dualStack DualStack) sequence(
+	ctx context.Context,
+	dial netDialFunc,
+	addresses []net.IP,
+	port string,
+) (net.Conn, error) {
+	var firstErr error
+	for i, ip := range addresses {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			share := time.Until(deadline) / time.Duration(len(addresses)-i)
+			attemptCtx, cancel = context.WithTimeout(ctx, share)
+		}
+		conn, err := dualStack.attempt(attemptCtx, dial, ip, port)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// race dials the addresses as RFC 8305 does, each one after the previous
+// failed or once the attempt delay passed, and returns the first connection.
+// The connections of the attempts that lost are closed.
+func (dualStack DualStack) race(
+	ctx context.Context,
+	dial netDialFunc,
+	addresses []net.IP,
+	port string,
+) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	next, pending := 0, 0
+	start := func() {
+		ip := addresses[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dualStack.attempt(ctx, dial, ip, port)
+			select {
+			case results <- dialResult{conn, err}:
+			case <-ctx.Done():
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+
+	delay := defaultAttemptDelay
+	if dualStack.AttemptDelay > 0 {
+		delay = time.Duration(dualStack.AttemptDelay) * time.Millisecond
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	start()
+	for {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				return result.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if next < len(addresses) {
+				start()
+				timer.Reset(delay)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		case <-timer.C:
+			if next < len(addresses) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+}
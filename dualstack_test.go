@@ -0,0 +1,163 @@
+package toxiproxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// dualStackUpstream listens on the same port of 127.0.0.1 and ::1, greeting
+// the clients with the family they connected to, and resolves
+// dualstack.test to both addresses.
+func dualStackUpstream(t *testing.T) string {
+	t.Helper()
+
+	var listeners []net.Listener
+	for attempt := 0; attempt < 10 && listeners == nil; attempt++ {
+		v4, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := strconv.Itoa(v4.Addr().(*net.TCPAddr).Port)
+		v6, err := net.Listen("tcp6", net.JoinHostPort("::1", port))
+		if err != nil {
+			v4.Close()
+			continue
+		}
+		listeners = []net.Listener{v4, v6}
+	}
+	if listeners == nil {
+		t.Skip("Unable to listen on the same port of 127.0.0.1 and ::1")
+	}
+	for i, family := range []string{FamilyIPv4, FamilyIPv6} {
+		listener := listeners[i]
+		t.Cleanup(func() { listener.Close() })
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, family+"\n")
+				conn.Close()
+			}
+		}()
+	}
+
+	lookup := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "dualstack.test" {
+			return lookup(ctx, host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("::1")}}, nil
+	}
+	t.Cleanup(func() { lookupIPAddr = lookup })
+
+	_, port, _ := net.SplitHostPort(listeners[0].Addr().String())
+	return net.JoinHostPort("dualstack.test", port)
+}
+
+// greetingFamily returns the family a client of the proxy reached.
+func greetingFamily(t *testing.T, proxy *Proxy) string {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	return line[:len(line)-1]
+}
+
+func TestDualStackFamilies(t *testing.T) {
+	upstream := dualStackUpstream(t)
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	for i, test := range []struct {
+		dualStack   DualStack
+		dialTimeout int
+		expected    string
+	}{
+		{DualStack{Prefer: FamilyIPv4}, 0, FamilyIPv4},
+		{DualStack{Prefer: FamilyIPv6}, 0, FamilyIPv6},
+		{DualStack{Prefer: FamilyIPv6, Fail: FamilyIPv6}, 0, FamilyIPv4},
+		{DualStack{Prefer: FamilyIPv4, Fail: FamilyIPv4, Blackhole: true}, 400, FamilyIPv6},
+		{DualStack{Prefer: FamilyIPv6, Race: true, AttemptDelay: 50}, 0, FamilyIPv6},
+		{DualStack{Prefer: FamilyIPv6, Race: true, Fail: FamilyIPv6, Blackhole: true}, 0, FamilyIPv4},
+		// The family of the first address resolved is dialed first.
+		{DualStack{Fail: FamilyIPv4, Blackhole: true}, 200, FamilyIPv6},
+	} {
+		proxy := NewProxy(srv, "dualstack"+strconv.Itoa(i), "localhost:0", upstream)
+		proxy.DualStack = test.dualStack
+		proxy.DialTimeout = test.dialTimeout
+		err := srv.Collection.Add(proxy, true)
+		if err != nil {
+			t.Fatal("Failed to add proxy:", err)
+		}
+
+		started := time.Now()
+		family := greetingFamily(t, proxy)
+		if family != test.expected {
+			t.Errorf("Expected %+v to reach %q, got %q", test.dualStack, test.expected, family)
+		}
+		if test.dualStack.Race && time.Since(started) > time.Second {
+			t.Errorf("Expected %+v to race the families, took %s", test.dualStack, time.Since(started))
+		}
+		proxy.Stop()
+	}
+}
+
+func TestDualStackOrder(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("fd00::1"),
+		net.ParseIP("fd00::2"),
+	}
+	for _, test := range []struct {
+		dualStack DualStack
+		expected  []int
+	}{
+		{DualStack{}, []int{0, 1, 2, 3}},
+		{DualStack{Prefer: FamilyIPv6}, []int{2, 3, 0, 1}},
+		{DualStack{Race: true}, []int{0, 2, 1, 3}},
+		{DualStack{Prefer: FamilyIPv6, Race: true}, []int{2, 0, 3, 1}},
+	} {
+		ordered := test.dualStack.order(ips)
+		for i, index := range test.expected {
+			if !ordered[i].Equal(ips[index]) {
+				t.Errorf("Expected %+v to dial %v, got %v", test.dualStack, test.expected, ordered)
+				break
+			}
+		}
+	}
+}
+
+func TestDualStackValidation(t *testing.T) {
+	for _, dualStack := range []DualStack{
+		{Prefer: "ipv5"},
+		{Fail: "v6"},
+		{Race: true, AttemptDelay: -1},
+	} {
+		proxy := &Proxy{DualStack: dualStack}
+		if validateOptions(proxy) == nil {
+			t.Errorf("Expected %+v to be rejected", dualStack)
+		}
+	}
+	proxy := &Proxy{Protocol: ProtocolUDP, DualStack: DualStack{Prefer: FamilyIPv4}}
+	if validateOptions(proxy) == nil {
+		t.Error("Expected the dual stack options of an udp proxy to be rejected")
+	}
+}
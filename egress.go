@@ -0,0 +1,251 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Schemes of the upstream proxies.
+const (
+	upstreamProxySocks = "socks5"
+	upstreamProxyHTTP  = "http"
+)
+
+// Methods of authentication of SOCKS5.
+const (
+	socksUserPassword        = 2
+	socksUserPasswordVersion = 1
+)
+
+// parseUpstreamProxy parses the URL of the proxy the upstream is connected
+// through, nil if not set.
+func parseUpstreamProxy(upstreamProxy string) (*url.URL, error) {
+	if upstreamProxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(upstreamProxy)
+	if err == nil && u.Scheme != upstreamProxySocks && u.Scheme != upstreamProxyHTTP {
+		err = fmt.Errorf("scheme %q is not socks5 or http", u.Scheme)
+	}
+	if err == nil {
+		_, _, err = net.SplitHostPort(u.Host)
+	}
+	if err != nil {
+		return nil, joinError(
+			fmt.Errorf("upstream_proxy must be a socks5:// or http:// URL with a port: %w", err),
+			ErrInvalidDialOptions,
+		)
+	}
+	return u, nil
+}
+
+func (proxy *Proxy) upstreamProxy() *url.URL {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	// It was validated when set.
+	u, _ := parseUpstreamProxy(proxy.UpstreamProxy)
+	return u
+}
+
+// dialThrough returns a DialFunc connecting through the proxy of a URL, which
+// is connected to with dial. The handshake ends with the context of the dial.
+func dialThrough(upstreamProxy *url.URL, dial DialFunc) DialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		conn, err := dial(ctx, upstreamProxy.Host)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() {
+			conn.SetDeadline(time.Unix(1, 0))
+		})
+
+		if upstreamProxy.Scheme == upstreamProxySocks {
+			err = socksHandshake(conn, upstreamProxy.User, address)
+		} else {
+			err = connectHandshake(conn, upstreamProxy.User, address)
+		}
+		if !stop() && err != nil {
+			err = errors.Join(ctx.Err(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("upstream proxy %s: %w", upstreamProxy.Host, err)
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// socksHandshake asks a SOCKS5 proxy to connect to an address. The names are
+// resolved by the proxy.
+func socksHandshake(conn net.Conn, user *url.Userinfo, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	methods := []byte{socksVersion, 1, socksNoAuth}
+	if user != nil {
+		methods = []byte{socksVersion, 2, socksNoAuth, socksUserPassword}
+	}
+	_, err = conn.Write(methods)
+	if err != nil {
+		return err
+	}
+	method := make([]byte, 2)
+	_, err = io.ReadFull(conn, method)
+	if err != nil {
+		return err
+	}
+	switch {
+	case method[0] != socksVersion:
+		return fmt.Errorf("socks version %d is not supported", method[0])
+	case method[1] == socksUserPassword && user != nil:
+		err = socksAuthenticate(conn, user)
+		if err != nil {
+			return err
+		}
+	case method[1] != socksNoAuth:
+		return errors.New("socks proxy requires an authentication")
+	}
+
+	request := []byte{socksVersion, socksConnect, 0}
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		request = append(append(request, socksIPv4), ip.To4()...)
+	case ip != nil:
+		request = append(append(request, socksIPv6), ip...)
+	case len(host) > 255:
+		return fmt.Errorf("host %q is too long", host)
+	default:
+		request = append(append(request, socksDomain, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(portNumber))
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+	return readSocksReply(conn)
+}
+
+// socksAuthenticate sends a user and its password to a SOCKS5 proxy.
+func socksAuthenticate(conn net.Conn, user *url.Userinfo) error {
+	password, _ := user.Password()
+	if len(user.Username()) > 255 || len(password) > 255 {
+		return errors.New("socks user or password is too long")
+	}
+	request := []byte{socksUserPasswordVersion, byte(len(user.Username()))}
+	request = append(request, user.Username()...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	_, err := conn.Write(request)
+	if err != nil {
+		return err
+	}
+	status := make([]byte, 2)
+	_, err = io.ReadFull(conn, status)
+	if err != nil {
+		return err
+	}
+	if status[1] != 0 {
+		return errors.New("socks proxy refused the user")
+	}
+	return nil
+}
+
+// readSocksReply reads the reply of a SOCKS5 proxy to a connect request, up to
+// the data of the connection.
+func readSocksReply(conn net.Conn) error {
+	head := make([]byte, 4)
+	_, err := io.ReadFull(conn, head)
+	if err != nil {
+		return err
+	}
+	switch head[1] {
+	case socksSucceeded:
+	case socksRefused:
+		return fmt.Errorf("socks proxy: %w", syscall.ECONNREFUSED)
+	case socksUnreachable:
+		return fmt.Errorf("socks proxy: %w", syscall.EHOSTUNREACH)
+	default:
+		return fmt.Errorf("socks proxy failed with reply %d", head[1])
+	}
+
+	var size int
+	switch head[3] {
+	case socksIPv4:
+		size = 4
+	case socksIPv6:
+		size = 16
+	case socksDomain:
+		length := make([]byte, 1)
+		_, err = io.ReadFull(conn, length)
+		size = int(length[0])
+	default:
+		return fmt.Errorf("socks address type %d is not supported", head[3])
+	}
+	if err != nil {
+		return err
+	}
+	// The address the proxy connected from is not used.
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+// connectHandshake asks an HTTP proxy to connect to an address with CONNECT.
+// Its response is read a byte at a time so that none of the data sent after it
+// is read.
+func connectHandshake(conn net.Conn, user *url.Userinfo, address string) error {
+	request := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	_, err := conn.Write([]byte(request + "\r\n"))
+	if err != nil {
+		return err
+	}
+
+	var response []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(response, []byte("\r\n\r\n")) {
+		if len(response) >= forwardMaxRequest {
+			return errors.New("connect response is too large")
+		}
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return err
+		}
+		response = append(response, b[0])
+	}
+
+	line, _, _ := bytes.Cut(response, []byte("\r\n"))
+	fields := bytes.Fields(line)
+	if len(fields) < 2 || !bytes.HasPrefix(fields[0], []byte("HTTP/")) {
+		return fmt.Errorf("invalid connect response %q", line)
+	}
+	if len(fields[1]) != 3 || fields[1][0] != '2' {
+		return fmt.Errorf("http proxy refused to connect: %s", bytes.Join(fields[1:], []byte(" ")))
+	}
+	return nil
+}
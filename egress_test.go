@@ -0,0 +1,61 @@
+package toxiproxy_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+func TestProxyConnectsThroughUpstreamProxy(t *testing.T) {
+	// A forward proxy is the proxy the upstream is reached through.
+	withForwardProxy(t, func(forward *toxiproxy.Proxy, echo string) {
+		for _, scheme := range []string{"socks5", "http"} {
+			proxy := NewTestProxy("test_upstream_proxy", echo)
+			proxy.UpstreamProxy = scheme + "://" + forward.Listen
+			err := proxy.Start()
+			if err != nil {
+				t.Fatal("Failed to start proxy:", err)
+			}
+
+			conn, err := net.Dial("tcp", proxy.Listen)
+			if err != nil {
+				t.Fatal("Unable to dial proxy:", err)
+			}
+			assertEcho(t, conn)
+			conn.Close()
+			proxy.Stop()
+		}
+	})
+}
+
+func TestProxyClosesClientsRefusedByUpstreamProxy(t *testing.T) {
+	withForwardProxy(t, func(forward *toxiproxy.Proxy, echo string) {
+		// Nothing listens on the upstream anymore.
+		upstream, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		upstream.Close()
+		proxy := NewTestProxy("test_upstream_proxy", upstream.Addr().String())
+		proxy.UpstreamProxy = "socks5://" + forward.Listen
+		err = proxy.Start()
+		if err != nil {
+			t.Fatal("Failed to start proxy:", err)
+		}
+		defer proxy.Stop()
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("Expected the client to be closed, got %v", err)
+		}
+	})
+}
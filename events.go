@@ -0,0 +1,176 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Number of events kept by a server unless configured otherwise.
+const DefaultEventBufferSize = 1000
+
+// Lifecycle events of proxies and their connections.
+const (
+	EventProxyStarted    = "proxy_started"
+	EventProxyStopped    = "proxy_stopped"
+	EventProxyRenamed    = "proxy_renamed"
+	EventUpstreamChanged = "upstream_changed"
+	EventListenFailed    = "listen_failed"
+	EventAccepted        = "accepted"
+	EventAcceptFailed    = "accept_failed"
+	EventDialFailed      = "dial_failed"
+	EventHandshakeFailed = "handshake_failed"
+	EventRejected        = "rejected"
+	EventHung            = "hung"
+	EventLinkClosed      = "link_closed"
+	EventUpstreamDown    = "upstream_down"
+	EventUpstreamUp      = "upstream_up"
+)
+
+type Event struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Proxy     string    `json:"proxy"`
+	Namespace string    `json:"namespace,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"`
+	Direction string    `json:"direction,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// EventBuffer keeps the last events in memory, so that a failed test can be
+// investigated without collecting the logs of the server.
+type EventBuffer struct {
+	lock   sync.Mutex
+	events []Event
+	next   int
+	full   bool
+	lastID uint64
+}
+
+func NewEventBuffer(size int) *EventBuffer {
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+	return &EventBuffer{events: make([]Event, size)}
+}
+
+// Add records an event, overwriting the oldest one when the buffer is full.
+func (b *EventBuffer) Add(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	b.events[b.next] = event
+	b.next = (b.next + 1) % len(b.events)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Recent returns the events of proxy, or of all proxies if it is empty, from
+// the oldest to the newest. Only events with an ID greater than since are
+// returned, and a positive limit only returns the newest ones.
+func (b *EventBuffer) Recent(proxy string, since uint64, limit int) []Event {
+	if b == nil {
+		return []Event{}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ordered := b.events[:b.next]
+	if b.full {
+		ordered = append(append([]Event{}, b.events[b.next:]...), ordered...)
+	}
+
+	events := []Event{}
+	for _, event := range ordered {
+		if event.ID > since && (proxy == "" || event.Proxy == proxy) {
+			events = append(events, event)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
+
+func (server *ApiServer) EventsRecent(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			server.apiError(response, ErrInvalidLimit)
+			return
+		}
+	}
+
+	var since uint64
+	if value := query.Get("since"); value != "" {
+		var err error
+		since, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			server.apiError(response, ErrInvalidSince)
+			return
+		}
+	}
+
+	events := server.Events.Recent(query.Get("proxy"), since, limit)
+	data, err := json.Marshal(events)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("EventsRecent: Failed to write response to client")
+	}
+}
+
+// event records a lifecycle event of the proxy in the server's buffer.
+func (proxy *Proxy) event(event Event) {
+	event.Proxy = proxy.name()
+	event.Namespace = proxy.namespace
+	proxy.apiServer.Events.Add(event)
+}
+
+// client returns the address of the client from the name of the link.
+func (link *ToxicLink) client(name string) string {
+	return strings.TrimSuffix(name, link.Direction())
+}
+
+// closeReason describes why the link closed, given the error writing to its
+// destination.
+func (link *ToxicLink) closeReason(name string, writeErr error) string {
+	if reason := link.proxy.timeoutReason(link.client(name)); reason != "" {
+		return reason
+	}
+	if writeErr != nil {
+		return "write: " + writeErr.Error()
+	}
+	if readErr := link.readErr.Load(); readErr != nil {
+		return "read: " + (*readErr).Error()
+	}
+	return "closed"
+}
@@ -0,0 +1,112 @@
+package toxiproxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestEventBufferKeepsLastEvents(t *testing.T) {
+	buffer := NewEventBuffer(3)
+	for _, name := range []string{"a", "b", "a", "b", "a"} {
+		buffer.Add(Event{Type: EventAccepted, Proxy: name})
+	}
+
+	events := buffer.Recent("", 0, 0)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, expected := range []string{"a", "b", "a"} {
+		if events[i].Proxy != expected {
+			t.Errorf("Expected event %d to be of proxy %s, got %s", i, expected, events[i].Proxy)
+		}
+	}
+
+	if events := buffer.Recent("a", 0, 0); len(events) != 2 {
+		t.Errorf("Expected 2 events for proxy a, got %d", len(events))
+	}
+	if events := buffer.Recent("", 0, 1); len(events) != 1 || events[0].Proxy != "a" {
+		t.Errorf("Expected only the newest event, got %+v", events)
+	}
+	if events := buffer.Recent("", 4, 0); len(events) != 1 || events[0].ID != 5 {
+		t.Errorf("Expected only the events after the 4th one, got %+v", events)
+	}
+}
+
+func waitForEvent(t *testing.T, buffer *EventBuffer, proxy, kind string) Event {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, event := range buffer.Recent(proxy, 0, 0) {
+			if event.Type == kind {
+				return event
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for a %s event, got %+v", kind, buffer.Recent(proxy, 0, 0))
+	return Event{}
+}
+
+func TestProxyRecordsEvents(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := upstream.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	proxy := NewProxy(srv, "test_events", "localhost:0", upstream.Addr().String())
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitForEvent(t, srv.Events, proxy.Name, EventAccepted)
+	closed := waitForEvent(t, srv.Events, proxy.Name, EventLinkClosed)
+	if closed.Client != conn.LocalAddr().String() || closed.Reason == "" {
+		t.Errorf("Unexpected link closed event: %+v", closed)
+	}
+
+	// Nothing listens on the upstream anymore.
+	upstream.Close()
+	conn, err = net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	failed := waitForEvent(t, srv.Events, proxy.Name, EventDialFailed)
+	if failed.Upstream != proxy.Upstream || failed.Reason == "" {
+		t.Errorf("Unexpected dial failed event: %+v", failed)
+	}
+}
+
+func TestEventsRecentInvalidLimit(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", "/events/recent?limit=-1", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// forwardHandshakeTimeout is the longest time a client of a forward proxy
+	// takes to ask for its destination.
+	forwardHandshakeTimeout = 10 * time.Second
+	// forwardMaxRequest is the size of the largest HTTP CONNECT request.
+	forwardMaxRequest = 8 << 10
+)
+
+// Versions and replies of SOCKS5.
+const (
+	socksVersion       = 5
+	socksNoAuth        = 0
+	socksNoMethod      = 0xff
+	socksConnect       = 1
+	socksIPv4          = 1
+	socksDomain        = 3
+	socksIPv6          = 4
+	socksSucceeded     = 0
+	socksFailure       = 1
+	socksUnreachable   = 4
+	socksRefused       = 5
+	socksNoCommand     = 7
+	socksNoAddressType = 8
+	socksReplyAddress  = "\x01\x00\x00\x00\x00\x00\x00" // 0.0.0.0:0
+)
+
+// forwardRequest is the destination asked for by a client of a forward proxy.
+type forwardRequest struct {
+	address string
+	socks   bool
+}
+
+// readForwardRequest reads the handshake of a client of a forward proxy, with
+// SOCKS5 or HTTP CONNECT, and returns the destination it asks for.
+func (proxy *Proxy) readForwardRequest(client net.Conn) (*forwardRequest, error) {
+	client.SetDeadline(time.Now().Add(forwardHandshakeTimeout))
+	defer client.SetDeadline(time.Time{})
+
+	var request *forwardRequest
+	first := make([]byte, 1)
+	_, err := io.ReadFull(client, first)
+	if err == nil && first[0] == socksVersion {
+		request, err = readSocksRequest(client)
+	} else if err == nil {
+		request, err = readConnectRequest(client, first[0])
+	}
+	if err != nil {
+		proxy.Logger.
+			Warn().
+			Err(err).
+			Str("client", client.RemoteAddr().String()).
+			Msg("Unable to read the destination of client")
+		proxy.event(Event{
+			Type:   EventHandshakeFailed,
+			Client: client.RemoteAddr().String(),
+			Reason: err.Error(),
+		})
+		return nil, err
+	}
+	return request, nil
+}
+
+// readSocksRequest reads the handshake of a SOCKS5 client after its version.
+// Only the clients without authentication that connect are served.
+func readSocksRequest(client net.Conn) (*forwardRequest, error) {
+	count := make([]byte, 1)
+	_, err := io.ReadFull(client, count)
+	if err != nil {
+		return nil, err
+	}
+	methods := make([]byte, count[0])
+	_, err = io.ReadFull(client, methods)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(methods, []byte{socksNoAuth}) {
+		client.Write([]byte{socksVersion, socksNoMethod})
+		return nil, errors.New("socks client requires authentication")
+	}
+	_, err = client.Write([]byte{socksVersion, socksNoAuth})
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 4)
+	_, err = io.ReadFull(client, head)
+	if err != nil {
+		return nil, err
+	}
+	if head[0] != socksVersion || head[1] != socksConnect {
+		writeSocksReply(client, socksNoCommand)
+		return nil, fmt.Errorf("socks command %d is not supported", head[1])
+	}
+
+	var host string
+	switch head[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if head[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		_, err = io.ReadFull(client, ip)
+		host = ip.String()
+	case socksDomain:
+		size := make([]byte, 1)
+		_, err = io.ReadFull(client, size)
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, size[0])
+		_, err = io.ReadFull(client, name)
+		host = string(name)
+	default:
+		writeSocksReply(client, socksNoAddressType)
+		return nil, fmt.Errorf("socks address type %d is not supported", head[3])
+	}
+	if err != nil {
+		return nil, err
+	}
+	port := make([]byte, 2)
+	_, err = io.ReadFull(client, port)
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	return &forwardRequest{address: address, socks: true}, nil
+}
+
+func writeSocksReply(client net.Conn, reply byte) error {
+	_, err := client.Write(append([]byte{socksVersion, reply, 0}, socksReplyAddress...))
+	return err
+}
+
+// readConnectRequest reads an HTTP CONNECT request, starting with its first
+// byte. The request is read a byte at a time so that none of the data sent
+// after it is read.
+func readConnectRequest(client net.Conn, first byte) (*forwardRequest, error) {
+	request := []byte{first}
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(request, []byte("\r\n\r\n")) {
+		if len(request) >= forwardMaxRequest {
+			client.Write([]byte("HTTP/1.1 431 Request Header Fields Too Large\r\n\r\n"))
+			return nil, errors.New("connect request is too large")
+		}
+		_, err := io.ReadFull(client, b)
+		if err != nil {
+			return nil, err
+		}
+		request = append(request, b[0])
+	}
+
+	line, _, _ := bytes.Cut(request, []byte("\r\n"))
+	fields := bytes.Fields(line)
+	if len(fields) != 3 || string(fields[0]) != "CONNECT" {
+		client.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\nAllow: CONNECT\r\n\r\n"))
+		return nil, fmt.Errorf("unsupported request %q", line)
+	}
+	address := string(fields[1])
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		client.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+		return nil, err
+	}
+	return &forwardRequest{address: address}, nil
+}
+
+// reply tells the client whether its destination was connected to.
+func (r *forwardRequest) reply(client net.Conn, dialErr error) error {
+	if r.socks {
+		reply := byte(socksSucceeded)
+		switch {
+		case dialErr == nil:
+		case errors.Is(dialErr, syscall.ECONNREFUSED):
+			reply = socksRefused
+		case errors.Is(dialErr, os.ErrDeadlineExceeded), errors.Is(dialErr, syscall.EHOSTUNREACH),
+			errors.Is(dialErr, syscall.ENETUNREACH):
+			reply = socksUnreachable
+		default:
+			reply = socksFailure
+		}
+		return writeSocksReply(client, reply)
+	}
+
+	status := "HTTP/1.1 200 Connection established\r\n\r\n"
+	if dialErr != nil {
+		status = "HTTP/1.1 502 Bad Gateway\r\n\r\n"
+	}
+	_, err := client.Write([]byte(status))
+	return err
+}
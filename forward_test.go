@@ -0,0 +1,191 @@
+package toxiproxy_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+// withForwardProxy runs f with a forward proxy, and the address of an echo
+// server to connect to through it.
+func withForwardProxy(t *testing.T, f func(proxy *toxiproxy.Proxy, echo string)) {
+	t.Helper()
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test_forward", "")
+	proxy.Protocol = toxiproxy.ProtocolForward
+	err = proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+	f(proxy, upstream.Addr().String())
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	msg := []byte("hello world")
+	_, err := conn.Write(msg)
+	if err != nil {
+		t.Fatal("Failed to write to proxy:", err)
+	}
+	resp := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		t.Fatal("Failed to read from proxy:", err)
+	}
+	if !bytes.Equal(resp, msg) {
+		t.Errorf("Expected %q back, got %q", msg, resp)
+	}
+}
+
+// socksConnect asks a SOCKS5 proxy for an address, and returns its reply.
+func socksConnect(t *testing.T, conn net.Conn, address string) byte {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(address)
+	addr, _ := net.ResolveTCPAddr("tcp", address)
+	request := []byte{5, 1, 0, 5, 1, 0, 3, byte(len(host))}
+	request = append(request, host...)
+	request = binary.BigEndian.AppendUint16(request, uint16(addr.Port))
+	_, err := conn.Write(request)
+	if err != nil {
+		t.Fatal("Failed to write to proxy:", err)
+	}
+
+	reply := make([]byte, 12)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		t.Fatalf("Failed to read the reply to %s:%s: %v", host, port, err)
+	}
+	if !bytes.Equal(reply[:2], []byte{5, 0}) {
+		t.Fatalf("Expected no authentication, got %v", reply[:2])
+	}
+	return reply[3]
+}
+
+func TestForwardProxyWithSocks(t *testing.T) {
+	withForwardProxy(t, func(proxy *toxiproxy.Proxy, echo string) {
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		if reply := socksConnect(t, conn, echo); reply != 0 {
+			t.Fatalf("Expected the connection to succeed, got %d", reply)
+		}
+		assertEcho(t, conn)
+
+		// Nothing listens on the port of the proxy's own client.
+		refused := conn.LocalAddr().String()
+		conn, err = net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		if reply := socksConnect(t, conn, refused); reply != 5 {
+			t.Errorf("Expected the connection to be refused, got %d", reply)
+		}
+	})
+}
+
+func TestForwardProxyAcceptsDuringASilentHandshake(t *testing.T) {
+	withForwardProxy(t, func(proxy *toxiproxy.Proxy, echo string) {
+		silent, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer silent.Close()
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if reply := socksConnect(t, conn, echo); reply != 0 {
+			t.Fatalf("Expected the connection to succeed, got %d", reply)
+		}
+		assertEcho(t, conn)
+
+		// Stopping the proxy closes the client still shaking hands.
+		proxy.Stop()
+		silent.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = silent.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("Expected the silent client to be closed, got %v", err)
+		}
+	})
+}
+
+func TestForwardProxyWithConnect(t *testing.T) {
+	withForwardProxy(t, func(proxy *toxiproxy.Proxy, echo string) {
+		_, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+			`{"type": "latency", "stream": "downstream", "attributes": {"latency": 100}}`,
+		))
+		if err != nil {
+			t.Fatal("AddToxicJson returned error:", err)
+		}
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("CONNECT " + echo + " HTTP/1.1\r\nHost: " + echo + "\r\n\r\n"))
+		if err != nil {
+			t.Fatal("Failed to write to proxy:", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal("Failed to read the response of proxy:", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected the connection to succeed, got %s", resp.Status)
+		}
+
+		// The toxics apply to the data after the handshake.
+		start := time.Now()
+		assertEcho(t, conn)
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Expected the data to be delayed, took %s", elapsed)
+		}
+
+		conn, err = net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("GET http://" + echo + "/ HTTP/1.1\r\n\r\n"))
+		if err != nil {
+			t.Fatal("Failed to write to proxy:", err)
+		}
+		resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal("Failed to read the response of proxy:", err)
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected other requests to be refused, got %s", resp.Status)
+		}
+	})
+}
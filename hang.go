@@ -0,0 +1,61 @@
+package toxiproxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+func validateHang(probability float64, timeout int, protocol string) error {
+	if probability < 0 || probability > 1 || timeout < 0 {
+		return joinError(
+			fmt.Errorf("hang_probability must be from 0 to 1, and hang_timeout not negative"),
+			ErrInvalidHang,
+		)
+	}
+	if probability > 0 && protocol == ProtocolUDP {
+		return joinError(fmt.Errorf("hang_probability only applies to TCP proxies"), ErrInvalidHang)
+	}
+	return nil
+}
+
+// hangs reports whether a client accepted by the proxy is to hang, and for how
+// long, forever if 0.
+func (proxy *Proxy) hangs() (bool, time.Duration) {
+	proxy.Toxics.Lock()
+	probability := proxy.HangProbability
+	timeout := time.Duration(proxy.HangTimeout) * time.Millisecond
+	proxy.Toxics.Unlock()
+
+	return probability > 0 && rand.Float64() < probability, timeout // #nosec G404 -- not a secret
+}
+
+// hang holds a client without connecting it to an upstream, like a backend
+// whose threads are all wedged: the client is neither read nor written to,
+// so that its writes block once the buffers of the socket are full. It is
+// closed after the timeout, or once the proxy stops.
+func (proxy *Proxy) hang(client net.Conn, timeout time.Duration, dying <-chan struct{}) {
+	proxy.Logger.
+		Info().
+		Str("client", client.RemoteAddr().String()).
+		Dur("timeout", timeout).
+		Msg("Hanging client")
+	proxy.event(Event{Type: EventHung, Client: client.RemoteAddr().String()})
+	proxy.Stats.addHung(1)
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-expired:
+	case <-dying:
+	}
+
+	proxy.Stats.addHung(-1)
+	proxy.releaseConnection()
+	client.Close()
+}
@@ -0,0 +1,101 @@
+package toxiproxy_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+func TestHangingClientsGetNoUpstream(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	var accepted atomic.Int64
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Write([]byte("hello"))
+		}
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.HangProbability = 1
+	proxy.HangTimeout = 200
+	proxy.Start()
+	defer proxy.Stop()
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	_, err = conn.Write([]byte("request"))
+	if err != nil {
+		t.Fatal("Expected the hung client to write, got", err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 5)
+	n, err := conn.Read(buf)
+	if err == nil {
+		t.Fatalf("Expected the hung client to read nothing, got %q", buf[:n])
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the client to be closed after the hang timeout, took %s", elapsed)
+	}
+	if accepted.Load() != 0 {
+		t.Errorf("Expected no connection to the upstream, got %d", accepted.Load())
+	}
+	if counters := proxy.Stats.Counters(); counters.HungConnections != 0 ||
+		counters.Connections != 0 {
+		t.Errorf("Expected the hung client to be released, got %+v", counters)
+	}
+}
+
+func TestHangingClientsAreCounted(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	proxy.HangProbability = 1
+	proxy.Start()
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	for i := 0; proxy.Stats.Counters().HungConnections != 1; i++ {
+		if i > 100 {
+			t.Fatalf("Expected a hung connection, got %+v", proxy.Stats.Counters())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Hung forever, until the proxy stops.
+	proxy.Stop()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected the hung client to be closed with the proxy")
+	}
+	if hung := proxy.Stats.Counters().HungConnections; hung != 0 {
+		t.Errorf("Expected no hung connection once stopped, got %d", hung)
+	}
+}
+
+func TestHangValidation(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	for _, input := range []*toxiproxy.Proxy{
+		{Listen: "localhost:0", Upstream: "localhost:20000", HangProbability: 1.5},
+		{Listen: "localhost:0", Upstream: "localhost:20000", HangTimeout: -1},
+		{Listen: "localhost:0", Upstream: "localhost:20000", HangProbability: 0.5,
+			Protocol: toxiproxy.ProtocolUDP},
+	} {
+		err := proxy.SetOptions(input)
+		if err == nil || err.(*toxiproxy.ApiError).Code != toxiproxy.ErrInvalidHang.Code {
+			t.Errorf("Expected a probability of %v and a timeout of %d to be invalid, got %v",
+				input.HangProbability, input.HangTimeout, err)
+		}
+	}
+}
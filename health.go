@@ -0,0 +1,429 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the health checks of the upstreams.
+const (
+	HealthCheckTCP  = "tcp"  // Connect to the upstream
+	HealthCheckHTTP = "http" // GET a path of the upstream, answered with a 2xx status
+)
+
+// What a proxy does once its upstream is down, besides reporting it.
+const (
+	OnDownDisable  = "disable"  // Disable the proxy until the upstream is up again
+	OnDownFailover = "failover" // Move the proxy to another upstream until it is up again
+)
+
+// Actions of the health check in effect while the upstream is down.
+const (
+	healthActionDisabled   = "disabled"
+	healthActionFailedOver = "failed_over"
+)
+
+// HealthCheck checks the upstream of a proxy periodically, so that a backend
+// actually down can be told from the toxics of the proxy. The checks connect
+// to the upstream as the clients of the proxy do, with its dial options. A
+// proxy without a Type is not checked.
+type HealthCheck struct {
+	Type string `json:"type,omitempty"`
+	// Path is the path of the GET requests of HTTP checks, "/" if not set.
+	Path string `json:"path,omitempty"`
+	// Interval is the number of milliseconds between two checks, and Timeout
+	// the longest a check takes, 1000 if not set. Threshold is the number of
+	// failed checks in a row after which the upstream is down, 3 if not set,
+	// and it is up again after a check succeeds.
+	Interval  int `json:"interval,omitempty"`
+	Timeout   int `json:"timeout,omitempty"`
+	Threshold int `json:"threshold,omitempty"`
+	// OnDown is OnDownDisable or OnDownFailover to act once the upstream is
+	// down, and to undo it once it is up, unless the proxy was enabled or
+	// moved meanwhile. Failover is the upstream of OnDownFailover.
+	OnDown   string `json:"on_down,omitempty"`
+	Failover string `json:"failover,omitempty"`
+}
+
+// HealthStatus is the state of the upstream of a proxy, as of its last check.
+type HealthStatus struct {
+	Healthy bool `json:"healthy"`
+	// Upstream is the upstream checked, the one the proxy failed over from
+	// while it is down.
+	Upstream  string     `json:"upstream"`
+	Failures  int        `json:"failures"` // Failed checks in a row
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	// Since is when the upstream became healthy or unhealthy, and Action what
+	// was done about it while it is down, "disabled" or "failed_over".
+	Since  *time.Time `json:"since,omitempty"`
+	Action string     `json:"action,omitempty"`
+}
+
+// UpstreamHealth is the health of the upstream of a proxy, null in JSON if
+// it is not checked.
+type UpstreamHealth struct {
+	lock   sync.Mutex
+	status *HealthStatus
+	stop   chan struct{} // Closed to stop the checks, nil if not running
+}
+
+func NewUpstreamHealth() *UpstreamHealth {
+	return &UpstreamHealth{}
+}
+
+// Status returns the state of the upstream, nil if it is not checked.
+func (h *UpstreamHealth) Status() *HealthStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.status == nil {
+		return nil
+	}
+	status := *h.status
+	return &status
+}
+
+func (h *UpstreamHealth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Status())
+}
+
+// UnmarshalJSON ignores the health sent back by clients updating a proxy.
+func (h *UpstreamHealth) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+func validateHealthCheck(check HealthCheck, protocol string) error {
+	var err error
+	switch {
+	case check.Type != "" && check.Type != HealthCheckTCP && check.Type != HealthCheckHTTP:
+		err = fmt.Errorf("type must be %s or %s", HealthCheckTCP, HealthCheckHTTP)
+	case check.Interval < 0 || check.Timeout < 0 || check.Threshold < 0:
+		err = errors.New("interval, timeout and threshold must not be negative")
+	case check.Path != "" && !strings.HasPrefix(check.Path, "/"):
+		err = fmt.Errorf("path %q must start with /", check.Path)
+	case check.OnDown != "" && check.OnDown != OnDownDisable && check.OnDown != OnDownFailover:
+		err = fmt.Errorf("on_down must be %s or %s", OnDownDisable, OnDownFailover)
+	case (check.OnDown == OnDownFailover) != (check.Failover != ""):
+		err = fmt.Errorf("failover is the upstream of on_down %s, and only of it", OnDownFailover)
+	case check.Type != "" && !needsUpstream(protocol):
+		err = errors.New("only the proxies with an upstream are checked")
+	case check.Type != "" && protocol == ProtocolUDP:
+		err = errors.New("udp proxies are not checked")
+	}
+	if err != nil {
+		return joinError(fmt.Errorf("health_check: %w", err), ErrInvalidHealthCheck)
+	}
+	return nil
+}
+
+func (check *HealthCheck) setDefaults() {
+	if check.Path == "" {
+		check.Path = "/"
+	}
+	if check.Interval == 0 {
+		check.Interval = defaultProbeInterval
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultProbeTimeout
+	}
+	if check.Threshold == 0 {
+		check.Threshold = defaultProbeThreshold
+	}
+}
+
+func (proxy *Proxy) healthCheck() HealthCheck {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	return proxy.HealthCheck
+}
+
+// watchHealth starts checking the upstream of the proxy as its health check
+// tells, once the proxy is added to a collection.
+func (proxy *Proxy) watchHealth() {
+	health := proxy.Health
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if health.stop != nil {
+		close(health.stop)
+		health.stop = nil
+	}
+	check := proxy.healthCheck()
+	if check.Type == "" {
+		health.status = nil
+		proxy.setUpstreamUp(-1)
+		return
+	}
+	check.setDefaults()
+	health.status = &HealthStatus{Healthy: true, Upstream: proxy.upstreamAddress(0)}
+	health.stop = make(chan struct{})
+	go proxy.runHealthCheck(check, health.stop)
+}
+
+// StopHealthCheck stops checking the upstream, once the proxy is removed. An
+// action of the checks in progress is abandoned.
+func (proxy *Proxy) StopHealthCheck() {
+	health := proxy.Health
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if health.stop != nil {
+		close(health.stop)
+		health.stop = nil
+	}
+	proxy.setUpstreamUp(-1)
+}
+
+// restartHealthCheck checks the upstream again if its health check changed
+// while the proxy is in a collection.
+func (proxy *Proxy) restartHealthCheck(previous HealthCheck) {
+	health := proxy.Health
+	health.lock.Lock()
+	running := health.stop != nil
+	health.lock.Unlock()
+
+	if running && proxy.healthCheck() != previous {
+		proxy.watchHealth()
+	}
+}
+
+// check checks an upstream once.
+func (check HealthCheck) check(ctx context.Context, dial DialFunc, upstream string) error {
+	if check.Type == HealthCheckTCP {
+		conn, err := dial(ctx, upstream)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx, upstream)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", "http://"+upstream+check.Path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return err
+}
+
+// runHealthCheck checks the upstream until done is closed.
+func (proxy *Proxy) runHealthCheck(check HealthCheck, done chan struct{}) {
+	ticker := time.NewTicker(time.Duration(check.Interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		upstream := proxy.checkedUpstream()
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			time.Duration(check.Timeout)*time.Millisecond,
+		)
+		dial := proxy.dialer(proxy.socketOptions(), proxy.protocol())
+		err := check.check(ctx, dial, upstream)
+		cancel()
+		proxy.recordHealth(check, upstream, err, done)
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkedUpstream returns the upstream checked: the one the proxy failed over
+// from, or its upstream.
+func (proxy *Proxy) checkedUpstream() string {
+	health := proxy.Health
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if health.status != nil && health.status.Action == healthActionFailedOver {
+		return health.status.Upstream
+	}
+	return proxy.upstreamAddress(0)
+}
+
+// recordHealth updates the state of the upstream with a check, and acts on
+// the upstream going down or up.
+func (proxy *Proxy) recordHealth(
+	check HealthCheck,
+	upstream string,
+	err error,
+	done chan struct{},
+) {
+	health := proxy.Health
+	now := time.Now()
+
+	health.lock.Lock()
+	select {
+	case <-done:
+		// Stopped while checking.
+		health.lock.Unlock()
+		return
+	default:
+	}
+	status := health.status
+	wasHealthy := status.Healthy
+	status.LastCheck = &now
+	status.Upstream = upstream
+	status.LastError = ""
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+		status.Healthy = wasHealthy && status.Failures < check.Threshold
+	} else {
+		status.Failures = 0
+		status.Healthy = true
+	}
+	healthy, action := status.Healthy, status.Action
+	if healthy != wasHealthy {
+		status.Since = &now
+	}
+	health.lock.Unlock()
+
+	if err != nil {
+		proxy.addHealthCheckFailure()
+	}
+	proxy.setUpstreamUp(boolToFloat(healthy))
+
+	switch {
+	case wasHealthy && !healthy:
+		proxy.Logger.
+			Warn().
+			Err(err).
+			Int("failures", check.Threshold).
+			Msg("Upstream is down")
+		proxy.event(Event{Type: EventUpstreamDown, Upstream: upstream, Reason: err.Error()})
+		proxy.setHealthAction(proxy.actOnDown(check, done), done)
+	case !wasHealthy && healthy:
+		proxy.Logger.Info().Msg("Upstream is up")
+		proxy.event(Event{Type: EventUpstreamUp, Upstream: upstream})
+		proxy.actOnUp(check, upstream, action, done)
+		proxy.setHealthAction("", done)
+	}
+}
+
+func (proxy *Proxy) setHealthAction(action string, done chan struct{}) {
+	health := proxy.Health
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	select {
+	case <-done:
+	default:
+		health.status.Action = action
+	}
+}
+
+// actOnDown disables or fails the proxy over once its upstream is down, and
+// returns what was done.
+func (proxy *Proxy) actOnDown(check HealthCheck, done chan struct{}) string {
+	if check.OnDown == "" {
+		return ""
+	}
+	proxy.Lock()
+	defer proxy.Unlock()
+
+	select {
+	case <-done:
+		// Removed while waiting for the lock.
+		return ""
+	default:
+	}
+	switch {
+	case check.OnDown == OnDownDisable && proxy.Enabled:
+		proxy.Logger.Warn().Msg("Disabling proxy while its upstream is down")
+		stop(proxy)
+		return healthActionDisabled
+	case check.OnDown == OnDownFailover:
+		err := proxy.switchUpstream(check.Failover, Switchover{})
+		if err != nil {
+			proxy.Logger.Err(err).Msg("Unable to fail over")
+			return ""
+		}
+		return healthActionFailedOver
+	}
+	return ""
+}
+
+// actOnUp undoes what was done once the upstream was down, unless the proxy
+// was enabled or moved meanwhile.
+func (proxy *Proxy) actOnUp(check HealthCheck, upstream, action string, done chan struct{}) {
+	if action == "" {
+		return
+	}
+	proxy.Lock()
+	defer proxy.Unlock()
+
+	select {
+	case <-done:
+		// Removed while waiting for the lock.
+		return
+	default:
+	}
+	var err error
+	switch {
+	case action == healthActionDisabled && !proxy.Enabled:
+		proxy.Logger.Info().Msg("Enabling proxy as its upstream is up")
+		err = start(proxy)
+	case action == healthActionFailedOver && proxy.Upstream == check.Failover:
+		err = proxy.switchUpstream(upstream, Switchover{})
+	}
+	if err != nil {
+		proxy.Logger.Err(err).Msg("Unable to restore proxy as its upstream is up")
+	}
+}
+
+func (proxy *Proxy) setUpstreamUp(up float64) {
+	metrics := proxy.apiServer.Metrics
+	if !metrics.proxyMetricsEnabled() {
+		return
+	}
+	if up < 0 {
+		metrics.ProxyMetrics.UpstreamUp.DeleteLabelValues(proxy.name())
+		return
+	}
+	metrics.ProxyMetrics.UpstreamUp.WithLabelValues(proxy.name()).Set(up)
+}
+
+func (proxy *Proxy) addHealthCheckFailure() {
+	metrics := proxy.apiServer.Metrics
+	if metrics.proxyMetricsEnabled() {
+		metrics.ProxyMetrics.HealthCheckFailuresTotal.WithLabelValues(proxy.name()).Inc()
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
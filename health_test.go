@@ -0,0 +1,161 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// waitForHealth waits for the upstream of a proxy to be healthy or not, and
+// returns the proxy.
+func waitForHealth(t *testing.T, name string, healthy bool) *tclient.Proxy {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		proxy, err := client.Proxy(name)
+		if err != nil {
+			t.Fatal("Unable to get proxy:", err)
+		}
+		if proxy.Health != nil && proxy.Health.Healthy == healthy && proxy.Health.LastCheck != nil {
+			return proxy
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("The upstream of %s did not become healthy: %v", name, healthy)
+	return nil
+}
+
+func TestHealthCheckDisablesTheProxyWhileTheUpstreamIsDown(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := upstream.Addr().String()
+
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "db"
+		proxy.Listen = "localhost:0"
+		proxy.Upstream = address
+		proxy.Enabled = true
+		proxy.HealthCheck = tclient.HealthCheck{
+			Type:      "tcp",
+			Interval:  20,
+			Threshold: 2,
+			OnDown:    "disable",
+		}
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		waitForHealth(t, "db", true)
+
+		upstream.Close()
+		proxy = waitForHealth(t, "db", false)
+		if proxy.Enabled || proxy.Health.Action != "disabled" || proxy.Health.LastError == "" {
+			t.Errorf("Expected the proxy to be disabled with the error, got %+v %+v", proxy, proxy.Health)
+		}
+
+		upstream, err = net.Listen("tcp", address)
+		if err != nil {
+			t.Skip("Unable to listen on the address of the upstream again:", err)
+		}
+		defer upstream.Close()
+		proxy = waitForHealth(t, "db", true)
+		if !proxy.Enabled || proxy.Health.Action != "" {
+			t.Errorf("Expected the proxy to be enabled again, got %+v %+v", proxy, proxy.Health)
+		}
+	})
+}
+
+func TestHealthCheckFailsOverWhileTheUpstreamIsDown(t *testing.T) {
+	var down atomic.Bool
+	var paths atomic.Value
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths.Store(r.URL.Path)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.NotFoundHandler())
+	defer secondary.Close()
+	primaryAddress := strings.TrimPrefix(primary.URL, "http://")
+	secondaryAddress := strings.TrimPrefix(secondary.URL, "http://")
+
+	WithServer(t, func(addr string) {
+		proxy := client.NewProxy()
+		proxy.Name = "api"
+		proxy.Listen = "localhost:0"
+		proxy.Upstream = primaryAddress
+		proxy.Enabled = true
+		proxy.HealthCheck = tclient.HealthCheck{
+			Type:      "http",
+			Path:      "/healthz",
+			Interval:  20,
+			Threshold: 1,
+			OnDown:    "failover",
+			Failover:  secondaryAddress,
+		}
+		err := proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		waitForHealth(t, "api", true)
+		if paths.Load() != "/healthz" {
+			t.Errorf("Expected the path of the check to be requested, got %v", paths.Load())
+		}
+
+		down.Store(true)
+		proxy = waitForHealth(t, "api", false)
+		if proxy.Upstream != secondaryAddress || proxy.Health.Upstream != primaryAddress {
+			t.Errorf("Expected the proxy to fail over, got %+v %+v", proxy, proxy.Health)
+		}
+		if proxy.Health.LastError != "status 503" {
+			t.Errorf("Expected the status of the check, got %q", proxy.Health.LastError)
+		}
+
+		down.Store(false)
+		proxy = waitForHealth(t, "api", true)
+		if proxy.Upstream != primaryAddress {
+			t.Errorf("Expected the proxy to be back on its upstream, got %s", proxy.Upstream)
+		}
+	})
+}
+
+func TestHealthCheckValidation(t *testing.T) {
+	WithServer(t, func(addr string) {
+		for _, check := range []tclient.HealthCheck{
+			{Type: "icmp"},
+			{Type: "http", Path: "healthz"},
+			{Type: "tcp", Interval: -1},
+			{Type: "tcp", OnDown: "failover"},
+			{Type: "tcp", OnDown: "restart"},
+		} {
+			proxy := client.NewProxy()
+			proxy.Name = "db"
+			proxy.Listen = "localhost:0"
+			proxy.Upstream = "localhost:5432"
+			proxy.HealthCheck = check
+			err := proxy.Save()
+			if !errors.Is(err, tclient.ErrInvalidHealthCheck) {
+				t.Errorf("Expected %+v to be rejected, got %v", check, err)
+			}
+		}
+
+		proxy, err := client.CreateProxy("db", "localhost:0", "localhost:5432")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		if proxy.Health != nil {
+			t.Errorf("Expected the upstream not to be checked, got %+v", proxy.Health)
+		}
+	})
+}
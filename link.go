@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/Shopify/toxiproxy/v2/stream"
 	"github.com/Shopify/toxiproxy/v2/toxics"
@@ -28,7 +31,42 @@ type ToxicLink struct {
 	input     *stream.ChanWriter
 	output    *stream.ChanReader
 	direction stream.Direction
-	Logger    *zerolog.Logger
+	span      trace.Span
+	readErr   atomic.Pointer[error]
+	// done is closed once the link stopped writing to its destination.
+	done chan struct{}
+	// sourceEOF is set once the source reached its end, so that only the
+	// write side of the destination is closed.
+	sourceEOF atomic.Bool
+	// reset is set by a toxic resetting the connection, so that both sides
+	// discard their unsent data when closed.
+	reset  atomic.Bool
+	source io.Reader
+	direct *directCopy
+	// connection is the id of the connection of the link, which seeds and
+	// scopes its toxics, clientIP the IP of its client for sticky toxics, and
+	// clientPort and upstream the port of its client and the address dialed
+	// for it, which toxics match.
+	connection uint64
+	clientIP   string
+	clientPort int
+	upstream   string
+	conn       *clientConnection
+	// bufferSize is the read buffer size of the proxy when the link started.
+	bufferSize int
+	Logger     *zerolog.Logger
+}
+
+// closeWriter is implemented by TCP connections, to send a FIN while reading
+// the other direction.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// lingerer is implemented by TCP connections, to discard unsent data when
+// reset by a toxic.
+type lingerer interface {
+	SetLinger(sec int) error
 }
 
 func NewToxicLink(
@@ -43,23 +81,37 @@ func NewToxicLink(
 			len(collection.chain[direction]),
 			cap(collection.chain[direction]),
 		),
-		proxy:     proxy,
-		toxics:    collection,
-		direction: direction,
-		Logger:    &logger,
+		proxy:      proxy,
+		toxics:     collection,
+		direction:  direction,
+		span:       trace.SpanFromContext(context.Background()),
+		bufferSize: proxy.readBufferSize(),
+		done:       make(chan struct{}),
+		Logger:     &logger,
 	}
 	// Initialize the link with ToxicStubs
 	last := make(chan *stream.StreamChunk) // The first toxic is always a noop
 	link.input = stream.NewChanWriter(last)
+	link.input.SetBufferSize(link.bufferSize)
+	if backpressure := proxy.backpressure(); backpressure != BackpressureBlock {
+		first := make(chan *stream.StreamChunk)
+		go link.hold(last, first, backpressure, proxy.backpressureBytes())
+		last = first
+	}
+	if proxy != nil {
+		link.input.SetOnBlock(proxy.Stats.addBlockedRead)
+	}
 	for i := 0; i < len(link.stubs); i++ {
 		var next chan *stream.StreamChunk
 		if i+1 < len(link.stubs) {
-			next = make(chan *stream.StreamChunk, link.toxics.chain[direction][i+1].BufferSize)
+			depth := proxy.channelDepth(link.toxics.chain[direction][i+1])
+			next = make(chan *stream.StreamChunk, depth)
 		} else {
 			next = make(chan *stream.StreamChunk)
 		}
 
 		link.stubs[i] = toxics.NewToxicStub(last, next)
+		link.stubs[i].OnReset = link.requestReset
 		last = next
 	}
 	link.output = stream.NewChanReader(last)
@@ -78,6 +130,14 @@ func (link *ToxicLink) Start(
 		Debug().
 		Str("direction", link.Direction()).
 		Msg("Setup connection")
+	link.source = source
+	if conn, ok := link.proxy.connections.get(link.client(name)); ok {
+		link.connection = conn.id
+		link.clientIP = addressHost(conn.client.RemoteAddr())
+		link.clientPort = addressPort(conn.client.RemoteAddr())
+		link.upstream = conn.address
+		link.conn = conn
+	}
 
 	labels := []string{
 		link.Direction(),
@@ -85,26 +145,30 @@ func (link *ToxicLink) Start(
 		link.proxy.Listen,
 		link.proxy.Upstream}
 
-	go link.read(labels, server, source)
+	_, link.span = tracer().Start(context.Background(), "ToxicLink "+link.Direction(),
+		trace.WithAttributes(
+			attribute.String("toxiproxy.link", name),
+			attribute.String("toxiproxy.direction", link.Direction()),
+			attribute.String("toxiproxy.proxy", link.proxy.Name),
+			attribute.String("toxiproxy.listen", link.proxy.Listen),
+			attribute.String("toxiproxy.upstream", link.proxy.Upstream),
+		),
+	)
+
+	if conn, ok := link.canCopyDirect(source); ok {
+		link.direct = &directCopy{source: conn, done: make(chan struct{})}
+		go link.copyDirect(labels, name, server, source, dest)
+	} else {
+		go link.read(labels, server, source)
+	}
 
 	for i, toxic := range link.toxics.chain[link.direction] {
-		if stateful, ok := toxic.Toxic.(toxics.StatefulToxic); ok {
-			link.stubs[i].State = stateful.NewState()
+		if i > 0 {
+			link.traceToxic("toxic.applied", toxic)
 		}
 
-		if _, ok := toxic.Toxic.(*toxics.ResetToxic); ok {
-			if err := source.(*net.TCPConn).SetLinger(0); err != nil {
-				logger.Err(err).
-					Str("toxic", toxic.Type).
-					Msg("source: Unable to setLinger(ms)")
-			}
-
-			if err := dest.(*net.TCPConn).SetLinger(0); err != nil {
-				logger.Err(err).
-					Str("toxic", toxic.Type).
-					Msg("dest: Unable to setLinger(ms)")
-			}
-		}
+		link.setState(link.stubs[i], toxic)
+		link.identify(link.stubs[i], toxic)
 
 		go link.stubs[i].Run(toxic)
 	}
@@ -112,6 +176,32 @@ func (link *ToxicLink) Start(
 	go link.write(labels, name, server, dest)
 }
 
+// identify tells a stub of a toxic about the connection of the link.
+func (link *ToxicLink) identify(stub *toxics.ToxicStub, toxic *toxics.ToxicWrapper) {
+	stub.SetSeed(toxic.StubSeed(link.connection))
+	stub.SetConnection(link.connection)
+	stub.SetClient(link.clientIP)
+	stub.SetClientPort(link.clientPort)
+	stub.SetUpstream(link.upstream)
+}
+
+// setState sets the states of a stub of the toxic starting, the shared one
+// with the other link of the connection for a paired toxic of both streams.
+func (link *ToxicLink) setState(stub *toxics.ToxicStub, toxic *toxics.ToxicWrapper) {
+	if stateful, ok := toxic.Toxic.(toxics.StatefulToxic); ok {
+		stub.State = stateful.NewState()
+	}
+	if paired, ok := toxic.Toxic.(toxics.PairedToxic); ok && toxic.Pair != nil && link.conn != nil {
+		stub.Shared = link.conn.sharedState(toxic, paired)
+	}
+}
+
+// metricLabels returns the labels of the byte counters of the link, with the
+// name the proxy has now, as it may have been renamed since the link started.
+func (link *ToxicLink) metricLabels(labels []string) []string {
+	return []string{labels[0], link.proxy.name(), labels[2], labels[3]}
+}
+
 // read copies bytes from a source to the link's input channel.
 func (link *ToxicLink) read(
 	metricLabels []string,
@@ -125,10 +215,16 @@ func (link *ToxicLink) read(
 			Int64("bytes", bytes).
 			Err(err).
 			Msg("Source terminated")
+		link.readErr.Store(&err)
+	} else {
+		link.sourceEOF.Store(true)
 	}
+	link.span.SetAttributes(
+		attribute.Int64("toxiproxy.received_bytes", bytes+link.directBytes()),
+	)
 	if server.Metrics.proxyMetricsEnabled() {
 		server.Metrics.ProxyMetrics.ReceivedBytesTotal.
-			WithLabelValues(metricLabels...).Add(float64(bytes))
+			WithLabelValues(link.metricLabels(metricLabels)...).Add(float64(bytes))
 	}
 	link.input.Close()
 }
@@ -145,42 +241,106 @@ func (link *ToxicLink) write(
 		Str("component", "ToxicLink").
 		Str("method", "write").
 		Str("link", name).
-		Str("proxy", link.proxy.Name).
+		Str("proxy", link.proxy.name()).
 		Str("link_addr", fmt.Sprintf("%p", link)).
 		Logger()
 
-	bytes, err := io.Copy(dest, link.output)
+	writer := &directionWriter{
+		link.proxy.writer(link.client(name), dest, link.direction),
+		link.proxy.Directions,
+		link.direction,
+	}
+	bytes, err := io.Copy(writer, link.output)
+	close(link.done)
+	bytes += link.directBytes()
+	if err == nil {
+		err = link.directWriteErr()
+	}
+	link.span.SetAttributes(attribute.Int64("toxiproxy.sent_bytes", bytes))
 	if err != nil {
 		logger.Warn().
 			Int64("bytes", bytes).
 			Err(err).
 			Msg("Could not write to destination")
+		link.span.RecordError(err)
+		link.span.SetStatus(codes.Error, "could not write to destination")
 	} else if server.Metrics.proxyMetricsEnabled() {
 		server.Metrics.ProxyMetrics.SentBytesTotal.
-			WithLabelValues(metricLabels...).Add(float64(bytes))
+			WithLabelValues(link.metricLabels(metricLabels)...).Add(float64(bytes))
 	}
 
-	dest.Close()
+	link.span.End()
+	link.proxy.event(Event{
+		Type:      EventLinkClosed,
+		Client:    link.client(name),
+		Direction: link.Direction(),
+		Bytes:     bytes,
+		Reason:    link.closeReason(name, err),
+	})
+	link.closeDest(dest, err)
 	logger.Trace().Msgf("Remove link %s from ToxicCollection", name)
 	link.toxics.RemoveLink(name)
-	logger.Trace().Msgf("RemoveConnection %s from Proxy %s", name, link.proxy.Name)
+	logger.Trace().Msgf("RemoveConnection %s from Proxy %s", name, link.proxy.name())
 	link.proxy.RemoveConnection(name)
 }
 
+// closeDest closes the destination once the link is done. When the source
+// reached its end, only the write side of the destination is closed so that
+// the other direction can still finish, as some protocols rely on. Both sides
+// are closed once the links of both directions are removed.
+func (link *ToxicLink) closeDest(dest io.WriteCloser, writeErr error) {
+	if link.reset.Load() {
+		link.resetConnection(dest)
+		return
+	}
+	if conn, ok := dest.(closeWriter); ok && writeErr == nil && link.sourceEOF.Load() {
+		err := conn.CloseWrite()
+		if err == nil {
+			return
+		}
+		link.Logger.Warn().Err(err).Msg("Unable to half-close destination")
+	}
+	dest.Close()
+}
+
+func (link *ToxicLink) requestReset() {
+	link.reset.Store(true)
+}
+
+// resetConnection closes the destination with a RST, and has the source sent
+// one too once the other direction closes it. Connections of custom
+// transports may not support lingering, they are closed as usual.
+func (link *ToxicLink) resetConnection(dest io.WriteCloser) {
+	if conn, ok := link.source.(lingerer); ok {
+		if err := conn.SetLinger(0); err != nil {
+			link.Logger.Err(err).Msg("source: Unable to setLinger(ms)")
+		}
+	}
+	if conn, ok := dest.(lingerer); ok {
+		if err := conn.SetLinger(0); err != nil {
+			link.Logger.Err(err).Msg("dest: Unable to setLinger(ms)")
+		}
+	}
+	dest.Close()
+}
+
 // Add a toxic to the end of the chain.
 func (link *ToxicLink) AddToxic(toxic *toxics.ToxicWrapper) {
+	link.stopDirect()
+	link.traceToxic("toxic.applied", toxic)
 	i := len(link.stubs)
 
-	newin := make(chan *stream.StreamChunk, toxic.BufferSize)
+	newin := make(chan *stream.StreamChunk, link.proxy.channelDepth(toxic))
 	link.stubs = append(link.stubs, toxics.NewToxicStub(newin, link.stubs[i-1].Output))
+	link.stubs[i].OnReset = link.requestReset
+	link.stubs[i].Late = true
 
 	// Interrupt the last toxic so that we don't have a race when moving channels
 	if link.stubs[i-1].InterruptToxic() {
 		link.stubs[i-1].Output = newin
 
-		if stateful, ok := toxic.Toxic.(toxics.StatefulToxic); ok {
-			link.stubs[i].State = stateful.NewState()
-		}
+		link.setState(link.stubs[i], toxic)
+		link.identify(link.stubs[i], toxic)
 
 		go link.stubs[i].Run(toxic)
 		go link.stubs[i-1].Run(link.toxics.chain[link.direction][i-1])
@@ -193,13 +353,24 @@ func (link *ToxicLink) AddToxic(toxic *toxics.ToxicWrapper) {
 
 // Update an existing toxic in the chain.
 func (link *ToxicLink) UpdateToxic(toxic *toxics.ToxicWrapper) {
+	link.traceToxic("toxic.updated", toxic)
+	if link.stubs[toxic.Index].InterruptToxic() {
+		go link.stubs[toxic.Index].Run(toxic)
+	}
+}
+
+// Resume an existing toxic holding the link paused.
+func (link *ToxicLink) ResumeToxic(toxic *toxics.ToxicWrapper, resumable toxics.ResumableToxic) {
+	link.traceToxic("toxic.resumed", toxic)
 	if link.stubs[toxic.Index].InterruptToxic() {
+		resumable.Resume(link.stubs[toxic.Index])
 		go link.stubs[toxic.Index].Run(toxic)
 	}
 }
 
 // Remove an existing toxic from the chain.
 func (link *ToxicLink) RemoveToxic(ctx context.Context, toxic *toxics.ToxicWrapper) {
+	link.traceToxic("toxic.removed", toxic)
 	toxic_index := toxic.Index
 	log := zerolog.Ctx(ctx).
 		With().
@@ -277,6 +448,62 @@ func (link *ToxicLink) RemoveToxic(ctx context.Context, toxic *toxics.ToxicWrapp
 	}
 }
 
+// ReorderToxics moves the stubs of the toxics of the link to their new place
+// in the chain, the stub at index i coming from index from[i], keeping their
+// states. The chunks queued between the toxics are flushed to the output of
+// the link first, in order, so that the stubs moved ahead of them can't
+// overtake them.
+func (link *ToxicLink) ReorderToxics(from []int) {
+	chain := link.toxics.chain[link.direction]
+	interrupted := make([]bool, len(link.stubs))
+	all := true
+	// The stubs are interrupted from the first, so that the ones after it
+	// still drain its output.
+	for i, stub := range link.stubs {
+		interrupted[i] = stub.InterruptToxic()
+		all = all && interrupted[i]
+	}
+
+	stubs := make([]*toxics.ToxicStub, len(link.stubs))
+	for i := range stubs {
+		stubs[i] = link.stubs[from[i]]
+	}
+	if !all {
+		// The link is closing, its stubs are only moved to the index of their
+		// toxic.
+		link.stubs = stubs
+		for i, stub := range stubs {
+			if interrupted[from[i]] {
+				go stub.Run(chain[i])
+			}
+		}
+		return
+	}
+
+	output := link.stubs[len(link.stubs)-1].Output
+	for i := len(link.stubs) - 1; i > 0; i-- {
+		for len(link.stubs[i].Input) > 0 {
+			select {
+			case output <- <-link.stubs[i].Input:
+			case <-time.After(5 * time.Second):
+				link.Logger.Error().
+					Msg("Could not write queued packets to Output while reordering toxics")
+			}
+		}
+	}
+
+	for i := 1; i < len(stubs); i++ {
+		input := make(chan *stream.StreamChunk, link.proxy.channelDepth(chain[i]))
+		stubs[i-1].Output = input
+		stubs[i].Input = input
+	}
+	stubs[len(stubs)-1].Output = output
+	link.stubs = stubs
+	for i, stub := range stubs {
+		go stub.Run(chain[i])
+	}
+}
+
 // Direction returns the direction of the link (upstream or downstream).
 func (link *ToxicLink) Direction() string {
 	return link.direction.String()
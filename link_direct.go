@@ -0,0 +1,131 @@
+package toxiproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// deadliner is implemented by connections whose blocking reads can be
+// interrupted, e.g. net.Conn.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// directCopy copies the bytes of a link straight from its source to its
+// destination while it has no toxics, skipping the chunks and channels of the
+// toxic chain. The copy is stopped by a read deadline when a toxic is added,
+// and the source is then read into the chain.
+type directCopy struct {
+	source   deadliner
+	stopping atomic.Bool
+	done     chan struct{}
+	bytes    atomic.Int64
+	writeErr atomic.Pointer[error]
+}
+
+// canCopyDirect reports whether the link can start with a direct copy. The
+// connections of a proxy with an idle timeout go through the toxic chain, so
+// that their activity is seen as it happens, and so do the ones of a disabled
+// direction, so that their data is discarded.
+func (link *ToxicLink) canCopyDirect(source io.Reader) (deadliner, bool) {
+	if len(link.stubs) > 1 || link.proxy.IdleTimeout > 0 ||
+		!link.proxy.Directions.Enabled(link.direction) {
+		return nil, false
+	}
+	conn, ok := source.(deadliner)
+	return conn, ok
+}
+
+// copyDirect copies the source to the destination until either is closed, or
+// until a toxic is added in which case it continues with read.
+func (link *ToxicLink) copyDirect(
+	metricLabels []string,
+	name string,
+	server *ApiServer,
+	source io.Reader,
+	dest io.Writer,
+) {
+	direct := link.direct
+	// The buffer is used by the connections whose destination has no ReadFrom.
+	bytes, err := io.CopyBuffer(
+		link.proxy.writer(link.client(name), dest, link.direction),
+		source,
+		make([]byte, link.bufferSize),
+	)
+	direct.bytes.Store(bytes)
+	if server.Metrics.proxyMetricsEnabled() {
+		server.Metrics.ProxyMetrics.ReceivedBytesTotal.
+			WithLabelValues(link.metricLabels(metricLabels)...).Add(float64(bytes))
+	}
+
+	if direct.stopping.Load() && errors.Is(err, os.ErrDeadlineExceeded) {
+		err = direct.source.SetReadDeadline(time.Time{})
+		close(direct.done)
+		if err == nil {
+			link.read(metricLabels, server, source)
+			return
+		}
+	} else {
+		close(direct.done)
+		if err == nil {
+			link.sourceEOF.Store(true)
+		}
+	}
+
+	if err != nil {
+		link.Logger.Warn().
+			Int64("bytes", bytes).
+			Err(err).
+			Msg("Direct copy terminated")
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "write" {
+			direct.writeErr.Store(&err)
+		} else {
+			link.readErr.Store(&err)
+		}
+	}
+	link.span.SetAttributes(attribute.Int64("toxiproxy.received_bytes", bytes))
+	link.input.Close()
+}
+
+// stopDirect stops the direct copy of the link, if any, and waits until the
+// bytes it reads go through the toxic chain.
+func (link *ToxicLink) stopDirect() {
+	direct := link.direct
+	if direct == nil {
+		return
+	}
+	if direct.stopping.CompareAndSwap(false, true) {
+		err := direct.source.SetReadDeadline(time.Now())
+		if err != nil {
+			link.Logger.Warn().Err(err).Msg("Unable to interrupt direct copy")
+		}
+	}
+	<-direct.done
+}
+
+// directBytes returns the bytes sent by the direct copy of the link.
+func (link *ToxicLink) directBytes() int64 {
+	if link.direct == nil {
+		return 0
+	}
+	return link.direct.bytes.Load()
+}
+
+// directWriteErr returns the error writing to the destination of the direct
+// copy of the link, if any.
+func (link *ToxicLink) directWriteErr() error {
+	if link.direct == nil {
+		return nil
+	}
+	if err := link.direct.writeErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
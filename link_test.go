@@ -5,10 +5,13 @@ import (
 	"encoding/binary"
 	"flag"
 	"io"
+	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
 	"github.com/Shopify/toxiproxy/v2/stream"
@@ -83,6 +86,98 @@ func TestStubInitializaationWithToxics(t *testing.T) {
 	}
 }
 
+func TestStubInitializationWithChannelDepth(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	proxy := NewProxy(srv, "test_depth", "localhost:0", "localhost:20001")
+	proxy.ChannelDepth = 16
+	proxy.ReadBufferSize = 1024
+
+	collection := proxy.Toxics
+	link := NewToxicLink(proxy, collection, stream.Downstream, zerolog.Nop())
+	go link.stubs[0].Run(collection.chain[stream.Downstream][0])
+	collection.links["test"] = link
+
+	collection.chainAddToxic(&toxics.ToxicWrapper{
+		Toxic:      new(toxics.LatencyToxic),
+		Type:       "latency",
+		Direction:  stream.Downstream,
+		BufferSize: 1024,
+		Toxicity:   1,
+	})
+	if cap(link.stubs[0].Input) != 0 {
+		t.Fatalf("Noop buffer was not initialized as 0: %d", cap(link.stubs[0].Input))
+	}
+	if cap(link.stubs[1].Input) != 16 {
+		t.Fatalf("latency buffer was not initialized as 16: %d", cap(link.stubs[1].Input))
+	}
+
+	go func() {
+		_, _ = link.input.ReadFrom(strings.NewReader(strings.Repeat("a", 4096)))
+		link.input.Close()
+	}()
+	// WriteTo writes the chunks of the link one by one.
+	chunks := &chunkRecorder{}
+	total, err := link.output.WriteTo(chunks)
+	if err != nil {
+		t.Fatal("Failed to read the link:", err)
+	}
+	if total != 4096 {
+		t.Fatalf("Expected 4096 bytes through the link, got %d", total)
+	}
+	for _, size := range chunks.sizes {
+		if size > 1024 {
+			t.Fatalf("Chunk is larger than the read buffer size: %d", size)
+		}
+	}
+}
+
+type chunkRecorder struct {
+	sizes []int
+}
+
+func (r *chunkRecorder) Write(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return len(p), nil
+}
+
+func TestActivationsAreCountedOncePerLink(t *testing.T) {
+	collection := NewToxicCollection(nil)
+	link := NewToxicLink(nil, collection, stream.Downstream, zerolog.Nop())
+	go link.stubs[0].Run(collection.chain[stream.Downstream][0])
+	collection.links["test"] = link
+
+	latency := &toxics.ToxicWrapper{
+		Toxic:     new(toxics.LatencyToxic),
+		Type:      "latency",
+		Direction: stream.Downstream,
+		Toxicity:  1,
+		Stats:     toxics.NewToxicStats(),
+	}
+	collection.chainAddToxic(latency)
+	deadline := time.Now().Add(time.Second)
+	for latency.Stats.Counters().Activations != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected 1 activation of the latency toxic")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Adding a toxic restarts the previous stub, and updating one restarts it.
+	collection.chainAddToxic(&toxics.ToxicWrapper{
+		Toxic:     new(toxics.BandwidthToxic),
+		Type:      "bandwidth",
+		Direction: stream.Downstream,
+		Toxicity:  1,
+	})
+	collection.chainUpdateToxic(latency)
+	// The stub can only be interrupted once it runs the toxic again.
+	link.stubs[1].InterruptToxic()
+	if activations := latency.Stats.Counters().Activations; activations != 1 {
+		t.Fatalf("Expected restarts not to count activations, got %d", activations)
+	}
+	link.input.Close()
+}
+
 func TestAddRemoveStubs(t *testing.T) {
 	ctx := context.Background()
 	collection := NewToxicCollection(nil)
@@ -137,6 +232,75 @@ func TestAddRemoveStubs(t *testing.T) {
 	}
 }
 
+func TestReorderToxics(t *testing.T) {
+	ctx := context.Background()
+	collection := NewToxicCollection(nil)
+	link := NewToxicLink(nil, collection, stream.Downstream, zerolog.Nop())
+	go link.stubs[0].Run(collection.chain[stream.Downstream][0])
+	collection.links["test"] = link
+
+	for _, name := range []string{"first", "second", "third"} {
+		collection.chainAddToxic(&toxics.ToxicWrapper{
+			Toxic:      new(toxics.NoopToxic),
+			Name:       name,
+			Type:       "noop",
+			Direction:  stream.Downstream,
+			BufferSize: len(name),
+			Toxicity:   1,
+		})
+	}
+	collection.chainAddToxic(&toxics.ToxicWrapper{
+		Toxic:     new(toxics.NoopToxic),
+		Name:      "upstream",
+		Type:      "noop",
+		Direction: stream.Upstream,
+		Toxicity:  1,
+	})
+
+	err := collection.ReorderToxics(ctx, []string{"first", "third", "upstream"})
+	if err != ErrInvalidToxicOrder {
+		t.Fatalf("Expected a missing toxic to be rejected, got %v", err)
+	}
+	err = collection.ReorderToxics(ctx, []string{"first", "third", "third", "upstream"})
+	if err != ErrInvalidToxicOrder {
+		t.Fatalf("Expected a toxic listed twice to be rejected, got %v", err)
+	}
+	err = collection.ReorderToxics(ctx, []string{"first", "third", "unknown", "upstream"})
+	if err != ErrToxicNotFound {
+		t.Fatalf("Expected an unknown toxic to be rejected, got %v", err)
+	}
+
+	stubs := append([]*toxics.ToxicStub(nil), link.stubs...)
+	err = collection.ReorderToxics(ctx, []string{"upstream", "first", "third", "second"})
+	if err != nil {
+		t.Fatal("Failed to reorder toxics:", err)
+	}
+	// The stubs keep the states of their toxics.
+	if link.stubs[2] != stubs[3] || link.stubs[3] != stubs[2] {
+		t.Fatal("Expected the stubs of the link to be moved with their toxics")
+	}
+	for i, name := range []string{"", "first", "third", "second"} {
+		toxic := collection.chain[stream.Downstream][i]
+		if toxic.Name != name || toxic.Index != i {
+			t.Fatalf("Expected %q at index %d, got %q at %d", name, i, toxic.Name, toxic.Index)
+		}
+		if cap(link.stubs[i].Input) != toxic.BufferSize {
+			t.Fatalf("Expected the stub %d of the link to run %s", i, name)
+		}
+	}
+
+	// Data still flows through the reordered chain.
+	n, err := link.input.Write([]byte{42})
+	if n != 1 || err != nil {
+		t.Fatalf("Write failed: %d %v", n, err)
+	}
+	buf := make([]byte, 2)
+	n, err = link.output.Read(buf)
+	if n != 1 || err != nil || buf[0] != 42 {
+		t.Fatalf("Read failed: %d %v %x", n, err, buf[0])
+	}
+}
+
 func TestNoDataDropped(t *testing.T) {
 	ctx := context.Background()
 	collection := NewToxicCollection(nil)
@@ -194,6 +358,66 @@ func TestNoDataDropped(t *testing.T) {
 	}
 }
 
+func TestNoDataReorderedByReorderingToxics(t *testing.T) {
+	ctx := context.Background()
+	collection := NewToxicCollection(nil)
+	link := NewToxicLink(nil, collection, stream.Downstream, zerolog.Nop())
+	go link.stubs[0].Run(collection.chain[stream.Downstream][0])
+	collection.links["test"] = link
+
+	names := []string{"first", "second", "third"}
+	for _, name := range names {
+		collection.chainAddToxic(&toxics.ToxicWrapper{
+			Toxic:      new(toxics.NoopToxic),
+			Name:       name,
+			Type:       "noop",
+			Direction:  stream.Downstream,
+			BufferSize: 1024,
+			Toxicity:   1,
+		})
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := uint16(0); i < 65535; i++ {
+			buf := make([]byte, 2)
+			binary.BigEndian.PutUint16(buf, i)
+			link.input.Write(buf)
+		}
+		link.input.Close()
+	}()
+	go func(ctx context.Context) {
+		reversed := []string{"third", "second", "first"}
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				collection.ReorderToxics(ctx, reversed)
+				collection.ReorderToxics(ctx, names)
+			}
+		}
+	}(ctx)
+
+	buf := make([]byte, 2)
+	for i := uint16(0); i < 65535; i++ {
+		n, err := link.output.Read(buf)
+		if n != 2 || err != nil {
+			t.Fatalf("Read failed: %d %v", n, err)
+		} else {
+			val := binary.BigEndian.Uint16(buf)
+			if val != i {
+				t.Fatalf("Read incorrect bytes: %v != %d", val, i)
+			}
+		}
+	}
+	n, err := link.output.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("Expected EOF: %d %v", n, err)
+	}
+}
+
 func TestToxicity(t *testing.T) {
 	collection := NewToxicCollection(nil)
 	link := NewToxicLink(nil, collection, stream.Downstream, zerolog.Nop())
@@ -323,3 +547,72 @@ func TestRemoveToxicWithBrokenConnection(t *testing.T) {
 	collection.chainRemoveToxic(ctx, toxics[0])
 	collection.chainRemoveToxic(ctx, toxics[1])
 }
+
+func TestDirectCopyUntilToxicAdded(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewProxy(srv, "test_direct", "localhost:0", upstream.Addr().String())
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo := func() time.Duration {
+		start := time.Now()
+		_, err := conn.Write([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadFull(conn, make([]byte, 5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+	echo()
+
+	proxy.Toxics.Lock()
+	for name, link := range proxy.Toxics.links {
+		if link.direct == nil || link.direct.stopping.Load() {
+			t.Errorf("Expected link %s to copy directly", name)
+		}
+	}
+	proxy.Toxics.Unlock()
+
+	_, err = proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "latency", "attributes": {"latency": 100}}`,
+	))
+	if err != nil {
+		t.Fatal("Failed to add toxic:", err)
+	}
+
+	if elapsed := echo(); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the toxic to delay the open connection, took %s", elapsed)
+	}
+	connections := proxy.Connections()
+	if len(connections) != 1 || connections[0].DownstreamBytes != 10 {
+		t.Errorf("Expected 10 bytes sent downstream, got %+v", connections)
+	}
+}
@@ -0,0 +1,248 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog"
+)
+
+// boundAddresses records the addresses the proxies of a server listen on, to
+// name the proxy holding the address another proxy fails to listen on.
+type boundAddresses struct {
+	sync.Mutex
+	proxies map[*Proxy]boundProxy
+}
+
+// boundProxy is a proxy of a server listening, with the addresses of its
+// listeners.
+type boundProxy struct {
+	name      string
+	namespace string
+	addresses []net.Addr
+}
+
+func newBoundAddresses() *boundAddresses {
+	return &boundAddresses{proxies: make(map[*Proxy]boundProxy)}
+}
+
+func (proxy *Proxy) boundAddresses() *boundAddresses {
+	if proxy.apiServer == nil {
+		return nil
+	}
+	return proxy.apiServer.bound
+}
+
+// add records the addresses of the listeners of a proxy that listens.
+func (bound *boundAddresses) add(proxy *Proxy) {
+	if bound == nil {
+		return
+	}
+	listeners := proxy.listeners()
+	addresses := make([]net.Addr, len(listeners))
+	for i, listener := range listeners {
+		addresses[i] = listener.Addr()
+	}
+
+	bound.Lock()
+	defer bound.Unlock()
+	bound.proxies[proxy] = boundProxy{proxy.Name, proxy.namespace, addresses}
+}
+
+// remove forgets the addresses of a proxy that stopped listening.
+func (bound *boundAddresses) remove(proxy *Proxy) {
+	if bound == nil {
+		return
+	}
+	bound.Lock()
+	defer bound.Unlock()
+	delete(bound.proxies, proxy)
+}
+
+// rename renames a proxy listening.
+func (bound *boundAddresses) rename(proxy *Proxy, name string) {
+	if bound == nil {
+		return
+	}
+	bound.Lock()
+	defer bound.Unlock()
+	if listening, ok := bound.proxies[proxy]; ok {
+		listening.name = name
+		bound.proxies[proxy] = listening
+	}
+}
+
+// holder returns the proxy listening on an address, if one does.
+func (bound *boundAddresses) holder(address net.Addr) (boundProxy, bool) {
+	if bound == nil || address == nil {
+		return boundProxy{}, false
+	}
+	bound.Lock()
+	defer bound.Unlock()
+
+	for _, proxy := range bound.proxies {
+		for _, other := range proxy.addresses {
+			if addressesOverlap(address, other) {
+				return proxy, true
+			}
+		}
+	}
+	return boundProxy{}, false
+}
+
+// describe names the proxy as seen from a namespace, the proxies of the
+// other namespaces being only named by their namespace.
+func (proxy boundProxy) describe(namespace string) string {
+	switch {
+	case proxy.namespace == namespace:
+		return "proxy " + proxy.name
+	case proxy.namespace == "":
+		return "a proxy outside of the namespaces"
+	default:
+		return "a proxy of namespace " + proxy.namespace
+	}
+}
+
+// addressesOverlap reports whether two addresses can't both be listened on:
+// the same unix socket, or the same port of the same protocol, on the same
+// IP or on all of them.
+func addressesOverlap(a, b net.Addr) bool {
+	if strings.TrimRight(a.Network(), "46") != strings.TrimRight(b.Network(), "46") {
+		return false
+	}
+	if a.Network() != "tcp" && a.Network() != "udp" {
+		return a.String() == b.String()
+	}
+	hostA, portA, errA := net.SplitHostPort(a.String())
+	hostB, portB, errB := net.SplitHostPort(b.String())
+	if errA != nil || errB != nil || portA != portB {
+		return false
+	}
+	ipA, ipB := net.ParseIP(hostA), net.ParseIP(hostB)
+	return ipA.IsUnspecified() || ipB.IsUnspecified() || ipA.Equal(ipB)
+}
+
+// listenError tells which proxy or process holds the address a proxy failed
+// to listen on because it is in use.
+func (proxy *Proxy) listenError(err error) error {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Addr == nil {
+		return joinError(err, ErrListenConflict)
+	}
+
+	if holder, ok := proxy.boundAddresses().holder(opErr.Addr); ok {
+		err = fmt.Errorf("%w, by %s", err, holder.describe(proxy.namespace))
+	} else if owner := listenOwner(opErr.Addr); owner != "" {
+		err = fmt.Errorf("%w, by %s", err, owner)
+	}
+	return joinError(err, ErrListenConflict)
+}
+
+// ListenStatus tells whether the proxies of a server can listen on an
+// address, and what holds it if they can't.
+type ListenStatus struct {
+	Address   string `json:"address"`
+	Protocol  string `json:"protocol"`
+	Available bool   `json:"available"`
+	// The proxy or the process listening on the address, if known, e.g.
+	// "proxy redis" or "process nginx (pid 412)".
+	Holder string `json:"holder,omitempty"`
+	// Why the address can't be listened on, e.g. "bind: permission denied".
+	Reason string `json:"reason,omitempty"`
+}
+
+// ListenCheck tells whether a proxy of the namespace could listen on an
+// address, e.g. GET /listen?address=localhost:3306&protocol=udp.
+func (server *ApiServer) ListenCheck(response http.ResponseWriter, request *http.Request) {
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	query := request.URL.Query()
+	status, err := server.listenStatus(
+		collection.namespace,
+		query.Get("address"),
+		protocolOf(query.Get("protocol")),
+	)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ListenCheck: Failed to write response to client")
+	}
+}
+
+// listenStatus tells whether an address of a protocol can be listened on,
+// by trying to.
+func (server *ApiServer) listenStatus(namespace, address, protocol string) (*ListenStatus, error) {
+	network := "tcp"
+	if protocol == ProtocolUDP {
+		network = "udp"
+	}
+	_, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, joinError(err, ErrInvalidListen)
+	}
+
+	var addr net.Addr
+	if network == "udp" {
+		addr, err = net.ResolveUDPAddr(network, address)
+	} else {
+		addr, err = net.ResolveTCPAddr(network, address)
+	}
+	if err != nil {
+		return nil, joinError(err, ErrInvalidListen)
+	}
+
+	status := &ListenStatus{Address: addr.String(), Protocol: network}
+	if holder, ok := server.bound.holder(addr); ok {
+		status.Holder = holder.describe(namespace)
+		status.Reason = "address already in use"
+		return status, nil
+	}
+
+	if network == "udp" {
+		var conn net.PacketConn
+		conn, err = net.ListenPacket(network, addr.String())
+		if err == nil {
+			conn.Close()
+		}
+	} else {
+		var listener net.Listener
+		listener, err = net.Listen(network, addr.String())
+		if err == nil {
+			listener.Close()
+		}
+	}
+	if err != nil {
+		status.Reason = err.Error()
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			status.Reason = opErr.Err.Error()
+		}
+		if errors.Is(err, syscall.EADDRINUSE) {
+			status.Holder = listenOwner(addr)
+		}
+		return status, nil
+	}
+	status.Available = true
+	return status, nil
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package toxiproxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listenOwner names the process listening on the port of an address, from
+// the sockets of /proc, e.g. "process nginx (pid 412)". The processes of
+// other users are not known to the server unless it runs as root.
+func listenOwner(address net.Addr) string {
+	network := address.Network()
+	if network != "tcp" && network != "udp" {
+		return ""
+	}
+	_, portText, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return ""
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return ""
+	}
+
+	for _, table := range []string{network, network + "6"} {
+		inode := socketInode(filepath.Join("/proc/net", table), port, network == "tcp")
+		if inode == "" {
+			continue
+		}
+		if owner := socketOwner(inode); owner != "" {
+			return owner
+		}
+	}
+	return ""
+}
+
+// socketInode returns the inode of the socket bound to a local port in a
+// table of /proc/net, listening if it is a TCP one.
+func socketInode(table string, port int, listening bool) string {
+	file, err := os.Open(table)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	suffix := fmt.Sprintf(":%04X", port)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // The header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !strings.HasSuffix(fields[1], suffix) {
+			continue
+		}
+		// 0A is the state of the listening sockets.
+		if listening && fields[3] != "0A" {
+			continue
+		}
+		return fields[9]
+	}
+	return ""
+}
+
+// socketOwner names the process with a file descriptor of a socket inode.
+func socketOwner(inode string) string {
+	target := "socket:[" + inode + "]"
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || link != target {
+			continue
+		}
+		pid := strings.Split(fd, "/")[2]
+		name, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil {
+			return "process " + pid
+		}
+		return fmt.Sprintf("process %s (pid %s)", strings.TrimSpace(string(name)), pid)
+	}
+	return ""
+}
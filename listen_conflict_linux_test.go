@@ -0,0 +1,37 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestListenConflictNamesTheProcess(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	WithServer(t, func(addr string) {
+		holder := fmt.Sprintf("(pid %d)", os.Getpid())
+		_, err := client.CreateProxy("redis", listener.Addr().String(), "localhost:6379")
+		if !errors.Is(err, tclient.ErrListenConflict) || !strings.HasSuffix(err.Error(), holder) {
+			t.Fatalf("Expected a listen conflict with the test, got %v", err)
+		}
+
+		status, err := client.CheckListen(listener.Addr().String(), "")
+		if err != nil {
+			t.Fatal("Unable to check the address:", err)
+		}
+		if status.Available || !strings.HasSuffix(status.Holder, holder) ||
+			status.Reason != "bind: address already in use" {
+			t.Errorf("Expected the address to be held by the test, got %+v", status)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestListenConflictNamesTheProxy(t *testing.T) {
+	WithServer(t, func(addr string) {
+		redis, err := client.CreateProxy("redis", "localhost:0", "localhost:6379")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		_, err = client.CreateProxy("cache", redis.Listen, "localhost:6379")
+		var apiErr *tclient.ApiError
+		if !errors.As(err, &apiErr) || !errors.Is(err, tclient.ErrListenConflict) {
+			t.Fatalf("Expected a listen conflict, got %v", err)
+		}
+		expected := "listen address in use: listen tcp " + redis.Listen +
+			": bind: address already in use, by proxy redis"
+		if apiErr.Message != expected {
+			t.Errorf("Expected error `%s',\n\tgot: `%s'", expected, apiErr.Message)
+		}
+
+		_, err = client.Namespace("ci").CreateProxy("redis", redis.Listen, "localhost:6379")
+		if err == nil || !errors.Is(err, tclient.ErrListenConflict) {
+			t.Fatalf("Expected a listen conflict, got %v", err)
+		}
+		expected = "listen address in use: listen tcp " + redis.Listen +
+			": bind: address already in use, by a proxy outside of the namespaces"
+		if !errors.As(err, &apiErr) || apiErr.Message != expected {
+			t.Errorf("Expected error `%s',\n\tgot: `%v'", expected, err)
+		}
+	})
+}
+
+func TestCheckListen(t *testing.T) {
+	WithServer(t, func(addr string) {
+		redis, err := client.CreateProxy("redis", "localhost:0", "localhost:6379")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		status, err := client.CheckListen(redis.Listen, "")
+		if err != nil {
+			t.Fatal("Unable to check the address:", err)
+		}
+		if status.Available || status.Holder != "proxy redis" || status.Protocol != "tcp" {
+			t.Errorf("Expected the address to be held by the proxy, got %+v", status)
+		}
+
+		_, port, _ := net.SplitHostPort(redis.Listen)
+		status, err = client.CheckListen("0.0.0.0:"+port, "")
+		if err != nil {
+			t.Fatal("Unable to check the address:", err)
+		}
+		if status.Available || status.Holder != "proxy redis" {
+			t.Errorf("Expected all the IPs to overlap the proxy, got %+v", status)
+		}
+
+		status, err = client.CheckListen("127.0.0.1:"+port, "udp")
+		if err != nil {
+			t.Fatal("Unable to check the address:", err)
+		}
+		if !status.Available || status.Protocol != "udp" {
+			t.Errorf("Expected the port to be available to UDP, got %+v", status)
+		}
+
+		err = redis.Delete()
+		if err != nil {
+			t.Fatal("Unable to delete proxy:", err)
+		}
+		status, err = client.CheckListen(redis.Listen, "")
+		if err != nil {
+			t.Fatal("Unable to check the address:", err)
+		}
+		if !status.Available || status.Holder != "" {
+			t.Errorf("Expected the address to be available, got %+v", status)
+		}
+
+		_, err = client.CheckListen("localhost", "")
+		if !errors.Is(err, tclient.ErrInvalidListen) {
+			t.Errorf("Expected an invalid address, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package toxiproxy
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// unixPrefix starts the listen addresses of unix sockets, e.g.
+// unix:/tmp/redis.sock.
+const unixPrefix = "unix:"
+
+// validateListen checks the addresses of a listen field.
+func validateListen(listen, protocol string) error {
+	addresses := strings.Split(listen, ",")
+	for _, address := range addresses {
+		var err error
+		r, rangeErr := parsePortRange(address)
+		switch {
+		case len(addresses) > 1 && address == "":
+			err = errors.New("listen addresses must not be empty")
+		case len(addresses) > 1 && (rangeErr != nil || r != nil):
+			err = errors.New("a list of listen addresses must not have ranges of ports")
+		case strings.HasPrefix(address, unixPrefix) && protocol == ProtocolUDP:
+			err = errors.New("udp proxies can't listen on unix sockets")
+		}
+		if err != nil {
+			return joinError(err, ErrInvalidListen)
+		}
+	}
+	return nil
+}
+
+// listenAddresses returns the addresses of the listen field of a proxy: an
+// address, the ports of a range, or a list of addresses separated by commas.
+func listenAddresses(listen string) ([]string, error) {
+	r, err := parsePortRange(listen)
+	if err != nil || r == nil {
+		return strings.Split(listen, ","), err
+	}
+	addresses := make([]string, r.size())
+	for i := range addresses {
+		addresses[i] = r.address(i)
+	}
+	return addresses, nil
+}
+
+// listenAll listens on each address, as a single listener.
+func (proxy *Proxy) listenAll(listen ListenFunc, addresses []string) (net.Listener, error) {
+	if len(addresses) == 1 {
+		return proxy.listenOn(listen, addresses[0])
+	}
+
+	l := &multiListener{
+		accepted: make(chan multiAccepted),
+		done:     make(chan struct{}),
+	}
+	for _, address := range addresses {
+		listener, err := proxy.listenOn(listen, address)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.listeners = append(l.listeners, listener)
+	}
+	for i, listener := range l.listeners {
+		go l.serve(i, listener)
+	}
+	return l, nil
+}
+
+// listenOn listens on a unix socket, a port of the pool, or an address with
+// listen.
+func (proxy *Proxy) listenOn(listen ListenFunc, address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		return net.Listen("unix", path)
+	}
+	if address == PoolListen {
+		return proxy.portPool().listen(listen)
+	}
+	return listen(address)
+}
+
+// listeners returns the listeners of the proxy, one for each address of a
+// range of ports or of a list.
+func (proxy *Proxy) listeners() []net.Listener {
+	if multi, ok := proxy.listener.(*multiListener); ok {
+		return multi.listeners
+	}
+	return []net.Listener{proxy.listener}
+}
+
+// listenString returns the listen field of a listening proxy, with the hosts
+// resolved and the ports listened on.
+func (proxy *Proxy) listenString() string {
+	listeners := proxy.listeners()
+	if r, _ := parsePortRange(proxy.Listen); r != nil {
+		resolved := *r
+		resolved.host, _, _ = net.SplitHostPort(listeners[0].Addr().String())
+		return resolved.String()
+	}
+	addresses := make([]string, len(listeners))
+	for i, listener := range listeners {
+		addresses[i] = listener.Addr().String()
+		if listener.Addr().Network() == "unix" {
+			addresses[i] = unixPrefix + addresses[i]
+		}
+	}
+	return strings.Join(addresses, ",")
+}
+
+// resolveListen resolves the hosts of a listen field, as they are once the
+// proxy listens on it.
+func resolveListen(listen string) (string, error) {
+	r, err := parsePortRange(listen)
+	if err == nil && r != nil {
+		addr, err := net.ResolveTCPAddr("tcp", r.address(0))
+		if err != nil {
+			return "", err
+		}
+		r.host, _, _ = net.SplitHostPort(addr.String())
+		return r.String(), nil
+	}
+
+	addresses := strings.Split(listen, ",")
+	for i, address := range addresses {
+		if strings.HasPrefix(address, unixPrefix) || address == PoolListen {
+			continue
+		}
+		addr, err := net.ResolveTCPAddr("tcp", address)
+		if err != nil {
+			return "", err
+		}
+		addresses[i] = addr.String()
+	}
+	return strings.Join(addresses, ","), nil
+}
+
+// accept accepts a client, and returns the index of the address of the range
+// or the list it was accepted on.
+func (proxy *Proxy) accept() (net.Conn, int, error) {
+	if multi, ok := proxy.listener.(*multiListener); ok {
+		return multi.acceptIndex()
+	}
+	client, err := proxy.listener.Accept()
+	return client, 0, err
+}
+
+// multiListener accepts the clients of several listeners.
+type multiListener struct {
+	listeners []net.Listener
+	accepted  chan multiAccepted
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type multiAccepted struct {
+	conn  net.Conn
+	index int
+	err   error
+}
+
+func (l *multiListener) serve(index int, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		select {
+		case l.accepted <- multiAccepted{conn: conn, index: index, err: err}:
+		case <-l.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *multiListener) Accept() (net.Conn, error) {
+	conn, _, err := l.acceptIndex()
+	return conn, err
+}
+
+// acceptIndex accepts a client, and returns the index of the listener it was
+// accepted by.
+func (l *multiListener) acceptIndex() (net.Conn, int, error) {
+	select {
+	case accepted := <-l.accepted:
+		return accepted.conn, accepted.index, accepted.err
+	case <-l.done:
+		return nil, 0, net.ErrClosed
+	}
+}
+
+func (l *multiListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		for _, listener := range l.listeners {
+			err = errors.Join(err, listener.Close())
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener.
+func (l *multiListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
@@ -0,0 +1,70 @@
+package toxiproxy_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyListensOnSeveralAddresses(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	// The paths of unix sockets are short, which the test directories may not be.
+	dir, err := os.MkdirTemp("", "toxiproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "proxy.sock")
+
+	proxy := NewTestProxy("test_listeners", upstream.Addr().String())
+	proxy.Listen = "localhost:0,unix:" + socket
+	err = proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	listen := strings.Split(proxy.Listen, ",")
+	if len(listen) != 2 || strings.HasSuffix(listen[0], ":0") || listen[1] != "unix:"+socket {
+		t.Fatalf("Expected the proxy to listen on a port and %s, got %s", socket, proxy.Listen)
+	}
+
+	_, err = proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "latency", "stream": "downstream", "attributes": {"latency": 50}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	for _, address := range [][2]string{{"tcp", listen[0]}, {"unix", socket}} {
+		conn, err := net.Dial(address[0], address[1])
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		// The toxics of the proxy apply to all of its addresses.
+		start := time.Now()
+		assertEcho(t, conn)
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected %s to be delayed, took %s", address[1], elapsed)
+		}
+		conn.Close()
+	}
+}
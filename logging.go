@@ -0,0 +1,212 @@
+package toxiproxy
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+
+	// Resets a proxy's level or format to the global setting.
+	LogSettingInherit = "inherit"
+)
+
+const logLevelUnset = math.MinInt32
+
+const (
+	logFormatUnset = iota
+	logFormatJSON
+	logFormatConsole
+)
+
+// LogSettings are the level and format of the logs, either globally or for a
+// single proxy. Empty fields are left unchanged on update.
+type LogSettings struct {
+	Proxy  string `json:"proxy,omitempty"`
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+// logControl decides which log events are written and in which format. The
+// server owns the global one, and each proxy has a child that falls back to
+// its parent for any setting it doesn't override.
+//
+// It is a zerolog.Sampler rather than a hook or a logger level, so that the
+// level can change at runtime and events are dropped before they're built.
+type logControl struct {
+	parent *logControl
+	out    io.Writer // Only set on the global control, nil if formats are fixed.
+	level  atomic.Int32
+	format atomic.Int32
+}
+
+func newLogControl(parent *logControl) *logControl {
+	control := &logControl{parent: parent}
+	control.level.Store(logLevelUnset)
+	return control
+}
+
+func (c *logControl) Level() zerolog.Level {
+	level := c.level.Load()
+	if level == logLevelUnset {
+		if c.parent == nil {
+			return zerolog.TraceLevel
+		}
+		return c.parent.Level()
+	}
+	return zerolog.Level(level)
+}
+
+func (c *logControl) Format() string {
+	format := c.format.Load()
+	if format == logFormatUnset && c.parent != nil {
+		return c.parent.Format()
+	}
+	if format == logFormatConsole {
+		return LogFormatConsole
+	}
+	return LogFormatJSON
+}
+
+// Sample implements zerolog.Sampler.
+func (c *logControl) Sample(level zerolog.Level) bool {
+	return level >= c.Level()
+}
+
+func (c *logControl) root() *logControl {
+	if c.parent == nil {
+		return c
+	}
+	return c.parent.root()
+}
+
+// Write implements io.Writer, writing JSON events as is or reformatted for the console.
+func (c *logControl) Write(p []byte) (int, error) {
+	out := c.root().out
+	if c.Format() == LogFormatConsole {
+		return zerolog.ConsoleWriter{Out: out, NoColor: true}.Write(p)
+	}
+	return out.Write(p)
+}
+
+func (c *logControl) settings() LogSettings {
+	settings := LogSettings{Level: c.Level().String(), Format: c.Format()}
+	if c.parent != nil {
+		if c.level.Load() == logLevelUnset {
+			settings.Level = LogSettingInherit
+		}
+		if c.format.Load() == logFormatUnset {
+			settings.Format = LogSettingInherit
+		}
+	}
+	return settings
+}
+
+func (c *logControl) update(input LogSettings) error {
+	level := c.level.Load()
+	switch input.Level {
+	case "":
+	case LogSettingInherit:
+		if c.parent == nil {
+			return ErrInvalidLogLevel
+		}
+		level = logLevelUnset
+	default:
+		parsed, err := zerolog.ParseLevel(input.Level)
+		if err != nil || parsed == zerolog.NoLevel {
+			return ErrInvalidLogLevel
+		}
+		level = int32(parsed)
+	}
+
+	format := c.format.Load()
+	switch input.Format {
+	case "":
+	case LogSettingInherit:
+		if c.parent == nil {
+			return ErrInvalidLogFormat
+		}
+		format = logFormatUnset
+	case LogFormatJSON, LogFormatConsole:
+		if c.root().out == nil {
+			return ErrLogFormatFixed
+		}
+		format = logFormatJSON
+		if input.Format == LogFormatConsole {
+			format = logFormatConsole
+		}
+	default:
+		return ErrInvalidLogFormat
+	}
+
+	c.level.Store(level)
+	c.format.Store(format)
+	return nil
+}
+
+// newServerLogControl takes over the level of logger, so that it can be
+// changed at runtime, and returns the logger controlled by the new control.
+func newServerLogControl(logger zerolog.Logger) (*logControl, zerolog.Logger) {
+	control := newLogControl(nil)
+	if level := logger.GetLevel(); level != zerolog.Disabled {
+		control.level.Store(int32(level))
+		logger = logger.Level(zerolog.TraceLevel)
+	}
+	return control, control.logger(logger)
+}
+
+// logger returns a copy of the logger controlled by c.
+func (c *logControl) logger(logger zerolog.Logger) zerolog.Logger {
+	if c.root().out != nil {
+		logger = logger.Output(c)
+	}
+	return logger.Sample(c)
+}
+
+// SetLogOutput makes the server write its logs to w, and allows changing the
+// log format at runtime. It should be called before any proxy is created.
+func (server *ApiServer) SetLogOutput(w io.Writer) {
+	server.logging.out = w
+	logger := server.logging.logger(*server.Logger)
+	server.Logger = &logger
+}
+
+// LogSettings returns the global log settings, or the ones of a proxy.
+func (server *ApiServer) LogSettings(proxyName string) (LogSettings, error) {
+	control := server.logging
+	if proxyName != "" {
+		proxy, err := server.Collection.Get(proxyName)
+		if err != nil {
+			return LogSettings{}, err
+		}
+		control = proxy.logging
+	}
+
+	settings := control.settings()
+	settings.Proxy = proxyName
+	return settings, nil
+}
+
+// UpdateLogSettings changes the global log settings, or the ones of
+// input.Proxy if it is set.
+func (server *ApiServer) UpdateLogSettings(input LogSettings) (LogSettings, error) {
+	control := server.logging
+	if input.Proxy != "" {
+		proxy, err := server.Collection.Get(input.Proxy)
+		if err != nil {
+			return LogSettings{}, err
+		}
+		control = proxy.logging
+	}
+
+	err := control.update(input)
+	if err != nil {
+		return LogSettings{}, err
+	}
+	return server.LogSettings(input.Proxy)
+}
@@ -0,0 +1,162 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func newLoggingTestServer(t *testing.T, level zerolog.Level) (*ApiServer, *bytes.Buffer) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	srv := NewServer(
+		NewMetricsContainer(prometheus.NewRegistry()),
+		zerolog.New(out).Level(level),
+	)
+	srv.SetLogOutput(out)
+	return srv, out
+}
+
+func TestLogSettingsGlobalLevel(t *testing.T) {
+	srv, out := newLoggingTestServer(t, zerolog.InfoLevel)
+
+	srv.Logger.Debug().Msg("hidden")
+	if out.Len() != 0 {
+		t.Fatalf("Expected debug log to be dropped, got %q", out.String())
+	}
+
+	settings, err := srv.UpdateLogSettings(LogSettings{Level: "debug"})
+	if err != nil {
+		t.Fatal("Failed to update log settings:", err)
+	}
+	if settings.Level != "debug" || settings.Format != LogFormatJSON {
+		t.Fatalf("Unexpected settings: %+v", settings)
+	}
+
+	srv.Logger.Debug().Msg("shown")
+	if !strings.Contains(out.String(), `"message":"shown"`) {
+		t.Fatalf("Expected debug log to be written, got %q", out.String())
+	}
+}
+
+func TestLogSettingsProxyOverridesAndInherits(t *testing.T) {
+	srv, out := newLoggingTestServer(t, zerolog.InfoLevel)
+
+	proxy := NewProxy(srv, "test_log_settings", "localhost:0", "upstream")
+	err := srv.Collection.Add(proxy, false)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+
+	settings, err := srv.UpdateLogSettings(LogSettings{
+		Proxy:  proxy.Name,
+		Level:  "trace",
+		Format: LogFormatConsole,
+	})
+	if err != nil {
+		t.Fatal("Failed to update log settings:", err)
+	}
+	expected := LogSettings{Proxy: proxy.Name, Level: "trace", Format: LogFormatConsole}
+	if settings != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, settings)
+	}
+
+	proxy.Logger.Trace().Msg("proxy trace")
+	srv.Logger.Debug().Msg("server debug")
+	if out.String() != "<nil> TRC proxy trace listen=localhost:0 name=test_log_settings"+
+		" upstream=upstream\n" {
+		t.Fatalf("Unexpected logs: %q", out.String())
+	}
+
+	settings, err = srv.UpdateLogSettings(LogSettings{
+		Proxy:  proxy.Name,
+		Level:  LogSettingInherit,
+		Format: LogSettingInherit,
+	})
+	if err != nil {
+		t.Fatal("Failed to update log settings:", err)
+	}
+	expected = LogSettings{Proxy: proxy.Name, Level: LogSettingInherit, Format: LogSettingInherit}
+	if settings != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, settings)
+	}
+
+	out.Reset()
+	proxy.Logger.Trace().Msg("proxy trace")
+	proxy.Logger.Info().Msg("proxy info")
+	if !strings.HasPrefix(out.String(), `{"level":"info"`) ||
+		strings.Contains(out.String(), "proxy trace") {
+		t.Fatalf("Expected proxy to use the global settings, got %q", out.String())
+	}
+}
+
+func TestLogSettingsOfANamespacedProxy(t *testing.T) {
+	srv, out := newLoggingTestServer(t, zerolog.InfoLevel)
+
+	proxy := NewProxy(srv, "redis", "localhost:0", "upstream")
+	collection := srv.Namespace("ci")
+	err := collection.Add(proxy, false)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	err = proxy.logging.update(LogSettings{Level: "trace", Format: LogFormatConsole})
+	if err != nil {
+		t.Fatal("Failed to update log settings:", err)
+	}
+
+	proxy.Logger.Trace().Msg("proxy trace")
+	if out.String() != "<nil> TRC proxy trace listen=localhost:0 name=redis namespace=ci"+
+		" upstream=upstream\n" {
+		t.Fatalf("Expected the namespaced proxy to keep its settings, got %q", out.String())
+	}
+
+	_, err = collection.Rename("redis", "cache")
+	if err != nil {
+		t.Fatal("Failed to rename proxy:", err)
+	}
+	out.Reset()
+	proxy.Logger.Trace().Msg("proxy trace")
+	if out.String() != "<nil> TRC proxy trace listen=localhost:0 name=cache namespace=ci"+
+		" upstream=upstream\n" {
+		t.Fatalf("Expected the renamed proxy to keep its settings, got %q", out.String())
+	}
+}
+
+func TestLogSettingsInvalid(t *testing.T) {
+	srv, _ := newLoggingTestServer(t, zerolog.InfoLevel)
+
+	cases := []struct {
+		input    LogSettings
+		expected error
+	}{
+		{LogSettings{Level: "loud"}, ErrInvalidLogLevel},
+		{LogSettings{Level: LogSettingInherit}, ErrInvalidLogLevel},
+		{LogSettings{Format: "xml"}, ErrInvalidLogFormat},
+		{LogSettings{Proxy: "missing", Level: "debug"}, ErrProxyNotFound},
+	}
+	for _, tc := range cases {
+		_, err := srv.UpdateLogSettings(tc.input)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("%+v: expected %v, got %v", tc.input, tc.expected, err)
+		}
+	}
+
+	settings, _ := srv.LogSettings("")
+	if settings.Level != "info" {
+		t.Fatalf("Expected level to be unchanged, got %s", settings.Level)
+	}
+}
+
+func TestLogSettingsFormatFixedWithoutOutput(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	_, err := srv.UpdateLogSettings(LogSettings{Format: LogFormatConsole})
+	if !errors.Is(err, ErrLogFormatFixed) {
+		t.Fatalf("Expected %v, got %v", ErrLogFormatFixed, err)
+	}
+}
@@ -2,6 +2,7 @@ package toxiproxy
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/Shopify/toxiproxy/v2/collectors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,6 +24,7 @@ type metricsContainer struct {
 	ProxyMetrics   *collectors.ProxyMetricCollectors
 
 	registry *prometheus.Registry
+	register sync.Once
 }
 
 func (m *metricsContainer) runtimeMetricsEnabled() bool {
@@ -38,15 +40,23 @@ func (m *metricsContainer) anyMetricsEnabled() bool {
 	return m.runtimeMetricsEnabled() || m.proxyMetricsEnabled()
 }
 
+// gatherer registers the enabled collectors on first use and returns the
+// registry they are registered with.
+func (m *metricsContainer) gatherer() prometheus.Gatherer {
+	m.register.Do(func() {
+		if m.runtimeMetricsEnabled() {
+			m.registry.MustRegister(m.RuntimeMetrics.Collectors()...)
+		}
+		if m.proxyMetricsEnabled() {
+			m.registry.MustRegister(m.ProxyMetrics.Collectors()...)
+		}
+	})
+	return m.registry
+}
+
 // handler returns an HTTP handler with the necessary collectors registered
 // via a global prometheus registry.
 func (m *metricsContainer) handler() http.Handler {
-	if m.runtimeMetricsEnabled() {
-		m.registry.MustRegister(m.RuntimeMetrics.Collectors()...)
-	}
-	if m.proxyMetricsEnabled() {
-		m.registry.MustRegister(m.ProxyMetrics.Collectors()...)
-	}
 	return promhttp.HandlerFor(
-		m.registry, promhttp.HandlerOpts{Registry: m.registry})
+		m.gatherer(), promhttp.HandlerOpts{Registry: m.registry})
 }
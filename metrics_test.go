@@ -3,12 +3,16 @@ package toxiproxy
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
@@ -54,6 +58,177 @@ func TestProxyMetricsReceivedSentBytes(t *testing.T) {
 	}
 }
 
+func TestProxyMetricsToxicLatencyAdded(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	srv.Metrics.ProxyMetrics = collectors.NewProxyMetricCollectors()
+
+	proxy := NewProxy(srv, "test_proxy_metrics_latency_added", "localhost:0", "upstream")
+	_, err := proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"name":"lag","type":"latency","stream":"upstream","attributes":{"latency":20}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	r := bufio.NewReader(bytes.NewBufferString("hello"))
+	w := &testWriteCloser{
+		bufio.NewWriter(bytes.NewBuffer([]byte{})),
+	}
+	closed := make(chan struct{})
+	linkName := "testupstream"
+	proxy.Toxics.StartLink(srv, linkName, r, &notifyWriteCloser{w, closed}, stream.Upstream)
+	<-closed
+
+	actual := prometheusOutput(t, srv, "toxiproxy_toxic_latency_added_seconds_count")
+
+	expected := []string{
+		`toxiproxy_toxic_latency_added_seconds_count{` +
+			`direction="upstream",proxy="test_proxy_metrics_latency_added",` +
+			`toxic="lag",type="latency"` +
+			`} 1`,
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf(
+			"\nexpected:\n  [%v]\ngot:\n  [%v]",
+			strings.Join(expected, "\n  "),
+			strings.Join(actual, "\n  "),
+		)
+	}
+
+	delay := proxy.Toxics.GetToxic("lag").Stats.Counters().Delay
+	// The time spent reading the chunk is not part of the added delay.
+	if delay == nil || delay.Count != 1 || delay.SumMs < 15 || delay.SumMs > 20 {
+		t.Fatalf("Expected one delay of about 20ms in toxic stats, got %+v", delay)
+	}
+}
+
+func TestProxyMetricsToxicLatencyAddedAfterReorder(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	srv.Metrics.ProxyMetrics = collectors.NewProxyMetricCollectors()
+
+	proxy := NewProxy(srv, "test_proxy_metrics_reorder", "localhost:0", "upstream")
+	for _, name := range []string{"first", "second"} {
+		_, err := proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+			`{"name":"` + name + `","type":"latency","stream":"upstream"}`,
+		))
+		if err != nil {
+			t.Fatal("AddToxicJson returned error:", err)
+		}
+	}
+	err := proxy.Toxics.ReorderToxics(context.Background(), []string{"second", "first"})
+	if err != nil {
+		t.Fatal("ReorderToxics returned error:", err)
+	}
+
+	r := bufio.NewReader(bytes.NewBufferString("hello"))
+	w := &testWriteCloser{
+		bufio.NewWriter(bytes.NewBuffer([]byte{})),
+	}
+	closed := make(chan struct{})
+	proxy.Toxics.StartLink(srv, "testupstream", r, &notifyWriteCloser{w, closed}, stream.Upstream)
+	<-closed
+
+	actual := prometheusOutput(t, srv, "toxiproxy_toxic_latency_added_seconds_count")
+
+	expected := []string{
+		`toxiproxy_toxic_latency_added_seconds_count{` +
+			`direction="upstream",proxy="test_proxy_metrics_reorder",` +
+			`toxic="first",type="latency"` +
+			`} 1`,
+		`toxiproxy_toxic_latency_added_seconds_count{` +
+			`direction="upstream",proxy="test_proxy_metrics_reorder",` +
+			`toxic="second",type="latency"` +
+			`} 1`,
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf(
+			"\nexpected:\n  [%v]\ngot:\n  [%v]",
+			strings.Join(expected, "\n  "),
+			strings.Join(actual, "\n  "),
+		)
+	}
+}
+
+func TestProxyMetricsFollowARename(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	srv.Metrics.ProxyMetrics = collectors.NewProxyMetricCollectors()
+
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	proxy := NewProxy(srv, "db", "localhost:0", upstream.Addr().String())
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+	_, err = proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"name":"lag","type":"latency","attributes":{"latency":1}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := echo(conn); err != nil {
+		t.Fatal("Failed to echo:", err)
+	}
+
+	_, err = srv.Collection.Rename("db", "primary")
+	if err != nil {
+		t.Fatal("Failed to rename proxy:", err)
+	}
+	if err := echo(conn); err != nil {
+		t.Fatal("Failed to echo:", err)
+	}
+	conn.Close()
+	waitForConnections(t, proxy, 0)
+
+	actual := prometheusOutput(t, srv, "toxiproxy_")
+	for _, line := range actual {
+		if strings.Contains(line, `proxy="db"`) {
+			t.Errorf("Expected the series of the previous name to be gone, got %s", line)
+		}
+	}
+	for _, expected := range []string{
+		`toxiproxy_proxy_connections{proxy="primary"} 0`,
+		`toxiproxy_proxy_received_bytes_total{direction="upstream",listener="` + proxy.Listen +
+			`",proxy="primary",upstream="` + proxy.Upstream + `"} 8`,
+		`toxiproxy_toxic_latency_added_seconds_count{direction="downstream",proxy="primary",` +
+			`toxic="lag",type="latency"} 1`,
+	} {
+		found := false
+		for _, line := range actual {
+			found = found || line == expected
+		}
+		if !found {
+			t.Errorf("Expected %s, got\n  %s", expected, strings.Join(actual, "\n  "))
+		}
+	}
+}
+
 func TestRuntimeMetricsBuildInfo(t *testing.T) {
 	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
 	srv.Metrics.RuntimeMetrics = collectors.NewRuntimeMetricCollectors()
@@ -87,6 +262,16 @@ func (t *testWriteCloser) Close() error {
 	return t.Flush()
 }
 
+type notifyWriteCloser struct {
+	io.WriteCloser
+	closed chan struct{}
+}
+
+func (n *notifyWriteCloser) Close() error {
+	defer close(n.closed)
+	return n.WriteCloser.Close()
+}
+
 func prometheusOutput(t *testing.T, apiServer *ApiServer, prefix string) []string {
 	t.Helper()
 
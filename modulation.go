@@ -0,0 +1,102 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// validateModulation checks waveforms for the attributes of a toxic.
+func validateModulation(modulation toxics.Modulation, toxic toxics.Toxic) error {
+	err := modulation.Validate(toxic)
+	if err != nil {
+		return joinError(err, ErrInvalidModulation)
+	}
+	return nil
+}
+
+// modulateAttributes sets the attributes following the waveforms of a toxic to
+// their values at a time, like an update of the attributes.
+func modulateAttributes(toxic *toxics.ToxicWrapper, now time.Time) error {
+	if len(toxic.Modulation) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"attributes": toxic.Modulation.Attributes(toxic.Toxic, now),
+	})
+	if err != nil {
+		return err
+	}
+	return decodeAttributes(data, toxic.Toxic)
+}
+
+// modulate starts updating the attributes of a toxic following its waveforms,
+// replacing the updates of the toxic with the same name. It is called with
+// the lock taken.
+func (c *ToxicCollection) modulate(toxic *toxics.ToxicWrapper) {
+	c.stopModulation(toxic.Name)
+	if len(toxic.Modulation) == 0 {
+		return
+	}
+	if c.modulations == nil {
+		c.modulations = make(map[string]chan struct{})
+	}
+	stop := make(chan struct{})
+	c.modulations[toxic.Name] = stop
+	go c.runModulation(toxic, stop)
+}
+
+// stopModulation stops the updates of the attributes of a toxic. It is
+// called with the lock taken.
+func (c *ToxicCollection) stopModulation(name string) {
+	if stop, ok := c.modulations[name]; ok {
+		close(stop)
+		delete(c.modulations, name)
+	}
+}
+
+// StopModulations stops the updates of the attributes of all the toxics,
+// once the proxy is removed.
+func (c *ToxicCollection) StopModulations() {
+	c.Lock()
+	defer c.Unlock()
+
+	for name := range c.modulations {
+		c.stopModulation(name)
+	}
+}
+
+func (c *ToxicCollection) runModulation(toxic *toxics.ToxicWrapper, stop chan struct{}) {
+	ticker := time.NewTicker(toxic.Modulation.Interval())
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-stop:
+			return
+		case now = <-ticker.C:
+		}
+
+		c.Lock()
+		select {
+		case <-stop:
+			// Stopped while waiting for the lock.
+			c.Unlock()
+			return
+		default:
+		}
+		for _, half := range halves(toxic) {
+			err := modulateAttributes(half, now)
+			if err != nil {
+				if c.proxy.Logger != nil {
+					c.proxy.Logger.Warn().Err(err).Str("toxic", toxic.Name).Msg("Unable to modulate toxic")
+				}
+				continue
+			}
+			c.chainUpdateToxic(half)
+		}
+		c.Unlock()
+	}
+}
@@ -0,0 +1,140 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func isInvalidModulation(err error) bool {
+	var apiErr *toxiproxy.ApiError
+	return errors.As(err, &apiErr) && apiErr.Code == toxiproxy.ErrInvalidModulation.Code
+}
+
+// modulatedRates returns the rates a bandwidth toxic had over 200ms.
+func modulatedRates(proxy *toxiproxy.Proxy, name string) map[int64]bool {
+	toxic := proxy.Toxics.GetToxic(name)
+	rates := make(map[int64]bool)
+	for range 20 {
+		proxy.Toxics.Lock()
+		rates[toxic.Toxic.(*toxics.BandwidthToxic).Rate] = true
+		proxy.Toxics.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return rates
+}
+
+func TestToxicAttributesFollowTheirModulation(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	defer proxy.Toxics.StopModulations()
+
+	_, err := proxy.Toxics.AddToxicJson(strings.NewReader(`{
+		"type": "bandwidth",
+		"stream": "both",
+		"attributes": {"rate": 1000},
+		"modulation": {
+			"rate": {"shape": "square", "min": 10, "max": 20, "period": 40, "interval": 5}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("Unable to add toxic:", err)
+	}
+
+	rates := modulatedRates(proxy, "bandwidth_both")
+	if len(rates) != 2 || !rates[10] || !rates[20] {
+		t.Errorf("Expected the rate to follow the square wave, got %v", rates)
+	}
+
+	pair := proxy.Toxics.GetToxic("bandwidth_both").Pair
+	proxy.Toxics.Lock()
+	upstream := pair.Toxic.(*toxics.BandwidthToxic).Rate
+	proxy.Toxics.Unlock()
+	if upstream != 10 && upstream != 20 {
+		t.Errorf("Expected the upstream half to follow the wave, got a rate of %d", upstream)
+	}
+
+	_, err = proxy.Toxics.UpdateToxicJson("bandwidth_both", strings.NewReader(
+		`{"modulation": null}`,
+	))
+	if err != nil {
+		t.Fatal("Unable to update toxic:", err)
+	}
+	if rates := modulatedRates(proxy, "bandwidth_both"); len(rates) != 1 {
+		t.Errorf("Expected the rate to stop changing, got %v", rates)
+	}
+}
+
+func TestToxicModulationValidation(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	defer proxy.Toxics.StopModulations()
+
+	for _, modulation := range []string{
+		`{"shared": {"shape": "sine", "max": 1, "period": 100}}`,
+		`{"unknown": {"shape": "sine", "max": 1, "period": 100}}`,
+		`{"rate": {"shape": "triangle", "max": 1, "period": 100}}`,
+		`{"rate": {"shape": "sine", "max": 1, "period": 0}}`,
+		`{"rate": {"shape": "square", "max": 1, "period": 100, "duty": 2}}`,
+		`{"rate": {"shape": "custom", "period": 100}}`,
+	} {
+		_, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+			`{"type": "bandwidth", "modulation": ` + modulation + `}`,
+		))
+		if !isInvalidModulation(err) {
+			t.Errorf("Expected %s to be invalid, got %v", modulation, err)
+		}
+	}
+
+	_, err := proxy.Toxics.AddToxicJson(strings.NewReader(`{"type": "bandwidth"}`))
+	if err != nil {
+		t.Fatal("Unable to add toxic:", err)
+	}
+	_, err = proxy.Toxics.UpdateToxicJson("bandwidth_downstream", strings.NewReader(
+		`{"modulation": {"drop": {"shape": "sine", "max": 1, "period": 100}}}`,
+	))
+	if !isInvalidModulation(err) {
+		t.Errorf("Expected the update to be invalid, got %v", err)
+	}
+	if toxic := proxy.Toxics.GetToxic("bandwidth_downstream"); len(toxic.Modulation) != 0 {
+		t.Errorf("Expected the toxic to keep no modulation, got %v", toxic.Modulation)
+	}
+}
+
+func TestRejectedToxicUpdateLeavesTheToxic(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	defer proxy.Toxics.StopModulations()
+
+	_, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "bandwidth", "stream": "both", "toxicity": 1, "attributes": {"rate": 1000}}`,
+	))
+	if err != nil {
+		t.Fatal("Unable to add toxic:", err)
+	}
+
+	for _, update := range []string{
+		`{"attributes": {"rate": 10}, "toxicity": 0.5,
+			"modulation": {"rate": {"shape": "sine", "max": 1, "period": 0}}}`,
+		`{"attributes": {"rate": 10}, "toxicity": 0.5,
+			"modulation": {"rate": {"shape": "sine", "max": 20, "period": 100}},
+			"match": {"client_ports": "http"}}`,
+	} {
+		_, err = proxy.Toxics.UpdateToxicJson("bandwidth_both", strings.NewReader(update))
+		if err == nil {
+			t.Fatalf("Expected %s to be rejected", update)
+		}
+
+		toxic := proxy.Toxics.GetToxic("bandwidth_both")
+		for _, half := range []*toxics.ToxicWrapper{toxic, toxic.Pair} {
+			proxy.Toxics.Lock()
+			rate := half.Toxic.(*toxics.BandwidthToxic).Rate
+			proxy.Toxics.Unlock()
+			if rate != 1000 || half.Toxicity != 1 || half.Modulation != nil || half.Match != nil {
+				t.Errorf("Expected %s to leave the %s half as it was, got a rate of %d, %+v",
+					update, half.Direction, rate, half)
+			}
+		}
+	}
+}
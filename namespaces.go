@@ -0,0 +1,146 @@
+package toxiproxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// namespacePattern matches the names of namespaces, which are part of the
+// paths of the API.
+const namespacePattern = `[A-Za-z0-9_.-]+`
+
+var namespaceName = regexp.MustCompile(`^` + namespacePattern + `$`)
+
+// namespaces holds the proxies of the namespaces of a server, so that the
+// proxies of independent teams or parallel CI pipelines can have the same
+// names. The proxies outside of a namespace are the Collection of the server.
+type namespaces struct {
+	sync.Mutex
+	collections map[string]*ProxyCollection
+	tokens      map[string]string // The namespace of each token
+}
+
+func newNamespaces() *namespaces {
+	return &namespaces{
+		collections: make(map[string]*ProxyCollection),
+		tokens:      make(map[string]string),
+	}
+}
+
+// Namespace returns the proxies of a namespace, created empty if it has
+// none, or the Collection of the server for the empty name.
+func (server *ApiServer) Namespace(name string) *ProxyCollection {
+	if name == "" {
+		return server.Collection
+	}
+	server.namespaces.Lock()
+	defer server.namespaces.Unlock()
+
+	collection, ok := server.namespaces.collections[name]
+	if !ok {
+		collection = NewProxyCollection()
+		collection.namespace = name
+		server.namespaces.collections[name] = collection
+	}
+	return collection
+}
+
+// SetNamespaceTokens restricts namespaces to the requests authorized with a
+// bearer token, given for each namespace. The requests with the token of a
+// namespace are scoped to it, even without its path.
+func (server *ApiServer) SetNamespaceTokens(tokens map[string]string) error {
+	namespaces := make(map[string]string, len(tokens))
+	for namespace, token := range tokens {
+		if !namespaceName.MatchString(namespace) {
+			return fmt.Errorf("%q is not a valid namespace name", namespace)
+		}
+		if token == "" {
+			return fmt.Errorf("the token of namespace %s is empty", namespace)
+		}
+		if other, ok := namespaces[token]; ok {
+			return fmt.Errorf("namespaces %s and %s have the same token", namespace, other)
+		}
+		namespaces[token] = namespace
+	}
+
+	server.namespaces.Lock()
+	defer server.namespaces.Unlock()
+	server.namespaces.tokens = namespaces
+	return nil
+}
+
+// collection returns the proxies of the namespace of a request, given by its
+// path or its token. A namespace with a token is only reachable with it.
+func (server *ApiServer) collection(request *http.Request) (*ProxyCollection, error) {
+	namespace := mux.Vars(request)["namespace"]
+	token, _ := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+
+	server.namespaces.Lock()
+	scope, scoped := server.namespaces.tokens[token]
+	restricted := false
+	for _, other := range server.namespaces.tokens {
+		restricted = restricted || other == namespace
+	}
+	server.namespaces.Unlock()
+
+	switch {
+	case scoped && namespace == "":
+		namespace = scope
+	case scoped && namespace != scope:
+		return nil, joinError(
+			fmt.Errorf("the token is the one of namespace %s", scope),
+			ErrNamespaceForbidden,
+		)
+	case !scoped && restricted:
+		return nil, joinError(
+			fmt.Errorf("namespace %s needs its token", namespace),
+			ErrNamespaceForbidden,
+		)
+	}
+	return server.Namespace(namespace), nil
+}
+
+// setNamespace records the namespace a proxy is added to, in its events and
+// its logs. It is called before the proxy starts.
+func (proxy *Proxy) setNamespace(namespace string) {
+	if namespace == "" || proxy.namespace == namespace {
+		return
+	}
+	proxy.namespace = namespace
+	proxy.Logger = proxy.newLogger()
+}
+
+// proxy returns the proxy named by the path of a request, in its namespace.
+func (server *ApiServer) proxy(request *http.Request) (*Proxy, error) {
+	collection, err := server.collection(request)
+	if err != nil {
+		return nil, err
+	}
+	return collection.Get(mux.Vars(request)["proxy"])
+}
+
+// NamespaceDelete deletes the proxies of a namespace, e.g. once the CI
+// pipeline using it is done.
+func (server *ApiServer) NamespaceDelete(response http.ResponseWriter, request *http.Request) {
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = collection.Clear()
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err = response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("NamespaceDelete: Failed to write headers to client")
+	}
+}
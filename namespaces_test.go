@@ -0,0 +1,130 @@
+package toxiproxy_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Shopify/toxiproxy/v2"
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestNamespacesHaveTheirOwnProxies(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := toxiproxy.New(
+		toxiproxy.WithListener(listener),
+		toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+	go server.Listen("")
+	defer server.Shutdown()
+
+	client := tclient.NewClient(listener.Addr().String())
+	err = client.WaitForReady(context.Background())
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+
+	clients := []*tclient.Client{client, client.Namespace("ci-1"), client.Namespace("ci-2")}
+	for _, c := range clients {
+		proxy, err := c.CreateProxy("redis", "localhost:0", "localhost:6379")
+		if err != nil {
+			t.Fatal("Unable to create a proxy of the same name:", err)
+		}
+		defer proxy.Delete()
+		_, err = proxy.AddToxic("latency", "latency", "", 1, tclient.Attributes{"latency": 100})
+		if err != nil {
+			t.Fatal("Unable to add toxic:", err)
+		}
+	}
+
+	// Resetting a namespace only resets its own proxies.
+	err = clients[1].ResetState()
+	if err != nil {
+		t.Fatal("Unable to reset the namespace:", err)
+	}
+	for i, c := range clients {
+		proxy, err := c.Proxy("redis")
+		if err != nil {
+			t.Fatal("Unable to retrieve proxy:", err)
+		}
+		if expected := i != 1; (len(proxy.ActiveToxics) == 1) != expected {
+			t.Errorf("Expected the toxic of client %d to be kept: %t, got %v",
+				i, expected, proxy.ActiveToxics)
+		}
+	}
+
+	err = clients[1].DeleteNamespace()
+	if err != nil {
+		t.Fatal("Unable to delete the namespace:", err)
+	}
+	for i, c := range clients {
+		proxies, err := c.Proxies()
+		if err != nil {
+			t.Fatal("Unable to list proxies:", err)
+		}
+		if expected := i != 1; (len(proxies) == 1) != expected {
+			t.Errorf("Expected the proxy of client %d to be kept: %t, got %v", i, expected, proxies)
+		}
+	}
+}
+
+func TestNamespaceTokens(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := toxiproxy.New(
+		toxiproxy.WithListener(listener),
+		toxiproxy.WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+	err = server.SetNamespaceTokens(map[string]string{"team-a": "secret-a", "team-b": "secret-b"})
+	if err != nil {
+		t.Fatal("Unable to set the tokens:", err)
+	}
+	go server.Listen("")
+	defer server.Shutdown()
+
+	client := tclient.NewClient(listener.Addr().String())
+	err = client.WaitForReady(context.Background())
+	if err != nil {
+		t.Fatal("Server did not start:", err)
+	}
+
+	_, err = client.Namespace("team-a").Proxies()
+	if !errors.Is(err, tclient.ErrNamespaceForbidden) {
+		t.Fatalf("Expected the namespace to need its token, got %v", err)
+	}
+
+	// The requests with the token of a namespace are scoped to it.
+	client.Header = http.Header{"Authorization": {"Bearer secret-a"}}
+	proxy, err := client.CreateProxy("redis", "localhost:0", "localhost:6379")
+	if err != nil {
+		t.Fatal("Unable to create proxy:", err)
+	}
+	defer proxy.Delete()
+	proxies, err := client.Namespace("team-a").Proxies()
+	if err != nil || len(proxies) != 1 {
+		t.Fatalf("Expected the proxy in the namespace of the token, got %v and %v", proxies, err)
+	}
+	_, err = client.Namespace("team-b").Proxies()
+	if !errors.Is(err, tclient.ErrNamespaceForbidden) {
+		t.Fatalf("Expected the token to be refused by another namespace, got %v", err)
+	}
+
+	proxies, err = tclient.NewClient(listener.Addr().String()).Proxies()
+	if err != nil || len(proxies) != 0 {
+		t.Fatalf("Expected no proxy outside of namespaces, got %v and %v", proxies, err)
+	}
+
+	err = server.SetNamespaceTokens(map[string]string{"team-a": "secret", "team-b": "secret"})
+	if err == nil {
+		t.Error("Expected namespaces sharing a token to be refused")
+	}
+}
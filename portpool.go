@@ -0,0 +1,64 @@
+package toxiproxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// PoolListen is the listen address of the proxies listening on a free port of
+// the pool of their server, or on an ephemeral port of localhost without a
+// pool.
+const PoolListen = "0"
+
+// portPool hands the ports of a range out to the proxies listening on
+// PoolListen, one after the other.
+type portPool struct {
+	sync.Mutex
+	ports *portRange
+	next  int
+}
+
+// SetPortPool makes the proxies listening on PoolListen listen on a free port
+// of a range, e.g. localhost:20000-20099, so that the proxies of parallel jobs
+// don't collide with the ports of other services.
+func (server *ApiServer) SetPortPool(ports string) error {
+	r, err := parsePortRange(ports)
+	if err == nil && r == nil {
+		err = fmt.Errorf("%q is not a range of ports", ports)
+	}
+	if err != nil {
+		return err
+	}
+	server.ports = &portPool{ports: r}
+	return nil
+}
+
+func (proxy *Proxy) portPool() *portPool {
+	if proxy.apiServer == nil {
+		return nil
+	}
+	return proxy.apiServer.ports
+}
+
+// listen listens with listen on the next free port of the pool.
+func (pool *portPool) listen(listen ListenFunc) (net.Listener, error) {
+	if pool == nil {
+		return listen("localhost:0")
+	}
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	var err error
+	for range pool.ports.size() {
+		address := pool.ports.address(pool.next)
+		pool.next = (pool.next + 1) % pool.ports.size()
+		var listener net.Listener
+		listener, err = listen(address)
+		if err == nil {
+			return listener, nil
+		}
+	}
+	return nil, fmt.Errorf("no free port in the pool %s: %w", pool.ports, err)
+}
@@ -0,0 +1,86 @@
+package toxiproxy_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2"
+)
+
+func TestProxiesListenOnPortPool(t *testing.T) {
+	listeners, pool := listenRange(t, 3)
+	// The first port of the pool is taken, the others are free.
+	defer listeners[0].Close()
+	listeners[1].Close()
+	listeners[2].Close()
+
+	srv := toxiproxy.NewServer(
+		toxiproxy.NewMetricsContainer(prometheus.NewRegistry()),
+		zerolog.Nop(),
+	)
+	err := srv.SetPortPool(pool)
+	if err != nil {
+		t.Fatal("Failed to set the port pool:", err)
+	}
+
+	for i, listener := range listeners[1:] {
+		proxy := toxiproxy.NewProxy(srv, fmt.Sprint("pool", i), toxiproxy.PoolListen, "localhost:20000")
+		err = srv.Collection.Add(proxy, true)
+		if err != nil {
+			t.Fatal("Failed to add proxy:", err)
+		}
+		defer proxy.Stop()
+		if proxy.Listen != listener.Addr().String() {
+			t.Errorf("Expected proxy %d to listen on %s, got %s", i, listener.Addr(), proxy.Listen)
+		}
+	}
+
+	proxy := toxiproxy.NewProxy(srv, "full", toxiproxy.PoolListen, "localhost:20000")
+	err = srv.Collection.Add(proxy, true)
+	if err == nil {
+		proxy.Stop()
+		t.Error("Expected the pool to be full")
+	}
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", "/proxies/pool0/listen", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.Code)
+	}
+	var listen struct {
+		Listen string `json:"listen"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &listen)
+	if err != nil {
+		t.Fatal("Failed to read the response:", err)
+	}
+	if listen.Listen != listeners[1].Addr().String() {
+		t.Errorf("Expected the listen address of the proxy, got %s", listen.Listen)
+	}
+
+	if srv.SetPortPool("localhost:20000") == nil {
+		t.Error("Expected a single port to be an invalid pool")
+	}
+}
+
+func TestProxyListensOnEphemeralPortWithoutPool(t *testing.T) {
+	proxy := NewTestProxy("test_pool", "localhost:20000")
+	proxy.Listen = toxiproxy.PoolListen
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	addr, err := net.ResolveTCPAddr("tcp", proxy.Listen)
+	if err != nil || !addr.IP.IsLoopback() {
+		t.Errorf("Expected the proxy to listen on localhost, got %s", proxy.Listen)
+	}
+}
@@ -0,0 +1,91 @@
+package toxiproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxPortRange is the largest number of ports of a range, so that a mistyped
+// range does not open thousands of listeners.
+const maxPortRange = 1024
+
+// portRange is a range of ports of a host, written host:first-last, e.g.
+// localhost:7000-7010.
+type portRange struct {
+	host        string
+	first, last int
+}
+
+// parsePortRange parses a range of ports, nil if the address has a single
+// port.
+func parsePortRange(address string) (*portRange, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(port, "-")
+	if !ok {
+		return nil, nil
+	}
+	firstPort, err := strconv.ParseUint(first, 10, 16)
+	lastPort, lastErr := strconv.ParseUint(last, 10, 16)
+	if err != nil || lastErr != nil || firstPort == 0 || lastPort < firstPort {
+		return nil, fmt.Errorf("invalid port range %q", port)
+	}
+	if lastPort-firstPort >= maxPortRange {
+		return nil, fmt.Errorf("port range %q has more than %d ports", port, maxPortRange)
+	}
+	return &portRange{host: host, first: int(firstPort), last: int(lastPort)}, nil
+}
+
+func (r *portRange) size() int {
+	return r.last - r.first + 1
+}
+
+// address returns the address of the port of an index of the range.
+func (r *portRange) address(index int) string {
+	return net.JoinHostPort(r.host, strconv.Itoa(r.first+index))
+}
+
+func (r *portRange) String() string {
+	return net.JoinHostPort(r.host, fmt.Sprintf("%d-%d", r.first, r.last))
+}
+
+// validatePortRanges checks that a proxy listening on a range of ports has an
+// upstream range of as many ports, each port of one connecting to the port of
+// the other at the same index.
+func validatePortRanges(listen, upstream string) error {
+	listenRange, err := parsePortRange(listen)
+	var upstreamRange *portRange
+	if err == nil {
+		upstreamRange, err = parsePortRange(upstream)
+	}
+	switch {
+	case err != nil:
+	case listenRange == nil && upstreamRange != nil:
+		err = errors.New("upstream is a range of ports, but listen is not")
+	case listenRange != nil && (upstreamRange == nil || upstreamRange.size() != listenRange.size()):
+		err = errors.New("listen and upstream must be ranges of as many ports")
+	}
+	if err != nil {
+		return joinError(err, ErrInvalidPortRange)
+	}
+	return nil
+}
+
+// upstreamAddress returns the upstream of the clients accepted on the port of
+// an index of the range the proxy listens on.
+func (proxy *Proxy) upstreamAddress(index int) string {
+	proxy.Toxics.Lock()
+	defer proxy.Toxics.Unlock()
+
+	// It was validated when set.
+	r, _ := parsePortRange(proxy.Upstream)
+	if r == nil {
+		return proxy.Upstream
+	}
+	return r.address(index)
+}
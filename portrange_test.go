@@ -0,0 +1,98 @@
+package toxiproxy_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenRange listens on a range of consecutive ports of localhost.
+func listenRange(t *testing.T, size int) ([]net.Listener, string) {
+	t.Helper()
+	for attempt := 0; attempt < 10; attempt++ {
+		first, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := first.Addr().(*net.TCPAddr).Port
+		listeners := []net.Listener{first}
+		for i := 1; i < size; i++ {
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port+i))
+			if err != nil {
+				break
+			}
+			listeners = append(listeners, listener)
+		}
+		if len(listeners) == size {
+			return listeners, fmt.Sprintf("127.0.0.1:%d-%d", port, port+size-1)
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+	t.Fatal("Unable to find a range of free ports")
+	return nil, ""
+}
+
+func TestProxyListensOnPortRange(t *testing.T) {
+	upstreams, upstreamRange := listenRange(t, 3)
+	for i, upstream := range upstreams {
+		defer upstream.Close()
+		go func() {
+			for {
+				conn, err := upstream.Accept()
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(conn, "%d", i)
+				conn.Close()
+			}
+		}()
+	}
+	// The ports are free again for the proxy.
+	listeners, listen := listenRange(t, 3)
+	for _, listener := range listeners {
+		listener.Close()
+	}
+
+	proxy := NewTestProxy("test_range", upstreamRange)
+	proxy.Listen = listen
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+	if proxy.Listen != listen {
+		t.Errorf("Expected the proxy to listen on %s, got %s", listen, proxy.Listen)
+	}
+
+	_, err = proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "latency", "stream": "downstream", "attributes": {"latency": 50}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	for i, listener := range listeners {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		start := time.Now()
+		data, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal("Failed to read from proxy:", err)
+		}
+		if string(data) != fmt.Sprint(i) {
+			t.Errorf("Expected port %d to connect to upstream %d, got %q", i, i, data)
+		}
+		// The toxics of the proxy apply to all of its ports.
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected port %d to be delayed, took %s", i, elapsed)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// Preset is a named chain of toxics simulating a common network, so that
+// users don't need to work out realistic numbers themselves.
+type Preset struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Toxics      []PresetToxic `json:"toxics"`
+}
+
+type PresetToxic struct {
+	Type       string                 `json:"type"`
+	Stream     string                 `json:"stream"`
+	Toxicity   float32                `json:"toxicity"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// ToxicName is the name of the toxic added by preset, unique per preset so
+// that a preset can be removed without touching other toxics.
+func (t PresetToxic) ToxicName(preset string) string {
+	return preset + "_" + t.Type + "_" + t.Stream
+}
+
+// Latencies are per direction, a round trip is twice as long. Bandwidths are
+// in KB/s, downstream being the download speed of the client.
+var Presets = map[string]Preset{
+	"3g": {
+		Name:        "3g",
+		Description: "mobile 3G: ~200ms round trip with jitter, 2Mbps down, 768Kbps up",
+		Toxics: []PresetToxic{
+			{"latency", "downstream", 1, map[string]interface{}{"latency": 100, "jitter": 50}},
+			{"latency", "upstream", 1, map[string]interface{}{"latency": 100, "jitter": 50}},
+			{"bandwidth", "downstream", 1, map[string]interface{}{"rate": 250}},
+			{"bandwidth", "upstream", 1, map[string]interface{}{"rate": 96}},
+		},
+	},
+	"satellite": {
+		Name:        "satellite",
+		Description: "geostationary satellite: ~600ms round trip, 10Mbps down, 3Mbps up",
+		Toxics: []PresetToxic{
+			{"latency", "downstream", 1, map[string]interface{}{"latency": 300, "jitter": 20}},
+			{"latency", "upstream", 1, map[string]interface{}{"latency": 300, "jitter": 20}},
+			{"bandwidth", "downstream", 1, map[string]interface{}{"rate": 1250}},
+			{"bandwidth", "upstream", 1, map[string]interface{}{"rate": 375}},
+		},
+	},
+	"lossy-wifi": {
+		Name: "lossy-wifi",
+		Description: "congested wifi: retransmissions show up as latency spikes " +
+			"and fragmented reads, 20Mbps",
+		Toxics: []PresetToxic{
+			{"latency", "downstream", 1, map[string]interface{}{"latency": 20, "jitter": 80}},
+			{"latency", "upstream", 1, map[string]interface{}{"latency": 20, "jitter": 80}},
+			{"slicer", "downstream", 1, map[string]interface{}{
+				"average_size": 512, "size_variation": 256, "delay": 5000,
+			}},
+			{"bandwidth", "downstream", 1, map[string]interface{}{"rate": 2500}},
+		},
+	},
+	"transatlantic": {
+		Name:        "transatlantic",
+		Description: "link between Europe and North America: ~80ms round trip",
+		Toxics: []PresetToxic{
+			{"latency", "downstream", 1, map[string]interface{}{"latency": 40, "jitter": 5}},
+			{"latency", "upstream", 1, map[string]interface{}{"latency": 40, "jitter": 5}},
+		},
+	},
+}
+
+// ApplyPreset adds the toxics of a preset to the proxy. Either all of them are
+// added, or none if one fails, e.g. because the preset is already applied.
+func (proxy *Proxy) ApplyPreset(ctx context.Context, name string) ([]*toxics.ToxicWrapper, error) {
+	preset, ok := Presets[name]
+	if !ok {
+		return nil, ErrPresetNotFound
+	}
+
+	added := make([]*toxics.ToxicWrapper, 0, len(preset.Toxics))
+	for _, t := range preset.Toxics {
+		data, err := json.Marshal(map[string]interface{}{
+			"name":       t.ToxicName(name),
+			"type":       t.Type,
+			"stream":     t.Stream,
+			"toxicity":   t.Toxicity,
+			"attributes": t.Attributes,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		toxic, err := proxy.Toxics.AddToxicJson(bytes.NewReader(data))
+		if err != nil {
+			for _, toxic := range added {
+				proxy.Toxics.RemoveToxic(ctx, toxic.Name)
+			}
+			return nil, err
+		}
+		added = append(added, toxic)
+	}
+	return added, nil
+}
+
+func (server *ApiServer) PresetIndex(response http.ResponseWriter, request *http.Request) {
+	presets := make([]Preset, 0, len(Presets))
+	for _, preset := range Presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+
+	data, err := json.Marshal(presets)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("PresetIndex: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) PresetApply(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	added, err := proxy.ApplyPreset(request.Context(), vars["preset"])
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(added)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("PresetApply: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) PresetRemove(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	ctx := request.Context()
+
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	preset, ok := Presets[vars["preset"]]
+	if !ok {
+		server.apiError(response, ErrPresetNotFound)
+		return
+	}
+
+	for _, t := range preset.Toxics {
+		err := proxy.Toxics.RemoveToxic(ctx, t.ToxicName(preset.Name))
+		if err != ErrToxicNotFound && server.apiError(response, err) {
+			return
+		}
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err = response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(ctx)
+		log.Warn().Err(err).Msg("PresetRemove: Failed to write headers to client")
+	}
+}
@@ -0,0 +1,143 @@
+package toxiproxy_test
+
+import (
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2"
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestApplyEveryPreset(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		for name, preset := range toxiproxy.Presets {
+			if preset.Name != name {
+				t.Errorf("Preset %s has name %s", name, preset.Name)
+			}
+
+			toxics, err := proxy.ApplyPreset(name)
+			if err != nil {
+				t.Fatalf("Unable to apply preset %s: %v", name, err)
+			}
+			for i, toxic := range preset.Toxics {
+				AssertToxicExists(t, toxics, toxic.ToxicName(name), toxic.Type, toxic.Stream, true)
+				for key := range toxic.Attributes {
+					if _, ok := toxics[i].Attributes[key]; !ok {
+						t.Errorf("Preset %s sets unknown attribute %s on %s", name, key, toxic.Type)
+					}
+				}
+			}
+
+			err = proxy.RemovePreset(name)
+			if err != nil {
+				t.Fatalf("Unable to remove preset %s: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestListPresets(t *testing.T) {
+	WithServer(t, func(addr string) {
+		presets, err := client.Presets()
+		if err != nil {
+			t.Fatal("Failed to list presets:", err)
+		}
+
+		if len(presets) != len(toxiproxy.Presets) {
+			t.Fatalf("Expected %d presets, got %d", len(toxiproxy.Presets), len(presets))
+		}
+		for i := 1; i < len(presets); i++ {
+			if presets[i-1].Name >= presets[i].Name {
+				t.Errorf("Presets are not sorted: %s before %s", presets[i-1].Name, presets[i].Name)
+			}
+		}
+	})
+}
+
+func TestApplyAndRemovePreset(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = proxy.AddToxic("latency_downstream", "latency", "downstream", 1, nil)
+		if err != nil {
+			t.Fatal("Unable to add toxic:", err)
+		}
+
+		toxics, err := proxy.ApplyPreset("3g")
+		if err != nil {
+			t.Fatal("Unable to apply preset:", err)
+		}
+		if len(toxics) != len(toxiproxy.Presets["3g"].Toxics) {
+			t.Fatalf("Expected %d toxics, got %d", len(toxiproxy.Presets["3g"].Toxics), len(toxics))
+		}
+		AssertToxicExists(t, toxics, "3g_latency_upstream", "latency", "upstream", true)
+		AssertToxicExists(t, toxics, "3g_bandwidth_downstream", "bandwidth", "downstream", true)
+
+		_, err = proxy.ApplyPreset("3g")
+		if err == nil {
+			t.Fatal("Expected applying a preset twice to fail")
+		}
+		AssertProxyToxicCount(t, proxy, len(toxics)+1)
+
+		err = proxy.RemovePreset("3g")
+		if err != nil {
+			t.Fatal("Unable to remove preset:", err)
+		}
+		AssertProxyToxicCount(t, proxy, 1)
+	})
+}
+
+func TestApplyPresetRollsBack(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = proxy.AddToxic("3g_bandwidth_downstream", "latency", "downstream", 1, nil)
+		if err != nil {
+			t.Fatal("Unable to add toxic:", err)
+		}
+
+		_, err = proxy.ApplyPreset("3g")
+		if err == nil {
+			t.Fatal("Expected preset to conflict with the existing toxic")
+		}
+		AssertProxyToxicCount(t, proxy, 1)
+	})
+}
+
+func TestApplyUnknownPreset(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		_, err = proxy.ApplyPreset("dialup")
+		if err == nil {
+			t.Fatal("Expected an unknown preset to fail")
+		}
+		expected := "ApplyPreset: HTTP 404: preset not found"
+		if err.Error() != expected {
+			t.Fatalf("Expected error `%s', got `%s'", expected, err.Error())
+		}
+	})
+}
+
+func AssertProxyToxicCount(t *testing.T, proxy *tclient.Proxy, count int) {
+	t.Helper()
+
+	toxics, err := proxy.Toxics()
+	if err != nil {
+		t.Fatal("Unable to list toxics:", err)
+	}
+	if len(toxics) != count {
+		t.Fatalf("Expected %d toxics, got %d: %+v", count, len(toxics), toxics)
+	}
+}
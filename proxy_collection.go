@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 )
 
@@ -14,7 +15,9 @@ import (
 type ProxyCollection struct {
 	sync.RWMutex
 
-	proxies map[string]*Proxy
+	proxies   map[string]*Proxy
+	namespace string // Set on the proxies added
+	snapshots snapshots
 }
 
 func NewProxyCollection() *ProxyCollection {
@@ -30,6 +33,7 @@ func (collection *ProxyCollection) Add(proxy *Proxy, start bool) error {
 	if _, exists := collection.proxies[proxy.Name]; exists {
 		return ErrProxyAlreadyExists
 	}
+	proxy.setNamespace(collection.namespace)
 
 	if start {
 		err := proxy.Start()
@@ -39,6 +43,7 @@ func (collection *ProxyCollection) Add(proxy *Proxy, start bool) error {
 	}
 
 	collection.proxies[proxy.Name] = proxy
+	proxy.watchHealth()
 
 	return nil
 }
@@ -54,10 +59,13 @@ func (collection *ProxyCollection) AddOrReplace(proxy *Proxy, start bool) (*Prox
 		}
 
 		if !differs {
-			return existing, nil
+			return existing, existing.SetOptions(proxy)
 		}
+		existing.StopHealthCheck()
 		existing.Stop()
+		existing.Toxics.StopModulations()
 	}
+	proxy.setNamespace(collection.namespace)
 
 	if start {
 		err := proxy.Start()
@@ -67,14 +75,46 @@ func (collection *ProxyCollection) AddOrReplace(proxy *Proxy, start bool) (*Prox
 	}
 
 	collection.proxies[proxy.Name] = proxy
+	proxy.watchHealth()
 
 	return proxy, nil
 }
 
+// PopulateOptions changes how a populate reconciles the proxies of a
+// collection with the proxies of its payload.
+type PopulateOptions struct {
+	// Prune removes the proxies of the collection not in the payload.
+	Prune bool
+	// DryRun only plans the populate, without changing the proxies.
+	DryRun bool
+}
+
+// PopulatePlan lists the names of the proxies a populate creates, replaces
+// because their listen or upstream address changed, keeps with their new
+// options, and removes when pruning.
+type PopulatePlan struct {
+	Created  []string `json:"created"`
+	Replaced []string `json:"replaced"`
+	Kept     []string `json:"kept"`
+	Removed  []string `json:"removed"`
+}
+
 func (collection *ProxyCollection) PopulateJson(
 	server *ApiServer,
 	data io.Reader,
 ) ([]*Proxy, error) {
+	proxies, _, err := collection.ReconcileJson(server, data, PopulateOptions{})
+	return proxies, err
+}
+
+// ReconcileJson populates the collection with the proxies of data, removing
+// the others when pruning, and returns the proxies populated with the plan
+// of the changes. A dry run returns the plan without populating any proxy.
+func (collection *ProxyCollection) ReconcileJson(
+	server *ApiServer,
+	data io.Reader,
+	options PopulateOptions,
+) ([]*Proxy, *PopulatePlan, error) {
 	input := []struct {
 		Proxy
 		Enabled *bool `json:"enabled"` // Overrides Proxy field to make field nullable
@@ -82,35 +122,95 @@ func (collection *ProxyCollection) PopulateJson(
 
 	err := json.NewDecoder(data).Decode(&input)
 	if err != nil {
-		return nil, joinError(err, ErrBadRequestBody)
+		return nil, nil, joinError(err, ErrBadRequestBody)
 	}
 
 	// Check for valid input before creating any proxies
 	t := true
 	for i := range input {
 		if len(input[i].Name) < 1 {
-			return nil, joinError(fmt.Errorf("name at proxy %d", i+1), ErrMissingField)
+			return nil, nil, joinError(fmt.Errorf("name at proxy %d", i+1), ErrMissingField)
 		}
-		if len(input[i].Upstream) < 1 {
-			return nil, joinError(fmt.Errorf("upstream at proxy %d", i+1), ErrMissingField)
+		if len(input[i].Upstream) < 1 && needsUpstream(input[i].Protocol) {
+			return nil, nil, joinError(fmt.Errorf("upstream at proxy %d", i+1), ErrMissingField)
 		}
 		if input[i].Enabled == nil {
 			input[i].Enabled = &t
 		}
+		err = validateOptions(&input[i].Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	proxies := make([]*Proxy, 0, len(input))
-
 	for i := range input {
 		proxy := NewProxy(server, input[i].Name, input[i].Listen, input[i].Upstream)
+		proxy.copyOptions(&input[i].Proxy)
+		proxies = append(proxies, proxy)
+	}
+	plan, err := collection.plan(proxies, options.Prune)
+	if err != nil || options.DryRun {
+		return []*Proxy{}, plan, err
+	}
+
+	populated := make([]*Proxy, 0, len(proxies))
+	for i, proxy := range proxies {
 		addedOrReplaced, err := collection.AddOrReplace(proxy, *input[i].Enabled)
 		if err != nil {
-			return proxies, err
+			return populated, plan, err
 		}
 
-		proxies = append(proxies, addedOrReplaced)
+		populated = append(populated, addedOrReplaced)
 	}
-	return proxies, err
+	for _, name := range plan.Removed {
+		err := collection.Remove(name)
+		if err != nil && err != ErrProxyNotFound {
+			return populated, plan, err
+		}
+	}
+	return populated, plan, nil
+}
+
+// plan returns the changes populating the collection with proxies makes,
+// removing the other proxies if prune is set.
+func (collection *ProxyCollection) plan(proxies []*Proxy, prune bool) (*PopulatePlan, error) {
+	collection.RLock()
+	defer collection.RUnlock()
+
+	plan := &PopulatePlan{
+		Created:  []string{},
+		Replaced: []string{},
+		Kept:     []string{},
+		Removed:  []string{},
+	}
+	names := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		names[proxy.Name] = true
+		existing, exists := collection.proxies[proxy.Name]
+		if !exists {
+			plan.Created = append(plan.Created, proxy.Name)
+			continue
+		}
+		differs, err := existing.Differs(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if differs {
+			plan.Replaced = append(plan.Replaced, proxy.Name)
+		} else {
+			plan.Kept = append(plan.Kept, proxy.Name)
+		}
+	}
+	if prune {
+		for name := range collection.proxies {
+			if !names[name] {
+				plan.Removed = append(plan.Removed, name)
+			}
+		}
+		sort.Strings(plan.Removed)
+	}
+	return plan, nil
 }
 
 func (collection *ProxyCollection) Proxies() map[string]*Proxy {
@@ -132,6 +232,28 @@ func (collection *ProxyCollection) Get(name string) (*Proxy, error) {
 	return collection.getByName(name)
 }
 
+// Rename renames a proxy of the collection, keeping its listener, its toxics,
+// its stats and its connections.
+func (collection *ProxyCollection) Rename(name, newName string) (*Proxy, error) {
+	collection.Lock()
+	defer collection.Unlock()
+
+	proxy, err := collection.getByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if newName == name {
+		return proxy, nil
+	}
+	if _, exists := collection.proxies[newName]; exists {
+		return nil, ErrProxyAlreadyExists
+	}
+	proxy.rename(newName)
+	delete(collection.proxies, name)
+	collection.proxies[newName] = proxy
+	return proxy, nil
+}
+
 func (collection *ProxyCollection) Remove(name string) error {
 	collection.Lock()
 	defer collection.Unlock()
@@ -140,7 +262,9 @@ func (collection *ProxyCollection) Remove(name string) error {
 	if err != nil {
 		return err
 	}
+	proxy.StopHealthCheck()
 	proxy.Stop()
+	proxy.Toxics.StopModulations()
 
 	delete(collection.proxies, proxy.Name)
 	return nil
@@ -151,7 +275,9 @@ func (collection *ProxyCollection) Clear() error {
 	defer collection.Unlock()
 
 	for _, proxy := range collection.proxies {
+		proxy.StopHealthCheck()
 		proxy.Stop()
+		proxy.Toxics.StopModulations()
 
 		delete(collection.proxies, proxy.Name)
 	}
@@ -0,0 +1,205 @@
+package toxiproxy_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// greetingUpstream greets its clients with a line, then echoes them.
+func greetingUpstream(t *testing.T, greeting string) net.Listener {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { upstream.Close() })
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, err := io.WriteString(conn, greeting+"\n")
+				if err == nil {
+					io.Copy(conn, conn)
+				}
+			}()
+		}
+	}()
+	return upstream
+}
+
+// greetedBy connects to a proxy and returns its connection once greeted by
+// the upstream.
+func greetedBy(t *testing.T, listen, greeting string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != greeting+"\n" {
+		t.Fatalf("Expected to be greeted by %s, got %q %v", greeting, line, err)
+	}
+	return conn, reader
+}
+
+// echoes reports whether a connection still relays its data.
+func echoes(conn net.Conn, reader *bufio.Reader) bool {
+	_, err := io.WriteString(conn, "ping\n")
+	if err != nil {
+		return false
+	}
+	line, err := reader.ReadString('\n')
+	return err == nil && line == "ping\n"
+}
+
+func TestMoveProxyKeepsItsConnections(t *testing.T) {
+	blue := greetingUpstream(t, "blue")
+	green := greetingUpstream(t, "green")
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("db", "localhost:0", blue.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		listen := proxy.Listen
+		conn, reader := greetedBy(t, listen, "blue")
+
+		err = proxy.Move(green.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to move proxy:", err)
+		}
+		if proxy.Listen != listen || proxy.Upstream != green.Addr().String() {
+			t.Errorf("Expected the proxy to keep its listener, got %+v", proxy)
+		}
+		if !echoes(conn, reader) {
+			t.Error("Expected the connection to the previous upstream to stay open")
+		}
+		greetedBy(t, listen, "green")
+
+		// Updating the upstream alone doesn't restart the proxy either.
+		proxy.Upstream = blue.Addr().String()
+		err = proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to update proxy:", err)
+		}
+		if !echoes(conn, reader) {
+			t.Error("Expected the connection to stay open through the update")
+		}
+		greetedBy(t, listen, "blue")
+
+		err = proxy.Move("")
+		if err == nil {
+			t.Error("Expected an empty upstream to be rejected")
+		}
+	})
+}
+
+func TestRenameProxyKeepsItsToxicsAndConnections(t *testing.T) {
+	blue := greetingUpstream(t, "blue")
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("db", "localhost:0", blue.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = proxy.AddToxic("slow", "latency", "downstream", 1, tclient.Attributes{"latency": 1})
+		if err != nil {
+			t.Fatal("Unable to create toxic:", err)
+		}
+		_, err = client.CreateProxy("cache", "localhost:0", blue.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		conn, reader := greetedBy(t, proxy.Listen, "blue")
+
+		err = proxy.Rename("cache")
+		if err == nil {
+			t.Fatal("Expected the name of another proxy to be rejected")
+		}
+		err = proxy.Rename("primary")
+		if err != nil {
+			t.Fatal("Unable to rename proxy:", err)
+		}
+		if proxy.Name != "primary" || len(proxy.ActiveToxics) != 1 {
+			t.Errorf("Expected the renamed proxy with its toxic, got %+v", proxy)
+		}
+		if !echoes(conn, reader) {
+			t.Error("Expected the connection to stay open")
+		}
+
+		renamed, err := client.Proxy("primary")
+		if err != nil {
+			t.Fatal("Unable to get the renamed proxy:", err)
+		}
+		if renamed.Listen != proxy.Listen || len(renamed.ActiveToxics) != 1 {
+			t.Errorf("Expected the proxy to keep its listener and toxic, got %+v", renamed)
+		}
+		_, err = client.Proxy("db")
+		if err == nil {
+			t.Error("Expected the previous name to be gone")
+		}
+	})
+}
+
+// closesWithin reports whether a connection is closed by the proxy before a
+// timeout.
+func closesWithin(conn net.Conn, reader *bufio.Reader, timeout time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := reader.ReadString('\n')
+	var netErr net.Error
+	return err != nil && !(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestSwitchProxyDrainsOrResetsItsConnections(t *testing.T) {
+	blue := greetingUpstream(t, "blue")
+	green := greetingUpstream(t, "green")
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("db", "localhost:0", blue.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		conn, reader := greetedBy(t, proxy.Listen, "blue")
+
+		err = proxy.Switch(green.Addr().String(), tclient.Switchover{
+			Connections:  tclient.SwitchDrain,
+			DrainTimeout: 300,
+		})
+		if err != nil {
+			t.Fatal("Unable to switch proxy:", err)
+		}
+		greenConn, greenReader := greetedBy(t, proxy.Listen, "green")
+		if !echoes(conn, reader) {
+			t.Error("Expected the drained connection to stay open until the timeout")
+		}
+		if !closesWithin(conn, reader, 2*time.Second) {
+			t.Error("Expected the drained connection to be closed after the timeout")
+		}
+
+		err = proxy.Switch(blue.Addr().String(), tclient.Switchover{Connections: tclient.SwitchReset})
+		if err != nil {
+			t.Fatal("Unable to switch proxy:", err)
+		}
+		if !closesWithin(greenConn, greenReader, time.Second) {
+			t.Error("Expected the connection to the previous upstream to be reset")
+		}
+		greetedBy(t, proxy.Listen, "blue")
+
+		err = proxy.Switch(green.Addr().String(), tclient.Switchover{Connections: "close"})
+		if !errors.Is(err, tclient.ErrInvalidSwitchover) {
+			t.Errorf("Expected an invalid switchover, got %v", err)
+		}
+	})
+}
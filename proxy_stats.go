@@ -0,0 +1,174 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// ProxyStats counts the connections and traffic of a proxy, so that clients
+// can show live throughput without enabling the prometheus metrics.
+//
+// All methods are safe to call on a nil *ProxyStats.
+type ProxyStats struct {
+	connections atomic.Int64
+	rejected    atomic.Int64
+	idle        atomic.Int64
+	expired     atomic.Int64
+	bytes       [stream.NumDirections]atomic.Int64
+	blocked     atomic.Int64
+	buffered    atomic.Int64
+	dropped     atomic.Int64
+	hung        atomic.Int64
+}
+
+// ProxyCounters is a point-in-time copy of ProxyStats.
+type ProxyCounters struct {
+	// Number of open client connections.
+	Connections int64 `json:"connections"`
+	// Number of clients rejected over the connection limits since the proxy
+	// was created.
+	RejectedConnections int64 `json:"rejected_connections"`
+	// Number of connections closed by the idle timeout and by the max age
+	// since the proxy was created.
+	IdleTimeouts int64 `json:"idle_timeouts"`
+	AgeTimeouts  int64 `json:"age_timeouts"`
+	// Number of bytes sent to the upstream since the proxy was created.
+	UpstreamBytes int64 `json:"upstream_bytes"`
+	// Number of bytes sent to clients since the proxy was created.
+	DownstreamBytes int64 `json:"downstream_bytes"`
+	// Number of reads from connections that waited for the toxics to take
+	// the data read before, since the proxy was created.
+	BlockedReads int64 `json:"blocked_reads"`
+	// Number of bytes held for toxics slower than the reads, with the buffer
+	// and drop backpressures.
+	BufferedBytes int64 `json:"buffered_bytes"`
+	// Number of bytes read and dropped with the drop backpressure since the
+	// proxy was created.
+	DroppedBytes int64 `json:"dropped_bytes"`
+	// Number of clients held without an upstream by the hang probability.
+	HungConnections int64 `json:"hung_connections"`
+}
+
+func NewProxyStats() *ProxyStats {
+	return new(ProxyStats)
+}
+
+func (s *ProxyStats) addConnection(delta int64) {
+	if s != nil {
+		s.connections.Add(delta)
+	}
+}
+
+func (s *ProxyStats) addRejected() {
+	if s != nil {
+		s.rejected.Add(1)
+	}
+}
+
+// addTimeout counts a connection closed with the reason of a timeout.
+func (s *ProxyStats) addTimeout(reason string) {
+	if s == nil {
+		return
+	}
+	if reason == closeReasonIdle {
+		s.idle.Add(1)
+	} else {
+		s.expired.Add(1)
+	}
+}
+
+func (s *ProxyStats) addBlockedRead() {
+	if s != nil {
+		s.blocked.Add(1)
+	}
+}
+
+func (s *ProxyStats) addBuffered(delta int64) {
+	if s != nil {
+		s.buffered.Add(delta)
+	}
+}
+
+func (s *ProxyStats) addDropped(bytes int) {
+	if s != nil {
+		s.dropped.Add(int64(bytes))
+	}
+}
+
+func (s *ProxyStats) addHung(delta int64) {
+	if s != nil {
+		s.hung.Add(delta)
+	}
+}
+
+// writer counts the bytes written to w in the given direction.
+func (s *ProxyStats) writer(w io.Writer, direction stream.Direction) io.Writer {
+	if s == nil {
+		return w
+	}
+	return &countingWriter{w, &s.bytes[direction]}
+}
+
+func (s *ProxyStats) Counters() ProxyCounters {
+	if s == nil {
+		return ProxyCounters{}
+	}
+	return ProxyCounters{
+		Connections:         s.connections.Load(),
+		RejectedConnections: s.rejected.Load(),
+		IdleTimeouts:        s.idle.Load(),
+		AgeTimeouts:         s.expired.Load(),
+		UpstreamBytes:       s.bytes[stream.Upstream].Load(),
+		DownstreamBytes:     s.bytes[stream.Downstream].Load(),
+		BlockedReads:        s.blocked.Load(),
+		BufferedBytes:       s.buffered.Load(),
+		DroppedBytes:        s.dropped.Load(),
+		HungConnections:     s.hung.Load(),
+	}
+}
+
+func (s *ProxyStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Counters())
+}
+
+// UnmarshalJSON ignores stats sent back by clients updating a proxy.
+func (s *ProxyStats) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+type countingWriter struct {
+	io.Writer
+	count *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count.Add(int64(n))
+	return n, err
+}
+
+// ReadFrom lets io.Copy reach the ReadFrom of the underlying writer. The bytes
+// are counted as they are read from r, so that the counters of a connection
+// copied without toxics are live while it is open, which costs the splice of
+// copies between TCP connections.
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := w.Writer.(io.ReaderFrom); ok {
+		return rf.ReadFrom(&countingReader{r, w.count})
+	}
+	// Hide this ReadFrom from io.Copy, so that it copies with Write.
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+type countingReader struct {
+	io.Reader
+	count *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
@@ -2,16 +2,22 @@ package toxiproxy_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"io"
 	"net"
 	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/Shopify/toxiproxy/v2"
 	"github.com/Shopify/toxiproxy/v2/testhelper"
+	"github.com/Shopify/toxiproxy/v2/toxics"
 )
 
 func TestProxySimpleMessage(t *testing.T) {
@@ -35,6 +41,347 @@ func TestProxySimpleMessage(t *testing.T) {
 	})
 }
 
+func TestProxyStats(t *testing.T) {
+	WithTCPProxy(t, func(conn net.Conn, response chan []byte, proxy *toxiproxy.Proxy) {
+		waitForCounters := func(check func(toxiproxy.ProxyCounters) bool) {
+			deadline := time.Now().Add(time.Second)
+			for !check(proxy.Stats.Counters()) {
+				if time.Now().After(deadline) {
+					t.Fatalf("Unexpected proxy stats: %+v", proxy.Stats.Counters())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		msg := []byte("hello world")
+		_, err := conn.Write(msg)
+		if err != nil {
+			t.Error("Failed writing to TCP server", err)
+		}
+		waitForCounters(func(c toxiproxy.ProxyCounters) bool {
+			return c.Connections == 1
+		})
+
+		err = conn.Close()
+		if err != nil {
+			t.Error("Failed to close TCP connection", err)
+		}
+		<-response
+		// Links without toxics count their bytes once their direct copy stops.
+		waitForCounters(func(c toxiproxy.ProxyCounters) bool {
+			return c.Connections == 0 && c.UpstreamBytes == int64(len(msg))
+		})
+	})
+}
+
+func TestProxyMaxConnections(t *testing.T) {
+	upstream := testhelper.NewUpstream(t, false)
+	defer upstream.Close()
+
+	proxy := NewTestProxy("test", upstream.Addr())
+	proxy.MaxConnections = 1
+	proxy.Start()
+	defer proxy.Stop()
+
+	first := AssertProxyUp(t, proxy.Listen, true)
+	defer first.Close()
+	<-upstream.Connections
+
+	// The client over the limit is closed.
+	second := AssertProxyUp(t, proxy.Listen, true)
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := second.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatal("Expected the client over the limit to be closed, got", err)
+	}
+	if rejected := proxy.Stats.Counters().RejectedConnections; rejected != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", rejected)
+	}
+}
+
+func TestProxyWaitsOverMaxConnections(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	connections := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			connections <- conn
+		}
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.MaxConnections = 1
+	proxy.OnLimit = toxiproxy.OnLimitWait
+	proxy.Start()
+	defer proxy.Stop()
+
+	first := AssertProxyUp(t, proxy.Listen, true)
+	firstUpstream := <-connections
+
+	// The client over the limit connects once the first one closes.
+	second := AssertProxyUp(t, proxy.Listen, true)
+	defer second.Close()
+	select {
+	case <-connections:
+		t.Fatal("Expected the client over the limit to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first.Close()
+	firstUpstream.Close()
+	select {
+	case <-connections:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting client to connect to the upstream")
+	}
+}
+
+func TestProxyClosesTheClientsWaitingPastTheLimitTimeout(t *testing.T) {
+	upstream := testhelper.NewUpstream(t, false)
+	defer upstream.Close()
+
+	proxy := NewTestProxy("test", upstream.Addr())
+	proxy.MaxConnections = 1
+	proxy.OnLimit = toxiproxy.OnLimitWait
+	proxy.LimitTimeout = 50
+	proxy.Start()
+	defer proxy.Stop()
+
+	first := AssertProxyUp(t, proxy.Listen, true)
+	defer first.Close()
+	<-upstream.Connections
+
+	second := AssertProxyUp(t, proxy.Listen, true)
+	defer second.Close()
+	start := time.Now()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := second.Read(make([]byte, 1))
+	if !errors.Is(err, io.EOF) {
+		t.Fatal("Expected the waiting client to be closed, got", err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Fatalf("Expected the client to wait for the limit timeout, waited %s", waited)
+	}
+	if rejected := proxy.Stats.Counters().RejectedConnections; rejected != 1 {
+		t.Errorf("Expected the client to be counted as rejected, got %d", rejected)
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	upstream := testhelper.NewUpstream(t, false)
+	defer upstream.Close()
+
+	server := toxiproxy.New(toxiproxy.WithMaxConnections(1))
+	first := toxiproxy.NewProxy(server, "first", "localhost:0", upstream.Addr())
+	second := toxiproxy.NewProxy(server, "second", "localhost:0", upstream.Addr())
+	second.OnLimit = toxiproxy.OnLimitReset
+	for _, proxy := range []*toxiproxy.Proxy{first, second} {
+		proxy.Start()
+		defer proxy.Stop()
+	}
+
+	conn := AssertProxyUp(t, first.Listen, true)
+	defer conn.Close()
+	<-upstream.Connections
+
+	// The limit of the server applies to the clients of all its proxies.
+	conn = AssertProxyUp(t, second.Listen, true)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatal("Expected the client over the limit of the server to be reset, got", err)
+	}
+}
+
+func TestProxyHalfClose(t *testing.T) {
+	// The upstream answers once the client is done sending, like HTTP/1.0.
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request, _ := io.ReadAll(conn)
+				conn.Write(append([]byte("response to "), request...))
+			}()
+		}
+	}()
+
+	for _, toxic := range []string{"", "latency"} {
+		proxy := NewTestProxy("test", upstream.Addr().String())
+		proxy.Start()
+		if toxic != "" {
+			_, err := proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+				`{"type": "` + toxic + `", "stream": "upstream"}`,
+			))
+			if err != nil {
+				t.Fatal("AddToxicJson returned error:", err)
+			}
+		}
+
+		conn := AssertProxyUp(t, proxy.Listen, true)
+		_, err := conn.Write([]byte("request"))
+		if err != nil {
+			t.Fatal("Failed writing to proxy:", err)
+		}
+		err = conn.(*net.TCPConn).CloseWrite()
+		if err != nil {
+			t.Fatal("Failed to half-close the connection:", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Errorf("Failed reading the response with toxic %q: %v", toxic, err)
+		}
+		if string(response) != "response to request" {
+			t.Errorf("Expected the response through the half-closed connection, got %q", response)
+		}
+		conn.Close()
+		proxy.Stop()
+	}
+}
+
+func TestToxicOfBothStreams(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.Start()
+	defer proxy.Stop()
+
+	toxic, err := proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"type": "latency", "stream": "both", "attributes": {"latency": 100}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+	if toxic.Name != "latency_both" || toxic.Pair == nil || toxic.Pair.Toxic == toxic.Toxic {
+		t.Fatalf("Expected a toxic with its own upstream half, got %+v", toxic)
+	}
+	if list := proxy.Toxics.GetToxicArray(); len(list) != 1 {
+		t.Fatalf("Expected the toxic to be listed once, got %d toxics", len(list))
+	}
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	roundTrip := func() time.Duration {
+		start := time.Now()
+		_, err := conn.Write([]byte("ping"))
+		if err == nil {
+			_, err = io.ReadFull(conn, make([]byte, 4))
+		}
+		if err != nil {
+			t.Fatal("Failed to echo through the proxy:", err)
+		}
+		return time.Since(start)
+	}
+
+	if elapsed := roundTrip(); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected a latency on both streams, round trip took %s", elapsed)
+	}
+
+	_, err = proxy.Toxics.UpdateToxicJson("latency_both", bytes.NewBufferString(
+		`{"attributes": {"latency": 0}}`,
+	))
+	if err != nil {
+		t.Fatal("UpdateToxicJson returned error:", err)
+	}
+	if elapsed := roundTrip(); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected both streams to be updated, round trip took %s", elapsed)
+	}
+
+	err = proxy.Toxics.RemoveToxic(context.Background(), "latency_both")
+	if err != nil {
+		t.Fatal("RemoveToxic returned error:", err)
+	}
+	if list := proxy.Toxics.GetToxicArray(); len(list) != 0 {
+		t.Fatalf("Expected both halves to be removed, got %+v", list)
+	}
+	if proxy.Toxics.GetToxic("latency_both") != nil {
+		t.Fatal("Expected the toxic to be removed")
+	}
+}
+
+func TestPairedToxicSharesItsStateAcrossStreams(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	// A broker answering a Metadata request (v1) with a single broker.
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request := make([]byte, 12)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		body := append(request[8:12:12], "\x00\x00\x00\x01\x00\x00\x00\x01\x00\x07kafka-1"+
+			"\x00\x00\x23\x84\xff\xff\x00\x00\x00\x01\x00\x00\x00\x00"...)
+		conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...))
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.Start()
+	defer proxy.Stop()
+
+	_, err = proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"type": "kafka", "stream": "both", "attributes": {"advertise": "localhost:19092"}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write([]byte("\x00\x00\x00\x08\x00\x03\x00\x01\x00\x00\x00\x2a"))
+	if err != nil {
+		t.Fatal("Failed to write the request:", err)
+	}
+	response := make([]byte, 4+4+4+4+2+9+4+2+4+4)
+	_, err = io.ReadFull(conn, response)
+	if err != nil {
+		t.Fatal("Failed to read the response:", err)
+	}
+	if !bytes.Contains(response, []byte("\x00\x09localhost\x00\x00\x4a\x94")) {
+		t.Errorf("Expected the address of the broker to be rewritten, got %q", response)
+	}
+}
+
 func TestProxyToDownUpstream(t *testing.T) {
 	proxy := NewTestProxy("test", "localhost:20009")
 	proxy.Start()
@@ -120,6 +467,50 @@ func TestStartTwoProxiesOnSameAddress(t *testing.T) {
 	})
 }
 
+func TestStartTwoProxiesWithReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not supported on Windows")
+	}
+	socket := toxiproxy.SocketOptions{
+		ReusePort:  true,
+		Backlog:    16,
+		Nagle:      true,
+		KeepAlive:  -1,
+		SendBuffer: 64 << 10,
+	}
+	testhelper.WithTCPServer(t, func(upstream string, response chan []byte) {
+		proxy := NewTestProxy("test", upstream)
+		proxy.Socket = socket
+		err := proxy.Start()
+		if err != nil {
+			t.Fatal("Failed to start proxy:", err)
+		}
+		defer proxy.Stop()
+
+		proxy2 := NewTestProxy("proxy_2", upstream)
+		proxy2.Listen = proxy.Listen
+		proxy2.Socket = socket
+		err = proxy2.Start()
+		if err != nil {
+			t.Fatal("Expected both proxies to listen on the same address:", err)
+		}
+		defer proxy2.Stop()
+
+		conn := AssertProxyUp(t, proxy.Listen, true)
+		msg := []byte("hello world")
+		_, err = conn.Write(msg)
+		if err != nil {
+			t.Error("Failed writing to TCP server", err)
+		}
+		conn.Close()
+
+		resp := <-response
+		if !bytes.Equal(resp, msg) {
+			t.Error("Server didn't read correct bytes from client", resp)
+		}
+	})
+}
+
 func TestStopProxyBeforeStarting(t *testing.T) {
 	testhelper.WithTCPServer(t, func(upstream string, response chan []byte) {
 		proxy := NewTestProxy("test", upstream)
@@ -290,3 +681,318 @@ func TestProxyDiffers(t *testing.T) {
 		}
 	})
 }
+
+func TestProxyWithInMemoryTransports(t *testing.T) {
+	clients := testhelper.NewPipeListener()
+	upstream := testhelper.NewPipeListener()
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test_pipe", "upstream")
+	proxy.ListenFunc = func(string) (net.Listener, error) {
+		return clients, nil
+	}
+	proxy.DialFunc = upstream.Dial
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	for i := 0; i < 2; i++ {
+		conn, err := clients.Dial(context.Background(), proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+
+		msg := []byte("hello world")
+		go conn.Write(msg)
+		resp := make([]byte, len(msg))
+		_, err = io.ReadFull(conn, resp)
+		if err != nil {
+			t.Fatal("Failed to read from proxy:", err)
+		}
+		if !bytes.Equal(resp, msg) {
+			t.Errorf("Expected %q back, got %q", msg, resp)
+		}
+	}
+
+	if connections := proxy.Connections(); len(connections) != 2 {
+		t.Errorf("Expected 2 connections with the same address, got %+v", connections)
+	}
+}
+
+func TestProxyRetriesDialingUpstream(t *testing.T) {
+	clients := testhelper.NewPipeListener()
+	upstream := testhelper.NewPipeListener()
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	var attempts []time.Time
+	proxy := NewTestProxy("test_dial_retries", "upstream")
+	proxy.DialRetries = 2
+	proxy.DialBackoff = 20
+	proxy.ListenFunc = func(string) (net.Listener, error) {
+		return clients, nil
+	}
+	proxy.DialFunc = func(ctx context.Context, address string) (net.Conn, error) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) <= 2 {
+			return nil, syscall.ECONNREFUSED
+		}
+		return upstream.Dial(ctx, address)
+	}
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := clients.Dial(context.Background(), proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello world")
+	go conn.Write(msg)
+	resp := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		t.Fatal("Failed to read from proxy:", err)
+	}
+
+	if len(attempts) != 3 {
+		t.Fatalf("Expected 3 attempts to dial the upstream, got %d", len(attempts))
+	}
+	if waited := attempts[2].Sub(attempts[1]); waited < 40*time.Millisecond {
+		t.Errorf("Expected the backoff to double to 40ms, waited %s", waited)
+	}
+}
+
+func TestProxyDialTimeout(t *testing.T) {
+	clients := testhelper.NewPipeListener()
+
+	proxy := NewTestProxy("test_dial_timeout", "upstream")
+	proxy.DialTimeout = 50
+	proxy.ListenFunc = func(string) (net.Listener, error) {
+		return clients, nil
+	}
+	// An upstream that never answers.
+	proxy.DialFunc = func(ctx context.Context, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := clients.Dial(context.Background(), proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("Expected the client to be closed once the dial timed out, got %v", err)
+	}
+}
+
+func TestProxyAcceptsWhileDialingUpstream(t *testing.T) {
+	clients := testhelper.NewPipeListener()
+	upstream := testhelper.NewPipeListener()
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	var dials atomic.Int32
+	proxy := NewTestProxy("test_slow_dial", "upstream")
+	proxy.ListenFunc = func(string) (net.Listener, error) {
+		return clients, nil
+	}
+	// The upstream never answers the first client.
+	proxy.DialFunc = func(ctx context.Context, address string) (net.Conn, error) {
+		if dials.Add(1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return upstream.Dial(ctx, address)
+	}
+	err := proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+
+	stuck, err := clients.Dial(context.Background(), proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial proxy:", err)
+	}
+	defer stuck.Close()
+	for dials.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := clients.Dial(ctx, proxy.Listen)
+	if err != nil {
+		t.Fatal("Expected the second client to be accepted while the first dials:", err)
+	}
+	defer conn.Close()
+	msg := []byte("hello world")
+	go conn.Write(msg)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(conn, make([]byte, len(msg)))
+	if err != nil {
+		t.Fatal("Expected the second client to connect while the first dials:", err)
+	}
+
+	// Stopping the proxy gives up the dial of the first client.
+	stopped := make(chan struct{})
+	go func() {
+		proxy.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the proxy to stop while dialing")
+	}
+}
+
+func TestProxyResetsConnectionsOnStop(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	proxy := NewTestProxy("test", upstream.Addr().String())
+	proxy.OnStop = toxics.CloseRST
+	proxy.Start()
+
+	conn := AssertProxyUp(t, proxy.Listen, true)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal("Failed writing to proxy:", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	proxy.Stop()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Expected the connection to be reset, got %v", err)
+	}
+}
+
+func TestUDPProxy(t *testing.T) {
+	upstream, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := upstream.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// Answers the DNS query by echoing it as a response.
+			buf[2] |= 0x80
+			upstream.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	proxy := NewTestProxy("test_udp", upstream.LocalAddr().String())
+	proxy.Protocol = toxiproxy.ProtocolUDP
+	proxy.IdleTimeout = 200
+	err = proxy.Start()
+	if err != nil {
+		t.Fatal("Failed to start proxy:", err)
+	}
+	defer proxy.Stop()
+
+	_, err = proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"type": "dns", "stream": "downstream", "attributes": {"rcode": "nxdomain"}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	query := []byte("\x00\x01\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00" +
+		"\x07example\x03com\x00\x00\x01\x00\x01")
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("udp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		defer conn.Close()
+
+		// Datagrams are sent whole, one at a time.
+		for j := 0; j < 2; j++ {
+			_, err = conn.Write(query)
+			if err != nil {
+				t.Fatal("Failed to write to proxy:", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			resp := make([]byte, 512)
+			n, err := conn.Read(resp)
+			if err != nil {
+				t.Fatal("Failed to read from proxy:", err)
+			}
+			expected := append([]byte("\x00\x01\x81\x03"), query[4:]...)
+			if !bytes.Equal(resp[:n], expected) {
+				t.Errorf("Expected %q back, got %q", expected, resp[:n])
+			}
+		}
+	}
+
+	if connections := proxy.Connections(); len(connections) != 2 {
+		t.Errorf("Expected a connection for each client, got %+v", connections)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(proxy.Connections()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the idle clients to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,136 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// readiness tells whether the proxies of the config file of a server were
+// populated, for the probes of its orchestrator, and whether its API listens.
+type readiness struct {
+	sync.Mutex
+	populating bool
+	listening  bool
+	err        error         // Why the config was not populated
+	changed    chan struct{} // Closed and replaced on every change
+}
+
+var errPopulating = errors.New("populating the proxies of the config file")
+
+func newReadiness() *readiness {
+	return &readiness{changed: make(chan struct{})}
+}
+
+func (r *readiness) update(change func()) {
+	r.Lock()
+	defer r.Unlock()
+
+	change()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *readiness) populate() {
+	r.update(func() {
+		r.populating = true
+		r.err = nil
+	})
+}
+
+func (r *readiness) populated(err error) {
+	r.update(func() {
+		r.populating = false
+		if err != nil {
+			r.err = fmt.Errorf("config: %w", err)
+		}
+	})
+}
+
+func (r *readiness) listen() {
+	r.update(func() {
+		r.listening = true
+	})
+}
+
+// wait blocks until the API listens and the config is populated, and
+// returns why the server is not ready, nil if it is.
+func (r *readiness) wait(ctx context.Context) error {
+	for {
+		r.Lock()
+		if r.listening && !r.populating {
+			err := r.err
+			r.Unlock()
+			return err
+		}
+		changed := r.changed
+		r.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// check returns why the server is not ready, nil if it is.
+func (r *readiness) check() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.populating {
+		return errPopulating
+	}
+	return r.err
+}
+
+// probePaths are the paths of the probes, which are not rate limited.
+var probePaths = map[string]bool{
+	"/ready": true,
+	"/live":  true,
+}
+
+// WaitReady blocks until the server is ready: Listen serves the API, and the
+// config file given to PopulateConfig was populated. It returns why the server
+// is not ready, as /ready does, if the config failed to populate, or the error
+// of the context if it is done first. Programs use it to tell a supervisor
+// once the server is usable.
+func (server *ApiServer) WaitReady(ctx context.Context) error {
+	return server.readiness.wait(ctx)
+}
+
+// Ready answers once the server is usable: its API is served, and the
+// proxies of the config file given to PopulateConfig were all populated and
+// listen. It answers a 503 not_ready error with the reason otherwise, e.g.
+// while the config is populated or if a proxy of the config failed to start.
+func (server *ApiServer) Ready(response http.ResponseWriter, request *http.Request) {
+	err := server.readiness.check()
+	if err != nil {
+		server.apiError(response, joinError(err, ErrNotReady))
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write([]byte(`{"ready": true}` + "\n"))
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("Ready: Failed to write response to client")
+	}
+}
+
+// Live answers as long as the API is served, whatever the state of the
+// proxies and of their upstreams, so that an orchestrator doesn't restart the
+// server when an upstream is down.
+func (server *ApiServer) Live(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	_, err := response.Write([]byte(`{"live": true}` + "\n"))
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("Live: Failed to write response to client")
+	}
+}
@@ -0,0 +1,110 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestReadyOnceTheConfigIsPopulated(t *testing.T) {
+	held, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	for _, test := range []struct {
+		config string
+		reason string
+	}{
+		{"", ""},
+		{`[{"name": "redis", "listen": "localhost:0", "upstream": "localhost:6379"}]`, ""},
+		{`[{"name": "redis", "listen": "` + held.Addr().String() + `", "upstream": "localhost:6379"}]`,
+			"config: "},
+		{`[{"name": "redis"`, "config: "},
+	} {
+		srv := New(WithLogger(zerolog.Nop()))
+		if test.config != "" {
+			config := filepath.Join(t.TempDir(), "toxiproxy.json")
+			err := os.WriteFile(config, []byte(test.config), 0o600)
+			if err != nil {
+				t.Fatal("Failed to write config", err)
+			}
+			srv.PopulateConfig(config)
+		}
+
+		resp := httptest.NewRecorder()
+		srv.Routes().ServeHTTP(resp, httptest.NewRequest("GET", "/ready", nil))
+		if test.reason == "" {
+			if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"ready": true`) {
+				t.Errorf("Expected %s to be ready, got %d %s", test.config, resp.Code, resp.Body)
+			}
+		} else if resp.Code != http.StatusServiceUnavailable ||
+			!strings.Contains(resp.Body.String(), `"code":"not_ready"`) ||
+			!strings.Contains(resp.Body.String(), test.reason) {
+			t.Errorf("Expected %s not to be ready, got %d %s", test.config, resp.Code, resp.Body)
+		}
+		srv.Collection.Clear()
+	}
+}
+
+func TestLiveIsNotRateLimited(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()), WithRateLimit(1, 1))
+	routes := srv.Routes()
+	srv.readiness.populated(os.ErrNotExist)
+
+	for i := 0; i < 3; i++ {
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, httptest.NewRequest("GET", "/live", nil))
+		if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"live": true`) {
+			t.Fatalf("Expected the server to be live, got %d %s", resp.Code, resp.Body)
+		}
+		resp = httptest.NewRecorder()
+		routes.ServeHTTP(resp, httptest.NewRequest("GET", "/ready", nil))
+		if resp.Code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected the server not to be ready, got %d %s", resp.Code, resp.Body)
+		}
+	}
+}
+
+func TestWaitReadyUntilTheApiListens(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(WithLogger(zerolog.Nop()), WithListener(listener))
+	defer srv.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = srv.WaitReady(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected to wait for the API to listen, got %v", err)
+	}
+
+	srv.readiness.populate()
+	go srv.Listen("")
+	ready := make(chan error)
+	go func() {
+		ready <- srv.WaitReady(context.Background())
+	}()
+	select {
+	case err := <-ready:
+		t.Fatalf("Expected to wait for the config to be populated, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	srv.readiness.populated(os.ErrNotExist)
+	err = <-ready
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the config error, got %v", err)
+	}
+}
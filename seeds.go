@@ -0,0 +1,40 @@
+package toxiproxy
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// seedSource draws the seeds of the toxics added without one, so that the
+// toxics of a server started with the same seed get the same seeds.
+//
+// All methods are safe to call on a nil *seedSource, which draws random seeds.
+type seedSource struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newSeedSource(seed int64) *seedSource {
+	return &seedSource{rand: rand.New(rand.NewSource(seed))} // #nosec G404 -- replayable on purpose
+}
+
+// next returns a seed, never 0 which stands for no seed.
+func (s *seedSource) next() int64 {
+	if s == nil {
+		return rand.Int63() | 1 // #nosec G404 -- was ignored before too
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		if seed := s.rand.Int63(); seed != 0 {
+			return seed
+		}
+	}
+}
+
+// SetSeed seeds the seeds of the toxics added without one from then on, so
+// that a run of a server can be replayed.
+func (server *ApiServer) SetSeed(seed int64) {
+	server.seeds = newSeedSource(seed)
+}
@@ -0,0 +1,48 @@
+package toxiproxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerSeedsToxics(t *testing.T) {
+	seeds := func() []int64 {
+		srv := New(WithSeed(7))
+		proxy := NewProxy(srv, "test_seeds", "localhost:0", "localhost:20001")
+
+		var seeds []int64
+		for _, stream := range []string{"upstream", "downstream"} {
+			toxic, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+				`{"type": "latency", "stream": "` + stream + `"}`,
+			))
+			if err != nil {
+				t.Fatal("AddToxicJson returned error:", err)
+			}
+			seeds = append(seeds, toxic.Seed)
+		}
+		return seeds
+	}
+
+	first, second := seeds(), seeds()
+	if first[0] == 0 || first[0] == first[1] {
+		t.Fatalf("Expected a seed for each toxic, got %v", first)
+	}
+	if first[0] != second[0] || first[1] != second[1] {
+		t.Errorf("Expected the same seeds from the same server seed, got %v and %v", first, second)
+	}
+}
+
+func TestToxicKeepsItsSeed(t *testing.T) {
+	srv := New(WithSeed(7))
+	proxy := NewProxy(srv, "test_seeds", "localhost:0", "localhost:20001")
+
+	toxic, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "latency", "stream": "upstream", "seed": 42}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+	if toxic.Seed != 42 {
+		t.Errorf("Expected the seed of the toxic to be kept, got %d", toxic.Seed)
+	}
+}
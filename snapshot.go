@@ -0,0 +1,301 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// A Snapshot is the state of the proxies of a collection and of their toxics
+// at a time, so that a test can change them freely and restore them after,
+// even if its own cleanup is broken. A snapshot never changes once taken.
+type Snapshot struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// The proxies with their toxics, as listed by GET /proxies.
+	Proxies json.RawMessage `json:"proxies"`
+}
+
+// snapshots are the snapshots taken of a collection, by ID.
+type snapshots struct {
+	sync.Mutex
+	byID   map[uint64]*Snapshot
+	lastID uint64
+}
+
+// snapshotProxy is the state of a proxy in a snapshot that populating the
+// collection with it doesn't restore.
+type snapshotProxy struct {
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	Directions map[string]bool   `json:"directions"`
+	Toxics     []json.RawMessage `json:"toxics"`
+}
+
+// TakeSnapshot snapshots the proxies of the collection and their toxics.
+func (collection *ProxyCollection) TakeSnapshot() (*Snapshot, error) {
+	proxies := make([]*Proxy, 0)
+	for _, proxy := range collection.Proxies() {
+		proxies = append(proxies, proxy)
+	}
+	sort.Slice(proxies, func(i, j int) bool {
+		return proxies[i].Name < proxies[j].Name
+	})
+	state := proxiesWithToxics(proxies)
+	if state == nil {
+		state = []proxyToxics{}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	collection.snapshots.Lock()
+	defer collection.snapshots.Unlock()
+
+	if collection.snapshots.byID == nil {
+		collection.snapshots.byID = make(map[uint64]*Snapshot)
+	}
+	collection.snapshots.lastID++
+	snapshot := &Snapshot{
+		ID:        collection.snapshots.lastID,
+		CreatedAt: time.Now().UTC(),
+		Proxies:   data,
+	}
+	collection.snapshots.byID[snapshot.ID] = snapshot
+	return snapshot, nil
+}
+
+// Snapshots returns the snapshots of the collection, from the oldest.
+func (collection *ProxyCollection) Snapshots() []*Snapshot {
+	collection.snapshots.Lock()
+	defer collection.snapshots.Unlock()
+
+	result := make([]*Snapshot, 0, len(collection.snapshots.byID))
+	for _, snapshot := range collection.snapshots.byID {
+		result = append(result, snapshot)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+func (collection *ProxyCollection) GetSnapshot(id uint64) (*Snapshot, error) {
+	collection.snapshots.Lock()
+	defer collection.snapshots.Unlock()
+
+	snapshot, exists := collection.snapshots.byID[id]
+	if !exists {
+		return nil, ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+func (collection *ProxyCollection) RemoveSnapshot(id uint64) error {
+	collection.snapshots.Lock()
+	defer collection.snapshots.Unlock()
+
+	if _, exists := collection.snapshots.byID[id]; !exists {
+		return ErrSnapshotNotFound
+	}
+	delete(collection.snapshots.byID, id)
+	return nil
+}
+
+// RestoreSnapshot rolls the proxies of the collection back to a snapshot:
+// the proxies created since are removed, the ones removed are created again,
+// and each proxy gets back its fields, its directions and its toxics. The
+// snapshot is kept, to be restored again.
+func (collection *ProxyCollection) RestoreSnapshot(
+	ctx context.Context,
+	server *ApiServer,
+	id uint64,
+) error {
+	snapshot, err := collection.GetSnapshot(id)
+	if err != nil {
+		return err
+	}
+	_, _, err = collection.ReconcileJson(
+		server,
+		bytes.NewReader(snapshot.Proxies),
+		PopulateOptions{Prune: true},
+	)
+	if err != nil {
+		return err
+	}
+
+	var proxies []snapshotProxy
+	err = json.Unmarshal(snapshot.Proxies, &proxies)
+	if err != nil {
+		return err
+	}
+	for _, input := range proxies {
+		proxy, err := collection.Get(input.Name)
+		if err != nil {
+			return err
+		}
+		if input.Enabled {
+			err = proxy.Start()
+			if err != nil && err != ErrProxyAlreadyStarted {
+				return err
+			}
+		} else {
+			proxy.Stop()
+		}
+		for name, enabled := range input.Directions {
+			direction, err := stream.ParseDirection(name)
+			if err == nil {
+				proxy.SetDirectionEnabled(direction, enabled)
+			}
+		}
+
+		proxy.Toxics.ResetToxics(ctx)
+		for _, toxic := range input.Toxics {
+			_, err = proxy.Toxics.AddToxicJson(bytes.NewReader(toxic))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotRoutes adds the endpoints of the snapshots of a collection to r.
+func (server *ApiServer) snapshotRoutes(r *mux.Router) {
+	r.HandleFunc("/snapshots", server.SnapshotIndex).Methods("GET").
+		Name("SnapshotIndex")
+	r.HandleFunc("/snapshots", server.SnapshotCreate).Methods("POST").
+		Name("SnapshotCreate")
+	r.HandleFunc("/snapshots/{snapshot}", server.SnapshotShow).Methods("GET").
+		Name("SnapshotShow")
+	r.HandleFunc("/snapshots/{snapshot}", server.SnapshotDelete).Methods("DELETE").
+		Name("SnapshotDelete")
+	r.HandleFunc("/snapshots/{snapshot}/restore", server.SnapshotRestore).Methods("POST").
+		Name("SnapshotRestore")
+}
+
+// snapshotID returns the ID of the snapshot of a request, and its collection.
+func (server *ApiServer) snapshotID(request *http.Request) (*ProxyCollection, uint64, error) {
+	collection, err := server.collection(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := strconv.ParseUint(mux.Vars(request)["snapshot"], 10, 64)
+	if err != nil {
+		return nil, 0, ErrSnapshotNotFound
+	}
+	return collection, id, nil
+}
+
+func (server *ApiServer) SnapshotIndex(response http.ResponseWriter, request *http.Request) {
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(collection.Snapshots())
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("SnapshotIndex: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) SnapshotCreate(response http.ResponseWriter, request *http.Request) {
+	collection, err := server.collection(request)
+	if server.apiError(response, err) {
+		return
+	}
+	snapshot, err := collection.TakeSnapshot()
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusCreated)
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("SnapshotCreate: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) SnapshotShow(response http.ResponseWriter, request *http.Request) {
+	collection, id, err := server.snapshotID(request)
+	if server.apiError(response, err) {
+		return
+	}
+	snapshot, err := collection.GetSnapshot(id)
+	if server.apiError(response, err) {
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("SnapshotShow: Failed to write response to client")
+	}
+}
+
+func (server *ApiServer) SnapshotRestore(response http.ResponseWriter, request *http.Request) {
+	collection, id, err := server.snapshotID(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = collection.RestoreSnapshot(request.Context(), server, id)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err = response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("SnapshotRestore: Failed to write headers to client")
+	}
+}
+
+func (server *ApiServer) SnapshotDelete(response http.ResponseWriter, request *http.Request) {
+	collection, id, err := server.snapshotID(request)
+	if server.apiError(response, err) {
+		return
+	}
+	err = collection.RemoveSnapshot(id)
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+	_, err = response.Write(nil)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("SnapshotDelete: Failed to write headers to client")
+	}
+}
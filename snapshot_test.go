@@ -0,0 +1,94 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"testing"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+	WithServer(t, func(addr string) {
+		redis, err := client.CreateProxy("redis", "localhost:7070", "localhost:7171")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = redis.AddToxic("slow", "latency", "both", 0.5, tclient.Attributes{"latency": 100})
+		if err != nil {
+			t.Fatal("Unable to create toxic:", err)
+		}
+		mysql, err := client.CreateProxy("mysql", "localhost:7272", "localhost:7373")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		err = mysql.SetDirection("upstream", false)
+		if err != nil {
+			t.Fatal("Unable to disable the upstream:", err)
+		}
+
+		snapshot, err := client.CreateSnapshot()
+		if err != nil {
+			t.Fatal("Unable to create snapshot:", err)
+		}
+		if len(snapshot.Proxies) != 2 || snapshot.Proxies[1].Name != "redis" ||
+			len(snapshot.Proxies[1].ActiveToxics) != 1 {
+			t.Fatalf("Expected the proxies and toxics in the snapshot, got %+v", snapshot.Proxies)
+		}
+
+		_, err = redis.UpdateToxic("slow", 1, tclient.Attributes{"latency": 5000})
+		if err != nil {
+			t.Fatal("Unable to update toxic:", err)
+		}
+		_, err = redis.AddToxic("", "timeout", "downstream", 1, nil)
+		if err != nil {
+			t.Fatal("Unable to create toxic:", err)
+		}
+		err = redis.Disable()
+		if err != nil {
+			t.Fatal("Unable to disable proxy:", err)
+		}
+		err = mysql.Delete()
+		if err != nil {
+			t.Fatal("Unable to delete proxy:", err)
+		}
+		_, err = client.CreateProxy("extra", "localhost:7474", "localhost:7575")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		err = snapshot.Restore()
+		if err != nil {
+			t.Fatal("Unable to restore snapshot:", err)
+		}
+
+		proxies, err := client.Proxies()
+		if err != nil {
+			t.Fatal("Unable to list proxies:", err)
+		}
+		if len(proxies) != 2 || proxies["extra"] != nil {
+			t.Fatalf("Expected the proxies of the snapshot, got %+v", proxies)
+		}
+		redis = proxies["redis"]
+		if !redis.Enabled || len(redis.ActiveToxics) != 1 {
+			t.Fatalf("Expected redis enabled with its toxic, got %+v", redis)
+		}
+		toxic := redis.ActiveToxics[0]
+		if toxic.Name != "slow" || toxic.Stream != "both" || toxic.Toxicity != 0.5 ||
+			toxic.Attributes["latency"] != 100.0 {
+			t.Fatalf("Expected the toxic of the snapshot, got %+v", toxic)
+		}
+		if proxies["mysql"] == nil || proxies["mysql"].Directions["upstream"] {
+			t.Fatalf("Expected mysql with its upstream disabled, got %+v", proxies["mysql"])
+		}
+		AssertProxyUp(t, proxies["mysql"].Listen, true)
+
+		err = snapshot.Delete()
+		if err != nil {
+			t.Fatal("Unable to delete snapshot:", err)
+		}
+		err = snapshot.Restore()
+		if !errors.Is(err, tclient.ErrSnapshotNotFound) {
+			t.Fatalf("Expected the deleted snapshot not to be found, got %v", err)
+		}
+	})
+}
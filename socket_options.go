@@ -0,0 +1,137 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// SocketOptions tune the TCP sockets of a proxy, to reproduce the behavior of
+// production hosts. They do not apply to the connections of a ListenFunc or a
+// DialFunc.
+type SocketOptions struct {
+	// ReusePort lets other processes listen on the same address, with
+	// SO_REUSEPORT. Backlog is the length of the queue of connections waiting
+	// to be accepted, the default of the system if not set.
+	ReusePort bool `json:"reuse_port"`
+	Backlog   int  `json:"backlog"`
+	// Nagle enables Nagle's algorithm on both legs, turning off TCP_NODELAY.
+	Nagle bool `json:"nagle"`
+	// KeepAlive is the interval of TCP keepalives in milliseconds on both
+	// legs, 15 seconds if not set or -1 to disable them.
+	KeepAlive int `json:"keepalive"`
+	// SendBuffer and ReceiveBuffer are the sizes of the socket buffers of both
+	// legs in bytes, the default of the system if not set.
+	SendBuffer    int `json:"send_buffer"`
+	ReceiveBuffer int `json:"receive_buffer"`
+}
+
+var (
+	errReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+	errBacklogUnsupported   = errors.New("the backlog can't be set on this platform")
+)
+
+func validateSocketOptions(options SocketOptions) error {
+	if options.Backlog < 0 {
+		return joinError(fmt.Errorf("backlog must not be negative"), ErrInvalidSocketOptions)
+	}
+	if options.KeepAlive < -1 {
+		return joinError(
+			fmt.Errorf("keepalive must be -1 to disable keepalives, or an interval"),
+			ErrInvalidSocketOptions,
+		)
+	}
+	if options.SendBuffer < 0 || options.ReceiveBuffer < 0 {
+		return joinError(
+			fmt.Errorf("send_buffer and receive_buffer must not be negative"),
+			ErrInvalidSocketOptions,
+		)
+	}
+	return nil
+}
+
+// listenerDiffers reports whether the options need the proxy to listen again.
+func (options SocketOptions) listenerDiffers(other SocketOptions) bool {
+	return options.ReusePort != other.ReusePort || options.Backlog != other.Backlog
+}
+
+func (options SocketOptions) keepAlive() time.Duration {
+	if options.KeepAlive < 0 {
+		return -1
+	}
+	return time.Duration(options.KeepAlive) * time.Millisecond
+}
+
+// listen listens on a TCP address with the options.
+func (options SocketOptions) listen(address string) (net.Listener, error) {
+	config := net.ListenConfig{KeepAlive: options.keepAlive()}
+	if options.ReusePort {
+		config.Control = func(_, _ string, conn syscall.RawConn) error {
+			return control(conn, setReusePort)
+		}
+	}
+	listener, err := config.Listen(context.Background(), "tcp", address)
+	if err != nil || options.Backlog == 0 {
+		return listener, err
+	}
+
+	conn, err := listener.(*net.TCPListener).SyscallConn()
+	if err == nil {
+		err = control(conn, func(fd uintptr) error {
+			return setBacklog(fd, options.Backlog)
+		})
+	}
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("backlog: %w", err)
+	}
+	return listener, nil
+}
+
+// dialFrom returns a DialFunc connecting to TCP addresses with the options,
+// from bind, dialing the addresses of dual-stack upstreams as told.
+func (options SocketOptions) dialFrom(bind UpstreamBind, dualStack DualStack) DialFunc {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialer := bind.dialer("tcp")
+		dialer.KeepAlive = options.keepAlive()
+		return dialer.DialContext(ctx, network, address)
+	}
+	if dualStack != (DualStack{}) {
+		return dualStack.dialWith(dial)
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		return dial(ctx, "tcp", address)
+	}
+}
+
+// apply sets the options of a leg of a connection, after it was accepted or
+// dialed.
+func (options SocketOptions) apply(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	err := tcp.SetNoDelay(!options.Nagle)
+	if err == nil && options.SendBuffer > 0 {
+		err = tcp.SetWriteBuffer(options.SendBuffer)
+	}
+	if err == nil && options.ReceiveBuffer > 0 {
+		err = tcp.SetReadBuffer(options.ReceiveBuffer)
+	}
+	return err
+}
+
+// control runs f on the file descriptor of a socket.
+func control(conn syscall.RawConn, f func(fd uintptr) error) error {
+	var err error
+	controlErr := conn.Control(func(fd uintptr) {
+		err = f(fd)
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package toxiproxy
+
+func setReusePort(uintptr) error {
+	return errReusePortUnsupported
+}
+
+func setBacklog(uintptr, int) error {
+	return errBacklogUnsupported
+}
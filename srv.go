@@ -0,0 +1,70 @@
+package toxiproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// lookupSRV resolves the SRV upstreams, replaced by the tests.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+var errSRVUnavailable = errors.New("service not available")
+
+// isSRVName reports whether an upstream is the name of an SRV record, e.g.
+// _db._tcp.service.consul, rather than an address with a port.
+func isSRVName(upstream string) bool {
+	if _, _, err := net.SplitHostPort(upstream); err == nil {
+		return false
+	}
+	labels := strings.Split(upstream, ".")
+	return len(labels) >= 3 &&
+		len(labels[0]) > 1 && labels[0][0] == '_' &&
+		len(labels[1]) > 1 && labels[1][0] == '_'
+}
+
+// dialSRV returns a DialFunc resolving the upstreams that are SRV names for
+// each connection, and connecting to their targets with dial in the order of
+// their priorities and weights, each target being dialed after the previous
+// one failed. The other addresses are dialed as they are.
+func dialSRV(dial DialFunc) DialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if !isSRVName(address) {
+			return dial(ctx, address)
+		}
+		_, targets, err := lookupSRV(ctx, "", "", address)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: "srv", Err: err}
+		}
+
+		var firstErr error
+		for _, target := range targets {
+			host := strings.TrimSuffix(target.Target, ".")
+			// A target of "." tells that the service is not available.
+			if host == "" {
+				continue
+			}
+			conn, err := dial(ctx, net.JoinHostPort(host, strconv.Itoa(int(target.Port))))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if firstErr == nil {
+			firstErr = &net.OpError{
+				Op:  "dial",
+				Net: "srv",
+				Err: fmt.Errorf("%s: %w", address, errSRVUnavailable),
+			}
+		}
+		return nil, firstErr
+	}
+}
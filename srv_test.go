@@ -0,0 +1,103 @@
+package toxiproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestIsSRVName(t *testing.T) {
+	for upstream, expected := range map[string]bool{
+		"_db._tcp.service.consul":   true,
+		"_dns._udp.example.com":     true,
+		"_db._tcp.service:5432":     false,
+		"localhost:5432":            false,
+		"db.service.consul":         false,
+		"_db.service.consul":        false,
+		"[fd00::1]:5432":            false,
+		"_postgres._tcp.db.default": true,
+	} {
+		if isSRVName(upstream) != expected {
+			t.Errorf("Expected %s to be an SRV name: %v", upstream, expected)
+		}
+	}
+}
+
+func TestProxyResolvesSRVUpstreams(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	closed, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	lookups := make(chan string, 10)
+	lookup := lookupSRV
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups <- name
+		if name != "_db._tcp.service.test" {
+			return "", []*net.SRV{{Target: ".", Port: 0}}, nil
+		}
+		return name, []*net.SRV{
+			{Target: "localhost.", Port: uint16(closed.Addr().(*net.TCPAddr).Port), Priority: 1},
+			{Target: "localhost.", Port: uint16(upstream.Addr().(*net.TCPAddr).Port), Priority: 2},
+		}, nil
+	}
+	defer func() { lookupSRV = lookup }()
+
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+	proxy := NewProxy(srv, "test_srv", "localhost:0", "_db._tcp.service.test")
+	err = srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		err = echo(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal("Expected the second target of the record to be reached:", err)
+		}
+	}
+	if len(lookups) != 2 {
+		t.Errorf("Expected the record to be resolved for each connection, got %d lookups", len(lookups))
+	}
+
+	err = proxy.Move("_db._tcp.unavailable.test")
+	if err != nil {
+		t.Fatal("Failed to move proxy:", err)
+	}
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if echo(conn) == nil {
+		t.Error("Expected the client of an unavailable service to be closed")
+	}
+}
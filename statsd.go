@@ -0,0 +1,224 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+)
+
+// Maximum size of a single statsd packet, small enough to avoid fragmentation.
+const statsdPacketSize = 1432
+
+type StatsdConfig struct {
+	// Address of the statsd server, e.g. localhost:8125.
+	Addr string
+	// Prefix prepended to every metric name, e.g. "toxiproxy.".
+	Prefix string
+	// Interval between two pushes.
+	Interval time.Duration
+	// Tags added to every metric, in key:value format. DogStatsD only.
+	Tags []string
+	// DogStatsD sends metric labels as tags. Otherwise, label values are
+	// appended to the metric name.
+	DogStatsD bool
+}
+
+// StatsdExporter periodically pushes the prometheus metrics of a server to
+// statsd, for environments where the /metrics endpoint cannot be scraped.
+// Counters are sent as the increase since the previous push, gauges as their
+// current value, and histograms as a counter for each of their count and sum.
+type StatsdExporter struct {
+	config  StatsdConfig
+	metrics *metricsContainer
+	logger  zerolog.Logger
+	conn    net.Conn
+	last    map[string]float64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewStatsdExporter(
+	m *metricsContainer,
+	config StatsdConfig,
+	logger zerolog.Logger,
+) (*StatsdExporter, error) {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsdExporter{
+		config:  config,
+		metrics: m,
+		logger:  logger.With().Str("component", "StatsdExporter").Logger(),
+		conn:    conn,
+		last:    make(map[string]float64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Run pushes metrics every interval until Stop is called.
+func (e *StatsdExporter) Run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Push()
+		case <-e.stop:
+			e.Push()
+			return
+		}
+	}
+}
+
+// Stop pushes the metrics a last time and closes the connection.
+func (e *StatsdExporter) Stop() {
+	close(e.stop)
+	<-e.done
+	e.conn.Close()
+}
+
+// Push sends the current value of all metrics to statsd.
+func (e *StatsdExporter) Push() {
+	families, err := e.metrics.gatherer().Gather()
+	if err != nil {
+		e.logger.Warn().Err(err).Msg("Failed to gather metrics")
+	}
+
+	var packet bytes.Buffer
+	for _, line := range e.lines(families) {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdPacketSize {
+			e.send(packet.Bytes())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		e.send(packet.Bytes())
+	}
+}
+
+func (e *StatsdExporter) send(packet []byte) {
+	_, err := e.conn.Write(packet)
+	if err != nil {
+		e.logger.Warn().Err(err).Msg("Failed to send metrics to statsd")
+	}
+}
+
+func (e *StatsdExporter) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = e.appendCounter(lines, name, metric, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				lines = e.appendLine(lines, name, metric, metric.GetGauge().GetValue(), "g")
+			case dto.MetricType_UNTYPED:
+				lines = e.appendLine(lines, name, metric, metric.GetUntyped().GetValue(), "g")
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				count := float64(histogram.GetSampleCount())
+				lines = e.appendCounter(lines, name+"_count", metric, count)
+				lines = e.appendCounter(lines, name+"_sum", metric, histogram.GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				count := float64(summary.GetSampleCount())
+				lines = e.appendCounter(lines, name+"_count", metric, count)
+				lines = e.appendCounter(lines, name+"_sum", metric, summary.GetSampleSum())
+			}
+		}
+	}
+	return lines
+}
+
+// appendCounter sends the increase of a cumulative value since the last push.
+func (e *StatsdExporter) appendCounter(
+	lines []string,
+	name string,
+	metric *dto.Metric,
+	value float64,
+) []string {
+	key := e.name(name, metric) + "|" + strings.Join(e.tags(metric), ",")
+	delta := value - e.last[key]
+	e.last[key] = value
+	if delta < 0 {
+		// The counter was reset, e.g. a toxic was removed and added again.
+		delta = value
+	}
+	if delta == 0 {
+		return lines
+	}
+	return e.appendLine(lines, name, metric, delta, "c")
+}
+
+func (e *StatsdExporter) appendLine(
+	lines []string,
+	name string,
+	metric *dto.Metric,
+	value float64,
+	kind string,
+) []string {
+	line := e.name(name, metric) + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if tags := e.tags(metric); len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return append(lines, line)
+}
+
+func (e *StatsdExporter) name(name string, metric *dto.Metric) string {
+	name = e.config.Prefix + name
+	if e.config.DogStatsD {
+		return name
+	}
+	for _, label := range sortedLabels(metric) {
+		name += "." + sanitizeStatsd(label.GetValue())
+	}
+	return name
+}
+
+func (e *StatsdExporter) tags(metric *dto.Metric) []string {
+	if !e.config.DogStatsD {
+		return nil
+	}
+	tags := append([]string{}, e.config.Tags...)
+	for _, label := range sortedLabels(metric) {
+		tags = append(tags, fmt.Sprintf("%s:%s", label.GetName(), label.GetValue()))
+	}
+	return tags
+}
+
+func sortedLabels(metric *dto.Metric) []*dto.LabelPair {
+	labels := append([]*dto.LabelPair{}, metric.GetLabel()...)
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].GetName() < labels[j].GetName()
+	})
+	return labels
+}
+
+// sanitizeStatsd replaces the characters with a special meaning in the
+// statsd protocol, and dots that would split the name into more levels.
+func sanitizeStatsd(value string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", " ", "_").
+		Replace(value)
+}
@@ -0,0 +1,94 @@
+package toxiproxy
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/Shopify/toxiproxy/v2/collectors"
+)
+
+func readStatsdPacket(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+
+	buf := make([]byte, statsdPacketSize)
+	err := conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal("Failed to read statsd packet:", err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestStatsdExporterPushesCounterDeltas(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cases := []struct {
+		name      string
+		dogstatsd bool
+		expected  string
+	}{
+		{
+			"statsd",
+			false,
+			"toxiproxy.toxiproxy_proxy_received_bytes_total." +
+				"upstream.127_0_0_1_6380.redis.localhost_6379:%s|c",
+		},
+		{
+			"dogstatsd",
+			true,
+			"toxiproxy.toxiproxy_proxy_received_bytes_total:%s|c|#env:test," +
+				"direction:upstream,listener:127.0.0.1:6380,proxy:redis,upstream:localhost:6379",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := NewMetricsContainer(prometheus.NewRegistry())
+			metrics.ProxyMetrics = collectors.NewProxyMetricCollectors()
+			counter := metrics.ProxyMetrics.ReceivedBytesTotal.
+				WithLabelValues("upstream", "redis", "127.0.0.1:6380", "localhost:6379")
+
+			exporter, err := NewStatsdExporter(metrics, StatsdConfig{
+				Addr:      conn.LocalAddr().String(),
+				Prefix:    "toxiproxy.",
+				Tags:      []string{"env:test"},
+				Interval:  time.Hour,
+				DogStatsD: tc.dogstatsd,
+			}, zerolog.Nop())
+			if err != nil {
+				t.Fatal("Failed to create exporter:", err)
+			}
+			go exporter.Run()
+			defer exporter.Stop()
+
+			counter.Add(5)
+			exporter.Push()
+			actual := readStatsdPacket(t, conn)
+			expected := []string{strings.Replace(tc.expected, "%s", "5", 1)}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected:\n  %v\ngot:\n  %v", expected, actual)
+			}
+
+			counter.Add(3)
+			exporter.Push()
+			actual = readStatsdPacket(t, conn)
+			expected = []string{strings.Replace(tc.expected, "%s", "3", 1)}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected:\n  %v\ngot:\n  %v", expected, actual)
+			}
+		})
+	}
+}
@@ -7,29 +7,88 @@ import (
 )
 
 // Stores a slice of bytes with its receive timestamp.
+//
+// The data of chunks created by a ChanWriter comes from a pool, and is reused
+// once a ChanReader has read all of it. Toxics must not keep the data of a
+// chunk after sending it to their output, but can send new chunks of parts of
+// it, which are not reused.
 type StreamChunk struct {
 	Data      []byte
 	Timestamp time.Time
+	pooled    *[]byte
+}
+
+// release returns the data of the chunk to its pool.
+func (c *StreamChunk) release() {
+	if c.pooled != nil {
+		putBuffer(c.pooled)
+		c.pooled = nil
+	}
 }
 
 // Implements the io.WriteCloser interface for a chan []byte.
 type ChanWriter struct {
-	output chan<- *StreamChunk
+	output     chan<- *StreamChunk
+	bufferSize int
+	onBlock    func()
 }
 
 func NewChanWriter(output chan<- *StreamChunk) *ChanWriter {
-	return &ChanWriter{output}
+	return &ChanWriter{output: output, bufferSize: DefaultBufferSize}
+}
+
+// SetBufferSize sets the number of bytes read at once by ReadFrom, which is
+// the largest size of the chunks it writes.
+func (c *ChanWriter) SetBufferSize(size int) {
+	c.bufferSize = size
+}
+
+// SetOnBlock sets a function called each time a write waits for the channel
+// to have room, e.g. to count the reads slowed down by the toxics.
+func (c *ChanWriter) SetOnBlock(onBlock func()) {
+	c.onBlock = onBlock
 }
 
 // Write `buf` as a StreamChunk to the channel. The full buffer is always written, and error
 // will always be nil. Calling `Write()` after closing the channel will panic.
 func (c *ChanWriter) Write(buf []byte) (int, error) {
-	packet := &StreamChunk{make([]byte, len(buf)), time.Now()}
+	data := getBuffer(len(buf))
+	packet := &StreamChunk{Data: *data, Timestamp: time.Now(), pooled: data}
 	copy(packet.Data, buf) // Make a copy before sending it to the channel
+	if c.onBlock != nil {
+		select {
+		case c.output <- packet:
+			return len(buf), nil
+		default:
+			c.onBlock()
+		}
+	}
 	c.output <- packet
 	return len(buf), nil
 }
 
+// ReadFrom writes the data read from r as StreamChunks, reading into a buffer
+// from the pool rather than allocating one as io.Copy does.
+func (c *ChanWriter) ReadFrom(r io.Reader) (int64, error) {
+	buf := getBuffer(c.bufferSize)
+	defer putBuffer(buf)
+
+	var written int64
+	for {
+		n, err := r.Read(*buf)
+		if n > 0 {
+			c.Write((*buf)[:n])
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
 // Close the output channel.
 func (c *ChanWriter) Close() error {
 	close(c.output)
@@ -41,12 +100,13 @@ type ChanReader struct {
 	input     <-chan *StreamChunk
 	interrupt <-chan struct{}
 	buffer    []byte
+	current   *StreamChunk
 }
 
 var ErrInterrupted = fmt.Errorf("read interrupted by channel")
 
 func NewChanReader(input <-chan *StreamChunk) *ChanReader {
-	return &ChanReader{input, make(chan struct{}), []byte{}}
+	return &ChanReader{input: input, interrupt: make(chan struct{}), buffer: []byte{}}
 }
 
 // Specify a channel that can interrupt a read if it is blocking.
@@ -63,22 +123,25 @@ func (c *ChanReader) Read(out []byte) (int, error) {
 	}
 	n := copy(out, c.buffer)
 	c.buffer = c.buffer[n:]
-	if len(out) <= len(c.buffer) {
+	if len(c.buffer) > 0 || n == len(out) {
 		return n, nil
-	} else if n > 0 {
+	}
+
+	// The current chunk has been read entirely.
+	if c.current != nil {
+		c.current.release()
+		c.current = nil
+	}
+
+	if n > 0 {
 		// We have some data to return, so make the channel read optional
 		select {
 		case p := <-c.input:
 			if p == nil { // Stream was closed
 				c.buffer = nil
-				if n > 0 {
-					return n, nil
-				}
-				return 0, io.EOF
+				return n, nil
 			}
-			n2 := copy(out[n:], p.Data)
-			c.buffer = p.Data[n2:]
-			return n + n2, nil
+			return n + c.take(p, out[n:]), nil
 		default:
 			return n, nil
 		}
@@ -94,7 +157,55 @@ func (c *ChanReader) Read(out []byte) (int, error) {
 		c.buffer = nil
 		return 0, io.EOF
 	}
-	n2 := copy(out[n:], p.Data)
-	c.buffer = p.Data[n2:]
-	return n + n2, nil
+	return c.take(p, out), nil
+}
+
+// take reads a new chunk into `out`, and keeps the rest of it for the next reads.
+func (c *ChanReader) take(p *StreamChunk, out []byte) int {
+	n := copy(out, p.Data)
+	c.buffer = p.Data[n:]
+	if c.buffer == nil { // A nil buffer means the stream was closed
+		c.buffer = []byte{}
+	}
+	c.current = p
+	return n
+}
+
+// WriteTo writes the chunks of the channel to w as they come, without copying
+// them into a buffer as io.Copy does.
+func (c *ChanReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if c.buffer == nil {
+			return written, nil
+		}
+		if len(c.buffer) > 0 {
+			n, err := w.Write(c.buffer)
+			written += int64(n)
+			c.buffer = c.buffer[n:]
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		if c.current != nil {
+			c.current.release()
+			c.current = nil
+		}
+		select {
+		case p := <-c.input:
+			if p == nil { // Stream was closed
+				c.buffer = nil
+				return written, nil
+			}
+			c.buffer = p.Data
+			if c.buffer == nil {
+				c.buffer = []byte{}
+			}
+			c.current = p
+		case <-c.interrupt:
+			return written, ErrInterrupted
+		}
+	}
 }
@@ -221,3 +221,91 @@ func TestStream_ReadInterrupt(t *testing.T) {
 		t.Fatal("Got wrong message from stream", string(readMsg))
 	}
 }
+
+func TestReadChunksLargerThanBuffer(t *testing.T) {
+	send := bytes.Repeat([]byte("0123456789"), 5)
+	c := make(chan *StreamChunk, 2)
+	writer := NewChanWriter(c)
+	reader := NewChanReader(c)
+	writer.Write(send[:20])
+	writer.Write(send[20:])
+	writer.Close()
+
+	var received []byte
+	buf := make([]byte, 6)
+	for {
+		n, err := reader.Read(buf)
+		received = append(received, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("Couldn't read from stream", err)
+		}
+	}
+	if !bytes.Equal(received, send) {
+		t.Fatalf("Got wrong message from stream: %q", received)
+	}
+}
+
+func TestPooledChunksAreNotShared(t *testing.T) {
+	c := make(chan *StreamChunk, 1)
+	writer := NewChanWriter(c)
+	reader := NewChanReader(c)
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			writer.Write(bytes.Repeat([]byte{byte(i)}, 1+i%3000))
+		}
+		writer.Close()
+	}()
+
+	var received bytes.Buffer
+	_, err := io.Copy(&received, reader)
+	if err != nil {
+		t.Fatal("Couldn't read from stream", err)
+	}
+	for i := 0; i < 1000; i++ {
+		expected := bytes.Repeat([]byte{byte(i)}, 1+i%3000)
+		if !bytes.Equal(received.Next(len(expected)), expected) {
+			t.Fatalf("Got wrong data for chunk %d", i)
+		}
+	}
+}
+
+func TestReadFromWritesChunks(t *testing.T) {
+	send := bytes.Repeat([]byte("hello world"), 10000)
+	c := make(chan *StreamChunk)
+	writer := NewChanWriter(c)
+	reader := NewChanReader(c)
+
+	go func() {
+		io.Copy(writer, bytes.NewReader(send))
+		writer.Close()
+	}()
+
+	received, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Couldn't read from stream", err)
+	}
+	if !bytes.Equal(received, send) {
+		t.Fatal("Got wrong message from stream")
+	}
+}
+
+func BenchmarkChanReadWrite(b *testing.B) {
+	send := make([]byte, 16*1024)
+	c := make(chan *StreamChunk, 16)
+	writer := NewChanWriter(c)
+	reader := NewChanReader(c)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(send)))
+	go func() {
+		for i := 0; i < b.N; i++ {
+			writer.Write(send)
+		}
+		writer.Close()
+	}()
+	io.Copy(io.Discard, reader)
+}
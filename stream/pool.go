@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Chunk data is allocated from pools of buffers with sizes in powers of two,
+// from 512 bytes up to 1MB. Larger chunks are not pooled.
+const (
+	minPooledShift = 9
+	maxPooledShift = 20
+	maxPooledSize  = 1 << maxPooledShift
+)
+
+// DefaultBufferSize is the number of bytes a ChanWriter reads at once, as with
+// io.Copy.
+const DefaultBufferSize = 32 * 1024
+
+var bufferPools [maxPooledShift - minPooledShift + 1]sync.Pool
+
+// poolIndex returns the index of the smallest pool with buffers of at least
+// size bytes.
+func poolIndex(size int) int {
+	shift := bits.Len(uint(size - 1))
+	if shift < minPooledShift {
+		return 0
+	}
+	return shift - minPooledShift
+}
+
+// getBuffer returns a buffer of size bytes, from a pool if it is small enough.
+func getBuffer(size int) *[]byte {
+	if size > maxPooledSize {
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	index := poolIndex(size)
+	if buf, ok := bufferPools[index].Get().(*[]byte); ok {
+		*buf = (*buf)[:size]
+		return buf
+	}
+	buf := make([]byte, size, 1<<(index+minPooledShift))
+	return &buf
+}
+
+// putBuffer returns a buffer to its pool, it must not be used anymore.
+func putBuffer(buf *[]byte) {
+	size := cap(*buf)
+	if size > maxPooledSize || size&(size-1) != 0 || size < 1<<minPooledShift {
+		return
+	}
+	bufferPools[poolIndex(size)].Put(buf)
+}
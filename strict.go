@@ -0,0 +1,78 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// strictHeader makes a request strict or not, whatever the mode of the
+// server, e.g. "X-Toxiproxy-Strict: true".
+const strictHeader = "X-Toxiproxy-Strict"
+
+// proxyFields are the fields of a proxy in the API, with the toxics written
+// with it, which are ignored when a proxy is created or updated.
+type proxyFields struct {
+	Proxy
+	Toxics json.RawMessage `json:"toxics"`
+}
+
+// toxicFields are the fields of a toxic in the API. Its attributes are
+// checked against the type of the toxic, in strict mode or not.
+type toxicFields struct {
+	toxics.ToxicWrapper
+	Toxic json.RawMessage `json:"attributes"`
+}
+
+// strict reports whether the fields of the body of a request that are
+// unknown are rejected, if the server is strict or the request asks to be.
+// A header that is not a boolean makes the request strict.
+func (server *ApiServer) strict(request *http.Request) bool {
+	header := request.Header.Get(strictHeader)
+	if header == "" {
+		return server.Strict
+	}
+	strict, err := strconv.ParseBool(header)
+	return strict || err != nil
+}
+
+// checkBody rejects the body of a strict request if it has fields that v
+// doesn't, leaving the body to be decoded by the handler.
+func (server *ApiServer) checkBody(request *http.Request, v interface{}) error {
+	if !server.strict(request) {
+		return nil
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return joinError(err, ErrBadRequestBody)
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return checkFields(body, v)
+}
+
+// checkFields rejects the fields of data that v doesn't have. The other
+// errors of data are left to its decoding.
+func checkFields(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	field, ok := unknownField(decoder.Decode(v))
+	if ok {
+		return joinError(fmt.Errorf("%s", field), ErrUnknownField)
+	}
+	return nil
+}
+
+// unknownField returns the name of the unknown field of a decoding error.
+func unknownField(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	name, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	return strings.Trim(name, `"`), ok
+}
@@ -0,0 +1,123 @@
+package toxiproxy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func strictPost(t *testing.T, url, strict, body string) (int, string) {
+	request, err := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal("Failed to create request", err)
+	}
+	if strict != "" {
+		request.Header.Set("X-Toxiproxy-Strict", strict)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Failed to post", err)
+	}
+	defer resp.Body.Close()
+
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+	return resp.StatusCode, apiErr.Code
+}
+
+func TestStrictRequestsRejectUnknownFields(t *testing.T) {
+	WithServer(t, func(addr string) {
+		body := `{"name": "mysql", "upstream": "localhost:20001", "enabeld": false}`
+		status, code := strictPost(t, addr+"/proxies", "true", body)
+		if status != http.StatusBadRequest || code != "unknown_field" {
+			t.Fatalf("Expected the unknown field to be rejected, got %d %q", status, code)
+		}
+		status, _ = strictPost(t, addr+"/proxies", "", body)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected the unknown field to be ignored, got %d", status)
+		}
+
+		toxic := `{"type": "latency", "toxicty": 0.5, "attributes": {"latency": 100}}`
+		status, code = strictPost(t, addr+"/proxies/mysql/toxics", "1", toxic)
+		if status != http.StatusBadRequest || code != "unknown_field" {
+			t.Fatalf("Expected the unknown field of the toxic to be rejected, got %d %q", status, code)
+		}
+		status, _ = strictPost(t, addr+"/proxies/mysql/toxics", "", toxic)
+		if status != http.StatusOK {
+			t.Fatalf("Expected the unknown field of the toxic to be ignored, got %d", status)
+		}
+	})
+}
+
+func TestStrictServerAcceptsTheClient(t *testing.T) {
+	WithServer(t, func(addr string) {
+		testServer.Strict = true
+		defer func() {
+			testServer.Strict = false
+		}()
+
+		proxy, err := client.CreateProxy("mysql", "localhost:3310", "localhost:20001")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+		_, err = proxy.AddToxic("slow", "latency", "downstream", 1, tclient.Attributes{"latency": 100})
+		if err != nil {
+			t.Fatal("Unable to create toxic:", err)
+		}
+		_, err = proxy.UpdateToxic("slow", 0.5, tclient.Attributes{"jitter": 10})
+		if err != nil {
+			t.Fatal("Unable to update toxic:", err)
+		}
+		proxy.Upstream = "localhost:20002"
+		err = proxy.Save()
+		if err != nil {
+			t.Fatal("Unable to save proxy with its toxics:", err)
+		}
+		_, err = client.Populate([]tclient.Proxy{*proxy})
+		if err != nil {
+			t.Fatal("Unable to populate proxies:", err)
+		}
+
+		body := `{"name": "redis", "upstream": "localhost:6379", "enable": false}`
+		status, code := strictPost(t, addr+"/proxies", "", body)
+		if status != http.StatusBadRequest || code != "unknown_field" {
+			t.Fatalf("Expected the unknown field to be rejected, got %d %q", status, code)
+		}
+		status, _ = strictPost(t, addr+"/proxies", "false", body)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected the request to opt out of the strict mode, got %d", status)
+		}
+	})
+}
+
+func TestStrictConfigRejectsUnknownFields(t *testing.T) {
+	WithServer(t, func(addr string) {
+		testServer.Strict = true
+		defer func() {
+			testServer.Strict = false
+		}()
+
+		config := filepath.Join(t.TempDir(), "toxiproxy.json")
+		data := `[{"name": "mysql", "listen": "localhost:3310", "upstraem": "localhost:20001"}]`
+		err := os.WriteFile(config, []byte(data), 0o600)
+		if err != nil {
+			t.Fatal("Failed to write config", err)
+		}
+
+		testServer.PopulateConfig(config)
+		proxies, err := client.Proxies()
+		if err != nil {
+			t.Fatal("Unable to list proxies:", err)
+		}
+		if len(proxies) != 0 {
+			t.Fatalf("Expected the config to be rejected, got %d proxies", len(proxies))
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package toxiproxy
+
+import (
+	"fmt"
+	"time"
+)
+
+// Modes of the connections open to the previous upstream of a proxy switched
+// over to another one.
+const (
+	SwitchKeep  = "keep"  // Keep them open, the default
+	SwitchDrain = "drain" // Close them after the drain timeout, unless closed before
+	SwitchReset = "reset" // Reset them at once
+)
+
+// Reason of the links closed by a switchover of their proxy.
+const closeReasonSwitchover = "switchover"
+
+// Switchover tells what becomes of the connections of a proxy moved to another
+// upstream, e.g. to reproduce the clients of a DNS failover, which keep their
+// connections, or of a blue/green switch, which loses them once drained.
+type Switchover struct {
+	Connections string `json:"connections"`
+	// Milliseconds the drained connections have to close before they are
+	// closed, 0 to close them at once.
+	DrainTimeout int `json:"drain_timeout"`
+}
+
+func (switchover Switchover) validate() error {
+	switch switchover.Connections {
+	case "", SwitchKeep, SwitchDrain, SwitchReset:
+	default:
+		return joinError(
+			fmt.Errorf("connections must be keep, drain or reset, not %q", switchover.Connections),
+			ErrInvalidSwitchover,
+		)
+	}
+	if switchover.DrainTimeout < 0 {
+		return joinError(fmt.Errorf("drain_timeout must not be negative"), ErrInvalidSwitchover)
+	}
+	return nil
+}
+
+// Switch points the proxy to another upstream at once, for the clients
+// accepted from then on, and keeps, drains or resets the connections open to
+// the previous upstream.
+func (proxy *Proxy) Switch(upstream string, switchover Switchover) error {
+	proxy.Lock()
+	defer proxy.Unlock()
+
+	return proxy.switchUpstream(upstream, switchover)
+}
+
+// switchUpstream switches the proxy to another upstream, assumes the lock
+// has already been taken.
+func (proxy *Proxy) switchUpstream(upstream string, switchover Switchover) error {
+	if upstream == "" && needsUpstream(proxy.protocol()) {
+		return joinError(fmt.Errorf("upstream"), ErrMissingField)
+	}
+	err := validatePortRanges(proxy.Listen, upstream)
+	if err != nil {
+		return err
+	}
+	err = switchover.validate()
+	if err != nil {
+		return err
+	}
+	if upstream == proxy.Upstream {
+		return nil
+	}
+	proxy.setUpstream(upstream)
+
+	if switchover.Connections == "" || switchover.Connections == SwitchKeep ||
+		!needsUpstream(proxy.protocol()) {
+		return nil
+	}
+	var previous []*clientConnection
+	proxy.connections.each(func(conn *clientConnection) {
+		if !dialedFor(upstream, conn.address) {
+			previous = append(previous, conn)
+		}
+	})
+	proxy.Logger.
+		Info().
+		Str("connections", switchover.Connections).
+		Int("count", len(previous)).
+		Msg("Switching over the connections to the previous upstream")
+
+	timeout := time.Duration(switchover.DrainTimeout) * time.Millisecond
+	for _, conn := range previous {
+		if switchover.Connections == SwitchReset {
+			proxy.switchOver(conn, true)
+		} else {
+			go proxy.drain(conn, timeout)
+		}
+	}
+	return nil
+}
+
+// dialedFor reports whether an address was dialed for an upstream, one of
+// the addresses of a port range.
+func dialedFor(upstream, address string) bool {
+	// It was validated when set.
+	r, _ := parsePortRange(upstream)
+	if r == nil {
+		return address == upstream
+	}
+	for i := range r.size() {
+		if r.address(i) == address {
+			return true
+		}
+	}
+	return false
+}
+
+// drain closes a connection after a timeout, unless it is removed before.
+func (proxy *Proxy) drain(conn *clientConnection, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-conn.done:
+	case <-timer.C:
+		proxy.switchOver(conn, false)
+	}
+}
+
+// switchOver closes or resets a connection to the previous upstream, its links
+// are closed with the reason once they notice.
+func (proxy *Proxy) switchOver(conn *clientConnection, reset bool) {
+	reason := closeReasonSwitchover
+	if !conn.timeout.CompareAndSwap(nil, &reason) {
+		return
+	}
+	if reset {
+		conn.reset()
+	}
+	conn.close()
+}
@@ -4,16 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/Shopify/toxiproxy/v2/collectors"
 	"github.com/Shopify/toxiproxy/v2/stream"
 	"github.com/Shopify/toxiproxy/v2/toxics"
 )
 
+// streamBoth is the stream of a toxic applied to both directions.
+const streamBoth = "both"
+
 // ToxicCollection contains a list of toxics that are chained together. Each proxy
 // has its own collection. A hidden noop toxic is always maintained at the beginning
 // of each chain so toxics have a method of pausing incoming data (by interrupting
@@ -25,6 +33,8 @@ type ToxicCollection struct {
 	proxy *Proxy
 	chain [][]*toxics.ToxicWrapper
 	links map[string]*ToxicLink
+	// The updates of the toxics following waveforms, by name
+	modulations map[string]chan struct{}
 }
 
 func NewToxicCollection(proxy *Proxy) *ToxicCollection {
@@ -38,7 +48,7 @@ func NewToxicCollection(proxy *Proxy) *ToxicCollection {
 		links: make(map[string]*ToxicLink),
 	}
 	for dir := range collection.chain {
-		collection.chain[dir] = make([]*toxics.ToxicWrapper, 1, toxics.Count()+1)
+		collection.chain[dir] = make([]*toxics.ToxicWrapper, 1, collection.registry().Count()+1)
 		collection.chain[dir][0] = collection.noop
 	}
 	return collection
@@ -48,6 +58,9 @@ func (c *ToxicCollection) ResetToxics(ctx context.Context) {
 	c.Lock()
 	defer c.Unlock()
 
+	for name := range c.modulations {
+		c.stopModulation(name)
+	}
 	// Remove all but the first noop toxic
 	for dir := range c.chain {
 		for len(c.chain[dir]) > 1 {
@@ -74,6 +87,10 @@ func (c *ToxicCollection) GetToxicArray() []toxics.Toxic {
 				// Skip the first noop toxic, it should not be visible
 				continue
 			}
+			if toxic.Pair != nil && toxic.Direction == stream.Upstream {
+				// A toxic of both streams is shown once, by its downstream half
+				continue
+			}
 			result = append(result, toxic)
 		}
 	}
@@ -98,18 +115,31 @@ func (c *ToxicCollection) AddToxicJson(data io.Reader) (*toxics.ToxicWrapper, er
 		return nil, joinError(err, ErrBadRequestBody)
 	}
 
-	wrapper.Direction, err = stream.ParseDirection(wrapper.Stream)
-	if err != nil {
-		return nil, ErrInvalidStream
+	both := strings.EqualFold(wrapper.Stream, streamBoth)
+	if both {
+		wrapper.Stream = streamBoth
+		wrapper.Direction = stream.Downstream
+	} else {
+		wrapper.Direction, err = stream.ParseDirection(wrapper.Stream)
+		if err != nil {
+			return nil, ErrInvalidStream
+		}
 	}
 
 	if wrapper.Name == "" {
 		wrapper.Name = fmt.Sprintf("%s_%s", wrapper.Type, wrapper.Stream)
 	}
+	if wrapper.Seed == 0 {
+		wrapper.Seed = c.seeds().next()
+	}
+	// The scope counts the connections opened from now on.
+	wrapper.LastConnection = c.lastConnection()
 
-	if toxics.New(wrapper) == nil {
+	if c.registry().New(wrapper) == nil {
 		return nil, ErrInvalidToxicType
 	}
+	wrapper.Stats = toxics.NewToxicStats()
+	c.observeLatency(wrapper)
 
 	found := c.findToxicByName(wrapper.Name)
 	if found != nil {
@@ -117,20 +147,155 @@ func (c *ToxicCollection) AddToxicJson(data io.Reader) (*toxics.ToxicWrapper, er
 	}
 
 	// Parse attributes because we now know the toxics type.
-	attrs := &struct {
-		Attributes interface{} `json:"attributes"`
-	}{
-		wrapper.Toxic,
+	err = checkAttributes(buffer.Bytes(), wrapper.Toxic)
+	if err != nil {
+		return nil, err
 	}
-	err = json.NewDecoder(&buffer).Decode(attrs)
+	err = decodeAttributes(buffer.Bytes(), wrapper.Toxic)
 	if err != nil {
-		return nil, joinError(err, ErrBadRequestBody)
+		return nil, err
+	}
+	err = validateModulation(wrapper.Modulation, wrapper.Toxic)
+	if err != nil {
+		return nil, err
+	}
+	err = validateMatch(wrapper.Match)
+	if err != nil {
+		return nil, err
+	}
+	err = modulateAttributes(wrapper, time.Now())
+	if err != nil {
+		return nil, err
 	}
 
+	if both {
+		// The upstream half gets its own attributes, so that no toxic is
+		// shared by the two streams.
+		pair := *wrapper
+		pair.Direction = stream.Upstream
+		pair.Pair = wrapper
+		wrapper.Pair = &pair
+		c.registry().New(&pair)
+		err = decodeAttributes(buffer.Bytes(), pair.Toxic)
+		if err != nil {
+			return nil, err
+		}
+		err = modulateAttributes(&pair, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		c.chainAddToxic(&pair)
+	}
 	c.chainAddToxic(wrapper)
+	c.modulate(wrapper)
 	return wrapper, nil
 }
 
+// validateMatch checks the CIDR and the ports of the match of a toxic.
+func validateMatch(match *toxics.Match) error {
+	err := match.Validate()
+	if err != nil {
+		return joinError(err, ErrInvalidMatch)
+	}
+	return nil
+}
+
+// checkAttributes decodes the attributes of data onto a copy of a toxic, and
+// rejects the attributes the toxic doesn't have or that are out of their
+// range, before they are decoded onto the toxic itself.
+func checkAttributes(data []byte, toxic toxics.Toxic) error {
+	attrs := &struct {
+		Attributes json.RawMessage `json:"attributes"`
+	}{}
+	err := json.Unmarshal(data, attrs)
+	if err != nil {
+		return attributesError(err)
+	}
+
+	candidate, err := copyToxic(toxic)
+	if err != nil {
+		return internalError(err)
+	}
+	if len(attrs.Attributes) > 0 && string(attrs.Attributes) != "null" {
+		decoder := json.NewDecoder(bytes.NewReader(attrs.Attributes))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(candidate)
+		if attribute, ok := unknownField(err); ok {
+			return invalidAttribute(attribute, "is not an attribute of the toxic")
+		}
+		if err != nil {
+			return attributesError(prefixAttribute(err))
+		}
+	}
+
+	var attrErr *toxics.AttributeError
+	err = toxics.Validate(candidate)
+	if errors.As(err, &attrErr) {
+		return invalidAttribute(attrErr.Attribute, attrErr.Message)
+	}
+	if err != nil {
+		return joinError(err, ErrBadRequestBody)
+	}
+	return nil
+}
+
+// copyToxic returns a toxic of the same type with the same attributes, onto
+// which an update is decoded before it is applied to the toxic.
+func copyToxic(toxic toxics.Toxic) (toxics.Toxic, error) {
+	data, err := json.Marshal(toxic)
+	if err != nil {
+		return nil, err
+	}
+	copied := reflect.New(reflect.TypeOf(toxic).Elem()).Interface().(toxics.Toxic)
+	err = json.Unmarshal(data, copied)
+	if err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// applyAttributes decodes the attributes of the checked copy onto the toxic,
+// which keeps the rest of its state.
+func applyAttributes(copied, toxic toxics.Toxic) error {
+	data, err := json.Marshal(copied)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, toxic)
+}
+
+// prefixAttribute names the field of a type error of the attributes as
+// decoded with the rest of the toxic, e.g. attributes.latency.
+func prefixAttribute(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		typeErr.Field = "attributes." + typeErr.Field
+	}
+	return err
+}
+
+// invalidAttribute is the error of an attribute of a toxic, with the code of
+// the attribute, e.g. invalid_attribute:latency.
+func invalidAttribute(attribute, message string) *ApiError {
+	apiErr := joinError(fmt.Errorf("%s %s", attribute, message), ErrInvalidAttribute)
+	apiErr.Code += ":" + attribute
+	return apiErr
+}
+
+// decodeAttributes parses the attributes of a toxic in data.
+func decodeAttributes(data []byte, toxic toxics.Toxic) error {
+	attrs := &struct {
+		Attributes interface{} `json:"attributes"`
+	}{
+		toxic,
+	}
+	err := json.NewDecoder(bytes.NewReader(data)).Decode(attrs)
+	if err != nil {
+		return attributesError(err)
+	}
+	return nil
+}
+
 func (c *ToxicCollection) UpdateToxicJson(
 	name string,
 	data io.Reader,
@@ -140,25 +305,139 @@ func (c *ToxicCollection) UpdateToxicJson(
 
 	toxic := c.findToxicByName(name)
 	if toxic != nil {
+		body, err := io.ReadAll(data)
+		if err != nil {
+			return nil, joinError(err, ErrBadRequestBody)
+		}
+		err = checkAttributes(body, toxic.Toxic)
+		if err != nil {
+			return nil, err
+		}
+
+		// The update is checked on copies of the halves, so that the toxic is
+		// left as it was if any of it is rejected.
+		var copies []*toxics.ToxicWrapper
+		for _, half := range halves(toxic) {
+			copied, err := copyToxic(half.Toxic)
+			if err != nil {
+				return nil, internalError(err)
+			}
+			copies = append(copies, &toxics.ToxicWrapper{Toxic: copied})
+		}
+
 		attrs := &struct {
-			Attributes interface{} `json:"attributes"`
-			Toxicity   float32     `json:"toxicity"`
+			Attributes interface{}     `json:"attributes"`
+			Toxicity   float32         `json:"toxicity"`
+			Sticky     bool            `json:"sticky"`
+			Modulation json.RawMessage `json:"modulation"`
+			First      int             `json:"first_connections"`
+			Every      int             `json:"every_connection"`
+			Match      json.RawMessage `json:"match"`
 		}{
-			toxic.Toxic,
-			toxic.Toxicity,
+			Attributes: copies[0].Toxic,
+			Toxicity:   toxic.Toxicity,
+			Sticky:     toxic.Sticky,
+			First:      toxic.FirstConnections,
+			Every:      toxic.EveryConnection,
 		}
-		err := json.NewDecoder(data).Decode(attrs)
+		err = json.NewDecoder(bytes.NewReader(body)).Decode(attrs)
 		if err != nil {
-			return nil, joinError(err, ErrBadRequestBody)
+			return nil, attributesError(err)
+		}
+		if toxic.Pair != nil {
+			err = decodeAttributes(body, copies[1].Toxic)
+			if err != nil {
+				return nil, err
+			}
 		}
-		toxic.Toxicity = attrs.Toxicity
 
-		c.chainUpdateToxic(toxic)
+		// The waveforms are replaced when given, and removed with null.
+		modulation := toxic.Modulation
+		if len(attrs.Modulation) > 0 {
+			modulation = nil
+			err = json.Unmarshal(attrs.Modulation, &modulation)
+			if err != nil {
+				return nil, joinError(err, ErrBadRequestBody)
+			}
+		}
+		err = validateModulation(modulation, copies[0].Toxic)
+		if err != nil {
+			return nil, err
+		}
+		for _, copied := range copies {
+			copied.Modulation = modulation
+			err = modulateAttributes(copied, time.Now())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The match is replaced when given, and removed with null.
+		match := toxic.Match
+		if len(attrs.Match) > 0 {
+			match = nil
+			err = json.Unmarshal(attrs.Match, &match)
+			if err != nil {
+				return nil, joinError(err, ErrBadRequestBody)
+			}
+			err = validateMatch(match)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i, half := range halves(toxic) {
+			err = applyAttributes(copies[i].Toxic, half.Toxic)
+			if err != nil {
+				return nil, internalError(err)
+			}
+		}
+		for _, half := range halves(toxic) {
+			half.Toxicity = attrs.Toxicity
+			half.Sticky = attrs.Sticky
+			half.FirstConnections = attrs.First
+			half.EveryConnection = attrs.Every
+			half.Modulation = modulation
+			half.Match = match
+			c.chainUpdateToxic(half)
+		}
+		c.modulate(toxic)
 		return toxic, nil
 	}
 	return nil, ErrToxicNotFound
 }
 
+// ResumeToxic resumes the connections held paused by a toxic, e.g. a
+// limit_data toxic with pause, the ones of both streams for a toxic of both.
+func (c *ToxicCollection) ResumeToxic(name string) (*toxics.ToxicWrapper, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	toxic := c.findToxicByName(name)
+	if toxic == nil {
+		return nil, ErrToxicNotFound
+	}
+	resumable, ok := toxic.Toxic.(toxics.ResumableToxic)
+	if !ok {
+		return nil, ErrToxicNotResumable
+	}
+
+	for _, half := range halves(toxic) {
+		group := sync.WaitGroup{}
+		for _, link := range c.links {
+			if link.direction == half.Direction {
+				group.Add(1)
+				go func(link *ToxicLink) {
+					defer group.Done()
+					link.ResumeToxic(half, resumable)
+				}(link)
+			}
+		}
+		group.Wait()
+	}
+	return toxic, nil
+}
+
 func (c *ToxicCollection) RemoveToxic(ctx context.Context, name string) error {
 	log := zerolog.Ctx(ctx).
 		With().
@@ -178,11 +457,47 @@ func (c *ToxicCollection) RemoveToxic(ctx context.Context, name string) error {
 		return ErrToxicNotFound
 	}
 
-	c.chainRemoveToxic(ctx, toxic)
+	c.stopModulation(name)
+	for _, half := range halves(toxic) {
+		c.chainRemoveToxic(ctx, half)
+	}
 	log.Trace().Msg("Finished")
 	return nil
 }
 
+func (c *ToxicCollection) ReorderToxics(ctx context.Context, names []string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	order := make([][]*toxics.ToxicWrapper, len(c.chain))
+	for _, name := range names {
+		toxic := c.findToxicByName(name)
+		if toxic == nil {
+			return ErrToxicNotFound
+		}
+		for _, half := range halves(toxic) {
+			order[half.Direction] = append(order[half.Direction], half)
+		}
+	}
+	for dir := range c.chain {
+		if len(order[dir]) != len(c.chain[dir])-1 {
+			return ErrInvalidToxicOrder
+		}
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return ErrInvalidToxicOrder
+		}
+		seen[name] = true
+	}
+
+	for dir := range c.chain {
+		c.chainReorderToxics(stream.Direction(dir), order[dir])
+	}
+	return nil
+}
+
 func (c *ToxicCollection) StartLink(
 	server *ApiServer,
 	name string,
@@ -211,12 +526,71 @@ func (c *ToxicCollection) RemoveLink(name string) {
 	delete(c.links, name)
 }
 
+// seeds returns the seed source of the server of the proxy.
+func (c *ToxicCollection) seeds() *seedSource {
+	if c.proxy == nil || c.proxy.apiServer == nil {
+		return nil
+	}
+	return c.proxy.apiServer.seeds
+}
+
+// lastConnection returns the id of the last connection of the proxy opened.
+func (c *ToxicCollection) lastConnection() uint64 {
+	if c.proxy == nil || c.proxy.connections == nil {
+		return 0
+	}
+	return c.proxy.connections.nextID.Load()
+}
+
+// registry returns the toxic types of the server of the proxy.
+func (c *ToxicCollection) registry() *toxics.Registry {
+	if c.proxy == nil || c.proxy.apiServer == nil || c.proxy.apiServer.Toxics == nil {
+		return toxics.DefaultRegistry
+	}
+	return c.proxy.apiServer.Toxics
+}
+
+// proxyMetrics returns the proxy metric collectors, or nil if they are disabled.
+func (c *ToxicCollection) proxyMetrics() *collectors.ProxyMetricCollectors {
+	if c.proxy == nil || c.proxy.apiServer == nil {
+		return nil
+	}
+	if !c.proxy.apiServer.Metrics.proxyMetricsEnabled() {
+		return nil
+	}
+	return c.proxy.apiServer.Metrics.ProxyMetrics
+}
+
+func (c *ToxicCollection) toxicMetricLabels(toxic *toxics.ToxicWrapper) []string {
+	direction := toxic.Direction.String()
+	if toxic.Stream == streamBoth {
+		direction = streamBoth
+	}
+	return []string{
+		direction,
+		c.proxy.name(),
+		toxic.Name,
+		toxic.Type,
+	}
+}
+
+// observeLatency has the latency added by a toxic observed by its histogram.
+func (c *ToxicCollection) observeLatency(toxic *toxics.ToxicWrapper) {
+	if metrics := c.proxyMetrics(); metrics != nil {
+		toxic.Stats.SetObserver(metrics.ToxicLatencyAdded.
+			WithLabelValues(c.toxicMetricLabels(toxic)...))
+	}
+}
+
 // All following functions assume the lock is already grabbed.
 func (c *ToxicCollection) findToxicByName(name string) *toxics.ToxicWrapper {
 	for dir := range c.chain {
 		// Skip the first noop toxic, it has no name
 		for _, toxic := range c.chain[dir][1:] {
 			if toxic.Name == name {
+				if toxic.Pair != nil && toxic.Direction == stream.Upstream {
+					return toxic.Pair
+				}
 				return toxic
 			}
 		}
@@ -224,6 +598,15 @@ func (c *ToxicCollection) findToxicByName(name string) *toxics.ToxicWrapper {
 	return nil
 }
 
+// halves returns the toxic, and its upstream half if it is a toxic of both
+// streams.
+func halves(toxic *toxics.ToxicWrapper) []*toxics.ToxicWrapper {
+	if toxic.Pair != nil {
+		return []*toxics.ToxicWrapper{toxic, toxic.Pair}
+	}
+	return []*toxics.ToxicWrapper{toxic}
+}
+
 func (c *ToxicCollection) chainAddToxic(toxic *toxics.ToxicWrapper) {
 	dir := toxic.Direction
 	toxic.Index = len(c.chain[dir])
@@ -243,6 +626,37 @@ func (c *ToxicCollection) chainAddToxic(toxic *toxics.ToxicWrapper) {
 	wg.Wait()
 }
 
+// chainReorderToxics puts the toxics of a direction in the given order, the
+// links moving their stubs in place so that the toxics keep their states and
+// their stats.
+func (c *ToxicCollection) chainReorderToxics(dir stream.Direction, order []*toxics.ToxicWrapper) {
+	from := make([]int, len(c.chain[dir]))
+	moved := false
+	for i, toxic := range order {
+		from[i+1] = toxic.Index
+		moved = moved || toxic.Index != i+1
+	}
+	if !moved {
+		return
+	}
+	for i, toxic := range order {
+		toxic.Index = i + 1
+		c.chain[dir][i+1] = toxic
+	}
+
+	wg := sync.WaitGroup{}
+	for _, link := range c.links {
+		if link.direction == dir {
+			wg.Add(1)
+			go func(link *ToxicLink) {
+				defer wg.Done()
+				link.ReorderToxics(from)
+			}(link)
+		}
+	}
+	wg.Wait()
+}
+
 func (c *ToxicCollection) chainUpdateToxic(toxic *toxics.ToxicWrapper) {
 	c.chain[toxic.Direction][toxic.Index] = toxic
 
@@ -295,5 +709,9 @@ func (c *ToxicCollection) chainRemoveToxic(ctx context.Context, toxic *toxics.To
 		Msg("Waiting to update links")
 	wg.Wait()
 
+	if metrics := c.proxyMetrics(); metrics != nil {
+		metrics.ToxicLatencyAdded.DeleteLabelValues(c.toxicMetricLabels(toxic)...)
+	}
+
 	toxic.Index = -1
 }
@@ -0,0 +1,299 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Types of the frames of AMQP 0-9-1.
+const (
+	amqpMethod    = 1
+	amqpHeader    = 2
+	amqpBody      = 3
+	amqpHeartbeat = 8
+)
+
+// The protocol header a client starts with.
+const amqpProtocolHeader = "AMQP\x00\x00\x09\x01"
+
+// A frame larger than this is likely not AMQP.
+const amqpMaxSize = 256 << 20
+
+// Class and method ids of the methods that can be named in the attributes of
+// the toxic, as class<<16 | method.
+var amqpMethods = map[string]uint32{
+	"connection.close":   10<<16 | 50,
+	"connection.blocked": 10<<16 | 60,
+	"channel.close":      20<<16 | 40,
+	"basic.qos":          60<<16 | 10,
+	"basic.consume":      60<<16 | 20,
+	"basic.cancel":       60<<16 | 30,
+	"basic.publish":      60<<16 | 40,
+	"basic.return":       60<<16 | 50,
+	"basic.deliver":      60<<16 | 60,
+	"basic.get-ok":       60<<16 | 71,
+	"basic.ack":          60<<16 | 80,
+	"basic.reject":       60<<16 | 90,
+	"basic.nack":         60<<16 | 120,
+	"confirm.select":     85<<16 | 10,
+	"tx.commit":          90<<16 | 20,
+}
+
+// AMQPFrames are the frames acted on by an AMQP toxic: heartbeat, or methods
+// by their name, e.g. basic.deliver, or their ids, e.g. 60.60.
+type AMQPFrames []string
+
+func (f *AMQPFrames) UnmarshalJSON(data []byte) error {
+	var frames []string
+	if json.Unmarshal(data, &frames) != nil {
+		var frame string
+		err := json.Unmarshal(data, &frame)
+		if err != nil {
+			return err
+		}
+		frames = []string{frame}
+	}
+	for _, frame := range frames {
+		if _, ok := amqpFrame(frame); !ok {
+			return &json.UnmarshalTypeError{Value: "string " + frame, Type: reflect.TypeOf(*f)}
+		}
+	}
+	*f = frames
+	return nil
+}
+
+// amqpFrame returns the method ids of a frame named, 0 for heartbeats.
+func amqpFrame(name string) (uint32, bool) {
+	if name == "heartbeat" {
+		return 0, true
+	}
+	if method, ok := amqpMethods[name]; ok {
+		return method, true
+	}
+	var class, method uint16
+	var rest string
+	n, _ := fmt.Sscanf(name, "%d.%d%s", &class, &method, &rest)
+	if n != 2 || !strings.Contains(name, ".") || class == 0 {
+		return 0, false
+	}
+	return uint32(class)<<16 | uint32(method), true
+}
+
+// The AMQPToxic follows the frames of AMQP 0-9-1, e.g. of RabbitMQ, to drop or
+// delay the heartbeats or the methods named, so that the recovery of clients
+// and the timeouts of publisher confirms can be tested. The content of a
+// method dropped, e.g. of basic.deliver, is dropped with it.
+type AMQPToxic struct {
+	// Frames acted on
+	Frames AMQPFrames `json:"frames"`
+	// Drop the frames
+	Drop bool `json:"drop"`
+	// Time in milliseconds the frames are delayed by
+	Delay int64 `json:"delay"`
+}
+
+type AMQPToxicState struct {
+	started   bool
+	lost      bool   // The data passes through once the stream can't be followed
+	head      []byte // Of the next frame, until it is read
+	remaining int    // Bytes of the current frame left
+	dropping  bool   // The current frame is dropped
+	// Channels of which the content is dropped, until their next method
+	content map[uint16]bool
+}
+
+// amqpHeadSize returns the size of the start of a frame needed, given what
+// was read of it: the frame header, and the ids of a method. The protocol
+// header of the client is read whole.
+func amqpHeadSize(head []byte) int {
+	switch {
+	case len(head) == 0:
+		return 1
+	case head[0] == amqpProtocolHeader[0]:
+		return len(amqpProtocolHeader)
+	case head[0] == amqpMethod:
+		return 11
+	}
+	return 7
+}
+
+// matches reports whether the toxic acts on the frame of the head.
+func (t *AMQPToxic) matches(head []byte) bool {
+	var frame uint32
+	switch head[0] {
+	case amqpHeartbeat:
+	case amqpMethod:
+		frame = binary.BigEndian.Uint32(head[7:])
+	default:
+		return false
+	}
+	for _, name := range t.Frames {
+		if id, _ := amqpFrame(name); id == frame {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *AMQPToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*AMQPToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its frames can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			a := amqpChunk{toxic: t, stub: stub, state: state, chunk: c}
+			a.run()
+			if a.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the frame held once the toxic is removed.
+func (t *AMQPToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*AMQPToxicState)
+	if len(state.head) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.head, Timestamp: time.Now()}
+		state.head = nil
+	}
+}
+
+func (t *AMQPToxic) NewState() interface{} {
+	return &AMQPToxicState{content: make(map[uint16]bool)}
+}
+
+// amqpChunk parses a chunk of data of an AMQP toxic.
+type amqpChunk struct {
+	toxic       *AMQPToxic
+	stub        *ToxicStub
+	state       *AMQPToxicState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied.
+func (a *amqpChunk) run() {
+	state := a.state
+	data := a.chunk.Data
+	defer a.flush()
+	for len(data) > 0 {
+		if state.lost {
+			a.out = append(a.out, data...)
+			return
+		}
+
+		if state.remaining > 0 {
+			n := min(state.remaining, len(data))
+			a.send(data[:n])
+			data = data[n:]
+			state.remaining -= n
+			continue
+		}
+
+		n := min(amqpHeadSize(state.head)-len(state.head), len(data))
+		state.head = append(state.head, data[:n]...)
+		data = data[n:]
+		if len(state.head) < amqpHeadSize(state.head) {
+			continue
+		}
+		if state.head[0] == amqpProtocolHeader[0] {
+			a.out = append(a.out, state.head...)
+			state.head = state.head[:0]
+			continue
+		}
+		a.begin()
+	}
+}
+
+// begin applies the toxic to the frame starting.
+func (a *amqpChunk) begin() {
+	state := a.state
+	head := state.head
+	length := binary.BigEndian.Uint32(head[3:])
+	if !slices.Contains([]byte{amqpMethod, amqpHeader, amqpBody, amqpHeartbeat}, head[0]) ||
+		length > amqpMaxSize || len(head) > int(length)+7 {
+		state.lost = true
+		a.out = append(a.out, head...)
+		state.head = head[:0]
+		return
+	}
+	// The payload left and the frame end.
+	state.remaining = int(length) + 8 - len(head)
+
+	channel := binary.BigEndian.Uint16(head[1:])
+	state.dropping = false
+	switch head[0] {
+	case amqpMethod:
+		delete(state.content, channel)
+	case amqpHeader, amqpBody:
+		state.dropping = state.content[channel]
+	}
+	if a.toxic.matches(head) {
+		a.stub.Stats.AddChunk(len(a.chunk.Data))
+		if a.toxic.Drop {
+			state.dropping = true
+			if head[0] == amqpMethod {
+				state.content[channel] = true
+			}
+		} else if a.toxic.Delay > 0 && !a.interrupted {
+			a.flush()
+			delay := time.Duration(a.toxic.Delay) * time.Millisecond
+			select {
+			case <-time.After(delay):
+				a.stub.Stats.AddDelay(delay)
+			case <-a.stub.Interrupt:
+				// The rest of the chunk is sent right away.
+				a.interrupted = true
+			}
+		}
+	}
+	a.send(head)
+	state.head = head[:0]
+}
+
+// send sends data of the current frame, unless it is dropped.
+func (a *amqpChunk) send(data []byte) {
+	if !a.state.dropping {
+		a.out = append(a.out, data...)
+	}
+}
+
+func (a *amqpChunk) flush() {
+	if len(a.out) > 0 {
+		a.stub.Output <- &stream.StreamChunk{Data: a.out, Timestamp: a.chunk.Timestamp}
+		a.out = nil
+	}
+}
+
+func (t *AMQPToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
+func init() {
+	Register("amqp", new(AMQPToxic))
+}
@@ -0,0 +1,74 @@
+package toxics_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// amqpFrame returns a frame of AMQP 0-9-1.
+func amqpFrame(kind byte, channel uint16, payload string) []byte {
+	frame := binary.BigEndian.AppendUint16([]byte{kind}, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	return append(append(frame, payload...), 0xce)
+}
+
+var (
+	amqpHeartbeat = amqpFrame(8, 0, "")
+	amqpDeliver   = amqpFrame(1, 1,
+		"\x00\x3c\x00\x3c\x04ctag\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x01q")
+	amqpContent = append(amqpFrame(2, 1, "\x00\x3c\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00"),
+		amqpFrame(3, 1, "hello")...)
+	amqpAck = amqpFrame(1, 1, "\x00\x3c\x00\x50\x00\x00\x00\x00\x00\x00\x00\x01\x00")
+)
+
+func runAMQP(t *testing.T, attrs string, late bool, chunks ...[]byte) []byte {
+	t.Helper()
+	toxic := new(toxics.AMQPToxic)
+	err := json.Unmarshal([]byte(attrs), toxic)
+	if err != nil {
+		t.Fatal("Failed to parse the attributes:", err)
+	}
+	result, _ := runWire(t, toxic, late, chunks...)
+	return result
+}
+
+func TestAMQPToxicDropsFrames(t *testing.T) {
+	header := []byte("AMQP\x00\x00\x09\x01")
+	result := runAMQP(t, `{"frames": "heartbeat", "drop": true}`, false,
+		header[:3], append(header[3:], amqpHeartbeat...), amqpAck)
+	checkWire(t, result, header, amqpAck)
+
+	// The content of the delivery is dropped with it, across the heartbeats.
+	result = runAMQP(t, `{"frames": ["basic.deliver"], "drop": true}`, false,
+		append(amqpDeliver, amqpContent[:22]...), amqpHeartbeat, amqpContent[22:30],
+		amqpContent[30:], amqpAck)
+	checkWire(t, result, amqpHeartbeat, amqpAck)
+}
+
+func TestAMQPToxicDelaysFrames(t *testing.T) {
+	start := time.Now()
+	result := runAMQP(t, `{"frames": ["60.80"], "delay": 50}`, false,
+		append(amqpDeliver, amqpContent...), amqpAck)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the ack to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, amqpDeliver, amqpContent, amqpAck)
+
+	err := json.Unmarshal([]byte(`{"frames": ["basic.nope"]}`), new(toxics.AMQPToxic))
+	if err == nil {
+		t.Error("Expected an unknown frame to be refused")
+	}
+}
+
+func TestAMQPToxicPassesUnknownStreamsThrough(t *testing.T) {
+	result := runAMQP(t, `{"frames": "heartbeat", "drop": true}`, true, amqpHeartbeat)
+	checkWire(t, result, amqpHeartbeat)
+
+	encrypted := []byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\x00")
+	result = runAMQP(t, `{"frames": "heartbeat", "drop": true}`, false, encrypted, amqpHeartbeat)
+	checkWire(t, result, encrypted, amqpHeartbeat)
+}
@@ -0,0 +1,67 @@
+package toxics
+
+import (
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// The AsymmetricToxic shapes each direction of a connection like a consumer
+// link, e.g. 10Mbps down and 1Mbps up, with the latency of each direction
+// added once the data is sent at its rate, so that a transfer saturating the
+// upstream delays the data behind it like on a real link. Added to the
+// stream both, it configures both directions at once instead of a latency
+// and a bandwidth toxic for each; on a stream alone, it shapes that one.
+type AsymmetricToxic struct {
+	// Rates in KB/s, not limited if 0
+	DownRate int64 `json:"down_rate"`
+	UpRate   int64 `json:"up_rate"`
+	// Times in milliseconds
+	DownLatency int64 `json:"down_latency"`
+	UpLatency   int64 `json:"up_latency"`
+	Jitter      int64 `json:"jitter"`
+}
+
+// Data in KB in flight on the connections of a direction without a rate.
+const unlimitedInFlight = 16 << 10
+
+func (t *AsymmetricToxic) GetBufferSize() int {
+	return 1024
+}
+
+func (t *AsymmetricToxic) Pipe(stub *ToxicStub) {
+	rate, latency := t.DownRate, t.DownLatency
+	if stub.Direction == stream.Upstream {
+		rate, latency = t.UpRate, t.UpLatency
+	}
+
+	// The data in flight is the data sent at the rate during the latency,
+	// with 100 milliseconds of data waiting to be sent.
+	inFlight := int64(unlimitedInFlight)
+	if rate > 0 {
+		inFlight = max(rate*(latency+max(t.Jitter, 0))/1000+rate/10, 64)
+	}
+	shaper := &BandwidthToxic{Rate: rate, Queue: inFlight}
+	delay := &LatencyToxic{Latency: latency, Jitter: t.Jitter}
+	if latency <= 0 && t.Jitter <= 0 {
+		shaper.Pipe(stub)
+		return
+	}
+	shaper.pipe(stub, func(stub *ToxicStub) time.Duration {
+		return max(delay.delay(stub), 0)
+	})
+}
+
+func (t *AsymmetricToxic) Validate() error {
+	return firstError(
+		nonNegative("down_rate", t.DownRate),
+		nonNegative("up_rate", t.UpRate),
+		nonNegative("down_latency", t.DownLatency),
+		nonNegative("up_latency", t.UpLatency),
+		nonNegative("jitter", t.Jitter),
+	)
+}
+
+func init() {
+	Register("asymmetric", new(AsymmetricToxic))
+}
@@ -0,0 +1,79 @@
+package toxics_test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/testhelper"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// startAsymmetric proxies a connection with an asymmetric toxic of both
+// streams, and returns its client and upstream ends.
+func startAsymmetric(t *testing.T, toxic *toxics.AsymmetricToxic) (net.Conn, net.Conn) {
+	upstream := testhelper.NewUpstream(t, false)
+	t.Cleanup(upstream.Close)
+
+	proxy := NewTestProxy("test", upstream.Addr())
+	proxy.Start()
+	t.Cleanup(proxy.Stop)
+
+	client, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatalf("Unable to dial TCP server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	upstreamConn := <-upstream.Connections
+
+	_, err = proxy.Toxics.AddToxicJson(ToxicToJson(t, "", "asymmetric", "both", toxic))
+	if err != nil {
+		t.Fatal("Failed to add the toxic:", err)
+	}
+	return client, upstreamConn
+}
+
+// transfer writes size bytes to from, and returns how long it takes to read
+// them from to.
+func transfer(t *testing.T, from, to net.Conn, size int) time.Duration {
+	payload := []byte(strings.Repeat("a", size))
+	start := time.Now()
+	go from.Write(payload)
+	_, err := io.ReadFull(to, make([]byte, size))
+	if err != nil {
+		t.Fatal("Failed to read the transfer:", err)
+	}
+	return time.Since(start)
+}
+
+func TestAsymmetricToxicShapesEachDirection(t *testing.T) {
+	client, upstream := startAsymmetric(t, &toxics.AsymmetricToxic{DownRate: 2000, UpRate: 200})
+
+	// 100KB at 200KB/s up, and at 2MB/s down.
+	AssertDeltaTime(t, "Upstream", transfer(t, client, upstream, 100000),
+		500*time.Millisecond, 100*time.Millisecond)
+	AssertDeltaTime(t, "Downstream", transfer(t, upstream, client, 100000),
+		50*time.Millisecond, 40*time.Millisecond)
+}
+
+func TestAsymmetricToxicDelaysEachDirection(t *testing.T) {
+	client, upstream := startAsymmetric(t, &toxics.AsymmetricToxic{
+		UpLatency:   100,
+		DownLatency: 20,
+	})
+
+	AssertDeltaTime(t, "Upstream", transfer(t, client, upstream, 1),
+		100*time.Millisecond, 20*time.Millisecond)
+	AssertDeltaTime(t, "Downstream", transfer(t, upstream, client, 1),
+		20*time.Millisecond, 20*time.Millisecond)
+}
+
+func TestAsymmetricToxicKeepsTheRateWithLatency(t *testing.T) {
+	client, upstream := startAsymmetric(t, &toxics.AsymmetricToxic{UpRate: 1000, UpLatency: 100})
+
+	// 500KB at 1MB/s arrive 100ms late, not 100ms late for each chunk.
+	AssertDeltaTime(t, "Upstream", transfer(t, client, upstream, 500000),
+		600*time.Millisecond, 100*time.Millisecond)
+}
@@ -2,81 +2,209 @@ package toxics
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/Shopify/toxiproxy/v2/stream"
 )
 
-// The BandwidthToxic passes data through at a limited rate.
+// The BandwidthToxic passes data through at a limited rate. It behaves like a
+// token bucket shaper: bursts pass at once after the link was idle, and the
+// data waiting to be sent is queued.
 type BandwidthToxic struct {
 	// Rate in KB/s
 	Rate int64 `json:"rate"`
+	// Shared applies the rate to all the connections of the proxy together,
+	// rather than to each of them.
+	Shared bool `json:"shared"`
+	// Burst in KB sent at once after the link was idle
+	Burst int64 `json:"burst"`
+	// Queue in KB waiting to be sent on each connection. When the queue is
+	// full, new data is dropped if Drop is set, or waits to be queued. If not
+	// set, a single chunk is queued at a time.
+	Queue int64 `json:"queue"`
+	Drop  bool  `json:"drop"`
+
+	sharedOnce sync.Once
+	shared     *tokenBucket
+}
+
+// Timers fire late by around a millisecond, so the time lost to a late timer
+// isn't counted as idle time that would raise the rate.
+const timerSlack = 10 * time.Millisecond
+
+// tokenBucket schedules the chunks of the links of a bandwidth toxic, holding
+// the time at which the chunks reserved so far are sent at the rate.
+type tokenBucket struct {
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// reserve returns when n bytes can be sent at rate KB/s after the ones
+// reserved before, with a burst in KB.
+func (b *tokenBucket) reserve(n int, rate, burst int64) time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	if b.next.Before(now.Add(-timerSlack)) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(n) * time.Millisecond / time.Duration(rate))
+
+	release := b.next.Add(-time.Duration(burst*1000) * time.Millisecond / time.Duration(rate))
+	if release.Before(now) {
+		return now
+	}
+	return release
+}
+
+func (t *BandwidthToxic) sharedBucket() *tokenBucket {
+	t.sharedOnce.Do(func() {
+		t.shared = new(tokenBucket)
+	})
+	return t.shared
+}
+
+type queuedChunk struct {
+	chunk   *stream.StreamChunk
+	release time.Time
 }
 
 func (t *BandwidthToxic) Pipe(stub *ToxicStub) {
+	t.pipe(stub, nil)
+}
+
+// pipe passes the data through at the rate, each chunk being delayed by
+// delay once sent at the rate if it is set, like on a link with latency.
+func (t *BandwidthToxic) pipe(stub *ToxicStub, delay func(*ToxicStub) time.Duration) {
 	logger := log.With().
 		Str("component", "BandwidthToxic").
 		Str("method", "Pipe").
 		Str("toxic_type", "bandwidth").
 		Str("addr", fmt.Sprintf("%p", t)).
 		Logger()
-	var sleep time.Duration = 0
+
+	bucket := new(tokenBucket)
+	if t.Shared {
+		bucket = t.sharedBucket()
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	var queue []queuedChunk
+	queued := 0 // Bytes in the queue
+	input := stub.Input
 	for {
+		if input == nil && len(queue) == 0 {
+			stub.Close()
+			return
+		}
+
+		in := input
+		if t.queueFull(queue, queued) {
+			in = nil
+		}
+		var due <-chan time.Time
+		if len(queue) > 0 {
+			timer.Reset(time.Until(queue[0].release))
+			due = timer.C
+		}
+
 		select {
 		case <-stub.Interrupt:
 			logger.Trace().Msg("BandwidthToxic was interrupted")
+			t.flush(stub, logger, queue)
 			return
-		case p := <-stub.Input:
+		case p := <-in:
 			if p == nil {
-				stub.Close()
-				return
+				input = nil
+				continue
 			}
-			if t.Rate <= 0 {
-				sleep = 0
-			} else {
-				sleep += time.Duration(len(p.Data)) * time.Millisecond / time.Duration(t.Rate)
+			if t.Rate > 0 || delay != nil {
+				stub.Stats.AddChunk(len(p.Data))
 			}
-			// If the rate is low enough, split the packet up and send in 100 millisecond intervals
-			for int64(len(p.Data)) > t.Rate*100 {
-				select {
-				case <-time.After(100 * time.Millisecond):
-					stub.Output <- &stream.StreamChunk{
-						Data:      p.Data[:t.Rate*100],
-						Timestamp: p.Timestamp,
-					}
-					p.Data = p.Data[t.Rate*100:]
-					sleep -= 100 * time.Millisecond
-				case <-stub.Interrupt:
-					logger.Trace().Msg("BandwidthToxic was interrupted during writing data")
-					err := stub.WriteOutput(p, 5*time.Second) // Don't drop any data on the floor
-					if err != nil {
-						logger.Warn().Err(err).
-							Msg("Could not write last packets after interrupt to Output")
-					}
-					return
-				}
+			if t.Drop && t.Queue > 0 && queued+len(p.Data) > int(t.Queue*1000) {
+				continue
 			}
-			start := time.Now()
-			select {
-			case <-time.After(sleep):
-				// time.After only seems to have ~1ms prevision, so offset the next sleep by the error
-				sleep -= time.Since(start)
-				stub.Output <- p
-			case <-stub.Interrupt:
-				logger.Trace().Msg("BandwidthToxic was interrupted during writing data")
-				err := stub.WriteOutput(p, 5*time.Second) // Don't drop any data on the floor
-				if err != nil {
-					logger.Warn().Err(err).
-						Msg("Could not write last packets after interrupt to Output")
-				}
-				return
+			var latency time.Duration
+			if delay != nil {
+				latency = delay(stub)
+				stub.Stats.AddDelay(max(latency, 0))
 			}
+			queue = t.enqueue(queue, bucket, p, latency)
+			queued += len(p.Data)
+		case <-due:
+			head := queue[0]
+			queue[0] = queuedChunk{}
+			queue = queue[1:]
+			queued -= len(head.chunk.Data)
+			stub.Output <- head.chunk
 		}
 	}
 }
 
+// queueFull reports whether new chunks must wait to be queued.
+func (t *BandwidthToxic) queueFull(queue []queuedChunk, queued int) bool {
+	if t.Queue <= 0 {
+		return len(queue) > 0
+	}
+	return !t.Drop && queued >= int(t.Queue*1000)
+}
+
+// enqueue schedules a chunk at the rate, in pieces of up to 100 milliseconds
+// if the rate is low enough, delayed by latency.
+func (t *BandwidthToxic) enqueue(
+	queue []queuedChunk,
+	bucket *tokenBucket,
+	p *stream.StreamChunk,
+	latency time.Duration,
+) []queuedChunk {
+	if t.Rate <= 0 {
+		return append(queue, queuedChunk{p, time.Now().Add(latency)})
+	}
+
+	for int64(len(p.Data)) > t.Rate*100 {
+		piece := &stream.StreamChunk{
+			Data:      p.Data[:t.Rate*100],
+			Timestamp: p.Timestamp,
+		}
+		release := bucket.reserve(len(piece.Data), t.Rate, t.Burst).Add(latency)
+		queue = append(queue, queuedChunk{piece, release})
+		p.Data = p.Data[t.Rate*100:]
+	}
+	release := bucket.reserve(len(p.Data), t.Rate, t.Burst).Add(latency)
+	return append(queue, queuedChunk{p, release})
+}
+
+// flush writes the queued chunks after an interrupt, not to drop any data on
+// the floor.
+func (t *BandwidthToxic) flush(stub *ToxicStub, logger zerolog.Logger, queue []queuedChunk) {
+	if len(queue) > 0 {
+		logger.Trace().Msg("BandwidthToxic was interrupted during writing data")
+	}
+	for _, queued := range queue {
+		err := stub.WriteOutput(queued.chunk, 5*time.Second)
+		if err != nil {
+			logger.Warn().Err(err).
+				Msg("Could not write last packets after interrupt to Output")
+			return
+		}
+	}
+}
+
+func (t *BandwidthToxic) Validate() error {
+	return firstError(
+		nonNegative("rate", t.Rate),
+		nonNegative("burst", t.Burst),
+		nonNegative("queue", t.Queue),
+	)
+}
+
 func init() {
 	Register("bandwidth", new(BandwidthToxic))
 }
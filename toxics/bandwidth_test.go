@@ -2,12 +2,14 @@ package toxics_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Shopify/toxiproxy/v2/stream"
 	"github.com/Shopify/toxiproxy/v2/testhelper"
 	"github.com/Shopify/toxiproxy/v2/toxics"
 )
@@ -93,3 +95,75 @@ func BenchmarkBandwidthToxic100MB(b *testing.B) {
 		b.Error("Failed to close TCP connection", err)
 	}
 }
+
+func TestSharedBandwidthToxic(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		toxic := &toxics.BandwidthToxic{Rate: 100, Shared: shared} // 100KB/s
+
+		// Two links of the toxic send 10KB each at once.
+		start := time.Now()
+		done := make(chan time.Duration)
+		for i := 0; i < 2; i++ {
+			input := make(chan *stream.StreamChunk)
+			output := make(chan *stream.StreamChunk)
+			stub := toxics.NewToxicStub(input, output)
+			go stub.Run(&toxics.ToxicWrapper{Toxic: toxic, Toxicity: 1})
+			go func() {
+				input <- &stream.StreamChunk{Data: make([]byte, 10000), Timestamp: time.Now()}
+				<-output
+				done <- time.Since(start)
+				close(input)
+			}()
+		}
+		last := max(<-done, <-done)
+
+		expected := 100 * time.Millisecond
+		if shared {
+			expected = 200 * time.Millisecond
+		}
+		AssertDeltaTime(t, fmt.Sprintf("Shared %v", shared), last, expected, 20*time.Millisecond)
+	}
+}
+
+func TestBandwidthToxicBurst(t *testing.T) {
+	toxic := &toxics.BandwidthToxic{Rate: 100, Burst: 10} // 100KB/s
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+	go stub.Run(&toxics.ToxicWrapper{Toxic: toxic, Toxicity: 1})
+	defer close(input)
+
+	// The first 10KB pass at once, the next ones at the rate.
+	start := time.Now()
+	input <- &stream.StreamChunk{Data: make([]byte, 10000), Timestamp: time.Now()}
+	<-output
+	AssertDeltaTime(t, "Burst", time.Since(start), 0, 10*time.Millisecond)
+
+	input <- &stream.StreamChunk{Data: make([]byte, 10000), Timestamp: time.Now()}
+	<-output
+	AssertDeltaTime(t, "Rate", time.Since(start), 100*time.Millisecond, 20*time.Millisecond)
+}
+
+func TestBandwidthToxicDropsWhenQueueFull(t *testing.T) {
+	toxic := &toxics.BandwidthToxic{Rate: 100, Queue: 10, Drop: true} // 100KB/s
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+	go stub.Run(&toxics.ToxicWrapper{Toxic: toxic, Toxicity: 1})
+
+	// The first chunk fills the queue, the next ones are dropped.
+	for i := 0; i < 3; i++ {
+		input <- &stream.StreamChunk{Data: make([]byte, 10000), Timestamp: time.Now()}
+	}
+	close(input)
+
+	received := 0
+	for p := range output {
+		received += len(p.Data)
+	}
+	if received != 10000 {
+		t.Fatalf("Expected 10000 bytes to pass, got %d", received)
+	}
+}
@@ -0,0 +1,74 @@
+package toxics
+
+import "time"
+
+// The BlackholeToxic drops all the data during random windows without closing
+// the connection, like a route flap or an expired NAT entry. The windows last
+// around duration and start around interval after the previous one ended,
+// from half to one and a half times each.
+type BlackholeToxic struct {
+	// Times in milliseconds
+	Duration int64 `json:"duration"`
+	Interval int64 `json:"interval"`
+}
+
+type BlackholeToxicState struct {
+	// The next or current window of the link.
+	start, end time.Time
+}
+
+// randomAround returns a random duration from half to one and a half times ms.
+func randomAround(stub *ToxicStub, ms int64) time.Duration {
+	mean := time.Duration(ms) * time.Millisecond
+	return mean/2 + time.Duration(stub.Rand().Int63n(int64(mean)+1))
+}
+
+// dropping reports whether the data sent at now falls in a window.
+func (t *BlackholeToxic) dropping(stub *ToxicStub, state *BlackholeToxicState, now time.Time) bool {
+	if t.Duration <= 0 || t.Interval <= 0 {
+		return false
+	}
+	if !now.Before(state.end) {
+		// The next window is drawn once the data flows again after the
+		// last one.
+		state.start = now.Add(randomAround(stub, t.Interval))
+		state.end = state.start.Add(randomAround(stub, t.Duration))
+	}
+	return !now.Before(state.start)
+}
+
+func (t *BlackholeToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*BlackholeToxicState)
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if t.dropping(stub, state, time.Now()) {
+				// Drop the data on the ground.
+				stub.Stats.AddChunk(len(c.Data))
+				continue
+			}
+			stub.Output <- c
+		}
+	}
+}
+
+func (t *BlackholeToxic) NewState() interface{} {
+	return new(BlackholeToxicState)
+}
+
+func (t *BlackholeToxic) Validate() error {
+	return firstError(
+		nonNegative("duration", t.Duration),
+		nonNegative("interval", t.Interval),
+	)
+}
+
+func init() {
+	Register("blackhole", new(BlackholeToxic))
+}
@@ -0,0 +1,44 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestBlackholeToxicDropsDuringWindows(t *testing.T) {
+	toxic := &toxics.BlackholeToxic{Duration: 40, Interval: 40}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1000)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	stub.SetSeed(42)
+
+	go toxic.Pipe(stub)
+
+	// The first chunk draws the first window, at least 20ms later.
+	sent := 0
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		input <- &stream.StreamChunk{Data: []byte("x")}
+		sent++
+		time.Sleep(time.Millisecond)
+	}
+	close(input)
+
+	passed := 0
+	for range output {
+		passed++
+	}
+	dropped := int(stub.Stats.Counters().Chunks)
+	if passed+dropped != sent {
+		t.Fatalf("Expected %d chunks passed or dropped, got %d and %d", sent, passed, dropped)
+	}
+	if passed < sent/5 || dropped < sent/5 {
+		t.Errorf("Expected around half of %d chunks dropped, got %d dropped", sent, dropped)
+	}
+}
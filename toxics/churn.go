@@ -0,0 +1,100 @@
+package toxics
+
+import (
+	"sync"
+	"time"
+)
+
+// The ChurnToxic closes each connection after a lifetime drawn for it, like a
+// flapping backend, to exercise the reconnects of the clients. With a holdoff,
+// the connections opened for a while after each close are reset as soon as
+// they open, to exercise their backoffs too.
+type ChurnToxic struct {
+	// Times in milliseconds, the lifetime is drawn from min to max for each
+	// connection
+	MinLifetime int64 `json:"min_lifetime"`
+	MaxLifetime int64 `json:"max_lifetime"`
+	// Time in milliseconds after each close during which the new connections
+	// are rejected, none if 0
+	Holdoff int64 `json:"holdoff"`
+	// How the connection is closed at the end of its lifetime, with a FIN by
+	// default.
+	Close CloseMode `json:"close"`
+
+	// The holdoff is shared by the connections of the toxic.
+	mutex        sync.Mutex
+	holdoffUntil time.Time
+}
+
+type ChurnToxicState struct {
+	started  bool
+	deadline time.Time
+}
+
+// rejecting reports whether a connection opened at now is in the holdoff of a
+// close.
+func (t *ChurnToxic) rejecting(now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return now.Before(t.holdoffUntil)
+}
+
+func (t *ChurnToxic) startHoldoff(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.holdoffUntil = now.Add(time.Duration(t.Holdoff) * time.Millisecond)
+}
+
+func (t *ChurnToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*ChurnToxicState)
+	if !state.started {
+		state.started = true
+		now := time.Now()
+		// The connections already open when the toxic is added are not
+		// rejected.
+		if !stub.Late && t.rejecting(now) {
+			stub.Stats.AddClose()
+			stub.Reset()
+			return
+		}
+		lifetime := drawBetween(stub, max(t.MinLifetime, 0), t.MaxLifetime)
+		state.deadline = now.Add(time.Duration(lifetime) * time.Millisecond)
+	}
+
+	timer := time.NewTimer(time.Until(state.deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case <-timer.C:
+			t.startHoldoff(time.Now())
+			stub.Stats.AddClose()
+			stub.CloseWith(t.Close)
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			stub.Output <- c
+		}
+	}
+}
+
+func (t *ChurnToxic) NewState() interface{} {
+	return new(ChurnToxicState)
+}
+
+func (t *ChurnToxic) Validate() error {
+	return firstError(
+		nonNegative("min_lifetime", t.MinLifetime),
+		nonNegative("max_lifetime", t.MaxLifetime),
+		nonNegative("holdoff", t.Holdoff),
+		notAbove("min_lifetime", t.MinLifetime, t.MaxLifetime, "max_lifetime"),
+	)
+}
+
+func init() {
+	Register("churn", new(ChurnToxic))
+}
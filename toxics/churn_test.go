@@ -0,0 +1,89 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// startChurn runs a churn toxic on a new stub, and returns the stub and a
+// channel closed once the toxic returns.
+func startChurn(
+	toxic *toxics.ChurnToxic,
+	late bool,
+	onReset func(),
+) (*toxics.ToxicStub, chan struct{}) {
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	stub.Late = late
+	stub.OnReset = onReset
+
+	done := make(chan struct{})
+	go func() {
+		toxic.Pipe(stub)
+		close(done)
+	}()
+	return stub, done
+}
+
+func TestChurnToxicClosesAfterTheLifetime(t *testing.T) {
+	toxic := &toxics.ChurnToxic{MinLifetime: 50, MaxLifetime: 100}
+
+	start := time.Now()
+	stub, done := startChurn(toxic, false, nil)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be closed at the end of its lifetime")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the connection to live 50ms at least, got %s", elapsed)
+	}
+	if !stub.Closed() {
+		t.Error("Expected the stub to be closed")
+	}
+	if counters := stub.Stats.Counters(); counters.Closes != 1 {
+		t.Errorf("Expected the close to be counted, got %+v", counters)
+	}
+}
+
+func TestChurnToxicRejectsDuringTheHoldoff(t *testing.T) {
+	toxic := &toxics.ChurnToxic{MinLifetime: 10, MaxLifetime: 10, Holdoff: 200}
+
+	_, done := startChurn(toxic, false, nil)
+	<-done
+
+	reset := false
+	stub, done := startChurn(toxic, false, func() { reset = true })
+	<-done
+	if !stub.Closed() || !reset {
+		t.Fatal("Expected the reconnect to be reset during the holdoff")
+	}
+
+	// A connection open when the toxic was added is not rejected.
+	stub, done = startChurn(toxic, true, nil)
+	select {
+	case <-done:
+		t.Fatal("Expected the connection open before the toxic not to be rejected")
+	case <-time.After(5 * time.Millisecond):
+	}
+	stub.Interrupt <- struct{}{}
+	<-done
+
+	time.Sleep(200 * time.Millisecond)
+	stub, done = startChurn(toxic, false, nil)
+	select {
+	case <-done:
+		t.Fatal("Expected the reconnect to be accepted after the holdoff")
+	case <-time.After(5 * time.Millisecond):
+	}
+	<-done
+	if stub.Stats.Counters().Closes != 1 {
+		t.Errorf("Expected the connection to close at the end of its lifetime")
+	}
+}
@@ -0,0 +1,346 @@
+package toxics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// DNSRcode is the response code a DNS toxic answers with.
+type DNSRcode string
+
+const (
+	DNSServfail DNSRcode = "servfail" // The server failed
+	DNSNXDomain DNSRcode = "nxdomain" // The name does not exist
+	DNSRefused  DNSRcode = "refused"  // The server refuses to answer
+)
+
+var dnsRcodes = map[DNSRcode]uint16{DNSServfail: 2, DNSNXDomain: 3, DNSRefused: 5}
+
+func (r *DNSRcode) UnmarshalJSON(data []byte) error {
+	var rcode string
+	err := json.Unmarshal(data, &rcode)
+	if err != nil {
+		return err
+	}
+	if _, ok := dnsRcodes[DNSRcode(rcode)]; !ok && rcode != "" {
+		return &json.UnmarshalTypeError{Value: "string " + rcode, Type: reflect.TypeOf(*r)}
+	}
+	*r = DNSRcode(rcode)
+	return nil
+}
+
+// DNSAddress is an IP address, written in JSON as a string.
+type DNSAddress struct {
+	net.IP
+}
+
+func (a *DNSAddress) UnmarshalJSON(data []byte) error {
+	var address string
+	err := json.Unmarshal(data, &address)
+	if err != nil {
+		return err
+	}
+	a.IP = nil
+	if address == "" {
+		return nil
+	}
+	a.IP = net.ParseIP(address)
+	if a.IP == nil {
+		return &json.UnmarshalTypeError{Value: "string " + address, Type: reflect.TypeOf(*a)}
+	}
+	return nil
+}
+
+func (a DNSAddress) MarshalJSON() ([]byte, error) {
+	if a.IP == nil {
+		return json.Marshal("")
+	}
+	return json.Marshal(a.String())
+}
+
+// Sizes and flags of the DNS messages.
+const (
+	dnsHeaderSize = 12
+	dnsResponse   = 0x8000 // QR bit of the flags
+	dnsTruncated  = 0x0200 // TC bit of the flags
+	dnsTypeA      = 1
+	dnsTypeAAAA   = 28
+)
+
+// The DNSToxic follows the DNS responses of a UDP proxy, or of DNS over TCP,
+// to delay them, to answer with an error, to truncate them so that clients
+// retry over TCP, to serve stale answers or to rewrite the addresses answered.
+// It acts on the responses, so it belongs on the downstream.
+type DNSToxic struct {
+	// Time in milliseconds the responses are delayed by
+	Delay int64 `json:"delay"`
+	// Answer with this response code instead, e.g. "servfail", if set
+	Rcode DNSRcode `json:"rcode"`
+	// Set the truncated flag and drop the records, keeping the question
+	Truncate bool `json:"truncate"`
+	// Answer each question with the first answer sent for it
+	Stale bool `json:"stale"`
+	// Address of A or AAAA records replacing the ones answered, if set
+	Address DNSAddress `json:"address"`
+	// Fraction of the responses that are affected, all of them if 0
+	Probability float32 `json:"probability"`
+
+	staleOnce sync.Once
+	stale     *dnsCache
+}
+
+type DNSToxicState struct {
+	started bool
+	lost    bool   // The data passes through once the messages can't be found
+	message []byte // Start of the next message, with its length
+}
+
+// dnsCache holds the first answer to each question, for all the connections
+// of a DNS toxic.
+type dnsCache struct {
+	mutex   sync.Mutex
+	answers map[string][]byte
+}
+
+// answer returns the first answer to the question of a response, storing the
+// response if it is the first one.
+func (c *dnsCache) answer(question string, response []byte) []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	answer, ok := c.answers[question]
+	if !ok {
+		answer = bytes.Clone(response)
+		c.answers[question] = answer
+	}
+	return answer
+}
+
+func (t *DNSToxic) staleCache() *dnsCache {
+	t.staleOnce.Do(func() {
+		t.stale = &dnsCache{answers: make(map[string][]byte)}
+	})
+	return t.stale
+}
+
+// dnsName returns the end of the name starting at off, or -1 if it is invalid.
+func dnsName(message []byte, off int) int {
+	for off < len(message) {
+		size := int(message[off])
+		switch {
+		case size == 0:
+			return off + 1
+		case size&0xc0 == 0xc0:
+			// A pointer to the rest of the name.
+			if off+2 > len(message) {
+				return -1
+			}
+			return off + 2
+		case size > 63:
+			return -1
+		}
+		off += 1 + size
+	}
+	return -1
+}
+
+// dnsQuestions returns the end of the questions of a message, or -1 if they
+// are invalid.
+func dnsQuestions(message []byte) int {
+	off := dnsHeaderSize
+	for i := 0; i < int(binary.BigEndian.Uint16(message[4:])); i++ {
+		off = dnsName(message, off)
+		if off < 0 || off+4 > len(message) {
+			return -1
+		}
+		off += 4
+	}
+	return off
+}
+
+func (t *DNSToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*DNSToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its messages can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				t.Cleanup(stub)
+				stub.Close()
+				return
+			}
+			if t.run(stub, state, c) {
+				return
+			}
+		}
+	}
+}
+
+// run sends the messages of the chunk, and reports whether the toxic was
+// interrupted.
+func (t *DNSToxic) run(stub *ToxicStub, state *DNSToxicState, c *stream.StreamChunk) bool {
+	data := c.Data
+	interrupted := false
+	var out []byte
+	flush := func() {
+		if len(out) > 0 {
+			stub.Output <- &stream.StreamChunk{Data: out, Timestamp: c.Timestamp}
+			out = nil
+		}
+	}
+	defer flush()
+
+	for len(data) > 0 {
+		if state.lost {
+			out = append(out, data...)
+			return interrupted
+		}
+
+		if len(state.message) < 2 {
+			n := min(2-len(state.message), len(data))
+			state.message = append(state.message, data[:n]...)
+			data = data[n:]
+			if len(state.message) < 2 {
+				continue
+			}
+		}
+		size := 2 + int(binary.BigEndian.Uint16(state.message))
+		n := min(size-len(state.message), len(data))
+		state.message = append(state.message, data[:n]...)
+		data = data[n:]
+		if len(state.message) < size {
+			continue
+		}
+
+		message := state.message[2:]
+		state.message = nil
+		message = t.apply(stub, message, flush, &interrupted)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(message)))
+		out = append(out, message...)
+	}
+	return interrupted
+}
+
+// apply applies the toxic to a whole message and returns it. The message is
+// not delayed once the toxic was interrupted.
+func (t *DNSToxic) apply(stub *ToxicStub, message []byte, flush func(), interrupted *bool) []byte {
+	if len(message) < dnsHeaderSize || binary.BigEndian.Uint16(message[2:])&dnsResponse == 0 {
+		return message
+	}
+	questions := dnsQuestions(message)
+	var answer []byte
+	if t.Stale && questions > 0 {
+		question := bytes.ToLower(message[dnsHeaderSize:questions])
+		answer = t.staleCache().answer(string(question), message)
+	}
+	if t.Probability > 0 && stub.Rand().Float32() >= t.Probability {
+		return message
+	}
+
+	stub.Stats.AddChunk(len(message))
+	switch {
+	case t.Rcode != "":
+		message = dnsEmpty(message, questions)
+		flags := binary.BigEndian.Uint16(message[2:])&^0x000f | dnsRcodes[t.Rcode]
+		binary.BigEndian.PutUint16(message[2:], flags)
+	case t.Truncate:
+		message = dnsEmpty(message, questions)
+		binary.BigEndian.PutUint16(message[2:], binary.BigEndian.Uint16(message[2:])|dnsTruncated)
+	case answer != nil:
+		id := message[:2]
+		message = append(bytes.Clone(id), answer[2:]...)
+	case t.Address.IP != nil:
+		t.rewriteAddresses(message, questions)
+	}
+
+	if t.Delay > 0 && !*interrupted {
+		flush()
+		delay := time.Duration(t.Delay) * time.Millisecond
+		select {
+		case <-time.After(delay):
+			stub.Stats.AddDelay(delay)
+		case <-stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			*interrupted = true
+		}
+	}
+	return message
+}
+
+// dnsEmpty returns the header and the questions of a message, without its
+// records.
+func dnsEmpty(message []byte, questions int) []byte {
+	empty := bytes.Clone(message[:dnsHeaderSize])
+	if questions < 0 {
+		binary.BigEndian.PutUint16(empty[4:], 0)
+	} else {
+		empty = append(empty, message[dnsHeaderSize:questions]...)
+	}
+	clear(empty[6:dnsHeaderSize])
+	return empty
+}
+
+// rewriteAddresses replaces the addresses of the A or AAAA records answered,
+// of the family of the address of the toxic.
+func (t *DNSToxic) rewriteAddresses(message []byte, off int) {
+	if off < 0 {
+		return
+	}
+	kind, address := uint16(dnsTypeAAAA), t.Address.To16()
+	if ip := t.Address.To4(); ip != nil {
+		kind, address = dnsTypeA, ip
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(message[6:])); i++ {
+		off = dnsName(message, off)
+		if off < 0 || off+10 > len(message) {
+			return
+		}
+		size := int(binary.BigEndian.Uint16(message[off+8:]))
+		rdata := off + 10
+		if rdata+size > len(message) {
+			return
+		}
+		if binary.BigEndian.Uint16(message[off:]) == kind && size == len(address) {
+			copy(message[rdata:], address)
+		}
+		off = rdata + size
+	}
+}
+
+// Cleanup sends the start of the message held once the toxic is removed.
+func (t *DNSToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*DNSToxicState)
+	if len(state.message) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.message, Timestamp: time.Now()}
+		state.message = nil
+	}
+}
+
+func (t *DNSToxic) NewState() interface{} {
+	return new(DNSToxicState)
+}
+
+func (t *DNSToxic) Validate() error {
+	return firstError(
+		nonNegative("delay", t.Delay),
+		inRange("probability", t.Probability, 0, 1),
+	)
+}
+
+func init() {
+	Register("dns", new(DNSToxic))
+}
@@ -0,0 +1,107 @@
+package toxics_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// dnsQuestion is the question of example.com for its A records.
+const dnsQuestion = "\x07example\x03com\x00\x00\x01\x00\x01"
+
+// dnsMessage returns a DNS message with its length, with the question and
+// answers with a pointer to the name of the question.
+func dnsMessage(id uint16, flags uint16, answers ...string) []byte {
+	message := binary.BigEndian.AppendUint16(nil, id)
+	message = binary.BigEndian.AppendUint16(message, flags)
+	message = binary.BigEndian.AppendUint16(message, 1)
+	message = binary.BigEndian.AppendUint16(message, uint16(len(answers)))
+	message = append(message, 0, 0, 0, 0)
+	message = append(message, dnsQuestion...)
+	for _, address := range answers {
+		message = append(message, "\xc0\x0c\x00\x01\x00\x01\x00\x00\x00\x3c\x00\x04"...)
+		message = append(message, address...)
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(message))), message...)
+}
+
+var (
+	dnsQuery  = dnsMessage(1, 0x0100)
+	dnsAnswer = dnsMessage(1, 0x8180, "\x5d\xb8\xd7\x0e")
+)
+
+func TestDNSToxicAnswersWithAnError(t *testing.T) {
+	toxic := &toxics.DNSToxic{Rcode: toxics.DNSServfail}
+	// The response is split in the middle of its length, and of the message.
+	result, _ := runWire(t, toxic, false, dnsQuery, dnsAnswer[:1], dnsAnswer[1:20], dnsAnswer[20:])
+	checkWire(t, result, dnsQuery, dnsMessage(1, 0x8182))
+}
+
+func TestDNSToxicTruncatesResponses(t *testing.T) {
+	toxic := &toxics.DNSToxic{Truncate: true}
+	result, _ := runWire(t, toxic, false, dnsAnswer)
+	checkWire(t, result, dnsMessage(1, 0x8380))
+}
+
+func TestDNSToxicServesStaleAnswers(t *testing.T) {
+	toxic := &toxics.DNSToxic{Stale: true}
+	fresh := dnsMessage(2, 0x8180, "\x5d\xb8\xd7\x0f")
+	result, _ := runWire(t, toxic, false, dnsAnswer)
+	checkWire(t, result, dnsAnswer)
+	// The answer is shared by the connections of the toxic.
+	result, _ = runWire(t, toxic, false, fresh)
+	checkWire(t, result, dnsMessage(2, 0x8180, "\x5d\xb8\xd7\x0e"))
+}
+
+func TestDNSToxicRewritesAddresses(t *testing.T) {
+	toxic := new(toxics.DNSToxic)
+	err := json.Unmarshal([]byte(`{"address": "127.0.0.1"}`), toxic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := runWire(t, toxic, false, dnsAnswer)
+	checkWire(t, result, dnsMessage(1, 0x8180, "\x7f\x00\x00\x01"))
+
+	// The A records are left as they are by an IPv6 address.
+	err = json.Unmarshal([]byte(`{"address": "::1"}`), toxic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ = runWire(t, toxic, false, dnsAnswer)
+	checkWire(t, result, dnsAnswer)
+
+	err = json.Unmarshal([]byte(`{"address": "localhost"}`), toxic)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("Expected an invalid address to be rejected, got %v", err)
+	}
+	err = json.Unmarshal([]byte(`{"rcode": "timeout"}`), toxic)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("Expected an invalid rcode to be rejected, got %v", err)
+	}
+}
+
+func TestDNSToxicDelaysResponses(t *testing.T) {
+	toxic := &toxics.DNSToxic{Delay: 50}
+	start := time.Now()
+	result, _ := runWire(t, toxic, false, dnsQuery)
+	if time.Since(start) > 40*time.Millisecond {
+		t.Error("Expected the query not to be delayed")
+	}
+	checkWire(t, result, dnsQuery)
+
+	start = time.Now()
+	result, _ = runWire(t, toxic, false, append(dnsAnswer, dnsAnswer...))
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected both responses to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, dnsAnswer, dnsAnswer)
+}
+
+func TestDNSToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.DNSToxic{Rcode: toxics.DNSRefused}
+	result, _ := runWire(t, toxic, true, dnsAnswer)
+	checkWire(t, result, dnsAnswer)
+}
@@ -0,0 +1,237 @@
+package toxics
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Modes of the gzip toxic.
+const (
+	GzipCompress   = "compress"   // Compress the stream, the default
+	GzipDecompress = "decompress" // Decompress a gzip stream
+	GzipRecompress = "recompress" // Decompress a gzip stream and compress it again
+)
+
+// GzipMode is what a gzip toxic does to the stream, written in JSON as the
+// name of the mode, e.g. "decompress".
+type GzipMode string
+
+func (m *GzipMode) UnmarshalJSON(data []byte) error {
+	var mode string
+	err := json.Unmarshal(data, &mode)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case "", GzipCompress, GzipDecompress, GzipRecompress:
+	default:
+		return &json.UnmarshalTypeError{Value: "string " + mode, Type: reflect.TypeOf(*m)}
+	}
+	*m = GzipMode(mode)
+	return nil
+}
+
+// The GzipToxic compresses the stream with gzip, decompresses a gzip stream,
+// or recompresses one at another level, to test the handling of the
+// content lengths and encodings by clients and the proxies between them, or
+// the bandwidth of clients against compressed upstreams. The whole stream is
+// one gzip stream, flushed after each chunk so that the data is not held,
+// and a stream that doesn't start as gzip is passed through when
+// decompressed. The connection is reset if a gzip stream is corrupt.
+type GzipToxic struct {
+	Mode GzipMode `json:"mode"`
+	// Level of gzip from 1, the fastest, to 9, the smallest. If 0, the
+	// default level of gzip when compressing, and 1 when recompressing.
+	Level int `json:"level"`
+}
+
+// GzipToxicState runs the compression of a connection, which reads and
+// writes the stream as a whole, in a goroutine fed with the data of the
+// chunks, so that the toxic can be interrupted without losing it.
+type GzipToxicState struct {
+	started bool
+	in      chan []byte
+	out     chan []byte
+	done    chan struct{} // Closed to stop the goroutine
+	ended   bool          // The input ended, and in is closed
+	pending []byte        // Data read but not yet passed to the goroutine
+	err     error         // Why the goroutine stopped, read once out is closed
+}
+
+func (t *GzipToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*GzipToxicState)
+	if !state.started {
+		state.started = true
+		go func() {
+			state.err = t.transform(&gzipReader{state: state}, &gzipWriter{state: state})
+			close(state.out)
+		}()
+	}
+
+	for {
+		input := stub.Input
+		var in chan<- []byte
+		if state.pending != nil {
+			input = nil
+			in = state.in
+		} else if state.ended {
+			input = nil
+		}
+
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-input:
+			if c == nil {
+				state.ended = true
+				close(state.in)
+				continue
+			}
+			state.pending = c.Data
+		case in <- state.pending:
+			state.pending = nil
+		case data, ok := <-state.out:
+			if !ok {
+				if state.err != nil {
+					stub.Stats.AddClose()
+					stub.Reset()
+				} else {
+					stub.Close()
+				}
+				return
+			}
+			stub.Stats.AddChunk(len(data))
+			stub.Output <- &stream.StreamChunk{Data: data, Timestamp: time.Now()}
+		}
+	}
+}
+
+// transform reads the whole stream from r and writes what the toxic makes of
+// it to w, flushing it after each read.
+func (t *GzipToxic) transform(r io.Reader, w io.Writer) error {
+	if t.Mode == GzipCompress || t.Mode == "" {
+		return compressGzip(r, w, t.Level, gzip.DefaultCompression)
+	}
+
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		// Not gzip, the data is passed through.
+		_, err = buffered.WriteTo(w)
+		return err
+	}
+	decompressed, err := gzip.NewReader(buffered)
+	if err != nil {
+		return err
+	}
+	if t.Mode == GzipRecompress {
+		return compressGzip(decompressed, w, t.Level, gzip.BestSpeed)
+	}
+	_, err = io.Copy(w, decompressed)
+	return err
+}
+
+// compressGzip compresses r to w at a level, or at a default level if the
+// level is not one of gzip, flushing the compressed data after each read.
+func compressGzip(r io.Reader, w io.Writer, level, defaultLevel int) error {
+	if level == 0 || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = defaultLevel
+	}
+	// The level is valid.
+	compressor, _ := gzip.NewWriterLevel(w, level)
+	buffer := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			_, writeErr := compressor.Write(buffer[:n])
+			if writeErr == nil {
+				writeErr = compressor.Flush()
+			}
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return compressor.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Cleanup stops the goroutine of the connection once the toxic is removed,
+// the data it holds being lost.
+func (t *GzipToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*GzipToxicState)
+	if state.started {
+		close(state.done)
+	}
+}
+
+func (t *GzipToxic) NewState() interface{} {
+	return &GzipToxicState{
+		in:   make(chan []byte),
+		out:  make(chan []byte),
+		done: make(chan struct{}),
+	}
+}
+
+// errGzipStopped stops the goroutine of a connection once the toxic is
+// removed.
+var errGzipStopped = errors.New("gzip toxic removed")
+
+// gzipReader reads the data of the chunks passed to the goroutine.
+type gzipReader struct {
+	state *GzipToxicState
+	data  []byte
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		select {
+		case data, ok := <-r.state.in:
+			if !ok {
+				return 0, io.EOF
+			}
+			r.data = data
+		case <-r.state.done:
+			return 0, errGzipStopped
+		}
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// gzipWriter sends the data written by the goroutine to the toxic.
+type gzipWriter struct {
+	state *GzipToxicState
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	select {
+	case w.state.out <- append([]byte(nil), p...):
+		return len(p), nil
+	case <-w.state.done:
+		return 0, errGzipStopped
+	}
+}
+
+func (t *GzipToxic) Validate() error {
+	return inRange("level", t.Level, gzip.HuffmanOnly, gzip.BestCompression)
+}
+
+func init() {
+	Register("gzip", new(GzipToxic))
+}
@@ -0,0 +1,178 @@
+package toxics_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// runGzip runs a gzip toxic over chunks, and returns the data it sent and
+// whether it reset the connection.
+func runGzip(t *testing.T, toxic *toxics.GzipToxic, chunks ...[]byte) ([]byte, bool) {
+	input := make(chan *stream.StreamChunk, len(chunks)+1)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	reset := false
+	stub.OnReset = func() { reset = true }
+
+	for _, chunk := range chunks {
+		input <- &stream.StreamChunk{Data: chunk}
+	}
+	input <- nil
+	done := make(chan struct{})
+	go func() {
+		toxic.Pipe(stub)
+		close(done)
+	}()
+
+	var sent []byte
+	for c := range output {
+		sent = append(sent, c.Data...)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the toxic to end with the stream")
+	}
+	return sent, reset
+}
+
+func gzipped(t *testing.T, data string, level int) []byte {
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte(data))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func gunzipped(t *testing.T, data []byte) string {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Expected a gzip stream:", err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected a whole gzip stream:", err)
+	}
+	return string(plain)
+}
+
+func TestGzipToxicCompressesTheStream(t *testing.T) {
+	text := strings.Repeat("hello world ", 1000)
+	sent, reset := runGzip(t, new(toxics.GzipToxic), []byte(text[:5000]), []byte(text[5000:]))
+	if reset {
+		t.Fatal("Expected the connection not to be reset")
+	}
+	if got := gunzipped(t, sent); got != text {
+		t.Fatalf("Expected the stream to be compressed, got %q", got)
+	}
+	if len(sent) >= len(text) {
+		t.Errorf("Expected the stream to be smaller, got %d bytes of %d", len(sent), len(text))
+	}
+}
+
+func TestGzipToxicFlushesEachChunk(t *testing.T) {
+	toxic := new(toxics.GzipToxic)
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	go toxic.Pipe(stub)
+	defer close(stub.Interrupt)
+
+	reader, writer := io.Pipe()
+	go func() {
+		for c := range output {
+			writer.Write(c.Data)
+		}
+	}()
+	input <- &stream.StreamChunk{Data: []byte("hello")}
+
+	read := make(chan string)
+	go func() {
+		decompressed, err := gzip.NewReader(reader)
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 5)
+		io.ReadFull(decompressed, buf)
+		read <- string(buf)
+	}()
+	select {
+	case got := <-read:
+		if got != "hello" {
+			t.Fatalf("Expected hello, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the chunk to be flushed before the stream ends")
+	}
+}
+
+func TestGzipToxicDecompressesTheStream(t *testing.T) {
+	compressed := gzipped(t, "hello world", gzip.BestCompression)
+	sent, reset := runGzip(t, &toxics.GzipToxic{Mode: toxics.GzipDecompress},
+		compressed[:3], compressed[3:10], compressed[10:])
+	if reset {
+		t.Fatal("Expected the connection not to be reset")
+	}
+	if string(sent) != "hello world" {
+		t.Fatalf("Expected the stream to be decompressed, got %q", sent)
+	}
+}
+
+func TestGzipToxicPassesThroughDataThatIsNotGzip(t *testing.T) {
+	sent, reset := runGzip(t, &toxics.GzipToxic{Mode: toxics.GzipDecompress},
+		[]byte("hello"), []byte(" world"))
+	if reset || string(sent) != "hello world" {
+		t.Fatalf("Expected the data to be passed through, got %q (reset %v)", sent, reset)
+	}
+}
+
+func TestGzipToxicResetsACorruptStream(t *testing.T) {
+	compressed := gzipped(t, strings.Repeat("hello world ", 100), gzip.BestCompression)
+	compressed[len(compressed)/2] ^= 0xff
+	_, reset := runGzip(t, &toxics.GzipToxic{Mode: toxics.GzipDecompress}, compressed)
+	if !reset {
+		t.Fatal("Expected the connection to be reset")
+	}
+}
+
+func TestGzipToxicRecompressesTheStream(t *testing.T) {
+	text := strings.Repeat("hello world ", 1000)
+	compressed := gzipped(t, text, gzip.BestCompression)
+	sent, reset := runGzip(t, &toxics.GzipToxic{Mode: toxics.GzipRecompress}, compressed)
+	if reset {
+		t.Fatal("Expected the connection not to be reset")
+	}
+	if got := gunzipped(t, sent); got != text {
+		t.Fatalf("Expected the stream to be recompressed, got %q", got)
+	}
+	if bytes.Equal(sent, compressed) {
+		t.Error("Expected the stream to be compressed again")
+	}
+}
+
+func TestGzipToxicRejectsAnUnknownMode(t *testing.T) {
+	toxic := new(toxics.GzipToxic)
+	err := json.Unmarshal([]byte(`{"mode": "zip"}`), toxic)
+	if err == nil {
+		t.Fatal("Expected an unknown mode to be rejected")
+	}
+	err = json.Unmarshal([]byte(`{"mode": "recompress", "level": 9}`), toxic)
+	if err != nil || toxic.Mode != toxics.GzipRecompress || toxic.Level != 9 {
+		t.Fatalf("Expected the mode and the level to be set, got %+v: %v", toxic, err)
+	}
+}
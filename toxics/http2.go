@@ -0,0 +1,349 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// The connection preface a client of HTTP/2 starts with.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// Types and flags of the frames of HTTP/2.
+const (
+	http2Data         = 0
+	http2Headers      = 1
+	http2RstStream    = 3
+	http2Settings     = 4
+	http2Goaway       = 7
+	http2WindowUpdate = 8
+	http2Continuation = 9
+
+	http2EndStream  = 0x1
+	http2Ack        = 0x1
+	http2EndHeaders = 0x4
+
+	http2HeaderSize = 9
+)
+
+// Error codes of HTTP/2, by their name.
+var http2ErrorCodes = map[HTTP2ErrorCode]uint32{
+	"no_error":            0,
+	"protocol_error":      1,
+	"internal_error":      2,
+	"flow_control_error":  3,
+	"settings_timeout":    4,
+	"stream_closed":       5,
+	"frame_size_error":    6,
+	"refused_stream":      7,
+	"cancel":              8,
+	"compression_error":   9,
+	"connect_error":       10,
+	"enhance_your_calm":   11,
+	"inadequate_security": 12,
+	"http_1_1_required":   13,
+}
+
+// HTTP2ErrorCode is the error code of the frames sent by an HTTP/2 toxic,
+// written in JSON as its name, e.g. "refused_stream".
+type HTTP2ErrorCode string
+
+func (c *HTTP2ErrorCode) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return err
+	}
+	if _, ok := http2ErrorCodes[HTTP2ErrorCode(name)]; !ok && name != "" {
+		return &json.UnmarshalTypeError{Value: "string " + name, Type: reflect.TypeOf(*c)}
+	}
+	*c = HTTP2ErrorCode(name)
+	return nil
+}
+
+// code returns the error code, or the default one if it is not set.
+func (c HTTP2ErrorCode) code(fallback HTTP2ErrorCode) uint32 {
+	if c == "" {
+		c = fallback
+	}
+	return http2ErrorCodes[c]
+}
+
+// The HTTP2Toxic follows the frames of HTTP/2 over cleartext connections to
+// send a GOAWAY, starve the flow-control windows of the peer, reset streams or
+// delay the acknowledgements of SETTINGS, as outages show at the framing layer
+// that byte-level toxics can't reproduce. It acts on the frames sent by the
+// side of its stream: a toxic on the downstream acts as the server would.
+type HTTP2Toxic struct {
+	// Number of new streams left alone before the GOAWAY and the resets
+	After int `json:"after"`
+	// Send a GOAWAY before the next new stream, as if it wasn't processed
+	Goaway bool `json:"goaway"`
+	// Send a RST_STREAM after the headers of the new streams, and drop their data
+	Reset bool `json:"reset"`
+	// Fraction of the new streams that are reset, all of them if 0
+	Probability float32 `json:"probability"`
+	// Error code of the GOAWAY, "no_error" if not set, and of the RST_STREAM,
+	// "cancel" if not set
+	ErrorCode HTTP2ErrorCode `json:"error_code"`
+	// Drop the WINDOW_UPDATE frames, so that the peer runs out of window
+	Starve bool `json:"starve"`
+	// Time in milliseconds the SETTINGS acknowledgements are delayed by
+	SettingsAckDelay int64 `json:"settings_ack_delay"`
+}
+
+type HTTP2ToxicState struct {
+	started   bool
+	lost      bool   // The data passes through once it isn't HTTP/2
+	preface   int    // Bytes of the client preface left
+	framed    bool   // The first frame was seen
+	head      []byte // Header of the next frame, until it is read
+	remaining int    // Bytes of the current frame left
+	dropping  bool   // The current frame is dropped
+	resetting uint32 // Stream reset once its headers are sent, 0 if none
+	headers   bool   // The current frame ends the headers of the stream reset
+	maxStream uint32 // Largest stream id seen
+	streams   int    // New streams seen
+	goaway    bool   // The GOAWAY was sent
+	reset     map[uint32]bool
+}
+
+// http2Frame returns a frame with its header.
+func http2Frame(kind, flags byte, streamID uint32, payload []byte) []byte {
+	size := len(payload)
+	frame := []byte{byte(size >> 16), byte(size >> 8), byte(size), kind, flags}
+	frame = binary.BigEndian.AppendUint32(frame, streamID)
+	return append(frame, payload...)
+}
+
+func (t *HTTP2Toxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*HTTP2ToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its frames can't be found.
+		state.lost = stub.Late
+		if stub.Direction == stream.Upstream {
+			state.preface = len(http2Preface)
+		}
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				t.Cleanup(stub)
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			h := http2Chunk{toxic: t, stub: stub, state: state, chunk: c}
+			h.run()
+			if h.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the frame held once the toxic is removed.
+func (t *HTTP2Toxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*HTTP2ToxicState)
+	if len(state.head) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.head, Timestamp: time.Now()}
+		state.head = nil
+	}
+}
+
+func (t *HTTP2Toxic) NewState() interface{} {
+	return new(HTTP2ToxicState)
+}
+
+// http2Chunk parses a chunk of data of an HTTP/2 toxic.
+type http2Chunk struct {
+	toxic       *HTTP2Toxic
+	stub        *ToxicStub
+	state       *HTTP2ToxicState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied.
+func (h *http2Chunk) run() {
+	state := h.state
+	data := h.chunk.Data
+	defer h.flush()
+	for len(data) > 0 {
+		if state.lost {
+			h.out = append(h.out, data...)
+			return
+		}
+
+		if state.preface > 0 {
+			start := len(http2Preface) - state.preface
+			n := min(state.preface, len(data))
+			if string(data[:n]) != http2Preface[start:start+n] {
+				state.lost = true
+				h.out = append(h.out, http2Preface[:start]...)
+				continue
+			}
+			h.out = append(h.out, data[:n]...)
+			data = data[n:]
+			state.preface -= n
+			continue
+		}
+
+		if state.remaining > 0 {
+			n := min(state.remaining, len(data))
+			h.send(data[:n])
+			data = data[n:]
+			state.remaining -= n
+			if state.remaining == 0 {
+				h.end()
+			}
+			continue
+		}
+
+		n := min(http2HeaderSize-len(state.head), len(data))
+		state.head = append(state.head, data[:n]...)
+		data = data[n:]
+		if len(state.head) < http2HeaderSize {
+			continue
+		}
+		head := state.head
+		state.head = nil
+		if !state.framed {
+			state.framed = true
+			// Both sides start with their SETTINGS.
+			if head[3] != http2Settings {
+				state.lost = true
+				h.out = append(h.out, head...)
+				continue
+			}
+		}
+
+		state.remaining = int(head[0])<<16 | int(head[1])<<8 | int(head[2])
+		h.begin(head)
+		h.send(head)
+		if state.remaining == 0 {
+			h.end()
+		}
+	}
+}
+
+// begin applies the toxic to a frame starting.
+func (h *http2Chunk) begin(head []byte) {
+	state := h.state
+	kind, flags := head[3], head[4]
+	streamID := binary.BigEndian.Uint32(head[5:]) & 0x7fffffff
+	state.dropping = false
+
+	switch {
+	case kind == http2WindowUpdate && h.toxic.Starve:
+		h.stub.Stats.AddChunk(len(h.chunk.Data))
+		state.dropping = true
+	case kind == http2Settings && flags&http2Ack != 0 && h.toxic.SettingsAckDelay > 0:
+		h.delay(time.Duration(h.toxic.SettingsAckDelay) * time.Millisecond)
+	case kind == http2Headers && streamID > state.maxStream:
+		state.maxStream = streamID
+		state.streams++
+		if state.streams <= h.toxic.After {
+			break
+		}
+		if h.toxic.Goaway && !state.goaway {
+			state.goaway = true
+			h.stub.Stats.AddChunk(len(h.chunk.Data))
+			// The new stream is past the last one processed.
+			last := uint32(0)
+			if streamID > 2 {
+				last = streamID - 2
+			}
+			payload := binary.BigEndian.AppendUint32(nil, last)
+			payload = binary.BigEndian.AppendUint32(payload, h.toxic.ErrorCode.code("no_error"))
+			h.out = append(h.out, http2Frame(http2Goaway, 0, 0, payload)...)
+		}
+		if h.toxic.Reset &&
+			(h.toxic.Probability <= 0 || h.stub.Rand().Float32() < h.toxic.Probability) {
+			h.stub.Stats.AddChunk(len(h.chunk.Data))
+			state.resetting = streamID
+		}
+	case kind == http2Data && state.reset[streamID]:
+		state.dropping = true
+		if flags&http2EndStream != 0 {
+			delete(state.reset, streamID)
+		}
+	}
+
+	// The RST_STREAM follows the whole block of headers, which the peer decodes
+	// even for a stream reset to keep the state of its compression.
+	state.headers = state.resetting != 0 &&
+		(kind == http2Headers || kind == http2Continuation) && flags&http2EndHeaders != 0
+}
+
+// end sends the RST_STREAM of a stream reset once its headers are sent.
+func (h *http2Chunk) end() {
+	state := h.state
+	if !state.headers {
+		return
+	}
+	streamID := state.resetting
+	state.resetting, state.headers = 0, false
+	if state.reset == nil {
+		state.reset = make(map[uint32]bool)
+	}
+	state.reset[streamID] = true
+	payload := binary.BigEndian.AppendUint32(nil, h.toxic.ErrorCode.code("cancel"))
+	h.out = append(h.out, http2Frame(http2RstStream, 0, streamID, payload)...)
+}
+
+// send sends data of the current frame, unless it is dropped.
+func (h *http2Chunk) send(data []byte) {
+	if !h.state.dropping {
+		h.out = append(h.out, data...)
+	}
+}
+
+// delay holds the current frame and the next ones. The frames are not delayed
+// once the toxic was interrupted.
+func (h *http2Chunk) delay(delay time.Duration) {
+	if h.interrupted {
+		return
+	}
+	h.stub.Stats.AddChunk(len(h.chunk.Data))
+	h.flush()
+	select {
+	case <-time.After(delay):
+		h.stub.Stats.AddDelay(delay)
+	case <-h.stub.Interrupt:
+		// The rest of the chunk is sent right away.
+		h.interrupted = true
+	}
+}
+
+func (h *http2Chunk) flush() {
+	if len(h.out) > 0 {
+		h.stub.Output <- &stream.StreamChunk{Data: h.out, Timestamp: h.chunk.Timestamp}
+		h.out = nil
+	}
+}
+
+func (t *HTTP2Toxic) Validate() error {
+	return firstError(
+		nonNegative("after", t.After),
+		inRange("probability", t.Probability, 0, 1),
+		nonNegative("settings_ack_delay", t.SettingsAckDelay),
+	)
+}
+
+func init() {
+	Register("http2", new(HTTP2Toxic))
+}
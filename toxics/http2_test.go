@@ -0,0 +1,104 @@
+package toxics_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// h2Frame returns a frame of HTTP/2.
+func h2Frame(kind, flags byte, streamID uint32, payload string) []byte {
+	size := len(payload)
+	frame := []byte{byte(size >> 16), byte(size >> 8), byte(size), kind, flags}
+	frame = binary.BigEndian.AppendUint32(frame, streamID)
+	return append(frame, payload...)
+}
+
+var (
+	h2Preface     = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	h2Settings    = h2Frame(4, 0, 0, "\x00\x03\x00\x00\x00\x64")
+	h2SettingsAck = h2Frame(4, 1, 0, "")
+	h2Window      = h2Frame(8, 0, 0, "\x00\x01\x00\x00")
+	// The response of a stream, with its headers split in a CONTINUATION.
+	h2Response = func(streamID uint32) []byte {
+		return append(append(append(
+			h2Frame(1, 0, streamID, "\x88"),
+			h2Frame(9, 4, streamID, "\x0f\x10\x03foo")...),
+			h2Frame(0, 0, streamID, "hello")...),
+			h2Frame(0, 1, streamID, "")...)
+	}
+)
+
+// runH2 runs the toxic on the downstream, as sent by a server.
+func runH2(t *testing.T, toxic *toxics.HTTP2Toxic, chunks ...[]byte) []byte {
+	t.Helper()
+	result, _ := runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Downstream
+	}, chunks...)
+	return result
+}
+
+func TestHTTP2ToxicSendsAGoaway(t *testing.T) {
+	toxic := &toxics.HTTP2Toxic{Goaway: true, After: 1}
+	result := runH2(t, toxic, h2Settings, h2Response(1), h2Response(3), h2Response(5))
+	checkWire(t, result, h2Settings, h2Response(1),
+		h2Frame(7, 0, 0, "\x00\x00\x00\x01\x00\x00\x00\x00"), h2Response(3), h2Response(5))
+}
+
+func TestHTTP2ToxicResetsStreams(t *testing.T) {
+	toxic := new(toxics.HTTP2Toxic)
+	err := json.Unmarshal([]byte(`{"reset": true, "error_code": "refused_stream"}`), toxic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := h2Response(1)
+	// The frames are split across chunks.
+	result := runH2(t, toxic, h2Settings, response[:5], response[5:14], response[14:], h2Window)
+	checkWire(t, result, h2Settings, response[:25],
+		h2Frame(3, 0, 1, "\x00\x00\x00\x07"), h2Window)
+
+	err = json.Unmarshal([]byte(`{"error_code": "oops"}`), toxic)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("Expected an invalid error code to be rejected, got %v", err)
+	}
+}
+
+func TestHTTP2ToxicStarvesWindows(t *testing.T) {
+	toxic := &toxics.HTTP2Toxic{Starve: true}
+	result, _ := runWire(t, toxic, false, h2Preface, h2Settings, h2Window, h2Response(1))
+	checkWire(t, result, h2Preface, h2Settings, h2Response(1))
+}
+
+func TestHTTP2ToxicDelaysSettingsAcks(t *testing.T) {
+	toxic := &toxics.HTTP2Toxic{SettingsAckDelay: 100}
+	start := time.Now()
+	result := runH2(t, toxic, h2Settings, h2Response(1))
+	if time.Since(start) > 80*time.Millisecond {
+		t.Error("Expected the settings not to be delayed")
+	}
+	checkWire(t, result, h2Settings, h2Response(1))
+
+	start = time.Now()
+	result = runH2(t, toxic, h2Settings, h2SettingsAck, h2Response(1))
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the acknowledgement to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, h2Settings, h2SettingsAck, h2Response(1))
+}
+
+func TestHTTP2ToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.HTTP2Toxic{Starve: true}
+	result, _ := runWire(t, toxic, true, h2Window)
+	checkWire(t, result, h2Window)
+
+	request := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	result, _ = runWire(t, toxic, false, request, h2Window)
+	checkWire(t, result, request, h2Window)
+
+	result = runH2(t, toxic, h2Window, h2Window)
+	checkWire(t, result, h2Window, h2Window)
+}
@@ -0,0 +1,483 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Keys of the Kafka APIs that can be named in the attributes of the toxic.
+var kafkaAPIKeys = map[string]int16{
+	"produce":          0,
+	"fetch":            1,
+	"list_offsets":     2,
+	"metadata":         3,
+	"offset_commit":    8,
+	"offset_fetch":     9,
+	"find_coordinator": 10,
+	"join_group":       11,
+	"heartbeat":        12,
+	"leave_group":      13,
+	"sync_group":       14,
+	"api_versions":     18,
+}
+
+const kafkaMetadata = 3
+
+// A message larger than this is likely not Kafka, e.g. the handshake of TLS.
+const kafkaMaxSize = 256 << 20
+
+// KafkaAPIKeys are the keys of Kafka APIs, written in JSON as an array or a
+// single value of numbers or names, e.g. ["produce", 1].
+type KafkaAPIKeys []int16
+
+func (k *KafkaAPIKeys) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if json.Unmarshal(data, &values) != nil {
+		var value interface{}
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+		values = []interface{}{value}
+	}
+
+	keys := KafkaAPIKeys{}
+	for _, value := range values {
+		switch value := value.(type) {
+		case float64:
+			if value == float64(int16(value)) {
+				keys = append(keys, int16(value))
+				continue
+			}
+		case string:
+			if key, ok := kafkaAPIKeys[value]; ok {
+				keys = append(keys, key)
+				continue
+			}
+		}
+		return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(*k)}
+	}
+	*k = keys
+	return nil
+}
+
+// The KafkaToxic follows the requests of Kafka clients to delay or fail the
+// ones of some APIs, and rewrites the addresses of the brokers in the Metadata
+// responses so that the clients keep connecting through proxies. The requests
+// are acted on in the upstream; the addresses are rewritten in the downstream
+// of a toxic of both streams only, as the responses are matched with their
+// requests.
+type KafkaToxic struct {
+	// Keys of the APIs of the requests acted on, all if empty
+	APIKeys KafkaAPIKeys `json:"api_keys"`
+	// Time in milliseconds each request is delayed by
+	Delay int64 `json:"delay"`
+	// Drop the requests, for the clients to time out
+	Drop bool `json:"drop"`
+	// Close the connection instead of sending the requests
+	Kill  bool      `json:"kill"`
+	Close CloseMode `json:"close"`
+	// Address advertised for the brokers, host:port
+	Advertise string `json:"advertise"`
+	// Addresses advertised for some brokers, by their host:port
+	Brokers map[string]string `json:"brokers"`
+}
+
+// KafkaToxicState follows the messages of a stream.
+type KafkaToxicState struct {
+	started   bool
+	lost      bool   // The data passes through once the stream can't be followed
+	head      []byte // Of the next message, until it is read
+	remaining int    // Bytes of the current message left
+	dropping  bool   // The current message is dropped
+	message   []byte // The current message, if it is rewritten
+	version   int16  // Of the Metadata response rewritten
+}
+
+// KafkaSharedState holds the versions of the Metadata requests sent, by their
+// correlation id, to rewrite their responses.
+type KafkaSharedState struct {
+	lock     sync.Mutex
+	metadata map[int32]int16
+}
+
+func (s *KafkaSharedState) add(correlation int32, version int16) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.metadata[correlation] = version
+}
+
+// take returns the version of the Metadata request of the response, if it is
+// one.
+func (s *KafkaSharedState) take(correlation int32) (int16, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	version, ok := s.metadata[correlation]
+	delete(s.metadata, correlation)
+	return version, ok
+}
+
+// headSize returns the size of the start of the messages needed: the size
+// and header of a request, or the size and correlation id of a response.
+func kafkaHeadSize(direction stream.Direction) int {
+	if direction == stream.Upstream {
+		return 12
+	}
+	return 8
+}
+
+func (t *KafkaToxic) acts() bool {
+	return t.Delay > 0 || t.Drop || t.Kill
+}
+
+func (t *KafkaToxic) rewrites() bool {
+	return t.Advertise != "" || len(t.Brokers) > 0
+}
+
+func (t *KafkaToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*KafkaToxicState)
+	shared, _ := stub.Shared.(*KafkaSharedState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its messages can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			k := kafkaChunk{toxic: t, stub: stub, state: state, shared: shared, chunk: c}
+			if k.run() {
+				stub.Stats.AddClose()
+				stub.CloseWith(t.Close)
+				return
+			}
+			if k.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the message held once the toxic is removed.
+func (t *KafkaToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*KafkaToxicState)
+	if data := append(state.message, state.head...); len(data) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: data, Timestamp: time.Now()}
+	}
+	state.message, state.head = nil, nil
+}
+
+func (t *KafkaToxic) NewState() interface{} {
+	return new(KafkaToxicState)
+}
+
+func (t *KafkaToxic) NewSharedState() interface{} {
+	return &KafkaSharedState{metadata: make(map[int32]int16)}
+}
+
+// kafkaChunk parses a chunk of data of a Kafka toxic.
+type kafkaChunk struct {
+	toxic       *KafkaToxic
+	stub        *ToxicStub
+	state       *KafkaToxicState
+	shared      *KafkaSharedState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied, and reports whether
+// the connection is killed.
+func (k *kafkaChunk) run() bool {
+	state := k.state
+	data := k.chunk.Data
+	defer k.flush()
+	for len(data) > 0 {
+		if state.lost {
+			k.out = append(k.out, data...)
+			return false
+		}
+
+		if state.remaining == 0 {
+			size := kafkaHeadSize(k.stub.Direction)
+			n := min(size-len(state.head), len(data))
+			state.head = append(state.head, data[:n]...)
+			data = data[n:]
+			if len(state.head) < size {
+				continue
+			}
+
+			length := binary.BigEndian.Uint32(state.head)
+			if length < uint32(size-4) || length > kafkaMaxSize {
+				state.lost = true
+				k.out = append(k.out, state.head...)
+				state.head = state.head[:0]
+				continue
+			}
+			state.remaining = int(length) + 4 - size
+			if k.begin() {
+				return true
+			}
+			k.send(state.head)
+			state.head = state.head[:0]
+		} else {
+			n := min(state.remaining, len(data))
+			k.send(data[:n])
+			data = data[n:]
+			state.remaining -= n
+		}
+
+		if state.remaining == 0 {
+			k.end()
+		}
+	}
+	return false
+}
+
+// begin applies the toxic to the message starting, and reports whether the
+// connection is killed.
+func (k *kafkaChunk) begin() bool {
+	state := k.state
+	if k.stub.Direction != stream.Upstream {
+		correlation := int32(binary.BigEndian.Uint32(state.head[4:]))
+		if k.shared != nil {
+			if version, ok := k.shared.take(correlation); ok {
+				state.version = version
+				state.message = []byte{}
+			}
+		}
+		return false
+	}
+
+	key := int16(binary.BigEndian.Uint16(state.head[4:]))
+	if k.toxic.acts() && (len(k.toxic.APIKeys) == 0 || slices.Contains(k.toxic.APIKeys, key)) {
+		k.stub.Stats.AddChunk(len(k.chunk.Data))
+		if k.toxic.Kill {
+			return true
+		}
+		if k.toxic.Drop {
+			state.dropping = true
+			return false
+		}
+		if k.toxic.Delay > 0 && !k.interrupted {
+			k.flush()
+			delay := time.Duration(k.toxic.Delay) * time.Millisecond
+			select {
+			case <-time.After(delay):
+				k.stub.Stats.AddDelay(delay)
+			case <-k.stub.Interrupt:
+				// The rest of the chunk is sent right away.
+				k.interrupted = true
+			}
+		}
+	}
+	if key == kafkaMetadata && k.shared != nil && k.toxic.rewrites() {
+		version := int16(binary.BigEndian.Uint16(state.head[6:]))
+		k.shared.add(int32(binary.BigEndian.Uint32(state.head[8:])), version)
+	}
+	return false
+}
+
+// send sends data of the current message, unless it is dropped or rewritten.
+func (k *kafkaChunk) send(data []byte) {
+	switch {
+	case k.state.dropping:
+	case k.state.message != nil:
+		k.state.message = append(k.state.message, data...)
+	default:
+		k.out = append(k.out, data...)
+	}
+}
+
+// end sends the message ended, rewritten if it is a Metadata response.
+func (k *kafkaChunk) end() {
+	state := k.state
+	if state.message != nil {
+		k.out = append(k.out, k.toxic.rewriteMetadata(state.message, state.version)...)
+	}
+	state.message = nil
+	state.dropping = false
+}
+
+func (k *kafkaChunk) flush() {
+	if len(k.out) > 0 {
+		k.stub.Output <- &stream.StreamChunk{Data: k.out, Timestamp: k.chunk.Timestamp}
+		k.out = nil
+	}
+}
+
+// kafkaReader reads the fields of a Kafka message, until one is missing.
+type kafkaReader struct {
+	data []byte
+	pos  int
+	ok   bool
+}
+
+func (r *kafkaReader) bytes(n int) []byte {
+	if !r.ok || n < 0 || r.pos+n > len(r.data) {
+		r.ok = false
+		return nil
+	}
+	r.pos += n
+	return r.data[r.pos-n : r.pos]
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.bytes(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.bytes(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) uvarint() int {
+	if !r.ok {
+		return 0
+	}
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 || value > kafkaMaxSize {
+		r.ok = false
+		return 0
+	}
+	r.pos += n
+	return int(value)
+}
+
+// string reads a string, compact in flexible versions. A null string is
+// returned as nil.
+func (r *kafkaReader) string(compact bool) []byte {
+	if compact {
+		n := r.uvarint()
+		if n == 0 {
+			return nil
+		}
+		return r.bytes(n - 1)
+	}
+	n := r.int16()
+	if n < 0 {
+		return nil
+	}
+	return r.bytes(int(n))
+}
+
+// taggedFields skips the tagged fields of flexible versions.
+func (r *kafkaReader) taggedFields() {
+	for i := r.uvarint(); i > 0 && r.ok; i-- {
+		r.uvarint()
+		r.bytes(r.uvarint())
+	}
+}
+
+// appendKafkaString appends a string, compact in flexible versions.
+func appendKafkaString(data []byte, s string, compact bool) []byte {
+	if compact {
+		data = binary.AppendUvarint(data, uint64(len(s)+1))
+	} else {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(s)))
+	}
+	return append(data, s...)
+}
+
+// advertised returns the address advertised for a broker, if it changes.
+func (t *KafkaToxic) advertised(host []byte, port int32) (string, int32, bool) {
+	address, ok := t.Brokers[net.JoinHostPort(string(host), strconv.Itoa(int(port)))]
+	if !ok {
+		address = t.Advertise
+	}
+	host2, port2, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(port2, 10, 31)
+	if err != nil {
+		return "", 0, false
+	}
+	return host2, int32(n), true
+}
+
+// rewriteMetadata rewrites the addresses of the brokers of a Metadata response
+// of the version, with its size. The message is returned as is if it can't be
+// parsed.
+func (t *KafkaToxic) rewriteMetadata(message []byte, version int16) []byte {
+	flexible := version >= 9
+	r := kafkaReader{data: message, pos: 8, ok: true}
+	if flexible {
+		// The tagged fields of the header
+		r.taggedFields()
+	}
+	if version >= 3 {
+		r.int32() // Throttle time
+	}
+
+	var brokers int
+	if flexible {
+		brokers = r.uvarint() - 1
+	} else {
+		brokers = int(r.int32())
+	}
+	result := append([]byte(nil), message[:r.pos]...)
+	for i := 0; i < brokers && r.ok; i++ {
+		node := r.bytes(4)
+		host := r.string(flexible)
+		port := r.int32()
+		fields := r.pos
+		if version >= 1 {
+			r.string(flexible) // Rack
+		}
+		if flexible {
+			r.taggedFields()
+		}
+		if !r.ok {
+			break
+		}
+
+		result = append(result, node...)
+		if newHost, newPort, ok := t.advertised(host, port); ok {
+			host, port = []byte(newHost), newPort
+		}
+		result = appendKafkaString(result, string(host), flexible)
+		result = binary.BigEndian.AppendUint32(result, uint32(port))
+		result = append(result, message[fields:r.pos]...)
+	}
+	if !r.ok {
+		return message
+	}
+
+	result = append(result, message[r.pos:]...)
+	binary.BigEndian.PutUint32(result, uint32(len(result)-4))
+	return result
+}
+
+func (t *KafkaToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
+func init() {
+	Register("kafka", new(KafkaToxic))
+}
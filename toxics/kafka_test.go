@@ -0,0 +1,137 @@
+package toxics_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// kafkaRequest returns a request of a Kafka client with its header.
+func kafkaRequest(key, version int16, correlation int32) []byte {
+	header := binary.BigEndian.AppendUint16(nil, uint16(key))
+	header = binary.BigEndian.AppendUint16(header, uint16(version))
+	header = binary.BigEndian.AppendUint32(header, uint32(correlation))
+	header = append(header, "\x00\x04test"...) // Client id
+	return kafkaMessage(string(header))
+}
+
+// kafkaResponse returns a response of a Kafka broker.
+func kafkaResponse(correlation int32, body string) []byte {
+	return kafkaMessage(string(binary.BigEndian.AppendUint32(nil, uint32(correlation))) + body)
+}
+
+func kafkaMessage(payload string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(payload))), payload...)
+}
+
+// kafkaBroker returns a broker of a Metadata response, with a rack in version
+// 1 and later, and compact in version 9 and later.
+func kafkaBroker(version int16, host string, port int32) string {
+	broker := "\x00\x00\x00\x01"
+	if version >= 9 {
+		broker += string(rune(len(host)+1)) + host
+	} else {
+		broker += "\x00" + string(rune(len(host))) + host
+	}
+	broker += string(binary.BigEndian.AppendUint32(nil, uint32(port)))
+	if version >= 9 {
+		return broker + "\x00\x00" // Null rack and no tagged fields
+	}
+	return broker + "\xff\xff"
+}
+
+func kafkaMetadata(version int16, correlation int32, host string, port int32) []byte {
+	if version >= 9 {
+		return kafkaResponse(correlation, "\x00\x00\x00\x00\x00\x02"+kafkaBroker(version, host, port)+
+			"\x00\x00\x00\x00\x01\x01\x00")
+	}
+	return kafkaResponse(correlation, "\x00\x00\x00\x01"+kafkaBroker(version, host, port)+
+		"\x00\x00\x00\x01\x00\x00\x00\x00")
+}
+
+func TestKafkaToxicActsOnRequestsOfSomeAPIs(t *testing.T) {
+	fetch := kafkaRequest(1, 11, 1)
+	produce := kafkaRequest(0, 7, 2)
+	upstream := func(stub *toxics.ToxicStub) { stub.Direction = stream.Upstream }
+
+	toxic := new(toxics.KafkaToxic)
+	err := json.Unmarshal([]byte(`{"api_keys": "produce", "delay": 50}`), toxic)
+	if err != nil {
+		t.Fatal("Failed to parse the attributes:", err)
+	}
+	start := time.Now()
+	result, _ := runStub(t, toxic, upstream, fetch, append(produce, fetch...))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the produce request to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, fetch, produce, fetch)
+
+	toxic = &toxics.KafkaToxic{APIKeys: toxics.KafkaAPIKeys{0}, Drop: true}
+	// The request is split in the middle of its header.
+	result, _ = runStub(t, toxic, upstream, append(fetch, produce[:6]...), produce[6:], fetch)
+	checkWire(t, result, fetch, fetch)
+
+	toxic = &toxics.KafkaToxic{APIKeys: toxics.KafkaAPIKeys{0}, Kill: true}
+	result, closes := runStub(t, toxic, upstream, append(fetch, produce...), fetch)
+	checkWire(t, result, fetch)
+	if closes != 1 {
+		t.Error("Expected the connection to be closed on the produce request")
+	}
+
+	err = json.Unmarshal([]byte(`{"api_keys": ["fetch", "nope"]}`), toxic)
+	if err == nil {
+		t.Error("Expected an unknown API to be refused")
+	}
+}
+
+func TestKafkaToxicRewritesMetadataResponses(t *testing.T) {
+	toxic := &toxics.KafkaToxic{
+		Advertise: "localhost:19092",
+		Brokers:   map[string]string{"kafka-2:9092": "localhost:29092"},
+	}
+	shared := toxic.NewSharedState()
+	runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Upstream
+		stub.Shared = shared
+	}, kafkaRequest(3, 1, 7), kafkaRequest(3, 9, 8), kafkaRequest(3, 12, 9))
+
+	other := kafkaResponse(6, "\x00\x00")
+	responses := append(append(append(other,
+		kafkaMetadata(1, 7, "kafka-1", 9092)...),
+		kafkaMetadata(9, 8, "kafka-2", 9092)...),
+		kafkaMetadata(12, 9, "kafka-1", 9092)...)
+	result, _ := runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Downstream
+		stub.Shared = shared
+	}, responses[:20], responses[20:])
+	checkWire(t, result, other,
+		kafkaMetadata(1, 7, "localhost", 19092),
+		kafkaMetadata(9, 8, "localhost", 29092),
+		kafkaMetadata(12, 9, "localhost", 19092))
+
+	// Without the requests of the upstream, the responses are not known.
+	result, _ = runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Downstream
+	}, responses)
+	checkWire(t, result, responses)
+}
+
+func TestKafkaToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.KafkaToxic{Drop: true}
+	request := kafkaRequest(0, 7, 1)
+	result, _ := runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Upstream
+		stub.Late = true
+	}, request)
+	checkWire(t, result, request)
+
+	encrypted := []byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\x00")
+	result, _ = runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Upstream
+	}, encrypted, request)
+	checkWire(t, result, encrypted, request)
+}
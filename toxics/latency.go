@@ -1,7 +1,6 @@
 package toxics
 
 import (
-	"math/rand"
 	"time"
 )
 
@@ -16,18 +15,19 @@ func (t *LatencyToxic) GetBufferSize() int {
 	return 1024
 }
 
-func (t *LatencyToxic) delay() time.Duration {
+func (t *LatencyToxic) delay(stub *ToxicStub) time.Duration {
 	// Delay = t.Latency +/- t.Jitter
 	delay := t.Latency
 	jitter := t.Jitter
 	if jitter > 0 {
-		// #nosec G404 -- was ignored before too
-		delay += rand.Int63n(jitter*2) - jitter
+		delay += stub.Rand().Int63n(jitter*2) - jitter
 	}
 	return time.Duration(delay) * time.Millisecond
 }
 
 func (t *LatencyToxic) Pipe(stub *ToxicStub) {
+	// Woken up by the shared timer wheel rather than by a timer per chunk.
+	wake := make(chan struct{}, 1)
 	for {
 		select {
 		case <-stub.Interrupt:
@@ -37,20 +37,34 @@ func (t *LatencyToxic) Pipe(stub *ToxicStub) {
 				stub.Close()
 				return
 			}
-			sleep := t.delay() - time.Since(c.Timestamp)
-			select {
-			case <-time.After(sleep):
-				c.Timestamp = c.Timestamp.Add(sleep)
-				stub.Output <- c
-			case <-stub.Interrupt:
-				// Exit fast without applying latency.
-				stub.Output <- c // Don't drop any data on the floor
-				return
+			received := c.Timestamp
+			deadline := received.Add(t.delay(stub))
+			sleep := time.Until(deadline)
+			if sleep > 0 {
+				latencyWheel.schedule(deadline, wake)
+				select {
+				case <-wake:
+				case <-stub.Interrupt:
+					// Exit fast without applying latency.
+					stub.Output <- c // Don't drop any data on the floor
+					return
+				}
 			}
+			c.Timestamp = c.Timestamp.Add(sleep)
+			stub.Stats.AddChunk(len(c.Data))
+			stub.Stats.AddDelay(max(sleep, 0))
+			stub.Output <- c
 		}
 	}
 }
 
+func (t *LatencyToxic) Validate() error {
+	return firstError(
+		nonNegative("latency", t.Latency),
+		nonNegative("jitter", t.Jitter),
+	)
+}
+
 func init() {
 	Register("latency", new(LatencyToxic))
 }
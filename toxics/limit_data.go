@@ -2,59 +2,100 @@ package toxics
 
 import "github.com/Shopify/toxiproxy/v2/stream"
 
-// LimitDataToxic has limit in bytes.
+// LimitDataToxic has limit in bytes. The data is cut at the byte of the
+// limit, in the middle of a chunk if needed.
 type LimitDataToxic struct {
 	Bytes int64 `json:"bytes"`
+	// How the connection is closed at the limit, with a FIN by default.
+	Close CloseMode `json:"close"`
+	// Hold the connection open at the limit instead of closing it, until the
+	// toxic is resumed or removed.
+	Pause bool `json:"pause"`
 }
 
 type LimitDataToxicState struct {
 	bytesTransmitted int64
+	// The rest of the chunk cut at the limit, sent once paused links resume.
+	rest *stream.StreamChunk
 }
 
 func (t *LimitDataToxic) Pipe(stub *ToxicStub) {
 	state := stub.State.(*LimitDataToxicState)
-	bytesRemaining := t.Bytes - state.bytesTransmitted
 
 	for {
-		select {
-		case <-stub.Interrupt:
+		if t.Pause && state.bytesTransmitted >= t.Bytes {
+			// Nothing is read anymore, so the sender is slowed down by TCP
+			// until the toxic is resumed.
+			<-stub.Interrupt
 			return
-		case c := <-stub.Input:
+		}
+
+		c := state.rest
+		state.rest = nil
+		if c == nil {
+			select {
+			case <-stub.Interrupt:
+				return
+			case c = <-stub.Input:
+			}
 			if c == nil {
 				stub.Close()
 				return
 			}
+		}
 
-			if bytesRemaining < 0 {
-				bytesRemaining = 0
-			}
-
-			if bytesRemaining < int64(len(c.Data)) {
-				c = &stream.StreamChunk{
+		bytesRemaining := max(t.Bytes-state.bytesTransmitted, 0)
+		if bytesRemaining < int64(len(c.Data)) {
+			if t.Pause {
+				state.rest = &stream.StreamChunk{
 					Timestamp: c.Timestamp,
-					Data:      c.Data[0:bytesRemaining],
+					Data:      c.Data[bytesRemaining:],
 				}
 			}
-
-			if len(c.Data) > 0 {
-				stub.Output <- c
-				state.bytesTransmitted += int64(len(c.Data))
+			c = &stream.StreamChunk{
+				Timestamp: c.Timestamp,
+				Data:      c.Data[0:bytesRemaining],
 			}
+		}
 
-			bytesRemaining = t.Bytes - state.bytesTransmitted
+		if len(c.Data) > 0 {
+			stub.Output <- c
+			state.bytesTransmitted += int64(len(c.Data))
+		}
 
-			if bytesRemaining <= 0 {
-				stub.Close()
-				return
-			}
+		if state.bytesTransmitted >= t.Bytes && !t.Pause {
+			stub.Stats.AddClose()
+			stub.CloseWith(t.Close)
+			return
 		}
 	}
 }
 
+// Resume lets another limit of bytes through the paused link of the stub,
+// starting with the rest of the chunk cut at the limit.
+func (t *LimitDataToxic) Resume(stub *ToxicStub) {
+	state := stub.State.(*LimitDataToxicState)
+	state.bytesTransmitted = 0
+}
+
+// Cleanup sends the rest of the chunk cut at the limit once the toxic is
+// removed.
+func (t *LimitDataToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*LimitDataToxicState)
+	if state.rest != nil {
+		stub.Output <- state.rest
+		state.rest = nil
+	}
+}
+
 func (t *LimitDataToxic) NewState() interface{} {
 	return new(LimitDataToxicState)
 }
 
+func (t *LimitDataToxic) Validate() error {
+	return nonNegative("bytes", t.Bytes)
+}
+
 func init() {
 	Register("limit_data", new(LimitDataToxic))
 }
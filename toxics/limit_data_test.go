@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"testing"
+	"time"
 
 	"github.com/Shopify/toxiproxy/v2/stream"
 	"github.com/Shopify/toxiproxy/v2/toxics"
@@ -158,3 +159,68 @@ func TestLimitDataToxicLimitIsSetToZero(t *testing.T) {
 
 	check(t, toxic, [][]byte{buf}, [][]byte{})
 }
+
+func TestLimitDataToxicPausesMidChunkAndResumes(t *testing.T) {
+	toxic := &toxics.LimitDataToxic{Bytes: 100, Pause: true}
+
+	input := make(chan *stream.StreamChunk, 1)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	buf := buffer(150)
+	input <- &stream.StreamChunk{Data: buf}
+	done := make(chan struct{})
+	go func() {
+		toxic.Pipe(stub)
+		close(done)
+	}()
+	checkOutgoingChunk(t, output, buf[0:100])
+
+	// Paused at the limit, without reading or closing.
+	input <- &stream.StreamChunk{Data: buf}
+	select {
+	case <-done:
+		t.Fatal("Expected the toxic to stay paused at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	checkRemainingChunks(t, output)
+	if stub.Closed() {
+		t.Fatal("Expected the paused toxic not to close the stub")
+	}
+
+	stub.Interrupt <- struct{}{}
+	<-done
+	toxic.Resume(stub)
+	go toxic.Pipe(stub)
+
+	// The rest of the chunk cut at the limit comes first.
+	checkOutgoingChunk(t, output, buf[100:150])
+	checkOutgoingChunk(t, output, buf[0:50])
+	stub.Interrupt <- struct{}{}
+	checkRemainingChunks(t, output)
+}
+
+func TestLimitDataToxicCleanupSendsTheRestOfTheChunk(t *testing.T) {
+	toxic := &toxics.LimitDataToxic{Bytes: 10, Pause: true}
+
+	input := make(chan *stream.StreamChunk, 1)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	buf := buffer(25)
+	input <- &stream.StreamChunk{Data: buf}
+	done := make(chan struct{})
+	go func() {
+		toxic.Pipe(stub)
+		close(done)
+	}()
+	checkOutgoingChunk(t, output, buf[0:10])
+
+	stub.Interrupt <- struct{}{}
+	<-done
+	toxic.Cleanup(stub)
+	checkOutgoingChunk(t, output, buf[10:25])
+	checkRemainingChunks(t, output)
+}
@@ -0,0 +1,118 @@
+package toxics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Match restricts a toxic to some connections of its proxy, e.g. so that
+// only the traffic of the system under test is degraded while the other
+// clients of a shared proxy are not. A connection matches if it matches all
+// the fields set.
+type Match struct {
+	// A CIDR the IP of the client is in, or an IP, e.g. "10.1.0.0/16".
+	ClientCIDR string `json:"client_cidr,omitempty"`
+	// A port of the client, or an inclusive range of them, e.g. "40000-49999".
+	ClientPorts string `json:"client_ports,omitempty"`
+	// The address dialed for the connection, e.g. the destination of a
+	// client of a forward proxy, as "host:port" or only its host.
+	Upstream string `json:"upstream,omitempty"`
+}
+
+// Validate returns an error if the CIDR or the ports of the match are invalid.
+func (m *Match) Validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.ClientCIDR != "" {
+		_, err := parsePrefix(m.ClientCIDR)
+		if err != nil {
+			return fmt.Errorf("client_cidr %q is not a CIDR or an IP", m.ClientCIDR)
+		}
+	}
+	if m.ClientPorts != "" {
+		_, _, err := parsePorts(m.ClientPorts)
+		if err != nil {
+			return fmt.Errorf("client_ports %q: %w", m.ClientPorts, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a connection matches, from the IP and port of its
+// client and the address dialed for it. Every connection matches a nil Match.
+func (m *Match) Matches(clientIP string, clientPort int, upstream string) bool {
+	if m == nil {
+		return true
+	}
+	if m.ClientCIDR != "" {
+		prefix, err := parsePrefix(m.ClientCIDR)
+		ip, ipErr := netip.ParseAddr(clientIP)
+		if err != nil || ipErr != nil || !prefix.Contains(ip.Unmap()) {
+			return false
+		}
+	}
+	if m.ClientPorts != "" {
+		low, high, err := parsePorts(m.ClientPorts)
+		if err != nil || clientPort < low || clientPort > high {
+			return false
+		}
+	}
+	return m.Upstream == "" || matchesUpstream(m.Upstream, upstream)
+}
+
+// matchesUpstream reports whether an address dialed is the upstream of a
+// match, the host of an upstream without a port matching all of its ports.
+func matchesUpstream(want, upstream string) bool {
+	if strings.EqualFold(want, upstream) {
+		return true
+	}
+	if _, _, err := net.SplitHostPort(want); err == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(upstream)
+	return err == nil && strings.EqualFold(strings.Trim(want, "[]"), host)
+}
+
+// parsePrefix parses a CIDR, or an IP as the prefix of that IP alone.
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		ip, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// parsePorts parses a port, or an inclusive range of ports as "low-high".
+func parsePorts(ports string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(ports, "-")
+	if !isRange {
+		highText = lowText
+	}
+	low, err := strconv.Atoi(lowText)
+	if err != nil {
+		return 0, 0, errors.New("the ports must be a port or a range of ports")
+	}
+	high, err := strconv.Atoi(highText)
+	if err != nil {
+		return 0, 0, errors.New("the ports must be a port or a range of ports")
+	}
+	if low < 0 || high > 65535 || low > high {
+		return 0, 0, errors.New("the ports must be an increasing range from 0 to 65535")
+	}
+	return low, high, nil
+}
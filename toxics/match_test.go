@@ -0,0 +1,78 @@
+package toxics_test
+
+import (
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestMatchMatchesTheConnections(t *testing.T) {
+	testCases := []struct {
+		name     string
+		match    *toxics.Match
+		ip       string
+		port     int
+		upstream string
+		matches  bool
+	}{
+		{"nil", nil, "10.0.0.1", 40000, "db:5432", true},
+		{"cidr", &toxics.Match{ClientCIDR: "10.1.0.0/16"}, "10.1.2.3", 1, "", true},
+		{"outside cidr", &toxics.Match{ClientCIDR: "10.1.0.0/16"}, "10.2.2.3", 1, "", false},
+		{"ip", &toxics.Match{ClientCIDR: "127.0.0.1"}, "127.0.0.1", 1, "", true},
+		{"mapped ip", &toxics.Match{ClientCIDR: "127.0.0.0/8"}, "::ffff:127.0.0.1", 1, "", true},
+		{"ipv6", &toxics.Match{ClientCIDR: "fd00::/8"}, "fd12::1", 1, "", true},
+		{"not an ip", &toxics.Match{ClientCIDR: "10.0.0.0/8"}, "pipe", 1, "", false},
+		{"port", &toxics.Match{ClientPorts: "40000"}, "10.0.0.1", 40000, "", true},
+		{"port range", &toxics.Match{ClientPorts: "40000-49999"}, "10.0.0.1", 49999, "", true},
+		{"outside ports", &toxics.Match{ClientPorts: "40000-49999"}, "10.0.0.1", 50000, "", false},
+		{"upstream", &toxics.Match{Upstream: "db:5432"}, "10.0.0.1", 1, "db:5432", true},
+		{"upstream host", &toxics.Match{Upstream: "DB"}, "10.0.0.1", 1, "db:5432", true},
+		{"other upstream", &toxics.Match{Upstream: "db:5433"}, "10.0.0.1", 1, "db:5432", false},
+		{"ipv6 upstream host", &toxics.Match{Upstream: "[::1]"}, "10.0.0.1", 1, "[::1]:80", true},
+		{
+			"all",
+			&toxics.Match{ClientCIDR: "10.0.0.0/8", ClientPorts: "1-2", Upstream: "db"},
+			"10.0.0.1", 2, "db:5432", true,
+		},
+		{
+			"not all",
+			&toxics.Match{ClientCIDR: "10.0.0.0/8", ClientPorts: "1-2", Upstream: "db"},
+			"10.0.0.1", 3, "db:5432", false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.match.Matches(tc.ip, tc.port, tc.upstream) != tc.matches {
+				t.Errorf("Expected %v to match %s:%d to %s: %v",
+					tc.match, tc.ip, tc.port, tc.upstream, tc.matches)
+			}
+		})
+	}
+}
+
+func TestMatchValidate(t *testing.T) {
+	valid := []*toxics.Match{
+		nil,
+		{},
+		{ClientCIDR: "10.0.0.0/8", ClientPorts: "0-65535", Upstream: "db:5432"},
+		{ClientCIDR: "::1"},
+	}
+	for _, match := range valid {
+		if err := match.Validate(); err != nil {
+			t.Errorf("Expected %v to be valid: %v", match, err)
+		}
+	}
+
+	invalid := []*toxics.Match{
+		{ClientCIDR: "10.0.0.0/33"},
+		{ClientCIDR: "localhost"},
+		{ClientPorts: "http"},
+		{ClientPorts: "2-1"},
+		{ClientPorts: "1-65536"},
+	}
+	for _, match := range invalid {
+		if err := match.Validate(); err == nil {
+			t.Errorf("Expected %v to be invalid", match)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package toxics
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The shapes of the waveforms of a modulation.
+const (
+	WaveSine   = "sine"   // From min at the start of the period to max at its middle
+	WaveSquare = "square" // At max for the duty cycle at the start of the period, min after
+	WaveCustom = "custom" // The values, spread over the period
+)
+
+// defaultModulationInterval is the time between two updates of an attribute
+// following a waveform.
+const defaultModulationInterval = 1000
+
+// Waveform is a repeating waveform an attribute of a toxic follows over time,
+// its periods starting at the Unix epoch plus the phase, so that a period of a
+// day follows the time of day.
+type Waveform struct {
+	Shape string  `json:"shape"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	// Times in milliseconds
+	Period   int64 `json:"period"`
+	Phase    int64 `json:"phase,omitempty"`
+	Interval int64 `json:"interval,omitempty"` // Between two updates, 1000 if not set
+	// Fraction of the period a square wave is at max, 0.5 if not set
+	Duty float64 `json:"duty,omitempty"`
+	// Values of a custom wave, interpolated between them
+	Values []float64 `json:"values,omitempty"`
+}
+
+// Modulation is the waveforms the numeric attributes of a toxic follow, by
+// the JSON names of the attributes, e.g. a bandwidth rate degrading during
+// the peak hours of a soak test.
+type Modulation map[string]Waveform
+
+// At returns the value of the waveform at a time.
+func (w Waveform) At(now time.Time) float64 {
+	position := (now.UnixMilli() - w.Phase) % w.Period
+	if position < 0 {
+		position += w.Period
+	}
+	progress := float64(position) / float64(w.Period)
+
+	switch w.Shape {
+	case WaveSquare:
+		duty := w.Duty
+		if duty == 0 {
+			duty = 0.5
+		}
+		if progress < duty {
+			return w.Max
+		}
+		return w.Min
+	case WaveCustom:
+		index := progress * float64(len(w.Values))
+		i := int(index)
+		next := w.Values[(i+1)%len(w.Values)]
+		return w.Values[i] + (next-w.Values[i])*(index-float64(i))
+	default:
+		return w.Min + (w.Max-w.Min)*(1-math.Cos(2*math.Pi*progress))/2
+	}
+}
+
+// interval returns the time between two updates of the attribute.
+func (w Waveform) interval() time.Duration {
+	if w.Interval == 0 {
+		return defaultModulationInterval * time.Millisecond
+	}
+	return time.Duration(w.Interval) * time.Millisecond
+}
+
+// Validate checks the waveforms, and that the attributes are numbers of the
+// toxic.
+func (m Modulation) Validate(toxic Toxic) error {
+	for name, wave := range m {
+		_, ok := numericAttribute(toxic, name)
+		switch {
+		case !ok:
+			return fmt.Errorf("%s is not a numeric attribute of the toxic", name)
+		case wave.Shape != WaveSine && wave.Shape != WaveSquare && wave.Shape != WaveCustom:
+			return fmt.Errorf("the shape of %s must be sine, square or custom", name)
+		case wave.Period <= 0:
+			return fmt.Errorf("the period of %s must be positive", name)
+		case wave.Interval < 0:
+			return fmt.Errorf("the interval of %s must not be negative", name)
+		case wave.Duty < 0 || wave.Duty > 1:
+			return fmt.Errorf("the duty cycle of %s must be between 0 and 1", name)
+		case wave.Shape == WaveCustom && len(wave.Values) == 0:
+			return fmt.Errorf("the custom wave of %s has no values", name)
+		}
+	}
+	return nil
+}
+
+// Interval returns the time between two updates of the attributes, the
+// shortest interval of the waveforms.
+func (m Modulation) Interval() time.Duration {
+	var interval time.Duration
+	for _, wave := range m {
+		if interval == 0 || wave.interval() < interval {
+			interval = wave.interval()
+		}
+	}
+	return interval
+}
+
+// Attributes returns the values of the attributes at a time, rounded for the
+// attributes that are integers.
+func (m Modulation) Attributes(toxic Toxic, now time.Time) map[string]interface{} {
+	attrs := make(map[string]interface{}, len(m))
+	for name, wave := range m {
+		value := wave.At(now)
+		kind, _ := numericAttribute(toxic, name)
+		if kind != reflect.Float32 && kind != reflect.Float64 {
+			attrs[name] = int64(math.Round(value))
+		} else {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
+
+// numericAttribute returns the kind of the field of a toxic with a JSON name,
+// if it is a number.
+func numericAttribute(toxic Toxic, name string) (reflect.Kind, bool) {
+	value := reflect.Indirect(reflect.ValueOf(toxic))
+	if value.Kind() != reflect.Struct {
+		return reflect.Invalid, false
+	}
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag != name {
+			continue
+		}
+		switch kind := field.Type.Kind(); kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Float32, reflect.Float64:
+			return kind, true
+		}
+		return reflect.Invalid, false
+	}
+	return reflect.Invalid, false
+}
@@ -0,0 +1,61 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestWaveformValues(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	for _, tc := range []struct {
+		name     string
+		wave     toxics.Waveform
+		time     time.Time
+		expected float64
+	}{
+		{"sine start", toxics.Waveform{Shape: "sine", Min: 10, Max: 20, Period: 100}, at(0), 10},
+		{"sine middle", toxics.Waveform{Shape: "sine", Min: 10, Max: 20, Period: 100}, at(250), 20},
+		{"sine quarter", toxics.Waveform{Shape: "sine", Min: 10, Max: 20, Period: 100}, at(25), 15},
+		{
+			"sine phase",
+			toxics.Waveform{Shape: "sine", Min: 10, Max: 20, Period: 100, Phase: 50},
+			at(0),
+			20,
+		},
+		{"square on", toxics.Waveform{Shape: "square", Min: 1, Max: 2, Period: 100}, at(49), 2},
+		{"square off", toxics.Waveform{Shape: "square", Min: 1, Max: 2, Period: 100}, at(50), 1},
+		{
+			"square duty",
+			toxics.Waveform{Shape: "square", Min: 1, Max: 2, Period: 100, Duty: 0.1},
+			at(20),
+			1,
+		},
+		{
+			"custom value",
+			toxics.Waveform{Shape: "custom", Period: 300, Values: []float64{0, 30, 60}},
+			at(100),
+			30,
+		},
+		{
+			"custom interpolated",
+			toxics.Waveform{Shape: "custom", Period: 300, Values: []float64{0, 30, 60}},
+			at(150),
+			45,
+		},
+		{
+			"custom loop",
+			toxics.Waveform{Shape: "custom", Period: 300, Values: []float64{0, 30, 60}},
+			at(250),
+			30,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			value := tc.wave.At(tc.time)
+			if value < tc.expected-1e-9 || value > tc.expected+1e-9 {
+				t.Errorf("Expected %v, got %v", tc.expected, value)
+			}
+		})
+	}
+}
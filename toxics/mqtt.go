@@ -0,0 +1,278 @@
+package toxics
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Types of the control packets of MQTT, by their name.
+var mqttPackets = map[string]byte{
+	"connect":     1,
+	"connack":     2,
+	"publish":     3,
+	"puback":      4,
+	"pubrec":      5,
+	"pubrel":      6,
+	"pubcomp":     7,
+	"subscribe":   8,
+	"suback":      9,
+	"unsubscribe": 10,
+	"unsuback":    11,
+	"pingreq":     12,
+	"pingresp":    13,
+	"disconnect":  14,
+	"auth":        15,
+}
+
+const mqttPublish = 3
+
+// The DISCONNECT packet sent by the toxic, without a reason code.
+var mqttDisconnect = []byte{14 << 4, 0}
+
+// MQTTPackets are the types of the control packets acted on by an MQTT toxic,
+// written in JSON as a name or a list of names, e.g. ["puback", "pingresp"].
+type MQTTPackets []byte
+
+func (p *MQTTPackets) UnmarshalJSON(data []byte) error {
+	var names []string
+	if json.Unmarshal(data, &names) != nil {
+		var name string
+		err := json.Unmarshal(data, &name)
+		if err != nil {
+			return err
+		}
+		names = []string{name}
+	}
+
+	packets := MQTTPackets{}
+	for _, name := range names {
+		kind, ok := mqttPackets[name]
+		if !ok {
+			return &json.UnmarshalTypeError{Value: "string " + name, Type: reflect.TypeOf(*p)}
+		}
+		packets = append(packets, kind)
+	}
+	*p = packets
+	return nil
+}
+
+func (p MQTTPackets) MarshalJSON() ([]byte, error) {
+	names := []string{}
+	for _, kind := range p {
+		for name, k := range mqttPackets {
+			if k == kind {
+				names = append(names, name)
+			}
+		}
+	}
+	return json.Marshal(names)
+}
+
+// The MQTTToxic follows the control packets of MQTT 3.1.1 and 5 to drop or
+// delay the ones of some types, e.g. PUBACK, or to disconnect the client on
+// them, so that the QoS and the session resume of clients can be tested.
+type MQTTToxic struct {
+	// Types of the packets acted on, all if empty
+	Packets MQTTPackets `json:"packets"`
+	// Drop the packets
+	Drop bool `json:"drop"`
+	// Time in milliseconds the packets are delayed by
+	Delay int64 `json:"delay"`
+	// Send a DISCONNECT instead of the packets, and close the connection
+	Disconnect bool `json:"disconnect"`
+}
+
+type MQTTToxicState struct {
+	started   bool
+	lost      bool   // The data passes through once the stream can't be followed
+	head      []byte // Fixed header of the next packet, until it is read
+	remaining int    // Bytes of the current packet left
+	dropping  bool   // The current packet is dropped
+}
+
+// mqttHeader parses the fixed header of a packet: the remaining length, and
+// whether the header is whole. The header is invalid if the length is -1.
+func mqttHeader(head []byte) (int, bool) {
+	kind, flags := head[0]>>4, head[0]&0x0f
+	switch {
+	case kind == 0, kind == mqttPublish && flags&0x06 == 0x06:
+		return -1, true
+	case kind == 6 || kind == 8 || kind == 10:
+		if flags != 0x02 {
+			return -1, true
+		}
+	case kind != mqttPublish && flags != 0:
+		return -1, true
+	}
+
+	length := 0
+	for i, b := range head[1:] {
+		length |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return length, len(head) == i+2
+		}
+		if i == 3 {
+			return -1, true
+		}
+	}
+	return 0, false
+}
+
+func (t *MQTTToxic) matches(head []byte) bool {
+	return len(t.Packets) == 0 || slices.Contains(t.Packets, head[0]>>4)
+}
+
+func (t *MQTTToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*MQTTToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its packets can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			m := mqttChunk{toxic: t, stub: stub, state: state, chunk: c}
+			if m.run() {
+				stub.Stats.AddClose()
+				stub.Close()
+				return
+			}
+			if m.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the packet held once the toxic is removed.
+func (t *MQTTToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*MQTTToxicState)
+	if len(state.head) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.head, Timestamp: time.Now()}
+		state.head = nil
+	}
+}
+
+func (t *MQTTToxic) NewState() interface{} {
+	return new(MQTTToxicState)
+}
+
+// mqttChunk parses a chunk of data of an MQTT toxic.
+type mqttChunk struct {
+	toxic       *MQTTToxic
+	stub        *ToxicStub
+	state       *MQTTToxicState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied, and reports whether
+// the connection is disconnected.
+func (m *mqttChunk) run() bool {
+	state := m.state
+	data := m.chunk.Data
+	defer m.flush()
+	for len(data) > 0 {
+		if state.lost {
+			m.out = append(m.out, data...)
+			return false
+		}
+
+		if state.remaining > 0 {
+			n := min(state.remaining, len(data))
+			m.send(data[:n])
+			data = data[n:]
+			state.remaining -= n
+			continue
+		}
+
+		state.head = append(state.head, data[0])
+		data = data[1:]
+		if len(state.head) < 2 {
+			continue
+		}
+		length, whole := mqttHeader(state.head)
+		if length < 0 {
+			state.lost = true
+			m.out = append(m.out, state.head...)
+			state.head = state.head[:0]
+			continue
+		}
+		if !whole {
+			continue
+		}
+
+		state.remaining = length
+		state.dropping = false
+		if m.toxic.matches(state.head) && m.begin() {
+			return true
+		}
+		m.send(state.head)
+		state.head = state.head[:0]
+	}
+	return false
+}
+
+// begin applies the toxic to the packet starting, and reports whether the
+// connection is disconnected.
+func (m *mqttChunk) begin() bool {
+	m.stub.Stats.AddChunk(len(m.chunk.Data))
+	switch {
+	case m.toxic.Disconnect:
+		m.out = append(m.out, mqttDisconnect...)
+		return true
+	case m.toxic.Drop:
+		m.state.dropping = true
+	case m.toxic.Delay > 0 && !m.interrupted:
+		m.flush()
+		delay := time.Duration(m.toxic.Delay) * time.Millisecond
+		select {
+		case <-time.After(delay):
+			m.stub.Stats.AddDelay(delay)
+		case <-m.stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			m.interrupted = true
+		}
+	}
+	return false
+}
+
+// send sends data of the current packet, unless it is dropped.
+func (m *mqttChunk) send(data []byte) {
+	if !m.state.dropping {
+		m.out = append(m.out, data...)
+	}
+}
+
+func (m *mqttChunk) flush() {
+	if len(m.out) > 0 {
+		m.stub.Output <- &stream.StreamChunk{Data: m.out, Timestamp: m.chunk.Timestamp}
+		m.out = nil
+	}
+}
+
+func (t *MQTTToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
+func init() {
+	Register("mqtt", new(MQTTToxic))
+}
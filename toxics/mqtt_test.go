@@ -0,0 +1,71 @@
+package toxics_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+var (
+	mqttPublish = append([]byte{0x32, 0x81, 0x01, 0x00, 0x01, 't', 0x00, 0x01},
+		strings.Repeat("x", 124)...)
+	mqttPuback   = []byte{0x40, 0x02, 0x00, 0x01}
+	mqttPingresp = []byte{0xd0, 0x00}
+)
+
+func runMQTT(t *testing.T, attrs string, late bool, chunks ...[]byte) ([]byte, int64) {
+	t.Helper()
+	toxic := new(toxics.MQTTToxic)
+	err := json.Unmarshal([]byte(attrs), toxic)
+	if err != nil {
+		t.Fatal("Failed to parse the attributes:", err)
+	}
+	return runWire(t, toxic, late, chunks...)
+}
+
+func TestMQTTToxicDropsPackets(t *testing.T) {
+	// The remaining length of the publish takes two bytes, split across chunks.
+	result, _ := runMQTT(t, `{"packets": ["puback", "pingresp"], "drop": true}`, false,
+		append(mqttPuback, mqttPublish[:2]...), mqttPublish[2:], mqttPingresp, mqttPuback)
+	checkWire(t, result, mqttPublish)
+
+	_, err := json.Marshal(&toxics.MQTTToxic{Packets: toxics.MQTTPackets{4}})
+	if err != nil {
+		t.Error("Failed to marshal the packets:", err)
+	}
+	err = json.Unmarshal([]byte(`{"packets": "nope"}`), new(toxics.MQTTToxic))
+	if err == nil {
+		t.Error("Expected an unknown packet to be refused")
+	}
+}
+
+func TestMQTTToxicDelaysPackets(t *testing.T) {
+	start := time.Now()
+	result, _ := runMQTT(t, `{"packets": "publish", "delay": 50}`, false,
+		append(mqttPingresp, mqttPublish...))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the publish to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, mqttPingresp, mqttPublish)
+}
+
+func TestMQTTToxicDisconnects(t *testing.T) {
+	result, closes := runMQTT(t, `{"packets": "publish", "disconnect": true}`, false,
+		append(mqttPuback, mqttPublish...), mqttPingresp)
+	checkWire(t, result, mqttPuback, []byte{0xe0, 0x00})
+	if closes != 1 {
+		t.Error("Expected the connection to be closed")
+	}
+}
+
+func TestMQTTToxicPassesUnknownStreamsThrough(t *testing.T) {
+	result, _ := runMQTT(t, `{"drop": true}`, true, mqttPuback)
+	checkWire(t, result, mqttPuback)
+
+	encrypted := []byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\x00")
+	result, _ = runMQTT(t, `{"drop": true}`, false, encrypted, mqttPuback)
+	checkWire(t, result, encrypted, mqttPuback)
+}
@@ -0,0 +1,291 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// The MySQLToxic follows the packets a MySQL server sends to delay the query
+// responses, replace them with an error, or close the connection between two
+// queries, so that the failover of drivers can be tested without corrupting
+// the protocol. It is added to the downstream of a proxy in front of a server.
+// It follows the responses of text queries, it passes the connection through
+// from the first response it can't follow on, e.g. of a prepared statement,
+// or once the connection is encrypted.
+type MySQLToxic struct {
+	// Time in milliseconds each response is delayed by
+	Delay int64 `json:"delay"`
+	// Message of the error replacing each response, if set
+	Error string `json:"error"`
+	// Number of the error, 1105 (ER_UNKNOWN_ERROR) if not set
+	ErrorCode int `json:"error_code"`
+	// Close the connection once no query is running
+	Kill  bool      `json:"kill"`
+	Close CloseMode `json:"close"`
+}
+
+// States of the responses of a MySQL server.
+const (
+	mysqlHandshake  = iota // Until the authentication is done
+	mysqlIdle              // Between two responses
+	mysqlNext              // Before the next result of a response
+	mysqlColumns           // Column definitions of a result set
+	mysqlColumnsEnd        // The end of the column definitions, if any
+	mysqlRows              // Rows of a result set
+)
+
+// Status flag of the OK and EOF packets followed by another result.
+const mysqlMoreResults = 0x0008
+
+// A payload of the maximum size is continued by the next packet.
+const mysqlMaxPayload = 0xffffff
+
+// mysqlParser follows the packets of a MySQL server: a 3 bytes length and a
+// sequence id, a response starting with the sequence id 1.
+type mysqlParser struct {
+	state     int
+	columns   uint64 // Column definitions left
+	greeted   bool
+	continued bool   // The payload is continued by the next packet
+	first     []byte // Start of the payload of a continued packet
+	invalid   bool
+}
+
+func (p *mysqlParser) headerSize(first byte) int {
+	return 4
+}
+
+func (p *mysqlParser) payloadSize(header []byte) int {
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if p.state == mysqlHandshake && p.greeted && size > 1<<16 {
+		// The authentication packets are small, this is likely the
+		// handshake of an encrypted connection.
+		p.invalid = true
+		return -1
+	}
+	return size
+}
+
+func (p *mysqlParser) begins(header []byte) bool {
+	if header[3] != 1 {
+		// A response of a command that isn't followed.
+		p.invalid = true
+	}
+	return true
+}
+
+func (p *mysqlParser) ends(header, prefix []byte, size int) bool {
+	if p.continued {
+		p.continued = size == mysqlMaxPayload
+		if p.continued {
+			return false
+		}
+		prefix, size = p.first, mysqlMaxPayload+size
+	} else if size == mysqlMaxPayload {
+		p.continued = true
+		p.first = append(p.first[:0], prefix...)
+		return false
+	}
+	if len(prefix) == 0 {
+		p.state = mysqlIdle
+		p.invalid = true
+		return false
+	}
+
+	switch p.state {
+	case mysqlHandshake:
+		if !p.greeted {
+			p.greeted = true
+			return false
+		}
+		switch prefix[0] {
+		case 0x00, 0xff:
+			p.state = mysqlIdle
+			return true
+		case 0xfe, 0x01:
+			// Switching the authentication method, or more of it.
+			return false
+		}
+		p.invalid = true
+		return false
+	case mysqlIdle, mysqlNext:
+		switch prefix[0] {
+		case 0x00:
+			return p.endResult(mysqlOKStatus(prefix))
+		case 0xff:
+			return p.endResult(0)
+		case 0xfb:
+			// The client sends a local file, the server answers with an OK.
+			p.state = mysqlNext
+			return false
+		}
+		columns, ok := mysqlLength(prefix)
+		if !ok || columns == 0 {
+			p.invalid = true
+			return false
+		}
+		p.state = mysqlColumns
+		p.columns = columns
+		return false
+	case mysqlColumns:
+		p.columns--
+		if p.columns == 0 {
+			p.state = mysqlColumnsEnd
+		}
+		return false
+	case mysqlColumnsEnd:
+		p.state = mysqlRows
+		if mysqlEOF(prefix, size) {
+			return false
+		}
+		// Without EOF packets, the rows start right after the columns.
+		return p.endRows(prefix, size)
+	default:
+		return p.endRows(prefix, size)
+	}
+}
+
+// endRows parses a packet of the rows of a result set.
+func (p *mysqlParser) endRows(prefix []byte, size int) bool {
+	switch {
+	case mysqlEOF(prefix, size):
+		return p.endResult(mysqlEOFStatus(prefix))
+	case prefix[0] == 0xfe && size < mysqlMaxPayload:
+		// An OK packet ending the rows without EOF packets. A row starting
+		// with 0xfe is larger than a packet.
+		return p.endResult(mysqlOKStatus(prefix))
+	case prefix[0] == 0xff:
+		return p.endResult(0)
+	}
+	return false
+}
+
+// mysqlEOF reports whether the packet is an EOF packet, shorter than an OK
+// packet starting with 0xfe.
+func mysqlEOF(prefix []byte, size int) bool {
+	return prefix[0] == 0xfe && size == 5
+}
+
+// endResult ends a result with the status, and reports whether it was the
+// last one of its response.
+func (p *mysqlParser) endResult(status uint16) bool {
+	if status&mysqlMoreResults != 0 {
+		p.state = mysqlNext
+		return false
+	}
+	p.state = mysqlIdle
+	return true
+}
+
+func (p *mysqlParser) keeps(header []byte) bool {
+	return false
+}
+
+func (p *mysqlParser) synced() bool {
+	return !p.invalid
+}
+
+// mysqlLength returns the length-encoded integer at the start of data.
+func mysqlLength(data []byte) (uint64, bool) {
+	var size int
+	switch data[0] {
+	case 0xfc:
+		size = 2
+	case 0xfd:
+		size = 3
+	case 0xfe:
+		size = 8
+	case 0xfb, 0xff:
+		return 0, false
+	default:
+		return uint64(data[0]), true
+	}
+	if len(data) < size+1 {
+		return 0, false
+	}
+	value := make([]byte, 8)
+	copy(value, data[1:size+1])
+	return binary.LittleEndian.Uint64(value), true
+}
+
+// mysqlLengthSize returns the size of the length-encoded integer at the start
+// of data.
+func mysqlLengthSize(data []byte) int {
+	switch data[0] {
+	case 0xfc:
+		return 3
+	case 0xfd:
+		return 4
+	case 0xfe:
+		return 9
+	}
+	return 1
+}
+
+// mysqlOKStatus returns the status flags of an OK packet.
+func mysqlOKStatus(prefix []byte) uint16 {
+	pos := 1
+	for i := 0; i < 2 && pos < len(prefix); i++ {
+		// The affected rows and the last insert id.
+		pos += mysqlLengthSize(prefix[pos:])
+	}
+	if pos+2 > len(prefix) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(prefix[pos:])
+}
+
+// mysqlEOFStatus returns the status flags of an EOF packet.
+func mysqlEOFStatus(prefix []byte) uint16 {
+	if len(prefix) < 5 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(prefix[3:])
+}
+
+// errorPacket returns an ERR packet answering a command.
+func (t *MySQLToxic) errorPacket() []byte {
+	code := t.ErrorCode
+	if code == 0 {
+		code = 1105
+	}
+	payload := []byte{0xff}
+	payload = binary.LittleEndian.AppendUint16(payload, uint16(code))
+	payload = append(payload, "#HY000"...)
+	payload = append(payload, t.Error...)
+
+	size := len(payload)
+	packet := []byte{byte(size), byte(size >> 8), byte(size >> 16), 1}
+	return append(packet, payload...)
+}
+
+func (t *MySQLToxic) Pipe(stub *ToxicStub) {
+	actions := wireActions{
+		delay: time.Duration(t.Delay) * time.Millisecond,
+		kill:  t.Kill,
+		close: t.Close,
+	}
+	if t.Error != "" {
+		actions.failure = t.errorPacket()
+	}
+	pipeWire(stub, stub.State.(*wireState), actions)
+}
+
+func (t *MySQLToxic) Cleanup(stub *ToxicStub) {
+	cleanupWire(stub, stub.State.(*wireState))
+}
+
+func (t *MySQLToxic) NewState() interface{} {
+	return newWireState(new(mysqlParser))
+}
+
+func (t *MySQLToxic) Validate() error {
+	return firstError(
+		nonNegative("delay", t.Delay),
+		inRange("error_code", t.ErrorCode, 0, 65535),
+	)
+}
+
+func init() {
+	Register("mysql", new(MySQLToxic))
+}
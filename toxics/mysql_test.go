@@ -0,0 +1,86 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// mysqlPacket returns a packet of a MySQL server.
+func mysqlPacket(seq byte, payload string) []byte {
+	size := len(payload)
+	return append([]byte{byte(size), byte(size >> 8), byte(size >> 16), seq}, payload...)
+}
+
+// mysqlPackets returns the packets of a response, starting with the sequence
+// id 1.
+func mysqlPackets(payloads ...string) []byte {
+	var packets []byte
+	for i, payload := range payloads {
+		packets = append(packets, mysqlPacket(byte(i+1), payload)...)
+	}
+	return packets
+}
+
+var (
+	mysqlGreeting = mysqlPacket(0, "\x0a8.0.36\x00\x01\x00\x00\x00abcdefgh\x00\xff\xff")
+	mysqlStartup  = append(mysqlGreeting, mysqlPacket(2, "\x00\x00\x00\x02\x00\x00\x00")...)
+	mysqlColumn   = "\x03def\x00\x00\x00\x02id\x00\x0c\x3f\x00\x0b\x00\x00\x00\x08\x00\x00\x00\x00\x00"
+	// A result set with EOF packets, and one without.
+	mysqlResult = mysqlPackets("\x01", mysqlColumn, "\xfe\x00\x00\x02\x00", "\x011",
+		"\xfe\x00\x00\x02\x00")
+	mysqlResultNoEOF   = mysqlPackets("\x01", mysqlColumn, "\x011", "\xfe\x00\x00\x02\x00\x00\x00")
+	mysqlMultiResult   = mysqlPackets("\x00\x01\x00\x0a\x00\x00\x00", "\x00\x01\x00\x02\x00\x00\x00")
+	mysqlErrorResponse = mysqlPacket(1, "\xff\x51\x04#HY000boom")
+)
+
+func TestMySQLToxicReplacesResponsesWithAnError(t *testing.T) {
+	toxic := &toxics.MySQLToxic{Error: "boom", ErrorCode: 1105}
+	for _, response := range [][]byte{mysqlResult, mysqlResultNoEOF, mysqlMultiResult} {
+		// The response is split in the middle of a packet.
+		result, closes := runWire(t, toxic, false,
+			mysqlStartup, response[:6], response[6:], mysqlResult)
+		checkWire(t, result, mysqlStartup, mysqlErrorResponse, mysqlErrorResponse)
+		if closes != 0 {
+			t.Error("Expected the connection to stay open")
+		}
+	}
+}
+
+func TestMySQLToxicDelaysResponses(t *testing.T) {
+	toxic := &toxics.MySQLToxic{Delay: 50}
+	start := time.Now()
+	result, _ := runWire(t, toxic, false, mysqlStartup, mysqlResultNoEOF, mysqlMultiResult)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected both responses to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, mysqlStartup, mysqlResultNoEOF, mysqlMultiResult)
+}
+
+func TestMySQLToxicKillsBetweenQueries(t *testing.T) {
+	toxic := &toxics.MySQLToxic{Kill: true}
+	result, closes := runWire(t, toxic, false, mysqlStartup[:10], mysqlStartup[10:], mysqlResult)
+	checkWire(t, result, mysqlStartup)
+	if closes != 1 {
+		t.Error("Expected the connection to be closed once it was ready")
+	}
+}
+
+func TestMySQLToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.MySQLToxic{Error: "boom"}
+	result, _ := runWire(t, toxic, true, mysqlResult)
+	checkWire(t, result, mysqlResult)
+
+	// The response of a prepared statement looks like an OK packet followed
+	// by packets out of sequence.
+	prepared := mysqlPackets("\x00\x01\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00",
+		mysqlColumn, "\xfe\x00\x00\x02\x00")
+	result, _ = runWire(t, toxic, false, mysqlStartup, prepared, mysqlResult)
+	checkWire(t, result, mysqlStartup, mysqlErrorResponse, prepared[16:], mysqlResult)
+
+	// The handshake of TLS follows the greeting.
+	encrypted := []byte("\x16\x03\x03\x00\x7a\x02\x00\x00\x76")
+	result, _ = runWire(t, toxic, false, mysqlGreeting, encrypted, mysqlResult)
+	checkWire(t, result, mysqlGreeting, encrypted, mysqlResult)
+}
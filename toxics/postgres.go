@@ -0,0 +1,128 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// The PostgresToxic follows the messages a PostgreSQL server sends to delay
+// the query responses, replace them with an error, or close the connection
+// between two queries, so that the failover of drivers can be tested without
+// corrupting the protocol. It is added to the downstream of a proxy in front
+// of a server, and passes encrypted connections through.
+type PostgresToxic struct {
+	// Time in milliseconds each response is delayed by
+	Delay int64 `json:"delay"`
+	// Message of the error replacing each response, if set
+	Error string `json:"error"`
+	// SQLSTATE code of the error, XX000 (internal_error) if not set
+	SQLState string `json:"sqlstate"`
+	// Close the connection once no query is running
+	Kill  bool      `json:"kill"`
+	Close CloseMode `json:"close"`
+}
+
+// postgresParser follows the messages of a PostgreSQL server: a type byte and
+// a length counting itself, a response ending with ReadyForQuery.
+type postgresParser struct {
+	started   bool
+	encrypted bool
+	invalid   bool
+}
+
+func (p *postgresParser) headerSize(first byte) int {
+	if !p.started {
+		p.started = true
+		switch first {
+		case 'N':
+			// The single byte refusing encryption requested by the client.
+			return 1
+		case 'S', 'G':
+			p.encrypted = true
+		}
+	}
+	return 5
+}
+
+func (p *postgresParser) payloadSize(header []byte) int {
+	if len(header) == 1 {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 {
+		p.invalid = true
+		return -1
+	}
+	return length - 4
+}
+
+func (p *postgresParser) begins(header []byte) bool {
+	switch header[0] {
+	case 'A', 'N', 'S':
+		// Notifications, notices and parameters are sent at any time.
+		return false
+	}
+	return true
+}
+
+func (p *postgresParser) ends(header, prefix []byte, size int) bool {
+	return len(header) == 5 && header[0] == 'Z'
+}
+
+func (p *postgresParser) keeps(header []byte) bool {
+	return header[0] == 'Z'
+}
+
+func (p *postgresParser) synced() bool {
+	return !p.encrypted && !p.invalid
+}
+
+// errorResponse returns an ErrorResponse message.
+func (t *PostgresToxic) errorResponse() []byte {
+	code := t.SQLState
+	if code == "" {
+		code = "XX000"
+	}
+	var fields []byte
+	for _, field := range []struct {
+		kind  byte
+		value string
+	}{{'S', "ERROR"}, {'V', "ERROR"}, {'C', code}, {'M', t.Error}} {
+		fields = append(fields, field.kind)
+		fields = append(fields, field.value...)
+		fields = append(fields, 0)
+	}
+	fields = append(fields, 0)
+
+	message := []byte{'E'}
+	message = binary.BigEndian.AppendUint32(message, uint32(len(fields)+4))
+	return append(message, fields...)
+}
+
+func (t *PostgresToxic) Pipe(stub *ToxicStub) {
+	actions := wireActions{
+		delay: time.Duration(t.Delay) * time.Millisecond,
+		kill:  t.Kill,
+		close: t.Close,
+	}
+	if t.Error != "" {
+		actions.failure = t.errorResponse()
+	}
+	pipeWire(stub, stub.State.(*wireState), actions)
+}
+
+func (t *PostgresToxic) Cleanup(stub *ToxicStub) {
+	cleanupWire(stub, stub.State.(*wireState))
+}
+
+func (t *PostgresToxic) NewState() interface{} {
+	return newWireState(new(postgresParser))
+}
+
+func (t *PostgresToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
+func init() {
+	Register("postgres", new(PostgresToxic))
+}
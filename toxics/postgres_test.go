@@ -0,0 +1,82 @@
+package toxics_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// pgMessage returns a message of a PostgreSQL server.
+func pgMessage(kind byte, payload string) []byte {
+	message := binary.BigEndian.AppendUint32([]byte{kind}, uint32(len(payload)+4))
+	return append(message, payload...)
+}
+
+var (
+	pgStartup = append(append(append(
+		pgMessage('R', "\x00\x00\x00\x00"),
+		pgMessage('S', "TimeZone\x00UTC\x00")...),
+		pgMessage('K', "\x00\x00\x00\x01\x00\x00\x00\x02")...),
+		pgMessage('Z', "I")...)
+	pgResponse = append(append(append(
+		pgMessage('T', "\x00\x01id\x00\x00\x00\x00\x00\x00\x00"+
+			"\x00\x00\x17\x00\x04\xff\xff\xff\xff\x00\x00"),
+		pgMessage('D', "\x00\x01\x00\x00\x00\x011")...),
+		pgMessage('C', "SELECT 1\x00")...),
+		pgMessage('Z', "I")...)
+)
+
+func TestPostgresToxicReplacesResponsesWithAnError(t *testing.T) {
+	toxic := &toxics.PostgresToxic{Error: "boom", SQLState: "57P01"}
+	// The response is split in the middle of a message.
+	result, closes := runWire(t, toxic, false, pgStartup, pgResponse[:10], pgResponse[10:])
+	checkWire(t, result, pgStartup,
+		pgMessage('E', "SERROR\x00VERROR\x00C57P01\x00Mboom\x00\x00"), pgMessage('Z', "I"))
+	if closes != 0 {
+		t.Error("Expected the connection to stay open")
+	}
+}
+
+func TestPostgresToxicDelaysResponses(t *testing.T) {
+	toxic := &toxics.PostgresToxic{Delay: 50}
+	start := time.Now()
+	result, _ := runWire(t, toxic, false, pgStartup)
+	if time.Since(start) > 40*time.Millisecond {
+		t.Error("Expected the startup not to be delayed")
+	}
+	checkWire(t, result, pgStartup)
+
+	start = time.Now()
+	result, _ = runWire(t, toxic, false, pgStartup, pgResponse, pgResponse)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected both responses to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, pgStartup, pgResponse, pgResponse)
+}
+
+func TestPostgresToxicKillsBetweenQueries(t *testing.T) {
+	toxic := &toxics.PostgresToxic{Kill: true}
+	// The startup is not cut, the next response is not sent.
+	result, closes := runWire(t, toxic, false, pgStartup[:10], append(pgStartup[10:], pgResponse...))
+	checkWire(t, result, pgStartup)
+	if closes != 1 {
+		t.Error("Expected the connection to be closed once it was ready")
+	}
+}
+
+func TestPostgresToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.PostgresToxic{Error: "boom"}
+	result, _ := runWire(t, toxic, true, pgResponse)
+	checkWire(t, result, pgResponse)
+
+	encrypted := []byte("S\x16\x03\x03\x00\x7a\x02\x00\x00\x76")
+	result, _ = runWire(t, toxic, false, encrypted, pgResponse)
+	checkWire(t, result, encrypted, pgResponse)
+
+	refused := []byte("N")
+	result, _ = runWire(t, toxic, false, refused, pgStartup, pgResponse)
+	checkWire(t, result, refused, pgStartup,
+		pgMessage('E', "SERROR\x00VERROR\x00CXX000\x00Mboom\x00\x00"), pgMessage('Z', "I"))
+}
@@ -0,0 +1,175 @@
+package toxics
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// LatencyHistogram is a cumulative histogram of measured latencies, like the
+// delays of the stats of a toxic or a Prometheus histogram exported from
+// production. The latencies of the +Inf overflow bucket have no bound to be
+// drawn from, and are left out.
+type LatencyHistogram []DelayBucket
+
+func (h *LatencyHistogram) UnmarshalJSON(data []byte) error {
+	var buckets []DelayBucket
+	err := json.Unmarshal(data, &buckets)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for i, bucket := range buckets {
+		if bucket.LeMs < 0 || bucket.Count < 0 ||
+			(i > 0 && (bucket.LeMs <= buckets[i-1].LeMs || bucket.Count < buckets[i-1].Count)) {
+			return &json.UnmarshalTypeError{
+				Value: "array of negative, unsorted or non-cumulative buckets",
+				Type:  reflect.TypeOf(*h),
+			}
+		}
+		if !math.IsInf(bucket.LeMs, 1) {
+			total = bucket.Count
+		}
+	}
+	if len(buckets) > 0 && total == 0 {
+		return &json.UnmarshalTypeError{Value: "array of empty buckets", Type: reflect.TypeOf(*h)}
+	}
+	*h = buckets
+	return nil
+}
+
+// draw returns a latency with the distribution of the histogram, uniform
+// within its bucket.
+func (h LatencyHistogram) draw(r *rand.Rand) float64 {
+	finite := h
+	if last := len(h) - 1; math.IsInf(h[last].LeMs, 1) {
+		finite = h[:last]
+	}
+	roll := r.Int63n(finite[len(finite)-1].Count)
+	low := 0.0
+	for _, bucket := range finite {
+		if roll < bucket.Count {
+			return low + r.Float64()*(bucket.LeMs-low)
+		}
+		low = bucket.LeMs
+	}
+	return low
+}
+
+// LatencySeries is a time series of measured latencies in milliseconds.
+type LatencySeries []float64
+
+func (s *LatencySeries) UnmarshalJSON(data []byte) error {
+	var latencies []float64
+	err := json.Unmarshal(data, &latencies)
+	if err != nil {
+		return err
+	}
+	for _, latency := range latencies {
+		if latency < 0 {
+			return &json.UnmarshalTypeError{
+				Value: "array of negative latencies",
+				Type:  reflect.TypeOf(*s),
+			}
+		}
+	}
+	*s = latencies
+	return nil
+}
+
+// at returns the latency of the series at a time, the series looping from
+// the Unix epoch with step between two values, interpolated between them.
+func (s LatencySeries) at(now time.Time, step time.Duration) float64 {
+	position := now.UnixNano() % (int64(step) * int64(len(s)))
+	i := position / int64(step)
+	next := s[(i+1)%int64(len(s))]
+	progress := float64(position%int64(step)) / float64(step)
+	return s[i] + (next-s[i])*progress
+}
+
+// The ProfileToxic passes data through with the delays of real measurements:
+// drawn from a histogram of latencies for each chunk, or following a time
+// series of latencies over time.
+type ProfileToxic struct {
+	Histogram LatencyHistogram `json:"histogram"`
+	Series    LatencySeries    `json:"series"`
+	// Time in milliseconds between two values of the series
+	Step int64 `json:"step"`
+}
+
+func (t *ProfileToxic) UnmarshalJSON(data []byte) error {
+	// Decoded into a copy, so that an update is applied only if it's valid.
+	type profile ProfileToxic
+	updated := profile(*t)
+	err := json.Unmarshal(data, &updated)
+	if err != nil {
+		return err
+	}
+	if len(updated.Histogram) > 0 && len(updated.Series) > 0 {
+		return &json.UnmarshalTypeError{
+			Value: "object with both a histogram and a series",
+			Type:  reflect.TypeOf(*t),
+		}
+	}
+	if updated.Step < 0 {
+		return &json.UnmarshalTypeError{Value: "negative step", Type: reflect.TypeOf(*t)}
+	}
+	*t = ProfileToxic(updated)
+	return nil
+}
+
+func (t *ProfileToxic) GetBufferSize() int {
+	return 1024
+}
+
+func (t *ProfileToxic) delay(stub *ToxicStub, now time.Time) time.Duration {
+	var delay float64
+	switch {
+	case len(t.Histogram) > 0:
+		delay = t.Histogram.draw(stub.Rand())
+	case len(t.Series) > 0:
+		step := time.Duration(t.Step) * time.Millisecond
+		if step == 0 {
+			step = time.Second
+		}
+		delay = t.Series.at(now, step)
+	}
+	return time.Duration(delay * float64(time.Millisecond))
+}
+
+func (t *ProfileToxic) Pipe(stub *ToxicStub) {
+	// Woken up by the shared timer wheel, like the latency toxic.
+	wake := make(chan struct{}, 1)
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			deadline := c.Timestamp.Add(t.delay(stub, c.Timestamp))
+			sleep := time.Until(deadline)
+			if sleep > 0 {
+				latencyWheel.schedule(deadline, wake)
+				select {
+				case <-wake:
+				case <-stub.Interrupt:
+					stub.Output <- c // Don't drop any data on the floor
+					return
+				}
+			}
+			c.Timestamp = c.Timestamp.Add(sleep)
+			stub.Stats.AddChunk(len(c.Data))
+			stub.Stats.AddDelay(max(sleep, 0))
+			stub.Output <- c
+		}
+	}
+}
+
+func init() {
+	Register("profile", new(ProfileToxic))
+}
@@ -0,0 +1,106 @@
+package toxics_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// profileDelays passes chunks through a profile toxic, and returns the delay
+// of each.
+func profileDelays(t *testing.T, toxic *toxics.ProfileToxic, chunks int) []time.Duration {
+	t.Helper()
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.Stats = toxics.NewToxicStats()
+
+	go toxic.Pipe(stub)
+	defer close(input)
+
+	delays := make([]time.Duration, chunks)
+	for i := range delays {
+		sent := time.Now()
+		input <- &stream.StreamChunk{Data: []byte("hello"), Timestamp: sent}
+		select {
+		case <-output:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for the chunk")
+		}
+		delays[i] = time.Since(sent)
+	}
+	return delays
+}
+
+func TestProfileToxicDrawsFromItsHistogram(t *testing.T) {
+	// The +Inf overflow bucket has no bound to draw from.
+	toxic := new(toxics.ProfileToxic)
+	err := json.Unmarshal([]byte(`{"histogram": [
+		{"le_ms": 20, "count": 0},
+		{"le_ms": 40, "count": 3},
+		{"le_ms": "+Inf", "count": 100}
+	]}`), toxic)
+	if err != nil {
+		t.Fatal("Unable to read histogram:", err)
+	}
+
+	for _, delay := range profileDelays(t, toxic, 10) {
+		if delay < 20*time.Millisecond || delay > 70*time.Millisecond {
+			t.Errorf("Expected a delay in the bucket of 20 to 40ms, got %s", delay)
+		}
+	}
+}
+
+func TestProfileToxicFollowsItsSeries(t *testing.T) {
+	toxic := &toxics.ProfileToxic{Series: toxics.LatencySeries{30, 30, 30}, Step: 10}
+
+	for _, delay := range profileDelays(t, toxic, 5) {
+		if delay < 30*time.Millisecond || delay > 60*time.Millisecond {
+			t.Errorf("Expected a delay of 30ms, got %s", delay)
+		}
+	}
+}
+
+func TestProfileToxicRejectsInvalidMeasurements(t *testing.T) {
+	for _, attributes := range []string{
+		`{"histogram": [{"le_ms": 20, "count": 1}, {"le_ms": 10, "count": 1}]}`,
+		`{"histogram": [{"le_ms": 10, "count": 2}, {"le_ms": 20, "count": 1}]}`,
+		`{"histogram": [{"le_ms": 10, "count": -1}]}`,
+		`{"histogram": [{"le_ms": 10, "count": 0}, {"le_ms": "+Inf", "count": 1}]}`,
+		`{"series": [10, -5]}`,
+		`{"series": [10], "step": -1}`,
+		`{"series": [10], "histogram": [{"le_ms": 10, "count": 1}]}`,
+	} {
+		toxic := new(toxics.ProfileToxic)
+		err := json.Unmarshal([]byte(attributes), toxic)
+		if err == nil {
+			t.Errorf("Expected %s to be invalid", attributes)
+		}
+	}
+}
+
+func TestProfileToxicKeepsItsMeasurementsOnInvalidUpdate(t *testing.T) {
+	proxy := NewTestProxy("test", "localhost:20000")
+	_, err := proxy.Toxics.AddToxicJson(strings.NewReader(
+		`{"type": "profile", "attributes": {"series": [10, 20]}}`,
+	))
+	if err != nil {
+		t.Fatal("Unable to add toxic:", err)
+	}
+
+	_, err = proxy.Toxics.UpdateToxicJson("profile_downstream", strings.NewReader(
+		`{"attributes": {"histogram": [{"le_ms": 10, "count": 1}]}}`,
+	))
+	if err == nil {
+		t.Fatal("Expected a histogram and a series to be invalid")
+	}
+
+	toxic := proxy.Toxics.GetToxic("profile_downstream").Toxic.(*toxics.ProfileToxic)
+	if len(toxic.Series) != 2 || len(toxic.Histogram) != 0 {
+		t.Errorf("Expected the toxic to be unchanged, got %+v", toxic)
+	}
+}
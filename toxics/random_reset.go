@@ -0,0 +1,121 @@
+package toxics
+
+import (
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// The RandomResetToxic resets the connection at a point of the stream drawn
+// for each connection, after a number of bytes or a time within ranges, to
+// test the handling of a connection lost at unpredictable points rather than
+// at a fixed limit. The first of the two points reached resets it. The ranges
+// of 0 are not drawn, and the connection is reset with its first data if
+// neither is set. The points are drawn from the seed of the toxic.
+type RandomResetToxic struct {
+	// Bytes transmitted before the reset
+	MinBytes int64 `json:"min_bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	// Times in milliseconds since the toxic started on the connection
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+	// How the connection is closed, with a RST by default.
+	Close CloseMode `json:"close"`
+}
+
+type RandomResetToxicState struct {
+	drawn            bool
+	offset           int64 // Negative if the bytes are not drawn
+	deadline         time.Time
+	bytesTransmitted int64
+}
+
+// drawBetween returns a random value from low to high, low if high is lower.
+func drawBetween(stub *ToxicStub, low, high int64) int64 {
+	if high <= low {
+		return low
+	}
+	return low + stub.Rand().Int63n(high-low+1)
+}
+
+// draw sets the points of the reset of the connection of the stub, once.
+func (t *RandomResetToxic) draw(stub *ToxicStub, state *RandomResetToxicState) {
+	state.drawn = true
+	state.offset = -1
+	if t.MaxBytes > 0 || t.MaxTime <= 0 {
+		state.offset = drawBetween(stub, max(t.MinBytes, 0), t.MaxBytes)
+	}
+	if t.MaxTime > 0 {
+		delay := drawBetween(stub, max(t.MinTime, 0), t.MaxTime)
+		state.deadline = time.Now().Add(time.Duration(delay) * time.Millisecond)
+	}
+}
+
+func (t *RandomResetToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*RandomResetToxicState)
+	if !state.drawn {
+		t.draw(stub, state)
+	}
+
+	var deadline <-chan time.Time
+	if !state.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(state.deadline))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case <-deadline:
+			t.reset(stub)
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+
+			if state.offset >= 0 && state.bytesTransmitted+int64(len(c.Data)) >= state.offset {
+				// The data up to the offset is sent before the reset.
+				if n := state.offset - state.bytesTransmitted; n > 0 {
+					stub.Output <- &stream.StreamChunk{Data: c.Data[:n], Timestamp: c.Timestamp}
+					state.bytesTransmitted += n
+				}
+				t.reset(stub)
+				return
+			}
+			stub.Output <- c
+			state.bytesTransmitted += int64(len(c.Data))
+		}
+	}
+}
+
+func (t *RandomResetToxic) reset(stub *ToxicStub) {
+	stub.Stats.AddClose()
+	if t.Close == CloseFIN {
+		stub.Close()
+	} else {
+		stub.Reset()
+	}
+}
+
+func (t *RandomResetToxic) NewState() interface{} {
+	return new(RandomResetToxicState)
+}
+
+func (t *RandomResetToxic) Validate() error {
+	return firstError(
+		nonNegative("min_bytes", t.MinBytes),
+		nonNegative("max_bytes", t.MaxBytes),
+		nonNegative("min_time", t.MinTime),
+		nonNegative("max_time", t.MaxTime),
+		notAbove("min_bytes", t.MinBytes, t.MaxBytes, "max_bytes"),
+		notAbove("min_time", t.MinTime, t.MaxTime, "max_time"),
+	)
+}
+
+func init() {
+	Register("random_reset", new(RandomResetToxic))
+}
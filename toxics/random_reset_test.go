@@ -0,0 +1,106 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// resetOffset runs a random_reset toxic of seed over chunks of 10 bytes, and
+// returns the number of bytes sent before the reset and whether it reset.
+func resetOffset(t *testing.T, toxic *toxics.RandomResetToxic, seed int64) (int, bool) {
+	input := make(chan *stream.StreamChunk, 100)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	stub.SetSeed(seed)
+	reset := false
+	stub.OnReset = func() { reset = true }
+
+	for i := 0; i < 100; i++ {
+		input <- &stream.StreamChunk{Data: make([]byte, 10)}
+	}
+	done := make(chan struct{})
+	go func() {
+		toxic.Pipe(stub)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the toxic to reset the connection")
+	}
+
+	sent := 0
+	for c := range output {
+		sent += len(c.Data)
+	}
+	return sent, reset
+}
+
+func TestRandomResetToxicResetsWithinTheByteRange(t *testing.T) {
+	toxic := &toxics.RandomResetToxic{MinBytes: 15, MaxBytes: 500}
+
+	offsets := map[int]bool{}
+	for seed := int64(1); seed <= 20; seed++ {
+		sent, reset := resetOffset(t, toxic, seed)
+		if !reset {
+			t.Fatal("Expected the connection to be reset")
+		}
+		if sent < 15 || sent > 500 {
+			t.Fatalf("Expected the reset between 15 and 500 bytes, got %d", sent)
+		}
+		if again, _ := resetOffset(t, toxic, seed); again != sent {
+			t.Fatalf("Expected the same offset for seed %d, got %d and %d", seed, sent, again)
+		}
+		offsets[sent] = true
+	}
+	if len(offsets) < 2 {
+		t.Errorf("Expected the offsets to vary with the seed, got %v", offsets)
+	}
+}
+
+func TestRandomResetToxicClosesGracefullyWithFin(t *testing.T) {
+	toxic := &toxics.RandomResetToxic{MinBytes: 25, MaxBytes: 25, Close: toxics.CloseFIN}
+
+	sent, reset := resetOffset(t, toxic, 1)
+	if reset {
+		t.Error("Expected the connection to be closed without a reset")
+	}
+	if sent != 25 {
+		t.Errorf("Expected the close after exactly 25 bytes, got %d", sent)
+	}
+}
+
+func TestRandomResetToxicResetsWithinTheTimeRange(t *testing.T) {
+	toxic := &toxics.RandomResetToxic{MinTime: 50, MaxTime: 100}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	reset := make(chan struct{})
+	stub.OnReset = func() { close(reset) }
+
+	start := time.Now()
+	go toxic.Pipe(stub)
+	// The data passes until the reset, whatever its amount.
+	input <- &stream.StreamChunk{Data: make([]byte, 1<<20)}
+	<-output
+
+	select {
+	case <-reset:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be reset")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the reset after 50ms at least, got %s", elapsed)
+	}
+	if counters := stub.Stats.Counters(); counters.Closes != 1 {
+		t.Errorf("Expected the reset to be counted, got %+v", counters)
+	}
+}
@@ -0,0 +1,194 @@
+package toxics
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// replyMaxLine is the size of a line after which the data is passed through,
+// as it is likely not a line protocol.
+const replyMaxLine = 64 << 10
+
+// A line starting a multiline reply of SMTP or FTP, e.g. "250-PIPELINING".
+var replyContinued = regexp.MustCompile(`^\d{3}-`)
+
+// The ReplyToxic follows the replies of a line protocol, e.g. SMTP, IMAP, POP3
+// or FTP, to delay or replace the ones matching its pattern, e.g. to turn a
+// "250 OK" into a "451 try again later" so that the retries of mail clients
+// can be tested. The lines of a multiline reply, e.g. "250-PIPELINING", make a
+// single reply.
+type ReplyToxic struct {
+	// Regular expression matched against each reply, without its line ending
+	Pattern Pattern `json:"pattern"`
+	// Reply replacing the ones matching, with $1 for the first group, if set
+	Replace string `json:"replace"`
+	// Time in milliseconds the replies matching are delayed by
+	Delay int64 `json:"delay"`
+	// Fraction of the replies matching that are affected, all of them if 0
+	Probability float32 `json:"probability"`
+}
+
+type ReplyToxicState struct {
+	started  bool
+	skipping bool   // The start of the current line was missed
+	lost     bool   // The data passes through once it isn't text anymore
+	line     []byte // Start of the next line
+	reply    []byte // Lines of the current multiline reply
+}
+
+// replyText reports whether the data can be a line of text.
+func replyText(data []byte) bool {
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\r' && b != '\n' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *ReplyToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*ReplyToxicState)
+	if !state.started {
+		state.started = true
+		// The line a late toxic starts in is sent as is.
+		state.skipping = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				t.Cleanup(stub)
+				stub.Close()
+				return
+			}
+			if t.run(stub, state, c) {
+				return
+			}
+		}
+	}
+}
+
+// run sends the replies of the chunk, and reports whether the toxic was
+// interrupted.
+func (t *ReplyToxic) run(stub *ToxicStub, state *ReplyToxicState, c *stream.StreamChunk) bool {
+	data := c.Data
+	interrupted := false
+	var out []byte
+	flush := func() {
+		if len(out) > 0 {
+			stub.Output <- &stream.StreamChunk{Data: out, Timestamp: c.Timestamp}
+			out = nil
+		}
+	}
+	defer flush()
+
+	for len(data) > 0 {
+		if state.lost {
+			out = append(out, data...)
+			return interrupted
+		}
+
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		data = data[end:]
+		if state.skipping {
+			out = append(out, line...)
+			state.skipping = line[len(line)-1] != '\n'
+			continue
+		}
+		if !replyText(line) || len(state.line)+len(line) > replyMaxLine {
+			state.lost = true
+			out = append(append(append(out, state.reply...), state.line...), line...)
+			state.reply, state.line = nil, nil
+			continue
+		}
+
+		state.line = append(state.line, line...)
+		if line[len(line)-1] != '\n' {
+			continue
+		}
+		state.reply = append(state.reply, state.line...)
+		continued := replyContinued.Match(state.line)
+		state.line = nil
+		if continued {
+			continue
+		}
+
+		reply := state.reply
+		state.reply = nil
+		out = append(out, t.apply(stub, reply, flush, &interrupted)...)
+	}
+	return interrupted
+}
+
+// apply applies the toxic to a whole reply and returns it. The reply is not
+// delayed once the toxic was interrupted.
+func (t *ReplyToxic) apply(stub *ToxicStub, reply []byte, flush func(), interrupted *bool) []byte {
+	if t.Pattern.Regexp == nil {
+		return reply
+	}
+	text := bytes.TrimSuffix(reply, []byte("\n"))
+	ending := []byte("\n")
+	if bytes.HasSuffix(text, []byte("\r")) {
+		text = text[:len(text)-1]
+		ending = []byte("\r\n")
+	}
+	match := t.Pattern.FindSubmatchIndex(text)
+	if match == nil || t.Probability > 0 && stub.Rand().Float32() >= t.Probability {
+		return reply
+	}
+
+	stub.Stats.AddChunk(len(reply))
+	if t.Replace != "" {
+		reply = append(t.Pattern.Expand(nil, []byte(t.Replace), text, match), ending...)
+	}
+	if t.Delay > 0 && !*interrupted {
+		flush()
+		delay := time.Duration(t.Delay) * time.Millisecond
+		select {
+		case <-time.After(delay):
+			stub.Stats.AddDelay(delay)
+		case <-stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			*interrupted = true
+		}
+	}
+	return reply
+}
+
+// Cleanup sends the start of the reply held once the toxic is removed.
+func (t *ReplyToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*ReplyToxicState)
+	if len(state.reply)+len(state.line) > 0 {
+		stub.Output <- &stream.StreamChunk{
+			Data:      append(state.reply, state.line...),
+			Timestamp: time.Now(),
+		}
+		state.reply, state.line = nil, nil
+	}
+}
+
+func (t *ReplyToxic) NewState() interface{} {
+	return new(ReplyToxicState)
+}
+
+func (t *ReplyToxic) Validate() error {
+	return firstError(
+		required("pattern", t.Pattern.Regexp != nil),
+		nonNegative("delay", t.Delay),
+		inRange("probability", t.Probability, 0, 1),
+	)
+}
+
+func init() {
+	Register("reply", new(ReplyToxic))
+}
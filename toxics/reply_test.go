@@ -0,0 +1,80 @@
+package toxics_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func runReply(t *testing.T, attrs string, setup func(*toxics.ToxicStub), chunks ...string) string {
+	t.Helper()
+	toxic := new(toxics.ReplyToxic)
+	err := json.Unmarshal([]byte(attrs), toxic)
+	if err != nil {
+		t.Fatal("Failed to parse the attributes:", err)
+	}
+	data := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		data[i] = []byte(chunk)
+	}
+	result, _ := runStub(t, toxic, setup, data...)
+	return string(result)
+}
+
+func TestReplyToxicReplacesReplies(t *testing.T) {
+	none := func(*toxics.ToxicStub) {}
+	result := runReply(t, `{"pattern": "^250 OK$", "replace": "451 try again later"}`, none,
+		"220 hello\r\n250-PIPELINING\r\n250 OK\r\n", "25", "0 OK\r", "\n250 OK\n")
+	expected := "220 hello\r\n250-PIPELINING\r\n250 OK\r\n451 try again later\r\n451 try again later\n"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	result = runReply(t, `{"pattern": "^(a\\d) OK (.*)", "replace": "$1 NO $2"}`, none,
+		"* 1 EXISTS\r\na1 OK done\r\n")
+	if expected := "* 1 EXISTS\r\na1 NO done\r\n"; result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestReplyToxicAffectsAFractionOfReplies(t *testing.T) {
+	seeded := func(stub *toxics.ToxicStub) { stub.SetSeed(1) }
+	result := runReply(t, `{"pattern": "^250", "replace": "451 later", "probability": 0.5}`,
+		seeded, strings.Repeat("250 OK\r\n", 100))
+	if replaced := strings.Count(result, "451 later"); replaced < 25 || replaced > 75 {
+		t.Errorf("Expected about half of the replies to be replaced, got %d", replaced)
+	}
+	if strings.Count(result, "\r\n") != 100 {
+		t.Errorf("Expected all the replies to be sent, got %q", result)
+	}
+}
+
+func TestReplyToxicDelaysReplies(t *testing.T) {
+	start := time.Now()
+	result := runReply(t, `{"pattern": "^354", "delay": 50}`, func(*toxics.ToxicStub) {},
+		"250 OK\r\n354 go ahead\r\n")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the reply to be delayed, took %s", elapsed)
+	}
+	if result != "250 OK\r\n354 go ahead\r\n" {
+		t.Errorf("Expected the replies to be sent as is, got %q", result)
+	}
+}
+
+func TestReplyToxicPassesUnknownStreamsThrough(t *testing.T) {
+	attrs := `{"pattern": "^250", "replace": "451 later"}`
+	late := func(stub *toxics.ToxicStub) { stub.Late = true }
+	result := runReply(t, attrs, late, "0 OK\r\n250 OK\r\n")
+	if result != "0 OK\r\n451 later\r\n" {
+		t.Errorf("Expected the line started to be sent as is, got %q", result)
+	}
+
+	encrypted := "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\x00"
+	result = runReply(t, attrs, func(*toxics.ToxicStub) {}, "220 ready\r\n"+encrypted, "250 OK\r\n")
+	if result != "220 ready\r\n"+encrypted+"250 OK\r\n" {
+		t.Errorf("Expected the data after STARTTLS to be passed through, got %q", result)
+	}
+}
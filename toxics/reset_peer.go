@@ -6,7 +6,7 @@ import (
 
 /*
 The ResetToxic sends closes the connection abruptly after a timeout (in ms).
-The behavior of Close is set to discard any unsent/unacknowledged data by setting SetLinger to 0,
+The link of the stub discards any unsent/unacknowledged data by setting SetLinger to 0,
 ~= sets TCP RST flag and resets the connection.
 If the timeout is set to 0, then the connection will be reset immediately.
 
@@ -16,6 +16,9 @@ Drop data since it will initiate a graceful close by sending the FIN/ACK. (io.EO
 type ResetToxic struct {
 	// Timeout in milliseconds
 	Timeout int64 `json:"timeout"`
+	// How the connection is closed, with a RST by default. A FIN closes it
+	// gracefully after the timeout instead.
+	Close CloseMode `json:"close"`
 }
 
 func (t *ResetToxic) Pipe(stub *ToxicStub) {
@@ -27,12 +30,21 @@ func (t *ResetToxic) Pipe(stub *ToxicStub) {
 			return
 		case <-stub.Input:
 			<-time.After(timeout)
-			stub.Close()
+			stub.Stats.AddClose()
+			if t.Close == CloseFIN {
+				stub.Close()
+			} else {
+				stub.Reset()
+			}
 			return
 		}
 	}
 }
 
+func (t *ResetToxic) Validate() error {
+	return nonNegative("timeout", t.Timeout)
+}
+
 func init() {
 	Register("reset_peer", new(ResetToxic))
 }
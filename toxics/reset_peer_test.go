@@ -94,3 +94,48 @@ func resetTCPHelper(t *testing.T, toxicJSON io.Reader) {
 	}()
 	checkConnectionState(t, proxy.Listen)
 }
+
+func TestResetToxicClosesGracefully(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server", err)
+	}
+	defer ln.Close()
+	proxy := NewTestProxy("test", ln.Addr().String())
+	proxy.Start()
+	proxy.Toxics.AddToxicJson(ToxicToJson(t, "resettcp", "reset_peer", "upstream",
+		&toxics.ResetToxic{Close: toxics.CloseFIN}))
+	defer proxy.Stop()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal("Unable to dial TCP server", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal("Failed writing TCP payload", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatal("Expected a graceful close, got:", err)
+	}
+}
+
+func TestTimeoutToxicResets(t *testing.T) {
+	resetTCPHelper(t, ToxicToJson(t, "timeout", "timeout", "upstream",
+		&toxics.TimeoutToxic{Timeout: 50, Close: toxics.CloseRST}))
+}
+
+func TestLimitDataToxicResets(t *testing.T) {
+	resetTCPHelper(t, ToxicToJson(t, "limit", "limit_data", "upstream",
+		&toxics.LimitDataToxic{Bytes: 1, Close: toxics.CloseRST}))
+}
@@ -1,12 +1,38 @@
 package toxics
 
 import (
-	"math/rand"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/Shopify/toxiproxy/v2/stream"
 )
 
+// Framing is how the messages of a protocol are delimited in a stream, so
+// that a slicer never sends the end of a message with the start of the next.
+type Framing string
+
+const (
+	FramingDelimiter Framing = "delimiter" // Messages end with a delimiter
+	FramingLength    Framing = "length"    // Messages start with their big-endian length
+)
+
+func (f *Framing) UnmarshalJSON(data []byte) error {
+	var framing string
+	err := json.Unmarshal(data, &framing)
+	if err != nil {
+		return err
+	}
+	switch Framing(framing) {
+	case "", FramingDelimiter, FramingLength:
+		*f = Framing(framing)
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: "string " + framing, Type: reflect.TypeOf(*f)}
+}
+
 // The SlicerToxic slices data into multiple smaller packets
 // to simulate real-world TCP behavior.
 type SlicerToxic struct {
@@ -18,6 +44,72 @@ type SlicerToxic struct {
 	// Microseconds to delay each packet. May be useful since there's
 	// usually some kind of buffering of network data
 	Delay int `json:"delay"`
+	// Framing of the messages, sliced separately if set
+	Framing Framing `json:"framing"`
+	// Delimiter of the delimiter framing, a newline if not set
+	Delimiter string `json:"delimiter"`
+	// Bytes of the length prefix of the length framing, 4 if not set. The
+	// length doesn't count the prefix.
+	LengthSize int `json:"length_size"`
+}
+
+type SlicerToxicState struct {
+	tail      []byte // Of the data, for a delimiter split across chunks
+	header    []byte // Of the length prefix read so far
+	remaining uint64 // Bytes of the message left after the length prefix
+}
+
+// boundaries returns the offsets in data at which a message ends, other than
+// the end of data.
+func (t *SlicerToxic) boundaries(state *SlicerToxicState, data []byte) []int {
+	var result []int
+	switch t.Framing {
+	case FramingDelimiter:
+		delimiter := []byte(t.Delimiter)
+		if len(delimiter) == 0 {
+			delimiter = []byte("\n")
+		}
+		buf := append(state.tail, data...)
+		for pos := 0; ; {
+			i := bytes.Index(buf[pos:], delimiter)
+			if i < 0 {
+				break
+			}
+			pos += i + len(delimiter)
+			if end := pos - len(state.tail); end > 0 && end < len(data) {
+				result = append(result, end)
+			}
+		}
+		keep := min(len(delimiter)-1, len(buf))
+		state.tail = append([]byte(nil), buf[len(buf)-keep:]...)
+	case FramingLength:
+		size := t.LengthSize
+		if size <= 0 || size > 8 {
+			size = 4
+		}
+		for pos := 0; pos < len(data); {
+			if state.remaining > 0 {
+				n := int(min(state.remaining, uint64(len(data)-pos)))
+				pos += n
+				state.remaining -= uint64(n)
+			} else {
+				n := min(size-len(state.header), len(data)-pos)
+				state.header = append(state.header, data[pos:pos+n]...)
+				pos += n
+				if len(state.header) < size {
+					continue
+				}
+				prefix := make([]byte, 8)
+				copy(prefix[8-size:], state.header)
+				state.remaining = binary.BigEndian.Uint64(prefix)
+				state.header = state.header[:0]
+			}
+			if state.remaining == 0 && len(state.header) == 0 && pos < len(data) {
+				result = append(result, pos)
+			}
+		}
+	}
+	return result
 }
 
 // Returns a list of chunk offsets to slice up a packet of the
@@ -28,7 +120,7 @@ type SlicerToxic struct {
 //
 // This tries to get fairly evenly-varying chunks (no tendency
 // to have a small/large chunk at the start/end).
-func (t *SlicerToxic) chunk(start int, end int) []int {
+func (t *SlicerToxic) chunk(stub *ToxicStub, start int, end int) []int {
 	// Base case:
 	// If the size is within the random varation, _or already
 	// less than the average size_, just return it.
@@ -40,15 +132,31 @@ func (t *SlicerToxic) chunk(start int, end int) []int {
 	mid := start + (end-start)/2
 
 	if t.SizeVariation > 0 {
-		mid += rand.Intn(t.SizeVariation*2) - t.SizeVariation // #nosec G404 -- was ignored before too
+		mid += stub.Rand().Intn(t.SizeVariation*2) - t.SizeVariation
 	}
-	left := t.chunk(start, mid)
-	right := t.chunk(mid, end)
+	left := t.chunk(stub, start, mid)
+	right := t.chunk(stub, mid, end)
 
 	return append(left, right...)
 }
 
+// slices returns the chunk offsets of data, with each message sliced
+// separately.
+func (t *SlicerToxic) slices(stub *ToxicStub, state *SlicerToxicState, data []byte) []int {
+	var result []int
+	start := 0
+	for _, end := range append(t.boundaries(state, data), len(data)) {
+		result = append(result, t.chunk(stub, start, end)...)
+		start = end
+	}
+	return result
+}
+
 func (t *SlicerToxic) Pipe(stub *ToxicStub) {
+	state, ok := stub.State.(*SlicerToxicState)
+	if !ok {
+		state = new(SlicerToxicState)
+	}
 	for {
 		select {
 		case <-stub.Interrupt:
@@ -59,7 +167,10 @@ func (t *SlicerToxic) Pipe(stub *ToxicStub) {
 				return
 			}
 
-			chunks := t.chunk(0, len(c.Data))
+			chunks := t.slices(stub, state, c.Data)
+			if len(chunks) > 2 {
+				stub.Stats.AddChunk(len(c.Data))
+			}
 			for i := 1; i < len(chunks); i += 2 {
 				stub.Output <- &stream.StreamChunk{
 					Data:      c.Data[chunks[i-1]:chunks[i]],
@@ -80,6 +191,23 @@ func (t *SlicerToxic) Pipe(stub *ToxicStub) {
 	}
 }
 
+func (t *SlicerToxic) NewState() interface{} {
+	return new(SlicerToxicState)
+}
+
+func (t *SlicerToxic) Validate() error {
+	err := firstError(
+		nonNegative("average_size", t.AverageSize),
+		nonNegative("size_variation", t.SizeVariation),
+		nonNegative("delay", t.Delay),
+		inRange("length_size", t.LengthSize, 0, 8),
+	)
+	if err == nil && t.SizeVariation > t.AverageSize {
+		err = &AttributeError{"size_variation", "must not be greater than average_size"}
+	}
+	return err
+}
+
 func init() {
 	Register("slicer", new(SlicerToxic))
 }
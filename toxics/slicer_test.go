@@ -2,6 +2,7 @@ package toxics_test
 
 import (
 	"bytes"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -104,3 +105,98 @@ func TestSlicerToxicZeroSizeVariation(t *testing.T) {
 		t.Errorf("Server did not read correct buffer from client!")
 	}
 }
+
+func TestSlicerToxicReplaysSeed(t *testing.T) {
+	data := []byte(strings.Repeat("hello world ", 1000)) // 12 kb
+	slicer := &toxics.SlicerToxic{AverageSize: 100, SizeVariation: 50}
+
+	slice := func(seed int64) []int {
+		input := make(chan *stream.StreamChunk, 1)
+		output := make(chan *stream.StreamChunk)
+		stub := toxics.NewToxicStub(input, output)
+		stub.SetSeed(seed)
+		go slicer.Pipe(stub)
+
+		input <- &stream.StreamChunk{Data: data}
+		close(input)
+		var sizes []int
+		for c := range output {
+			sizes = append(sizes, len(c.Data))
+		}
+		return sizes
+	}
+
+	first := slice(42)
+	if second := slice(42); !slices.Equal(first, second) {
+		t.Errorf("Expected the same slices with the same seed, got %v and %v", first, second)
+	}
+	if other := slice(43); slices.Equal(first, other) {
+		t.Errorf("Expected other slices with another seed, got %v", other)
+	}
+}
+
+// sliceFramed sends the chunks through the slicer and returns the slices.
+func sliceFramed(slicer *toxics.SlicerToxic, chunks ...[]byte) [][]byte {
+	input := make(chan *stream.StreamChunk, len(chunks))
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = slicer.NewState()
+	go slicer.Pipe(stub)
+
+	for _, data := range chunks {
+		input <- &stream.StreamChunk{Data: data}
+	}
+	close(input)
+	var result [][]byte
+	for c := range output {
+		result = append(result, c.Data)
+	}
+	return result
+}
+
+func TestSlicerToxicKeepsDelimitedMessagesApart(t *testing.T) {
+	slicer := &toxics.SlicerToxic{
+		AverageSize: 4,
+		Framing:     toxics.FramingDelimiter,
+		Delimiter:   "\r\n",
+	}
+	result := sliceFramed(slicer,
+		[]byte("GET / HTTP/1.1\r\nHost: a\r"), []byte("\nAccept: */*\r\n\r\n"))
+
+	var joined []byte
+	for _, data := range result {
+		if i := bytes.Index(data, []byte("\n")); i >= 0 && i != len(data)-1 {
+			t.Errorf("Expected each slice to end with its message, got %q", data)
+		}
+		joined = append(joined, data...)
+	}
+	if string(joined) != "GET / HTTP/1.1\r\nHost: a\r\nAccept: */*\r\n\r\n" {
+		t.Errorf("Expected the data to be kept, got %q", joined)
+	}
+	// The delimiter split across the chunks ends the message of the second one.
+	if !slices.ContainsFunc(result, func(data []byte) bool { return string(data) == "\n" }) {
+		t.Errorf("Expected the split delimiter to end a slice, got %q", result)
+	}
+}
+
+func TestSlicerToxicKeepsLengthPrefixedMessagesApart(t *testing.T) {
+	slicer := &toxics.SlicerToxic{AverageSize: 3, Framing: toxics.FramingLength, LengthSize: 2}
+	// Messages of 5, 0 and 7 bytes of payload, the third split across chunks.
+	messages := []string{"\x00\x05hello", "\x00\x00", "\x00\x07goodbye"}
+	data := []byte(strings.Join(messages, ""))
+	result := sliceFramed(slicer, data[:12], data[12:])
+
+	ends := map[int]bool{7: true, 9: true, 18: true}
+	offset := 0
+	for _, slice := range result {
+		for i := offset + 1; i < offset+len(slice); i++ {
+			if ends[i] {
+				t.Errorf("Expected the slice at %d to stop at the end of its message at %d", offset, i)
+			}
+		}
+		offset += len(slice)
+	}
+	if offset != len(data) {
+		t.Errorf("Expected %d bytes, got %d", len(data), offset)
+	}
+}
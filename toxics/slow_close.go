@@ -18,6 +18,7 @@ func (t *SlowCloseToxic) Pipe(stub *ToxicStub) {
 				delay := time.Duration(t.Delay) * time.Millisecond
 				select {
 				case <-time.After(delay):
+					stub.Stats.AddClose()
 					stub.Close()
 					return
 				case <-stub.Interrupt:
@@ -29,6 +30,10 @@ func (t *SlowCloseToxic) Pipe(stub *ToxicStub) {
 	}
 }
 
+func (t *SlowCloseToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
 func init() {
 	Register("slow_close", new(SlowCloseToxic))
 }
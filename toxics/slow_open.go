@@ -0,0 +1,54 @@
+package toxics
+
+import "time"
+
+// The SlowOpenToxic delays the first chunk of data of the link only, like a
+// slow TLS handshake or a cold backend, and then passes the data through.
+type SlowOpenToxic struct {
+	// Times in milliseconds
+	Delay int64 `json:"delay"`
+}
+
+type SlowOpenToxicState struct {
+	opened bool
+}
+
+func (t *SlowOpenToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*SlowOpenToxicState)
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if !state.opened {
+				state.opened = true
+				delay := time.Duration(t.Delay) * time.Millisecond
+				select {
+				case <-time.After(time.Until(c.Timestamp.Add(delay))):
+				case <-stub.Interrupt:
+					stub.Output <- c // Don't drop any data on the floor
+					return
+				}
+				c.Timestamp = c.Timestamp.Add(delay)
+				stub.Stats.AddChunk(len(c.Data))
+			}
+			stub.Output <- c
+		}
+	}
+}
+
+func (t *SlowOpenToxic) NewState() interface{} {
+	return new(SlowOpenToxicState)
+}
+
+func (t *SlowOpenToxic) Validate() error {
+	return nonNegative("delay", t.Delay)
+}
+
+func init() {
+	Register("slow_open", new(SlowOpenToxic))
+}
@@ -0,0 +1,63 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestSlowOpenToxicDelaysTheFirstChunk(t *testing.T) {
+	toxic := &toxics.SlowOpenToxic{Delay: 50}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	go toxic.Pipe(stub)
+	defer close(input)
+
+	for i, minimum := range []time.Duration{50 * time.Millisecond, 0, 0} {
+		sent := time.Now()
+		input <- &stream.StreamChunk{Data: []byte("hello"), Timestamp: sent}
+		select {
+		case <-output:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for chunk %d", i)
+		}
+		elapsed := time.Since(sent)
+		if elapsed < minimum || minimum == 0 && elapsed > 20*time.Millisecond {
+			t.Errorf("Expected chunk %d to be delayed by %s, took %s", i, minimum, elapsed)
+		}
+	}
+}
+
+func TestSlowOpenToxicDelaysOnceAcrossRestarts(t *testing.T) {
+	toxic := &toxics.SlowOpenToxic{Delay: 1000}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	// Interrupting the delay sends the chunk right away.
+	go func() {
+		input <- &stream.StreamChunk{Data: []byte("first"), Timestamp: time.Now()}
+		stub.Interrupt <- struct{}{}
+	}()
+	toxic.Pipe(stub)
+	checkOutgoingChunk(t, output, []byte("first"))
+
+	go func() {
+		input <- &stream.StreamChunk{Data: []byte("second"), Timestamp: time.Now()}
+		stub.Interrupt <- struct{}{}
+	}()
+	start := time.Now()
+	toxic.Pipe(stub)
+	checkOutgoingChunk(t, output, []byte("second"))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected only the first chunk to be delayed, took %s", elapsed)
+	}
+}
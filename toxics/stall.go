@@ -0,0 +1,89 @@
+package toxics
+
+import "time"
+
+// The StallToxic freezes the connection for a duration every interval without
+// closing it, like a GC pause, a VM migration or a Wi-Fi roaming gap. The
+// data sent during a stall waits for the end of it.
+type StallToxic struct {
+	// Times in milliseconds
+	Duration int64 `json:"duration"`
+	Interval int64 `json:"interval"`
+}
+
+type StallToxicState struct {
+	// The first stall starts an interval after the link, the next ones an
+	// interval after the previous one.
+	start time.Time
+}
+
+// stalledUntil returns the end of the stall at now, or now if the connection
+// isn't stalled.
+func (t *StallToxic) stalledUntil(start, now time.Time) time.Time {
+	duration := time.Duration(t.Duration) * time.Millisecond
+	interval := time.Duration(t.Interval) * time.Millisecond
+	if duration <= 0 || interval <= 0 {
+		return now
+	}
+
+	elapsed := now.Sub(start)
+	if elapsed < interval {
+		return now
+	}
+	phase := elapsed % interval
+	if phase >= duration {
+		return now
+	}
+	return now.Add(duration - phase)
+}
+
+func (t *StallToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*StallToxicState)
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+
+			var stalled time.Duration
+			for {
+				now := time.Now()
+				until := t.stalledUntil(state.start, now)
+				if !until.After(now) {
+					break
+				}
+				select {
+				case <-time.After(until.Sub(now)):
+					stalled += until.Sub(now)
+				case <-stub.Interrupt:
+					stub.Output <- c // Don't drop any data on the floor
+					return
+				}
+			}
+			if stalled > 0 {
+				c.Timestamp = c.Timestamp.Add(stalled)
+				stub.Stats.AddChunk(len(c.Data))
+			}
+			stub.Output <- c
+		}
+	}
+}
+
+func (t *StallToxic) NewState() interface{} {
+	return &StallToxicState{start: time.Now()}
+}
+
+func (t *StallToxic) Validate() error {
+	return firstError(
+		nonNegative("duration", t.Duration),
+		nonNegative("interval", t.Interval),
+	)
+}
+
+func init() {
+	Register("stall", new(StallToxic))
+}
@@ -0,0 +1,81 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestStallToxicFreezesEachInterval(t *testing.T) {
+	toxic := &toxics.StallToxic{Duration: 80, Interval: 100}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	start := time.Now()
+
+	go toxic.Pipe(stub)
+	defer close(input)
+
+	send := func() time.Duration {
+		sent := time.Now()
+		input <- &stream.StreamChunk{Data: []byte("hello"), Timestamp: sent}
+		select {
+		case <-output:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for the chunk")
+		}
+		return time.Since(sent)
+	}
+
+	if elapsed := send(); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected no stall before the first interval, waited %s", elapsed)
+	}
+
+	time.Sleep(time.Until(start.Add(110 * time.Millisecond)))
+	if elapsed := send(); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the chunk to wait for the end of the stall, waited %s", elapsed)
+	}
+
+	time.Sleep(time.Until(start.Add(190 * time.Millisecond)))
+	if elapsed := send(); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected no stall after the end of the stall, waited %s", elapsed)
+	}
+
+	if counters := stub.Stats.Counters(); counters.Chunks != 1 {
+		t.Errorf("Expected 1 stalled chunk, got %+v", counters)
+	}
+}
+
+func TestStallToxicKeepsDataOnInterrupt(t *testing.T) {
+	toxic := &toxics.StallToxic{Duration: 1000, Interval: 1}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 1)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		toxic.Pipe(stub)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	input <- &stream.StreamChunk{Data: []byte("hello")}
+	stub.Interrupt <- struct{}{}
+	<-done
+
+	select {
+	case chunk := <-output:
+		if string(chunk.Data) != "hello" {
+			t.Errorf("Expected the stalled chunk, got %q", chunk.Data)
+		}
+	default:
+		t.Error("Expected the stalled chunk to be sent on interrupt")
+	}
+}
@@ -0,0 +1,200 @@
+package toxics
+
+import (
+	"encoding/json"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the delay histogram buckets, doubling from 1ms to ~16s. Longer
+// delays are counted in an overflow bucket with an infinite upper bound.
+var delayBuckets = func() []time.Duration {
+	buckets := make([]time.Duration, 15)
+	for i := range buckets {
+		buckets[i] = time.Millisecond << i
+	}
+	return buckets
+}()
+
+// DelayObserver receives every delay recorded by ToxicStats in seconds.
+// It is satisfied by prometheus.Observer.
+type DelayObserver interface {
+	Observe(float64)
+}
+
+// ToxicStats counts the effects a toxic has had on the links it is attached to.
+// The counters are cumulative for the lifetime of the toxic and are shared by
+// every link, so they can be used to verify that a toxic actually fired.
+//
+// All methods are safe to call on a nil *ToxicStats, which allows toxics to be
+// used on stubs that were created without a ToxicWrapper (e.g. in tests).
+type ToxicStats struct {
+	activations atomic.Int64
+	chunks      atomic.Int64
+	bytes       atomic.Int64
+	closes      atomic.Int64
+
+	delayCount   atomic.Int64
+	delaySum     atomic.Int64     // Nanoseconds
+	delayBuckets [16]atomic.Int64 // The last one is the overflow bucket
+
+	// Notified of every recorded delay in addition to the histogram kept here.
+	observer atomic.Pointer[DelayObserver]
+}
+
+// ToxicCounters is a point-in-time copy of ToxicStats.
+type ToxicCounters struct {
+	// Number of times the toxic was applied to a link (after toxicity).
+	Activations int64 `json:"activations"`
+	// Number of chunks affected by the toxic (delayed, sliced, dropped, ...).
+	Chunks int64 `json:"chunks"`
+	// Number of bytes in the affected chunks.
+	Bytes int64 `json:"bytes"`
+	// Number of links closed or reset by the toxic.
+	Closes int64 `json:"closes"`
+	// Distribution of the delays added by the toxic, if it delays data.
+	Delay *DelayHistogram `json:"delay,omitempty"`
+}
+
+// DelayHistogram is a cumulative histogram of delays, like a Prometheus histogram.
+type DelayHistogram struct {
+	Count   int64         `json:"count"`
+	SumMs   float64       `json:"sum_ms"`
+	Buckets []DelayBucket `json:"buckets"`
+}
+
+type DelayBucket struct {
+	// Upper bound of the bucket in milliseconds, +Inf for the overflow bucket.
+	LeMs float64 `json:"le_ms"`
+	// Number of delays less than or equal to the upper bound.
+	Count int64 `json:"count"`
+}
+
+// MarshalJSON writes the infinite bound of the overflow bucket as "+Inf", as
+// JSON has no infinite numbers.
+func (b DelayBucket) MarshalJSON() ([]byte, error) {
+	type bucket DelayBucket
+	if !math.IsInf(b.LeMs, 1) {
+		return json.Marshal(bucket(b))
+	}
+	return json.Marshal(struct {
+		LeMs  string `json:"le_ms"`
+		Count int64  `json:"count"`
+	}{"+Inf", b.Count})
+}
+
+// UnmarshalJSON reads the "+Inf" bound of the overflow bucket.
+func (b *DelayBucket) UnmarshalJSON(data []byte) error {
+	var bucket struct {
+		LeMs  json.RawMessage `json:"le_ms"`
+		Count int64           `json:"count"`
+	}
+	err := json.Unmarshal(data, &bucket)
+	if err != nil {
+		return err
+	}
+
+	b.Count = bucket.Count
+	if len(bucket.LeMs) == 0 {
+		return nil
+	}
+	if string(bucket.LeMs) == `"+Inf"` {
+		b.LeMs = math.Inf(1)
+		return nil
+	}
+	return json.Unmarshal(bucket.LeMs, &b.LeMs)
+}
+
+func NewToxicStats() *ToxicStats {
+	return new(ToxicStats)
+}
+
+// AddActivation records that the toxic was run on a link.
+func (s *ToxicStats) AddActivation() {
+	if s != nil {
+		s.activations.Add(1)
+	}
+}
+
+// AddChunk records that the toxic affected a chunk of n bytes.
+func (s *ToxicStats) AddChunk(n int) {
+	if s != nil {
+		s.chunks.Add(1)
+		s.bytes.Add(int64(n))
+	}
+}
+
+// AddClose records that the toxic closed a link.
+func (s *ToxicStats) AddClose() {
+	if s != nil {
+		s.closes.Add(1)
+	}
+}
+
+// AddDelay records the delay that the toxic added to a chunk.
+func (s *ToxicStats) AddDelay(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.delayCount.Add(1)
+	s.delaySum.Add(int64(d))
+	bucket := len(delayBuckets)
+	for i, bound := range delayBuckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.delayBuckets[bucket].Add(1)
+	if observer := s.observer.Load(); observer != nil {
+		(*observer).Observe(d.Seconds())
+	}
+}
+
+// SetObserver has the delays recorded from now on observed by observer too.
+func (s *ToxicStats) SetObserver(observer DelayObserver) {
+	s.observer.Store(&observer)
+}
+
+func (s *ToxicStats) Counters() ToxicCounters {
+	if s == nil {
+		return ToxicCounters{}
+	}
+	counters := ToxicCounters{
+		Activations: s.activations.Load(),
+		Chunks:      s.chunks.Load(),
+		Bytes:       s.bytes.Load(),
+		Closes:      s.closes.Load(),
+	}
+
+	count := s.delayCount.Load()
+	if count == 0 {
+		return counters
+	}
+	counters.Delay = &DelayHistogram{
+		Count:   count,
+		SumMs:   float64(s.delaySum.Load()) / float64(time.Millisecond),
+		Buckets: make([]DelayBucket, len(delayBuckets)+1),
+	}
+	var cumulative int64
+	for i, bound := range delayBuckets {
+		cumulative += s.delayBuckets[i].Load()
+		counters.Delay.Buckets[i] = DelayBucket{
+			LeMs:  float64(bound) / float64(time.Millisecond),
+			Count: cumulative,
+		}
+	}
+	cumulative += s.delayBuckets[len(delayBuckets)].Load()
+	counters.Delay.Buckets[len(delayBuckets)] = DelayBucket{LeMs: math.Inf(1), Count: cumulative}
+	return counters
+}
+
+func (s *ToxicStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Counters())
+}
+
+// UnmarshalJSON ignores its input, counters can not be set through the api.
+func (s *ToxicStats) UnmarshalJSON([]byte) error {
+	return nil
+}
@@ -0,0 +1,162 @@
+package toxics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2"
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestToxicStatsNilIsSafe(t *testing.T) {
+	var stats *toxics.ToxicStats
+	stats.AddActivation()
+	stats.AddChunk(10)
+	stats.AddClose()
+
+	if stats.Counters() != (toxics.ToxicCounters{}) {
+		t.Errorf("Expected empty counters for nil stats, got %+v", stats.Counters())
+	}
+}
+
+func TestToxicStatsCountsLatency(t *testing.T) {
+	WithEchoProxy(t, func(conn net.Conn, response chan []byte, proxy *toxiproxy.Proxy) {
+		toxic, err := proxy.Toxics.AddToxicJson(ToxicToJson(
+			t, "latency", "latency", "upstream", &toxics.LatencyToxic{Latency: 10},
+		))
+		if err != nil {
+			t.Fatal("AddToxicJson returned error:", err)
+		}
+
+		msg := []byte("hello world\n")
+		_, err = conn.Write(msg)
+		if err != nil {
+			t.Fatal("Failed writing to TCP server", err)
+		}
+
+		resp := <-response
+		if !bytes.Equal(resp, msg) {
+			t.Fatal("Server didn't read correct bytes from client:", string(resp))
+		}
+
+		counters := toxic.Stats.Counters()
+		if counters.Activations != 1 {
+			t.Errorf("Expected 1 activation, got %d", counters.Activations)
+		}
+		if counters.Chunks != 1 || counters.Bytes != int64(len(msg)) {
+			t.Errorf("Expected 1 chunk of %d bytes, got %+v", len(msg), counters)
+		}
+	})
+}
+
+func TestToxicStatsSkippedByToxicity(t *testing.T) {
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+
+	wrapper := &toxics.ToxicWrapper{
+		Toxic:    &toxics.TimeoutToxic{},
+		Type:     "timeout",
+		Toxicity: 0,
+		Stats:    toxics.NewToxicStats(),
+	}
+	go stub.Run(wrapper)
+
+	input <- &stream.StreamChunk{Data: []byte("hello")}
+	select {
+	case <-output:
+	case <-time.After(time.Second):
+		t.Fatal("Expected data to pass through a toxic with toxicity of 0")
+	}
+	close(input)
+	<-output
+
+	counters := wrapper.Stats.Counters()
+	if counters.Activations != 0 || counters.Chunks != 0 {
+		t.Errorf("Expected no effects with toxicity of 0, got %+v", counters)
+	}
+}
+
+func TestToxicStatsCountsTimeoutClose(t *testing.T) {
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+
+	wrapper := &toxics.ToxicWrapper{
+		Toxic:    &toxics.TimeoutToxic{Timeout: 10},
+		Type:     "timeout",
+		Toxicity: 1,
+		Stats:    toxics.NewToxicStats(),
+	}
+	go stub.Run(wrapper)
+
+	input <- &stream.StreamChunk{Data: []byte("hello")}
+	select {
+	case <-output:
+	case <-time.After(time.Second):
+		t.Fatal("Expected timeout toxic to close the stub")
+	}
+
+	counters := wrapper.Stats.Counters()
+	if counters.Activations != 1 || counters.Chunks != 1 || counters.Bytes != 5 ||
+		counters.Closes != 1 {
+		t.Errorf("Unexpected counters for timeout toxic: %+v", counters)
+	}
+}
+
+func TestToxicStatsCountsOverflowDelays(t *testing.T) {
+	stats := toxics.NewToxicStats()
+	stats.AddDelay(5 * time.Millisecond)
+	stats.AddDelay(20 * time.Second)
+
+	delay := stats.Counters().Delay
+	if delay.Count != 2 {
+		t.Fatalf("Expected 2 delays, got %d", delay.Count)
+	}
+	overflow := delay.Buckets[len(delay.Buckets)-1]
+	if !math.IsInf(overflow.LeMs, 1) || overflow.Count != 2 {
+		t.Fatalf("Expected both delays in the overflow bucket, got %+v", overflow)
+	}
+	if last := delay.Buckets[len(delay.Buckets)-2]; last.Count != 1 {
+		t.Fatalf("Expected a single delay under %vms, got %d", last.LeMs, last.Count)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal("Failed to marshal stats:", err)
+	}
+	if !strings.Contains(string(data), `{"le_ms":"+Inf","count":2}`) {
+		t.Fatalf("Expected the overflow bucket in %s", data)
+	}
+}
+
+func TestLatencyToxicRecordsAddedDelay(t *testing.T) {
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+
+	wrapper := &toxics.ToxicWrapper{
+		Toxic:    &toxics.LatencyToxic{Latency: 100},
+		Type:     "latency",
+		Toxicity: 1,
+		Stats:    toxics.NewToxicStats(),
+	}
+	go stub.Run(wrapper)
+
+	// The chunk waited in other toxics for longer than the latency.
+	input <- &stream.StreamChunk{Data: []byte("hello"), Timestamp: time.Now().Add(-time.Second)}
+	<-output
+	close(input)
+	<-output
+
+	delay := wrapper.Stats.Counters().Delay
+	if delay == nil || delay.Count != 1 || delay.SumMs != 0 {
+		t.Fatalf("Expected a single delay of 0ms, got %+v", delay)
+	}
+}
@@ -0,0 +1,83 @@
+package toxics
+
+import (
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// The TarpitToxic trickles the data through, a few bytes per interval, so that
+// the peer hits its read timeouts. The first grace bytes of the connection
+// pass at full speed.
+type TarpitToxic struct {
+	// Bytes sent each interval, 1 if not set
+	Bytes int64 `json:"bytes"`
+	// Time in milliseconds
+	Interval int64 `json:"interval"`
+	// Bytes sent at full speed before the trickle starts
+	Grace int64 `json:"grace"`
+}
+
+type TarpitToxicState struct {
+	bytesTransmitted int64
+}
+
+func (t *TarpitToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*TarpitToxicState)
+	size := max(t.Bytes, 1)
+	interval := time.Duration(t.Interval) * time.Millisecond
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+
+			data := c.Data
+			if grace := t.Grace - state.bytesTransmitted; grace > 0 {
+				n := min(grace, int64(len(data)))
+				stub.Output <- &stream.StreamChunk{Data: data[:n], Timestamp: c.Timestamp}
+				state.bytesTransmitted += n
+				data = data[n:]
+			}
+			if len(data) > 0 {
+				stub.Stats.AddChunk(len(data))
+			}
+
+			for len(data) > 0 {
+				select {
+				case <-time.After(interval):
+				case <-stub.Interrupt:
+					// Don't drop any data on the floor
+					stub.Output <- &stream.StreamChunk{Data: data, Timestamp: time.Now()}
+					state.bytesTransmitted += int64(len(data))
+					return
+				}
+				n := min(size, int64(len(data)))
+				stub.Output <- &stream.StreamChunk{Data: data[:n], Timestamp: time.Now()}
+				state.bytesTransmitted += n
+				data = data[n:]
+			}
+		}
+	}
+}
+
+func (t *TarpitToxic) NewState() interface{} {
+	return new(TarpitToxicState)
+}
+
+func (t *TarpitToxic) Validate() error {
+	return firstError(
+		nonNegative("bytes", t.Bytes),
+		nonNegative("interval", t.Interval),
+		nonNegative("grace", t.Grace),
+	)
+}
+
+func init() {
+	Register("tarpit", new(TarpitToxic))
+}
@@ -0,0 +1,69 @@
+package toxics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestTarpitToxicTricklesAfterGrace(t *testing.T) {
+	toxic := &toxics.TarpitToxic{Bytes: 2, Interval: 10, Grace: 3}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	go toxic.Pipe(stub)
+	defer close(input)
+
+	start := time.Now()
+	input <- &stream.StreamChunk{Data: []byte("hello world")}
+
+	expected := []string{"hel", "lo", " w", "or", "ld"}
+	for i, data := range expected {
+		select {
+		case chunk := <-output:
+			if string(chunk.Data) != data {
+				t.Fatalf("Expected chunk %d to be %q, got %q", i, data, chunk.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for chunk %d", i)
+		}
+		if i == 0 && time.Since(start) > 5*time.Millisecond {
+			t.Errorf("Expected the grace bytes at full speed, waited %s", time.Since(start))
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected 4 intervals of trickle, took %s", elapsed)
+	}
+}
+
+func TestTarpitToxicGraceSurvivesRestart(t *testing.T) {
+	toxic := &toxics.TarpitToxic{Bytes: 1, Interval: 1000, Grace: 4}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+
+	go func() {
+		input <- &stream.StreamChunk{Data: []byte("ab")}
+		stub.Interrupt <- struct{}{}
+	}()
+	toxic.Pipe(stub)
+	checkOutgoingChunk(t, output, []byte("ab"))
+
+	// Only the rest of the grace passes at once after the restart, the data
+	// held back is sent on interrupt.
+	go func() {
+		input <- &stream.StreamChunk{Data: []byte("cdef")}
+		stub.Interrupt <- struct{}{}
+	}()
+	toxic.Pipe(stub)
+	checkOutgoingChunk(t, output, []byte("cd"))
+	checkOutgoingChunk(t, output, []byte("ef"))
+	checkRemainingChunks(t, output)
+}
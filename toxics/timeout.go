@@ -8,6 +8,8 @@ import "time"
 type TimeoutToxic struct {
 	// Times in milliseconds
 	Timeout int64 `json:"timeout"`
+	// How the connection is closed after the timeout, with a FIN by default.
+	Close CloseMode `json:"close"`
 }
 
 func (t *TimeoutToxic) Pipe(stub *ToxicStub) {
@@ -16,7 +18,8 @@ func (t *TimeoutToxic) Pipe(stub *ToxicStub) {
 		for {
 			select {
 			case <-time.After(timeout):
-				stub.Close()
+				stub.Stats.AddClose()
+				stub.CloseWith(t.Close)
 				return
 			case <-stub.Interrupt:
 				return
@@ -26,6 +29,7 @@ func (t *TimeoutToxic) Pipe(stub *ToxicStub) {
 					return
 				}
 				// Drop the data on the ground.
+				stub.Stats.AddChunk(len(c.Data))
 			}
 		}
 	} else {
@@ -39,6 +43,7 @@ func (t *TimeoutToxic) Pipe(stub *ToxicStub) {
 					return
 				}
 				// Drop the data on the ground.
+				stub.Stats.AddChunk(len(c.Data))
 			}
 		}
 	}
@@ -48,6 +53,10 @@ func (t *TimeoutToxic) Cleanup(stub *ToxicStub) {
 	stub.Close()
 }
 
+func (t *TimeoutToxic) Validate() error {
+	return nonNegative("timeout", t.Timeout)
+}
+
 func init() {
 	Register("timeout", new(TimeoutToxic))
 }
@@ -0,0 +1,106 @@
+package toxics
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyWheel wakes up the latency toxics of all links.
+var latencyWheel = newTimerWheel(time.Millisecond, 1024)
+
+// timerWheel is a hashed timing wheel: the deadlines of all links are kept in
+// slots of one tick, which a single goroutine visits in turn, rather than
+// allocating a timer per chunk. Deadlines are rounded up to the next tick. The
+// goroutine only runs while deadlines are pending, and catches up with the
+// ticks it missed under load.
+type timerWheel struct {
+	tick    time.Duration
+	start   time.Time
+	mutex   sync.Mutex
+	slots   [][]wheelEntry
+	next    int64 // Next tick to visit
+	pending int
+	running bool
+}
+
+type wheelEntry struct {
+	tick int64
+	wake chan<- struct{}
+}
+
+func newTimerWheel(tick time.Duration, slots int) *timerWheel {
+	return &timerWheel{
+		tick:  tick,
+		start: time.Now(),
+		slots: make([][]wheelEntry, slots),
+	}
+}
+
+// schedule sends on wake once the deadline has passed. The send does not
+// block, wake should be buffered.
+func (w *timerWheel) schedule(deadline time.Time, wake chan<- struct{}) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	tick := int64((deadline.Sub(w.start) + w.tick - 1) / w.tick)
+	if tick < w.next {
+		tick = w.next
+	}
+	slot := tick % int64(len(w.slots))
+	w.slots[slot] = append(w.slots[slot], wheelEntry{tick: tick, wake: wake})
+	w.pending++
+
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !w.advance(now) {
+			return
+		}
+	}
+}
+
+// advance wakes up the entries due by now, and reports whether entries are
+// still pending.
+func (w *timerWheel) advance(now time.Time) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	current := int64(now.Sub(w.start) / w.tick)
+	if missed := current - w.next + 1; missed > int64(len(w.slots)) {
+		// Every slot is due, visit them once.
+		w.next = current - int64(len(w.slots)) + 1
+	}
+
+	for ; w.next <= current; w.next++ {
+		slot := &w.slots[w.next%int64(len(w.slots))]
+		kept := (*slot)[:0]
+		for _, entry := range *slot {
+			if entry.tick > current {
+				kept = append(kept, entry)
+				continue
+			}
+			select {
+			case entry.wake <- struct{}{}:
+			default:
+			}
+			w.pending--
+		}
+		// Release the channels of the woken entries.
+		clear((*slot)[len(kept):])
+		*slot = kept
+	}
+
+	if w.pending == 0 {
+		w.running = false
+		return false
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package toxics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+func TestTimerWheelWakesAtDeadlines(t *testing.T) {
+	wheel := newTimerWheel(time.Millisecond, 16)
+
+	start := time.Now()
+	delays := []time.Duration{-time.Millisecond, 5 * time.Millisecond, 40 * time.Millisecond}
+	wakes := make([]chan struct{}, len(delays))
+	for i, delay := range delays {
+		wakes[i] = make(chan struct{}, 1)
+		wheel.schedule(start.Add(delay), wakes[i])
+	}
+
+	for i, delay := range delays {
+		select {
+		case <-wakes[i]:
+		case <-time.After(time.Second):
+			t.Fatalf("Deadline in %v was not woken up", delay)
+		}
+		elapsed := time.Since(start)
+		if elapsed < delay {
+			t.Errorf("Deadline in %v was woken up early, after %v", delay, elapsed)
+		}
+	}
+
+	// The wheel stops once no deadlines are pending, and starts again.
+	deadline := time.Now().Add(time.Second)
+	for {
+		wheel.mutex.Lock()
+		running := wheel.running
+		wheel.mutex.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the wheel to stop without pending deadlines")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	wheel.schedule(time.Now().Add(time.Millisecond), wakes[0])
+	select {
+	case <-wakes[0]:
+	case <-time.After(time.Second):
+		t.Fatal("Deadline scheduled after the wheel stopped was not woken up")
+	}
+}
+
+func TestTimerWheelCatchesUpMissedTicks(t *testing.T) {
+	wheel := newTimerWheel(time.Millisecond, 16)
+	wheel.running = true // Advance by hand, without the ticker
+
+	wake := make(chan struct{}, 1)
+	wheel.schedule(wheel.start.Add(5*time.Millisecond), wake)
+	if wheel.advance(wheel.start.Add(4 * time.Millisecond)) {
+		select {
+		case <-wake:
+			t.Fatal("Deadline was woken up early")
+		default:
+		}
+	}
+
+	// Several turns of the wheel were missed at once.
+	if wheel.advance(wheel.start.Add(100 * time.Millisecond)) {
+		t.Fatal("Expected no pending deadlines")
+	}
+	select {
+	case <-wake:
+	default:
+		t.Fatal("Expected the missed deadline to be woken up")
+	}
+}
+
+func BenchmarkLatencyToxic(b *testing.B) {
+	input := make(chan *stream.StreamChunk, 1024)
+	output := make(chan *stream.StreamChunk, 1024)
+	stub := NewToxicStub(input, output)
+	go stub.Run(&ToxicWrapper{Toxic: &LatencyToxic{Latency: 1}, Toxicity: 1})
+
+	data := []byte("hello")
+	go func() {
+		for i := 0; i < b.N; i++ {
+			input <- &stream.StreamChunk{Data: data, Timestamp: time.Now()}
+		}
+		close(input)
+	}()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		<-output
+	}
+}
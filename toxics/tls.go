@@ -0,0 +1,237 @@
+package toxics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Fatal alerts of TLS, by their name.
+var tlsAlerts = map[string]byte{
+	"handshake_failure":       40,
+	"bad_certificate":         42,
+	"unsupported_certificate": 43,
+	"certificate_revoked":     44,
+	"certificate_expired":     45,
+	"certificate_unknown":     46,
+	"illegal_parameter":       47,
+	"unknown_ca":              48,
+	"access_denied":           49,
+	"decode_error":            50,
+	"decrypt_error":           51,
+	"protocol_version":        70,
+	"insufficient_security":   71,
+	"internal_error":          80,
+	"unrecognized_name":       112,
+	"no_application_protocol": 120,
+}
+
+// Content types of the TLS records.
+const (
+	tlsHandshake  = 22
+	tlsAlert      = 21
+	tlsHeaderSize = 5
+)
+
+// TLSAlert is the fatal alert a TLS toxic aborts the handshake with, written
+// in JSON as its name, e.g. "certificate_expired".
+type TLSAlert byte
+
+func (a *TLSAlert) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return err
+	}
+	alert, ok := tlsAlerts[name]
+	if !ok && name != "" {
+		return &json.UnmarshalTypeError{Value: "string " + name, Type: reflect.TypeOf(*a)}
+	}
+	*a = TLSAlert(alert)
+	return nil
+}
+
+func (a TLSAlert) MarshalJSON() ([]byte, error) {
+	for name, alert := range tlsAlerts {
+		if TLSAlert(alert) == a {
+			return json.Marshal(name)
+		}
+	}
+	return json.Marshal("")
+}
+
+// The TLSToxic follows the TLS records of a server to slow down its handshake,
+// or to abort it with a fatal alert, e.g. "certificate_expired", so that the
+// handshake timeouts and the certificate errors of clients can be tested. The
+// connection is not terminated: only the records of the handshake sent in the
+// clear are acted on, which are the ServerHello alone with TLS 1.3.
+type TLSToxic struct {
+	// Time in milliseconds each handshake record is delayed by
+	Delay int64 `json:"delay"`
+	// Fatal alert sent instead of a handshake record, closing the connection
+	Alert TLSAlert `json:"alert"`
+	// Number of handshake records sent before the alert
+	After int `json:"after"`
+}
+
+type TLSToxicState struct {
+	started   bool
+	lost      bool   // The data passes through once it isn't TLS
+	head      []byte // Header of the next record, until it is read
+	remaining int    // Bytes of the current record left
+	records   int    // Handshake records sent
+}
+
+// tlsRecord reports whether the header is the one of a record of TLS.
+func tlsRecord(head []byte) bool {
+	return head[0] >= 20 && head[0] <= 24 && head[1] == 3 &&
+		binary.BigEndian.Uint16(head[3:]) <= 1<<14+2048
+}
+
+func (t *TLSToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*TLSToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its records can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				t.Cleanup(stub)
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			r := tlsChunk{toxic: t, stub: stub, state: state, chunk: c}
+			if r.run() {
+				stub.Stats.AddClose()
+				stub.Close()
+				return
+			}
+			if r.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the record held once the toxic is removed.
+func (t *TLSToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*TLSToxicState)
+	if len(state.head) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.head, Timestamp: time.Now()}
+		state.head = nil
+	}
+}
+
+func (t *TLSToxic) NewState() interface{} {
+	return new(TLSToxicState)
+}
+
+// tlsChunk parses a chunk of data of a TLS toxic.
+type tlsChunk struct {
+	toxic       *TLSToxic
+	stub        *ToxicStub
+	state       *TLSToxicState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied, and reports whether
+// the handshake was aborted.
+func (r *tlsChunk) run() bool {
+	state := r.state
+	data := r.chunk.Data
+	defer r.flush()
+	for len(data) > 0 {
+		if state.lost {
+			r.out = append(r.out, data...)
+			return false
+		}
+
+		if state.remaining > 0 {
+			n := min(state.remaining, len(data))
+			r.out = append(r.out, data[:n]...)
+			data = data[n:]
+			state.remaining -= n
+			continue
+		}
+
+		n := min(tlsHeaderSize-len(state.head), len(data))
+		state.head = append(state.head, data[:n]...)
+		data = data[n:]
+		if len(state.head) < tlsHeaderSize {
+			continue
+		}
+		head := state.head
+		state.head = nil
+		if !tlsRecord(head) {
+			state.lost = true
+			r.out = append(r.out, head...)
+			continue
+		}
+
+		state.remaining = int(binary.BigEndian.Uint16(head[3:]))
+		if head[0] == tlsHandshake && r.handshake(head) {
+			return true
+		}
+		r.out = append(r.out, head...)
+	}
+	return false
+}
+
+// handshake applies the toxic to a handshake record starting, and reports
+// whether the handshake is aborted.
+func (r *tlsChunk) handshake(head []byte) bool {
+	state := r.state
+	if r.toxic.Alert != 0 && state.records >= r.toxic.After {
+		r.stub.Stats.AddChunk(len(r.chunk.Data))
+		r.out = append(r.out, tlsAlert, head[1], head[2], 0, 2, 2, byte(r.toxic.Alert))
+		return true
+	}
+	state.records++
+	if r.toxic.Delay > 0 && !r.interrupted {
+		r.stub.Stats.AddChunk(len(r.chunk.Data))
+		r.flush()
+		delay := time.Duration(r.toxic.Delay) * time.Millisecond
+		select {
+		case <-time.After(delay):
+			r.stub.Stats.AddDelay(delay)
+		case <-r.stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			r.interrupted = true
+		}
+	}
+	return false
+}
+
+func (r *tlsChunk) flush() {
+	if len(r.out) > 0 {
+		r.stub.Output <- &stream.StreamChunk{Data: r.out, Timestamp: r.chunk.Timestamp}
+		r.out = nil
+	}
+}
+
+func (t *TLSToxic) Validate() error {
+	return firstError(
+		nonNegative("delay", t.Delay),
+		nonNegative("after", t.After),
+	)
+}
+
+func init() {
+	Register("tls", new(TLSToxic))
+}
@@ -0,0 +1,130 @@
+package toxics_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// tlsCertificate returns a self-signed certificate for localhost.
+func tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsHandshake runs the handshake of a TLS client with a server whose data
+// goes through the toxic, and returns its error.
+func tlsHandshake(t *testing.T, toxic *toxics.TLSToxic, version uint16) error {
+	t.Helper()
+	client, clientSide := net.Pipe()
+	server, serverSide := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	go toxic.Pipe(stub)
+	go io.Copy(serverSide, clientSide)
+	go func() {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := serverSide.Read(buf)
+			if err != nil {
+				input <- nil
+				return
+			}
+			input <- &stream.StreamChunk{Data: append([]byte(nil), buf[:n]...)}
+		}
+	}()
+	go func() {
+		for chunk := range output {
+			clientSide.Write(chunk.Data)
+		}
+		clientSide.Close()
+	}()
+
+	go tls.Server(server, &tls.Config{
+		Certificates: []tls.Certificate{tlsCertificate(t)},
+		MaxVersion:   version,
+	}).Handshake()
+	conn := tls.Client(client, &tls.Config{InsecureSkipVerify: true, MaxVersion: version})
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn.Handshake()
+}
+
+func TestTLSToxicAbortsTheHandshakeWithAnAlert(t *testing.T) {
+	toxic := new(toxics.TLSToxic)
+	err := json.Unmarshal([]byte(`{"alert": "certificate_expired"}`), toxic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		err = tlsHandshake(t, toxic, version)
+		if err == nil || !strings.Contains(err.Error(), "expired certificate") {
+			t.Errorf("Expected the handshake to fail with the alert, got %v", err)
+		}
+	}
+
+	// The alert follows the ServerHello.
+	toxic.After = 1
+	err = tlsHandshake(t, toxic, tls.VersionTLS12)
+	if err == nil || !strings.Contains(err.Error(), "expired certificate") {
+		t.Errorf("Expected the handshake to fail with the alert, got %v", err)
+	}
+
+	err = json.Unmarshal([]byte(`{"alert": "expired"}`), toxic)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("Expected an invalid alert to be rejected, got %v", err)
+	}
+}
+
+func TestTLSToxicSlowsTheHandshake(t *testing.T) {
+	toxic := &toxics.TLSToxic{Delay: 100}
+	start := time.Now()
+	err := tlsHandshake(t, toxic, tls.VersionTLS13)
+	if err != nil {
+		t.Fatal("Expected the handshake to succeed:", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the handshake to be delayed, took %s", elapsed)
+	}
+}
+
+func TestTLSToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.TLSToxic{Alert: 40}
+	hello := []byte("\x16\x03\x03\x00\x04\x02\x00\x00\x00")
+	result, _ := runWire(t, toxic, true, hello)
+	checkWire(t, result, hello)
+
+	plain := []byte("HTTP/1.1 200 OK\r\n\r\n")
+	result, _ = runWire(t, toxic, false, plain, hello)
+	checkWire(t, result, plain, hello)
+}
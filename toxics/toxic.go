@@ -1,9 +1,13 @@
 package toxics
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -39,6 +43,14 @@ type BufferedToxic interface {
 	GetBufferSize() int
 }
 
+// Resumable toxics hold their connections paused until they are resumed,
+// e.g. a limit_data toxic with pause.
+type ResumableToxic interface {
+	// Resume is called with the toxic of the stub interrupted, before it runs
+	// again.
+	Resume(*ToxicStub)
+}
+
 // Stateful toxics store a per-connection state object on the ToxicStub.
 // The state is created once when the toxic is added and persists until the
 // toxic is removed or the connection is closed.
@@ -47,24 +59,107 @@ type StatefulToxic interface {
 	NewState() interface{}
 }
 
+// Paired toxics of the stream both share a per-connection state between their
+// stubs of the upstream and the downstream, e.g. to match the responses with
+// the requests. It is created by the first of the two stubs started.
+type PairedToxic interface {
+	// Creates a new object to store the state shared by both streams in
+	NewSharedState() interface{}
+}
+
+// CloseMode is how a toxic closes a connection: gracefully with a FIN, or
+// abruptly with a RST that discards the data not sent yet. The default is the
+// one of the toxic.
+type CloseMode string
+
+const (
+	CloseFIN CloseMode = "fin"
+	CloseRST CloseMode = "rst"
+)
+
+func (m *CloseMode) UnmarshalJSON(data []byte) error {
+	var mode string
+	err := json.Unmarshal(data, &mode)
+	if err != nil {
+		return err
+	}
+	switch CloseMode(mode) {
+	case "", CloseFIN, CloseRST:
+		*m = CloseMode(mode)
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: "string " + mode, Type: reflect.TypeOf(*m)}
+}
+
+// ToxicWrapper is a toxic added to a proxy. The random values of the toxic,
+// e.g. its toxicity rolls, come from its seed so that a run can be replayed:
+// each connection gets its own values, the same ones for the same seed. A
+// sticky toxic rolls its toxicity from the IP of the client instead, so that
+// a client reconnecting is affected the same way.
+//
+// A toxic of the stream both is a pair of wrappers, one on each stream, with
+// the same name and stats, each the Pair of the other.
 type ToxicWrapper struct {
 	Toxic      `json:"attributes"`
 	Name       string           `json:"name"`
 	Type       string           `json:"type"`
 	Stream     string           `json:"stream"`
 	Toxicity   float32          `json:"toxicity"`
+	Seed       int64            `json:"seed"`   // Of the random values, e.g. toxicity rolls
+	Sticky     bool             `json:"sticky"` // Roll the toxicity from the client IP
+	Modulation Modulation       `json:"modulation,omitempty"`
+	Stats      *ToxicStats      `json:"stats"`
 	Direction  stream.Direction `json:"-"`
-	Index      int              `json:"-"`
+	Index      int              `json:"index"` // Position in the chain of its stream, from 1
 	BufferSize int              `json:"-"`
+	Pair       *ToxicWrapper    `json:"-"`
+	// The toxic only applies to the first FirstConnections connections opened
+	// after it was added, to every EveryConnection-th of them, or to the ones
+	// that are both, and to all of them if neither is set.
+	FirstConnections int `json:"first_connections,omitempty"`
+	EveryConnection  int `json:"every_connection,omitempty"`
+	// LastConnection is the id of the last connection of the proxy opened
+	// before the toxic was added.
+	LastConnection uint64 `json:"-"`
+	// Match restricts the toxic to the connections of some clients or
+	// upstreams, if set.
+	Match *Match `json:"match,omitempty"`
 }
 
 type ToxicStub struct {
 	Input     <-chan *stream.StreamChunk
 	Output    chan<- *stream.StreamChunk
 	State     interface{}
+	Stats     *ToxicStats
 	Interrupt chan struct{}
 	running   chan struct{}
 	closed    chan struct{}
+	// The toxicity is rolled once per stub, not each time the stub is
+	// restarted, and again if the toxicity of the toxic changes.
+	rolled   bool
+	toxicity float32
+	sticky   bool
+	active   bool
+	covered  bool
+	client   string
+	conn     uint64 // Id of the connection, which scopes the toxics
+	port     int    // Port of the client, which toxics match
+	upstream string // Address dialed for the connection, which toxics match
+	seed     int64
+	seeded   bool
+	rand     *rand.Rand
+
+	// OnReset is called by Reset before the stub closes, for the link of the
+	// stub to reset the connection.
+	OnReset func()
+	// Late is set on the stubs of a toxic added to a link already started,
+	// which missed the data sent before.
+	Late bool
+	// Shared is the state of a PairedToxic of both streams shared with the
+	// stub of the other stream, nil for a toxic of a single stream.
+	Shared interface{}
+	// Direction is the stream of the toxic running on the stub.
+	Direction stream.Direction
 }
 
 func NewToxicStub(input <-chan *stream.StreamChunk, output chan<- *stream.StreamChunk) *ToxicStub {
@@ -81,14 +176,117 @@ func NewToxicStub(input <-chan *stream.StreamChunk, output chan<- *stream.Stream
 func (s *ToxicStub) Run(toxic *ToxicWrapper) {
 	s.running = make(chan struct{})
 	defer close(s.running)
-	randomToxicity := rand.Float32() // #nosec G404 -- was ignored before too
-	if randomToxicity < toxic.Toxicity {
+	s.Stats = toxic.Stats
+	s.Direction = toxic.Direction
+	covered := toxic.Covers(s.conn) && toxic.Match.Matches(s.client, s.port, s.upstream)
+	if !s.rolled || s.toxicity != toxic.Toxicity || s.sticky != toxic.Sticky ||
+		s.covered != covered {
+		wasActive := s.active
+		s.active = covered && (toxic.Toxicity >= 1 ||
+			toxic.Toxicity > 0 && s.roll(toxic) < toxic.Toxicity)
+		s.rolled = true
+		s.toxicity = toxic.Toxicity
+		s.sticky = toxic.Sticky
+		s.covered = covered
+		if s.active && !wasActive {
+			s.Stats.AddActivation()
+		}
+	}
+
+	if s.active {
 		toxic.Pipe(s)
 	} else {
 		new(NoopToxic).Pipe(s)
 	}
 }
 
+// SetSeed seeds the random values of the stub, so that they are the same for
+// the same seed. It is called before the stub runs.
+func (s *ToxicStub) SetSeed(seed int64) {
+	s.seed = seed
+	s.seeded = true
+	s.rand = nil
+}
+
+// Rand returns the random source of the toxic running on the stub, seeded
+// with SetSeed or randomly if it wasn't called.
+func (s *ToxicStub) Rand() *rand.Rand {
+	if s.rand == nil {
+		seed := s.seed
+		if !s.seeded {
+			seed = rand.Int63() // #nosec G404 -- was ignored before too
+		}
+		s.rand = rand.New(rand.NewSource(seed)) // #nosec G404 -- replayable on purpose
+	}
+	return s.rand
+}
+
+// SetConnection sets the id of the connection of the stub, which scopes the
+// toxics with Covers. It is called before the stub runs.
+func (s *ToxicStub) SetConnection(id uint64) {
+	s.conn = id
+}
+
+// SetClient sets the IP of the client of the connection of the stub, which
+// rolls the toxicity of sticky toxics. It is called before the stub runs.
+func (s *ToxicStub) SetClient(ip string) {
+	s.client = ip
+}
+
+// SetClientPort sets the port of the client of the connection of the stub,
+// which the matches of the toxics check. It is called before the stub runs.
+func (s *ToxicStub) SetClientPort(port int) {
+	s.port = port
+}
+
+// SetUpstream sets the address dialed for the connection of the stub, which
+// the matches of the toxics check. It is called before the stub runs.
+func (s *ToxicStub) SetUpstream(address string) {
+	s.upstream = address
+}
+
+// roll returns a number in [0, 1) to compare with the toxicity, the same one
+// for each connection of a client with a sticky toxic. A higher toxicity
+// affects the clients of a lower one and more.
+func (s *ToxicStub) roll(toxic *ToxicWrapper) float32 {
+	if !toxic.Sticky || s.client == "" {
+		return s.Rand().Float32()
+	}
+	hash := fnv.New64a()
+	hash.Write(binary.LittleEndian.AppendUint64(nil, uint64(toxic.Seed)))
+	hash.Write([]byte(s.client))
+	// The high bits of FNV barely change with the last bytes, they are mixed
+	// as in splitmix64.
+	z := hash.Sum64()
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float32(z>>40) / (1 << 24)
+}
+
+// Covers reports whether the toxic applies to the connection with the given
+// id, as scoped by FirstConnections and EveryConnection. The connections
+// opened before the toxic was added are not covered by a scoped toxic.
+func (t *ToxicWrapper) Covers(connection uint64) bool {
+	if t.FirstConnections <= 0 && t.EveryConnection <= 0 {
+		return true
+	}
+	if connection <= t.LastConnection {
+		return false
+	}
+	n := connection - t.LastConnection
+	if t.FirstConnections > 0 && n > uint64(t.FirstConnections) {
+		return false
+	}
+	return t.EveryConnection <= 0 || n%uint64(t.EveryConnection) == 0
+}
+
+// StubSeed returns the seed of the stub of the toxic on the connection with
+// the given id.
+func (t *ToxicWrapper) StubSeed(connection uint64) int64 {
+	return t.Seed ^ int64(connection*0x9E3779B97F4A7C15)
+}
+
 // WriteOutput allows to write to Output with timeout to avoid deadlocks.
 // If duration is 0, then wait until other goroutines finish reading from Output.
 func (s *ToxicStub) WriteOutput(p *stream.StreamChunk, d time.Duration) error {
@@ -133,26 +331,72 @@ func (s *ToxicStub) Close() {
 	}
 }
 
-var (
-	ToxicRegistry map[string]Toxic
-	registryMutex sync.RWMutex
-)
+// Reset closes the stub like Close, and has the connection reset with a RST
+// rather than closed gracefully.
+func (s *ToxicStub) Reset() {
+	if !s.Closed() && s.OnReset != nil {
+		s.OnReset()
+	}
+	s.Close()
+}
 
-func Register(typeName string, toxic Toxic) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
+// CloseWith closes the stub with the close mode, a graceful close if it is
+// not set.
+func (s *ToxicStub) CloseWith(mode CloseMode) {
+	if mode == CloseRST {
+		s.Reset()
+	} else {
+		s.Close()
+	}
+}
+
+// Registry holds the toxic types a server can create.
+type Registry struct {
+	mutex  sync.RWMutex
+	toxics map[string]Toxic
+}
+
+// ToxicRegistry is the map of the toxics of the default registry.
+//
+// Deprecated: use DefaultRegistry, which guards the map with a lock.
+var ToxicRegistry = make(map[string]Toxic)
+
+// DefaultRegistry holds the built-in toxics, and the ones registered with
+// Register. It shares its map with ToxicRegistry.
+var DefaultRegistry = &Registry{toxics: ToxicRegistry}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{toxics: make(map[string]Toxic)}
+}
+
+// Clone returns a registry with the toxics of this one, e.g. to add custom
+// toxics to the built-in ones for a single server.
+func (r *Registry) Clone() *Registry {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	if ToxicRegistry == nil {
-		ToxicRegistry = make(map[string]Toxic)
+	clone := NewRegistry()
+	for typeName, toxic := range r.toxics {
+		clone.toxics[typeName] = toxic
 	}
-	ToxicRegistry[typeName] = toxic
+	return clone
 }
 
-func New(wrapper *ToxicWrapper) Toxic {
-	registryMutex.RLock()
-	defer registryMutex.RUnlock()
+func (r *Registry) Register(typeName string, toxic Toxic) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.toxics[typeName] = toxic
+}
 
-	orig, ok := ToxicRegistry[wrapper.Type]
+// New creates a toxic of the type of the wrapper, or returns nil if the type
+// is not registered.
+func (r *Registry) New(wrapper *ToxicWrapper) Toxic {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	orig, ok := r.toxics[wrapper.Type]
 	if !ok {
 		return nil
 	}
@@ -165,9 +409,39 @@ func New(wrapper *ToxicWrapper) Toxic {
 	return wrapper.Toxic
 }
 
+func (r *Registry) Count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.toxics)
+}
+
+// Types returns the sorted names of the registered toxic types.
+func (r *Registry) Types() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	types := make([]string, 0, len(r.toxics))
+	for typeName := range r.toxics {
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func Register(typeName string, toxic Toxic) {
+	DefaultRegistry.Register(typeName, toxic)
+}
+
+func New(wrapper *ToxicWrapper) Toxic {
+	return DefaultRegistry.New(wrapper)
+}
+
 func Count() int {
-	registryMutex.RLock()
-	defer registryMutex.RUnlock()
+	return DefaultRegistry.Count()
+}
 
-	return len(ToxicRegistry)
+// Types returns the sorted names of the toxic types of the default registry.
+func Types() []string {
+	return DefaultRegistry.Types()
 }
@@ -10,6 +10,8 @@ import (
 	"io"
 	"net"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -399,3 +401,140 @@ func TestToxicStub_WriteOutput(t *testing.T) {
 		}
 	})
 }
+
+func TestToxicRegistryIsTheDefaultRegistry(t *testing.T) {
+	if _, ok := toxics.ToxicRegistry["latency"]; !ok {
+		t.Fatal("Expected the built-in toxics in ToxicRegistry")
+	}
+
+	toxics.Register("registry_alias", new(toxics.NoopToxic))
+	defer func() {
+		delete(toxics.ToxicRegistry, "registry_alias")
+	}()
+	if _, ok := toxics.ToxicRegistry["registry_alias"]; !ok {
+		t.Fatal("Expected ToxicRegistry to list the toxics added with Register")
+	}
+	if len(toxics.ToxicRegistry) != toxics.Count() {
+		t.Fatalf("Expected %d toxics in ToxicRegistry, got %d",
+			toxics.Count(), len(toxics.ToxicRegistry))
+	}
+}
+
+// dropToxic drops the data going through it, to tell whether it is applied.
+type dropToxic struct{}
+
+func (dropToxic) Pipe(stub *toxics.ToxicStub) {
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+		}
+	}
+}
+
+func TestStickyToxicityFollowsTheClient(t *testing.T) {
+	wrapper := &toxics.ToxicWrapper{
+		Toxic:    dropToxic{},
+		Toxicity: 0.5,
+		Seed:     42,
+		Sticky:   true,
+		Stats:    toxics.NewToxicStats(),
+	}
+	// applied connects a client, and tells whether the toxic applied to it.
+	applied := func(client string, connection uint64) bool {
+		input := make(chan *stream.StreamChunk, 1)
+		output := make(chan *stream.StreamChunk, 1)
+		stub := toxics.NewToxicStub(input, output)
+		stub.SetSeed(wrapper.StubSeed(connection))
+		stub.SetClient(client)
+		go stub.Run(wrapper)
+
+		input <- &stream.StreamChunk{Data: []byte("hello")}
+		close(input)
+		return <-output == nil
+	}
+
+	affected := 0
+	for i := 0; i < 20; i++ {
+		client := "10.0.0." + strconv.Itoa(i)
+		first := applied(client, 1)
+		for connection := uint64(2); connection < 5; connection++ {
+			if applied(client, connection) != first {
+				t.Fatalf("Expected the connections of %s to be affected the same way", client)
+			}
+		}
+		if first {
+			affected++
+		}
+	}
+	if affected == 0 || affected == 20 {
+		t.Errorf("Expected about half the clients to be affected, got %d of 20", affected)
+	}
+}
+
+func TestToxicCoversTheConnectionsInScope(t *testing.T) {
+	testCases := []struct {
+		name    string
+		first   int
+		every   int
+		covered []uint64
+	}{
+		{"unscoped", 0, 0, []uint64{3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+		{"first", 2, 0, []uint64{4, 5}},
+		{"every", 0, 3, []uint64{6, 9, 12}},
+		{"both", 7, 3, []uint64{6, 9}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wrapper := &toxics.ToxicWrapper{
+				FirstConnections: tc.first,
+				EveryConnection:  tc.every,
+				LastConnection:   3,
+			}
+			var covered []uint64
+			for connection := uint64(3); connection <= 12; connection++ {
+				if wrapper.Covers(connection) {
+					covered = append(covered, connection)
+				}
+			}
+			if !reflect.DeepEqual(covered, tc.covered) {
+				t.Errorf("Expected the connections %v to be covered, got %v", tc.covered, covered)
+			}
+		})
+	}
+}
+
+func TestToxicOutOfScopeIsNotApplied(t *testing.T) {
+	wrapper := &toxics.ToxicWrapper{
+		Toxic:            dropToxic{},
+		Toxicity:         1,
+		FirstConnections: 1,
+		Stats:            toxics.NewToxicStats(),
+	}
+	applied := func(connection uint64) bool {
+		input := make(chan *stream.StreamChunk, 1)
+		output := make(chan *stream.StreamChunk, 1)
+		stub := toxics.NewToxicStub(input, output)
+		stub.SetConnection(connection)
+		go stub.Run(wrapper)
+
+		input <- &stream.StreamChunk{Data: []byte("hello")}
+		close(input)
+		return <-output == nil
+	}
+
+	if !applied(1) {
+		t.Error("Expected the toxic to apply to the first connection")
+	}
+	if applied(2) {
+		t.Error("Expected the toxic not to apply to the second connection")
+	}
+	if activations := wrapper.Stats.Counters().Activations; activations != 1 {
+		t.Errorf("Expected 1 activation, got %d", activations)
+	}
+}
@@ -0,0 +1,172 @@
+package toxics
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// triggerWindow is the number of bytes of the previous chunks kept to match
+// the pattern of a trigger across chunks.
+const triggerWindow = 4096
+
+// Pattern is a regular expression, written as a string in JSON.
+type Pattern struct {
+	*regexp.Regexp
+}
+
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+	var expr string
+	err := json.Unmarshal(data, &expr)
+	if err != nil {
+		return err
+	}
+	if expr == "" {
+		p.Regexp = nil
+		return nil
+	}
+	p.Regexp, err = regexp.Compile(expr)
+	return err
+}
+
+func (p Pattern) MarshalJSON() ([]byte, error) {
+	if p.Regexp == nil {
+		return json.Marshal("")
+	}
+	return json.Marshal(p.String())
+}
+
+// TriggerAction is what a trigger toxic does to the data once its pattern
+// matched.
+type TriggerAction string
+
+const (
+	TriggerReset  TriggerAction = "reset"  // Reset the connection
+	TriggerClose  TriggerAction = "close"  // Close the connection gracefully
+	TriggerDelay  TriggerAction = "delay"  // Delay the chunk matching
+	TriggerDrop   TriggerAction = "drop"   // Drop the chunk matching and all the next ones
+	TriggerInject TriggerAction = "inject" // Send data after the chunk matching
+)
+
+func (a *TriggerAction) UnmarshalJSON(data []byte) error {
+	var action string
+	err := json.Unmarshal(data, &action)
+	if err != nil {
+		return err
+	}
+	switch TriggerAction(action) {
+	case "", TriggerReset, TriggerClose, TriggerDelay, TriggerDrop, TriggerInject:
+		*a = TriggerAction(action)
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: "string " + action, Type: reflect.TypeOf(*a)}
+}
+
+// The TriggerToxic watches the data for a pattern, and applies its action once
+// the pattern matches, e.g. to fail the requests of a single endpoint whatever
+// the protocol. The data passes through until then.
+type TriggerToxic struct {
+	// Regular expression matched against the last 4KB of data.
+	Pattern Pattern `json:"pattern"`
+	// Reset by default.
+	Action TriggerAction `json:"action"`
+	// Time in milliseconds of the delay action.
+	Delay int64 `json:"delay"`
+	// Data sent by the inject action.
+	Data string `json:"data"`
+}
+
+type TriggerToxicState struct {
+	tail     []byte // Of the data already matched
+	dropping bool
+}
+
+// matches reports whether the pattern matches the chunk, or the data before
+// it and the chunk together.
+func (t *TriggerToxic) matches(state *TriggerToxicState, data []byte) bool {
+	if t.Pattern.Regexp == nil {
+		return false
+	}
+	buf := append(state.tail, data...)
+	matched := false
+	for _, loc := range t.Pattern.FindAllIndex(buf, -1) {
+		// The matches within the tail were found with the previous chunks.
+		if loc[1] > len(state.tail) {
+			matched = true
+			break
+		}
+	}
+	state.tail = append([]byte(nil), buf[max(len(buf)-triggerWindow, 0):]...)
+	return matched
+}
+
+func (t *TriggerToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*TriggerToxicState)
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if state.dropping {
+				// Drop the data on the ground.
+				stub.Stats.AddChunk(len(c.Data))
+				continue
+			}
+			if !t.matches(state, c.Data) {
+				stub.Output <- c
+				continue
+			}
+
+			stub.Stats.AddChunk(len(c.Data))
+			switch t.Action {
+			case TriggerClose:
+				stub.Stats.AddClose()
+				stub.Close()
+				return
+			case TriggerDelay:
+				delay := time.Duration(t.Delay) * time.Millisecond
+				select {
+				case <-time.After(delay):
+				case <-stub.Interrupt:
+					stub.Output <- c // Don't drop any data on the floor
+					return
+				}
+				c.Timestamp = c.Timestamp.Add(delay)
+				stub.Output <- c
+			case TriggerDrop:
+				state.dropping = true
+			case TriggerInject:
+				stub.Output <- c
+				if t.Data != "" {
+					stub.Output <- &stream.StreamChunk{Data: []byte(t.Data), Timestamp: time.Now()}
+				}
+			default:
+				stub.Stats.AddClose()
+				stub.Reset()
+				return
+			}
+		}
+	}
+}
+
+func (t *TriggerToxic) NewState() interface{} {
+	return new(TriggerToxicState)
+}
+
+func (t *TriggerToxic) Validate() error {
+	return firstError(
+		required("pattern", t.Pattern.Regexp != nil),
+		nonNegative("delay", t.Delay),
+	)
+}
+
+func init() {
+	Register("trigger", new(TriggerToxic))
+}
@@ -0,0 +1,99 @@
+package toxics_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// runTrigger sends the chunks through a trigger toxic and returns what came
+// out of it, and whether the stub was reset.
+func runTrigger(t *testing.T, attrs string, chunks ...string) ([]string, bool) {
+	t.Helper()
+	toxic := new(toxics.TriggerToxic)
+	err := json.Unmarshal([]byte(attrs), toxic)
+	if err != nil {
+		t.Fatal("Failed to parse the attributes:", err)
+	}
+
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	reset := false
+	stub.OnReset = func() { reset = true }
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		toxic.Pipe(stub)
+	}()
+	for _, chunk := range chunks {
+		select {
+		case input <- &stream.StreamChunk{Data: []byte(chunk), Timestamp: time.Now()}:
+		case <-done:
+		}
+	}
+	select {
+	case input <- nil:
+	case <-done:
+	}
+	<-done
+
+	var result []string
+	for chunk := range output {
+		result = append(result, string(chunk.Data))
+	}
+	return result, reset
+}
+
+func TestTriggerToxicResetsOnMatch(t *testing.T) {
+	result, reset := runTrigger(t, `{"pattern": "GET /fail"}`,
+		"GET /ok HTTP/1.1\r\n", "GET /fa", "il HTTP/1.1\r\n", "GET /ok HTTP/1.1\r\n")
+	if !reset {
+		t.Error("Expected the connection to be reset on a match across chunks")
+	}
+	if len(result) != 2 || result[1] != "GET /fa" {
+		t.Errorf("Expected the data before the match only, got %q", result)
+	}
+}
+
+func TestTriggerToxicActions(t *testing.T) {
+	result, _ := runTrigger(t, `{"pattern": "b+", "action": "drop"}`, "a", "bb", "a")
+	if len(result) != 1 || result[0] != "a" {
+		t.Errorf("Expected the data from the match on to be dropped, got %q", result)
+	}
+
+	result, _ = runTrigger(t, `{"pattern": "b", "action": "inject", "data": "!"}`, "a", "b", "a")
+	if len(result) != 4 || result[2] != "!" {
+		t.Errorf("Expected data to be injected after the match, got %q", result)
+	}
+
+	start := time.Now()
+	result, reset := runTrigger(t, `{"pattern": "b", "action": "delay", "delay": 50}`, "a", "b")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || len(result) != 2 || reset {
+		t.Errorf("Expected the match to be delayed, got %q after %s", result, elapsed)
+	}
+
+	result, reset = runTrigger(t, `{"pattern": "b", "action": "close"}`, "a", "b", "a")
+	if len(result) != 1 || reset {
+		t.Errorf("Expected the connection to be closed gracefully, got %q", result)
+	}
+}
+
+func TestTriggerToxicRejectsInvalidAttributes(t *testing.T) {
+	for _, attrs := range []string{`{"pattern": "("}`, `{"action": "explode"}`} {
+		err := json.Unmarshal([]byte(attrs), new(toxics.TriggerToxic))
+		if err == nil {
+			t.Errorf("Expected %s to be rejected", attrs)
+		}
+	}
+
+	data, err := json.Marshal(&toxics.TriggerToxic{})
+	if err != nil || string(data) != `{"pattern":"","action":"","delay":0,"data":""}` {
+		t.Errorf("Unexpected JSON of the toxic: %s %v", data, err)
+	}
+}
@@ -0,0 +1,74 @@
+package toxics
+
+import "fmt"
+
+// A ValidatedToxic checks its attributes once they are decoded, so that a
+// toxic created or updated with attributes it can't use is rejected instead
+// of silently doing nothing, e.g. with a negative latency.
+type ValidatedToxic interface {
+	// Validate returns an *AttributeError for the first invalid attribute.
+	Validate() error
+}
+
+// AttributeError is an attribute of a toxic that is unknown, missing or out
+// of its range.
+type AttributeError struct {
+	// Name of the attribute in JSON, e.g. "latency".
+	Attribute string
+	Message   string
+}
+
+func (e *AttributeError) Error() string {
+	return e.Attribute + " " + e.Message
+}
+
+// Validate returns the first error of a toxic that is a ValidatedToxic.
+func Validate(toxic Toxic) error {
+	if validated, ok := toxic.(ValidatedToxic); ok {
+		return validated.Validate()
+	}
+	return nil
+}
+
+// firstError returns the first error that is not nil.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nonNegative rejects a negative value of an attribute.
+func nonNegative[T int | int64](attribute string, value T) error {
+	if value < 0 {
+		return &AttributeError{attribute, "must not be negative"}
+	}
+	return nil
+}
+
+// inRange rejects a value of an attribute out of an inclusive range.
+func inRange[T int | int64 | float32](attribute string, value, low, high T) error {
+	if value < low || value > high {
+		return &AttributeError{attribute, fmt.Sprintf("must be from %v to %v", low, high)}
+	}
+	return nil
+}
+
+// notAbove rejects the low value of a range above its high value, unless the
+// high value is not set.
+func notAbove(attribute string, low, high int64, highAttribute string) error {
+	if high > 0 && low > high {
+		return &AttributeError{attribute, "must not be greater than " + highAttribute}
+	}
+	return nil
+}
+
+// required rejects an attribute that is not set.
+func required(attribute string, set bool) error {
+	if !set {
+		return &AttributeError{attribute, "is required"}
+	}
+	return nil
+}
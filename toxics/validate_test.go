@@ -0,0 +1,48 @@
+package toxics_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+func TestValidateRejectsTheAttributesOutOfRange(t *testing.T) {
+	for _, test := range []struct {
+		toxic     toxics.Toxic
+		attribute string
+	}{
+		{&toxics.LatencyToxic{Jitter: -1}, "jitter"},
+		{&toxics.BandwidthToxic{Rate: -1}, "rate"},
+		{&toxics.SlicerToxic{AverageSize: 10, SizeVariation: 20}, "size_variation"},
+		{&toxics.SlicerToxic{LengthSize: 9}, "length_size"},
+		{&toxics.ChurnToxic{MinLifetime: 10, MaxLifetime: 5}, "min_lifetime"},
+		{&toxics.GzipToxic{Level: 10}, "level"},
+		{&toxics.DNSToxic{Probability: 1.5}, "probability"},
+		{&toxics.ReplyToxic{}, "pattern"},
+	} {
+		var attrErr *toxics.AttributeError
+		err := toxics.Validate(test.toxic)
+		if !errors.As(err, &attrErr) || attrErr.Attribute != test.attribute {
+			t.Errorf("Expected %T to have an invalid %s, got %v", test.toxic, test.attribute, err)
+		}
+	}
+}
+
+func TestValidateAcceptsTheDefaults(t *testing.T) {
+	for _, typeName := range toxics.Types() {
+		wrapper := &toxics.ToxicWrapper{Type: typeName}
+		toxic := toxics.New(wrapper)
+		if typeName == "reply" || typeName == "trigger" {
+			continue // The pattern is required.
+		}
+		err := toxics.Validate(toxic)
+		if err != nil {
+			t.Errorf("Expected the defaults of %s to be valid, got %v", typeName, err)
+		}
+	}
+	err := toxics.Validate(&toxics.RandomResetToxic{MinBytes: 10})
+	if err != nil {
+		t.Errorf("Expected a minimum without a maximum to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package toxics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// Opcodes of the WebSocket frames, by their name.
+var websocketOpcodes = map[string]byte{
+	"text":   1,
+	"binary": 2,
+	"close":  8,
+	"ping":   9,
+	"pong":   10,
+}
+
+const (
+	websocketContinuation = 0
+	websocketClose        = 8
+	// websocketMaxHandshake is the size of a handshake after which the data is
+	// passed through, as it is likely not HTTP.
+	websocketMaxHandshake = 64 << 10
+)
+
+// WebSocketFrames are the opcodes of the frames dropped by a WebSocket toxic,
+// written in JSON as a name or a list of names, e.g. ["ping", "pong"].
+type WebSocketFrames []byte
+
+func (f *WebSocketFrames) UnmarshalJSON(data []byte) error {
+	var names []string
+	if json.Unmarshal(data, &names) != nil {
+		var name string
+		err := json.Unmarshal(data, &name)
+		if err != nil {
+			return err
+		}
+		names = []string{name}
+	}
+
+	frames := WebSocketFrames{}
+	for _, name := range names {
+		opcode, ok := websocketOpcodes[name]
+		if !ok {
+			return &json.UnmarshalTypeError{Value: "string " + name, Type: reflect.TypeOf(*f)}
+		}
+		frames = append(frames, opcode)
+	}
+	*f = frames
+	return nil
+}
+
+func (f WebSocketFrames) MarshalJSON() ([]byte, error) {
+	names := []string{}
+	for _, opcode := range f {
+		for name, o := range websocketOpcodes {
+			if o == opcode {
+				names = append(names, name)
+			}
+		}
+	}
+	return json.Marshal(names)
+}
+
+// The WebSocketToxic follows the frames of a WebSocket connection, after its
+// HTTP handshake, to drop the frames of some types, e.g. pings, to delay or
+// corrupt messages, or to close the connection with a close frame of a code,
+// so that the reconnects of realtime applications can be tested.
+type WebSocketToxic struct {
+	// Types of the frames dropped
+	Drop WebSocketFrames `json:"drop"`
+	// Time in milliseconds the messages are delayed by
+	Delay int64 `json:"delay"`
+	// Flip the bits of the first byte of the messages
+	Corrupt bool `json:"corrupt"`
+	// Send a close frame with this code instead of a message, if set
+	CloseCode uint16 `json:"close_code"`
+	// Reason of the close frame
+	CloseReason string `json:"close_reason"`
+	// Fraction of the messages that are affected, all of them if 0
+	Probability float32 `json:"probability"`
+}
+
+type WebSocketToxicState struct {
+	started    bool
+	lost       bool   // The data passes through once it isn't WebSocket
+	upgraded   bool   // The handshake was sent
+	handshake  []byte // Start of the handshake, until it is whole
+	head       []byte // Header of the next frame, until it is read
+	remaining  int    // Bytes of the current frame left
+	dropping   bool   // The current frame is dropped
+	control    bool   // The current frame is a control frame
+	corrupting bool   // The next byte of the current message is corrupted
+	closed     bool   // The close frame was sent, the next frames are dropped
+}
+
+// websocketHeader returns the size of the header of a frame from its first two
+// bytes.
+func websocketHeader(head []byte) int {
+	size := 2
+	switch head[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if head[1]&0x80 != 0 {
+		size += 4 // Masking key
+	}
+	return size
+}
+
+// websocketLength returns the length of the payload of a whole header.
+func websocketLength(head []byte) int {
+	switch head[1] & 0x7f {
+	case 126:
+		return int(binary.BigEndian.Uint16(head[2:]))
+	case 127:
+		return int(binary.BigEndian.Uint64(head[2:]) & (1<<62 - 1))
+	}
+	return int(head[1] & 0x7f)
+}
+
+// websocketUpgrade reports whether a whole handshake starts a WebSocket connection.
+func websocketUpgrade(handshake []byte, direction stream.Direction) bool {
+	if direction == stream.Downstream {
+		return bytes.HasPrefix(handshake, []byte("HTTP/1.1 101"))
+	}
+	return bytes.Contains(bytes.ToLower(handshake), []byte("\r\nupgrade: websocket"))
+}
+
+func (t *WebSocketToxic) Pipe(stub *ToxicStub) {
+	state := stub.State.(*WebSocketToxicState)
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its frames can't be found.
+		state.lost = stub.Late
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				t.Cleanup(stub)
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			w := websocketChunk{toxic: t, stub: stub, state: state, chunk: c}
+			w.run()
+			if w.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// Cleanup sends the start of the handshake or of the frame held once the toxic
+// is removed.
+func (t *WebSocketToxic) Cleanup(stub *ToxicStub) {
+	state := stub.State.(*WebSocketToxicState)
+	if held := append(state.handshake, state.head...); len(held) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: held, Timestamp: time.Now()}
+		state.handshake, state.head = nil, nil
+	}
+}
+
+func (t *WebSocketToxic) NewState() interface{} {
+	return new(WebSocketToxicState)
+}
+
+// websocketChunk parses a chunk of data of a WebSocket toxic.
+type websocketChunk struct {
+	toxic       *WebSocketToxic
+	stub        *ToxicStub
+	state       *WebSocketToxicState
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the toxic applied.
+func (w *websocketChunk) run() {
+	state := w.state
+	data := w.chunk.Data
+	defer w.flush()
+	for len(data) > 0 {
+		if state.lost {
+			w.out = append(w.out, data...)
+			return
+		}
+
+		if !state.upgraded {
+			data = w.handshake(data)
+			continue
+		}
+
+		if state.remaining > 0 {
+			n := min(state.remaining, len(data))
+			w.payload(data[:n])
+			data = data[n:]
+			state.remaining -= n
+			continue
+		}
+
+		if len(state.head) < 2 {
+			state.head = append(state.head, data[0])
+			data = data[1:]
+			if len(state.head) < 2 {
+				continue
+			}
+		}
+		size := websocketHeader(state.head)
+		n := min(size-len(state.head), len(data))
+		state.head = append(state.head, data[:n]...)
+		data = data[n:]
+		if len(state.head) < size {
+			continue
+		}
+
+		head := state.head
+		state.head = nil
+		state.remaining = websocketLength(head)
+		w.begin(head)
+		w.send(head)
+	}
+}
+
+// handshake reads the HTTP handshake, and returns the data after it.
+func (w *websocketChunk) handshake(data []byte) []byte {
+	state := w.state
+	start := max(len(state.handshake)-3, 0)
+	state.handshake = append(state.handshake, data...)
+	end := bytes.Index(state.handshake[start:], []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(state.handshake) > websocketMaxHandshake {
+			state.lost = true
+			w.out = append(w.out, state.handshake...)
+			state.handshake = nil
+		}
+		return nil
+	}
+
+	end += start + 4
+	handshake := state.handshake[:end]
+	rest := state.handshake[end:]
+	state.handshake = nil
+	w.out = append(w.out, handshake...)
+	state.upgraded = true
+	state.lost = !websocketUpgrade(handshake, w.stub.Direction)
+	return rest
+}
+
+// begin applies the toxic to a frame starting.
+func (w *websocketChunk) begin(head []byte) {
+	state := w.state
+	opcode := head[0] & 0x0f
+	state.control = opcode >= websocketClose
+	state.dropping = state.closed
+	if state.closed {
+		return
+	}
+	if slices.Contains(w.toxic.Drop, opcode) {
+		w.stub.Stats.AddChunk(len(w.chunk.Data))
+		state.dropping = true
+		return
+	}
+	// Messages start with a frame of text or binary data.
+	if opcode == websocketContinuation || state.control {
+		return
+	}
+	if w.toxic.Probability > 0 && w.stub.Rand().Float32() >= w.toxic.Probability {
+		state.corrupting = false
+		return
+	}
+
+	w.stub.Stats.AddChunk(len(w.chunk.Data))
+	if w.toxic.CloseCode != 0 {
+		w.out = append(w.out, w.closeFrame(head[1]&0x80 != 0)...)
+		state.closed = true
+		state.dropping = true
+		return
+	}
+	state.corrupting = w.toxic.Corrupt
+	if w.toxic.Delay > 0 && !w.interrupted {
+		w.flush()
+		delay := time.Duration(w.toxic.Delay) * time.Millisecond
+		select {
+		case <-time.After(delay):
+			w.stub.Stats.AddDelay(delay)
+		case <-w.stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			w.interrupted = true
+		}
+	}
+}
+
+// closeFrame returns the close frame of the toxic, masked with a key of zeros
+// when sent by a client.
+func (w *websocketChunk) closeFrame(masked bool) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, w.toxic.CloseCode)
+	payload = append(payload, w.toxic.CloseReason...)
+	payload = payload[:min(len(payload), 125)]
+	frame := []byte{0x80 | websocketClose, byte(len(payload))}
+	if masked {
+		frame[1] |= 0x80
+		frame = append(frame, 0, 0, 0, 0)
+	}
+	return append(frame, payload...)
+}
+
+// send sends data of the current frame, unless it is dropped.
+func (w *websocketChunk) send(data []byte) {
+	if !w.state.dropping {
+		w.out = append(w.out, data...)
+	}
+}
+
+// payload sends the payload of the current frame. The bits of the first byte
+// of a message corrupted are flipped, which works as well for masked frames.
+func (w *websocketChunk) payload(data []byte) {
+	state := w.state
+	w.send(data)
+	if state.corrupting && !state.control && !state.dropping {
+		w.out[len(w.out)-len(data)] ^= 0xff
+		state.corrupting = false
+	}
+}
+
+func (w *websocketChunk) flush() {
+	if len(w.out) > 0 {
+		w.stub.Output <- &stream.StreamChunk{Data: w.out, Timestamp: w.chunk.Timestamp}
+		w.out = nil
+	}
+}
+
+func (t *WebSocketToxic) Validate() error {
+	return firstError(
+		nonNegative("delay", t.Delay),
+		inRange("probability", t.Probability, 0, 1),
+	)
+}
+
+func init() {
+	Register("websocket", new(WebSocketToxic))
+}
@@ -0,0 +1,87 @@
+package toxics_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+var (
+	wsRequest = []byte("GET /chat HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\n" +
+		"Connection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	wsResponse = []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n\r\n")
+	wsPing = []byte("\x89\x00")
+	wsPong = []byte("\x8a\x00")
+	// A text message in two frames, with a ping between them.
+	wsMessage = []byte("\x01\x03Hel\x89\x00\x80\x02lo")
+	// A masked text message of a client.
+	wsMasked = []byte("\x81\x82\x01\x02\x03\x04\x69\x6b")
+)
+
+// runWS runs the toxic on the downstream, as sent by a server.
+func runWS(t *testing.T, toxic *toxics.WebSocketToxic, chunks ...[]byte) []byte {
+	t.Helper()
+	result, _ := runStub(t, toxic, func(stub *toxics.ToxicStub) {
+		stub.Direction = stream.Downstream
+	}, chunks...)
+	return result
+}
+
+func TestWebSocketToxicDropsFrames(t *testing.T) {
+	toxic := new(toxics.WebSocketToxic)
+	err := json.Unmarshal([]byte(`{"drop": ["ping", "pong"]}`), toxic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The handshake and the message are split across chunks.
+	data := append(append(append([]byte(nil), wsResponse...), wsPong...), wsMessage...)
+	result := runWS(t, toxic, data[:10], data[10:len(wsResponse)+1], data[len(wsResponse)+1:])
+	checkWire(t, result, wsResponse, []byte("\x01\x03Hel\x80\x02lo"))
+
+	err = json.Unmarshal([]byte(`{"drop": "pang"}`), toxic)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("Expected an invalid frame to be rejected, got %v", err)
+	}
+}
+
+func TestWebSocketToxicCorruptsMessages(t *testing.T) {
+	toxic := &toxics.WebSocketToxic{Corrupt: true}
+	result := runWS(t, toxic, wsResponse, wsPing, wsMessage)
+	checkWire(t, result, wsResponse, wsPing, []byte("\x01\x03\xb7el\x89\x00\x80\x02lo"))
+
+	result, _ = runWire(t, toxic, false, wsRequest, wsMasked)
+	checkWire(t, result, wsRequest, []byte("\x81\x82\x01\x02\x03\x04\x96\x6b"))
+}
+
+func TestWebSocketToxicClosesWithACode(t *testing.T) {
+	toxic := &toxics.WebSocketToxic{CloseCode: 1012, CloseReason: "restart"}
+	result := runWS(t, toxic, wsResponse, wsPing, wsMessage, wsPing)
+	checkWire(t, result, wsResponse, wsPing, []byte("\x88\x09\x03\xf4restart"))
+
+	// The close frames of clients are masked.
+	result, _ = runWire(t, toxic, false, wsRequest, wsMasked)
+	checkWire(t, result, wsRequest, []byte("\x88\x89\x00\x00\x00\x00\x03\xf4restart"))
+}
+
+func TestWebSocketToxicDelaysMessages(t *testing.T) {
+	toxic := &toxics.WebSocketToxic{Delay: 50}
+	start := time.Now()
+	result := runWS(t, toxic, wsResponse, wsPing, wsMessage, wsMessage)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected both messages to be delayed, took %s", elapsed)
+	}
+	checkWire(t, result, wsResponse, wsPing, wsMessage, wsMessage)
+}
+
+func TestWebSocketToxicPassesUnknownStreamsThrough(t *testing.T) {
+	toxic := &toxics.WebSocketToxic{Corrupt: true}
+	result := runWS(t, toxic, []byte("HTTP/1.1 200 OK\r\n\r\n"), wsMessage)
+	checkWire(t, result, []byte("HTTP/1.1 200 OK\r\n\r\n"), wsMessage)
+
+	result, _ = runWire(t, toxic, true, wsMasked)
+	checkWire(t, result, wsMasked)
+}
@@ -0,0 +1,242 @@
+package toxics
+
+import (
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+// wirePrefix is the number of bytes of the payload of a message kept for the
+// parser, enough for the status of the messages ending a response.
+const wirePrefix = 32
+
+// wireParser follows the messages a database server sends, so that a toxic
+// can act on whole query responses without corrupting the protocol.
+type wireParser interface {
+	// headerSize returns the size of the header of the next message, given
+	// its first byte.
+	headerSize(first byte) int
+	// payloadSize returns the size of the payload after the header, or -1 if
+	// the stream can't be followed.
+	payloadSize(header []byte) int
+	// begins reports whether the message begins a response, between two
+	// responses. Other messages can be sent by the server at any time.
+	begins(header []byte) bool
+	// ends parses a whole message, given the start of its payload, and
+	// reports whether it ends a response or the startup of the connection.
+	ends(header, prefix []byte, size int) bool
+	// keeps reports whether a message of a response replaced by an error is
+	// still sent, e.g. to tell the client the server is ready again.
+	keeps(header []byte) bool
+	// synced is false once the stream can't be followed, e.g. once it is
+	// encrypted.
+	synced() bool
+}
+
+// wireActions are what a database toxic does to the query responses.
+type wireActions struct {
+	delay   time.Duration // Of each response
+	failure []byte        // Error replacing each response, if set
+	kill    bool          // Close the connection between two queries
+	close   CloseMode
+}
+
+type wireState struct {
+	parser  wireParser
+	started bool // The stub ran before
+	lost    bool // The data passes through once the stream can't be followed
+
+	header     []byte
+	headerSize int
+	prefix     []byte
+	size       int  // Of the payload of the current message
+	remaining  int  // Bytes of the payload left, -1 while reading the header
+	ready      bool // The connection started
+	inside     bool // A response is being sent
+	failing    bool // The response is replaced by an error
+}
+
+func newWireState(parser wireParser) *wireState {
+	return &wireState{parser: parser, remaining: -1}
+}
+
+// between reports whether the connection is between two queries.
+func (s *wireState) between() bool {
+	return !s.lost && s.ready && !s.inside && s.remaining < 0 && len(s.header) == 0
+}
+
+// pipeWire runs a database toxic with the actions on the stub.
+func pipeWire(stub *ToxicStub, state *wireState, actions wireActions) {
+	if !state.started {
+		state.started = true
+		// The start of the stream was missed, its messages can't be found.
+		state.lost = stub.Late
+	}
+	if actions.kill && state.between() {
+		stub.Stats.AddClose()
+		stub.CloseWith(actions.close)
+		return
+	}
+
+	for {
+		select {
+		case <-stub.Interrupt:
+			return
+		case c := <-stub.Input:
+			if c == nil {
+				stub.Close()
+				return
+			}
+			if state.lost {
+				stub.Output <- c
+				continue
+			}
+
+			w := wireChunk{stub: stub, state: state, actions: actions, chunk: c}
+			if w.run() {
+				stub.Stats.AddClose()
+				stub.CloseWith(actions.close)
+				return
+			}
+			if w.interrupted {
+				return
+			}
+		}
+	}
+}
+
+// cleanupWire sends the start of the message held once a database toxic is
+// removed.
+func cleanupWire(stub *ToxicStub, state *wireState) {
+	// The header is sent once whole.
+	if state.remaining < 0 && len(state.header) > 0 {
+		stub.Output <- &stream.StreamChunk{Data: state.header, Timestamp: time.Now()}
+		state.header = nil
+	}
+}
+
+// wireChunk parses a chunk of data of a database toxic.
+type wireChunk struct {
+	stub        *ToxicStub
+	state       *wireState
+	actions     wireActions
+	chunk       *stream.StreamChunk
+	out         []byte
+	interrupted bool
+}
+
+// run sends the data of the chunk with the actions applied, and reports
+// whether the connection is killed after it.
+func (w *wireChunk) run() bool {
+	state := w.state
+	data := w.chunk.Data
+	defer w.flush()
+	for len(data) > 0 {
+		if state.lost {
+			w.out = append(w.out, data...)
+			return false
+		}
+
+		if state.remaining < 0 {
+			if len(state.header) == 0 {
+				state.headerSize = state.parser.headerSize(data[0])
+			}
+			n := min(state.headerSize-len(state.header), len(data))
+			state.header = append(state.header, data[:n]...)
+			data = data[n:]
+			if !state.parser.synced() {
+				w.lose()
+				continue
+			}
+			if len(state.header) < state.headerSize {
+				continue
+			}
+
+			state.size = state.parser.payloadSize(state.header)
+			if state.size < 0 {
+				w.lose()
+				continue
+			}
+			state.remaining = state.size
+			state.prefix = state.prefix[:0]
+			if state.ready && !state.inside && state.parser.begins(state.header) {
+				if !state.parser.synced() {
+					w.lose()
+					continue
+				}
+				w.begin()
+			}
+			w.send(state.header)
+		}
+
+		n := min(state.remaining, len(data))
+		keep := min(wirePrefix-len(state.prefix), n)
+		state.prefix = append(state.prefix, data[:keep]...)
+		w.send(data[:n])
+		data = data[n:]
+		state.remaining -= n
+		if state.remaining > 0 {
+			continue
+		}
+
+		ends := state.parser.ends(state.header, state.prefix, state.size)
+		state.header = state.header[:0]
+		state.remaining = -1
+		if !state.parser.synced() {
+			w.lose()
+			continue
+		}
+		if ends {
+			state.ready = true
+			state.inside = false
+			state.failing = false
+			if w.actions.kill && state.between() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// begin applies the actions to the response starting.
+func (w *wireChunk) begin() {
+	w.state.inside = true
+	if w.actions.delay > 0 || w.actions.failure != nil {
+		w.stub.Stats.AddChunk(len(w.chunk.Data))
+	}
+	if w.actions.delay > 0 && !w.interrupted {
+		w.flush()
+		select {
+		case <-time.After(w.actions.delay):
+			w.stub.Stats.AddDelay(w.actions.delay)
+		case <-w.stub.Interrupt:
+			// The rest of the chunk is sent right away.
+			w.interrupted = true
+		}
+	}
+	if w.actions.failure != nil {
+		w.state.failing = true
+		w.out = append(w.out, w.actions.failure...)
+	}
+}
+
+// send sends data of the current message, unless its response is replaced.
+func (w *wireChunk) send(data []byte) {
+	if !w.state.failing || w.state.parser.keeps(w.state.header) {
+		w.out = append(w.out, data...)
+	}
+}
+
+// lose passes the data through from the current message on.
+func (w *wireChunk) lose() {
+	w.state.lost = true
+	w.out = append(w.out, w.state.header...)
+	w.state.header = w.state.header[:0]
+}
+
+func (w *wireChunk) flush() {
+	if len(w.out) > 0 {
+		w.stub.Output <- &stream.StreamChunk{Data: w.out, Timestamp: w.chunk.Timestamp}
+		w.out = nil
+	}
+}
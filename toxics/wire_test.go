@@ -0,0 +1,69 @@
+package toxics_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+type wireToxic interface {
+	toxics.Toxic
+	toxics.StatefulToxic
+}
+
+// runWire sends the chunks through a database toxic and returns the data
+// that came out of it, and the number of times it closed the connection.
+func runWire(t *testing.T, toxic wireToxic, late bool, chunks ...[]byte) ([]byte, int64) {
+	t.Helper()
+	return runStub(t, toxic, func(stub *toxics.ToxicStub) { stub.Late = late }, chunks...)
+}
+
+// runStub runs a toxic like runWire, with the stub set up first.
+func runStub(
+	t *testing.T,
+	toxic wireToxic,
+	setup func(*toxics.ToxicStub),
+	chunks ...[]byte,
+) ([]byte, int64) {
+	t.Helper()
+	input := make(chan *stream.StreamChunk)
+	output := make(chan *stream.StreamChunk, 100)
+	stub := toxics.NewToxicStub(input, output)
+	stub.State = toxic.NewState()
+	stub.Stats = toxics.NewToxicStats()
+	setup(stub)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		toxic.Pipe(stub)
+	}()
+	for _, chunk := range chunks {
+		select {
+		case input <- &stream.StreamChunk{Data: chunk, Timestamp: time.Now()}:
+		case <-done:
+		}
+	}
+	select {
+	case input <- nil:
+	case <-done:
+	}
+	<-done
+
+	var result []byte
+	for chunk := range output {
+		result = append(result, chunk.Data...)
+	}
+	return result, stub.Stats.Counters().Closes
+}
+
+// checkWire checks the data that came out of a database toxic.
+func checkWire(t *testing.T, result []byte, expected ...[]byte) {
+	t.Helper()
+	if want := bytes.Join(expected, nil); !bytes.Equal(result, want) {
+		t.Errorf("Expected %q, got %q", want, result)
+	}
+}
@@ -0,0 +1,74 @@
+// Package toxiproxytest starts in-process Toxiproxy servers for Go tests, in the
+// way net/http/httptest does for HTTP servers.
+package toxiproxytest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2"
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+// Server is a Toxiproxy server listening on an ephemeral port of localhost.
+type Server struct {
+	URL    string          // Base URL of the API, e.g. http://127.0.0.1:49152
+	Client *tclient.Client // Client of the API
+	API    *toxiproxy.ApiServer
+
+	t    testing.TB
+	http *httptest.Server
+}
+
+// NewServer starts a server that is closed, with all its proxies, when the
+// test and its subtests complete.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	api := toxiproxy.New()
+	http := httptest.NewServer(api.Routes())
+
+	server := &Server{
+		URL:    http.URL,
+		Client: tclient.NewClient(http.URL),
+		API:    api,
+		t:      t,
+		http:   http,
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Proxy creates a proxy to upstream listening on an ephemeral port of
+// localhost, its Listen field holds the address to connect to. The test fails
+// if the proxy can't be created.
+func (server *Server) Proxy(name, upstream string) *tclient.Proxy {
+	server.t.Helper()
+
+	proxy, err := server.Client.CreateProxy(name, "localhost:0", upstream)
+	if err != nil {
+		server.t.Fatalf("Failed to create proxy %s: %v", name, err)
+	}
+	return proxy
+}
+
+// Reset removes the toxics of all proxies and enables them, e.g. between the
+// cases of a table driven test.
+func (server *Server) Reset() {
+	server.t.Helper()
+
+	err := server.Client.ResetState()
+	if err != nil {
+		server.t.Fatalf("Failed to reset proxies: %v", err)
+	}
+}
+
+// Close stops all proxies and the server. It is called by the cleanup of the
+// test, and can be called more than once.
+func (server *Server) Close() {
+	server.http.Close()
+	err := server.API.Collection.Clear()
+	if err != nil {
+		server.t.Errorf("Failed to stop proxies: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package toxiproxytest_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/Shopify/toxiproxy/v2/testhelper"
+	"github.com/Shopify/toxiproxy/v2/toxiproxytest"
+)
+
+func TestServerProxiesToUpstream(t *testing.T) {
+	server := toxiproxytest.NewServer(t)
+
+	testhelper.WithTCPServer(t, func(upstream string, response chan []byte) {
+		proxy := server.Proxy("test", upstream)
+
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy", err)
+		}
+		msg := []byte("hello world")
+		_, err = conn.Write(msg)
+		if err != nil {
+			t.Fatal("Failed writing to proxy", err)
+		}
+		conn.Close()
+
+		if resp := <-response; !bytes.Equal(resp, msg) {
+			t.Errorf("Expected %q upstream, got %q", msg, resp)
+		}
+	})
+
+	server.Close()
+	proxies := server.API.Collection.Proxies()
+	if len(proxies) != 0 {
+		t.Errorf("Expected the proxies to be stopped, got %v", proxies)
+	}
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	first := toxiproxytest.NewServer(t)
+	second := toxiproxytest.NewServer(t)
+
+	first.Proxy("test", "localhost:20001")
+	second.Proxy("test", "localhost:20001")
+
+	if first.URL == second.URL {
+		t.Errorf("Expected servers on different ports, both on %s", first.URL)
+	}
+}
@@ -0,0 +1,80 @@
+package toxiproxy
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Shopify/toxiproxy/v2/toxics"
+)
+
+// Spans are emitted through the global OpenTelemetry tracer provider, which is
+// a noop until one is registered (see the -tracing flag of toxiproxy-server).
+const tracerName = "github.com/Shopify/toxiproxy/v2"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// statusRecorder captures the status code written by an http.Handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// tracingMiddleware starts a span for every API request, continuing the trace
+// of the caller if it sent trace context headers.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		name := r.Method + " " + r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() != "" {
+			name = route.GetName()
+		}
+
+		ctx, span := tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if vars := mux.Vars(r); vars["proxy"] != "" {
+			span.SetAttributes(attribute.String("toxiproxy.proxy", vars["proxy"]))
+		}
+		if vars := mux.Vars(r); vars["toxic"] != "" {
+			span.SetAttributes(attribute.String("toxiproxy.toxic", vars["toxic"]))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// traceToxic adds an event for a change of the toxics on the link to its span.
+func (link *ToxicLink) traceToxic(event string, toxic *toxics.ToxicWrapper) {
+	link.span.AddEvent(event, trace.WithAttributes(
+		attribute.String("toxiproxy.toxic", toxic.Name),
+		attribute.String("toxiproxy.toxic_type", toxic.Type),
+		attribute.Float64("toxiproxy.toxicity", float64(toxic.Toxicity)),
+	))
+}
@@ -0,0 +1,91 @@
+package toxiproxy
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Shopify/toxiproxy/v2/stream"
+)
+
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestTracingApiRequest(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	srv.Routes().ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != "Version" {
+		t.Errorf("Expected span to be named after the route, got %s", spans[0].Name())
+	}
+
+	var status int64
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	if status != http.StatusOK {
+		t.Errorf("Expected status code attribute of 200, got %d", status)
+	}
+}
+
+func TestTracingToxicLink(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	proxy := NewProxy(srv, "test_tracing_toxic_link", "localhost:0", "upstream")
+	_, err := proxy.Toxics.AddToxicJson(bytes.NewBufferString(
+		`{"name":"lag","type":"latency","stream":"upstream","attributes":{"latency":1}}`,
+	))
+	if err != nil {
+		t.Fatal("AddToxicJson returned error:", err)
+	}
+
+	r := bufio.NewReader(bytes.NewBufferString("hello"))
+	w := &testWriteCloser{
+		bufio.NewWriter(bytes.NewBuffer([]byte{})),
+	}
+	closed := make(chan struct{})
+	proxy.Toxics.StartLink(srv, "testupstream", r, &notifyWriteCloser{w, closed}, stream.Upstream)
+	<-closed
+	proxy.Toxics.RemoveLink("testupstream")
+
+	var span sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "ToxicLink upstream" {
+			span = s
+		}
+	}
+	if span == nil {
+		t.Fatal("Expected a span for the link")
+	}
+
+	events := span.Events()
+	if len(events) != 1 || events[0].Name != "toxic.applied" {
+		t.Fatalf("Expected a toxic.applied event, got %+v", events)
+	}
+}
@@ -0,0 +1,95 @@
+package toxiproxy
+
+import (
+	"errors"
+	"net"
+)
+
+var errTransparentUnsupported = errors.New(
+	"transparent proxies are only supported on Linux",
+)
+
+// readTransparentDestination returns the address a client of a transparent
+// proxy connected to before its connection was redirected to the proxy.
+func (proxy *Proxy) readTransparentDestination(client net.Conn) (string, error) {
+	destination, err := originalDestination(client)
+	if err == nil && proxy.isListenAddress(destination) {
+		// Connecting to it would connect the client to the proxy again.
+		err = errors.New("the connection was not redirected to the proxy")
+	}
+	if err != nil {
+		proxy.Logger.
+			Warn().
+			Err(err).
+			Str("client", client.RemoteAddr().String()).
+			Msg("Unable to find the destination of client")
+		proxy.event(Event{
+			Type:   EventHandshakeFailed,
+			Client: client.RemoteAddr().String(),
+			Reason: err.Error(),
+		})
+		return "", err
+	}
+	return destination.String(), nil
+}
+
+// originalDestination returns the destination of a connection redirected with
+// REDIRECT, as found by netfilter, or its local address when it was redirected
+// with TPROXY, which does not change it.
+func originalDestination(conn net.Conn) (*net.TCPAddr, error) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, errors.New("the client is not a TCP connection")
+	}
+	local := tcp.LocalAddr().(*net.TCPAddr)
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var destination *net.TCPAddr
+	err = control(raw, func(fd uintptr) error {
+		var err error
+		destination, err = getOriginalDestination(fd, local.IP.To4() == nil)
+		return err
+	})
+	if err != nil {
+		// The connection was not translated, e.g. by TPROXY.
+		return local, nil
+	}
+	return destination, nil
+}
+
+func (proxy *Proxy) isListenAddress(address *net.TCPAddr) bool {
+	for _, listener := range proxy.listeners() {
+		listen, ok := listener.Addr().(*net.TCPAddr)
+		if ok && listen.Port == address.Port &&
+			(listen.IP.IsUnspecified() || listen.IP.Equal(address.IP)) {
+			return true
+		}
+	}
+	return false
+}
+
+// setTransparent lets the listeners of a transparent proxy accept connections
+// redirected with TPROXY, which needs CAP_NET_ADMIN. The connections
+// redirected with REDIRECT are accepted without it.
+func (proxy *Proxy) setTransparent() {
+	for _, listener := range proxy.listeners() {
+		tcp, ok := listener.(*net.TCPListener)
+		if !ok {
+			continue
+		}
+		raw, err := tcp.SyscallConn()
+		if err == nil {
+			err = control(raw, setTransparent)
+		}
+		if err != nil {
+			proxy.Logger.
+				Warn().
+				Err(err).
+				Msg("Unable to set IP_TRANSPARENT, connections redirected with TPROXY are not accepted")
+			return
+		}
+	}
+}
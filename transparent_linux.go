@@ -0,0 +1,54 @@
+//go:build linux
+
+package toxiproxy
+
+import (
+	"encoding/binary"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+const transparentSupported = true
+
+// soOriginalDst is SO_ORIGINAL_DST of netfilter, and IP6T_SO_ORIGINAL_DST
+// for IPv6.
+const soOriginalDst = 80
+
+// setTransparent sets IP_TRANSPARENT, which IPv6 sockets share with
+// IPV6_TRANSPARENT.
+func setTransparent(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_TRANSPARENT, 1)
+}
+
+// getOriginalDestination reads the destination of a connection translated by
+// netfilter. The structures of the getsockopt calls of the same size as the
+// socket addresses are used to read them.
+func getOriginalDestination(fd uintptr, ipv6 bool) (*net.TCPAddr, error) {
+	if ipv6 {
+		info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.SOL_IPV6, soOriginalDst)
+		if err != nil {
+			return nil, err
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(info.Addr.Addr[:]),
+			Port: int(networkOrder(info.Addr.Port)),
+		}, nil
+	}
+
+	mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, soOriginalDst)
+	if err != nil {
+		return nil, err
+	}
+	// It holds a sockaddr_in: its family, port and address.
+	return &net.TCPAddr{
+		IP:   net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7]),
+		Port: int(binary.BigEndian.Uint16(mreq.Multiaddr[2:4])),
+	}, nil
+}
+
+// networkOrder returns a port read in the network byte order.
+func networkOrder(port uint16) uint16 {
+	b := binary.NativeEndian.AppendUint16(nil, port)
+	return binary.BigEndian.Uint16(b)
+}
@@ -0,0 +1,67 @@
+package toxiproxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestOriginalDestinationOfConnectionsNotTranslated(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accepted.Close()
+
+	destination, err := originalDestination(accepted)
+	if err != nil {
+		t.Fatal("Unable to find the original destination:", err)
+	}
+	if destination.String() != listener.Addr().String() {
+		t.Errorf("Expected the destination to be %s, got %s", listener.Addr(), destination)
+	}
+}
+
+func TestTransparentProxyRefusesConnectionsNotRedirected(t *testing.T) {
+	srv := NewServer(NewMetricsContainer(prometheus.NewRegistry()), zerolog.Nop())
+
+	proxy := NewProxy(srv, "test_transparent", "localhost:0", "")
+	proxy.Protocol = ProtocolTransparent
+	err := srv.Collection.Add(proxy, true)
+	if err != nil {
+		t.Fatal("Failed to add proxy:", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Connecting to the destination would connect to the proxy again.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+	failed := waitForEvent(t, srv.Events, proxy.Name, EventHandshakeFailed)
+	if failed.Client != conn.LocalAddr().String() || failed.Reason == "" {
+		t.Errorf("Unexpected handshake failed event: %+v", failed)
+	}
+}
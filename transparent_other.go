@@ -0,0 +1,15 @@
+//go:build !linux
+
+package toxiproxy
+
+import "net"
+
+const transparentSupported = false
+
+func setTransparent(uintptr) error {
+	return errTransparentUnsupported
+}
+
+func getOriginalDestination(uintptr, bool) (*net.TCPAddr, error) {
+	return nil, errTransparentUnsupported
+}
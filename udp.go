@@ -0,0 +1,302 @@
+package toxiproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// udpMaxDatagram is the size of the largest datagram.
+	udpMaxDatagram = 64 << 10
+	// udpQueue is the number of datagrams of a client waiting to be read, the
+	// next ones are dropped as a full socket buffer would.
+	udpQueue = 64
+	// udpIdleTimeout closes the connections of the clients of a UDP proxy that
+	// sent nothing either way for this long, unless the proxy sets an idle
+	// timeout, as a client never closes its connection.
+	udpIdleTimeout = 30 * time.Second
+)
+
+// datagramConn carries the datagrams of a UDP socket over a stream, each one
+// prefixed with its length on 2 bytes as with DNS over TCP, so that they go
+// through links and toxics as the data of a TCP connection and are sent again
+// whole.
+type datagramConn struct {
+	receive   func(deadline time.Time) ([]byte, error)
+	send      func([]byte) error
+	close     func() error
+	interrupt func(time.Time) // Sets the read deadline of a blocking receive
+	local     net.Addr
+	remote    net.Addr
+	deadline  atomic.Pointer[time.Time] // Of the reads
+	wake      chan struct{}             // Signaled when the deadline changes
+	readBuf   []byte                    // Framed datagram not read yet
+	writeBuf  []byte                    // Start of the framed datagram written
+}
+
+func newDatagramConn(local, remote net.Addr) *datagramConn {
+	return &datagramConn{local: local, remote: remote, wake: make(chan struct{}, 1)}
+}
+
+func (c *datagramConn) Read(p []byte) (int, error) {
+	if len(c.readBuf) == 0 {
+		var deadline time.Time
+		if d := c.deadline.Load(); d != nil {
+			deadline = *d
+		}
+		datagram, err := c.receive(deadline)
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = binary.BigEndian.AppendUint16(nil, uint16(len(datagram)))
+		c.readBuf = append(c.readBuf, datagram...)
+	}
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *datagramConn) Write(p []byte) (int, error) {
+	c.writeBuf = append(c.writeBuf, p...)
+	for len(c.writeBuf) >= 2 {
+		size := int(binary.BigEndian.Uint16(c.writeBuf))
+		if len(c.writeBuf) < 2+size {
+			break
+		}
+		err := c.send(c.writeBuf[2 : 2+size])
+		c.writeBuf = c.writeBuf[2+size:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *datagramConn) Close() error {
+	return c.close()
+}
+
+func (c *datagramConn) LocalAddr() net.Addr  { return c.local }
+func (c *datagramConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *datagramConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *datagramConn) SetReadDeadline(t time.Time) error {
+	c.deadline.Store(&t)
+	if c.interrupt != nil {
+		c.interrupt(t)
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetWriteDeadline does nothing, as datagrams are sent without blocking.
+func (c *datagramConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// udpListener accepts the clients of a UDP proxy: each address sending
+// datagrams to the listen address is a connection.
+type udpListener struct {
+	conn    *net.UDPConn
+	accept  chan *datagramConn
+	lock    sync.Mutex
+	clients map[string]chan []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func listenUDP(address string) (net.Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	listener := &udpListener{
+		conn:    conn,
+		accept:  make(chan *datagramConn),
+		clients: make(map[string]chan []byte),
+		closed:  make(chan struct{}),
+	}
+	go listener.read()
+	return listener, nil
+}
+
+// read dispatches the datagrams received to the connections of their client,
+// and accepts the new clients.
+func (l *udpListener) read() {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		n, addr, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			l.Close()
+			return
+		}
+		datagram := append([]byte(nil), buf[:n]...)
+
+		l.lock.Lock()
+		queue, ok := l.clients[addr.String()]
+		if !ok {
+			queue = make(chan []byte, udpQueue)
+			l.clients[addr.String()] = queue
+		}
+		l.lock.Unlock()
+		select {
+		case queue <- datagram:
+		default:
+			// The client sends faster than its connection goes.
+		}
+		if ok {
+			continue
+		}
+
+		select {
+		case l.accept <- l.client(addr, queue):
+		case <-l.closed:
+			return
+		}
+	}
+}
+
+// client returns the connection of a new client.
+func (l *udpListener) client(addr *net.UDPAddr, queue chan []byte) *datagramConn {
+	conn := newDatagramConn(l.conn.LocalAddr(), addr)
+	done := make(chan struct{})
+	conn.receive = func(deadline time.Time) ([]byte, error) {
+		return receiveDatagram(queue, done, conn.wake, &conn.deadline, deadline)
+	}
+	conn.send = func(datagram []byte) error {
+		_, err := l.conn.WriteToUDP(datagram, addr)
+		return err
+	}
+	var once sync.Once
+	conn.close = func() error {
+		once.Do(func() {
+			l.lock.Lock()
+			// A datagram of the client received from now on is a new client.
+			if l.clients[addr.String()] == queue {
+				delete(l.clients, addr.String())
+			}
+			l.lock.Unlock()
+			close(done)
+		})
+		return nil
+	}
+	return conn
+}
+
+// receiveDatagram waits for the next datagram of a client until the connection
+// is closed or the read deadline is reached.
+func receiveDatagram(
+	queue chan []byte,
+	done chan struct{},
+	wake chan struct{},
+	current *atomic.Pointer[time.Time],
+	deadline time.Time,
+) ([]byte, error) {
+	for {
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case datagram := <-queue:
+			return datagram, nil
+		case <-done:
+			return nil, io.EOF
+		case <-timeout:
+		case <-wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		deadline = time.Time{}
+		if d := current.Load(); d != nil {
+			deadline = *d
+		}
+	}
+}
+
+func (l *udpListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *udpListener) Close() error {
+	err := net.ErrClosed
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.conn.Close()
+	})
+	return err
+}
+
+func (l *udpListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// dialUDP opens a UDP socket to the upstream of a UDP proxy, over which the
+// datagrams of a client are sent.
+func dialUDP(bind UpstreamBind) DialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		dialer := bind.dialer("udp")
+		upstream, err := dialer.DialContext(ctx, "udp", address)
+		if err != nil {
+			return nil, err
+		}
+		conn := newDatagramConn(upstream.LocalAddr(), upstream.RemoteAddr())
+		buf := make([]byte, udpMaxDatagram)
+		conn.receive = func(deadline time.Time) ([]byte, error) {
+			upstream.SetReadDeadline(deadline)
+			for {
+				n, err := upstream.Read(buf)
+				// Refused when nothing listens on the upstream, for a datagram
+				// sent before; the next ones may be answered.
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				return buf[:n], nil
+			}
+		}
+		conn.send = func(datagram []byte) error {
+			_, err := upstream.Write(datagram)
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				return nil
+			}
+			return err
+		}
+		conn.interrupt = func(t time.Time) { upstream.SetReadDeadline(t) }
+		conn.close = upstream.Close
+		return conn, nil
+	}
+}
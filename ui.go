@@ -0,0 +1,45 @@
+package toxiproxy
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// The page of the web UI, which uses the API from the browser.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// Header of the requests of the web UI. Browsers can't send it to the API
+// from another origin without a preflight request the server doesn't allow,
+// so that the requests with it are from the page of the UI.
+const uiHeader = "X-Toxiproxy-UI"
+
+// uiRoutes adds the page of the web UI to r.
+func (server *ApiServer) uiRoutes(r *mux.Router) {
+	r.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).
+		Methods("GET").Name("UIRedirect")
+	r.HandleFunc("/ui/", server.UIShow).Methods("GET").Name("UIShow")
+}
+
+// uiRequest reports whether a request is for the web UI or from it, which
+// browsers can make when the server serves the UI.
+func (server *ApiServer) uiRequest(r *http.Request) bool {
+	return server.UI && (strings.HasPrefix(r.URL.Path, "/ui") || r.Header.Get(uiHeader) != "")
+}
+
+func (server *ApiServer) UIShow(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	response.Header().Set("Content-Security-Policy",
+		"default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; "+
+			"connect-src 'self'; frame-ancestors 'none'")
+	_, err := response.Write(uiPage)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("UIShow: Failed to write response to client")
+	}
+}
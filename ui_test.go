@@ -0,0 +1,63 @@
+package toxiproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestUIRoutesRequireUI(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()))
+
+	resp := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, browserRequest("GET", "/ui/", ""))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without the UI, got %d", resp.Code)
+	}
+
+	req := browserRequest("GET", "/proxies", "")
+	req.Header.Set(uiHeader, "1")
+	resp = httptest.NewRecorder()
+	srv.Routes().ServeHTTP(resp, req)
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("Expected the browser to be rejected without the UI, got %d", resp.Code)
+	}
+}
+
+func TestUIServesThePageAndItsRequests(t *testing.T) {
+	srv := New(WithLogger(zerolog.Nop()))
+	srv.UI = true
+	routes := srv.Routes()
+
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, browserRequest("GET", "/ui", ""))
+	if resp.Code != http.StatusMovedPermanently || resp.Header().Get("Location") != "/ui/" {
+		t.Errorf("Expected /ui to redirect to /ui/, got %d %q", resp.Code, resp.Header().Get("Location"))
+	}
+
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, browserRequest("GET", "/ui/", ""))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected the page of the UI, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), uiHeader) {
+		t.Error("Expected the page to send the header of the UI")
+	}
+
+	req := browserRequest("GET", "/proxies", "")
+	req.Header.Set(uiHeader, "1")
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected the requests of the UI to be allowed, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, browserRequest("POST", "/reset", "http://evil.example"))
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("Expected the other requests of browsers to be rejected, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,198 @@
+package toxiproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// Bounds of the time a request waits for the conditions of a proxy, checked
+// every waitInterval.
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+	waitInterval       = 10 * time.Millisecond
+)
+
+// waitOperators are the comparisons of a condition, the ones of two
+// characters first so that >= is not read as >.
+var waitOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// waitCounters are the counters of a proxy a condition can compare, by their
+// names in the stats of the proxy.
+var waitCounters = map[string]func(ProxyCounters) int64{
+	"connections":          func(c ProxyCounters) int64 { return c.Connections },
+	"rejected_connections": func(c ProxyCounters) int64 { return c.RejectedConnections },
+	"idle_timeouts":        func(c ProxyCounters) int64 { return c.IdleTimeouts },
+	"age_timeouts":         func(c ProxyCounters) int64 { return c.AgeTimeouts },
+	"upstream_bytes":       func(c ProxyCounters) int64 { return c.UpstreamBytes },
+	"downstream_bytes":     func(c ProxyCounters) int64 { return c.DownstreamBytes },
+	"blocked_reads":        func(c ProxyCounters) int64 { return c.BlockedReads },
+	"buffered_bytes":       func(c ProxyCounters) int64 { return c.BufferedBytes },
+	"dropped_bytes":        func(c ProxyCounters) int64 { return c.DroppedBytes },
+	"hung_connections":     func(c ProxyCounters) int64 { return c.HungConnections },
+}
+
+// waitCondition compares a counter of a proxy with a value, written like
+// connections==0 or downstream_bytes>=1024.
+type waitCondition struct {
+	counter  string
+	operator string
+	value    int64
+}
+
+func parseWaitCondition(condition string) (waitCondition, error) {
+	condition = strings.ReplaceAll(condition, " ", "")
+	for _, operator := range waitOperators {
+		counter, value, ok := strings.Cut(condition, operator)
+		if !ok {
+			continue
+		}
+		if _, ok := waitCounters[counter]; !ok {
+			return waitCondition{}, fmt.Errorf("%q is not a counter of the proxy", counter)
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return waitCondition{}, fmt.Errorf("%q is not an integer", value)
+		}
+		return waitCondition{counter, operator, number}, nil
+	}
+	return waitCondition{}, fmt.Errorf(
+		"%q should compare a counter with ==, !=, >=, <=, > or <", condition,
+	)
+}
+
+func (c waitCondition) met(counters ProxyCounters) bool {
+	value := waitCounters[c.counter](counters)
+	switch c.operator {
+	case "==":
+		return value == c.value
+	case "!=":
+		return value != c.value
+	case ">=":
+		return value >= c.value
+	case "<=":
+		return value <= c.value
+	case ">":
+		return value > c.value
+	}
+	return value < c.value
+}
+
+// ProxyWait blocks until the counters of a proxy meet all the conditions of
+// the request, e.g. connections==0 once its connections are drained, so that
+// tests do not have to poll the server.
+func (server *ApiServer) ProxyWait(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if len(query["condition"]) == 0 {
+		server.apiError(response, joinError(fmt.Errorf("a condition is required"), ErrInvalidWait))
+		return
+	}
+	conditions := make([]waitCondition, 0, len(query["condition"]))
+	for _, value := range query["condition"] {
+		condition, err := parseWaitCondition(value)
+		if err != nil {
+			server.apiError(response, joinError(err, ErrInvalidWait))
+			return
+		}
+		conditions = append(conditions, condition)
+	}
+
+	timeout := defaultWaitTimeout
+	if value := query.Get("timeout"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout < 0 || timeout > maxWaitTimeout {
+			server.apiError(response, joinError(
+				fmt.Errorf("the timeout should be a duration up to %s", maxWaitTimeout),
+				ErrInvalidWait,
+			))
+			return
+		}
+	}
+
+	proxy, err := server.proxy(request)
+	if server.apiError(response, err) {
+		return
+	}
+	// The wait is not cut by the write timeout of the other requests.
+	_ = http.NewResponseController(response).SetWriteDeadline(
+		time.Now().Add(timeout + wait_timeout),
+	)
+
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for {
+		counters := proxy.Stats.Counters()
+		unmet := unmetCondition(conditions, counters)
+		if unmet == nil {
+			server.writeWaitResult(response, request, proxy.Name, counters)
+			return
+		}
+
+		select {
+		case <-request.Context().Done():
+			return
+		case <-deadline:
+			server.apiError(response, joinError(
+				fmt.Errorf("%s is %d", unmet.counter, waitCounters[unmet.counter](counters)),
+				ErrWaitTimeout,
+			))
+			return
+		case <-ticker.C:
+		}
+
+		// The proxy may have been removed while waiting.
+		proxy, err = server.proxy(request)
+		if server.apiError(response, err) {
+			return
+		}
+	}
+}
+
+// unmetCondition returns the first condition the counters do not meet, nil
+// if they meet all of them.
+func unmetCondition(conditions []waitCondition, counters ProxyCounters) *waitCondition {
+	for i := range conditions {
+		if !conditions[i].met(counters) {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+func (server *ApiServer) writeWaitResult(
+	response http.ResponseWriter,
+	request *http.Request,
+	name string,
+	counters ProxyCounters,
+) {
+	data, err := json.Marshal(struct {
+		Name  string        `json:"name"`
+		Stats ProxyCounters `json:"stats"`
+	}{name, counters})
+	if server.apiError(response, err) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	_, err = response.Write(data)
+	if err != nil {
+		log := zerolog.Ctx(request.Context())
+		log.Warn().Err(err).Msg("ProxyWait: Failed to write response to client")
+	}
+}
+
+// waitRoute tells whether a request is a wait of ProxyWait, which sets its
+// own timeout.
+func waitRoute(request *http.Request) bool {
+	route := mux.CurrentRoute(request)
+	return route != nil && route.GetName() == "ProxyWait"
+}
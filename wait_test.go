@@ -0,0 +1,107 @@
+package toxiproxy_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	tclient "github.com/Shopify/toxiproxy/v2/client"
+)
+
+func TestProxyWaitForConnections(t *testing.T) {
+	upstream, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("Failed to create TCP server:", err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", upstream.Addr().String())
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		established := make(chan error, 1)
+		go func() {
+			_, err := proxy.Wait(time.Second, "connections>=1")
+			established <- err
+		}()
+		// The wait blocks until a client connects.
+		time.Sleep(50 * time.Millisecond)
+		conn, err := net.Dial("tcp", proxy.Listen)
+		if err != nil {
+			t.Fatal("Unable to dial proxy:", err)
+		}
+		if err := <-established; err != nil {
+			t.Fatal("Expected the wait for a connection to succeed, got", err)
+		}
+
+		conn.Close()
+		stats, err := proxy.Wait(time.Second, "connections == 0", "upstream_bytes==0")
+		if err != nil {
+			t.Fatal("Expected the wait for the connections to drain to succeed, got", err)
+		}
+		if stats.Connections != 0 {
+			t.Errorf("Expected no connections, got %d", stats.Connections)
+		}
+	})
+}
+
+func TestProxyWaitTimesOut(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", "localhost:3306")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		start := time.Now()
+		_, err = proxy.Wait(50*time.Millisecond, "connections>0")
+		if !errors.Is(err, tclient.ErrWaitTimeout) {
+			t.Fatal("Expected the wait to time out, got", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the wait to stop after its timeout, took %s", elapsed)
+		}
+	})
+}
+
+func TestProxyWaitInvalidConditions(t *testing.T) {
+	WithServer(t, func(addr string) {
+		proxy, err := client.CreateProxy("mysql_master", "localhost:0", "localhost:3306")
+		if err != nil {
+			t.Fatal("Unable to create proxy:", err)
+		}
+
+		for _, conditions := range [][]string{
+			{},
+			{"connections"},
+			{"connections=0"},
+			{"toxics==0"},
+			{"connections>=many"},
+		} {
+			_, err := proxy.Wait(time.Second, conditions...)
+			if !errors.Is(err, tclient.ErrInvalidWait) {
+				t.Errorf("Expected %q to be invalid, got %v", conditions, err)
+			}
+		}
+
+		_, err = proxy.Wait(time.Hour, "connections==0")
+		if !errors.Is(err, tclient.ErrInvalidWait) {
+			t.Errorf("Expected a timeout of an hour to be invalid, got %v", err)
+		}
+	})
+}